@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accessCounter batches view and serve counts in memory so serving a gallery page does
+// not write SQLite once per thumbnail. Counts not yet flushed are lost on exit.
+type accessCounter struct {
+	mu      sync.Mutex
+	pending map[string]imageAccess
+}
+
+// newAccessCounter returns nil when tracking is disabled; a nil counter ignores records.
+func newAccessCounter(flushInterval time.Duration) *accessCounter {
+	if flushInterval <= 0 {
+		return nil
+	}
+	return &accessCounter{pending: make(map[string]imageAccess)}
+}
+
+func (c *accessCounter) record(rel string, view bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a := c.pending[rel]
+	if view {
+		a.Views++
+	} else {
+		a.Serves++
+	}
+	a.LastAccessAt = time.Now().UnixMilli()
+	c.pending[rel] = a
+}
+
+func (c *accessCounter) take() map[string]imageAccess {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	batch := c.pending
+	c.pending = make(map[string]imageAccess)
+	return batch
+}
+
+// run flushes the batched counts every interval. A failed flush puts its counts back so
+// they go out with the next one.
+func (c *accessCounter) run(store TagStore, interval time.Duration) {
+	if c == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		batch := c.take()
+		if len(batch) == 0 {
+			continue
+		}
+		if err := store.AddImageAccess(batch); err != nil {
+			logger.Warn("failed to flush image access counts", "count", len(batch), "error", err)
+			c.mu.Lock()
+			for rel, a := range batch {
+				p := c.pending[rel]
+				p.Views += a.Views
+				p.Serves += a.Serves
+				p.LastAccessAt = max(p.LastAccessAt, a.LastAccessAt)
+				c.pending[rel] = p
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// sortImagesByPopularity orders images by views, then serves, then newest first.
+func (st *appState) sortImagesByPopularity(ctx context.Context, images []imageInfo) error {
+	paths := make([]string, 0, len(images))
+	for _, img := range images {
+		paths = append(paths, img.Path)
+	}
+	start := time.Now()
+	counts, err := st.store.GetImageAccess(paths)
+	timingFrom(ctx).since("sqlite", start)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		a, b := counts[images[i].Path], counts[images[j].Path]
+		if a.Views != b.Views {
+			return a.Views > b.Views
+		}
+		if a.Serves != b.Serves {
+			return a.Serves > b.Serves
+		}
+		return images[i].MTime > images[j].MTime
+	})
+	return nil
+}
+
+// handleImageView counts one view of an image, sent by the viewer when it opens a file.
+func (st *appState) handleImageView(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body filepathRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepath is required") {
+		return
+	}
+	rel := strings.TrimPrefix(path.Clean("/"+normalizeFilepath(body.Filepath)), "/")
+	if rel == "" || !isImageFile(rel) {
+		badRequest(w, "filepath is required")
+		return
+	}
+	st.access.record(rel, true)
+	writeJSON(w, http.StatusOK, map[string]any{"success": true})
+}
+
+// handleStatsPopular returns the most viewed images and users. Counts lag by up to
+// ACCESS_FLUSH_SECONDS because they are written in batches.
+func (st *appState) handleStatsPopular(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	limit := min(parsePositiveInt(r.URL.Query().Get("limit"), 20), 100)
+	username := strings.TrimSpace(r.URL.Query().Get("user"))
+	if strings.ContainsAny(username, `/\`) {
+		badRequest(w, "Invalid username")
+		return
+	}
+	images, err := st.store.TopImageAccess(username, limit)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	users, err := st.store.TopUserAccess(limit)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"images": images, "users": users})
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const maxArchiveNameSegment = 255
+
+// errArchiveRejected marks archives refused for their content rather than for an I/O
+// failure on our side, so handlers can answer 400 instead of 500.
+var errArchiveRejected = errors.New("archive rejected")
+
+// archiveLimits bounds what reading one archive may produce. Zero means unlimited.
+type archiveLimits struct {
+	MaxEntries    int
+	MaxBytes      int64
+	MaxEntryBytes int64
+}
+
+func (st *appState) archiveLimits() archiveLimits {
+	return archiveLimits{
+		MaxEntries:    st.cfg.archiveMaxEntries,
+		MaxBytes:      st.cfg.archiveMaxBytes,
+		MaxEntryBytes: st.cfg.mediaMaxFileSize,
+	}
+}
+
+func rejectArchive(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", errArchiveRejected, fmt.Sprintf(format, args...))
+}
+
+// sanitizeArchiveName turns an entry name into a clean relative slash path. Absolute
+// paths, drive letters, ".." segments and control characters are rejected instead of
+// being rewritten, since an archive carrying them was not made for us.
+func sanitizeArchiveName(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", rejectArchive("absolute entry path %q", name)
+	}
+	parts := make([]string, 0)
+	for _, seg := range strings.Split(name, "/") {
+		switch seg {
+		case "", ".":
+			continue
+		case "..":
+			return "", rejectArchive("entry path %q leaves the archive", name)
+		}
+		if strings.IndexFunc(seg, unicode.IsControl) >= 0 {
+			return "", rejectArchive("control character in entry path %q", name)
+		}
+		if len(seg) > maxArchiveNameSegment {
+			return "", rejectArchive("entry path %q is too long", name)
+		}
+		parts = append(parts, seg)
+	}
+	if len(parts) == 0 {
+		return "", rejectArchive("empty entry path %q", name)
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// isArchiveFile reports whether the file at path starts like a ZIP, a tar or a gzip.
+func isArchiveFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 262)
+	n, _ := io.ReadFull(f, head)
+	return archiveKind(head[:n]) != ""
+}
+
+func archiveKind(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return "zip"
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return "tar"
+	}
+	return ""
+}
+
+// walkArchive calls fn with the sanitized name and content of every regular file in the
+// ZIP, tar or tar.gz at src. Directories are skipped; links and special files reject the
+// archive. Content past the limits fails the read, whatever the headers claim.
+func walkArchive(src string, limits archiveLimits, fn func(name string, r io.Reader) error) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(262)
+	w := &archiveWalker{limits: limits, fn: fn}
+	switch archiveKind(head) {
+	case "zip":
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return w.walkZip(f, info.Size())
+	case "gzip":
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return rejectArchive("invalid gzip stream: %v", err)
+		}
+		defer zr.Close()
+		return w.walkTar(zr)
+	case "tar":
+		return w.walkTar(br)
+	}
+	return rejectArchive("unsupported archive format")
+}
+
+type archiveWalker struct {
+	limits  archiveLimits
+	fn      func(name string, r io.Reader) error
+	entries int
+	total   int64
+}
+
+func (w *archiveWalker) walkZip(f io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(f, size)
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return rejectArchive("invalid zip: %v", err)
+	}
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		if mode.IsDir() || strings.HasSuffix(zf.Name, "/") {
+			continue
+		}
+		if !mode.IsRegular() {
+			return rejectArchive("entry %q is not a regular file", zf.Name)
+		}
+		if err := w.admit(zf.Name, int64(zf.UncompressedSize64)); err != nil {
+			return err
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return rejectArchive("entry %q: %v", zf.Name, err)
+		}
+		err = w.visit(zf.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *archiveWalker) walkTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && !errors.Is(err, tar.ErrInsecurePath) {
+			return rejectArchive("invalid tar: %v", err)
+		}
+		switch h.Typeflag {
+		case tar.TypeDir, tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeReg:
+		default:
+			return rejectArchive("entry %q is not a regular file", h.Name)
+		}
+		if err := w.admit(h.Name, h.Size); err != nil {
+			return err
+		}
+		if err := w.visit(h.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// admit checks an entry against the limits using its declared size, so an obviously
+// oversized archive is refused before anything is decompressed.
+func (w *archiveWalker) admit(name string, declared int64) error {
+	w.entries++
+	if w.limits.MaxEntries > 0 && w.entries > w.limits.MaxEntries {
+		return rejectArchive("more than %d entries", w.limits.MaxEntries)
+	}
+	if w.limits.MaxEntryBytes > 0 && declared > w.limits.MaxEntryBytes {
+		return rejectArchive("entry %q is larger than %d bytes", name, w.limits.MaxEntryBytes)
+	}
+	if w.limits.MaxBytes > 0 && w.total+declared > w.limits.MaxBytes {
+		return rejectArchive("content is larger than %d bytes", w.limits.MaxBytes)
+	}
+	return nil
+}
+
+func (w *archiveWalker) visit(raw string, r io.Reader) error {
+	name, err := sanitizeArchiveName(raw)
+	if err != nil {
+		return err
+	}
+	return w.fn(name, &archiveLimitReader{r: r, w: w, name: name})
+}
+
+// archiveLimitReader counts what is actually decompressed, since sizes in headers can lie.
+type archiveLimitReader struct {
+	r    io.Reader
+	w    *archiveWalker
+	name string
+	read int64
+}
+
+func (l *archiveLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	l.w.total += int64(n)
+	if limit := l.w.limits.MaxEntryBytes; limit > 0 && l.read > limit {
+		return n, rejectArchive("entry %q is larger than %d bytes", l.name, limit)
+	}
+	if limit := l.w.limits.MaxBytes; limit > 0 && l.w.total > limit {
+		return n, rejectArchive("content is larger than %d bytes", limit)
+	}
+	return n, err
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// archiveEntry is one file written into a test archive. Link entries carry their target
+// as the content.
+type archiveEntry struct {
+	name string
+	body string
+	link bool
+}
+
+func writeTestZip(t *testing.T, path string, entries []archiveEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Store}
+		h.SetMode(0o644)
+		if e.link {
+			h.SetMode(fs.ModeSymlink | 0o777)
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestTar(t *testing.T, path string, entries []archiveEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: tar.TypeReg, Format: tar.FormatPAX}
+		if e.link {
+			h = &tar.Header{Name: e.name, Mode: 0o777, Linkname: e.body, Typeflag: tar.TypeSymlink, Format: tar.FormatPAX}
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if !e.link {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestTarGz(t *testing.T, path string, entries []archiveEntry) {
+	t.Helper()
+	tarPath := path + ".tar"
+	writeTestTar(t, tarPath, entries)
+	raw, err := os.ReadFile(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var testArchiveFormats = []struct {
+	name  string
+	write func(*testing.T, string, []archiveEntry)
+}{
+	{"zip", writeTestZip},
+	{"tar", writeTestTar},
+	{"tar.gz", writeTestTarGz},
+}
+
+// collectArchive walks src and returns each entry as name=content.
+func collectArchive(src string, limits archiveLimits) ([]string, error) {
+	var got []string
+	err := walkArchive(src, limits, func(name string, r io.Reader) error {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		got = append(got, name+"="+string(b))
+		return nil
+	})
+	return got, err
+}
+
+func TestWalkArchiveRejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+	}{
+		{"parent segment", []archiveEntry{{name: "../evil.jpg", body: "x"}}},
+		{"nested parent segment", []archiveEntry{{name: "a/../../evil.jpg", body: "x"}}},
+		{"backslash parent segment", []archiveEntry{{name: `..\evil.jpg`, body: "x"}}},
+		{"absolute path", []archiveEntry{{name: "/tmp/evil.jpg", body: "x"}}},
+		{"drive letter", []archiveEntry{{name: "C:/evil.jpg", body: "x"}}},
+		{"control character", []archiveEntry{{name: "a\x1bb.jpg", body: "x"}}},
+		{"symlink", []archiveEntry{{name: "link.jpg", body: "/etc/passwd", link: true}}},
+		{"symlink then write through it", []archiveEntry{
+			{name: "ok.jpg", body: "x"},
+			{name: "dir", body: "..", link: true},
+			{name: "dir/evil.jpg", body: "x"},
+		}},
+	}
+	for _, format := range testArchiveFormats {
+		for _, tt := range tests {
+			t.Run(format.name+"/"+tt.name, func(t *testing.T) {
+				src := filepath.Join(t.TempDir(), "in."+format.name)
+				format.write(t, src, tt.entries)
+
+				got, err := collectArchive(src, archiveLimits{})
+				if !errors.Is(err, errArchiveRejected) {
+					t.Fatalf("walkArchive error = %v, want errArchiveRejected", err)
+				}
+				for _, entry := range got {
+					if strings.Contains(entry, "evil") || strings.Contains(entry, "link") {
+						t.Fatalf("walkArchive passed on %q", entry)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestWalkArchiveEntries(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "a.jpg", body: "a"},
+		{name: "./sub/b.jpg", body: "bb"},
+		{name: `win\c.jpg`, body: "c"},
+	}
+	want := []string{"a.jpg=a", "sub/b.jpg=bb", "win/c.jpg=c"}
+	for _, format := range testArchiveFormats {
+		t.Run(format.name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "in."+format.name)
+			format.write(t, src, entries)
+
+			got, err := collectArchive(src, archiveLimits{})
+			if err != nil {
+				t.Fatalf("walkArchive: %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Fatalf("entries = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWalkArchiveLimits(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "a.jpg", body: "aaaa"},
+		{name: "b.jpg", body: "bbbb"},
+		{name: "c.jpg", body: "cccc"},
+	}
+	tests := []struct {
+		name    string
+		limits  archiveLimits
+		wantErr string
+	}{
+		{"entries", archiveLimits{MaxEntries: 2}, "more than 2 entries"},
+		{"entry bytes", archiveLimits{MaxEntryBytes: 3}, `entry "a.jpg" is larger than 3 bytes`},
+		{"total bytes", archiveLimits{MaxBytes: 10}, "content is larger than 10 bytes"},
+		{"within limits", archiveLimits{MaxEntries: 3, MaxEntryBytes: 4, MaxBytes: 12}, ""},
+	}
+	for _, format := range testArchiveFormats {
+		for _, tt := range tests {
+			t.Run(format.name+"/"+tt.name, func(t *testing.T) {
+				src := filepath.Join(t.TempDir(), "in."+format.name)
+				format.write(t, src, entries)
+
+				_, err := collectArchive(src, tt.limits)
+				if tt.wantErr == "" {
+					if err != nil {
+						t.Fatalf("walkArchive: %v", err)
+					}
+					return
+				}
+				if !errors.Is(err, errArchiveRejected) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("walkArchive error = %v, want %q", err, tt.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestWalkArchiveRejectsUnknownFormat(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "in.txt")
+	if err := os.WriteFile(src, []byte("not an archive"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := walkArchive(src, archiveLimits{}, func(string, io.Reader) error { return nil }); !errors.Is(err, errArchiveRejected) {
+		t.Fatalf("walkArchive error = %v, want errArchiveRejected", err)
+	}
+}
+
+func TestSanitizeArchiveName(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "a/b.jpg", want: "a/b.jpg"},
+		{in: "./a//b.jpg", want: "a/b.jpg"},
+		{in: `a\b.jpg`, want: "a/b.jpg"},
+		{in: "../b.jpg", wantErr: true},
+		{in: "a/../../b.jpg", wantErr: true},
+		{in: "/b.jpg", wantErr: true},
+		{in: `\b.jpg`, wantErr: true},
+		{in: "D:b.jpg", wantErr: true},
+		{in: "./", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := sanitizeArchiveName(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, errArchiveRejected) {
+				t.Errorf("sanitizeArchiveName(%q) error = %v, want errArchiveRejected", tt.in, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("sanitizeArchiveName(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
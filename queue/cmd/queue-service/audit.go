@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	auditLogKey = "xmd:audit-log"
+	// auditLogMax bounds the audit list; older entries are dropped first.
+	auditLogMax = 1000
+)
+
+// auditEntry records an operator action that bypassed the normal task flow.
+type auditEntry struct {
+	Time       string         `json:"time"`
+	Action     string         `json:"action"`
+	RemoteAddr string         `json:"remote_addr"`
+	Details    map[string]any `json:"details,omitempty"`
+}
+
+// recordAudit appends an entry to the audit list and the log. A failed write is only
+// logged, the action itself has already happened.
+func (st *appState) recordAudit(ctx context.Context, r *http.Request, action string, details map[string]any) {
+	entry := auditEntry{
+		Time:       time.Now().UTC().Format(time.RFC3339),
+		Action:     action,
+		RemoteAddr: r.RemoteAddr,
+		Details:    details,
+	}
+	logger.Info("audit", "action", action, "remote_addr", r.RemoteAddr, "details", details)
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := st.redis.RPush(ctx, auditLogKey, raw).Err(); err != nil {
+		logger.Warn("failed to record audit entry", "action", action, "error", err)
+		return
+	}
+	st.redis.LTrim(ctx, auditLogKey, -auditLogMax, -1)
+}
+
+// handleAuditLog serves GET /api/admin/audit, newest entry first.
+func (st *appState) handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	limit := min(parsePositiveInt(r.URL.Query().Get("limit"), 100), auditLogMax)
+	raws, err := st.redis.LRange(r.Context(), auditLogKey, int64(-limit), -1).Result()
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	items := make([]auditEntry, 0, len(raws))
+	for i := len(raws) - 1; i >= 0; i-- {
+		var entry auditEntry
+		if json.Unmarshal([]byte(raws[i]), &entry) == nil {
+			items = append(items, entry)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
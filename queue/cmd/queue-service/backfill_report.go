@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+const (
+	backfillStateTTL = 7 * 24 * time.Hour
+	// maxBackfillProblems bounds the tweets listed by name in a report; the counters
+	// still cover all of them.
+	maxBackfillProblems = 500
+
+	backfillSaved      = "saved"
+	backfillSkipped    = "skipped"
+	backfillFailed     = "failed"
+	backfillNoMedia    = "no_media"
+	backfillRestricted = "restricted"
+	backfillCancelled  = "cancelled"
+)
+
+// backfillReport summarizes a whole-profile download once the timeline task has listed
+// the profile and every tweet download it queued has finished. Tweet counts are by
+// outcome; media counts add up the media of all tweets.
+type backfillReport struct {
+	TaskID           string            `json:"task_id"`
+	Username         string            `json:"username"`
+	StartedAt        string            `json:"started_at"`
+	CompletedAt      string            `json:"completed_at"`
+	Pages            int               `json:"pages"`
+	TweetsFound      int               `json:"tweets_found"`
+	TweetsQueued     int               `json:"tweets_queued"`
+	TweetsSaved      int               `json:"tweets_saved"`
+	TweetsSkipped    int               `json:"tweets_skipped"`
+	TweetsFailed     int               `json:"tweets_failed"`
+	TweetsNoMedia    int               `json:"tweets_no_media"`
+	TweetsRestricted int               `json:"tweets_restricted"`
+	TweetsCancelled  int               `json:"tweets_cancelled"`
+	MediaSaved       int               `json:"media_saved"`
+	MediaSkipped     int               `json:"media_skipped"`
+	MediaFailed      int               `json:"media_failed"`
+	ListingError     string            `json:"listing_error,omitempty"`
+	Problems         []backfillProblem `json:"problems,omitempty"`
+}
+
+// backfillProblem is a tweet of the report that failed, was restricted or was cancelled.
+type backfillProblem struct {
+	TaskID  string `json:"task_id"`
+	URL     string `json:"url,omitempty"`
+	Outcome string `json:"outcome"`
+	Message string `json:"message,omitempty"`
+}
+
+func backfillKey(taskID string) string         { return backfillStatePrefix + taskID }
+func backfillProblemsKey(taskID string) string { return backfillStatePrefix + taskID + ":problems" }
+
+// startBackfill registers a timeline task so the downloads it queues report back to it.
+// A resumed task keeps its counters.
+func (st *appState) startBackfill(ctx context.Context, taskID, username string) {
+	pipe := st.redis.TxPipeline()
+	pipe.HSetNX(ctx, backfillKey(taskID), "username", username)
+	pipe.HSetNX(ctx, backfillKey(taskID), "started_at", time.Now().UTC().Format(time.RFC3339))
+	pipe.Expire(ctx, backfillKey(taskID), backfillStateTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Warn("failed to start backfill report", "task_id", taskID, "error", err)
+	}
+}
+
+// addBackfillTweets counts the tweets of one timeline page and how many were queued.
+func (st *appState) addBackfillTweets(ctx context.Context, taskID string, found, queued int) {
+	pipe := st.redis.TxPipeline()
+	pipe.HIncrBy(ctx, backfillKey(taskID), "tweets_found", int64(found))
+	pipe.HIncrBy(ctx, backfillKey(taskID), "tweets_queued", int64(queued))
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Warn("failed to count backfill tweets", "task_id", taskID, "error", err)
+	}
+}
+
+// finishBackfillListing records that the timeline task will queue nothing more, either
+// because it listed the whole profile or because it gave up with listingErr.
+func (st *appState) finishBackfillListing(ctx context.Context, taskID string, pages int, listingErr string) {
+	pipe := st.redis.TxPipeline()
+	pipe.HSet(ctx, backfillKey(taskID), "listed", "1", "pages", pages, "listing_error", listingErr)
+	all := pipe.HGetAll(ctx, backfillKey(taskID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Warn("failed to finish backfill listing", "task_id", taskID, "error", err)
+		return
+	}
+	st.completeBackfillIfDone(ctx, taskID, all.Val())
+}
+
+// recordBackfillChild counts the outcome of a download queued by a timeline task once it
+// is final, i.e. err is nil or will not be retried. The outcome is read back from the
+// state the download left, so every exit path of the worker is covered.
+func (st *appState) recordBackfillChild(ctx context.Context, parentID, taskID, url string, err error) {
+	if err != nil && !errors.Is(err, asynq.SkipRetry) && retriesLeft(ctx) {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	if username, _ := st.redis.HGet(ctx, backfillKey(parentID), "username").Result(); username == "" {
+		// Children of thread and quote expansion have a parent too, but no report.
+		return
+	}
+	outcome, message := backfillFailed, ""
+	saved, skipped, failed := 0, 0, 0
+	if rec, ok := getTaskState(ctx, st.redis, taskID); ok {
+		result, _ := rec.Result.(map[string]any)
+		message, _ = stringFromAny(result["message"])
+		switch rec.Status {
+		case "SUCCESS":
+			saved, _ = intFromAny(result["downloaded_count"])
+			skipped, _ = intFromAny(result["skipped_count"])
+			failed, _ = intFromAny(result["failed_count"])
+			switch code, _ := stringFromAny(result["message_code"]); {
+			case saved > 0:
+				outcome = backfillSaved
+			case code == msgDownloadNoImages:
+				outcome = backfillNoMedia
+			case failed > 0:
+				outcome = backfillFailed
+			default:
+				outcome = backfillSkipped
+			}
+		case taskStateCancelled:
+			outcome = backfillCancelled
+		default:
+			if isRestrictedMessage(message) {
+				outcome = backfillRestricted
+			}
+		}
+	}
+
+	pipe := st.redis.TxPipeline()
+	pipe.HIncrBy(ctx, backfillKey(parentID), "tweets_"+outcome, 1)
+	pipe.HIncrBy(ctx, backfillKey(parentID), "media_saved", int64(saved))
+	pipe.HIncrBy(ctx, backfillKey(parentID), "media_skipped", int64(skipped))
+	pipe.HIncrBy(ctx, backfillKey(parentID), "media_failed", int64(failed))
+	pipe.HIncrBy(ctx, backfillKey(parentID), "tweets_done", 1)
+	if outcome == backfillFailed || outcome == backfillRestricted || outcome == backfillCancelled {
+		problem := strings.Join([]string{taskID, url, outcome, message}, "\t")
+		pipe.RPush(ctx, backfillProblemsKey(parentID), problem)
+		pipe.LTrim(ctx, backfillProblemsKey(parentID), 0, maxBackfillProblems-1)
+		pipe.Expire(ctx, backfillProblemsKey(parentID), backfillStateTTL)
+	}
+	all := pipe.HGetAll(ctx, backfillKey(parentID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Warn("failed to record backfill outcome", "task_id", parentID, "child_task_id", taskID, "error", err)
+		return
+	}
+	st.completeBackfillIfDone(ctx, parentID, all.Val())
+}
+
+// isRestrictedMessage tells failures of tweets that cannot be read, such as protected,
+// deleted or age-restricted ones, from transient errors.
+func isRestrictedMessage(message string) bool {
+	m := strings.ToLower(message)
+	for _, s := range []string{"unavailable", "status=401", "status=403", "status=404"} {
+		if strings.Contains(m, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// completeBackfillIfDone writes the report once the listing is done and every queued
+// tweet has reported; HSETNX makes sure only the last of concurrent callers does.
+func (st *appState) completeBackfillIfDone(ctx context.Context, taskID string, vals map[string]string) {
+	count := func(field string) int {
+		n, _ := strconv.Atoi(vals[field])
+		return n
+	}
+	if vals["listed"] != "1" || count("tweets_done") < count("tweets_queued") {
+		return
+	}
+	pipe := st.redis.TxPipeline()
+	first := pipe.HSetNX(ctx, backfillKey(taskID), "reported", "1")
+	if _, err := pipe.Exec(ctx); err != nil || !first.Val() {
+		return
+	}
+	report := backfillReport{
+		TaskID:           taskID,
+		Username:         vals["username"],
+		StartedAt:        vals["started_at"],
+		CompletedAt:      time.Now().UTC().Format(time.RFC3339),
+		Pages:            count("pages"),
+		TweetsFound:      count("tweets_found"),
+		TweetsQueued:     count("tweets_queued"),
+		TweetsSaved:      count("tweets_" + backfillSaved),
+		TweetsSkipped:    count("tweets_" + backfillSkipped),
+		TweetsFailed:     count("tweets_" + backfillFailed),
+		TweetsNoMedia:    count("tweets_" + backfillNoMedia),
+		TweetsRestricted: count("tweets_" + backfillRestricted),
+		TweetsCancelled:  count("tweets_" + backfillCancelled),
+		MediaSaved:       count("media_saved"),
+		MediaSkipped:     count("media_skipped"),
+		MediaFailed:      count("media_failed"),
+		ListingError:     vals["listing_error"],
+	}
+	problems, _ := st.redis.LRange(ctx, backfillProblemsKey(taskID), 0, -1).Result()
+	for _, p := range problems {
+		fields := strings.SplitN(p, "\t", 4)
+		if len(fields) == 4 {
+			report.Problems = append(report.Problems, backfillProblem{TaskID: fields[0], URL: fields[1], Outcome: fields[2], Message: fields[3]})
+		}
+	}
+
+	state := "SUCCESS"
+	if report.ListingError != "" {
+		state = "FAILURE"
+	}
+	saveTaskResult(ctx, st.redis, taskID, taskTypeDownloadTimeline, state, report)
+	setTaskState(ctx, st.redis, taskID, state, withMessage(map[string]any{
+		"success":        state == "SUCCESS",
+		"username":       report.Username,
+		"pages":          report.Pages,
+		"enqueued_count": report.TweetsQueued,
+		"report_ready":   true,
+	}, "message", msgBackfillReport, report.Username, report.TweetsFound, report.MediaSaved, report.MediaSkipped,
+		report.TweetsFailed, report.TweetsNoMedia, report.TweetsRestricted))
+	logger.Info("backfill report ready",
+		"task_id", taskID,
+		"username", report.Username,
+		"tweets_found", report.TweetsFound,
+		"tweets_queued", report.TweetsQueued,
+		"media_saved", report.MediaSaved,
+		"media_skipped", report.MediaSkipped,
+		"tweets_failed", report.TweetsFailed,
+		"tweets_no_media", report.TweetsNoMedia,
+		"tweets_restricted", report.TweetsRestricted,
+	)
+}
+
+// backfillReportFor returns the report of a finished timeline task, if it has one.
+func (st *appState) backfillReportFor(ctx context.Context, taskID string) *backfillReport {
+	rec, ok := getTaskResult(ctx, st.redis, taskID)
+	if !ok || rec.TaskType != taskTypeDownloadTimeline {
+		return nil
+	}
+	var report backfillReport
+	if err := json.Unmarshal(rec.Result, &report); err != nil || report.TaskID == "" {
+		return nil
+	}
+	return &report
+}
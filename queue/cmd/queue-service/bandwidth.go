@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// bandwidthChunk bounds a single read so throttled transfers advance smoothly instead of
+// sleeping once per large buffer.
+const bandwidthChunk = 32 << 10
+
+// byteRateLimiter is a token bucket counted in bytes. Reads may take more than the bucket
+// holds; the debt is paid by waiting, so any chunk size works at any rate.
+type byteRateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newByteRateLimiter returns nil, meaning unlimited, for a non-positive rate.
+func newByteRateLimiter(bytesPerSecond int64) *byteRateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSecond)
+	return &byteRateLimiter{rate: rate, tokens: rate, last: time.Now()}
+}
+
+func (l *byteRateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	// One second of transfer may burst after an idle period.
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+func (l *byteRateLimiter) waitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	d := l.reserve(n)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type taskRateLimiterKey struct{}
+
+// withTaskRateLimiter attaches the per-task DOWNLOAD_TASK_RATE_LIMIT bucket shared by
+// every media item of one download task.
+func withTaskRateLimiter(ctx context.Context, l *byteRateLimiter) context.Context {
+	if l == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, taskRateLimiterKey{}, l)
+}
+
+func taskRateLimiterFrom(ctx context.Context) *byteRateLimiter {
+	l, _ := ctx.Value(taskRateLimiterKey{}).(*byteRateLimiter)
+	return l
+}
+
+// rateLimitedReader throttles r by every non-nil limiter.
+type rateLimitedReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*byteRateLimiter
+}
+
+// throttleReader wraps r with the global and per-task download limits, returning r as is
+// when neither is set.
+func (st *appState) throttleReader(ctx context.Context, r io.Reader) io.Reader {
+	limiters := make([]*byteRateLimiter, 0, 2)
+	for _, l := range []*byteRateLimiter{st.downloadRateLimiter, taskRateLimiterFrom(ctx)} {
+		if l != nil {
+			limiters = append(limiters, l)
+		}
+	}
+	if len(limiters) == 0 {
+		return r
+	}
+	return &rateLimitedReader{ctx: ctx, r: r, limiters: limiters}
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > bandwidthChunk {
+		p = p[:bandwidthChunk]
+	}
+	n, err := r.r.Read(p)
+	for _, l := range r.limiters {
+		if werr := l.waitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+// borderUniformRatio is the share of a row or column that has to match the border color.
+// It leaves room for JPEG noise and a stray watermark pixel.
+const borderUniformRatio = 0.99
+
+// detectBorders looks for solid bands along each edge, as left by screenshots and
+// letterboxed video frames, and returns the area inside them. Bands thinner than 1% of
+// the image (at least 4px) are ignored, as are images that would be trimmed to almost
+// nothing, e.g. a blank image.
+func detectBorders(img *image.RGBA, tolerance int) *cropSuggestion {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w < 16 || h < 16 {
+		return nil
+	}
+	near := func(c, ref color.RGBA) bool {
+		return absDiff(c.R, ref.R) <= tolerance && absDiff(c.G, ref.G) <= tolerance && absDiff(c.B, ref.B) <= tolerance
+	}
+	uniform := func(n int, at func(i int) color.RGBA, ref color.RGBA) bool {
+		misses, allowed := 0, int(float64(n)*(1-borderUniformRatio))
+		for i := 0; i < n; i++ {
+			if !near(at(i), ref) {
+				misses++
+				if misses > allowed {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	pixel := func(x, y int) color.RGBA { return img.RGBAAt(b.Min.X+x, b.Min.Y+y) }
+	row := func(y int) func(int) color.RGBA { return func(x int) color.RGBA { return pixel(x, y) } }
+
+	top, bottom := 0, h
+	for ref := pixel(0, 0); top < h && uniform(w, row(top), ref); top++ {
+	}
+	for ref := pixel(0, h-1); bottom > top && uniform(w, row(bottom-1), ref); bottom-- {
+	}
+	if bottom <= top {
+		return nil
+	}
+	col := func(x int) func(int) color.RGBA { return func(i int) color.RGBA { return pixel(x, top+i) } }
+	left, right := 0, w
+	for ref := pixel(0, top); left < w && uniform(bottom-top, col(left), ref); left++ {
+	}
+	for ref := pixel(w-1, top); right > left && uniform(bottom-top, col(right-1), ref); right-- {
+	}
+
+	minBand := func(size int) int { return max(4, size/100) }
+	if top < minBand(h) {
+		top = 0
+	}
+	if h-bottom < minBand(h) {
+		bottom = h
+	}
+	if left < minBand(w) {
+		left = 0
+	}
+	if w-right < minBand(w) {
+		right = w
+	}
+	if top == 0 && bottom == h && left == 0 && right == w {
+		return nil
+	}
+	if right-left < w/10 || bottom-top < h/10 {
+		return nil
+	}
+	return &cropSuggestion{X: left, Y: top, Width: right - left, Height: bottom - top, ImageWidth: w, ImageHeight: h}
+}
+
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+// detectBordersFile decodes the image at fullPath and runs detectBorders on it.
+func detectBordersFile(fullPath string, tolerance int) (*cropSuggestion, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return detectBorders(toRGBA(src), tolerance), nil
+}
+
+// recordCropSuggestion analyzes a stored image and records what it found. Formats the
+// standard library cannot decode are skipped.
+func (st *appState) recordCropSuggestion(fullPath, rel, contentHash string) (*cropSuggestion, error) {
+	if !supportsPerceptualHash(strings.ToLower(path.Ext(rel))) {
+		return nil, errBorderUnsupported
+	}
+	s, err := detectBordersFile(fullPath, st.cfg.borderTolerance)
+	if err != nil {
+		return nil, err
+	}
+	return s, st.store.RecordCropSuggestion(rel, contentHash, s)
+}
+
+var errBorderUnsupported = errors.New("image format is not supported")
+
+type detectBordersRequest struct {
+	Filepaths []string `json:"filepaths"`
+	imageFilterRequest
+}
+
+// handleDetectBorders queues border detection for images chosen by explicit filepaths or
+// by an /api/images style query, e.g. for images downloaded before BORDER_DETECT was on.
+func (st *appState) handleDetectBorders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body detectBordersRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepaths or query is required") {
+		return
+	}
+
+	ctx := r.Context()
+	var filepaths []string
+	if len(body.Filepaths) > 0 {
+		filepaths = normalizeUniqueFilepaths(body.Filepaths)
+	} else {
+		filter, err := body.imageFilterRequest.toFilter()
+		if err != nil {
+			badRequest(w, err.Error())
+			return
+		}
+		if filter.isEmpty() {
+			badRequest(w, "filepaths or query is required")
+			return
+		}
+		filepaths, err = st.selectImagePaths(ctx, filter)
+		if err != nil {
+			writeScanError(w, err)
+			return
+		}
+	}
+	images := make([]string, 0, len(filepaths))
+	for _, rel := range filepaths {
+		if supportsPerceptualHash(strings.ToLower(path.Ext(rel))) {
+			images = append(images, rel)
+		}
+	}
+	if len(images) == 0 {
+		badRequest(w, "no images matched")
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := detectBordersTaskPayload{TaskID: taskID, Filepaths: images}
+	err := st.enqueueTask(taskTypeDetectBorders, st.cfg.queueName, taskID, payload, 2*time.Hour)
+	if err != nil {
+		logger.Error("failed to enqueue border detection task",
+			"task_type", taskTypeDetectBorders,
+			"task_id", taskID,
+			"count", len(images),
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(ctx, st.redis, taskID, "PENDING", withMessage(map[string]any{
+		"total": len(images),
+	}, "message", msgBordersQueued))
+	logger.Info("border detection task queued", "task_id", taskID, "count", len(images))
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success":      true,
+		"queued":       true,
+		"task_id":      taskID,
+		"queued_count": len(images),
+		"message":      localize(ctx, msgBordersQueued),
+	})
+}
+
+func (st *appState) processDetectBordersTask(ctx context.Context, t *asynq.Task) error {
+	var payload detectBordersTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+
+	filepaths := normalizeUniqueFilepaths(payload.Filepaths)
+	total := len(filepaths)
+	records, err := st.store.GetImageRecords(filepaths)
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+	detected, clean, failed := 0, 0, 0
+	progress := newProgressThrottle(st.cfg.progressInterval)
+	for i, rel := range filepaths {
+		if err := ctx.Err(); err != nil {
+			setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+			return err
+		}
+		s, err := st.detectStoredBorders(rel, records[rel].ContentHash)
+		switch {
+		case err != nil:
+			failed++
+			logger.Warn("border detection failed", "filepath", rel, "error", err)
+		case s != nil:
+			detected++
+		default:
+			clean++
+		}
+		if progress.due(i+1 == total) {
+			setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+				"current": i + 1,
+				"total":   total,
+				"status":  fmt.Sprintf("detected:%d clean:%d failed:%d", detected, clean, failed),
+			})
+		}
+	}
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
+		"detected_count": detected,
+		"clean_count":    clean,
+		"failed_count":   failed,
+		"total":          total,
+		"current":        total,
+	}, "message", msgBordersCompleted, detected, clean, failed))
+	return nil
+}
+
+func (st *appState) detectStoredBorders(rel, contentHash string) (*cropSuggestion, error) {
+	fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+	if err != nil {
+		return nil, err
+	}
+	if contentHash == "" {
+		if contentHash, err = fileMD5(fullPath); err != nil {
+			return nil, err
+		}
+	}
+	return st.recordCropSuggestion(fullPath, rel, contentHash)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const collectionDefaultPerPage = 100
+
+type collectionRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+func (st *appState) handleCollections(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		collections, err := st.store.ListCollections()
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": collections})
+	case http.MethodPost:
+		var body collectionRequest
+		if !decodeJSONOrBadRequest(w, r, &body, "name is required") {
+			return
+		}
+		c := collection{}
+		if body.Name != nil {
+			c.Name = *body.Name
+		}
+		if body.Description != nil {
+			c.Description = *body.Description
+		}
+		st.saveCollection(w, c, http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (st *appState) saveCollection(w http.ResponseWriter, c collection, status int) {
+	if strings.TrimSpace(c.Name) == "" {
+		badRequest(w, "name is required")
+		return
+	}
+	saved, err := st.store.SaveCollection(c)
+	switch {
+	case errors.Is(err, errCollectionNameTaken):
+		writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "name": strings.TrimSpace(c.Name)})
+		return
+	case err != nil:
+		internalServerError(w)
+		return
+	}
+	logger.Info("collection saved", "id", saved.ID, "name", saved.Name)
+	writeJSON(w, status, map[string]any{"success": true, "item": saved})
+}
+
+// handleCollectionsSubroutes serves /api/collections/{id} and its images under
+// /api/collections/{id}/images.
+func (st *appState) handleCollectionsSubroutes(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/collections/"), "/")
+	idPart, sub, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id <= 0 || (sub != "" && sub != "images") {
+		http.NotFound(w, r)
+		return
+	}
+	c, found, err := st.store.GetCollection(id)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "collection not found"})
+		return
+	}
+	if sub == "images" {
+		st.handleCollectionImages(w, r, c)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, c)
+	case http.MethodPatch:
+		var body collectionRequest
+		if !decodeJSONOrBadRequest(w, r, &body, "invalid request body") {
+			return
+		}
+		if body.Name != nil {
+			c.Name = *body.Name
+		}
+		if body.Description != nil {
+			c.Description = *body.Description
+		}
+		st.saveCollection(w, c, http.StatusOK)
+	case http.MethodDelete:
+		if _, err := st.store.DeleteCollection(c.ID); err != nil {
+			internalServerError(w)
+			return
+		}
+		logger.Info("collection deleted", "id", c.ID, "name", c.Name)
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "id": c.ID})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+type collectionImagesRequest struct {
+	Filepaths []string `json:"filepaths"`
+	// Position places the given images at this index; without it new images are appended.
+	Position *int `json:"position"`
+}
+
+// handleCollectionImages lists a collection's images in order (GET), adds or moves images
+// (POST), sets the whole ordered membership (PUT) or removes images (DELETE).
+func (st *appState) handleCollectionImages(w http.ResponseWriter, r *http.Request, c collection) {
+	if r.Method == http.MethodGet {
+		st.handleCollectionImagesGet(w, r, c)
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body collectionImagesRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepaths is required") {
+		return
+	}
+	filepaths := normalizeUniqueFilepaths(body.Filepaths)
+	if len(filepaths) == 0 && r.Method != http.MethodPut {
+		badRequest(w, "filepaths is required")
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		removed, err := st.store.RemoveCollectionItems(c.ID, filepaths)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "id": c.ID, "removed": removed})
+		return
+	}
+
+	existing := make([]string, 0, len(filepaths))
+	missing := make([]string, 0)
+	for _, rel := range filepaths {
+		fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+		if err != nil {
+			badRequest(w, "invalid filepath: "+rel)
+			return
+		}
+		if info, err := os.Stat(fullPath); err != nil || info.IsDir() {
+			missing = append(missing, rel)
+			continue
+		}
+		existing = append(existing, rel)
+	}
+
+	resp := map[string]any{"success": true, "id": c.ID, "missing": missing}
+	if r.Method == http.MethodPut {
+		if err := st.store.ReplaceCollectionItems(c.ID, existing); err != nil {
+			internalServerError(w)
+			return
+		}
+		resp["count"] = len(existing)
+	} else {
+		position := -1
+		if body.Position != nil {
+			if *body.Position < 0 {
+				badRequest(w, "position must be non-negative")
+				return
+			}
+			position = *body.Position
+		}
+		added, err := st.store.AddCollectionItems(c.ID, existing, position)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		resp["added"] = added
+	}
+	logger.Info("collection images updated", "id", c.ID, "method", r.Method, "count", len(existing))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (st *appState) handleCollectionImagesGet(w http.ResponseWriter, r *http.Request, c collection) {
+	q := r.URL.Query()
+	page := parsePositiveInt(q.Get("page"), 1)
+	perPage := parsePositiveInt(q.Get("per_page"), collectionDefaultPerPage)
+	start := time.Now()
+	paths, total, err := st.store.ListCollectionItems(c.ID, (page-1)*perPage, perPage)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	tagsMap, err := st.store.GetTagsForFiles(paths)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	details, err := st.loadImageListDetails(paths)
+	timingFrom(r.Context()).since("sqlite", start)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	items := make([]imageListItem, 0, len(paths))
+	for _, p := range paths {
+		items = append(items, newImageListItem(p, tagsMap[p], nil, details))
+	}
+	writePaginatedResponse(w, items, total, perPage, page, false, 0)
+}
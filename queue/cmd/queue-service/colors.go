@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+// Color classes selected by color:mono / color:color.
+const (
+	colorClassMono  = "mono"
+	colorClassColor = "color"
+)
+
+// colorSampleSize bounds the samples taken along each axis; colorfulness is a whole-image
+// statistic, so a grid of this size is as good as every pixel.
+const colorSampleSize = 128
+
+// colorfulness scores how colorful img is with the Hasler and Süsstrunk metric on 8-bit
+// channels: 0 for grayscale, a few points for sepia or tinted paper, 15 and up for images
+// with any real color.
+func colorfulness(img image.Image) float64 {
+	b := img.Bounds()
+	stepX, stepY := max(1, b.Dx()/colorSampleSize), max(1, b.Dy()/colorSampleSize)
+	var sumRG, sumYB, sqRG, sqYB, n float64
+	for y := b.Min.Y; y < b.Max.Y; y += stepY {
+		for x := b.Min.X; x < b.Max.X; x += stepX {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			rf, gf, bf := float64(r>>8), float64(g>>8), float64(bl>>8)
+			rg := rf - gf
+			yb := (rf+gf)/2 - bf
+			sumRG += rg
+			sumYB += yb
+			sqRG += rg * rg
+			sqYB += yb * yb
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	meanRG, meanYB := sumRG/n, sumYB/n
+	varRG := max(0, sqRG/n-meanRG*meanRG)
+	varYB := max(0, sqYB/n-meanYB*meanYB)
+	return math.Sqrt(varRG+varYB) + 0.3*math.Sqrt(meanRG*meanRG+meanYB*meanYB)
+}
+
+// colorClass maps a colorfulness score to colorClassMono or colorClassColor.
+func (st *appState) colorClass(score float64) string {
+	if score < st.cfg.colorMonoThreshold {
+		return colorClassMono
+	}
+	return colorClassColor
+}
+
+// recordColorAnalysis analyzes a stored image and records its colorfulness score and
+// dominant colors. Formats the standard library cannot decode are skipped.
+func (st *appState) recordColorAnalysis(fullPath, rel, contentHash string) (float64, error) {
+	if !supportsPerceptualHash(strings.ToLower(path.Ext(rel))) {
+		return 0, errColorUnsupported
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return 0, err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return 0, err
+	}
+	score := colorfulness(img)
+	if err := st.store.RecordColorfulness(rel, contentHash, score); err != nil {
+		return score, err
+	}
+	return score, st.store.RecordDominantColors(rel, contentHash, dominantColors(img))
+}
+
+var errColorUnsupported = errors.New("image format is not supported")
+
+type analyzeColorsRequest struct {
+	Filepaths []string `json:"filepaths"`
+	imageFilterRequest
+}
+
+// handleAnalyzeColors queues color analysis for images chosen by explicit filepaths or by
+// an /api/images style query, e.g. for images downloaded before COLOR_ANALYSIS was on.
+func (st *appState) handleAnalyzeColors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body analyzeColorsRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepaths or query is required") {
+		return
+	}
+
+	ctx := r.Context()
+	var filepaths []string
+	if len(body.Filepaths) > 0 {
+		filepaths = normalizeUniqueFilepaths(body.Filepaths)
+	} else {
+		filter, err := body.imageFilterRequest.toFilter()
+		if err != nil {
+			badRequest(w, err.Error())
+			return
+		}
+		if filter.isEmpty() {
+			badRequest(w, "filepaths or query is required")
+			return
+		}
+		filepaths, err = st.selectImagePaths(ctx, filter)
+		if err != nil {
+			writeScanError(w, err)
+			return
+		}
+	}
+	images := make([]string, 0, len(filepaths))
+	for _, rel := range filepaths {
+		if supportsPerceptualHash(strings.ToLower(path.Ext(rel))) {
+			images = append(images, rel)
+		}
+	}
+	if len(images) == 0 {
+		badRequest(w, "no images matched")
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := analyzeColorsTaskPayload{TaskID: taskID, Filepaths: images}
+	err := st.enqueueTask(taskTypeAnalyzeColors, st.cfg.queueName, taskID, payload, 2*time.Hour)
+	if err != nil {
+		logger.Error("failed to enqueue color analysis task",
+			"task_type", taskTypeAnalyzeColors,
+			"task_id", taskID,
+			"count", len(images),
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(ctx, st.redis, taskID, "PENDING", withMessage(map[string]any{
+		"total": len(images),
+	}, "message", msgColorsQueued))
+	logger.Info("color analysis task queued", "task_id", taskID, "count", len(images))
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success":      true,
+		"queued":       true,
+		"task_id":      taskID,
+		"queued_count": len(images),
+		"message":      localize(ctx, msgColorsQueued),
+	})
+}
+
+func (st *appState) processAnalyzeColorsTask(ctx context.Context, t *asynq.Task) error {
+	var payload analyzeColorsTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+
+	filepaths := normalizeUniqueFilepaths(payload.Filepaths)
+	total := len(filepaths)
+	records, err := st.store.GetImageRecords(filepaths)
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+	mono, colored, failed := 0, 0, 0
+	progress := newProgressThrottle(st.cfg.progressInterval)
+	for i, rel := range filepaths {
+		if err := ctx.Err(); err != nil {
+			setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+			return err
+		}
+		score, err := st.analyzeStoredColors(rel, records[rel].ContentHash)
+		switch {
+		case err != nil:
+			failed++
+			logger.Warn("color analysis failed", "filepath", rel, "error", err)
+		case st.colorClass(score) == colorClassMono:
+			mono++
+		default:
+			colored++
+		}
+		if progress.due(i+1 == total) {
+			setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+				"current": i + 1,
+				"total":   total,
+				"status":  fmt.Sprintf("mono:%d color:%d failed:%d", mono, colored, failed),
+			})
+		}
+	}
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
+		"mono_count":   mono,
+		"color_count":  colored,
+		"failed_count": failed,
+		"total":        total,
+		"current":      total,
+	}, "message", msgColorsCompleted, mono, colored, failed))
+	return nil
+}
+
+func (st *appState) analyzeStoredColors(rel, contentHash string) (float64, error) {
+	fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+	if err != nil {
+		return 0, err
+	}
+	if contentHash == "" {
+		if contentHash, err = fileMD5(fullPath); err != nil {
+			return 0, err
+		}
+	}
+	return st.recordColorAnalysis(fullPath, rel, contentHash)
+}
@@ -1,21 +1,65 @@
 package main
 
+import "time"
+
 const (
-	taskTypeDownload        = "xmd:download_tweet_media"
-	taskTypeAutotagAll      = "xmd:autotag_all"
-	taskTypeAutotagUntagged = "xmd:autotag_untagged"
-	taskTypeReconcileDB     = "xmd:reconcile_db"
-	taskTypeDeleteUser      = "xmd:delete_user"
-	taskTypeDeleteImage     = "xmd:delete_image"
-	taskTypeDeleteImages    = "xmd:delete_images"
-	taskTypeRetagImage      = "xmd:retag_image"
-	taskTypeRetagImages     = "xmd:retag_images"
+	taskTypeDownload          = "xmd:download_tweet_media"
+	taskTypeDownloadTimeline  = "xmd:download_user_timeline"
+	taskTypeAutotagAll        = "xmd:autotag_all"
+	taskTypeAutotagUntagged   = "xmd:autotag_untagged"
+	taskTypeReconcileDB       = "xmd:reconcile_db"
+	taskTypeDeleteUser        = "xmd:delete_user"
+	taskTypeCleanupEmptyUsers = "xmd:cleanup_empty_users"
+	taskTypeNormalizeTags     = "xmd:normalize_tags"
+	taskTypeWatchlistScan     = "xmd:watchlist_scan"
+	taskTypeDeleteImage       = "xmd:delete_image"
+	taskTypeDeleteImages      = "xmd:delete_images"
+	taskTypeRetagImage        = "xmd:retag_image"
+	taskTypeRetagImages       = "xmd:retag_images"
+	taskTypeUpscaleImages     = "xmd:upscale_images"
+	taskTypeRefreshResolution = "xmd:refresh_resolution"
+	taskTypeMirrorBackfill    = "xmd:mirror_backfill"
+	taskTypePrecheckDownloads = "xmd:precheck_downloads"
+	taskTypeExportTags        = "xmd:export_tags"
+	taskTypeExportMedia       = "xmd:export_media"
+	taskTypeBuildDataset      = "xmd:build_dataset"
+	taskTypeEditImage         = "xmd:edit_image"
+	taskTypeDetectBorders     = "xmd:detect_borders"
+	taskTypeAnalyzeColors     = "xmd:analyze_colors"
+	taskTypeTaskWatchdog      = "xmd:task_watchdog"
+	taskTypeArchiveTrim       = "xmd:archive_trim"
 
 	taskListKey              = "xmd:download_task_ids"
 	taskURLHashKey           = "xmd:download_task_urls"
+	pendingDownloadSetKey    = "xmd:download_task_pending"
+	taskUserHashKey          = "xmd:download_task_users"
+	taskParentHashKey        = "xmd:download_task_parents"
+	taskRetryOfHashKey       = "xmd:download_task_retry_of"
+	taskRetriedAsHashKey     = "xmd:download_task_retried_as"
+	taskUploadHashKey        = "xmd:download_task_uploads"
+	timelineStatePrefix      = "xmd:timeline-state-"
+	backfillStatePrefix      = "xmd:backfill-"
+	downloadSavedPrefix      = "xmd:download-saved-"
 	autotagLastTask          = "xmd:autotag:last_task_id"
 	autotagDownloadStatusKey = "xmd:autotag:download:status"
 	retagLastTask            = "xmd:retag:last_task_id"
+	reconcileLastTask        = "xmd:reconcile:last_task_id"
 	taskMetaPrefix           = "xmd:task-meta-"
+	taskEventsChannel        = "xmd:task-events"
+	taskResultPrefix         = "xmd:task-result-"
+	taskCancelPrefix         = "xmd:task-cancel-"
+	deleteQueryTokenPrefix   = "xmd:delete-query-"
+	backendHealthKey         = "xmd:backend-health"
+	watchlistBackoffKey      = "xmd:watchlist:backoff_until"
 	maxTrackedTasks          = 200
+
+	taskStateTTL          = 7 * 24 * time.Hour
+	deleteQueryTokenTTL   = 15 * time.Minute
+	deleteQuerySampleSize = 20
+	reconcileStageBatch   = 500
+
+	syndicationBackendName = "syndication"
+
+	mediaTypeImage       = "image"
+	mediaTypeAnimatedGIF = "animated_gif"
 )
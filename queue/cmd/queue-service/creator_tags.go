@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tagSourceCreator marks the creator tag CREATOR_TAG adds to every download. ML re-tagging
+// keeps it.
+const tagSourceCreator = "creator"
+
+// creatorTagName is the tag naming the work of username, "artist:name" by default.
+func creatorTagName(prefix, username string) string {
+	if prefix == "" {
+		prefix = "artist"
+	}
+	return prefix + ":" + strings.ToLower(username)
+}
+
+func validateCreatorTagPrefix(prefix string) error {
+	if !tagCategoryNamePattern.MatchString(prefix) || prefix == tagCategoryGeneral {
+		return fmt.Errorf("invalid CREATOR_TAG_PREFIX %q: want a category name such as artist or creator", prefix)
+	}
+	return nil
+}
+
+// creatorTagFile tags a downloaded file with its user when CREATOR_TAG is on, so a tag
+// search finds every file of an account.
+func (st *appState) creatorTagFile(relativePath, username string) {
+	if !st.cfg.creatorTag || username == "" {
+		return
+	}
+	tags := map[string]float64{creatorTagName(st.cfg.creatorTagPrefix, username): 1}
+	if err := st.store.AddTagsWithSource(relativePath, tags, tagSourceCreator); err != nil {
+		logger.Warn("failed to save creator tag", "filepath", relativePath, "error", err)
+	}
+}
+
+type userMergeRequest struct {
+	Into string `json:"into"`
+}
+
+// handleUserMerge moves every file of username into the directory of another user, e.g.
+// after the account was renamed, and makes the old creator tag an alias of the new one so
+// a search for either finds both. Files whose name is already taken stay where they are.
+func (st *appState) handleUserMerge(w http.ResponseWriter, r *http.Request, username string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body userMergeRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "into is required") {
+		return
+	}
+	into := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(body.Into), "@"))
+	if into == "" || strings.ContainsAny(into, `/\`) || into == "." || into == ".." {
+		badRequest(w, "into must be a user name")
+		return
+	}
+	if strings.EqualFold(into, username) {
+		badRequest(w, "into must be another user")
+		return
+	}
+	fromDir, err := resolvePathUnderRoot(st.cfg.mediaRoot, username)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if info, err := os.Stat(fromDir); err != nil || !info.IsDir() {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "User not found", "username": username})
+		return
+	}
+	intoDir, err := resolvePathUnderRoot(st.cfg.mediaRoot, into)
+	if err != nil {
+		badRequest(w, "into must be a user name")
+		return
+	}
+
+	var files []string
+	err = filepath.WalkDir(fromDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Leftover .part files of interrupted downloads are not worth carrying over.
+		if d.Type().IsRegular() && !strings.HasPrefix(d.Name(), ".") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+
+	moved := 0
+	conflicts := make([]string, 0)
+	failed := make([]string, 0)
+	for _, full := range files {
+		sub, err := filepath.Rel(fromDir, full)
+		if err != nil {
+			failed = append(failed, full)
+			continue
+		}
+		rel := username + "/" + filepath.ToSlash(sub)
+		newRel := into + "/" + filepath.ToSlash(sub)
+		if err := st.moveImage(full, filepath.Join(intoDir, sub), rel, newRel); err != nil {
+			if errors.Is(err, os.ErrExist) {
+				conflicts = append(conflicts, rel)
+			} else {
+				failed = append(failed, rel)
+			}
+			continue
+		}
+		moved++
+	}
+
+	resp := map[string]any{
+		"success":     len(failed) == 0,
+		"username":    username,
+		"into":        into,
+		"moved_count": moved,
+		"conflicts":   conflicts,
+		"failed":      failed,
+	}
+	alias, err := st.store.MergeTagAlias(
+		creatorTagName(st.cfg.creatorTagPrefix, username),
+		creatorTagName(st.cfg.creatorTagPrefix, into),
+	)
+	if err != nil {
+		logger.Warn("failed to alias creator tag", "username", username, "into", into, "error", err)
+	} else {
+		resp["alias"] = alias
+	}
+	logger.Info("user merged", "username", username, "into", into, "moved", moved,
+		"conflicts", len(conflicts), "failed", len(failed))
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	cursorDefaultLimit = 100
+	cursorMaxLimit     = 500
+	// cursorScanBatch is how many index rows a cursor page reads per round while filtering.
+	cursorScanBatch = 500
+)
+
+// cursorRequest asks for one page of keyset pagination: After holds the fields of the
+// opaque cursor, nil on the first page.
+type cursorRequest struct {
+	After []string
+	Limit int
+}
+
+// parseCursorRequest returns nil when the request pages with page/per_page, i.e. has
+// neither cursor nor limit. Cursors carry fields values; the last one may contain "|".
+func parseCursorRequest(q url.Values, fields int) (*cursorRequest, error) {
+	if !q.Has("cursor") && !q.Has("limit") {
+		return nil, nil
+	}
+	req := &cursorRequest{Limit: min(parsePositiveInt(q.Get("limit"), cursorDefaultLimit), cursorMaxLimit)}
+	raw := strings.TrimSpace(q.Get("cursor"))
+	if raw == "" {
+		return req, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	req.After = strings.SplitN(string(decoded), "|", fields)
+	if len(req.After) != fields {
+		return nil, errors.New("invalid cursor")
+	}
+	return req, nil
+}
+
+func encodeCursor(fields ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(fields, "|")))
+}
+
+// writeCursorResponse is the envelope of cursor pages, like GET /api/timeline.
+func writeCursorResponse(w http.ResponseWriter, items any, nextCursor string) {
+	resp := map[string]any{"items": items, "has_more": nextCursor != ""}
+	if nextCursor != "" {
+		resp["next_cursor"] = nextCursor
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// latestBefore is the sort=latest order of images: newest first, then by path so the order
+// is total and a cursor names one position in it.
+func latestBefore(a, b imageInfo) bool {
+	if a.MTime != b.MTime {
+		return a.MTime > b.MTime
+	}
+	return a.Path < b.Path
+}
+
+func imageCursor(img imageInfo) string {
+	return encodeCursor(strconv.FormatInt(img.MTime, 10), img.Path)
+}
+
+func decodeImageCursor(fields []string) (imageInfo, error) {
+	mtime, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return imageInfo{}, errors.New("invalid cursor")
+	}
+	return imageInfo{MTime: mtime, Path: fields[1]}, nil
+}
+
+// cursorBefore is the order of image cursor pages: newest first, then by path descending,
+// matching the (mtime, filepath) keyset of the image index.
+func cursorBefore(a, b imageInfo) bool {
+	if a.MTime != b.MTime {
+		return a.MTime > b.MTime
+	}
+	return a.Path > b.Path
+}
+
+// latestImagesPage returns up to n images after the cursor in cursor order with the tags
+// the filter loaded. Once a reconcile has built the image index the page is read from it by
+// keyset, a batch at a time until enough rows pass the filter; before that the media root is
+// scanned.
+func (st *appState) latestImagesPage(ctx context.Context, f imageFilter, after *imageInfo, n int) ([]imageInfo, map[string][]imageTag, error) {
+	timing := timingFrom(ctx)
+	start := time.Now()
+	built, err := st.store.ImageIndexBuiltAt()
+	timing.since("sqlite", start)
+	if err != nil {
+		return nil, nil, err
+	}
+	if built.IsZero() {
+		allImages, allTagsMap, err := st.findImages(ctx, f)
+		if err != nil {
+			return nil, nil, err
+		}
+		return latestImagesAfter(allImages, after, n), allTagsMap, nil
+	}
+
+	var tagPaths, queryPaths map[string]struct{}
+	queryComplement := false
+	if len(f.Tags) > 0 {
+		start := time.Now()
+		paths, err := st.store.FindFilesByTagPatterns(f.Tags)
+		timing.since("sqlite", start)
+		if err != nil {
+			return nil, nil, err
+		}
+		tagPaths = pathSet(paths)
+	}
+	if f.TagQuery != nil {
+		start := time.Now()
+		paths, complement, err := st.store.FindFilesByTagQuery(f.TagQuery)
+		timing.since("sqlite", start)
+		if err != nil {
+			return nil, nil, err
+		}
+		queryPaths, queryComplement = pathSet(paths), complement
+	}
+
+	page := make([]imageInfo, 0, n)
+	pageTags := make(map[string][]imageTag)
+	pos := after
+	for len(page) < n {
+		start := time.Now()
+		batch, err := st.store.ListImagesBefore(f.User, pos, cursorScanBatch)
+		timing.since("sqlite", start)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		last := batch[len(batch)-1]
+		pos = &last
+
+		kept := make([]imageInfo, 0, len(batch))
+		for _, img := range batch {
+			if !isImageFile(img.Path) || !f.matchesMedia(img.Path) || !f.matchesTime(img.MTime) {
+				continue
+			}
+			if tagPaths != nil {
+				if _, ok := tagPaths[img.Path]; !ok {
+					continue
+				}
+			}
+			if queryPaths != nil {
+				if _, ok := queryPaths[img.Path]; ok == queryComplement {
+					continue
+				}
+			}
+			kept = append(kept, img)
+		}
+		refined, tagsMap, err := st.refineImages(ctx, f, kept)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, img := range refined {
+			if len(page) == n {
+				break
+			}
+			page = append(page, img)
+			if tags, ok := tagsMap[img.Path]; ok {
+				pageTags[img.Path] = tags
+			}
+		}
+		if len(batch) < cursorScanBatch {
+			break
+		}
+	}
+	return page, pageTags, nil
+}
+
+func pathSet(paths []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		set[p] = struct{}{}
+	}
+	return set
+}
+
+// latestImagesAfter returns up to n images that come after the cursor in cursor order,
+// sorted, without sorting all of images.
+func latestImagesAfter(images []imageInfo, after *imageInfo, n int) []imageInfo {
+	h := &latestHeap{}
+	for _, img := range images {
+		if after != nil && !cursorBefore(*after, img) {
+			continue
+		}
+		if h.Len() < n {
+			heap.Push(h, img)
+		} else if n > 0 && cursorBefore(img, (*h)[0]) {
+			(*h)[0] = img
+			heap.Fix(h, 0)
+		}
+	}
+	out := make([]imageInfo, h.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(h).(imageInfo)
+	}
+	return out
+}
+
+// latestHeap keeps the last image in cursor order on top.
+type latestHeap []imageInfo
+
+func (h latestHeap) Len() int           { return len(h) }
+func (h latestHeap) Less(i, j int) bool { return cursorBefore(h[j], h[i]) }
+func (h latestHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *latestHeap) Push(x any)        { *h = append(*h, x.(imageInfo)) }
+func (h *latestHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
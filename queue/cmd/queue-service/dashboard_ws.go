@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Dashboard topics a WebSocket client can subscribe to.
+const (
+	// dashboardTopicQueue carries the GET /api/download payload: queue depth, summary
+	// and the recently tracked tasks.
+	dashboardTopicQueue   = "queue"
+	dashboardTopicAutotag = "autotag"
+	dashboardTopicRetag   = "retag"
+	// dashboardTopicTasks carries one message per task state change.
+	dashboardTopicTasks = "tasks"
+)
+
+const (
+	// dashboardDebounce coalesces bursts of task events into one refresh of the
+	// aggregate topics.
+	dashboardDebounce = 250 * time.Millisecond
+	// dashboardRefresh re-reads the aggregate topics even without events, since queue
+	// depth also moves when asynq retries or archives tasks.
+	dashboardRefresh = 10 * time.Second
+	dashboardPing    = 30 * time.Second
+)
+
+var dashboardAggregateTopics = []string{dashboardTopicQueue, dashboardTopicAutotag, dashboardTopicRetag}
+
+// dashboardClientMessage is sent by the client:
+//
+//	{"type":"subscribe","topics":["queue","autotag","retag","tasks"],"task_ids":["..."]}
+//	{"type":"unsubscribe","topics":["tasks"]}
+//
+// task_ids, when present on subscribe, limits the tasks topic to those tasks.
+type dashboardClientMessage struct {
+	Type    string   `json:"type"`
+	Topics  []string `json:"topics"`
+	TaskIDs []string `json:"task_ids"`
+}
+
+// dashboardMessage is sent by the server. Type is a topic name for updates, or
+// "subscribed" / "error".
+type dashboardMessage struct {
+	Type    string   `json:"type"`
+	Data    any      `json:"data,omitempty"`
+	Topics  []string `json:"topics,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+type dashboardSession struct {
+	st     *appState
+	conn   *wsConn
+	topics map[string]bool
+	// taskFilter limits the tasks topic; nil means every tracked download.
+	taskFilter map[string]struct{}
+	// last holds the payload sent per aggregate topic so unchanged state is not resent.
+	last map[string][]byte
+}
+
+// handleDashboardWS serves /api/ws, multiplexing the dashboard's status feeds over one
+// WebSocket. Updates are driven by the task event channel that backs
+// /api/download/stream.
+func (st *appState) handleDashboardWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebSocket(w, r, splitCSV(st.cfg.wsAllowedOrigins))
+	if err != nil {
+		return
+	}
+	defer conn.close()
+	ctx, cancel := context.WithCancel(withLang(context.Background(), langFrom(r.Context())))
+	defer cancel()
+
+	sub := st.redis.Subscribe(ctx, taskEventsChannel)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		logger.Error("failed to subscribe to task events", "error", err)
+		_ = conn.writeJSON(dashboardMessage{Type: "error", Message: "task events unavailable"})
+		return
+	}
+
+	incoming := make(chan dashboardClientMessage)
+	go func() {
+		defer cancel()
+		for {
+			raw, err := conn.readMessage()
+			if err != nil {
+				return
+			}
+			var msg dashboardClientMessage
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				msg = dashboardClientMessage{Type: "invalid"}
+			}
+			select {
+			case incoming <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	s := &dashboardSession{st: st, conn: conn, topics: make(map[string]bool), last: make(map[string][]byte)}
+	debounce := time.NewTimer(dashboardDebounce)
+	debounce.Stop()
+	pending := false
+	refresh := time.NewTicker(dashboardRefresh)
+	defer refresh.Stop()
+	ping := time.NewTicker(dashboardPing)
+	defer ping.Stop()
+	events := sub.Channel()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-incoming:
+			err = s.handleClientMessage(ctx, msg)
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if s.topics[dashboardTopicTasks] {
+				if item, send := st.streamedTaskStatus(ctx, ev.Payload, s.taskFilter); send {
+					err = conn.writeJSON(dashboardMessage{Type: dashboardTopicTasks, Data: item})
+				}
+			}
+			if !pending {
+				pending = true
+				debounce.Reset(dashboardDebounce)
+			}
+		case <-debounce.C:
+			pending = false
+			err = s.pushAggregates(ctx, false)
+		case <-refresh.C:
+			err = s.pushAggregates(ctx, false)
+		case <-ping.C:
+			err = conn.writeFrame(wsOpPing, nil)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *dashboardSession) handleClientMessage(ctx context.Context, msg dashboardClientMessage) error {
+	switch msg.Type {
+	case "subscribe":
+		for _, t := range msg.Topics {
+			if !isDashboardTopic(t) {
+				return s.conn.writeJSON(dashboardMessage{Type: "error", Message: "unknown topic: " + t})
+			}
+		}
+		for _, t := range msg.Topics {
+			s.topics[t] = true
+		}
+		if msg.TaskIDs != nil {
+			s.taskFilter = nil
+			if len(msg.TaskIDs) > 0 {
+				s.taskFilter = make(map[string]struct{}, len(msg.TaskIDs))
+				for _, id := range msg.TaskIDs {
+					s.taskFilter[id] = struct{}{}
+				}
+			}
+		}
+		if err := s.conn.writeJSON(dashboardMessage{Type: "subscribed", Topics: s.topicList()}); err != nil {
+			return err
+		}
+		// New subscribers get the current state right away.
+		for _, t := range msg.Topics {
+			delete(s.last, t)
+		}
+		return s.pushAggregates(ctx, true)
+	case "unsubscribe":
+		for _, t := range msg.Topics {
+			delete(s.topics, t)
+			delete(s.last, t)
+		}
+		return s.conn.writeJSON(dashboardMessage{Type: "subscribed", Topics: s.topicList()})
+	default:
+		return s.conn.writeJSON(dashboardMessage{Type: "error", Message: "unknown message type"})
+	}
+}
+
+// pushAggregates sends each subscribed aggregate topic whose payload changed since it was
+// last sent. With onlyNew it sends just the topics that have not been sent yet.
+func (s *dashboardSession) pushAggregates(ctx context.Context, onlyNew bool) error {
+	for _, topic := range dashboardAggregateTopics {
+		if !s.topics[topic] {
+			continue
+		}
+		if _, sent := s.last[topic]; onlyNew && sent {
+			continue
+		}
+		var data map[string]any
+		switch topic {
+		case dashboardTopicQueue:
+			data = s.st.downloadStatusSnapshot(ctx, "")
+		case dashboardTopicAutotag:
+			data = s.st.autotagStatus(ctx)
+		case dashboardTopicRetag:
+			data = s.st.trackedTaskStatus(ctx, retagLastTask, msgRetagNone)
+		}
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(b, s.last[topic]) {
+			continue
+		}
+		s.last[topic] = b
+		if err := s.conn.writeJSON(dashboardMessage{Type: topic, Data: json.RawMessage(b)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *dashboardSession) topicList() []string {
+	topics := make([]string, 0, len(s.topics))
+	for t := range s.topics {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func isDashboardTopic(t string) bool {
+	switch t {
+	case dashboardTopicQueue, dashboardTopicAutotag, dashboardTopicRetag, dashboardTopicTasks:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/draw"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	datasetFormatDanbooru = "danbooru"
+	datasetFormatJSON     = "json"
+	datasetFormatMetadata = "metadata"
+
+	datasetCropNone   = "none"
+	datasetCropCenter = "center"
+
+	defaultDatasetValRatio = 0.1
+	maxDatasetValRatio     = 0.5
+	maxDatasetResolution   = 4096
+)
+
+type datasetRequest struct {
+	imageFilterRequest
+	MinConfidence float64 `json:"min_confidence"`
+	// Format is how tags are written: danbooru (.txt per image), json (.json per image)
+	// or metadata (one metadata.jsonl per split, as read by Hugging Face imagefolder).
+	Format string `json:"format"`
+	// Resolution caps the long side of each image, or the side of the square with crop
+	// "center". Images are never upscaled. 0 keeps the original size.
+	Resolution int    `json:"resolution"`
+	Crop       string `json:"crop"`
+	// MinSide skips images whose short side is smaller, before any cropping.
+	MinSide  int      `json:"min_side"`
+	ValRatio *float64 `json:"val_ratio"`
+	// Seed changes which images land in val. The same seed always gives the same split.
+	Seed int64 `json:"seed"`
+}
+
+func (r datasetRequest) options() (datasetOptions, error) {
+	opts := datasetOptions{
+		MinConfidence: r.MinConfidence,
+		Format:        strings.ToLower(strings.TrimSpace(r.Format)),
+		Resolution:    r.Resolution,
+		Crop:          strings.ToLower(strings.TrimSpace(r.Crop)),
+		MinSide:       r.MinSide,
+		ValRatio:      defaultDatasetValRatio,
+		Seed:          r.Seed,
+	}
+	if opts.Format == "" {
+		opts.Format = datasetFormatDanbooru
+	}
+	if opts.Crop == "" {
+		opts.Crop = datasetCropNone
+	}
+	if r.ValRatio != nil {
+		opts.ValRatio = *r.ValRatio
+	}
+	switch opts.Format {
+	case datasetFormatDanbooru, datasetFormatJSON, datasetFormatMetadata:
+	default:
+		return opts, fmt.Errorf("format must be one of %s, %s, %s", datasetFormatDanbooru, datasetFormatJSON, datasetFormatMetadata)
+	}
+	switch opts.Crop {
+	case datasetCropNone, datasetCropCenter:
+	default:
+		return opts, fmt.Errorf("crop must be %s or %s", datasetCropNone, datasetCropCenter)
+	}
+	if opts.Resolution < 0 || opts.Resolution > maxDatasetResolution {
+		return opts, fmt.Errorf("resolution must be between 0 and %d", maxDatasetResolution)
+	}
+	if opts.MinSide < 0 {
+		return opts, fmt.Errorf("min_side must not be negative")
+	}
+	if opts.ValRatio < 0 || opts.ValRatio > maxDatasetValRatio {
+		return opts, fmt.Errorf("val_ratio must be between 0 and %g", maxDatasetValRatio)
+	}
+	return opts, nil
+}
+
+// handleBuildDataset queues a training dataset archive: images matching an /api/images
+// style query, resized and cropped as requested, with tags next to them and split into
+// train/ and val/ directories. It is downloaded like a tag export.
+func (st *appState) handleBuildDataset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body datasetRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "invalid request") {
+		return
+	}
+	opts, err := body.options()
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	filter, err := body.imageFilterRequest.toFilter()
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	ctx := r.Context()
+	filepaths, err := st.selectImagePaths(ctx, filter)
+	if err != nil {
+		writeScanError(w, err)
+		return
+	}
+	if len(filepaths) == 0 {
+		badRequest(w, "no images matched")
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := datasetTaskPayload{
+		TaskID:    taskID,
+		Filepaths: filepaths,
+		Options:   opts,
+	}
+	err = st.enqueueTask(taskTypeBuildDataset, st.cfg.queueName, taskID, payload, 4*time.Hour)
+	if err != nil {
+		logger.Error("failed to enqueue dataset task",
+			"task_type", taskTypeBuildDataset,
+			"task_id", taskID,
+			"count", len(filepaths),
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(ctx, st.redis, taskID, "PENDING", withMessage(map[string]any{
+		"total": len(filepaths),
+	}, "message", msgDatasetQueued))
+	logger.Info("dataset task queued", "task_id", taskID, "count", len(filepaths), "format", opts.Format)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success":      true,
+		"queued":       true,
+		"task_id":      taskID,
+		"queued_count": len(filepaths),
+		"message":      localize(ctx, msgDatasetQueued),
+	})
+}
+
+// datasetSplit assigns an image to train or val from a hash of its path, so the split
+// stays stable when the dataset is rebuilt with more images.
+func datasetSplit(rel string, seed int64, valRatio float64) string {
+	if valRatio <= 0 {
+		return "train"
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%s", seed, rel)
+	if float64(h.Sum64()%10000)/10000 < valRatio {
+		return "val"
+	}
+	return "train"
+}
+
+// datasetImage is one image ready to be written: either the original file untouched or a
+// re-encoded copy when it had to be resized or cropped.
+type datasetImage struct {
+	ext  string
+	copy string
+	img  image.Image
+}
+
+var errDatasetTooSmall = errors.New("image is smaller than min_side")
+
+func (st *appState) prepareDatasetImage(rel string, opts datasetOptions) (datasetImage, error) {
+	full, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+	if err != nil {
+		return datasetImage{}, err
+	}
+	ext := strings.ToLower(path.Ext(rel))
+	transform := opts.Resolution > 0 || opts.Crop != datasetCropNone
+	if !transform && opts.MinSide == 0 {
+		return datasetImage{ext: ext, copy: full}, nil
+	}
+
+	f, err := os.Open(full)
+	if err != nil {
+		return datasetImage{}, err
+	}
+	defer f.Close()
+	if !transform {
+		cfg, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return datasetImage{}, err
+		}
+		if min(cfg.Width, cfg.Height) < opts.MinSide {
+			return datasetImage{}, errDatasetTooSmall
+		}
+		return datasetImage{ext: ext, copy: full}, nil
+	}
+	src, format, err := image.Decode(f)
+	if err != nil {
+		return datasetImage{}, err
+	}
+	b := src.Bounds()
+	if min(b.Dx(), b.Dy()) < opts.MinSide {
+		return datasetImage{}, errDatasetTooSmall
+	}
+	if opts.Crop == datasetCropCenter {
+		side := min(b.Dx(), b.Dy())
+		x0 := b.Min.X + (b.Dx()-side)/2
+		y0 := b.Min.Y + (b.Dy()-side)/2
+		b = image.Rect(x0, y0, x0+side, y0+side)
+	}
+	w, h := b.Dx(), b.Dy()
+	if opts.Resolution > 0 && max(w, h) > opts.Resolution {
+		if w >= h {
+			w, h = opts.Resolution, max(1, h*opts.Resolution/w)
+		} else {
+			w, h = max(1, w*opts.Resolution/h), opts.Resolution
+		}
+	}
+	out := datasetImage{ext: ".jpg", img: resizeBox(src, b, w, h)}
+	// Keep PNG lossless, everything else becomes JPEG.
+	if format == "png" {
+		out.ext = ".png"
+	}
+	return out, nil
+}
+
+// resizeBox scales the area r of src to w x h by averaging the source pixels that fall
+// into each destination pixel. That is plenty for downscaling training images.
+func resizeBox(src image.Image, r image.Rectangle, w, h int) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, r.Min, draw.Src)
+	if w == r.Dx() && h == r.Dy() {
+		return rgba
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := r.Dx(), r.Dy()
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+			var sum [4]int
+			for py := y0; py < y1; py++ {
+				row := rgba.Pix[py*rgba.Stride:]
+				for px := x0; px < x1; px++ {
+					p := row[px*4 : px*4+4]
+					sum[0] += int(p[0])
+					sum[1] += int(p[1])
+					sum[2] += int(p[2])
+					sum[3] += int(p[3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			d := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4]
+			for i := range d {
+				d[i] = uint8(sum[i] / n)
+			}
+		}
+	}
+	return dst
+}
+
+func (img datasetImage) writeTo(w io.Writer) error {
+	if img.img == nil {
+		f, err := os.Open(img.copy)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	}
+	return encodeImage(w, img.img, img.ext)
+}
+
+type datasetMetadataLine struct {
+	FileName string     `json:"file_name"`
+	Text     string     `json:"text"`
+	Tags     []imageTag `json:"tags"`
+	Source   string     `json:"source"`
+}
+
+func (st *appState) processBuildDatasetTask(ctx context.Context, t *asynq.Task) error {
+	var payload datasetTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+	opts := payload.Options
+
+	filepaths := normalizeUniqueFilepaths(payload.Filepaths)
+	total := len(filepaths)
+	archive, err := st.createExportArchive(taskID)
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+	fail := func(err error) error {
+		archive.abort()
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+
+	counts := map[string]int{"train": 0, "val": 0}
+	metadata := map[string][]datasetMetadataLine{}
+	skipped, untagged, current := 0, 0, 0
+	progress := newProgressThrottle(st.cfg.progressInterval)
+	for start := 0; start < total; start += exportTagBatch {
+		batch := filepaths[start:min(start+exportTagBatch, total)]
+		tagsMap, err := st.store.GetTagsForFiles(batch)
+		if err != nil {
+			return fail(err)
+		}
+		for _, rel := range batch {
+			if err := ctx.Err(); err != nil {
+				return fail(err)
+			}
+			current++
+			rel = filepath.ToSlash(rel)
+			tags := make([]imageTag, 0, len(tagsMap[rel]))
+			for _, tag := range tagsMap[rel] {
+				if tag.Confidence >= opts.MinConfidence {
+					tags = append(tags, tag)
+				}
+			}
+			text := exportSidecarText(tags, 0)
+			switch {
+			case text == "":
+				untagged++
+			case isVideoFile(rel):
+				skipped++
+			default:
+				img, err := st.prepareDatasetImage(rel, opts)
+				if err != nil {
+					logger.Warn("skipping dataset image", "filepath", rel, "error", err)
+					skipped++
+					break
+				}
+				split := datasetSplit(rel, opts.Seed, opts.ValRatio)
+				// Training tools expect flat directories, so the user directory becomes
+				// part of the name instead.
+				stem := strings.ReplaceAll(strings.TrimSuffix(rel, path.Ext(rel)), "/", "_")
+				name := stem + img.ext
+				w, err := createZipEntry(archive.Writer, split+"/"+name, zip.Store)
+				if err != nil {
+					return fail(err)
+				}
+				if err := img.writeTo(w); err != nil {
+					return fail(err)
+				}
+				switch opts.Format {
+				case datasetFormatDanbooru:
+					err = writeZipEntry(archive.Writer, split+"/"+stem+".txt", strings.NewReader(text+"\n"))
+				case datasetFormatJSON:
+					var data []byte
+					data, err = json.Marshal(datasetMetadataLine{FileName: name, Text: text, Tags: tags, Source: rel})
+					if err == nil {
+						err = writeZipEntry(archive.Writer, split+"/"+stem+".json", strings.NewReader(string(data)+"\n"))
+					}
+				case datasetFormatMetadata:
+					metadata[split] = append(metadata[split], datasetMetadataLine{FileName: name, Text: text, Tags: tags, Source: rel})
+				}
+				if err != nil {
+					return fail(err)
+				}
+				counts[split]++
+			}
+			if progress.due(current == total) {
+				setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+					"current": current,
+					"total":   total,
+					"status":  fmt.Sprintf("train:%d val:%d skipped:%d untagged:%d", counts["train"], counts["val"], skipped, untagged),
+				})
+			}
+		}
+	}
+	for _, split := range []string{"train", "val"} {
+		if len(metadata[split]) == 0 {
+			continue
+		}
+		var buf strings.Builder
+		enc := json.NewEncoder(&buf)
+		for _, line := range metadata[split] {
+			if err := enc.Encode(line); err != nil {
+				return fail(err)
+			}
+		}
+		if err := writeZipEntry(archive.Writer, split+"/metadata.jsonl", strings.NewReader(buf.String())); err != nil {
+			return fail(err)
+		}
+	}
+	if err := archive.commit(); err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
+		"train_count":    counts["train"],
+		"val_count":      counts["val"],
+		"skipped_count":  skipped,
+		"untagged_count": untagged,
+		"total":          total,
+		"current":        total,
+		"download_url":   fmt.Sprintf("/api/export/%s.zip", taskID),
+	}, "message", msgDatasetCompleted, counts["train"], counts["val"], skipped, untagged))
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+// precheckConcurrency bounds the syndication lookups of one pre-check task.
+const precheckConcurrency = 8
+
+// submitDownloads submits a batch of downloads and returns those that were queued, with
+// their task IDs set. When the batch holds at least DOWNLOAD_PRECHECK_MIN plain X tweet
+// URLs, those go through one pre-check task that only queues the tweets carrying media.
+// Expanded downloads skip the pre-check since a text-only tweet can still lead to media.
+func (st *appState) submitDownloads(queue string, payloads []downloadTaskPayload) []downloadTaskPayload {
+	var check, direct []downloadTaskPayload
+	for _, p := range payloads {
+		p.TaskID = uuid.NewString()
+		if st.cfg.downloadPrecheckMin > 0 && len(p.Expand) == 0 {
+			if e := st.extractorFor(p.URL); e != nil && e.Name() == extractorX {
+				check = append(check, p)
+				continue
+			}
+		}
+		direct = append(direct, p)
+	}
+	if len(check) > 0 && len(check) < st.cfg.downloadPrecheckMin {
+		direct = append(direct, check...)
+		check = nil
+	}
+
+	submitted := make([]downloadTaskPayload, 0, len(payloads))
+	if len(check) > 0 {
+		taskID := uuid.NewString()
+		payload := precheckTaskPayload{TaskID: taskID, Queue: queue, Items: check}
+		if err := st.enqueueTask(taskTypePrecheckDownloads, queue, taskID, payload, 30*time.Minute); err != nil {
+			logger.Warn("failed to enqueue download pre-check, queueing downloads directly",
+				"task_type", taskTypePrecheckDownloads,
+				"task_id", taskID,
+				"count", len(check),
+				"error", err,
+			)
+			direct = append(direct, check...)
+		} else {
+			logger.Info("download pre-check queued", "task_id", taskID, "count", len(check))
+			submitted = append(submitted, check...)
+		}
+	}
+	for _, p := range direct {
+		if _, err := st.submitDownload(queue, p); err != nil {
+			continue
+		}
+		submitted = append(submitted, p)
+	}
+	return submitted
+}
+
+// processPrecheckDownloadsTask looks up every tweet of the batch on the syndication API and
+// queues downloads only for those with media. Text-only tweets finish right away with the
+// same result a download task reports for them. Tweets that cannot be checked are queued
+// anyway so the download task can try its fallbacks.
+func (st *appState) processPrecheckDownloadsTask(ctx context.Context, t *asynq.Task) error {
+	var payload precheckTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	queue := payload.Queue
+	if queue == "" {
+		queue = st.cfg.queueName
+	}
+
+	// With authenticated lookups configured, syndication reporting no media is not
+	// conclusive, so every tweet is queued.
+	checkable := st.xAuth == nil && st.backendHealth.available(syndicationBackendName)
+	noMedia := make([]bool, len(payload.Items))
+	if checkable {
+		_ = parallelEach(ctx, len(payload.Items), precheckConcurrency, func(i int) {
+			item := payload.Items[i]
+			if st.taskCancelled(ctx, item.TaskID) {
+				return
+			}
+			media, _, err := fetchSyndicationTweetMedia(ctx, st.mediaClient, tweetIDFromURL(item.URL))
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					st.backendHealth.recordFailure(syndicationBackendName, err)
+				}
+				return
+			}
+			st.backendHealth.recordSuccess(syndicationBackendName)
+			noMedia[i] = len(media) == 0
+		})
+	}
+
+	// Queueing continues past cancellation of this task: the downloads are already
+	// tracked as PENDING and would otherwise never finish.
+	ctx = context.WithoutCancel(ctx)
+	queued, skipped, failed := 0, 0, 0
+	for i, item := range payload.Items {
+		if st.taskCancelled(ctx, item.TaskID) {
+			continue
+		}
+		if noMedia[i] {
+			res := downloadResult{URL: item.URL, Success: false, Message: messageText(langEnglish, msgDownloadNoImages)}
+			setTaskState(ctx, st.redis, item.TaskID, "SUCCESS", withMessage(toMap(res), "message", msgDownloadNoImages))
+			saveTaskResult(ctx, st.redis, item.TaskID, taskTypeDownload, "SUCCESS", res)
+			skipped++
+			continue
+		}
+		_, err := st.submitDownload(queue, item)
+		switch {
+		case err == nil, errors.Is(err, asynq.ErrTaskIDConflict):
+			// A conflict means a retried pre-check already queued this download.
+			queued++
+		default:
+			st.setDownloadFailure(ctx, item.TaskID, fmt.Sprintf("failed to queue download: %v", err))
+			failed++
+		}
+	}
+	logger.Info("download pre-check finished",
+		"task_id", payload.TaskID,
+		"queued", queued,
+		"no_media", skipped,
+		"failed", failed,
+	)
+	return nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	partLockPrefix  = "xmd:part-lock:"
+	partLockTTL     = time.Minute
+	partLockRefresh = 20 * time.Second
+)
+
+// errMediaTooLarge marks a download refused by MEDIA_MAX_FILE_SIZE.
+var errMediaTooLarge = errors.New("media exceeds MEDIA_MAX_FILE_SIZE")
+
+var (
+	contentRangeRe = regexp.MustCompile(`^bytes (\d+)-\d+/(\d+|\*)$`)
+	md5HexRe       = regexp.MustCompile(`^[0-9a-f]{32}$`)
+)
+
+// partMeta is stored next to a .part file so an interrupted download can be resumed
+// against the same representation and verified before it is finalized.
+type partMeta struct {
+	URL         string `json:"url"`
+	ETag        string `json:"etag,omitempty"`
+	Total       int64  `json:"total,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// partDownload is a completed, verified .part file.
+type partDownload struct {
+	Hash        string
+	Size        int64
+	ContentType string
+}
+
+func readPartMeta(path string) (partMeta, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return partMeta{}, false
+	}
+	var meta partMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return partMeta{}, false
+	}
+	return meta, true
+}
+
+func writePartMeta(path string, meta partMeta) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// lockPart gives the caller sole use of partPath until the returned release is called.
+// Tasks for the same tweet share .part paths, so a second task waits for the first
+// instead of truncating or resuming a file that is still being written. The lock lives
+// in Redis so it spans worker processes; it is refreshed while held and expires on its
+// own if the holder dies.
+func (st *appState) lockPart(ctx context.Context, partPath string) (func(), error) {
+	key := partLockPrefix + normalizeRelPath(st.cfg.mediaRoot, partPath)
+	token := uuid.NewString()
+	for {
+		ok, err := st.redis.SetNX(ctx, key, token, partLockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(partLockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if v, _ := st.redis.Get(context.Background(), key).Result(); v != token {
+					return
+				}
+				st.redis.Expire(context.Background(), key, partLockTTL)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		if v, _ := st.redis.Get(context.Background(), key).Result(); v == token {
+			st.redis.Del(context.Background(), key)
+		}
+	}, nil
+}
+
+func removePart(partPath string) {
+	_ = os.Remove(partPath)
+	_ = os.Remove(partPath + ".json")
+}
+
+// fetchToPart downloads mediaURL into partPath, resuming with a Range request when an
+// earlier attempt left a partial file for the same URL and ETag. On network errors the
+// partial file is kept for the next attempt; on integrity failures it is discarded.
+func (st *appState) fetchToPart(ctx context.Context, mediaURL, partPath string) (partDownload, error) {
+	metaPath := partPath + ".json"
+	for attempt := 0; attempt < 2; attempt++ {
+		var offset int64
+		meta, ok := readPartMeta(metaPath)
+		if ok && meta.URL == mediaURL && meta.ETag != "" {
+			if info, err := os.Stat(partPath); err == nil {
+				offset = info.Size()
+			}
+		}
+		if offset == 0 {
+			removePart(partPath)
+			meta = partMeta{URL: mediaURL}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, mediaURL, nil)
+		if err != nil {
+			return partDownload{}, err
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			req.Header.Set("If-Range", meta.ETag)
+		}
+		resp, err := st.mediaClient.Do(req)
+		if err != nil {
+			return partDownload{}, err
+		}
+
+		flags := os.O_CREATE | os.O_WRONLY
+		switch {
+		case resp.StatusCode == http.StatusPartialContent && offset > 0:
+			m := contentRangeRe.FindStringSubmatch(resp.Header.Get("Content-Range"))
+			start := int64(-1)
+			if m != nil {
+				start, _ = strconv.ParseInt(m[1], 10, 64)
+			}
+			if start != offset {
+				resp.Body.Close()
+				removePart(partPath)
+				continue
+			}
+			flags |= os.O_APPEND
+		case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+			resp.Body.Close()
+			removePart(partPath)
+			continue
+		case resp.StatusCode >= 400:
+			resp.Body.Close()
+			return partDownload{}, fmt.Errorf("media status=%d", resp.StatusCode)
+		default:
+			// Full representation: either a fresh download or the ETag no longer matches.
+			offset = 0
+			if limit := st.cfg.mediaMaxFileSize; limit > 0 && resp.ContentLength > limit {
+				resp.Body.Close()
+				removePart(partPath)
+				return partDownload{}, fmt.Errorf("%w: %d bytes exceeds %d", errMediaTooLarge, resp.ContentLength, limit)
+			}
+			flags |= os.O_TRUNC
+			meta = partMeta{
+				URL:         mediaURL,
+				ETag:        resp.Header.Get("ETag"),
+				Total:       resp.ContentLength,
+				ContentType: resp.Header.Get("Content-Type"),
+			}
+			if err := writePartMeta(metaPath, meta); err != nil {
+				resp.Body.Close()
+				return partDownload{}, err
+			}
+		}
+
+		result, err := appendPart(partPath, flags, offset, st.throttleReader(ctx, resp.Body), st.cfg.mediaMaxFileSize)
+		resp.Body.Close()
+		if errors.Is(err, errMediaTooLarge) {
+			removePart(partPath)
+			return partDownload{}, err
+		}
+		if err != nil {
+			return partDownload{}, err
+		}
+		result.ContentType = meta.ContentType
+		if err := verifyPart(meta, result); err != nil {
+			removePart(partPath)
+			return partDownload{}, err
+		}
+		return result, nil
+	}
+	return partDownload{}, errors.New("could not resume partial download")
+}
+
+// appendPart writes body to partPath and returns the md5 of the whole file. When resuming,
+// the bytes already on disk are hashed first so the digest covers the complete content.
+// A positive maxSize stops the copy as soon as the file would grow past it, which also
+// covers servers that send no Content-Length.
+func appendPart(partPath string, flags int, offset int64, body io.Reader, maxSize int64) (partDownload, error) {
+	if maxSize > 0 {
+		if offset > maxSize {
+			return partDownload{}, fmt.Errorf("%w: %d bytes exceeds %d", errMediaTooLarge, offset, maxSize)
+		}
+		body = io.LimitReader(body, maxSize-offset+1)
+	}
+	h := md5.New()
+	if offset > 0 {
+		if err := hashFilePrefix(h, partPath, offset); err != nil {
+			return partDownload{}, err
+		}
+	}
+	f, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return partDownload{}, err
+	}
+	n, err := io.Copy(io.MultiWriter(f, h), body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return partDownload{}, err
+	}
+	if maxSize > 0 && offset+n > maxSize {
+		return partDownload{}, fmt.Errorf("%w: more than %d bytes", errMediaTooLarge, maxSize)
+	}
+	return partDownload{Hash: hex.EncodeToString(h.Sum(nil)), Size: offset + n}, nil
+}
+
+func hashFilePrefix(h hash.Hash, path string, n int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(h, f, n)
+	return err
+}
+
+// verifyPart checks the finished file against the size and, when the ETag is a plain MD5
+// digest, the hash recorded when the download started.
+func verifyPart(meta partMeta, result partDownload) error {
+	if result.Size == 0 {
+		return errors.New("empty media response")
+	}
+	if meta.Total > 0 && result.Size != meta.Total {
+		return fmt.Errorf("size mismatch: got %d bytes, expected %d", result.Size, meta.Total)
+	}
+	etag := strings.ToLower(strings.Trim(strings.TrimPrefix(meta.ETag, "W/"), `"`))
+	if md5HexRe.MatchString(etag) && etag != result.Hash {
+		return fmt.Errorf("hash mismatch: got %s, expected %s", result.Hash, etag)
+	}
+	return nil
+}
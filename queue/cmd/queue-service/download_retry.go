@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const downloadRetryDefaultLimit = 50
+
+type downloadRetryRequest struct {
+	TaskIDs []string `json:"task_ids"`
+	Limit   int      `json:"limit"`
+}
+
+// handleDownloadRetry re-enqueues failed tweet downloads as fresh tasks. Explicit task_ids
+// are retried as given; without them the most recent tracked failures are collected. The
+// old and new task IDs are linked both ways so the status list can show the chain. Uploads
+// are not retried: their media came from the request, and fetching the tweet from X again
+// is what they exist to avoid.
+func (st *appState) handleDownloadRetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body downloadRetryRequest
+	// An empty body means "retry recent failures".
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		badRequest(w, "invalid JSON body")
+		return
+	}
+	limit := body.Limit
+	if limit <= 0 {
+		limit = downloadRetryDefaultLimit
+	}
+	if limit > maxTrackedTasks {
+		limit = maxTrackedTasks
+	}
+
+	ctx := r.Context()
+	explicit := len(body.TaskIDs) > 0
+	candidates := uniqueReverse(body.TaskIDs)
+	if !explicit {
+		ids, err := st.redis.LRange(ctx, taskListKey, 0, -1).Result()
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		candidates = uniqueReverse(ids)
+	}
+
+	requeued := make([]map[string]string, 0)
+	skipped := make([]map[string]string, 0)
+	for _, oldID := range candidates {
+		if len(requeued) == limit {
+			break
+		}
+		reason := ""
+		url, _ := st.redis.HGet(ctx, taskURLHashKey, oldID).Result()
+		rec, ok := getTaskState(ctx, st.redis, oldID)
+		upload, _ := st.redis.HGet(ctx, taskUploadHashKey, oldID).Result()
+		switch {
+		case !ok:
+			reason = "not found"
+		case rec.Status != "FAILURE":
+			reason = "not failed"
+		case url == "":
+			reason = "not a tweet download"
+		case upload != "":
+			reason = "upload is not retryable"
+		}
+		if reason != "" {
+			// Implicit collection walks every tracked task; only explicit IDs are worth reporting.
+			if explicit {
+				skipped = append(skipped, map[string]string{"task_id": oldID, "reason": reason})
+			}
+			continue
+		}
+
+		// Claiming the old ID before enqueueing keeps concurrent requests, such as a double
+		// click, from both retrying it.
+		newID := uuid.NewString()
+		claimed, err := st.redis.HSetNX(ctx, taskRetriedAsHashKey, oldID, newID).Result()
+		if err != nil {
+			skipped = append(skipped, map[string]string{"task_id": oldID, "reason": "enqueue failed"})
+			continue
+		}
+		if !claimed {
+			if explicit {
+				skipped = append(skipped, map[string]string{"task_id": oldID, "reason": "already retried"})
+			}
+			continue
+		}
+		if _, err := st.enqueueDownload(ctx, downloadTaskPayload{TaskID: newID, URL: url}); err != nil {
+			st.redis.HDel(ctx, taskRetriedAsHashKey, oldID)
+			skipped = append(skipped, map[string]string{"task_id": oldID, "reason": "enqueue failed"})
+			continue
+		}
+		st.redis.HSet(ctx, taskRetryOfHashKey, newID, oldID)
+		requeued = append(requeued, map[string]string{"task_id": oldID, "new_task_id": newID, "url": url})
+	}
+
+	st.redis.LTrim(ctx, taskListKey, -maxTrackedTasks, -1)
+	logger.Info("failed download tasks requeued", "count", len(requeued), "skipped", len(skipped))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"requeued": requeued,
+		"skipped":  skipped,
+	})
+}
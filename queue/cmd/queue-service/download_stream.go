@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const downloadStreamHeartbeat = 15 * time.Second
+
+// taskEvent is published on taskEventsChannel whenever a task state is written. It only
+// names the task; subscribers read the state itself.
+type taskEvent struct {
+	TaskID string `json:"task_id"`
+	Status string `json:"status"`
+}
+
+func encodeTaskEvent(taskID, status string) []byte {
+	b, _ := json.Marshal(taskEvent{TaskID: taskID, Status: status})
+	return b
+}
+
+func writeSSE(w http.ResponseWriter, event string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
+
+// handleDownloadStream serves GET /api/download/stream as Server-Sent Events. It first
+// sends a "snapshot" event shaped like GET /api/download, then a "task" event with the
+// resolved status of every tracked download or timeline task whose state changes.
+// ids=a,b limits both to those tasks.
+func (st *appState) handleDownloadStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	requested := strings.TrimSpace(r.URL.Query().Get("ids"))
+	var only map[string]struct{}
+	if requested != "" {
+		only = make(map[string]struct{})
+		for _, id := range splitCSV(requested) {
+			only[id] = struct{}{}
+		}
+	}
+
+	// Subscribing before the snapshot means no transition between the two is missed.
+	sub := st.redis.Subscribe(ctx, taskEventsChannel)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		logger.Error("failed to subscribe to task events", "error", err)
+		internalServerError(w)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	// Nginx buffers proxied responses unless told otherwise.
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := writeSSE(w, "snapshot", st.downloadStatusSnapshot(ctx, requested)); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(downloadStreamHeartbeat)
+	defer heartbeat.Stop()
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			item, send := st.streamedTaskStatus(ctx, msg.Payload, only)
+			if !send {
+				continue
+			}
+			if err := writeSSE(w, "task", item); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// streamedTaskStatus resolves a published event to the status sent to the client. Tasks
+// outside the ids filter and tasks that are not tracked downloads, such as autotag runs,
+// are skipped.
+func (st *appState) streamedTaskStatus(ctx context.Context, payload string, only map[string]struct{}) (downloadTaskStatusResponse, bool) {
+	var ev taskEvent
+	if err := json.Unmarshal([]byte(payload), &ev); err != nil || ev.TaskID == "" {
+		return downloadTaskStatusResponse{}, false
+	}
+	if only != nil {
+		if _, ok := only[ev.TaskID]; !ok {
+			return downloadTaskStatusResponse{}, false
+		}
+	}
+	item := st.resolveDownloadStatus(ctx, ev.TaskID)
+	if item.URL == nil && item.Username == nil {
+		return downloadTaskStatusResponse{}, false
+	}
+	return item, true
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	duplicatesDefaultPerPage = 50
+	duplicatesMaxPerPage     = 500
+	// duplicatesDefaultDistance is the near-duplicate threshold when PHASH_DEDUP_DISTANCE
+	// is off. Past maxDuplicateDistance unrelated images start to match.
+	duplicatesDefaultDistance = 6
+	maxDuplicateDistance      = 16
+)
+
+// duplicateFile is one member of a duplicate cluster.
+type duplicateFile struct {
+	Filepath string `json:"filepath"`
+	Username string `json:"username"`
+	Hash     string `json:"hash"`
+	Size     int64  `json:"size"`
+	MTime    int64  `json:"mtime"`
+	Keep     bool   `json:"keep"`
+
+	phash    uint64
+	hasPHash bool
+}
+
+// duplicateCluster groups files that are byte-identical ("exact") or, with near
+// duplicates on, look alike ("similar"). Keep is the file suggested to keep: the largest,
+// then the oldest. Reclaimable is what deleting the duplicates of Keep frees.
+type duplicateCluster struct {
+	Kind        string          `json:"kind"`
+	Keep        string          `json:"keep"`
+	Files       []duplicateFile `json:"files"`
+	TotalBytes  int64           `json:"total_bytes"`
+	Reclaimable int64           `json:"reclaimable_bytes"`
+}
+
+type duplicateReportResponse struct {
+	paginatedResponse
+	DuplicateFiles   int   `json:"duplicate_files"`
+	ReclaimableBytes int64 `json:"reclaimable_bytes"`
+}
+
+// findDuplicateClusters groups the library into duplicate clusters, largest saving first.
+// Near duplicates within distance bits of perceptual hash join the clusters when near is
+// set, except files linked as variants of each other, which differ on purpose.
+func (st *appState) findDuplicateClusters(near bool, distance int) ([]duplicateCluster, error) {
+	records, err := st.store.ListDuplicateImages()
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]imageRecord, len(records))
+	var hashes map[string]uint64
+	uf := newUnionFind()
+	for i, rec := range records {
+		files[rec.Filepath] = rec
+		uf.add(rec.Filepath)
+		if i > 0 && records[i-1].ContentHash == rec.ContentHash {
+			uf.union(records[i-1].Filepath, rec.Filepath)
+		}
+	}
+
+	if near {
+		hashes, err = st.store.ListPerceptualHashes()
+		if err != nil {
+			return nil, err
+		}
+		pairs := nearDuplicatePairs(hashes, distance)
+		involved := make([]string, 0)
+		seen := make(map[string]struct{})
+		for _, p := range pairs {
+			for _, path := range p {
+				if _, ok := seen[path]; !ok {
+					seen[path] = struct{}{}
+					involved = append(involved, path)
+				}
+			}
+		}
+		variants, err := st.store.GetVariantsForFiles(involved)
+		if err != nil {
+			return nil, err
+		}
+		missing := make([]string, 0)
+		for _, path := range involved {
+			if _, ok := files[path]; !ok {
+				missing = append(missing, path)
+			}
+		}
+		extra, err := st.store.GetImageRecords(missing)
+		if err != nil {
+			return nil, err
+		}
+		for path, rec := range extra {
+			files[path] = rec
+		}
+		for _, p := range pairs {
+			a, b := p[0], p[1]
+			if _, ok := files[a]; !ok {
+				continue
+			}
+			if _, ok := files[b]; !ok {
+				continue
+			}
+			if va, ok := variants[a]; ok && va.GroupID == variants[b].GroupID {
+				continue
+			}
+			uf.add(a)
+			uf.add(b)
+			uf.union(a, b)
+		}
+	}
+
+	members := make(map[string][]string)
+	for path := range files {
+		if uf.has(path) {
+			root := uf.find(path)
+			members[root] = append(members[root], path)
+		}
+	}
+	clusters := make([]duplicateCluster, 0, len(members))
+	for _, paths := range members {
+		if len(paths) < 2 {
+			continue
+		}
+		clusters = append(clusters, newDuplicateCluster(paths, files, hashes, distance))
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Reclaimable != clusters[j].Reclaimable {
+			return clusters[i].Reclaimable > clusters[j].Reclaimable
+		}
+		return clusters[i].Keep < clusters[j].Keep
+	})
+	return clusters, nil
+}
+
+func newDuplicateCluster(paths []string, files map[string]imageRecord, hashes map[string]uint64, distance int) duplicateCluster {
+	c := duplicateCluster{Kind: "exact", Files: make([]duplicateFile, 0, len(paths))}
+	for _, path := range paths {
+		rec := files[path]
+		phash, hasPHash := hashes[path]
+		c.Files = append(c.Files, duplicateFile{
+			Filepath: rec.Filepath,
+			Username: rec.Username,
+			Hash:     rec.ContentHash,
+			Size:     rec.Size,
+			MTime:    rec.MTime,
+			phash:    phash,
+			hasPHash: hasPHash,
+		})
+		c.TotalBytes += rec.Size
+	}
+	sort.Slice(c.Files, func(i, j int) bool {
+		a, b := c.Files[i], c.Files[j]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		if a.MTime != b.MTime {
+			return a.MTime < b.MTime
+		}
+		return a.Filepath < b.Filepath
+	})
+	for _, f := range c.Files[1:] {
+		if f.Hash != c.Files[0].Hash || f.Hash == "" {
+			c.Kind = "similar"
+		}
+	}
+	c.Files[0].Keep = true
+	c.Keep = c.Files[0].Filepath
+	for _, f := range c.duplicatesOf(c.Keep, distance) {
+		c.Reclaimable += f.Size
+	}
+	return c
+}
+
+// duplicatesOf returns the files of c that duplicate keep. Similar clusters chain (A looks
+// like B and B like C while A and C are far apart), so a file only counts when it has the
+// same content hash as keep or a perceptual hash within distance bits of it.
+func (c duplicateCluster) duplicatesOf(keep string, distance int) []duplicateFile {
+	var kept duplicateFile
+	for _, f := range c.Files {
+		if f.Filepath == keep {
+			kept = f
+			break
+		}
+	}
+	dups := make([]duplicateFile, 0, len(c.Files))
+	for _, f := range c.Files {
+		if f.Filepath == keep {
+			continue
+		}
+		sameBytes := f.Hash != "" && f.Hash == kept.Hash
+		looksAlike := f.hasPHash && kept.hasPHash && hammingDistance(f.phash, kept.phash) <= distance
+		if sameBytes || looksAlike {
+			dups = append(dups, f)
+		}
+	}
+	return dups
+}
+
+// nearDuplicatePairs returns the pairs of files whose perceptual hashes differ in at most
+// distance bits. Split into distance+1 bands, two such hashes agree on at least one band,
+// so only files sharing a band value are compared.
+func nearDuplicatePairs(hashes map[string]uint64, distance int) [][2]string {
+	paths := make([]string, 0, len(hashes))
+	for path := range hashes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	bands := distance + 1
+	seen := make(map[[2]int]struct{})
+	pairs := make([][2]string, 0)
+	for band := 0; band < bands; band++ {
+		lo, hi := band*64/bands, (band+1)*64/bands
+		mask := uint64(1)<<(hi-lo) - 1
+		buckets := make(map[uint64][]int)
+		for i, path := range paths {
+			key := (hashes[path] >> lo) & mask
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, idx := range buckets {
+			for x := 0; x < len(idx); x++ {
+				for y := x + 1; y < len(idx); y++ {
+					i, j := idx[x], idx[y]
+					if _, ok := seen[[2]int{i, j}]; ok {
+						continue
+					}
+					if hammingDistance(hashes[paths[i]], hashes[paths[j]]) <= distance {
+						seen[[2]int{i, j}] = struct{}{}
+						pairs = append(pairs, [2]string{paths[i], paths[j]})
+					}
+				}
+			}
+		}
+	}
+	return pairs
+}
+
+type unionFind struct {
+	parent map[string]string
+}
+
+func newUnionFind() *unionFind {
+	return &unionFind{parent: make(map[string]string)}
+}
+
+func (u *unionFind) add(x string) {
+	if _, ok := u.parent[x]; !ok {
+		u.parent[x] = x
+	}
+}
+
+func (u *unionFind) has(x string) bool {
+	_, ok := u.parent[x]
+	return ok
+}
+
+func (u *unionFind) find(x string) string {
+	for u.parent[x] != x {
+		u.parent[x] = u.parent[u.parent[x]]
+		x = u.parent[x]
+	}
+	return x
+}
+
+func (u *unionFind) union(a, b string) {
+	ra, rb := u.find(a), u.find(b)
+	if ra != rb {
+		u.parent[rb] = ra
+	}
+}
+
+// duplicateDistance checks the near-duplicate threshold, defaulting to the download-time
+// PHASH_DEDUP_DISTANCE so the report agrees with what new downloads skip.
+func (st *appState) duplicateDistance(requested *int) (int, error) {
+	if requested == nil {
+		if st.cfg.phashDedupDistance >= 0 {
+			return min(st.cfg.phashDedupDistance, maxDuplicateDistance), nil
+		}
+		return duplicatesDefaultDistance, nil
+	}
+	if *requested < 0 || *requested > maxDuplicateDistance {
+		return 0, fmt.Errorf("distance must be between 0 and %d", maxDuplicateDistance)
+	}
+	return *requested, nil
+}
+
+// handleImageDuplicates lists duplicate clusters across all users. With user set, only
+// clusters that include a file of that user are listed.
+func (st *appState) handleImageDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	near := parseBoolParam(q.Get("near"))
+	var requested *int
+	if raw := strings.TrimSpace(q.Get("distance")); raw != "" {
+		d, err := strconv.Atoi(raw)
+		if err != nil {
+			badRequest(w, "invalid distance")
+			return
+		}
+		requested = &d
+	}
+	distance, err := st.duplicateDistance(requested)
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	user := strings.TrimSpace(q.Get("user"))
+	clusters, err := st.findDuplicateClusters(near, distance)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	if user != "" {
+		filtered := clusters[:0]
+		for _, c := range clusters {
+			for _, f := range c.Files {
+				if f.Username == user {
+					filtered = append(filtered, c)
+					break
+				}
+			}
+		}
+		clusters = filtered
+	}
+
+	resp := duplicateReportResponse{}
+	for _, c := range clusters {
+		resp.DuplicateFiles += len(c.duplicatesOf(c.Keep, distance))
+		resp.ReclaimableBytes += c.Reclaimable
+	}
+	page := parsePositiveInt(q.Get("page"), 1)
+	perPage := min(parsePositiveInt(q.Get("per_page"), duplicatesDefaultPerPage), duplicatesMaxPerPage)
+	start, end := pageBounds((page-1)*perPage, perPage, len(clusters))
+	resp.paginatedResponse = paginatedResponse{
+		Items:       clusters[start:end],
+		TotalItems:  len(clusters),
+		PerPage:     perPage,
+		CurrentPage: page,
+		TotalPages:  totalPages(len(clusters), perPage),
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// duplicateResolveRequest keeps one file of some duplicate clusters and deletes the rest.
+// Keep names the file to keep of each cluster to resolve; All resolves every cluster with
+// its suggested file instead. Clusters are recomputed with Near and Distance, and only
+// the members that duplicate the kept file itself are deleted; the rest of a chained
+// similar cluster stays.
+type duplicateResolveRequest struct {
+	Keep     []string `json:"keep"`
+	All      bool     `json:"all"`
+	Near     bool     `json:"near"`
+	Distance *int     `json:"distance"`
+	DryRun   bool     `json:"dry_run"`
+}
+
+func (st *appState) handleImageDuplicatesResolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body duplicateResolveRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "keep or all is required") {
+		return
+	}
+	keep := normalizeUniqueFilepaths(body.Keep)
+	if len(keep) == 0 && !body.All {
+		badRequest(w, "keep or all is required")
+		return
+	}
+	if len(keep) > 0 && body.All {
+		badRequest(w, "keep and all are mutually exclusive")
+		return
+	}
+	distance, err := st.duplicateDistance(body.Distance)
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	clusters, err := st.findDuplicateClusters(body.Near, distance)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+
+	clusterOf := make(map[string]int)
+	for i, c := range clusters {
+		for _, f := range c.Files {
+			clusterOf[f.Filepath] = i
+		}
+	}
+	kept := make(map[int]string)
+	if body.All {
+		for i, c := range clusters {
+			kept[i] = c.Keep
+		}
+	}
+	for _, path := range keep {
+		i, ok := clusterOf[path]
+		if !ok {
+			badRequest(w, fmt.Sprintf("%s has no duplicates", path))
+			return
+		}
+		if other, dup := kept[i]; dup {
+			badRequest(w, fmt.Sprintf("%s and %s are in the same cluster; keep one of them", other, path))
+			return
+		}
+		kept[i] = path
+	}
+
+	filepaths := make([]string, 0)
+	var freed int64
+	for i, keepPath := range kept {
+		for _, f := range clusters[i].duplicatesOf(keepPath, distance) {
+			filepaths = append(filepaths, f.Filepath)
+			freed += f.Size
+		}
+	}
+	sort.Strings(filepaths)
+	if body.DryRun || len(filepaths) == 0 {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"dry_run":           body.DryRun,
+			"clusters":          len(kept),
+			"delete_count":      len(filepaths),
+			"reclaimable_bytes": freed,
+			"filepaths":         filepaths,
+		})
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := deleteImagesTaskPayload{TaskID: taskID, Filepaths: filepaths}
+	err = st.enqueueTask(taskTypeDeleteImages, st.cfg.interactiveQueue, taskID, payload, 30*time.Minute)
+	if err != nil {
+		logger.Error("failed to enqueue duplicate delete task",
+			"task_type", taskTypeDeleteImages,
+			"task_id", taskID,
+			"count", len(filepaths),
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(r.Context(), st.redis, taskID, "PENDING", withMessage(map[string]any{
+		"total": len(filepaths),
+	}, "message", msgDeleteImagesQueuedCount, len(filepaths)))
+	logger.Info("duplicate delete task queued", "task_id", taskID, "clusters", len(kept), "count", len(filepaths))
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success":           true,
+		"queued":            true,
+		"task_id":           taskID,
+		"queued_count":      len(filepaths),
+		"clusters":          len(kept),
+		"reclaimable_bytes": freed,
+		"message":           localize(r.Context(), msgDeleteImagesQueued),
+	})
+}
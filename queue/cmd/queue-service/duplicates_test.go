@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestDuplicateClusterChainedSimilarFiles(t *testing.T) {
+	const distance = 4
+	// A looks like B and B like C, but A and C are 8 bits apart.
+	hashes := map[string]uint64{
+		"alice/a.jpg": 0x00,
+		"bob/b.jpg":   0x0f,
+		"carol/c.jpg": 0xff,
+	}
+	pairs := nearDuplicatePairs(hashes, distance)
+	if len(pairs) != 2 {
+		t.Fatalf("pairs = %v, want A-B and B-C only", pairs)
+	}
+
+	files := map[string]imageRecord{
+		"alice/a.jpg": {Filepath: "alice/a.jpg", Username: "alice", ContentHash: "ha", Size: 300},
+		"bob/b.jpg":   {Filepath: "bob/b.jpg", Username: "bob", ContentHash: "hb", Size: 200},
+		"carol/c.jpg": {Filepath: "carol/c.jpg", Username: "carol", ContentHash: "hc", Size: 100},
+	}
+	c := newDuplicateCluster([]string{"alice/a.jpg", "bob/b.jpg", "carol/c.jpg"}, files, hashes, distance)
+	if c.Kind != "similar" || c.Keep != "alice/a.jpg" {
+		t.Fatalf("kind = %s, keep = %s; want similar, alice/a.jpg", c.Kind, c.Keep)
+	}
+	if c.Reclaimable != 200 {
+		t.Fatalf("reclaimable = %d, want only b.jpg's 200 bytes", c.Reclaimable)
+	}
+
+	tests := []struct {
+		keep string
+		want []string
+	}{
+		{"alice/a.jpg", []string{"bob/b.jpg"}},
+		{"bob/b.jpg", []string{"alice/a.jpg", "carol/c.jpg"}},
+		{"carol/c.jpg", []string{"bob/b.jpg"}},
+	}
+	for _, tt := range tests {
+		got := c.duplicatesOf(tt.keep, distance)
+		if len(got) != len(tt.want) {
+			t.Fatalf("duplicatesOf(%s) = %v, want %v", tt.keep, got, tt.want)
+		}
+		for i, f := range got {
+			if f.Filepath != tt.want[i] {
+				t.Fatalf("duplicatesOf(%s)[%d] = %s, want %s", tt.keep, i, f.Filepath, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestDuplicateClusterExactCopies(t *testing.T) {
+	files := map[string]imageRecord{
+		"alice/a.jpg": {Filepath: "alice/a.jpg", ContentHash: "h", Size: 10, MTime: 1},
+		"bob/a.jpg":   {Filepath: "bob/a.jpg", ContentHash: "h", Size: 10, MTime: 2},
+	}
+	// Without near duplicates there are no perceptual hashes; equal MD5s still match.
+	c := newDuplicateCluster([]string{"bob/a.jpg", "alice/a.jpg"}, files, nil, 0)
+	if c.Kind != "exact" || c.Keep != "alice/a.jpg" || c.Reclaimable != 10 {
+		t.Fatalf("cluster = %+v, want exact keeping the older alice/a.jpg", c)
+	}
+	if got := c.duplicatesOf("bob/a.jpg", 0); len(got) != 1 || got[0].Filepath != "alice/a.jpg" {
+		t.Fatalf("duplicatesOf(bob/a.jpg) = %v", got)
+	}
+}
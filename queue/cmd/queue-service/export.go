@@ -0,0 +1,321 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// exportDir holds finished archives under the media root so the API process can serve
+	// what the worker wrote. Media scans ignore it since it only contains .zip files.
+	exportDir       = ".exports"
+	exportRetention = 24 * time.Hour
+	exportTagBatch  = 500
+)
+
+type exportTagsRequest struct {
+	imageFilterRequest
+	// MinConfidence drops tags the autotagger was less sure about.
+	MinConfidence float64 `json:"min_confidence"`
+	// IncludeImages stores each image next to its sidecar, ready for training.
+	IncludeImages bool `json:"include_images"`
+}
+
+func (st *appState) exportPath(taskID string) string {
+	return filepath.Join(st.cfg.mediaRoot, exportDir, taskID+".zip")
+}
+
+// handleExportTags queues a ZIP of Danbooru-style sidecars, one .txt of comma separated
+// tags per image, for the images of one user matching an /api/images style query.
+func (st *appState) handleExportTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body exportTagsRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "user is required") {
+		return
+	}
+	if strings.TrimSpace(body.User) == "" {
+		badRequest(w, "user is required")
+		return
+	}
+	filter, err := body.imageFilterRequest.toFilter()
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	ctx := r.Context()
+	filepaths, err := st.selectImagePaths(ctx, filter)
+	if err != nil {
+		writeScanError(w, err)
+		return
+	}
+	if len(filepaths) == 0 {
+		badRequest(w, "no images matched")
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := exportTagsTaskPayload{
+		TaskID:        taskID,
+		Filepaths:     filepaths,
+		MinConfidence: body.MinConfidence,
+		IncludeImages: body.IncludeImages,
+	}
+	err = st.enqueueTask(taskTypeExportTags, st.cfg.queueName, taskID, payload, 2*time.Hour)
+	if err != nil {
+		logger.Error("failed to enqueue tag export task",
+			"task_type", taskTypeExportTags,
+			"task_id", taskID,
+			"count", len(filepaths),
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(ctx, st.redis, taskID, "PENDING", withMessage(map[string]any{
+		"total": len(filepaths),
+	}, "message", msgExportTagsQueued))
+	logger.Info("tag export task queued", "task_id", taskID, "count", len(filepaths))
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success":      true,
+		"queued":       true,
+		"task_id":      taskID,
+		"queued_count": len(filepaths),
+		"message":      localize(ctx, msgExportTagsQueued),
+	})
+}
+
+// handleExportDownload serves GET /api/export/{task_id}.zip once the export finished.
+func (st *appState) handleExportDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/api/export/")
+	taskID, ok := strings.CutSuffix(name, ".zip")
+	if !ok || uuid.Validate(taskID) != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(st.exportPath(taskID))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "export not found"})
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.zip"`, taskID))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// exportSidecarText formats tags the way Danbooru style datasets expect: most confident
+// first, comma separated.
+func exportSidecarText(tags []imageTag, minConfidence float64) string {
+	kept := make([]imageTag, 0, len(tags))
+	for _, t := range tags {
+		if t.Confidence >= minConfidence {
+			kept = append(kept, t)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Confidence > kept[j].Confidence })
+	names := make([]string, 0, len(kept))
+	for _, t := range kept {
+		names = append(names, t.Tag)
+	}
+	return strings.Join(names, ", ")
+}
+
+// removeStaleExports deletes archives older than exportRetention.
+func (st *appState) removeStaleExports() {
+	entries, err := os.ReadDir(filepath.Join(st.cfg.mediaRoot, exportDir))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < exportRetention {
+			continue
+		}
+		_ = os.Remove(filepath.Join(st.cfg.mediaRoot, exportDir, e.Name()))
+	}
+}
+
+func (st *appState) processExportTagsTask(ctx context.Context, t *asynq.Task) error {
+	var payload exportTagsTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+	filepaths := normalizeUniqueFilepaths(payload.Filepaths)
+	total := len(filepaths)
+	archive, err := st.createExportArchive(taskID)
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+	zw := archive.Writer
+	fail := func(err error) error {
+		archive.abort()
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+
+	exported, untagged, current := 0, 0, 0
+	progress := newProgressThrottle(st.cfg.progressInterval)
+	for start := 0; start < total; start += exportTagBatch {
+		batch := filepaths[start:min(start+exportTagBatch, total)]
+		tagsMap, err := st.store.GetTagsForFiles(batch)
+		if err != nil {
+			return fail(err)
+		}
+		for _, rel := range batch {
+			if err := ctx.Err(); err != nil {
+				return fail(err)
+			}
+			current++
+			text := exportSidecarText(tagsMap[rel], payload.MinConfidence)
+			if text == "" {
+				untagged++
+			} else {
+				// Keep the user directory so archives of several users never collide.
+				rel = filepath.ToSlash(rel)
+				stem := strings.TrimSuffix(rel, path.Ext(rel))
+				if err := writeZipEntry(zw, stem+".txt", strings.NewReader(text+"\n")); err != nil {
+					return fail(err)
+				}
+				if payload.IncludeImages {
+					if _, err := st.addImageToZip(zw, rel); err != nil {
+						return fail(err)
+					}
+				}
+				exported++
+			}
+			if progress.due(current == total) {
+				setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+					"current": current,
+					"total":   total,
+					"status":  fmt.Sprintf("exported:%d untagged:%d", exported, untagged),
+				})
+			}
+		}
+	}
+	if err := archive.commit(); err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
+		"exported_count": exported,
+		"untagged_count": untagged,
+		"total":          total,
+		"current":        total,
+		"download_url":   fmt.Sprintf("/api/export/%s.zip", taskID),
+	}, "message", msgExportTagsCompleted, exported, untagged))
+	return nil
+}
+
+// exportArchive is a ZIP being written next to its final path, so a half written archive
+// is never served.
+type exportArchive struct {
+	*zip.Writer
+	out *os.File
+	dst string
+}
+
+func (st *appState) createExportArchive(taskID string) (*exportArchive, error) {
+	st.removeStaleExports()
+	dst := st.exportPath(taskID)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return nil, err
+	}
+	out, err := os.Create(dst + ".part")
+	if err != nil {
+		return nil, err
+	}
+	return &exportArchive{Writer: zip.NewWriter(out), out: out, dst: dst}, nil
+}
+
+func (a *exportArchive) commit() error {
+	err := a.Writer.Close()
+	if cerr := a.out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(a.out.Name(), a.dst)
+	}
+	if err != nil {
+		_ = os.Remove(a.out.Name())
+	}
+	return err
+}
+
+func (a *exportArchive) abort() {
+	_ = a.Writer.Close()
+	_ = a.out.Close()
+	_ = os.Remove(a.out.Name())
+}
+
+// createZipEntry adds an entry under the sanitized name, so archives we write pass the
+// same checks as the ones we read and can be imported again.
+func createZipEntry(zw *zip.Writer, name string, method uint16) (io.Writer, error) {
+	clean, err := sanitizeArchiveName(name)
+	if err != nil {
+		return nil, err
+	}
+	return zw.CreateHeader(&zip.FileHeader{Name: clean, Method: method})
+}
+
+func writeZipEntry(zw *zip.Writer, name string, r io.Reader) error {
+	w, err := createZipEntry(zw, name, zip.Deflate)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// addImageToZip stores the file at rel under the same name. It reports false, without an
+// error, when the file was removed since the export was queued.
+func (st *appState) addImageToZip(zw *zip.Writer, rel string) (bool, error) {
+	full, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+	if err != nil {
+		return false, err
+	}
+	f, err := os.Open(full)
+	if err != nil {
+		// The rest of the archive is still useful when one image was removed meanwhile.
+		logger.Warn("failed to add image to export", "filepath", rel, "error", err)
+		return false, nil
+	}
+	defer f.Close()
+	// Media is already compressed, so it is stored as is.
+	w, err := createZipEntry(zw, rel, zip.Store)
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(w, f)
+	return err == nil, err
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+// exportManifestLine is one line of manifest.jsonl in a media export.
+type exportManifestLine struct {
+	Filepath string     `json:"filepath"`
+	Tags     []imageTag `json:"tags"`
+}
+
+// handleExportZip queues a ZIP of the files matching the /api/images filters in the query
+// string. manifest=true adds manifest.jsonl with the tags of every file. The archive is
+// served from /api/export/{task_id}.zip once the task finished.
+func (st *appState) handleExportZip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	filter, err := parseImageFilter(q)
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	// An unfiltered export would copy the whole library; ask for it explicitly.
+	if filter.isEmpty() {
+		badRequest(w, "at least one filter is required")
+		return
+	}
+	ctx := r.Context()
+	filepaths, err := st.selectImagePaths(ctx, filter)
+	if err != nil {
+		writeScanError(w, err)
+		return
+	}
+	if len(filepaths) == 0 {
+		badRequest(w, "no images matched")
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := exportMediaTaskPayload{
+		TaskID:    taskID,
+		Filepaths: filepaths,
+		Manifest:  parseBoolParam(q.Get("manifest")),
+	}
+	err = st.enqueueTask(taskTypeExportMedia, st.cfg.queueName, taskID, payload, 2*time.Hour)
+	if err != nil {
+		logger.Error("failed to enqueue media export task",
+			"task_type", taskTypeExportMedia,
+			"task_id", taskID,
+			"count", len(filepaths),
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(ctx, st.redis, taskID, "PENDING", withMessage(map[string]any{
+		"total": len(filepaths),
+	}, "message", msgExportMediaQueued))
+	logger.Info("media export task queued", "task_id", taskID, "count", len(filepaths))
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success":      true,
+		"queued":       true,
+		"task_id":      taskID,
+		"queued_count": len(filepaths),
+		"message":      localize(ctx, msgExportMediaQueued),
+	})
+}
+
+func (st *appState) processExportMediaTask(ctx context.Context, t *asynq.Task) error {
+	var payload exportMediaTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+	filepaths := normalizeUniqueFilepaths(payload.Filepaths)
+	total := len(filepaths)
+	archive, err := st.createExportArchive(taskID)
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+	fail := func(err error) error {
+		archive.abort()
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+
+	var manifest strings.Builder
+	enc := json.NewEncoder(&manifest)
+	exported, missing, current := 0, 0, 0
+	progress := newProgressThrottle(st.cfg.progressInterval)
+	for start := 0; start < total; start += exportTagBatch {
+		batch := filepaths[start:min(start+exportTagBatch, total)]
+		var tagsMap map[string][]imageTag
+		if payload.Manifest {
+			if tagsMap, err = st.store.GetTagsForFiles(batch); err != nil {
+				return fail(err)
+			}
+		}
+		for _, rel := range batch {
+			if err := ctx.Err(); err != nil {
+				return fail(err)
+			}
+			current++
+			added, err := st.addImageToZip(archive.Writer, rel)
+			if err != nil {
+				return fail(err)
+			}
+			if added {
+				exported++
+				if payload.Manifest {
+					tags := tagsMap[rel]
+					if tags == nil {
+						tags = []imageTag{}
+					}
+					if err := enc.Encode(exportManifestLine{Filepath: rel, Tags: tags}); err != nil {
+						return fail(err)
+					}
+				}
+			} else {
+				missing++
+			}
+			if progress.due(current == total) {
+				setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+					"current": current,
+					"total":   total,
+					"status":  fmt.Sprintf("exported:%d missing:%d", exported, missing),
+				})
+			}
+		}
+	}
+	if payload.Manifest {
+		if err := writeZipEntry(archive.Writer, "manifest.jsonl", strings.NewReader(manifest.String())); err != nil {
+			return fail(err)
+		}
+	}
+	if err := archive.commit(); err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
+		"exported_count": exported,
+		"missing_count":  missing,
+		"total":          total,
+		"current":        total,
+		"download_url":   fmt.Sprintf("/api/export/%s.zip", taskID),
+	}, "message", msgExportMediaCompleted, exported, missing))
+	return nil
+}
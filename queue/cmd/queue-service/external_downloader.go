@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported EXTERNAL_DOWNLOADER tools.
+const (
+	externalGalleryDL = "gallery-dl"
+	externalYTDLP     = "yt-dlp"
+)
+
+// externalOutputTail bounds how much tool output is kept for the failure message.
+const externalOutputTail = 512
+
+var externalNameRe = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// externalExtractor shells out to gallery-dl or yt-dlp and hands the files they write to
+// the regular download pipeline. Files are written to a scratch directory outside the
+// media root so scans never see half-finished output.
+type externalExtractor struct {
+	tool    string
+	binary  string
+	args    []string
+	timeout time.Duration
+	// rateLimit is passed as --limit-rate, which both tools understand.
+	rateLimit int64
+}
+
+// newExternalExtractor returns the configured external extractor, or false when
+// EXTERNAL_DOWNLOADER is unset or names an unsupported tool.
+func newExternalExtractor(cfg config) (externalExtractor, bool) {
+	tool := strings.ToLower(strings.TrimSpace(cfg.externalDownloader))
+	if tool != externalGalleryDL && tool != externalYTDLP {
+		return externalExtractor{}, false
+	}
+	binary := cfg.externalDownloaderPath
+	if binary == "" {
+		binary = tool
+	}
+	// The tool runs in its own process, so the tighter of the two limits applies to it alone.
+	rateLimit := cfg.downloadTaskRateLimit
+	if g := cfg.downloadRateLimit; g > 0 && (rateLimit <= 0 || g < rateLimit) {
+		rateLimit = g
+	}
+	return externalExtractor{
+		tool:      tool,
+		binary:    binary,
+		args:      strings.Fields(cfg.externalDownloaderArgs),
+		timeout:   cfg.externalDownloaderTimeout,
+		rateLimit: rateLimit,
+	}, true
+}
+
+func (e externalExtractor) Name() string { return e.tool }
+
+func (externalExtractor) Match(rawURL string) bool {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (e externalExtractor) command(ctx context.Context, rawURL, dir string) *exec.Cmd {
+	args := append([]string(nil), e.args...)
+	if e.rateLimit > 0 {
+		args = append(args, "--limit-rate", strconv.FormatInt(e.rateLimit, 10))
+	}
+	switch e.tool {
+	case externalGalleryDL:
+		args = append(args, "--write-metadata", "-D", dir, rawURL)
+	case externalYTDLP:
+		// The pipeline only accepts MP4 video, so prefer it and merge into it.
+		args = append(args, "--no-playlist", "--write-info-json", "-S", "ext", "--merge-output-format", "mp4",
+			"-o", filepath.Join(dir, "%(autonumber)s.%(ext)s"), rawURL)
+	}
+	return exec.CommandContext(ctx, e.binary, args...)
+}
+
+func (e externalExtractor) Extract(ctx context.Context, rawURL string) (extractedPost, error) {
+	dir, err := os.MkdirTemp("", "xmd-external-")
+	if err != nil {
+		return extractedPost{}, err
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	var output bytes.Buffer
+	cmd := e.command(ctx, rawURL, dir)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		cleanup()
+		tail := strings.TrimSpace(output.String())
+		if len(tail) > externalOutputTail {
+			tail = tail[len(tail)-externalOutputTail:]
+		}
+		return extractedPost{}, fmt.Errorf("%s failed: %v: %s", e.tool, err, tail)
+	}
+
+	var files, metaFiles []string
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(d.Name())) {
+		case ".json":
+			metaFiles = append(metaFiles, path)
+		case ".part", ".ytdl", ".description", ".txt":
+		default:
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	sort.Strings(metaFiles)
+
+	meta := readExternalMetadata(metaFiles)
+	post := extractedPost{
+		ID:       externalPostID(rawURL, metaString(meta, "id", "post_id", "tweet_id", "status_id")),
+		Username: externalUsername(rawURL, metaString(meta, "uploader_id", "uploader", "username", "author", "user", "artist")),
+		Cleanup:  cleanup,
+	}
+	for _, f := range files {
+		post.Media = append(post.Media, tweetMedia{URL: rawURL, Type: mediaTypeFromPath(f), LocalPath: f})
+	}
+	if text := metaString(meta, "description", "content", "title"); text != "" {
+		post.Meta = &tweetMeta{
+			TweetID:     post.ID,
+			DisplayName: metaString(meta, "uploader", "channel", "nick"),
+			Text:        strings.TrimSpace(text),
+		}
+	}
+	return post, nil
+}
+
+// readExternalMetadata returns the first metadata file that parses as a JSON object.
+// gallery-dl writes one per file and yt-dlp one per video; the post level fields are
+// the same in each.
+func readExternalMetadata(paths []string) map[string]any {
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var m map[string]any
+		if dec.Decode(&m) == nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// metaString returns the first non-empty value of keys. Numbers are formatted as is and
+// nested objects, as gallery-dl uses for authors, contribute their name.
+func metaString(m map[string]any, keys ...string) string {
+	for _, k := range keys {
+		switch v := m[k].(type) {
+		case string:
+			if s := strings.TrimSpace(v); s != "" {
+				return s
+			}
+		case json.Number:
+			return v.String()
+		case map[string]any:
+			if s := metaString(v, "screen_name", "username", "name", "nick"); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// externalPostID makes id safe to name files with; "_" separates the index, so it is
+// replaced too. Posts without an ID fall back to a hash of the URL.
+func externalPostID(rawURL, id string) string {
+	id = strings.Trim(externalNameRe.ReplaceAllString(strings.ToLower(id), "-"), "-.")
+	id = strings.NewReplacer("_", "-", ".", "-").Replace(id)
+	if id == "" {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(rawURL))
+		id = fmt.Sprintf("%016x", h.Sum64())
+	}
+	return id
+}
+
+// externalUsername stores media as "<user>@<host>" like Mastodon accounts so it never
+// collides with X usernames, or under the bare host when the tool reports no user.
+func externalUsername(rawURL, user string) string {
+	host := "unknown"
+	if u, err := url.Parse(rawURL); err == nil && u.Hostname() != "" {
+		host = strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	}
+	user = strings.Trim(externalNameRe.ReplaceAllString(strings.ToLower(strings.TrimPrefix(user, "@")), "_"), "_.")
+	if user == "" {
+		return host
+	}
+	return user + "@" + host
+}
+
+// adoptLocalFile copies a file written by an external downloader into partPath while
+// hashing it, applying the same size limit as HTTP downloads.
+func (st *appState) adoptLocalFile(src, partPath string) (partDownload, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return partDownload{}, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return partDownload{}, err
+	}
+	if limit := st.cfg.mediaMaxFileSize; limit > 0 && info.Size() > limit {
+		return partDownload{}, errMediaTooLarge
+	}
+	out, err := os.Create(partPath)
+	if err != nil {
+		return partDownload{}, err
+	}
+	h := md5.New()
+	n, err := io.Copy(io.MultiWriter(out, h), in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		removePart(partPath)
+		return partDownload{}, err
+	}
+	if n != info.Size() {
+		removePart(partPath)
+		return partDownload{}, errors.New("short copy")
+	}
+	return partDownload{Hash: hex.EncodeToString(h.Sum(nil)), Size: n}, nil
+}
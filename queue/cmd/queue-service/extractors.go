@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// mediaExtractor resolves the downloadable media of a post URL on one site.
+type mediaExtractor interface {
+	Name() string
+	Match(rawURL string) bool
+	Extract(ctx context.Context, rawURL string) (extractedPost, error)
+}
+
+// extractedPost is a post resolved by an extractor. ID names the saved files and Username
+// the media directory, so both must be filesystem safe.
+type extractedPost struct {
+	ID       string
+	Username string
+	Media    []tweetMedia
+	Meta     *tweetMeta
+	// Cleanup, when set, releases local files once the media has been ingested.
+	Cleanup func()
+}
+
+const extractorX = "x"
+
+// extractors lists the supported sites in match order. An external downloader accepts
+// any URL, so it comes last unless EXTERNAL_DOWNLOADER_MODE=always puts it first.
+func (st *appState) extractors() []mediaExtractor {
+	list := []mediaExtractor{
+		xExtractor{st: st},
+		mastodonExtractor{client: st.mediaClient},
+	}
+	if ext, ok := newExternalExtractor(st.cfg); ok {
+		if st.cfg.externalDownloaderMode == "always" {
+			return []mediaExtractor{ext}
+		}
+		list = append(list, ext)
+	}
+	return list
+}
+
+// extractorFor returns the extractor handling rawURL, or nil when no site matches.
+func (st *appState) extractorFor(rawURL string) mediaExtractor {
+	for _, e := range st.extractors() {
+		if e.Match(rawURL) {
+			return e
+		}
+	}
+	return nil
+}
+
+// isSupportedPostURL reports whether any extractor accepts rawURL.
+func (st *appState) isSupportedPostURL(rawURL string) bool {
+	return st.extractorFor(rawURL) != nil
+}
+
+// xExtractor handles x.com / twitter.com status URLs through getTweetImages.
+type xExtractor struct {
+	st *appState
+}
+
+func (xExtractor) Name() string { return extractorX }
+
+func (xExtractor) Match(rawURL string) bool { return isTweetURL(rawURL) }
+
+func (e xExtractor) Extract(ctx context.Context, rawURL string) (extractedPost, error) {
+	media, meta, err := e.st.getTweetImages(ctx, rawURL)
+	if err != nil {
+		return extractedPost{}, err
+	}
+	return extractedPost{
+		ID:       tweetIDFromURL(rawURL),
+		Username: extractUsername(rawURL),
+		Media:    media,
+		Meta:     meta,
+	}, nil
+}
+
+// mastodonStatusRe matches https://instance/@user/123 and https://instance/@user@remote/123.
+var mastodonStatusRe = regexp.MustCompile(`^https?://([A-Za-z0-9.-]+\.[A-Za-z]{2,})/@([A-Za-z0-9_]+)(?:@([A-Za-z0-9.-]+))?/(\d+)/?(?:[?#].*)?$`)
+
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// mastodonExtractor handles Mastodon status URLs through the instance's public API.
+// Media is stored under "<user>@<instance>" so it never collides with X usernames.
+type mastodonExtractor struct {
+	client httpDoer
+}
+
+func (mastodonExtractor) Name() string { return "mastodon" }
+
+func (mastodonExtractor) Match(rawURL string) bool {
+	return mastodonStatusRe.MatchString(strings.TrimSpace(rawURL))
+}
+
+func (e mastodonExtractor) Extract(ctx context.Context, rawURL string) (extractedPost, error) {
+	m := mastodonStatusRe.FindStringSubmatch(strings.TrimSpace(rawURL))
+	if m == nil {
+		return extractedPost{}, errors.New("invalid mastodon status url")
+	}
+	instance, statusID := strings.ToLower(m[1]), m[4]
+
+	apiURL := fmt.Sprintf("https://%s/api/v1/statuses/%s", instance, statusID)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	req.Header.Set("Accept", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return extractedPost{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return extractedPost{}, fmt.Errorf("mastodon api status=%d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return extractedPost{}, err
+	}
+
+	var parsed struct {
+		ID        string `json:"id"`
+		CreatedAt string `json:"created_at"`
+		Content   string `json:"content"`
+		Account   struct {
+			Acct        string `json:"acct"`
+			DisplayName string `json:"display_name"`
+		} `json:"account"`
+		MediaAttachments []struct {
+			Type string `json:"type"`
+			URL  string `json:"url"`
+		} `json:"media_attachments"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return extractedPost{}, err
+	}
+
+	// acct is "user" for local accounts and "user@remote" for federated ones.
+	acct := parsed.Account.Acct
+	if acct == "" {
+		acct = m[2]
+		if m[3] != "" {
+			acct += "@" + m[3]
+		}
+	}
+	if !strings.Contains(acct, "@") {
+		acct += "@" + instance
+	}
+	username := strings.ToLower(acct)
+
+	media := make([]tweetMedia, 0, len(parsed.MediaAttachments))
+	for _, a := range parsed.MediaAttachments {
+		if a.URL == "" {
+			continue
+		}
+		switch a.Type {
+		case "image":
+			media = append(media, tweetMedia{URL: a.URL, Type: mediaTypeImage})
+		case "gifv":
+			media = append(media, tweetMedia{URL: a.URL, Type: mediaTypeAnimatedGIF})
+		}
+	}
+
+	text := strings.NewReplacer("<br>", "\n", "<br/>", "\n", "<br />", "\n", "</p><p>", "\n\n").Replace(parsed.Content)
+	text = html.UnescapeString(htmlTagRe.ReplaceAllString(text, ""))
+	return extractedPost{
+		ID:       statusID,
+		Username: username,
+		Media:    media,
+		Meta: &tweetMeta{
+			TweetID:     statusID,
+			Username:    username,
+			DisplayName: parsed.Account.DisplayName,
+			Text:        strings.TrimSpace(text),
+			CreatedAt:   parsed.CreatedAt,
+		},
+	}, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	feedDefaultLimit = 50
+	feedMaxLimit     = 200
+	feedTitleRunes   = 80
+)
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Author    atomAuthor `xml:"author"`
+	Links     []atomLink `xml:"link"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// archivedTweet is one tweet of a user directory with the time its newest file was saved.
+type archivedTweet struct {
+	TweetID    string
+	Paths      []string
+	ArchivedAt time.Time
+}
+
+// publicBaseURL is the origin used for links in feeds. PUBLIC_BASE_URL wins; otherwise
+// it is rebuilt from the forwarded headers set by the frontend proxy.
+func (st *appState) publicBaseURL(r *http.Request) string {
+	if st.cfg.publicBaseURL != "" {
+		return strings.TrimRight(st.cfg.publicBaseURL, "/")
+	}
+	scheme := "http"
+	if proto := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0]); proto != "" {
+		scheme = proto
+	} else if r.TLS != nil {
+		scheme = "https"
+	}
+	host := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0])
+	if host == "" {
+		host = r.Host
+	}
+	return scheme + "://" + host
+}
+
+// mediaURL escapes each segment of a stored path for use under /images/.
+func mediaURL(base, rel string) string {
+	parts := strings.Split(rel, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return base + "/images/" + strings.Join(parts, "/")
+}
+
+// handleUserFeed serves the most recently archived tweets of username as an Atom feed.
+func (st *appState) handleUserFeed(w http.ResponseWriter, r *http.Request, username string) {
+	limit := parsePositiveInt(r.URL.Query().Get("limit"), feedDefaultLimit)
+	if limit > feedMaxLimit {
+		limit = feedMaxLimit
+	}
+	userPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, username)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "User not found"})
+		return
+	}
+	entries, err := os.ReadDir(userPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "User not found"})
+			return
+		}
+		internalServerError(w)
+		return
+	}
+
+	groups := st.groupUserImagesByTweet(userPath, entries)
+	// Images with an excluded tag are left out of their entry, like the tweet listings do;
+	// the public listener relies on this to keep NSFW media out of the feed.
+	if excludeTags := parseExcludeTags(r.URL.Query()); len(excludeTags) > 0 {
+		allPaths := make([]string, 0)
+		for _, paths := range groups {
+			allPaths = append(allPaths, paths...)
+		}
+		tagsMap, err := st.store.GetTagsForFiles(allPaths)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		for tweetID, paths := range groups {
+			kept := make([]string, 0, len(paths))
+			for _, p := range paths {
+				if !hasTagPattern(tagsMap[p], excludeTags) {
+					kept = append(kept, p)
+				}
+			}
+			groups[tweetID] = kept
+		}
+	}
+
+	tweets := make([]archivedTweet, 0)
+	for tweetID, paths := range groups {
+		t := archivedTweet{TweetID: tweetID, Paths: paths}
+		for _, p := range paths {
+			info, err := os.Stat(filepath.Join(st.cfg.mediaRoot, filepath.FromSlash(p)))
+			if err == nil && info.ModTime().After(t.ArchivedAt) {
+				t.ArchivedAt = info.ModTime()
+			}
+		}
+		if !t.ArchivedAt.IsZero() {
+			sort.Strings(t.Paths)
+			tweets = append(tweets, t)
+		}
+	}
+	sort.Slice(tweets, func(i, j int) bool {
+		if !tweets[i].ArchivedAt.Equal(tweets[j].ArchivedAt) {
+			return tweets[i].ArchivedAt.After(tweets[j].ArchivedAt)
+		}
+		return tweets[i].TweetID > tweets[j].TweetID
+	})
+	if len(tweets) > limit {
+		tweets = tweets[:limit]
+	}
+
+	tweetIDs := make([]string, 0, len(tweets))
+	for _, t := range tweets {
+		tweetIDs = append(tweetIDs, t.TweetID)
+	}
+	metas, err := st.store.GetTweetMetas(tweetIDs)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+
+	base := st.publicBaseURL(r)
+	userURL := base + "/users/" + url.PathEscape(username)
+	feed := atomFeed{
+		ID:      userURL,
+		Title:   fmt.Sprintf("%s - x-media-downloder", username),
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: base + "/api/users/" + url.PathEscape(username) + "/feed.atom"},
+			{Rel: "alternate", Type: "text/html", Href: userURL},
+		},
+		Entries: make([]atomEntry, 0, len(tweets)),
+	}
+	if len(tweets) > 0 {
+		feed.Updated = tweets[0].ArchivedAt.UTC().Format(time.RFC3339)
+	}
+	for _, t := range tweets {
+		feed.Entries = append(feed.Entries, feedEntry(base, userURL, username, t, metas[t.TweetID]))
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(out)
+}
+
+func feedEntry(base, userURL, username string, t archivedTweet, meta tweetMeta) atomEntry {
+	author := atomAuthor{Name: username, URI: userURL}
+	if meta.DisplayName != "" {
+		author.Name = meta.DisplayName
+	}
+	title := fmt.Sprintf("Tweet %s", t.TweetID)
+	if text := strings.TrimSpace(meta.Text); text != "" {
+		title = truncateRunes(strings.SplitN(text, "\n", 2)[0], feedTitleRunes)
+	}
+
+	var body strings.Builder
+	if meta.Text != "" {
+		body.WriteString("<p>")
+		body.WriteString(strings.ReplaceAll(html.EscapeString(meta.Text), "\n", "<br>"))
+		body.WriteString("</p>")
+	}
+	for _, p := range t.Paths {
+		src := html.EscapeString(mediaURL(base, p))
+		if isVideoFile(p) {
+			fmt.Fprintf(&body, `<p><a href="%s">%s</a></p>`, src, html.EscapeString(filepath.Base(p)))
+			continue
+		}
+		fmt.Fprintf(&body, `<p><a href="%s"><img src="%s" alt="%s"></a></p>`, src, src, html.EscapeString(filepath.Base(p)))
+	}
+
+	entry := atomEntry{
+		ID:      userURL + "#" + url.PathEscape(t.TweetID),
+		Title:   title,
+		Updated: t.ArchivedAt.UTC().Format(time.RFC3339),
+		Author:  author,
+		Links:   []atomLink{{Rel: "alternate", Type: "text/html", Href: userURL}},
+		Content: atomText{Type: "html", Body: body.String()},
+	}
+	if published, err := time.Parse(time.RFC3339, meta.CreatedAt); err == nil {
+		entry.Published = published.UTC().Format(time.RFC3339)
+	}
+	// Mastodon accounts are stored as user@instance and have no X permalink.
+	if !strings.Contains(username, "@") {
+		entry.Links = append(entry.Links, atomLink{Rel: "related", Type: "text/html", Href: fmt.Sprintf("https://x.com/%s/status/%s", url.PathEscape(username), url.PathEscape(t.TweetID))})
+	}
+	return entry
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
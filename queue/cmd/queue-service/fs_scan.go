@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// errScanTimeout is returned when a filesystem scan does not finish within FS_SCAN_TIMEOUT.
+var errScanTimeout = errors.New("filesystem scan timed out")
+
+// parallelEach calls fn for every index in [0, n) on at most workers goroutines. It stops
+// handing out work once ctx is done and returns the context error in that case.
+func parallelEach(ctx context.Context, n, workers int, fn func(i int)) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		case jobs <- i:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// scanContext bounds a request-driven filesystem scan by FS_SCAN_TIMEOUT.
+func (st *appState) scanContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if st.cfg.fsScanTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, st.cfg.fsScanTimeout)
+}
+
+// scanError maps a parallelEach error to errScanTimeout when the deadline was hit.
+func scanError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errScanTimeout
+	}
+	return err
+}
+
+// writeScanError responds with 503 for scan timeouts and 500 otherwise.
+func writeScanError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errScanTimeout) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": err.Error()})
+		return
+	}
+	internalServerError(w)
+}
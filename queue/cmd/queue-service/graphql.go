@@ -0,0 +1,809 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// This file holds a small GraphQL executor covering what the gallery needs: queries with
+// arguments, variables with defaults, aliases, fragments and __typename. Mutations,
+// subscriptions, directives and introspection are not supported; the REST API covers
+// those use cases.
+
+const (
+	maxGraphQLBodyBytes = 1 << 20
+	maxGraphQLDepth     = 12
+	// maxGraphQLFields caps the selected fields after fragments are inlined, and
+	// maxGraphQLRootFields the root fields, each of which may scan the whole library.
+	maxGraphQLFields     = 500
+	maxGraphQLRootFields = 10
+)
+
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+type graphQLError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   any            `json:"data"`
+	Errors []graphQLError `json:"errors,omitempty"`
+}
+
+// gqlSelection is one field of a selection set after fragments were inlined.
+type gqlSelection struct {
+	Alias     string
+	Name      string
+	Args      map[string]gqlValue
+	Selection []gqlSelection
+}
+
+func (s gqlSelection) key() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
+}
+
+// gqlValue is an argument literal, or a reference to a variable when Var is set.
+type gqlValue struct {
+	Var   string
+	Value any
+	List  []gqlValue
+	Obj   map[string]gqlValue
+}
+
+func (v gqlValue) resolve(vars map[string]any) any {
+	switch {
+	case v.Var != "":
+		return vars[v.Var]
+	case v.List != nil:
+		out := make([]any, 0, len(v.List))
+		for _, item := range v.List {
+			out = append(out, item.resolve(vars))
+		}
+		return out
+	case v.Obj != nil:
+		out := make(map[string]any, len(v.Obj))
+		for k, item := range v.Obj {
+			out[k] = item.resolve(vars)
+		}
+		return out
+	}
+	return v.Value
+}
+
+// gqlArgs are the resolved arguments of a field.
+type gqlArgs map[string]any
+
+func (a gqlArgs) String(name string) string {
+	s, _ := a[name].(string)
+	return strings.TrimSpace(s)
+}
+
+func (a gqlArgs) Int(name string, fallback int) int {
+	if v, ok := intFromAny(a[name]); ok {
+		return v
+	}
+	return fallback
+}
+
+func (a gqlArgs) Float(name string) float64 {
+	switch v := a[name].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	}
+	return 0
+}
+
+func (a gqlArgs) Strings(name string) []string {
+	switch v := a[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// gqlResolver resolves a field of parent. Object valued fields return the Go value their
+// type's resolvers expect as parent, or a slice of them for list fields.
+type gqlResolver func(ctx context.Context, parent any, args gqlArgs) (any, error)
+
+type gqlField struct {
+	// Type names the object type of the result; empty for scalars.
+	Type    string
+	Resolve gqlResolver
+}
+
+type gqlSchema map[string]map[string]gqlField
+
+// gqlObject keeps response fields in selection order, as the spec requires.
+type gqlObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *gqlObject) set(key string, value any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type gqlExecutor struct {
+	schema gqlSchema
+	vars   map[string]any
+	errors []graphQLError
+}
+
+func (e *gqlExecutor) object(ctx context.Context, typ string, parent any, sels []gqlSelection, path []any) *gqlObject {
+	out := &gqlObject{values: map[string]any{}}
+	fields := e.schema[typ]
+	for _, sel := range sels {
+		fieldPath := append(append([]any{}, path...), sel.key())
+		if sel.Name == "__typename" {
+			out.set(sel.key(), typ)
+			continue
+		}
+		field, ok := fields[sel.Name]
+		if !ok {
+			e.errors = append(e.errors, graphQLError{Message: fmt.Sprintf("cannot query field %q on type %q", sel.Name, typ), Path: fieldPath})
+			out.set(sel.key(), nil)
+			continue
+		}
+		args := gqlArgs{}
+		for name, v := range sel.Args {
+			args[name] = v.resolve(e.vars)
+		}
+		value, err := field.Resolve(ctx, parent, args)
+		if err != nil {
+			e.errors = append(e.errors, graphQLError{Message: err.Error(), Path: fieldPath})
+			out.set(sel.key(), nil)
+			continue
+		}
+		out.set(sel.key(), e.complete(ctx, field.Type, value, sel, fieldPath))
+	}
+	return out
+}
+
+func (e *gqlExecutor) complete(ctx context.Context, typ string, value any, sel gqlSelection, path []any) any {
+	if value == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil
+	}
+	if typ == "" {
+		return value
+	}
+	if len(sel.Selection) == 0 {
+		e.errors = append(e.errors, graphQLError{Message: fmt.Sprintf("field %q of type %q must have a selection", sel.Name, typ), Path: path})
+		return nil
+	}
+	if rv.Kind() == reflect.Slice {
+		out := make([]any, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			out = append(out, e.complete(ctx, typ, rv.Index(i).Interface(), sel, append(append([]any{}, path...), i)))
+		}
+		return out
+	}
+	return e.object(ctx, typ, value, sel.Selection, path)
+}
+
+// executeGraphQL runs the query against the "Query" type of schema.
+func executeGraphQL(ctx context.Context, schema gqlSchema, req graphQLRequest) graphQLResponse {
+	op, err := parseGraphQL(req.Query, req.OperationName)
+	if err != nil {
+		return graphQLResponse{Errors: []graphQLError{{Message: err.Error()}}}
+	}
+	vars := op.Defaults
+	if vars == nil {
+		vars = map[string]any{}
+	}
+	for k, v := range req.Variables {
+		vars[k] = v
+	}
+	e := &gqlExecutor{schema: schema, vars: vars}
+	data := e.object(ctx, "Query", nil, op.Selection, nil)
+	return graphQLResponse{Data: data, Errors: e.errors}
+}
+
+func (st *appState) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if raw := q.Get("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				writeJSON(w, http.StatusBadRequest, graphQLResponse{Errors: []graphQLError{{Message: "variables must be a JSON object"}}})
+				return
+			}
+		}
+	case http.MethodPost:
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBodyBytes))
+		if err := dec.Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, graphQLResponse{Errors: []graphQLError{{Message: "invalid request body"}}})
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeJSON(w, http.StatusBadRequest, graphQLResponse{Errors: []graphQLError{{Message: "query is required"}}})
+		return
+	}
+	resp := executeGraphQL(r.Context(), st.graphQLSchema(), req)
+	if resp.Data == nil {
+		writeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Parsing
+
+type gqlTokenKind int
+
+const (
+	gqlEOF gqlTokenKind = iota
+	gqlPunct
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind gqlTokenKind
+	text string
+}
+
+func lexGraphQL(src string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, gqlToken{gqlPunct, "..."})
+			i += 3
+		case strings.ContainsRune("{}()[]:=!$@|&", rune(c)):
+			tokens = append(tokens, gqlToken{gqlPunct, string(c)})
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, gqlToken{gqlName, src[i:j]})
+			i = j
+		case c == '-' || c >= '0' && c <= '9':
+			j := i + 1
+			kind := gqlInt
+			for j < len(src) && strings.IndexByte("0123456789.eE+-", src[j]) >= 0 {
+				if src[j] == '.' || src[j] == 'e' || src[j] == 'E' {
+					kind = gqlFloat
+				}
+				j++
+			}
+			tokens = append(tokens, gqlToken{kind, src[i:j]})
+			i = j
+		case c == '"':
+			if strings.HasPrefix(src[i:], `"""`) {
+				end := strings.Index(src[i+3:], `"""`)
+				if end < 0 {
+					return nil, errors.New("unterminated block string")
+				}
+				tokens = append(tokens, gqlToken{gqlString, src[i+3 : i+3+end]})
+				i += end + 6
+				continue
+			}
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				if j < len(src) && src[j] == '\n' {
+					return nil, errors.New("unterminated string")
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, errors.New("unterminated string")
+			}
+			// GraphQL string escapes are a subset of JSON's.
+			var s string
+			if err := json.Unmarshal([]byte(src[i:j+1]), &s); err != nil {
+				return nil, fmt.Errorf("invalid string %s", src[i:j+1])
+			}
+			tokens = append(tokens, gqlToken{gqlString, s})
+			i = j + 1
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return append(tokens, gqlToken{kind: gqlEOF}), nil
+}
+
+type gqlParser struct {
+	tokens    []gqlToken
+	pos       int
+	fragments map[string][]gqlRawSelection
+	// resolved memoizes inlined fragments so repeated spreads are expanded once.
+	resolved map[string][]gqlSelection
+}
+
+// gqlRawSelection is a selection before fragment spreads are resolved.
+type gqlRawSelection struct {
+	field    gqlSelection
+	children []gqlRawSelection
+	spread   string
+	inline   []gqlRawSelection
+}
+
+func (p *gqlParser) peek() gqlToken { return p.tokens[p.pos] }
+
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != gqlEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *gqlParser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == gqlPunct || t.kind == gqlName) && t.text == text
+}
+
+func (p *gqlParser) expect(text string) error {
+	if !p.is(text) {
+		return p.unexpected(fmt.Sprintf("%q", text))
+	}
+	p.next()
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.peek().kind != gqlName {
+		return "", p.unexpected("a name")
+	}
+	return p.next().text, nil
+}
+
+func (p *gqlParser) unexpected(want string) error {
+	t := p.peek()
+	if t.kind == gqlEOF {
+		return fmt.Errorf("syntax error: expected %s, found end of query", want)
+	}
+	return fmt.Errorf("syntax error: expected %s, found %q", want, t.text)
+}
+
+// gqlOperation is the query to run: its selection set with fragments inlined, and the
+// default values of its variables.
+type gqlOperation struct {
+	Selection []gqlSelection
+	Defaults  map[string]any
+}
+
+// parseGraphQL parses a query document and returns the requested operation.
+func parseGraphQL(src, operationName string) (gqlOperation, error) {
+	tokens, err := lexGraphQL(src)
+	if err != nil {
+		return gqlOperation{}, fmt.Errorf("syntax error: %w", err)
+	}
+	p := &gqlParser{tokens: tokens, fragments: map[string][]gqlRawSelection{}, resolved: map[string][]gqlSelection{}}
+	operations := map[string][]gqlRawSelection{}
+	defaults := map[string]map[string]any{}
+	var order []string
+	for p.peek().kind != gqlEOF {
+		switch {
+		case p.is("{"):
+			sels, err := p.selectionSet(0)
+			if err != nil {
+				return gqlOperation{}, err
+			}
+			operations[""] = sels
+			order = append(order, "")
+		case p.is("query"):
+			p.next()
+			name := ""
+			if p.peek().kind == gqlName {
+				name = p.next().text
+			}
+			if p.is("(") {
+				if defaults[name], err = p.variableDefinitions(); err != nil {
+					return gqlOperation{}, err
+				}
+			}
+			sels, err := p.selectionSet(0)
+			if err != nil {
+				return gqlOperation{}, err
+			}
+			operations[name] = sels
+			order = append(order, name)
+		case p.is("fragment"):
+			p.next()
+			name, err := p.name()
+			if err != nil {
+				return gqlOperation{}, err
+			}
+			if err := p.expect("on"); err != nil {
+				return gqlOperation{}, err
+			}
+			if _, err := p.name(); err != nil {
+				return gqlOperation{}, err
+			}
+			sels, err := p.selectionSet(0)
+			if err != nil {
+				return gqlOperation{}, err
+			}
+			p.fragments[name] = sels
+		case p.is("mutation"), p.is("subscription"):
+			return gqlOperation{}, fmt.Errorf("%s operations are not supported", p.peek().text)
+		default:
+			return gqlOperation{}, p.unexpected("an operation")
+		}
+	}
+	if len(order) == 0 {
+		return gqlOperation{}, errors.New("no operation in query")
+	}
+	if operationName == "" && len(order) > 1 {
+		return gqlOperation{}, errors.New("operationName is required when the query has several operations")
+	}
+	if operationName == "" {
+		operationName = order[0]
+	}
+	raw, ok := operations[operationName]
+	if !ok {
+		return gqlOperation{}, fmt.Errorf("unknown operation %q", operationName)
+	}
+	sels, err := p.resolve(raw, map[string]bool{})
+	if err != nil {
+		return gqlOperation{}, err
+	}
+	// Fragments are parsed on their own, so only the inlined query shows the real depth.
+	if graphQLDepth(sels) > maxGraphQLDepth {
+		return gqlOperation{}, fmt.Errorf("query is nested deeper than %d levels", maxGraphQLDepth)
+	}
+	if len(sels) > maxGraphQLRootFields {
+		return gqlOperation{}, fmt.Errorf("query selects more than %d root fields", maxGraphQLRootFields)
+	}
+	return gqlOperation{Selection: sels, Defaults: defaults[operationName]}, nil
+}
+
+// variableDefinitions parses ($name: Type = default, ...). Types are not checked, the
+// resolvers convert what they get.
+func (p *gqlParser) variableDefinitions() (map[string]any, error) {
+	p.next()
+	defaults := map[string]any{}
+	for !p.is(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		for p.is("[") || p.is("]") || p.is("!") || p.peek().kind == gqlName {
+			p.next()
+		}
+		if p.is("=") {
+			p.next()
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			defaults[name] = v.resolve(nil)
+		}
+	}
+	p.next()
+	return defaults, nil
+}
+
+func (p *gqlParser) selectionSet(depth int) ([]gqlRawSelection, error) {
+	if depth > maxGraphQLDepth {
+		return nil, fmt.Errorf("query is nested deeper than %d levels", maxGraphQLDepth)
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var out []gqlRawSelection
+	for !p.is("}") {
+		if p.is("...") {
+			p.next()
+			if p.is("on") || p.is("{") {
+				if p.is("on") {
+					p.next()
+					if _, err := p.name(); err != nil {
+						return nil, err
+					}
+				}
+				sels, err := p.selectionSet(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, gqlRawSelection{inline: sels})
+				continue
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, gqlRawSelection{spread: name})
+			continue
+		}
+		sel, err := p.field(depth)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sel)
+	}
+	p.next()
+	if len(out) == 0 {
+		return nil, errors.New("syntax error: empty selection set")
+	}
+	return out, nil
+}
+
+func (p *gqlParser) field(depth int) (gqlRawSelection, error) {
+	name, err := p.name()
+	if err != nil {
+		return gqlRawSelection{}, err
+	}
+	sel := gqlRawSelection{field: gqlSelection{Name: name}}
+	if p.is(":") {
+		p.next()
+		if sel.field.Name, err = p.name(); err != nil {
+			return gqlRawSelection{}, err
+		}
+		sel.field.Alias = name
+	}
+	if p.is("(") {
+		p.next()
+		sel.field.Args = map[string]gqlValue{}
+		for !p.is(")") {
+			argName, err := p.name()
+			if err != nil {
+				return gqlRawSelection{}, err
+			}
+			if err := p.expect(":"); err != nil {
+				return gqlRawSelection{}, err
+			}
+			v, err := p.value()
+			if err != nil {
+				return gqlRawSelection{}, err
+			}
+			sel.field.Args[argName] = v
+		}
+		p.next()
+	}
+	if p.is("@") {
+		return gqlRawSelection{}, errors.New("directives are not supported")
+	}
+	if p.is("{") {
+		if sel.children, err = p.selectionSet(depth + 1); err != nil {
+			return gqlRawSelection{}, err
+		}
+	}
+	return sel, nil
+}
+
+func (p *gqlParser) value() (gqlValue, error) {
+	t := p.peek()
+	switch {
+	case t.kind == gqlPunct && t.text == "$":
+		p.next()
+		name, err := p.name()
+		return gqlValue{Var: name}, err
+	case t.kind == gqlPunct && t.text == "[":
+		p.next()
+		list := []gqlValue{}
+		for !p.is("]") {
+			v, err := p.value()
+			if err != nil {
+				return gqlValue{}, err
+			}
+			list = append(list, v)
+		}
+		p.next()
+		return gqlValue{List: list}, nil
+	case t.kind == gqlPunct && t.text == "{":
+		p.next()
+		obj := map[string]gqlValue{}
+		for !p.is("}") {
+			name, err := p.name()
+			if err != nil {
+				return gqlValue{}, err
+			}
+			if err := p.expect(":"); err != nil {
+				return gqlValue{}, err
+			}
+			if obj[name], err = p.value(); err != nil {
+				return gqlValue{}, err
+			}
+		}
+		p.next()
+		return gqlValue{Obj: obj}, nil
+	case t.kind == gqlInt:
+		p.next()
+		n, err := strconv.Atoi(t.text)
+		if err != nil {
+			return gqlValue{}, fmt.Errorf("invalid integer %q", t.text)
+		}
+		return gqlValue{Value: n}, nil
+	case t.kind == gqlFloat:
+		p.next()
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return gqlValue{}, fmt.Errorf("invalid float %q", t.text)
+		}
+		return gqlValue{Value: f}, nil
+	case t.kind == gqlString:
+		p.next()
+		return gqlValue{Value: t.text}, nil
+	case t.kind == gqlName:
+		p.next()
+		switch t.text {
+		case "true":
+			return gqlValue{Value: true}, nil
+		case "false":
+			return gqlValue{Value: false}, nil
+		case "null":
+			return gqlValue{}, nil
+		}
+		// Enum values are passed to resolvers as strings.
+		return gqlValue{Value: t.text}, nil
+	}
+	return gqlValue{}, p.unexpected("a value")
+}
+
+// resolve inlines fragment spreads. Every result is checked against maxGraphQLFields
+// before it is merged further, so fragments that double at each level fail early instead
+// of expanding exponentially.
+func (p *gqlParser) resolve(raw []gqlRawSelection, visiting map[string]bool) ([]gqlSelection, error) {
+	var out []gqlSelection
+	for _, r := range raw {
+		switch {
+		case r.spread != "":
+			frag, ok := p.fragments[r.spread]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %q", r.spread)
+			}
+			if visiting[r.spread] {
+				return nil, fmt.Errorf("fragment %q spreads itself", r.spread)
+			}
+			sels, done := p.resolved[r.spread]
+			if !done {
+				visiting[r.spread] = true
+				var err error
+				sels, err = p.resolve(frag, visiting)
+				delete(visiting, r.spread)
+				if err != nil {
+					return nil, err
+				}
+				p.resolved[r.spread] = sels
+			}
+			out = mergeGraphQLSelections(out, sels)
+		case r.inline != nil:
+			sels, err := p.resolve(r.inline, visiting)
+			if err != nil {
+				return nil, err
+			}
+			out = mergeGraphQLSelections(out, sels)
+		default:
+			sel := r.field
+			if r.children != nil {
+				children, err := p.resolve(r.children, visiting)
+				if err != nil {
+					return nil, err
+				}
+				sel.Selection = children
+			}
+			out = mergeGraphQLSelections(out, []gqlSelection{sel})
+		}
+		if countGraphQLFields(out, maxGraphQLFields) > maxGraphQLFields {
+			return nil, fmt.Errorf("query selects more than %d fields", maxGraphQLFields)
+		}
+	}
+	return out, nil
+}
+
+// mergeGraphQLSelections adds sels to out, merging the sub-selections of fields that
+// share a response key, e.g. when a fragment and the query both select "images".
+// Sub-selections may be shared with memoized fragments, so they are copied, not
+// modified in place.
+func mergeGraphQLSelections(out, sels []gqlSelection) []gqlSelection {
+	for _, sel := range sels {
+		merged := false
+		for i := range out {
+			if out[i].key() == sel.key() && out[i].Name == sel.Name {
+				out[i].Selection = mergeGraphQLSelections(slices.Clone(out[i].Selection), sel.Selection)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			out = append(out, sel)
+		}
+	}
+	return out
+}
+
+// countGraphQLFields counts the fields in sels, stopping once the count passes limit.
+func countGraphQLFields(sels []gqlSelection, limit int) int {
+	n := 0
+	for _, sel := range sels {
+		n += 1 + countGraphQLFields(sel.Selection, limit-n-1)
+		if n > limit {
+			break
+		}
+	}
+	return n
+}
+
+// graphQLDepth is how deep selection sets nest below sels, counted like the parser's
+// depth: a set of scalar fields is 0.
+func graphQLDepth(sels []gqlSelection) int {
+	depth := 0
+	for _, sel := range sels {
+		if len(sel.Selection) > 0 {
+			depth = max(depth, 1+graphQLDepth(sel.Selection))
+		}
+	}
+	return depth
+}
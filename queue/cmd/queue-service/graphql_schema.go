@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultGraphQLLimit = 100
+	maxGraphQLLimit     = 1000
+)
+
+// gqlImage is an Image node. Tags and records are loaded for a whole list at once so a
+// page of images costs two queries, not two per image.
+type gqlImage struct {
+	Path   string
+	Tags   []imageTag
+	Record *imageRecord
+	Crop   *cropSuggestion
+	Colors []dominantColor
+	Rating imageRating
+}
+
+func (img *gqlImage) user() string {
+	user, _, _ := strings.Cut(img.Path, "/")
+	return user
+}
+
+func (img *gqlImage) tweetID() string {
+	parts := strings.Split(img.Path, "/")
+	if len(parts) == 3 {
+		return parts[1]
+	}
+	return tweetIDFromFilename(parts[len(parts)-1])
+}
+
+// gqlTweet is a Tweet node: a tweet with at least one stored image.
+type gqlTweet struct {
+	ID     string
+	User   string
+	Meta   tweetMeta
+	Images []string
+}
+
+func gqlPage(args gqlArgs) (offset, limit int) {
+	limit = args.Int("limit", defaultGraphQLLimit)
+	if limit <= 0 || limit > maxGraphQLLimit {
+		limit = maxGraphQLLimit
+	}
+	return max(args.Int("offset", 0), 0), limit
+}
+
+func pageOf[T any](items []T, args gqlArgs) []T {
+	offset, limit := gqlPage(args)
+	start, end := pageBounds(offset, limit, len(items))
+	return items[start:end]
+}
+
+// gqlProp exposes a scalar derived from the parent node.
+func gqlProp[T any](get func(T) any) gqlField {
+	return gqlField{Resolve: func(_ context.Context, parent any, _ gqlArgs) (any, error) {
+		return get(parent.(T)), nil
+	}}
+}
+
+func (st *appState) loadGraphQLImages(paths []string) ([]*gqlImage, error) {
+	tagsMap, err := st.store.GetTagsForFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	records, err := st.store.GetImageRecords(paths)
+	if err != nil {
+		return nil, err
+	}
+	crops, err := st.store.GetCropSuggestions(paths)
+	if err != nil {
+		return nil, err
+	}
+	palettes, err := st.store.GetDominantColors(paths)
+	if err != nil {
+		return nil, err
+	}
+	ratings, err := st.store.GetImageRatings(paths)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*gqlImage, 0, len(paths))
+	for _, p := range paths {
+		img := &gqlImage{Path: p, Tags: tagsMap[p], Colors: palettes[p], Rating: ratings[p]}
+		if rec, ok := records[p]; ok {
+			img.Record = &rec
+		}
+		if c, ok := crops[p]; ok {
+			img.Crop = &c
+		}
+		out = append(out, img)
+	}
+	return out, nil
+}
+
+// graphQLImages resolves the images of an /api/images style query, newest first.
+func (st *appState) graphQLImages(ctx context.Context, user string, args gqlArgs) ([]*gqlImage, error) {
+	if u := args.String("user"); u != "" {
+		user = u
+	}
+	excludeTags := append(args.Strings("excludeTags"), exactTagPatterns(args.Strings("excludeExactTags"))...)
+	filter, err := newImageFilter(args.Strings("tags"), excludeTags, user,
+		args.Int("minTagCount", -1), args.Int("maxTagCount", -1), args.String("from"), args.String("to"), args.String("q"))
+	if err != nil {
+		return nil, err
+	}
+	if err := filter.setColor(args.String("color"), false); err != nil {
+		return nil, err
+	}
+	images, _, err := st.findImages(ctx, filter)
+	if err != nil {
+		return nil, scanError(err)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].MTime > images[j].MTime })
+	images = pageOf(images, args)
+	paths := make([]string, 0, len(images))
+	for _, img := range images {
+		paths = append(paths, img.Path)
+	}
+	return st.loadGraphQLImages(paths)
+}
+
+// graphQLUserTweets lists the tweets of a user that have stored images, newest first.
+func (st *appState) graphQLUserTweets(user string, args gqlArgs) ([]*gqlTweet, error) {
+	userPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, user)
+	if err != nil {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(userPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	imagesByTweet := st.groupUserImagesByTweet(userPath, entries)
+	tweetIDs := make([]string, 0, len(imagesByTweet))
+	for tweetID, paths := range imagesByTweet {
+		if len(paths) > 0 {
+			tweetIDs = append(tweetIDs, tweetID)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(tweetIDs)))
+	tweetIDs = pageOf(tweetIDs, args)
+	metas, err := st.store.GetTweetMetas(tweetIDs)
+	if err != nil {
+		return nil, err
+	}
+	tweets := make([]*gqlTweet, 0, len(tweetIDs))
+	for _, id := range tweetIDs {
+		paths := imagesByTweet[id]
+		sort.Strings(paths)
+		tweets = append(tweets, &gqlTweet{ID: id, User: user, Meta: metas[id], Images: paths})
+	}
+	return tweets, nil
+}
+
+func (st *appState) graphQLTweet(tweetID, user string) (*gqlTweet, error) {
+	metas, err := st.store.GetTweetMetas([]string{tweetID})
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := metas[tweetID]
+	if ok && user == "" {
+		user = meta.Username
+	}
+	if user == "" {
+		return nil, nil
+	}
+	userPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, user)
+	if err != nil {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(userPath)
+	if err != nil {
+		return nil, nil
+	}
+	paths := st.groupUserImagesByTweet(userPath, entries)[tweetID]
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	sort.Strings(paths)
+	return &gqlTweet{ID: tweetID, User: user, Meta: meta, Images: paths}, nil
+}
+
+func (st *appState) graphQLSchema() gqlSchema {
+	return gqlSchema{
+		"Query": {
+			"users": {Type: "User", Resolve: func(ctx context.Context, _ any, args gqlArgs) (any, error) {
+				users, err := st.listUserCounts(ctx)
+				if err != nil {
+					return nil, scanError(err)
+				}
+				q := strings.ToLower(args.String("q"))
+				out := make([]userInfo, 0, len(users))
+				for _, u := range users {
+					if u.TweetCount > 0 && strings.Contains(strings.ToLower(u.Username), q) {
+						out = append(out, u)
+					}
+				}
+				sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i].Username) < strings.ToLower(out[j].Username) })
+				return pageOf(out, args), nil
+			}},
+			"user": {Type: "User", Resolve: func(ctx context.Context, _ any, args gqlArgs) (any, error) {
+				users, err := st.listUserCounts(ctx)
+				if err != nil {
+					return nil, scanError(err)
+				}
+				for _, u := range users {
+					if strings.EqualFold(u.Username, args.String("name")) {
+						return u, nil
+					}
+				}
+				return nil, nil
+			}},
+			"images": {Type: "Image", Resolve: func(ctx context.Context, _ any, args gqlArgs) (any, error) {
+				return st.graphQLImages(ctx, "", args)
+			}},
+			"image": {Type: "Image", Resolve: func(_ context.Context, _ any, args gqlArgs) (any, error) {
+				rel := normalizeFilepath(args.String("path"))
+				full, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+				if err != nil {
+					return nil, nil
+				}
+				if _, err := os.Stat(full); err != nil {
+					return nil, nil
+				}
+				images, err := st.loadGraphQLImages([]string{rel})
+				if err != nil {
+					return nil, err
+				}
+				return images[0], nil
+			}},
+			"tweet": {Type: "Tweet", Resolve: func(_ context.Context, _ any, args gqlArgs) (any, error) {
+				return st.graphQLTweet(args.String("id"), args.String("user"))
+			}},
+			"tags": {Type: "TagCount", Resolve: func(_ context.Context, _ any, args gqlArgs) (any, error) {
+				tags, err := st.store.GetAllTags()
+				if err != nil {
+					return nil, err
+				}
+				q := strings.ToLower(args.String("q"))
+				out := make([]tagCount, 0, len(tags))
+				for _, item := range tags {
+					tag, _ := item["tag"].(string)
+					count, _ := intFromAny(item["count"])
+					if strings.Contains(strings.ToLower(tag), q) {
+						out = append(out, tagCount{Tag: tag, Count: count})
+					}
+				}
+				sort.Slice(out, func(i, j int) bool {
+					if out[i].Count == out[j].Count {
+						return strings.ToLower(out[i].Tag) < strings.ToLower(out[j].Tag)
+					}
+					return out[i].Count > out[j].Count
+				})
+				return pageOf(out, args), nil
+			}},
+			"tasks": {Type: "Task", Resolve: func(ctx context.Context, _ any, args gqlArgs) (any, error) {
+				limit := args.Int("limit", 30)
+				if limit <= 0 || limit > maxTrackedTasks {
+					limit = maxTrackedTasks
+				}
+				ids, err := st.redis.LRange(ctx, taskListKey, int64(-limit), -1).Result()
+				if err != nil {
+					return nil, err
+				}
+				out := make([]downloadTaskStatusResponse, 0, len(ids))
+				for _, id := range uniqueReverse(ids) {
+					out = append(out, st.resolveDownloadStatus(ctx, id))
+				}
+				return out, nil
+			}},
+			"task": {Type: "Task", Resolve: func(ctx context.Context, _ any, args gqlArgs) (any, error) {
+				id := args.String("id")
+				if id == "" {
+					return nil, errors.New("id is required")
+				}
+				return st.resolveDownloadStatus(ctx, id), nil
+			}},
+		},
+		"User": {
+			"name":       gqlProp(func(u userInfo) any { return u.Username }),
+			"tweetCount": gqlProp(func(u userInfo) any { return u.TweetCount }),
+			"imageCount": gqlProp(func(u userInfo) any { return u.ImageCount }),
+			"tweets": {Type: "Tweet", Resolve: func(_ context.Context, parent any, args gqlArgs) (any, error) {
+				return st.graphQLUserTweets(parent.(userInfo).Username, args)
+			}},
+			"images": {Type: "Image", Resolve: func(ctx context.Context, parent any, args gqlArgs) (any, error) {
+				return st.graphQLImages(ctx, parent.(userInfo).Username, args)
+			}},
+		},
+		"Tweet": {
+			"id":   gqlProp(func(t *gqlTweet) any { return t.ID }),
+			"user": gqlProp(func(t *gqlTweet) any { return t.User }),
+			"url": gqlProp(func(t *gqlTweet) any {
+				return fmt.Sprintf("https://x.com/%s/status/%s", url.PathEscape(t.User), url.PathEscape(t.ID))
+			}),
+			"displayName": gqlProp(func(t *gqlTweet) any { return t.Meta.DisplayName }),
+			"text":        gqlProp(func(t *gqlTweet) any { return t.Meta.Text }),
+			"createdAt":   gqlProp(func(t *gqlTweet) any { return t.Meta.CreatedAt }),
+			"images": {Type: "Image", Resolve: func(_ context.Context, parent any, _ gqlArgs) (any, error) {
+				return st.loadGraphQLImages(parent.(*gqlTweet).Images)
+			}},
+		},
+		"Image": {
+			"path":      gqlProp(func(img *gqlImage) any { return img.Path }),
+			"mediaType": gqlProp(func(img *gqlImage) any { return mediaTypeFromPath(img.Path) }),
+			"ext":       gqlProp(func(img *gqlImage) any { return strings.TrimPrefix(path.Ext(img.Path), ".") }),
+			"user":      gqlProp(func(img *gqlImage) any { return img.user() }),
+			"tweetId":   gqlProp(func(img *gqlImage) any { return img.tweetID() }),
+			"hash": gqlProp(func(img *gqlImage) any {
+				if img.Record == nil {
+					return nil
+				}
+				return img.Record.ContentHash
+			}),
+			"size": gqlProp(func(img *gqlImage) any {
+				if img.Record == nil {
+					return nil
+				}
+				return img.Record.Size
+			}),
+			"tags": {Type: "Tag", Resolve: func(_ context.Context, parent any, args gqlArgs) (any, error) {
+				minConfidence := args.Float("minConfidence")
+				tags := make([]imageTag, 0, len(parent.(*gqlImage).Tags))
+				for _, t := range parent.(*gqlImage).Tags {
+					if t.Confidence >= minConfidence {
+						tags = append(tags, t)
+					}
+				}
+				return tags, nil
+			}},
+			"cropSuggestion": {Type: "CropSuggestion", Resolve: func(_ context.Context, parent any, _ gqlArgs) (any, error) {
+				return parent.(*gqlImage).Crop, nil
+			}},
+			"dominantColors": {Type: "DominantColor", Resolve: func(_ context.Context, parent any, _ gqlArgs) (any, error) {
+				return parent.(*gqlImage).Colors, nil
+			}},
+			"favorite": gqlProp(func(img *gqlImage) any { return img.Rating.Favorite }),
+			"rating":   gqlProp(func(img *gqlImage) any { return img.Rating.Rating }),
+			"tweet": {Type: "Tweet", Resolve: func(_ context.Context, parent any, _ gqlArgs) (any, error) {
+				img := parent.(*gqlImage)
+				if img.tweetID() == "" {
+					return nil, nil
+				}
+				return st.graphQLTweet(img.tweetID(), img.user())
+			}},
+		},
+		"Tag": {
+			"name":       gqlProp(func(t imageTag) any { return t.Tag }),
+			"confidence": gqlProp(func(t imageTag) any { return t.Confidence }),
+			"source":     gqlProp(func(t imageTag) any { return t.Source }),
+		},
+		"CropSuggestion": {
+			"x":           gqlProp(func(c *cropSuggestion) any { return c.X }),
+			"y":           gqlProp(func(c *cropSuggestion) any { return c.Y }),
+			"width":       gqlProp(func(c *cropSuggestion) any { return c.Width }),
+			"height":      gqlProp(func(c *cropSuggestion) any { return c.Height }),
+			"imageWidth":  gqlProp(func(c *cropSuggestion) any { return c.ImageWidth }),
+			"imageHeight": gqlProp(func(c *cropSuggestion) any { return c.ImageHeight }),
+		},
+		"DominantColor": {
+			"hex":    gqlProp(func(c dominantColor) any { return c.Hex }),
+			"weight": gqlProp(func(c dominantColor) any { return c.Weight }),
+		},
+		"TagCount": {
+			"name":  gqlProp(func(t tagCount) any { return t.Tag }),
+			"count": gqlProp(func(t tagCount) any { return t.Count }),
+		},
+		"Task": {
+			"id":              gqlProp(func(t downloadTaskStatusResponse) any { return t.TaskID }),
+			"kind":            gqlProp(func(t downloadTaskStatusResponse) any { return t.Kind }),
+			"url":             gqlProp(func(t downloadTaskStatusResponse) any { return t.URL }),
+			"username":        gqlProp(func(t downloadTaskStatusResponse) any { return t.Username }),
+			"state":           gqlProp(func(t downloadTaskStatusResponse) any { return t.State }),
+			"message":         gqlProp(func(t downloadTaskStatusResponse) any { return t.Message }),
+			"current":         gqlProp(func(t downloadTaskStatusResponse) any { return t.Current }),
+			"total":           gqlProp(func(t downloadTaskStatusResponse) any { return t.Total }),
+			"downloadedCount": gqlProp(func(t downloadTaskStatusResponse) any { return t.DownloadedCount }),
+			"skippedCount":    gqlProp(func(t downloadTaskStatusResponse) any { return t.SkippedCount }),
+			"parentTaskId":    gqlProp(func(t downloadTaskStatusResponse) any { return t.ParentTaskID }),
+			"childTaskIds":    gqlProp(func(t downloadTaskStatusResponse) any { return t.ChildTaskIDs }),
+		},
+	}
+}
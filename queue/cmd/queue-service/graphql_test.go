@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// describeGraphQL renders a resolved selection as name(alias){children} for comparisons.
+func describeGraphQL(sels []gqlSelection) string {
+	parts := make([]string, 0, len(sels))
+	for _, sel := range sels {
+		s := sel.Name
+		if sel.Alias != "" {
+			s = sel.Alias + ":" + s
+		}
+		if len(sel.Selection) > 0 {
+			s += "{" + describeGraphQL(sel.Selection) + "}"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestParseGraphQL(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		operation string
+		want      string
+	}{
+		{"anonymous", `{ users { name } }`, "", "users{name}"},
+		{"named query", `query Q { users { name } }`, "", "users{name}"},
+		{"alias", `{ a: user(name: "x") { name } b: user(name: "y") { name } }`, "", "a:user{name} b:user{name}"},
+		{"commas and comments", "{ users { name, # the handle\n images { path } } }", "", "users{name images{path}}"},
+		{"fragment spread", `{ users { ...U } } fragment U on User { name images { path } }`, "", "users{name images{path}}"},
+		{"fragment before query", `fragment U on User { name } { users { ...U } }`, "", "users{name}"},
+		{"inline fragment", `{ users { ... on User { name } ... { images { path } } } }`, "", "users{name images{path}}"},
+		{"spread merges with field", `{ users { images { path } ...U } } fragment U on User { images { tags { tag } } }`, "", "users{images{path tags{tag}}}"},
+		{"same fragment twice", `{ users { ...U ...U } } fragment U on User { name }`, "", "users{name}"},
+		{"typename", `{ __typename users { __typename } }`, "", "__typename users{__typename}"},
+		{"operation name picks", `query A { users { name } } query B { tags { tag } }`, "B", "tags{tag}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, err := parseGraphQL(tt.query, tt.operation)
+			if err != nil {
+				t.Fatalf("parseGraphQL: %v", err)
+			}
+			if got := describeGraphQL(op.Selection); got != tt.want {
+				t.Fatalf("selection = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGraphQLArguments(t *testing.T) {
+	op, err := parseGraphQL(`query Q($user: String = "alice", $n: Int) {
+		images(user: $user, limit: $n, tags: ["a", "b"], minTagCount: -2, confidence: 0.5,
+			exact: true, missing: null, sort: LATEST, filter: {tag: "x"}, note: """raw "text\n""") { path }
+	}`, "")
+	if err != nil {
+		t.Fatalf("parseGraphQL: %v", err)
+	}
+	if op.Defaults["user"] != "alice" {
+		t.Fatalf("defaults = %v", op.Defaults)
+	}
+	args := gqlArgs{}
+	for name, v := range op.Selection[0].Args {
+		args[name] = v.resolve(map[string]any{"user": "bob", "n": 3})
+	}
+	got, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"confidence":0.5,"exact":true,"filter":{"tag":"x"},"limit":3,"minTagCount":-2,"missing":null,"note":"raw \"text\\n","sort":"LATEST","tags":["a","b"],"user":"bob"}`
+	if string(got) != want {
+		t.Fatalf("args = %s\nwant   %s", got, want)
+	}
+}
+
+func TestParseGraphQLErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		operation string
+		wantErr   string
+	}{
+		{"empty", ``, "", "no operation in query"},
+		{"mutation", `mutation { deleteUser }`, "", "mutation operations are not supported"},
+		{"subscription", `subscription { tasks }`, "", "subscription operations are not supported"},
+		{"directive", `{ users @include(if: true) { name } }`, "", "directives are not supported"},
+		{"unknown fragment", `{ users { ...Nope } }`, "", `unknown fragment "Nope"`},
+		{"fragment cycle", `{ users { ...A } } fragment A on User { ...B } fragment B on User { ...A }`, "", "spreads itself"},
+		{"empty selection", `{ users { } }`, "", "empty selection set"},
+		{"unclosed selection", `{ users { name }`, "", "found end of query"},
+		{"unterminated string", `{ user(name: "x) { name } }`, "", "unterminated string"},
+		{"bad character", `{ users { name; } }`, "", "unexpected character"},
+		{"several operations", `query A { users { name } } query B { tags { tag } }`, "", "operationName is required"},
+		{"unknown operation", `query A { users { name } }`, "B", `unknown operation "B"`},
+		{"too deep", `{ a { b { c { d { e { f { g { h { i { j { k { l { m { n } } } } } } } } } } } } } }`, "", "nested deeper than 12 levels"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseGraphQL(tt.query, tt.operation)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseGraphQL error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// chainedFragments builds fragments F0..F(n-1) where each spreads the next twice,
+// optionally under distinct aliases so the copies can't be merged.
+func chainedFragments(n int, aliased bool) string {
+	var b strings.Builder
+	b.WriteString(`{ users { ...F0 } }`)
+	for i := 0; i < n; i++ {
+		next := fmt.Sprintf("...F%d", i+1)
+		if i == n-1 {
+			next = "name"
+		}
+		if aliased && i < n-1 {
+			fmt.Fprintf(&b, " fragment F%d on User { a: images { %s } b: images { %s } }", i, next, next)
+		} else {
+			fmt.Fprintf(&b, " fragment F%d on User { %s %s }", i, next, next)
+		}
+	}
+	return b.String()
+}
+
+func TestParseGraphQLLimits(t *testing.T) {
+	deepFragments := `{ users { ...F1 } }`
+	for i := 1; i <= 14; i++ {
+		deepFragments += fmt.Sprintf(" fragment F%d on User { images { ...F%d } }", i, i+1)
+	}
+	deepFragments += " fragment F15 on User { name }"
+
+	roots := make([]string, 0, maxGraphQLRootFields+1)
+	for i := 0; i <= maxGraphQLRootFields; i++ {
+		roots = append(roots, fmt.Sprintf("a%d: users { name }", i))
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{"chained fragments count toward depth", deepFragments, "nested deeper than 12 levels"},
+		{"aliased fragment doubling", chainedFragments(40, true), fmt.Sprintf("more than %d fields", maxGraphQLFields)},
+		{"root field aliases", "{ " + strings.Join(roots, " ") + " }", fmt.Sprintf("more than %d root fields", maxGraphQLRootFields)},
+		{"many fields", "{ users { " + aliasList("n", maxGraphQLFields) + " } }", fmt.Sprintf("more than %d fields", maxGraphQLFields)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			_, err := parseGraphQL(tt.query, "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseGraphQL error = %v, want %q", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("parseGraphQL took %s", elapsed)
+			}
+		})
+	}
+
+	// Spreading the same fragment twice merges, so doubling without aliases stays small
+	// and, memoized, fast.
+	start := time.Now()
+	op, err := parseGraphQL(chainedFragments(40, false), "")
+	if err != nil {
+		t.Fatalf("parseGraphQL: %v", err)
+	}
+	if got := describeGraphQL(op.Selection); got != "users{name}" {
+		t.Fatalf("selection = %s, want users{name}", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("parseGraphQL took %s", elapsed)
+	}
+}
+
+func aliasList(prefix string, n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = fmt.Sprintf("%s%d: name", prefix, i)
+	}
+	return strings.Join(parts, " ")
+}
+
+type testGQLUser struct {
+	Name   string
+	Images []string
+}
+
+func testGraphQLSchema() gqlSchema {
+	users := []*testGQLUser{
+		{Name: "alice", Images: []string{"alice/1.jpg", "alice/2.jpg"}},
+		{Name: "bob"},
+	}
+	return gqlSchema{
+		"Query": {
+			"users": {Type: "User", Resolve: func(_ context.Context, _ any, args gqlArgs) (any, error) {
+				return users[:min(args.Int("limit", len(users)), len(users))], nil
+			}},
+			"user": {Type: "User", Resolve: func(_ context.Context, _ any, args gqlArgs) (any, error) {
+				for _, u := range users {
+					if u.Name == args.String("name") {
+						return u, nil
+					}
+				}
+				return (*testGQLUser)(nil), nil
+			}},
+			"fail": {Resolve: func(context.Context, any, gqlArgs) (any, error) {
+				return nil, errors.New("boom")
+			}},
+		},
+		"User": {
+			"name": {Resolve: func(_ context.Context, parent any, _ gqlArgs) (any, error) {
+				return parent.(*testGQLUser).Name, nil
+			}},
+			"images": {Type: "Image", Resolve: func(_ context.Context, parent any, _ gqlArgs) (any, error) {
+				return parent.(*testGQLUser).Images, nil
+			}},
+		},
+		"Image": {
+			"path": {Resolve: func(_ context.Context, parent any, _ gqlArgs) (any, error) {
+				return parent.(string), nil
+			}},
+		},
+	}
+}
+
+func TestExecuteGraphQL(t *testing.T) {
+	tests := []struct {
+		name string
+		req  graphQLRequest
+		want string
+	}{
+		{
+			name: "nested lists keep selection order",
+			req:  graphQLRequest{Query: `{ users { images { path } name } }`},
+			want: `{"data":{"users":[{"images":[{"path":"alice/1.jpg"},{"path":"alice/2.jpg"}],"name":"alice"},{"images":[],"name":"bob"}]}}`,
+		},
+		{
+			name: "variables and defaults",
+			req: graphQLRequest{
+				Query:     `query Q($who: String = "alice", $n: Int = 5) { user(name: $who) { name } users(limit: $n) { name } }`,
+				Variables: map[string]any{"n": 1},
+			},
+			want: `{"data":{"user":{"name":"alice"},"users":[{"name":"alice"}]}}`,
+		},
+		{
+			name: "aliases and typename",
+			req:  graphQLRequest{Query: `{ a: user(name: "alice") { __typename name } b: user(name: "nobody") { name } }`},
+			want: `{"data":{"a":{"__typename":"User","name":"alice"},"b":null}}`,
+		},
+		{
+			name: "resolver error is reported with its path",
+			req:  graphQLRequest{Query: `{ fail users(limit: 1) { name } }`},
+			want: `{"data":{"fail":null,"users":[{"name":"alice"}]},"errors":[{"message":"boom","path":["fail"]}]}`,
+		},
+		{
+			name: "unknown field",
+			req:  graphQLRequest{Query: `{ users(limit: 1) { name email } }`},
+			want: `{"data":{"users":[{"name":"alice","email":null}]},"errors":[{"message":"cannot query field \"email\" on type \"User\"","path":["users",0,"email"]}]}`,
+		},
+		{
+			name: "object without selection",
+			req:  graphQLRequest{Query: `{ user(name: "alice") }`},
+			want: `{"data":{"user":null},"errors":[{"message":"field \"user\" of type \"User\" must have a selection","path":["user"]}]}`,
+		},
+		{
+			name: "parse error has no data",
+			req:  graphQLRequest{Query: `mutation { x }`},
+			want: `{"data":null,"errors":[{"message":"mutation operations are not supported"}]}`,
+		},
+	}
+	schema := testGraphQLSchema()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(executeGraphQL(context.Background(), schema, tt.req))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("response = %s\nwant       %s", got, tt.want)
+			}
+		})
+	}
+}
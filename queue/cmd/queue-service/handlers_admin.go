@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type cleanupEmptyUsersRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+func (st *appState) handleCleanupEmptyUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body cleanupEmptyUsersRequest
+	if r.ContentLength != 0 && !decodeJSONOrBadRequest(w, r, &body, "invalid request body") {
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := cleanupEmptyUsersTaskPayload{TaskID: taskID, DryRun: body.DryRun}
+	err := st.enqueueTask(taskTypeCleanupEmptyUsers, st.cfg.queueName, taskID, payload, 30*time.Minute)
+	if err != nil {
+		logger.Error("failed to enqueue cleanup empty users task",
+			"task_type", taskTypeCleanupEmptyUsers,
+			"task_id", taskID,
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(r.Context(), st.redis, taskID, "PENDING", taskMessage(msgCleanupUsersQueued))
+	logger.Info("cleanup empty users task queued", "task_id", taskID, "dry_run", body.DryRun)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success": true,
+		"queued":  true,
+		"task_id": taskID,
+		"dry_run": body.DryRun,
+		"message": localize(r.Context(), msgCleanupUsersQueued),
+	})
+}
+
+type unlockTasksRequest struct {
+	// Families limits the unlock to autotag, retag or reconcile; empty means all of them.
+	Families []string `json:"families"`
+	Reason   string   `json:"reason"`
+}
+
+// handleUnlockTasks force-clears the busy state of task families, e.g. after the worker
+// running their task was killed before the watchdog noticed.
+func (st *appState) handleUnlockTasks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body unlockTasksRequest
+	if r.ContentLength != 0 && !decodeJSONOrBadRequest(w, r, &body, "invalid request body") {
+		return
+	}
+	families := taskFamilies
+	if names := trimNonEmpty(body.Families); len(names) > 0 {
+		families = nil
+		for _, name := range names {
+			idx := slices.IndexFunc(taskFamilies, func(f taskFamily) bool { return strings.EqualFold(f.Name, name) })
+			if idx < 0 {
+				badRequest(w, "unknown task family: "+name)
+				return
+			}
+			families = append(families, taskFamilies[idx])
+		}
+	}
+
+	ctx := r.Context()
+	results := make([]familyUnlockResult, 0, len(families))
+	for _, fam := range families {
+		results = append(results, st.forceUnlockFamily(ctx, fam))
+	}
+	st.recordAudit(ctx, r, "tasks.unlock", map[string]any{
+		"reason":  strings.TrimSpace(body.Reason),
+		"results": results,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "items": results})
+}
+
+func (st *appState) handleNormalizeTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	taskID := uuid.NewString()
+	payload := normalizeTagsTaskPayload{TaskID: taskID}
+	waiting, err := st.submitFamilyTask(ctx, familyAutotag, taskTypeNormalizeTags, st.cfg.queueName, taskID, payload, time.Hour)
+	if errors.Is(err, errTaskFamilyBusy) {
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"success": false,
+			"message": localize(ctx, familyAutotag.BusyCode),
+		})
+		return
+	}
+	if err != nil {
+		logger.Error("failed to enqueue normalize tags task",
+			"task_type", taskTypeNormalizeTags,
+			"task_id", taskID,
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(ctx, st.redis, taskID, "PENDING", taskMessage(msgNormalizeTagsQueued))
+	logger.Info("normalize tags task queued", "task_id", taskID, "waiting", waiting)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success": true,
+		"queued":  true,
+		"waiting": waiting,
+		"task_id": taskID,
+		"message": localize(ctx, msgNormalizeTagsQueued),
+	})
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
 )
 
 func (st *appState) handleDownload(w http.ResponseWriter, r *http.Request) {
@@ -21,58 +24,260 @@ func (st *appState) handleDownload(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type downloadRequest struct {
+	URLs     []string `json:"urls"`
+	Users    []string `json:"users"`
+	Expand   string   `json:"expand"`
+	Priority string   `json:"priority"`
+	Force    bool     `json:"force"`
+}
+
 func (st *appState) handleDownloadPost(w http.ResponseWriter, r *http.Request) {
-	var body struct {
-		URLs []string `json:"urls"`
-	}
+	var body downloadRequest
 	if !decodeJSONOrBadRequest(w, r, &body, "URL list is required") {
 		return
 	}
-	if len(body.URLs) == 0 {
+	if len(body.URLs) == 0 && len(body.Users) == 0 {
 		badRequest(w, "URL list is required")
 		return
 	}
+	expand, err := parseExpandOption(body.Expand)
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	// A single pasted URL goes to the interactive queue so it does not wait behind bulk
+	// jobs; "normal" opts out and "high" routes a whole batch there.
+	queue := st.cfg.queueName
+	switch strings.ToLower(strings.TrimSpace(body.Priority)) {
+	case "":
+		if len(body.URLs) == 1 && len(body.Users) == 0 {
+			queue = st.cfg.interactiveQueue
+		}
+	case "high":
+		queue = st.cfg.interactiveQueue
+	case "normal":
+	default:
+		badRequest(w, "priority must be high or normal")
+		return
+	}
 
 	ctx := r.Context()
 	count := 0
 	queued := make([]map[string]string, 0)
+	seen := make(map[string]struct{}, len(body.URLs))
+	tracked := make([]trackedTask, 0, len(body.URLs)+len(body.Users))
+	batch := make([]downloadTaskPayload, 0, len(body.URLs))
+	var pending map[string]string
+	if !body.Force && len(body.URLs) > 0 {
+		pending = st.pendingDownloadURLs(ctx)
+	}
 	for _, rawURL := range body.URLs {
-		url := strings.TrimSpace(rawURL)
-		if !isTweetURL(url) {
+		url := canonicalPostURL(rawURL)
+		if !st.isSupportedPostURL(url) {
+			continue
+		}
+		if _, dup := seen[url]; dup {
+			continue
+		}
+		seen[url] = struct{}{}
+		if !body.Force {
+			if taskID, ok := pending[url]; ok {
+				queued = append(queued, map[string]string{"task_id": taskID, "url": url, "status": "duplicate", "reason": "queued"})
+				continue
+			}
+			if m := tweetURLRe.FindStringSubmatch(url); m != nil && st.isTweetDownloaded(m[1], m[2]) {
+				queued = append(queued, map[string]string{"url": url, "status": "duplicate", "reason": "downloaded"})
+				continue
+			}
+		}
+		batch = append(batch, downloadTaskPayload{URL: url, Expand: expand})
+	}
+	for _, p := range st.submitDownloads(queue, batch) {
+		tracked = append(tracked, trackedTask{TaskID: p.TaskID, URL: p.URL})
+		count++
+		queued = append(queued, map[string]string{"task_id": p.TaskID, "url": p.URL, "status": "queued"})
+	}
+
+	queuedUsers := make([]map[string]string, 0)
+	for _, rawUser := range body.Users {
+		username, ok := normalizeUsername(rawUser)
+		if !ok {
 			continue
 		}
 		taskID := uuid.NewString()
-		payload := downloadTaskPayload{TaskID: taskID, URL: url}
-		err := st.enqueueTask(taskTypeDownload, st.cfg.queueName, taskID, payload, 30*time.Minute)
+		payload := timelineTaskPayload{TaskID: taskID, Username: username}
+		err := st.enqueueTask(taskTypeDownloadTimeline, queue, taskID, payload, 2*time.Hour)
 		if err != nil {
-			logger.Warn("failed to enqueue download task",
-				"task_type", taskTypeDownload,
+			logger.Warn("failed to enqueue timeline task",
+				"task_type", taskTypeDownloadTimeline,
 				"task_id", taskID,
-				"url", url,
+				"username", username,
 				"error", err,
 			)
 			continue
 		}
-
-		setTaskState(ctx, st.redis, taskID, "PENDING", map[string]any{"status": "Queued"})
-		st.redis.RPush(ctx, taskListKey, taskID)
-		st.redis.HSet(ctx, taskURLHashKey, taskID, url)
+		tracked = append(tracked, trackedTask{TaskID: taskID, Username: username})
 		count++
-		queued = append(queued, map[string]string{"task_id": taskID, "url": url})
+		queuedUsers = append(queuedUsers, map[string]string{"task_id": taskID, "username": username})
 	}
 
+	st.trackTasks(ctx, tracked)
 	st.redis.LTrim(ctx, taskListKey, -maxTrackedTasks, -1)
-	logger.Info("download tasks queued", "count", count)
+	logger.Info("download tasks queued", "count", count, "queue", queue)
 	writeJSON(w, http.StatusOK, map[string]any{
 		"success":      true,
-		"message":      fmt.Sprintf("%d download tasks have been queued.", count),
+		"message":      localize(ctx, msgDownloadQueued, count),
+		"queue":        queue,
 		"queued_tasks": queued,
+		"queued_users": queuedUsers,
 	})
 }
 
+// pendingDownloadURLs maps the URL of every download task that is still queued or running
+// to its task ID. Only members of pendingDownloadSetKey are looked at, so the cost follows
+// the number of in-flight tasks rather than every task ever tracked. Members whose state has
+// expired or finished without setTaskState removing them are pruned here.
+func (st *appState) pendingDownloadURLs(ctx context.Context) map[string]string {
+	pending := make(map[string]string)
+	ids, err := st.redis.SMembers(ctx, pendingDownloadSetKey).Result()
+	if err != nil || len(ids) == 0 {
+		return pending
+	}
+	pipe := st.redis.TxPipeline()
+	states := make([]*redis.StringCmd, len(ids))
+	urls := make([]*redis.StringCmd, len(ids))
+	for i, id := range ids {
+		states[i] = pipe.Get(ctx, taskMetaPrefix+id)
+		urls[i] = pipe.HGet(ctx, taskURLHashKey, id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return pending
+	}
+	stale := make([]any, 0)
+	for i, id := range ids {
+		var rec queueTaskStatus
+		raw, _ := states[i].Result()
+		u, _ := urls[i].Result()
+		if raw == "" || json.Unmarshal([]byte(raw), &rec) != nil || isFinishedTaskState(rec.Status) || u == "" {
+			stale = append(stale, id)
+			continue
+		}
+		pending[u] = id
+	}
+	if len(stale) > 0 {
+		st.redis.SRem(ctx, pendingDownloadSetKey, stale...)
+	}
+	return pending
+}
+
+// enqueueDownloadURL queues a single tweet download and registers it for status tracking.
+// Callers are responsible for trimming taskListKey afterwards.
+func (st *appState) enqueueDownloadURL(ctx context.Context, url string) (string, error) {
+	return st.enqueueDownload(ctx, downloadTaskPayload{URL: url})
+}
+
+// enqueueDownload is enqueueDownloadURL with expansion and parent linkage options.
+func (st *appState) enqueueDownload(ctx context.Context, payload downloadTaskPayload) (string, error) {
+	return st.enqueueDownloadOn(ctx, st.cfg.queueName, payload)
+}
+
+// enqueueDownloadOn is enqueueDownload on an explicit queue.
+func (st *appState) enqueueDownloadOn(ctx context.Context, queue string, payload downloadTaskPayload) (string, error) {
+	taskID, err := st.submitDownload(queue, payload)
+	if err != nil {
+		return "", err
+	}
+	st.trackTasks(ctx, []trackedTask{{TaskID: taskID, URL: payload.URL, ParentTaskID: payload.ParentTaskID}})
+	return taskID, nil
+}
+
+// submitDownload hands a download task to asynq without registering it for status
+// tracking; batch callers register all their tasks at once with trackTasks. A preset
+// payload.TaskID is kept.
+func (st *appState) submitDownload(queue string, payload downloadTaskPayload) (string, error) {
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+	payload.TaskID = taskID
+	url := payload.URL
+	maxRetry := st.cfg.downloadMaxRetry
+	if maxRetry < 0 {
+		maxRetry = 0
+	}
+	err := st.enqueueTask(taskTypeDownload, queue, taskID, payload, 30*time.Minute, asynq.MaxRetry(maxRetry))
+	if err != nil {
+		logger.Warn("failed to enqueue download task",
+			"task_type", taskTypeDownload,
+			"task_id", taskID,
+			"queue", queue,
+			"url", url,
+			"error", err,
+		)
+		return "", err
+	}
+	return taskID, nil
+}
+
+// trackedTask is a queued download or timeline task to register for status tracking.
+type trackedTask struct {
+	TaskID       string
+	URL          string
+	Username     string
+	ParentTaskID string
+	// Upload marks media uploaded by hand, which a retry could not fetch again.
+	Upload bool
+}
+
+// trackTasks writes the PENDING state and tracking entries of tasks in one MULTI/EXEC
+// round trip. The tasks are already enqueued, so a worker may have recorded a newer state
+// in the meantime; SETNX keeps it. Callers are responsible for trimming taskListKey
+// afterwards.
+func (st *appState) trackTasks(ctx context.Context, tasks []trackedTask) {
+	if len(tasks) == 0 {
+		return
+	}
+	pipe := st.redis.TxPipeline()
+	for _, t := range tasks {
+		state := withMessage(map[string]any{}, "status", msgTaskQueued)
+		if t.Username != "" {
+			state["username"] = t.Username
+		}
+		pipe.SetNX(ctx, taskMetaPrefix+t.TaskID, encodeTaskState("PENDING", state), taskStateTTL)
+		pipe.RPush(ctx, taskListKey, t.TaskID)
+		if t.URL != "" {
+			pipe.HSet(ctx, taskURLHashKey, t.TaskID, t.URL)
+			pipe.SAdd(ctx, pendingDownloadSetKey, t.TaskID)
+		}
+		if t.Username != "" {
+			pipe.HSet(ctx, taskUserHashKey, t.TaskID, t.Username)
+		}
+		if t.ParentTaskID != "" {
+			pipe.HSet(ctx, taskParentHashKey, t.TaskID, t.ParentTaskID)
+		}
+		if t.Upload {
+			pipe.HSet(ctx, taskUploadHashKey, t.TaskID, "1")
+		}
+		pipe.Publish(ctx, taskEventsChannel, encodeTaskEvent(t.TaskID, "PENDING"))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Error("failed to persist task tracking", "count", len(tasks), "error", err)
+	}
+	for _, t := range tasks {
+		logTaskState(t.TaskID, "PENDING", withMessage(map[string]any{}, "status", msgTaskQueued))
+	}
+}
+
 func (st *appState) handleDownloadGet(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	requested := strings.TrimSpace(r.URL.Query().Get("ids"))
+	writeJSON(w, http.StatusOK, st.downloadStatusSnapshot(r.Context(), r.URL.Query().Get("ids")))
+}
+
+// downloadStatusSnapshot is the GET /api/download payload: the requested tasks, or the 30
+// most recently tracked ones, with queue depth and a per-state summary.
+func (st *appState) downloadStatusSnapshot(ctx context.Context, requested string) map[string]any {
+	redisStart := time.Now()
+	requested = strings.TrimSpace(requested)
 	var taskIDs []string
 	if requested != "" {
 		taskIDs = uniqueReverse(strings.Split(requested, ","))
@@ -95,8 +300,9 @@ func (st *appState) handleDownloadGet(w http.ResponseWriter, r *http.Request) {
 	if q, err := st.inspector.GetQueueInfo(st.cfg.queueName); err == nil {
 		queueDepth = q.Pending + q.Active + q.Scheduled + q.Retry
 	}
+	timingFrom(ctx).since("redis", redisStart)
 
-	summary := map[string]int{"total": len(items), "pending": 0, "success": 0, "failure": 0}
+	summary := map[string]int{"total": len(items), "pending": 0, "success": 0, "failure": 0, "cancelled": 0}
 	for _, item := range items {
 		switch item.State {
 		case "PENDING", "PROGRESS":
@@ -105,14 +311,16 @@ func (st *appState) handleDownloadGet(w http.ResponseWriter, r *http.Request) {
 			summary["success"]++
 		case "FAILURE":
 			summary["failure"]++
+		case taskStateCancelled:
+			summary["cancelled"]++
 		}
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
+	return map[string]any{
 		"queue_depth": queueDepth,
 		"summary":     summary,
 		"items":       items,
-	})
+	}
 }
 
 func (st *appState) resolveDownloadStatus(ctx context.Context, taskID string) downloadTaskStatusResponse {
@@ -124,14 +332,57 @@ func (st *appState) resolveDownloadStatus(ctx context.Context, taskID string) do
 	if urlVal != "" {
 		url = &urlVal
 	}
+	kind := "tweet"
+	var username *string
+	if url == nil {
+		if userVal, _ := st.redis.HGet(ctx, taskUserHashKey, taskID).Result(); userVal != "" {
+			kind = "user_timeline"
+			username = &userVal
+		}
+	}
+
+	var parentTaskID *string
+	if parentVal, _ := st.redis.HGet(ctx, taskParentHashKey, taskID).Result(); parentVal != "" {
+		parentTaskID = &parentVal
+	}
+
+	var retryOf, retriedAs *string
+	if v, _ := st.redis.HGet(ctx, taskRetryOfHashKey, taskID).Result(); v != "" {
+		retryOf = &v
+	}
+	if v, _ := st.redis.HGet(ctx, taskRetriedAsHashKey, taskID).Result(); v != "" {
+		retriedAs = &v
+	}
 
 	rec, ok := getTaskState(ctx, st.redis, taskID)
 	if !ok {
-		return downloadTaskStatusResponse{TaskID: taskID, URL: url, State: "PENDING", Message: "Queued or running"}
+		return downloadTaskStatusResponse{TaskID: taskID, URL: url, Kind: kind, Username: username, ParentTaskID: parentTaskID, RetryOf: retryOf, RetriedAs: retriedAs, State: "PENDING", Message: localize(ctx, msgTaskQueuedOrRunning)}
 	}
 
-	resp := downloadTaskStatusResponse{TaskID: taskID, URL: url, State: rec.Status, Message: "Running"}
-	resultMap, _ := rec.Result.(map[string]any)
+	resp := downloadTaskStatusResponse{TaskID: taskID, URL: url, Kind: kind, Username: username, ParentTaskID: parentTaskID, RetryOf: retryOf, RetriedAs: retriedAs, State: rec.Status, Message: localize(ctx, msgTaskRunning)}
+	resultMap := localizeResult(ctx, rec.Result)
+	if ids, ok := resultMap["child_task_ids"].([]any); ok {
+		for _, id := range ids {
+			if s, ok := stringFromAny(id); ok && s != "" {
+				resp.ChildTaskIDs = append(resp.ChildTaskIDs, s)
+			}
+		}
+	}
+	if v, ok := intFromAny(resultMap["enqueued_count"]); ok {
+		resp.EnqueuedCount = &v
+	}
+	if v, ok := intFromAny(resultMap["pages"]); ok {
+		resp.Pages = &v
+	}
+	if v, ok := intFromAny(resultMap["retry_count"]); ok && v > 0 {
+		resp.RetryCount = &v
+	}
+	if v, ok := intFromAny(resultMap["max_retry"]); ok && v > 0 {
+		resp.MaxRetry = &v
+	}
+	if ready, _ := resultMap["report_ready"].(bool); ready {
+		resp.Report = st.backfillReportFor(ctx, taskID)
+	}
 
 	switch rec.Status {
 	case "PROGRESS":
@@ -148,7 +399,7 @@ func (st *appState) resolveDownloadStatus(ctx context.Context, taskID string) do
 		if s, ok := stringFromAny(resultMap["message"]); ok && s != "" {
 			resp.Message = s
 		} else {
-			resp.Message = "Completed"
+			resp.Message = localize(ctx, msgTaskCompleted)
 		}
 		if v, ok := intFromAny(resultMap["downloaded_count"]); ok {
 			resp.DownloadedCount = &v
@@ -160,11 +411,24 @@ func (st *appState) resolveDownloadStatus(ctx context.Context, taskID string) do
 		if s, ok := stringFromAny(resultMap["message"]); ok {
 			resp.Message = s
 		} else {
-			resp.Message = "Task failed"
+			resp.Message = localize(ctx, msgTaskFailed)
+		}
+	case taskStateCancelled:
+		resp.Message = localize(ctx, msgTaskCancelled)
+		if s, ok := stringFromAny(resultMap["message"]); ok && s != "" {
+			resp.Message = s
+		}
+	case "RETRY":
+		// Waiting for the next attempt; reported as pending to keep the state set stable.
+		resp.State = "PENDING"
+		if s, ok := stringFromAny(resultMap["message"]); ok {
+			resp.Message = s
+		} else {
+			resp.Message = localize(ctx, msgTaskRetryWaiting)
 		}
 	default:
 		resp.State = "PENDING"
-		resp.Message = "Queued or running"
+		resp.Message = localize(ctx, msgTaskQueuedOrRunning)
 	}
 	return resp
 }
@@ -241,10 +505,10 @@ func (st *appState) handleAutotagReload(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	if !st.cfg.autotaggerEnable || st.cfg.autotaggerURL == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "message": "Autotagger is not configured."})
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "message": localize(r.Context(), msgAutotagNotConfigured)})
 		return
 	}
-	st.enqueueAutotagTask(w, r, taskTypeAutotagAll, "Started force re-tagging for ALL images in the background.")
+	st.enqueueAutotagTask(w, r, taskTypeAutotagAll, msgAutotagAllStarted)
 }
 
 func (st *appState) handleAutotagUntagged(w http.ResponseWriter, r *http.Request) {
@@ -253,10 +517,10 @@ func (st *appState) handleAutotagUntagged(w http.ResponseWriter, r *http.Request
 		return
 	}
 	if !st.cfg.autotaggerEnable || st.cfg.autotaggerURL == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "message": "Autotagger is not configured."})
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "message": localize(r.Context(), msgAutotagNotConfigured)})
 		return
 	}
-	st.enqueueAutotagTask(w, r, taskTypeAutotagUntagged, "Autotagging for untagged images started in the background.")
+	st.enqueueAutotagTask(w, r, taskTypeAutotagUntagged, msgAutotagUntaggedStarted)
 }
 
 func (st *appState) handleReconcileDB(w http.ResponseWriter, r *http.Request) {
@@ -264,27 +528,28 @@ func (st *appState) handleReconcileDB(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	st.enqueueAutotagTask(
-		w,
-		r,
-		taskTypeReconcileDB,
-		"Started DB consistency check and cleanup in the background.",
-	)
+	// Reconcile is tracked separately so it neither hides nor blocks autotag progress.
+	st.enqueueTrackedTask(w, r, taskTypeReconcileDB, familyReconcile, msgReconcileStarted)
 }
 
-func (st *appState) enqueueAutotagTask(w http.ResponseWriter, r *http.Request, taskType, message string) {
+func (st *appState) enqueueAutotagTask(w http.ResponseWriter, r *http.Request, taskType, messageCode string) {
+	st.enqueueTrackedTask(w, r, taskType, familyAutotag, messageCode)
+}
+
+// enqueueTrackedTask enqueues a maintenance task of fam, applying the family's conflict
+// policy while the previously tracked task is still pending or running.
+func (st *appState) enqueueTrackedTask(w http.ResponseWriter, r *http.Request, taskType string, fam taskFamily, messageCode string) {
 	ctx := r.Context()
-	if st.isTrackedTaskBusy(ctx, autotagLastTask) {
+	taskID := uuid.NewString()
+	payload := autotagTaskPayload{TaskID: taskID}
+	waiting, err := st.submitFamilyTask(ctx, fam, taskType, st.cfg.queueName, taskID, payload, 12*time.Hour)
+	if errors.Is(err, errTaskFamilyBusy) {
 		writeJSON(w, http.StatusConflict, map[string]any{
 			"success": false,
-			"message": "Another autotag task is already running.",
+			"message": localize(ctx, fam.BusyCode),
 		})
 		return
 	}
-
-	taskID := uuid.NewString()
-	payload := autotagTaskPayload{TaskID: taskID}
-	err := st.enqueueTask(taskType, st.cfg.queueName, taskID, payload, 12*time.Hour)
 	if err != nil {
 		logger.Error("failed to enqueue autotag task",
 			"task_type", taskType,
@@ -294,10 +559,13 @@ func (st *appState) enqueueAutotagTask(w http.ResponseWriter, r *http.Request, t
 		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "message": "failed to queue task"})
 		return
 	}
-	st.redis.Set(ctx, autotagLastTask, taskID, 7*24*time.Hour)
-	setTaskState(ctx, st.redis, taskID, "PENDING", map[string]any{"status": "Task is pending..."})
-	logger.Info("autotag task queued", "task_type", taskType, "task_id", taskID)
-	writeJSON(w, http.StatusOK, map[string]any{"success": true, "message": message, "task_id": taskID})
+	statusCode := msgTaskPending
+	if waiting {
+		statusCode = msgTaskWaitingFamily
+	}
+	setTaskState(ctx, st.redis, taskID, "PENDING", withMessage(map[string]any{}, "status", statusCode))
+	logger.Info("maintenance task queued", "task_type", taskType, "task_id", taskID, "waiting", waiting)
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "message": localize(ctx, messageCode), "task_id": taskID, "waiting": waiting})
 }
 
 func (st *appState) handleAutotagStatus(w http.ResponseWriter, r *http.Request) {
@@ -305,59 +573,60 @@ func (st *appState) handleAutotagStatus(w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	ctx := r.Context()
+	writeJSON(w, http.StatusOK, st.autotagStatus(r.Context()))
+}
+
+// autotagStatus reports a running manual autotag task first, then the autotag pass that
+// follows downloads, then the last manual task.
+func (st *appState) autotagStatus(ctx context.Context) map[string]any {
 	manualTaskID, _ := st.redis.Get(ctx, autotagLastTask).Result()
 	manualTaskID = strings.TrimSpace(manualTaskID)
 	manualRec, manualOK := getTaskState(ctx, st.redis, manualTaskID)
 	downloadRec, downloadOK := getDownloadAutotagState(ctx, st.redis)
 
-	// Keep explicit manual autotag task behavior (Tag Untagged Images / Reload / Reconcile).
+	// Keep explicit manual autotag task behavior (Tag Untagged Images / Reload).
 	if manualOK && (manualRec.Status == "PENDING" || manualRec.Status == "PROGRESS") {
-		resultMap, _ := manualRec.Result.(map[string]any)
+		resultMap := localizeResult(ctx, manualRec.Result)
 		resp := map[string]any{
 			"state":   manualRec.Status,
-			"status":  pickFirstNonEmpty(resultMap, "Processing...", "status", "message"),
+			"status":  pickFirstNonEmpty(resultMap, localize(ctx, msgTaskProcessing), "status", "message"),
 			"task_id": manualTaskID,
 		}
 		addProgressFields(resp, resultMap)
-		writeJSON(w, http.StatusOK, resp)
-		return
+		return resp
 	}
 
 	// Then fall back to download-triggered autotag status.
 	if downloadOK {
-		resultMap, _ := downloadRec.Result.(map[string]any)
+		resultMap := localizeResult(ctx, downloadRec.Result)
 		resp := map[string]any{
 			"state":  downloadRec.Status,
-			"status": pickFirstNonEmpty(resultMap, "Processing...", "status", "message"),
+			"status": pickFirstNonEmpty(resultMap, localize(ctx, msgTaskProcessing), "status", "message"),
 			"source": "download",
 		}
 		if taskID, ok := stringFromAny(resultMap["task_id"]); ok && taskID != "" {
 			resp["task_id"] = taskID
 		}
 		addProgressFields(resp, resultMap)
-		writeJSON(w, http.StatusOK, resp)
-		return
+		return resp
 	}
 
 	if manualOK {
-		resultMap, _ := manualRec.Result.(map[string]any)
+		resultMap := localizeResult(ctx, manualRec.Result)
 		resp := map[string]any{
 			"state":   manualRec.Status,
-			"status":  pickFirstNonEmpty(resultMap, "Processing...", "status", "message"),
+			"status":  pickFirstNonEmpty(resultMap, localize(ctx, msgTaskProcessing), "status", "message"),
 			"task_id": manualTaskID,
 		}
 		addProgressFields(resp, resultMap)
-		writeJSON(w, http.StatusOK, resp)
-		return
+		return resp
 	}
 
 	if manualTaskID != "" {
-		writeJSON(w, http.StatusOK, map[string]any{"state": "PENDING", "status": "Task is pending...", "task_id": manualTaskID})
-		return
+		return map[string]any{"state": "PENDING", "status": localize(ctx, msgTaskPending), "task_id": manualTaskID}
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{"state": "NOT_FOUND", "status": "No autotagging task has been run yet."})
+	return map[string]any{"state": "NOT_FOUND", "status": localize(ctx, msgAutotagNone)}
 }
 
 func (st *appState) handleRetagStatus(w http.ResponseWriter, r *http.Request) {
@@ -365,26 +634,71 @@ func (st *appState) handleRetagStatus(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	ctx := r.Context()
-	taskID, err := st.redis.Get(ctx, retagLastTask).Result()
-	if err != nil || taskID == "" {
-		writeJSON(w, http.StatusOK, map[string]any{"state": "NOT_FOUND", "status": "No bulk retag task has been run yet.", "task_id": ""})
+	st.writeTrackedTaskStatus(w, r, retagLastTask, msgRetagNone)
+}
+
+func (st *appState) handleReconcileStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+	st.writeTrackedTaskStatus(w, r, reconcileLastTask, msgReconcileNone)
+}
+
+// writeTrackedTaskStatus reports the state of the task last recorded under trackKey.
+func (st *appState) writeTrackedTaskStatus(w http.ResponseWriter, r *http.Request, trackKey, notFoundCode string) {
+	writeJSON(w, http.StatusOK, st.trackedTaskStatus(r.Context(), trackKey, notFoundCode))
+}
+
+func (st *appState) trackedTaskStatus(ctx context.Context, trackKey, notFoundCode string) map[string]any {
+	taskID, err := st.redis.Get(ctx, trackKey).Result()
+	if err != nil || taskID == "" {
+		return map[string]any{"state": "NOT_FOUND", "status": localize(ctx, notFoundCode), "task_id": ""}
+	}
 	rec, ok := getTaskState(ctx, st.redis, taskID)
 	if !ok {
-		writeJSON(w, http.StatusOK, map[string]any{"state": "PENDING", "status": "Task is pending...", "task_id": taskID})
-		return
+		return map[string]any{"state": "PENDING", "status": localize(ctx, msgTaskPending), "task_id": taskID}
 	}
 
-	resultMap, _ := rec.Result.(map[string]any)
+	resultMap := localizeResult(ctx, rec.Result)
 	resp := map[string]any{
 		"state":   rec.Status,
-		"status":  pickFirstNonEmpty(resultMap, "Processing...", "message", "status"),
+		"status":  pickFirstNonEmpty(resultMap, localize(ctx, msgTaskProcessing), "message", "status"),
 		"task_id": taskID,
 	}
 	addProgressFields(resp, resultMap)
-	writeJSON(w, http.StatusOK, resp)
+	return resp
+}
+
+func (st *appState) handleTasksSubroutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/tasks/"), "/")
+	taskID, action, _ := strings.Cut(path, "/")
+	switch {
+	case taskID == "":
+		http.NotFound(w, r)
+	case action == "" && r.Method == http.MethodDelete:
+		st.handleTaskCancel(w, r, taskID)
+	case action == "result" && r.Method == http.MethodGet:
+		st.handleTaskResult(w, r, taskID)
+	case action == "" || action == "result":
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleTaskResult returns the typed final result of a finished task.
+func (st *appState) handleTaskResult(w http.ResponseWriter, r *http.Request, taskID string) {
+	rec, ok := getTaskResult(r.Context(), st.redis, taskID)
+	if !ok {
+		state := "UNKNOWN"
+		if status, found := getTaskState(r.Context(), st.redis, taskID); found {
+			state = status.Status
+		}
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "result not available", "task_id": taskID, "state": state})
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
 }
 
 func (st *appState) handleTaskStatus(w http.ResponseWriter, r *http.Request) {
@@ -399,11 +713,11 @@ func (st *appState) handleTaskStatus(w http.ResponseWriter, r *http.Request) {
 	}
 	rec, ok := getTaskState(r.Context(), st.redis, taskID)
 	if !ok {
-		writeJSON(w, http.StatusOK, map[string]any{"task_id": taskID, "state": "PENDING", "message": "Queued or running"})
+		writeJSON(w, http.StatusOK, map[string]any{"task_id": taskID, "state": "PENDING", "message": localize(r.Context(), msgTaskQueuedOrRunning)})
 		return
 	}
-	resultMap, _ := rec.Result.(map[string]any)
-	message := pickFirstNonEmpty(resultMap, "Running", "message", "status")
+	resultMap := localizeResult(r.Context(), rec.Result)
+	message := pickFirstNonEmpty(resultMap, localize(r.Context(), msgTaskRunning), "message", "status")
 	writeJSON(w, http.StatusOK, map[string]any{
 		"task_id": taskID,
 		"state":   rec.Status,
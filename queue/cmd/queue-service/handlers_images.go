@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"math/rand"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -24,14 +29,249 @@ func (st *appState) handleImages(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (st *appState) handleImagesBulkDelete(w http.ResponseWriter, r *http.Request) {
+// imageListItem is one image of GET /api/images and of a user's tweets.
+type imageListItem struct {
+	Path         string     `json:"path"`
+	MediaType    string     `json:"media_type"`
+	Tags         []imageTag `json:"tags"`
+	VariantGroup string     `json:"variant_group,omitempty"`
+	VariantCount int        `json:"variant_count,omitempty"`
+	Hash         string     `json:"hash,omitempty"`
+	// CropSuggestion is the border trim found by border detection, if any.
+	CropSuggestion *cropSuggestion `json:"crop_suggestion,omitempty"`
+	DominantColors []dominantColor `json:"dominant_colors,omitempty"`
+	Favorite       bool            `json:"favorite,omitempty"`
+	Rating         int             `json:"rating,omitempty"`
+}
+
+// imageListDetails holds what list items show besides tags, loaded for a page at once.
+type imageListDetails struct {
+	records  map[string]imageRecord
+	crops    map[string]cropSuggestion
+	palettes map[string][]dominantColor
+	ratings  map[string]imageRating
+}
+
+func (st *appState) loadImageListDetails(paths []string) (imageListDetails, error) {
+	var d imageListDetails
+	var err error
+	if d.records, err = st.store.GetImageRecords(paths); err != nil {
+		return d, err
+	}
+	if d.crops, err = st.store.GetCropSuggestions(paths); err != nil {
+		return d, err
+	}
+	if d.palettes, err = st.store.GetDominantColors(paths); err != nil {
+		return d, err
+	}
+	d.ratings, err = st.store.GetImageRatings(paths)
+	return d, err
+}
+
+func newImageListItem(path string, tags []imageTag, groups map[string]variantSummary, details imageListDetails) imageListItem {
+	item := imageListItem{Path: path, MediaType: mediaTypeFromPath(path), Tags: tags}
+	if g, ok := groups[path]; ok {
+		item.VariantGroup = g.GroupID
+		item.VariantCount = g.Count
+	}
+	if rec, ok := details.records[path]; ok {
+		item.Hash = rec.ContentHash
+	}
+	if c, ok := details.crops[path]; ok {
+		item.CropSuggestion = &c
+	}
+	item.DominantColors = details.palettes[path]
+	if r, ok := details.ratings[path]; ok {
+		item.Favorite, item.Rating = r.Favorite, r.Rating
+	}
+	return item
+}
+
+type imageRatingRequest struct {
+	Filepath string `json:"filepath"`
+	Favorite *bool  `json:"favorite"`
+	// Rating is 1-5 stars; 0 clears it.
+	Rating *int `json:"rating"`
+}
+
+// handleImageRating sets the favorite flag and/or star rating of one image.
+func (st *appState) handleImageRating(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body imageRatingRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepath is required") {
+		return
+	}
+	rel := normalizeFilepath(body.Filepath)
+	if rel == "" {
+		badRequest(w, "filepath is required")
+		return
+	}
+	if body.Favorite == nil && body.Rating == nil {
+		badRequest(w, "favorite or rating is required")
+		return
+	}
+	if body.Rating != nil && (*body.Rating < 0 || *body.Rating > maxImageRating) {
+		badRequest(w, fmt.Sprintf("rating must be between 0 and %d", maxImageRating))
+		return
+	}
+	fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+	if err != nil {
+		badRequest(w, fmt.Sprintf("invalid filepath: %s", rel))
+		return
+	}
+	if info, err := os.Stat(fullPath); err != nil || info.IsDir() {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "Image not found", "filepath": rel})
+		return
+	}
+	saved, err := st.store.SetImageRating(rel, body.Favorite, body.Rating)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "item": saved})
+}
+
+type imageRenameRequest struct {
+	Filepath    string `json:"filepath"`
+	NewFilepath string `json:"new_filepath"`
+}
+
+// handleImageRename moves one file within MEDIA_ROOT, e.g. to another user's directory,
+// and carries its tags, ratings and other rows along. The extension must stay the same,
+// and an existing file is never replaced.
+func (st *appState) handleImageRename(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	var body struct {
-		Filepaths []string `json:"filepaths"`
+	var body imageRenameRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepath and new_filepath are required") {
+		return
+	}
+	rel, newRel := normalizeFilepath(body.Filepath), normalizeFilepath(body.NewFilepath)
+	if rel == "" || newRel == "" {
+		badRequest(w, "filepath and new_filepath are required")
+		return
+	}
+	if rel == newRel {
+		badRequest(w, "new_filepath is the same as filepath")
+		return
+	}
+	if !strings.EqualFold(path.Ext(rel), path.Ext(newRel)) {
+		badRequest(w, "new_filepath must keep the file extension")
+		return
+	}
+	// Files live under a user directory, which the index takes the owner from.
+	if !strings.Contains(newRel, "/") {
+		badRequest(w, "new_filepath must be inside a user directory")
+		return
+	}
+	fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+	if err != nil {
+		badRequest(w, fmt.Sprintf("invalid filepath: %s", rel))
+		return
+	}
+	newFull, err := resolvePathUnderRoot(st.cfg.mediaRoot, newRel)
+	if err != nil {
+		badRequest(w, fmt.Sprintf("invalid new_filepath: %s", newRel))
+		return
+	}
+	if info, err := os.Stat(fullPath); err != nil || !info.Mode().IsRegular() {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "Image not found", "filepath": rel})
+		return
+	}
+	if err := st.moveImage(fullPath, newFull, rel, newRel); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			writeJSON(w, http.StatusConflict, map[string]any{"error": "new_filepath already exists", "new_filepath": newRel})
+			return
+		}
+		internalServerError(w)
+		return
+	}
+	logger.Info("image renamed", "filepath", rel, "new_filepath", newRel)
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "filepath": newRel, "old_filepath": rel})
+}
+
+// moveImage moves the file at fullPath (rel) to newFull (newRel) along with its rows.
+// When the rows cannot be moved the file is put back.
+func (st *appState) moveImage(fullPath, newFull, rel, newRel string) error {
+	if err := os.MkdirAll(filepath.Dir(newFull), 0o755); err != nil {
+		return err
+	}
+	if err := renameNoReplace(fullPath, newFull); err != nil {
+		if !errors.Is(err, os.ErrExist) {
+			logger.Error("failed to rename image", "filepath", rel, "new_filepath", newRel, "error", err)
+		}
+		return err
+	}
+	if err := st.store.RenameImagePath(rel, newRel); err != nil {
+		logger.Error("failed to move image rows", "filepath", rel, "new_filepath", newRel, "error", err)
+		if rerr := renameNoReplace(newFull, fullPath); rerr != nil {
+			logger.Error("failed to restore renamed image", "filepath", rel, "new_filepath", newRel, "error", rerr)
+		}
+		return err
+	}
+	_ = cleanupEmptyParents(fullPath, st.cfg.mediaRoot)
+	st.mirrorRenamed(rel, newRel)
+	return nil
+}
+
+// renameNoReplace moves src to dst in one step, failing with os.ErrExist instead of
+// replacing dst. A hard link claims dst atomically; filesystems without links fall back
+// to a checked rename.
+func renameNoReplace(src, dst string) error {
+	err := os.Link(src, dst)
+	if err == nil {
+		return os.Remove(src)
+	}
+	if errors.Is(err, os.ErrExist) {
+		return err
+	}
+	if _, serr := os.Lstat(dst); serr == nil {
+		return os.ErrExist
+	}
+	return os.Rename(src, dst)
+}
+
+// sortImagesByRating orders images by stars, favorites first among equal stars, then
+// newest first.
+func (st *appState) sortImagesByRating(ctx context.Context, images []imageInfo) error {
+	paths := make([]string, 0, len(images))
+	for _, img := range images {
+		paths = append(paths, img.Path)
+	}
+	start := time.Now()
+	ratings, err := st.store.GetImageRatings(paths)
+	timingFrom(ctx).since("sqlite", start)
+	if err != nil {
+		return err
 	}
+	sort.SliceStable(images, func(i, j int) bool {
+		a, b := ratings[images[i].Path], ratings[images[j].Path]
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+		if a.Favorite != b.Favorite {
+			return a.Favorite
+		}
+		return images[i].MTime > images[j].MTime
+	})
+	return nil
+}
+
+type filepathsRequest struct {
+	Filepaths []string `json:"filepaths"`
+}
+
+func (st *appState) handleImagesBulkDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body filepathsRequest
 	if !decodeJSONOrBadRequest(w, r, &body, "filepaths is required") {
 		return
 	}
@@ -54,17 +294,16 @@ func (st *appState) handleImagesBulkDelete(w http.ResponseWriter, r *http.Reques
 		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
 		return
 	}
-	setTaskState(r.Context(), st.redis, taskID, "PENDING", map[string]any{
-		"message": fmt.Sprintf("Bulk delete task queued (%d images)", len(filepaths)),
-		"total":   len(filepaths),
-	})
+	setTaskState(r.Context(), st.redis, taskID, "PENDING", withMessage(map[string]any{
+		"total": len(filepaths),
+	}, "message", msgDeleteImagesQueuedCount, len(filepaths)))
 	logger.Info("bulk delete image task queued", "task_id", taskID, "count", len(filepaths))
 	writeJSON(w, http.StatusAccepted, map[string]any{
 		"success":      true,
 		"queued":       true,
 		"task_id":      taskID,
 		"queued_count": len(filepaths),
-		"message":      "Bulk delete image task queued",
+		"message":      localize(r.Context(), msgDeleteImagesQueued),
 	})
 }
 
@@ -77,118 +316,186 @@ func (st *appState) handleImagesGet(w http.ResponseWriter, r *http.Request) {
 	perPage := parsePositiveInt(r.URL.Query().Get("per_page"), 100)
 	offset := (page - 1) * perPage
 	returnAll := strings.TrimSpace(r.URL.Query().Get("all")) == "1"
-	searchTags := splitCSV(r.URL.Query().Get("tags"))
-	minTagCount := parseNonNegativeInt(r.URL.Query().Get("min_tag_count"), -1)
-	maxTagCount := parseNonNegativeInt(r.URL.Query().Get("max_tag_count"), -1)
-	excludeTags := splitCSV(r.URL.Query().Get("exclude_tags"))
-
-	type imageInfo struct {
-		Path  string
-		MTime int64
+	filter, err := parseImageFilter(r.URL.Query())
+	if err != nil {
+		badRequest(w, err.Error())
+		return
 	}
-	allImages := make([]imageInfo, 0)
-
-	if len(searchTags) > 0 {
-		paths, err := st.store.FindFilesByTagPatterns(searchTags)
-		if err != nil {
-			internalServerError(w)
+	collapse := parseBoolParam(r.URL.Query().Get("collapse_variants"))
+	cursor, err := parseCursorRequest(r.URL.Query(), 2)
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	var after *imageInfo
+	if cursor != nil {
+		if sortMode != "latest" || collapse {
+			badRequest(w, "cursor pagination supports sort=latest without collapse_variants")
 			return
 		}
-		for _, p := range paths {
-			full := filepath.Join(st.cfg.mediaRoot, filepath.FromSlash(p))
-			info, err := os.Stat(full)
+		if cursor.After != nil {
+			a, err := decodeImageCursor(cursor.After)
 			if err != nil {
-				continue
+				badRequest(w, err.Error())
+				return
 			}
-			allImages = append(allImages, imageInfo{Path: p, MTime: info.ModTime().UnixMilli()})
+			after = &a
 		}
-	} else {
-		files, err := listImageFiles(st.cfg.mediaRoot)
+	}
+
+	// A cursor page is read from the image index by keyset instead of scanning and sorting.
+	if cursor != nil {
+		pageImages, pageTags, err := st.latestImagesPage(r.Context(), filter, after, cursor.Limit+1)
 		if err != nil {
-			internalServerError(w)
+			writeScanError(w, err)
 			return
 		}
-		for _, full := range files {
-			info, err := os.Stat(full)
-			if err != nil {
-				continue
-			}
-			allImages = append(allImages, imageInfo{Path: normalizeRelPath(st.cfg.mediaRoot, full), MTime: info.ModTime().UnixMilli()})
-		}
-	}
-
-	allTagsMap := map[string][]imageTag{}
-	if minTagCount >= 0 || maxTagCount >= 0 || len(excludeTags) > 0 {
-		paths := make([]string, 0, len(allImages))
-		for _, img := range allImages {
-			paths = append(paths, img.Path)
+		nextCursor := ""
+		if len(pageImages) > cursor.Limit {
+			pageImages = pageImages[:cursor.Limit]
+			nextCursor = imageCursor(pageImages[len(pageImages)-1])
 		}
-		tagsMap, err := st.store.GetTagsForFiles(paths)
+		items, err := st.imageListItems(r, pageImages, pageTags, !filter.needsTags(), nil)
 		if err != nil {
 			internalServerError(w)
 			return
 		}
-		allTagsMap = tagsMap
+		writeCursorResponse(w, items, nextCursor)
+		return
+	}
 
-		filtered := make([]imageInfo, 0, len(allImages))
-		for _, img := range allImages {
-			tagsForImage := tagsMap[img.Path]
-			if hasTagPattern(tagsForImage, excludeTags) {
-				continue
-			}
-			tagCount := len(tagsForImage)
-			if minTagCount >= 0 && tagCount < minTagCount {
-				continue
-			}
-			if maxTagCount >= 0 && tagCount > maxTagCount {
-				continue
-			}
-			filtered = append(filtered, img)
-		}
-		allImages = filtered
+	allImages, allTagsMap, err := st.findImages(r.Context(), filter)
+	if err != nil {
+		writeScanError(w, err)
+		return
 	}
 
-	totalItems := len(allImages)
 	switch sortMode {
 	case "random":
-		rand.Shuffle(len(allImages), func(i, j int) { allImages[i], allImages[j] = allImages[j], allImages[i] })
+		if seed := r.URL.Query().Get("seed"); seed != "" {
+			seededShuffle(allImages, seed)
+		} else {
+			rand.Shuffle(len(allImages), func(i, j int) { allImages[i], allImages[j] = allImages[j], allImages[i] })
+		}
+	case "popular":
+		if err := st.sortImagesByPopularity(r.Context(), allImages); err != nil {
+			internalServerError(w)
+			return
+		}
+	case "rating":
+		if err := st.sortImagesByRating(r.Context(), allImages); err != nil {
+			internalServerError(w)
+			return
+		}
 	default:
-		sort.Slice(allImages, func(i, j int) bool { return allImages[i].MTime > allImages[j].MTime })
+		sort.Slice(allImages, func(i, j int) bool { return latestBefore(allImages[i], allImages[j]) })
 	}
 
+	var variantGroups map[string]variantSummary
+	if collapse {
+		allImages, variantGroups, err = st.collapseImageVariants(r, allImages)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+	}
+	totalItems := len(allImages)
+
 	pageImages := allImages
 	if !returnAll {
 		start, end := pageBounds(offset, perPage, totalItems)
 		pageImages = allImages[start:end]
 	}
+	items, err := st.imageListItems(r, pageImages, allTagsMap, !filter.needsTags(), variantGroups)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	writePaginatedResponse(w, items, totalItems, perPage, page, returnAll, 0)
+}
+
+// imageListItems renders one page of images. tagsMap holds the tags when the filter
+// already loaded them; with loadTags they are read for the page only.
+func (st *appState) imageListItems(r *http.Request, pageImages []imageInfo, tagsMap map[string][]imageTag, loadTags bool, variantGroups map[string]variantSummary) ([]imageListItem, error) {
 	paths := make([]string, 0, len(pageImages))
 	for _, img := range pageImages {
 		paths = append(paths, img.Path)
 	}
-	tagsMap := allTagsMap
-	if minTagCount < 0 && maxTagCount < 0 && len(excludeTags) == 0 {
+	timing := timingFrom(r.Context())
+	if loadTags {
+		start := time.Now()
 		var err error
 		tagsMap, err = st.store.GetTagsForFiles(paths)
+		timing.since("sqlite", start)
 		if err != nil {
-			internalServerError(w)
-			return
+			return nil, err
 		}
 	}
 
-	items := make([]any, 0, len(pageImages))
+	start := time.Now()
+	details, err := st.loadImageListDetails(paths)
+	timing.since("sqlite", start)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]imageListItem, 0, len(pageImages))
 	for _, img := range pageImages {
-		items = append(items, map[string]any{
-			"path": img.Path,
-			"tags": tagsMap[img.Path],
-		})
+		items = append(items, newImageListItem(img.Path, tagsMap[img.Path], variantGroups, details))
 	}
-	writePaginatedResponse(w, items, totalItems, perPage, page, returnAll, 0)
+	return items, nil
 }
 
-func (st *appState) handleImagesDelete(w http.ResponseWriter, r *http.Request) {
-	var body struct {
-		Filepath string `json:"filepath"`
+// seededShuffle orders images by a hash of seed and path, so every page requested with the
+// same seed cuts the same order. Images added or removed in between do not move the others.
+func seededShuffle(images []imageInfo, seed string) {
+	key := func(p string) uint64 {
+		h := fnv.New64a()
+		h.Write([]byte(seed))
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+		return h.Sum64()
 	}
+	keys := make(map[string]uint64, len(images))
+	for _, img := range images {
+		keys[img.Path] = key(img.Path)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		a, b := keys[images[i].Path], keys[images[j].Path]
+		if a != b {
+			return a < b
+		}
+		return images[i].Path < images[j].Path
+	})
+}
+
+// collapseImageVariants applies collapseVariants to a sorted image list.
+func (st *appState) collapseImageVariants(r *http.Request, images []imageInfo) ([]imageInfo, map[string]variantSummary, error) {
+	paths := make([]string, 0, len(images))
+	byPath := make(map[string]imageInfo, len(images))
+	for _, img := range images {
+		paths = append(paths, img.Path)
+		byPath[img.Path] = img
+	}
+	start := time.Now()
+	kept, groups, err := st.collapseVariants(paths)
+	timingFrom(r.Context()).since("sqlite", start)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make([]imageInfo, 0, len(kept))
+	for _, p := range kept {
+		out = append(out, byPath[p])
+	}
+	return out, groups, nil
+}
+
+type filepathRequest struct {
+	Filepath string `json:"filepath"`
+}
+
+func (st *appState) handleImagesDelete(w http.ResponseWriter, r *http.Request) {
+	var body filepathRequest
 	if !decodeJSONOrBadRequest(w, r, &body, "filepath is required") {
 		return
 	}
@@ -210,13 +517,13 @@ func (st *appState) handleImagesDelete(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
 		return
 	}
-	setTaskState(r.Context(), st.redis, taskID, "PENDING", map[string]any{"message": "Delete image task queued"})
+	setTaskState(r.Context(), st.redis, taskID, "PENDING", taskMessage(msgDeleteImageQueued))
 	logger.Info("delete image task queued", "task_id", taskID, "filepath", rel)
 	writeJSON(w, http.StatusAccepted, map[string]any{
 		"success": true,
 		"queued":  true,
 		"task_id": taskID,
-		"message": "Delete image task queued",
+		"message": localize(r.Context(), msgDeleteImageQueued),
 	})
 }
 
@@ -225,9 +532,7 @@ func (st *appState) handleImagesRetag(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	var body struct {
-		Filepath string `json:"filepath"`
-	}
+	var body filepathRequest
 	if !decodeJSONOrBadRequest(w, r, &body, "filepath is required") {
 		return
 	}
@@ -249,46 +554,212 @@ func (st *appState) handleImagesRetag(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
 		return
 	}
-	setTaskState(r.Context(), st.redis, taskID, "PENDING", map[string]any{"message": "Retag task queued"})
+	setTaskState(r.Context(), st.redis, taskID, "PENDING", taskMessage(msgRetagImageQueued))
 	logger.Info("retag image task queued", "task_id", taskID, "filepath", rel)
 	writeJSON(w, http.StatusAccepted, map[string]any{
 		"success": true,
 		"queued":  true,
 		"task_id": taskID,
-		"message": "Retag task queued",
+		"message": localize(r.Context(), msgRetagImageQueued),
 	})
 }
 
-func (st *appState) handleImagesRetagBulk(w http.ResponseWriter, r *http.Request) {
+type copyTagsRequest struct {
+	Source  string   `json:"source"`
+	Target  string   `json:"target"`
+	Targets []string `json:"targets"`
+	Mode    string   `json:"mode"`
+}
+
+// handleImagesCopyTags copies tags from one image to others, e.g. from a tagged original
+// to its upscaled variant. mode is "merge" (default) or "replace".
+func (st *appState) handleImagesCopyTags(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	var body struct {
-		Filepaths []string `json:"filepaths"`
+	var body copyTagsRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "source and targets are required") {
+		return
 	}
-	if !decodeJSONOrBadRequest(w, r, &body, "filepaths is required") {
+	source := normalizeFilepath(body.Source)
+	if body.Target != "" {
+		body.Targets = append(body.Targets, body.Target)
+	}
+	targets := make([]string, 0, len(body.Targets))
+	for _, target := range normalizeUniqueFilepaths(body.Targets) {
+		if target != source {
+			targets = append(targets, target)
+		}
+	}
+	if source == "" || len(targets) == 0 {
+		badRequest(w, "source and targets are required")
 		return
 	}
+	mode := strings.ToLower(strings.TrimSpace(body.Mode))
+	if mode == "" {
+		mode = "merge"
+	}
+	if mode != "merge" && mode != "replace" {
+		badRequest(w, "mode must be merge or replace")
+		return
+	}
+	for _, rel := range append([]string{source}, targets...) {
+		fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+		if err != nil {
+			badRequest(w, fmt.Sprintf("invalid filepath: %s", rel))
+			return
+		}
+		if _, err := os.Stat(fullPath); err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "Image not found", "filepath": rel})
+			return
+		}
+	}
 
-	ctx := r.Context()
-	if st.isTrackedTaskBusy(ctx, retagLastTask) {
-		writeJSON(w, http.StatusConflict, map[string]any{
-			"success": false,
-			"message": "Another bulk retag task is already running.",
-		})
+	copied, err := st.store.CopyTags(source, targets, mode == "merge")
+	if err != nil {
+		logger.Error("failed to copy tags", "source", source, "targets", len(targets), "error", err)
+		internalServerError(w)
+		return
+	}
+	if copied == 0 {
+		badRequest(w, "source has no tags")
 		return
 	}
+	logger.Info("tags copied", "source", source, "targets", len(targets), "mode", mode, "tags", copied)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":     true,
+		"source":      source,
+		"targets":     targets,
+		"mode":        mode,
+		"copied_tags": copied,
+	})
+}
 
-	filepaths := normalizeUniqueFilepaths(body.Filepaths)
+type imageTagsRequest struct {
+	Filepath string   `json:"filepath"`
+	Tags     []string `json:"tags"`
+}
+
+// handleImageTags corrects the tags of one image by hand: POST adds tags as manual tags,
+// DELETE removes tags whether the autotagger or a person set them.
+func (st *appState) handleImageTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body imageTagsRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepath and tags are required") {
+		return
+	}
+	rel := normalizeFilepath(body.Filepath)
+	tags := trimNonEmpty(body.Tags)
+	if rel == "" || len(tags) == 0 {
+		badRequest(w, "filepath and tags are required")
+		return
+	}
+	fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+	if err != nil {
+		badRequest(w, "invalid filepath")
+		return
+	}
+	if _, err := os.Stat(fullPath); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "Image not found"})
+		return
+	}
+
+	resp := map[string]any{"success": true, "filepath": rel}
+	if r.Method == http.MethodPost {
+		added, err := st.store.AddManualTags(rel, tags)
+		if err != nil {
+			logger.Error("failed to add tags", "filepath", rel, "error", err)
+			internalServerError(w)
+			return
+		}
+		if len(added) == 0 {
+			badRequest(w, "no valid tags")
+			return
+		}
+		logger.Info("tags added", "filepath", rel, "tags", added)
+		resp["added"] = added
+	} else {
+		removed, err := st.store.RemoveTags(rel, tags)
+		if err != nil {
+			logger.Error("failed to remove tags", "filepath", rel, "error", err)
+			internalServerError(w)
+			return
+		}
+		logger.Info("tags removed", "filepath", rel, "count", removed)
+		resp["removed_count"] = removed
+	}
+	tagsMap, err := st.store.GetTagsForFiles([]string{rel})
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	resp["tags"] = tagsMap[rel]
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type retagBulkRequest struct {
+	Filepaths []string `json:"filepaths"`
+	imageFilterRequest
+	UntaggedOnly bool `json:"untagged_only"`
+}
+
+func (st *appState) handleImagesRetagBulk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// Either explicit filepaths or an /api/images style query resolved server-side.
+	var body retagBulkRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepaths or query is required") {
+		return
+	}
+
+	ctx := r.Context()
+	var filepaths []string
+	if len(body.Filepaths) > 0 {
+		filepaths = normalizeUniqueFilepaths(body.Filepaths)
+		if len(filepaths) == 0 {
+			badRequest(w, "filepaths is required")
+			return
+		}
+	} else {
+		filter, err := body.imageFilterRequest.toFilter()
+		if err != nil {
+			badRequest(w, err.Error())
+			return
+		}
+		if body.UntaggedOnly {
+			filter.MaxTagCount = 0
+		}
+		if filter.isEmpty() {
+			badRequest(w, "filepaths or query is required")
+			return
+		}
+		filepaths, err = st.selectImagePaths(ctx, filter)
+		if err != nil {
+			writeScanError(w, err)
+			return
+		}
+	}
 	if len(filepaths) == 0 {
-		badRequest(w, "filepaths is required")
+		badRequest(w, "no images matched")
 		return
 	}
 
 	taskID := uuid.NewString()
 	payload := retagImagesTaskPayload{TaskID: taskID, Filepaths: filepaths}
-	err := st.enqueueTask(taskTypeRetagImages, st.cfg.interactiveQueue, taskID, payload, 30*time.Minute)
+	waiting, err := st.submitFamilyTask(ctx, familyRetag, taskTypeRetagImages, st.cfg.interactiveQueue, taskID, payload, 30*time.Minute)
+	if errors.Is(err, errTaskFamilyBusy) {
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"success": false,
+			"message": localize(ctx, familyRetag.BusyCode),
+		})
+		return
+	}
 	if err != nil {
 		logger.Error("failed to enqueue bulk retag task",
 			"task_type", taskTypeRetagImages,
@@ -300,17 +771,174 @@ func (st *appState) handleImagesRetagBulk(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	st.redis.Set(ctx, retagLastTask, taskID, 7*24*time.Hour)
-	setTaskState(ctx, st.redis, taskID, "PENDING", map[string]any{
-		"message": "Bulk retag task queued",
-		"total":   len(filepaths),
-	})
-	logger.Info("bulk retag task queued", "task_id", taskID, "count", len(filepaths))
+	setTaskState(ctx, st.redis, taskID, "PENDING", withMessage(map[string]any{
+		"total": len(filepaths),
+	}, "message", msgRetagImagesQueued))
+	logger.Info("bulk retag task queued", "task_id", taskID, "count", len(filepaths), "waiting", waiting)
 	writeJSON(w, http.StatusAccepted, map[string]any{
 		"success":      true,
 		"queued":       true,
+		"waiting":      waiting,
 		"task_id":      taskID,
 		"queued_count": len(filepaths),
-		"message":      "Bulk retag task queued",
+		"message":      localize(ctx, msgRetagImagesQueued),
+	})
+}
+
+type deleteByQueryRequest struct {
+	imageFilterRequest
+	DryRun       *bool  `json:"dry_run"`
+	ConfirmToken string `json:"confirm_token"`
+}
+
+func (st *appState) handleImagesDeleteByQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body deleteByQueryRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "invalid request body") {
+		return
+	}
+	filter, err := body.imageFilterRequest.toFilter()
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	if filter.isEmpty() {
+		badRequest(w, "at least one filter is required")
+		return
+	}
+
+	ctx := r.Context()
+	dryRun := body.DryRun == nil || *body.DryRun
+	if dryRun {
+		images, _, err := st.findImages(ctx, filter)
+		if err != nil {
+			writeScanError(w, err)
+			return
+		}
+		filepaths := make([]string, 0, len(images))
+		for _, img := range images {
+			filepaths = append(filepaths, img.Path)
+		}
+		resp := map[string]any{
+			"success":       true,
+			"dry_run":       true,
+			"matched_count": len(filepaths),
+			"sample":        filepaths[:min(len(filepaths), deleteQuerySampleSize)],
+		}
+		if len(filepaths) > 0 {
+			token := uuid.NewString()
+			b, _ := json.Marshal(deleteQueryConfirmation{Signature: filter.signature(), Filepaths: filepaths})
+			if err := st.redis.Set(ctx, deleteQueryTokenPrefix+token, b, deleteQueryTokenTTL).Err(); err != nil {
+				internalServerError(w)
+				return
+			}
+			resp["confirm_token"] = token
+			resp["expires_in"] = int(deleteQueryTokenTTL.Seconds())
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	token := strings.TrimSpace(body.ConfirmToken)
+	if token == "" {
+		badRequest(w, "confirm_token from a dry run is required")
+		return
+	}
+	// GETDEL consumes the token atomically so concurrent confirms cannot both enqueue.
+	raw, err := st.redis.GetDel(ctx, deleteQueryTokenPrefix+token).Result()
+	if err != nil || raw == "" {
+		badRequest(w, "confirm_token is invalid or expired; run a dry run first")
+		return
+	}
+	var confirmation deleteQueryConfirmation
+	if err := json.Unmarshal([]byte(raw), &confirmation); err != nil {
+		internalServerError(w)
+		return
+	}
+	if confirmation.Signature != filter.signature() {
+		badRequest(w, "filters do not match the dry run for this confirm_token; run a new dry run")
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := deleteImagesTaskPayload{TaskID: taskID, Filepaths: confirmation.Filepaths}
+	err = st.enqueueTask(taskTypeDeleteImages, st.cfg.interactiveQueue, taskID, payload, 30*time.Minute)
+	if err != nil {
+		logger.Error("failed to enqueue delete by query task",
+			"task_type", taskTypeDeleteImages,
+			"task_id", taskID,
+			"count", len(confirmation.Filepaths),
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(ctx, st.redis, taskID, "PENDING", withMessage(map[string]any{
+		"total": len(confirmation.Filepaths),
+	}, "message", msgDeleteByQueryQueuedCount, len(confirmation.Filepaths)))
+	logger.Info("delete by query task queued", "task_id", taskID, "count", len(confirmation.Filepaths))
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success":      true,
+		"queued":       true,
+		"task_id":      taskID,
+		"queued_count": len(confirmation.Filepaths),
+		"message":      localize(ctx, msgDeleteByQueryQueued),
+	})
+}
+
+// handleImageHash returns the content hash of a stored file, which the media route uses as
+// its ETag. A file missing from the index, or whose size no longer matches it, is hashed
+// on demand and re-indexed.
+func (st *appState) handleImageHash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	rel := strings.TrimPrefix(path.Clean("/"+normalizeFilepath(r.URL.Query().Get("filepath"))), "/")
+	if rel == "" || !isImageFile(rel) {
+		badRequest(w, "filepath is required")
+		return
+	}
+	fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+	if err != nil {
+		badRequest(w, fmt.Sprintf("invalid filepath: %s", rel))
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "Image not found", "filepath": rel})
+		return
+	}
+
+	records, err := st.store.GetImageRecords([]string{rel})
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	rec, ok := records[rel]
+	if !ok || rec.ContentHash == "" || rec.Size != info.Size() {
+		hash, err := fileMD5(fullPath)
+		if err != nil {
+			logger.Error("failed to hash image", "filepath", rel, "error", err)
+			internalServerError(w)
+			return
+		}
+		rec = newImageRecord(rel, hash, info.Size(), info.ModTime().UnixMilli())
+		if err := st.store.RecordImage(rec); err != nil {
+			logger.Warn("failed to index hashed image", "filepath", rel, "error", err)
+		}
+	}
+	// The frontend media route looks the hash up for every file it serves and marks
+	// those lookups, so they double as serve counts.
+	if parseBoolParam(r.URL.Query().Get("serve")) {
+		st.access.record(rel, false)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"filepath": rel,
+		"hash":     rec.ContentHash,
+		"size":     rec.Size,
 	})
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	maxImportFileBytes = 5 << 20
+	maxImportURLs      = 5000
+	importChunkSize    = 100
+)
+
+// importCandidate is one tweet found in an uploaded list.
+type importCandidate struct {
+	URL     string
+	TweetID string
+}
+
+// parseImportURLs extracts tweet URLs from a .txt or .csv upload. Any cell or line that
+// contains a status URL is accepted, and URLs are canonicalized to x.com.
+func parseImportURLs(r io.Reader) ([]importCandidate, error) {
+	seen := make(map[string]struct{})
+	candidates := make([]importCandidate, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		for _, m := range tweetURLRe.FindAllStringSubmatch(scanner.Text(), -1) {
+			if _, ok := seen[m[2]]; ok {
+				continue
+			}
+			seen[m[2]] = struct{}{}
+			candidates = append(candidates, importCandidate{
+				URL:     fmt.Sprintf("https://x.com/%s/status/%s", m[1], m[2]),
+				TweetID: m[2],
+			})
+		}
+	}
+	return candidates, scanner.Err()
+}
+
+// queuedTweetIDs returns tweet IDs of download tasks that are still queued or running.
+func (st *appState) queuedTweetIDs(ctx context.Context) map[string]struct{} {
+	ids := make(map[string]struct{})
+	for u := range st.pendingDownloadURLs(ctx) {
+		if m := tweetURLRe.FindStringSubmatch(u); m != nil {
+			ids[m[2]] = struct{}{}
+		}
+	}
+	return ids
+}
+
+// isTweetDownloaded reports whether media of the tweet already exists under the user directory.
+func (st *appState) isTweetDownloaded(username, tweetID string) bool {
+	userDir, err := resolvePathUnderRoot(st.cfg.mediaRoot, username)
+	if err != nil {
+		return false
+	}
+	if info, err := os.Stat(filepath.Join(userDir, tweetID)); err == nil && info.IsDir() {
+		return true
+	}
+	matches, _ := filepath.Glob(filepath.Join(userDir, tweetID+"_*"))
+	for _, m := range matches {
+		if isImageFile(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *appState) handleDownloadImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportFileBytes)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		badRequest(w, "file is required")
+		return
+	}
+	defer file.Close()
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if ext != ".txt" && ext != ".csv" {
+		badRequest(w, "file must be .txt or .csv")
+		return
+	}
+
+	candidates, err := parseImportURLs(file)
+	if err != nil {
+		badRequest(w, "failed to read file")
+		return
+	}
+	if len(candidates) == 0 {
+		badRequest(w, "no tweet URLs found")
+		return
+	}
+	if len(candidates) > maxImportURLs {
+		badRequest(w, fmt.Sprintf("too many URLs (max %d)", maxImportURLs))
+		return
+	}
+
+	ctx := r.Context()
+	queuedIDs := st.queuedTweetIDs(ctx)
+	pending := make([]importCandidate, 0, len(candidates))
+	skippedQueued, skippedDownloaded := 0, 0
+	for _, c := range candidates {
+		if _, ok := queuedIDs[c.TweetID]; ok {
+			skippedQueued++
+			continue
+		}
+		if st.isTweetDownloaded(extractUsername(c.URL), c.TweetID) {
+			skippedDownloaded++
+			continue
+		}
+		pending = append(pending, c)
+	}
+
+	queued := make([]map[string]string, 0, len(pending))
+	failed := 0
+	for start := 0; start < len(pending); start += importChunkSize {
+		end := min(start+importChunkSize, len(pending))
+		batch := make([]downloadTaskPayload, 0, end-start)
+		for _, c := range pending[start:end] {
+			batch = append(batch, downloadTaskPayload{URL: c.URL})
+		}
+		submitted := st.submitDownloads(st.cfg.queueName, batch)
+		failed += len(batch) - len(submitted)
+		tracked := make([]trackedTask, 0, len(submitted))
+		for _, p := range submitted {
+			tracked = append(tracked, trackedTask{TaskID: p.TaskID, URL: p.URL})
+			queued = append(queued, map[string]string{"task_id": p.TaskID, "url": p.URL})
+		}
+		st.trackTasks(ctx, tracked)
+		st.redis.LTrim(ctx, taskListKey, -maxTrackedTasks, -1)
+		logger.Info("download import chunk queued", "from", start, "to", end, "total", len(pending))
+	}
+
+	logger.Info("download import processed",
+		"filename", header.Filename,
+		"found", len(candidates),
+		"queued", len(queued),
+		"skipped_queued", skippedQueued,
+		"skipped_downloaded", skippedDownloaded,
+		"failed", failed,
+	)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":            true,
+		"message":            localize(ctx, msgDownloadQueued, len(queued)),
+		"found_count":        len(candidates),
+		"queued_count":       len(queued),
+		"skipped_queued":     skippedQueued,
+		"skipped_downloaded": skippedDownloaded,
+		"failed_count":       failed,
+		"queued_tasks":       queued,
+	})
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
@@ -24,6 +25,14 @@ func (st *appState) handleTags(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// tagCount is one tag of GET /api/tags. Category and Color are empty for general tags.
+type tagCount struct {
+	Tag      string `json:"tag"`
+	Count    int    `json:"count"`
+	Category string `json:"category,omitempty"`
+	Color    string `json:"color,omitempty"`
+}
+
 func (st *appState) handleTagsGet(w http.ResponseWriter, r *http.Request) {
 	page := parsePositiveInt(r.URL.Query().Get("page"), 1)
 	perPage := parsePositiveInt(r.URL.Query().Get("per_page"), 100)
@@ -34,13 +43,45 @@ func (st *appState) handleTagsGet(w http.ResponseWriter, r *http.Request) {
 	minCount := parseNonNegativeInt(r.URL.Query().Get("min_count"), -1)
 	maxCount := parseNonNegativeInt(r.URL.Query().Get("max_count"), -1)
 	sortBy := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("sort")))
+	category := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("category")))
+	excludeTags := parseExcludeTags(r.URL.Query())
+	source, bySource := "", r.URL.Query().Has("source")
+	if bySource {
+		var ok bool
+		if source, ok = tagSourceParam(r.URL.Query().Get("source")); !ok {
+			badRequest(w, "source must be autotagger, manual, heuristic or creator")
+			return
+		}
+	}
 
-	tags, err := st.store.GetAllTags()
+	start := time.Now()
+	var tags []map[string]any
+	var err error
+	if bySource {
+		tags, err = st.store.GetAllTagsBySource(source)
+	} else {
+		tags, err = st.store.GetAllTags()
+	}
+	timingFrom(r.Context()).since("sqlite", start)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	if q != "" {
+		aliases, err := st.store.ListTagAliases()
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		q = strings.ToLower(resolveTagAlias(tagAliasIndex(aliases), q))
+	}
+	categories, err := st.store.ListTagCategories()
 	if err != nil {
 		internalServerError(w)
 		return
 	}
-	filtered := make([]map[string]any, 0, len(tags))
+	categoryIndex := tagCategoryIndex(categories)
+	filtered := make([]tagCount, 0, len(tags))
 	for _, item := range tags {
 		tagVal, _ := item["tag"].(string)
 		countInt := 0
@@ -66,66 +107,319 @@ func (st *appState) handleTagsGet(w http.ResponseWriter, r *http.Request) {
 		if minCount >= 0 && countInt < minCount {
 			continue
 		}
+		if hasTagPattern([]imageTag{{Tag: tagVal}}, excludeTags) {
+			continue
+		}
 		if maxCount >= 0 && countInt > maxCount {
 			continue
 		}
-		filtered = append(filtered, map[string]any{
-			"tag":   tagVal,
-			"count": countInt,
-		})
+		item := tagCount{Tag: tagVal, Count: countInt}
+		if c, ok := categoryOfTag(categoryIndex, tagVal); ok {
+			item.Category, item.Color = c.Name, c.Color
+		}
+		if category != "" && category != item.Category && (category != tagCategoryGeneral || item.Category != "") {
+			continue
+		}
+		filtered = append(filtered, item)
 	}
-	tags = filtered
 
 	switch sortBy {
 	case "name_desc":
-		sort.Slice(tags, func(i, j int) bool {
-			a, _ := tags[i]["tag"].(string)
-			b, _ := tags[j]["tag"].(string)
-			return strings.ToLower(a) > strings.ToLower(b)
+		sort.Slice(filtered, func(i, j int) bool {
+			return strings.ToLower(filtered[i].Tag) > strings.ToLower(filtered[j].Tag)
 		})
 	case "count_asc":
-		sort.Slice(tags, func(i, j int) bool {
-			a, _ := tags[i]["count"].(int)
-			b, _ := tags[j]["count"].(int)
-			if a == b {
-				at, _ := tags[i]["tag"].(string)
-				bt, _ := tags[j]["tag"].(string)
-				return strings.ToLower(at) < strings.ToLower(bt)
+		sort.Slice(filtered, func(i, j int) bool {
+			a, b := filtered[i], filtered[j]
+			if a.Count == b.Count {
+				return strings.ToLower(a.Tag) < strings.ToLower(b.Tag)
 			}
-			return a < b
+			return a.Count < b.Count
 		})
 	case "name_asc":
-		sort.Slice(tags, func(i, j int) bool {
-			a, _ := tags[i]["tag"].(string)
-			b, _ := tags[j]["tag"].(string)
-			return strings.ToLower(a) < strings.ToLower(b)
+		sort.Slice(filtered, func(i, j int) bool {
+			return strings.ToLower(filtered[i].Tag) < strings.ToLower(filtered[j].Tag)
 		})
 	default:
-		sort.Slice(tags, func(i, j int) bool {
-			a, _ := tags[i]["count"].(int)
-			b, _ := tags[j]["count"].(int)
-			if a == b {
-				at, _ := tags[i]["tag"].(string)
-				bt, _ := tags[j]["tag"].(string)
-				return strings.ToLower(at) < strings.ToLower(bt)
+		sort.Slice(filtered, func(i, j int) bool {
+			a, b := filtered[i], filtered[j]
+			if a.Count == b.Count {
+				return strings.ToLower(a.Tag) < strings.ToLower(b.Tag)
 			}
-			return a > b
+			return a.Count > b.Count
 		})
 	}
 
-	totalItems := len(tags)
-	items := any(tags)
+	totalItems := len(filtered)
+	items := filtered
 	if !allItems {
 		start, end := pageBounds(offset, perPage, totalItems)
-		items = tags[start:end]
+		items = filtered[start:end]
 	}
 	writePaginatedResponse(w, items, totalItems, perPage, page, allItems, 1)
 }
 
-func (st *appState) handleTagsDelete(w http.ResponseWriter, r *http.Request) {
-	var body struct {
-		Tag string `json:"tag"`
+func (st *appState) handleTagsSubroutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/api/tags/")
+	if path == "aliases" || strings.HasPrefix(path, "aliases/") {
+		st.handleTagAliases(w, r, strings.TrimPrefix(strings.TrimPrefix(path, "aliases"), "/"))
+		return
+	}
+	if path == "categories" || strings.HasPrefix(path, "categories/") {
+		st.handleTagCategories(w, r, strings.TrimPrefix(strings.TrimPrefix(path, "categories"), "/"))
+		return
+	}
+	if path == "export" {
+		st.handleTagsExport(w, r)
+		return
+	}
+	if name, ok := strings.CutPrefix(path, "sources/"); ok {
+		st.handleTagSourcePurge(w, r, name)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasSuffix(path, "/confidence") {
+		http.NotFound(w, r)
+		return
+	}
+	tag, err := url.PathUnescape(strings.TrimSuffix(path, "/confidence"))
+	if err != nil || strings.TrimSpace(tag) == "" {
+		http.NotFound(w, r)
+		return
+	}
+	st.handleTagConfidenceGet(w, r, tag)
+}
+
+// handleTagSourcePurge deletes every tag of one source, such as all heuristic guesses.
+// Tags set by hand are only removed one by one.
+func (st *appState) handleTagSourcePurge(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	source, ok := tagSourceParam(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if source == tagSourceManual {
+		badRequest(w, "manual tags cannot be purged")
+		return
+	}
+	deleted, err := st.store.DeleteTagsBySource(source)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	logger.Info("tags purged by source", "source", name, "deleted", deleted)
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "source": name, "deleted_count": deleted})
+}
+
+func (st *appState) handleTagConfidenceGet(w http.ResponseWriter, r *http.Request, tag string) {
+	bucketCount := parsePositiveInt(r.URL.Query().Get("buckets"), 10)
+	if bucketCount > 100 {
+		bucketCount = 100
+	}
+
+	confidences, err := st.store.GetTagConfidences(tag)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	if len(confidences) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "Tag not found"})
+		return
+	}
+
+	type bucket struct {
+		From  float64 `json:"from"`
+		To    float64 `json:"to"`
+		Count int     `json:"count"`
+	}
+	buckets := make([]bucket, bucketCount)
+	width := 1.0 / float64(bucketCount)
+	for i := range buckets {
+		buckets[i] = bucket{From: float64(i) * width, To: float64(i+1) * width}
+	}
+	sum := 0.0
+	for _, c := range confidences {
+		idx := int(c / width)
+		if idx >= bucketCount {
+			idx = bucketCount - 1
+		}
+		if idx < 0 {
+			idx = 0
+		}
+		buckets[idx].Count++
+		sum += c
+	}
+	// confidences are sorted ascending by the store.
+	percentile := func(p float64) float64 {
+		return confidences[int(p*float64(len(confidences)-1))]
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"tag":     tag,
+		"count":   len(confidences),
+		"min":     confidences[0],
+		"max":     confidences[len(confidences)-1],
+		"mean":    sum / float64(len(confidences)),
+		"p25":     percentile(0.25),
+		"median":  percentile(0.5),
+		"p75":     percentile(0.75),
+		"buckets": buckets,
+	})
+}
+
+type tagAliasRequest struct {
+	Alias string `json:"alias"`
+	Tag   string `json:"tag"`
+}
+
+// handleTagAliases serves GET/POST /api/tags/aliases and DELETE /api/tags/aliases/{alias}.
+func (st *appState) handleTagAliases(w http.ResponseWriter, r *http.Request, escapedAlias string) {
+	if escapedAlias != "" {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		alias, err := url.PathUnescape(escapedAlias)
+		if err != nil || strings.TrimSpace(alias) == "" || strings.Contains(alias, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		deleted, err := st.store.DeleteTagAlias(alias)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if !deleted {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "alias not found"})
+			return
+		}
+		logger.Info("tag alias deleted", "alias", alias)
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "alias": alias})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		aliases, err := st.store.ListTagAliases()
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": aliases})
+	case http.MethodPost:
+		var body tagAliasRequest
+		if !decodeJSONOrBadRequest(w, r, &body, "alias and tag are required") {
+			return
+		}
+		body.Alias = strings.TrimSpace(body.Alias)
+		body.Tag = strings.TrimSpace(body.Tag)
+		if body.Alias == "" || body.Tag == "" || strings.Contains(body.Alias, "/") {
+			badRequest(w, "alias and tag are required")
+			return
+		}
+		alias, err := st.store.SaveTagAlias(body.Alias, body.Tag)
+		switch {
+		case errors.Is(err, errTagAliasSelf), errors.Is(err, errTagAliasChained), errors.Is(err, errTagAliasIsTag):
+			badRequest(w, err.Error())
+			return
+		case err != nil:
+			internalServerError(w)
+			return
+		}
+		logger.Info("tag alias saved", "alias", alias.Alias, "tag", alias.Tag)
+		writeJSON(w, http.StatusCreated, map[string]any{"success": true, "item": alias})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// tagCategoryGeneral selects tags without a known namespace in GET /api/tags?category=.
+const tagCategoryGeneral = "general"
+
+type tagCategoryRequest struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// handleTagCategories serves GET/POST /api/tags/categories and
+// DELETE /api/tags/categories/{name}.
+func (st *appState) handleTagCategories(w http.ResponseWriter, r *http.Request, escapedName string) {
+	if escapedName != "" {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		name, err := url.PathUnescape(escapedName)
+		if err != nil || strings.TrimSpace(name) == "" || strings.Contains(name, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		deleted, err := st.store.DeleteTagCategory(name)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if !deleted {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "category not found"})
+			return
+		}
+		logger.Info("tag category deleted", "name", name)
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "name": name})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		categories, err := st.store.ListTagCategories()
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": categories})
+	case http.MethodPost:
+		var body tagCategoryRequest
+		if !decodeJSONOrBadRequest(w, r, &body, "name is required") {
+			return
+		}
+		name := strings.ToLower(strings.TrimSpace(body.Name))
+		if !tagCategoryNamePattern.MatchString(name) || name == tagCategoryGeneral {
+			badRequest(w, "name must be lowercase letters, digits, _ or - and not general")
+			return
+		}
+		color := ""
+		if raw := strings.TrimSpace(body.Color); raw != "" {
+			rgb, ok := parseHexColor(raw)
+			if !ok {
+				badRequest(w, "color must be #rrggbb")
+				return
+			}
+			color = formatHexColor(rgb)
+		}
+		category, err := st.store.SaveTagCategory(name, color)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		logger.Info("tag category saved", "name", category.Name, "color", category.Color)
+		writeJSON(w, http.StatusCreated, map[string]any{"success": true, "item": category})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
+}
+
+type tagDeleteRequest struct {
+	Tag string `json:"tag"`
+}
+
+func (st *appState) handleTagsDelete(w http.ResponseWriter, r *http.Request) {
+	var body tagDeleteRequest
 	if !decodeJSONOrBadRequest(w, r, &body, "tag is required") {
 		return
 	}
@@ -144,7 +438,7 @@ func (st *appState) handleTagsDelete(w http.ResponseWriter, r *http.Request) {
 	if len(filepaths) == 0 {
 		writeJSON(w, http.StatusOK, map[string]any{
 			"success":      true,
-			"message":      fmt.Sprintf("No images found for tag '%s'", tag),
+			"message":      localize(r.Context(), msgDeleteByTagNone, tag),
 			"tag":          tag,
 			"queued_count": 0,
 		})
@@ -166,18 +460,17 @@ func (st *appState) handleTagsDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	setTaskState(r.Context(), st.redis, taskID, "PENDING", map[string]any{
-		"message": fmt.Sprintf("Delete images by tag task queued (%d images)", len(filepaths)),
-		"total":   len(filepaths),
-		"tag":     tag,
-	})
+	setTaskState(r.Context(), st.redis, taskID, "PENDING", withMessage(map[string]any{
+		"total": len(filepaths),
+		"tag":   tag,
+	}, "message", msgDeleteByTagQueuedCount, len(filepaths)))
 	writeJSON(w, http.StatusAccepted, map[string]any{
 		"success":      true,
 		"queued":       true,
 		"task_id":      taskID,
 		"tag":          tag,
 		"queued_count": len(filepaths),
-		"message":      fmt.Sprintf("Queued delete for %d images with tag '%s'", len(filepaths), tag),
+		"message":      localize(r.Context(), msgDeleteByTagQueued, len(filepaths), tag),
 	})
 }
 
@@ -203,24 +496,17 @@ func (st *appState) handleUsersGet(w http.ResponseWriter, r *http.Request) {
 	maxTweets := parseNonNegativeInt(r.URL.Query().Get("max_tweets"), -1)
 	sortBy := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("sort")))
 
-	type userInfo struct {
-		Username   string `json:"username"`
-		TweetCount int    `json:"tweet_count"`
-	}
-	users := make([]userInfo, 0)
-	entries, err := os.ReadDir(st.cfg.mediaRoot)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		internalServerError(w)
+	includeStale := parseBoolParam(r.URL.Query().Get("include_stale"))
+
+	candidates, err := st.listUserCounts(r.Context())
+	if err != nil {
+		writeScanError(w, err)
 		return
 	}
-
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		username := entry.Name()
+	users := make([]userInfo, 0, len(candidates))
+	for _, u := range candidates {
 		if q != "" {
-			usernameLower := strings.ToLower(username)
+			usernameLower := strings.ToLower(u.Username)
 			if match == "exact" {
 				if usernameLower != q {
 					continue
@@ -229,22 +515,22 @@ func (st *appState) handleUsersGet(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 		}
-		userPath := filepath.Join(st.cfg.mediaRoot, username)
-		tweetIDs, err := collectUserTweetIDs(userPath)
-		if err != nil {
+		if u.TweetCount <= 0 {
 			continue
 		}
-		tweetCount := len(tweetIDs)
-		if tweetCount <= 0 {
+		if minTweets >= 0 && u.TweetCount < minTweets {
 			continue
 		}
-		if minTweets >= 0 && tweetCount < minTweets {
+		if maxTweets >= 0 && u.TweetCount > maxTweets {
 			continue
 		}
-		if maxTweets >= 0 && tweetCount > maxTweets {
-			continue
+		if includeStale {
+			start := time.Now()
+			stale := st.isUserCountStale(u)
+			timingFrom(r.Context()).since("fs", start)
+			u.Stale = &stale
 		}
-		users = append(users, userInfo{Username: username, TweetCount: tweetCount})
+		users = append(users, u)
 	}
 	switch sortBy {
 	case "name_desc":
@@ -276,10 +562,94 @@ func (st *appState) handleUsersGet(w http.ResponseWriter, r *http.Request) {
 	writePaginatedResponse(w, items, totalItems, perPage, page, allItems, 1)
 }
 
-func (st *appState) handleUsersDelete(w http.ResponseWriter, r *http.Request) {
-	var body struct {
-		Username string `json:"username"`
+type userInfo struct {
+	Username   string `json:"username"`
+	TweetCount int    `json:"tweet_count"`
+	ImageCount *int   `json:"image_count,omitempty"`
+	Stale      *bool  `json:"stale,omitempty"`
+	updatedAt  int64
+}
+
+// listUserCounts serves per-user counts from the image index once a reconcile has built it,
+// and falls back to scanning user directories in parallel before that.
+func (st *appState) listUserCounts(ctx context.Context) ([]userInfo, error) {
+	timing := timingFrom(ctx)
+	start := time.Now()
+	built, err := st.store.ImageIndexBuiltAt()
+	if err != nil {
+		return nil, err
+	}
+	if !built.IsZero() {
+		stats, err := st.store.ListUserStats()
+		timing.since("sqlite", start)
+		if err != nil {
+			return nil, err
+		}
+		users := make([]userInfo, 0, len(stats))
+		for _, u := range stats {
+			imageCount := u.ImageCount
+			users = append(users, userInfo{Username: u.Username, TweetCount: u.TweetCount, ImageCount: &imageCount, updatedAt: u.UpdatedAt})
+		}
+		return users, nil
+	}
+
+	timing.since("sqlite", start)
+
+	defer timing.since("fs", time.Now())
+	entries, err := os.ReadDir(st.cfg.mediaRoot)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	dirs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+
+	scanCtx, cancel := st.scanContext(ctx)
+	defer cancel()
+	counts := make([]int, len(dirs))
+	err = parallelEach(scanCtx, len(dirs), st.cfg.fsScanWorkers, func(i int) {
+		tweetIDs, err := collectUserTweetIDs(filepath.Join(st.cfg.mediaRoot, dirs[i]))
+		if err != nil {
+			counts[i] = -1
+			return
+		}
+		counts[i] = len(tweetIDs)
+	})
+	if err != nil {
+		return nil, scanError(err)
+	}
+	users := make([]userInfo, 0, len(dirs))
+	for i, username := range dirs {
+		if counts[i] < 0 {
+			continue
+		}
+		users = append(users, userInfo{Username: username, TweetCount: counts[i]})
+	}
+	return users, nil
+}
+
+// isUserCountStale reports whether the user's directory changed after its counts were
+// last written. Counts computed from a directory scan are never stale.
+func (st *appState) isUserCountStale(u userInfo) bool {
+	if u.updatedAt == 0 {
+		return false
 	}
+	info, err := os.Stat(filepath.Join(st.cfg.mediaRoot, u.Username))
+	if err != nil {
+		return true
+	}
+	return info.ModTime().UnixMilli() > u.updatedAt
+}
+
+type userDeleteRequest struct {
+	Username string `json:"username"`
+}
+
+func (st *appState) handleUsersDelete(w http.ResponseWriter, r *http.Request) {
+	var body userDeleteRequest
 	if !decodeJSONOrBadRequest(w, r, &body, "username is required") {
 		return
 	}
@@ -301,63 +671,63 @@ func (st *appState) handleUsersDelete(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
 		return
 	}
-	setTaskState(r.Context(), st.redis, taskID, "PENDING", map[string]any{"message": "Delete user task queued"})
+	setTaskState(r.Context(), st.redis, taskID, "PENDING", taskMessage(msgDeleteUserQueued))
 	logger.Info("delete user task queued", "task_id", taskID, "username", username)
 	writeJSON(w, http.StatusAccepted, map[string]any{
 		"success": true,
 		"queued":  true,
 		"task_id": taskID,
-		"message": "Delete user task queued",
+		"message": localize(r.Context(), msgDeleteUserQueued),
 	})
 }
 
 func (st *appState) handleUsersSubroutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	if username, ok := strings.CutSuffix(path, "/merge"); ok {
+		if username == "" || strings.ContainsAny(username, `/\`) {
+			http.NotFound(w, r)
+			return
+		}
+		st.handleUserMerge(w, r, username)
+		return
+	}
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	path := strings.TrimPrefix(r.URL.Path, "/api/users/")
-	if !strings.HasSuffix(path, "/tweets") {
+	var suffix string
+	switch {
+	case strings.HasSuffix(path, "/tweets"):
+		suffix = "/tweets"
+	case strings.HasSuffix(path, "/feed.atom"):
+		suffix = "/feed.atom"
+	default:
 		http.NotFound(w, r)
 		return
 	}
-	username := strings.TrimSuffix(path, "/tweets")
+	username := strings.TrimSuffix(path, suffix)
 	username = strings.TrimSuffix(username, "/")
 	if username == "" || strings.Contains(username, "/") || strings.Contains(username, "\\") {
 		http.NotFound(w, r)
 		return
 	}
-	st.handleUserTweetsGet(w, r, username)
-}
-
-func (st *appState) handleUserTweetsGet(w http.ResponseWriter, r *http.Request, username string) {
-	page := parsePositiveInt(r.URL.Query().Get("page"), 1)
-	perPage := parsePositiveInt(r.URL.Query().Get("per_page"), 100)
-	offset := (page - 1) * perPage
-	returnAll := strings.TrimSpace(r.URL.Query().Get("all")) == "1"
-	minTagCount := parseNonNegativeInt(r.URL.Query().Get("min_tag_count"), -1)
-	maxTagCount := parseNonNegativeInt(r.URL.Query().Get("max_tag_count"), -1)
-	excludeTags := splitCSV(r.URL.Query().Get("exclude_tags"))
-
-	userPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, username)
-	if err != nil {
-		writeJSON(w, http.StatusNotFound, map[string]any{"error": "User not found"})
-		return
-	}
-	entries, err := os.ReadDir(userPath)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			writeJSON(w, http.StatusNotFound, map[string]any{"error": "User not found"})
-			return
-		}
-		internalServerError(w)
+	if suffix == "/feed.atom" {
+		st.handleUserFeed(w, r, username)
 		return
 	}
+	st.handleUserTweetsGet(w, r, username)
+}
 
+// groupUserImagesByTweet maps tweet IDs to the media paths found in a user directory. A
+// nested directory is one tweet; loose files are grouped by the ID in their name.
+func (st *appState) groupUserImagesByTweet(userPath string, entries []os.DirEntry) map[string][]string {
 	imagesByTweet := make(map[string][]string)
 	for _, entry := range entries {
 		entryPath := filepath.Join(userPath, entry.Name())
 		if entry.IsDir() {
+			if isProfileDir(entry.Name()) {
+				continue
+			}
 			tweetID := entry.Name()
 			imgEntries, err := os.ReadDir(entryPath)
 			if err != nil {
@@ -382,6 +752,52 @@ func (st *appState) handleUserTweetsGet(w http.ResponseWriter, r *http.Request,
 		}
 		imagesByTweet[tweetID] = append(imagesByTweet[tweetID], normalizeRelPath(st.cfg.mediaRoot, entryPath))
 	}
+	return imagesByTweet
+}
+
+// userTweet is one tweet of GET /api/users/{user}/tweets with its stored images.
+type userTweet struct {
+	TweetID     string          `json:"tweet_id"`
+	DisplayName string          `json:"display_name,omitempty"`
+	Text        string          `json:"text,omitempty"`
+	CreatedAt   string          `json:"created_at,omitempty"`
+	Images      []imageListItem `json:"images"`
+}
+
+func (st *appState) handleUserTweetsGet(w http.ResponseWriter, r *http.Request, username string) {
+	page := parsePositiveInt(r.URL.Query().Get("page"), 1)
+	perPage := parsePositiveInt(r.URL.Query().Get("per_page"), 100)
+	offset := (page - 1) * perPage
+	returnAll := strings.TrimSpace(r.URL.Query().Get("all")) == "1"
+	minTagCount := parseNonNegativeInt(r.URL.Query().Get("min_tag_count"), -1)
+	maxTagCount := parseNonNegativeInt(r.URL.Query().Get("max_tag_count"), -1)
+	excludeTags := parseExcludeTags(r.URL.Query())
+	collapse := parseBoolParam(r.URL.Query().Get("collapse_variants"))
+	cursor, err := parseCursorRequest(r.URL.Query(), 1)
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+
+	timing := timingFrom(r.Context())
+	userPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, username)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "User not found"})
+		return
+	}
+	fsStart := time.Now()
+	entries, err := os.ReadDir(userPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "User not found"})
+			return
+		}
+		internalServerError(w)
+		return
+	}
+
+	imagesByTweet := st.groupUserImagesByTweet(userPath, entries)
+	timing.since("fs", fsStart)
 
 	tweetIDs := make([]string, 0, len(imagesByTweet))
 	for tweetID, paths := range imagesByTweet {
@@ -390,26 +806,47 @@ func (st *appState) handleUserTweetsGet(w http.ResponseWriter, r *http.Request,
 		}
 	}
 	sort.Sort(sort.Reverse(sort.StringSlice(tweetIDs)))
-
-	type tweet struct {
-		TweetID string `json:"tweet_id"`
-		Images  []any  `json:"images"`
+	if cursor != nil && cursor.After != nil {
+		afterID := cursor.After[0]
+		tweetIDs = tweetIDs[sort.Search(len(tweetIDs), func(i int) bool { return tweetIDs[i] < afterID }):]
 	}
-	tweets := make([]tweet, 0, len(tweetIDs))
+
+	// A cursor page stops once it is full, so only its tweets are read from the store.
+	tweets := make([]userTweet, 0)
+	hasMore := false
 	for _, tweetID := range tweetIDs {
-		imagePaths := imagesByTweet[tweetID]
-		if len(imagePaths) == 0 {
-			continue
+		if cursor != nil && len(tweets) == cursor.Limit {
+			hasMore = true
+			break
 		}
+		imagePaths := imagesByTweet[tweetID]
 		sort.Strings(imagePaths)
+		var variantGroups map[string]variantSummary
+		if collapse {
+			variantStart := time.Now()
+			imagePaths, variantGroups, err = st.collapseVariants(imagePaths)
+			timing.since("sqlite", variantStart)
+			if err != nil {
+				internalServerError(w)
+				return
+			}
+		}
 
+		tagsStart := time.Now()
 		tagsMap, err := st.store.GetTagsForFiles(imagePaths)
+		timing.since("sqlite", tagsStart)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		details, err := st.loadImageListDetails(imagePaths)
+		timing.since("sqlite", tagsStart)
 		if err != nil {
 			internalServerError(w)
 			return
 		}
 
-		images := make([]any, 0, len(imagePaths))
+		images := make([]imageListItem, 0, len(imagePaths))
 		for _, p := range imagePaths {
 			tagsForImage := tagsMap[p]
 			if hasTagPattern(tagsForImage, excludeTags) {
@@ -422,14 +859,38 @@ func (st *appState) handleUserTweetsGet(w http.ResponseWriter, r *http.Request,
 			if maxTagCount >= 0 && tagCount > maxTagCount {
 				continue
 			}
-			images = append(images, map[string]any{"path": p, "tags": tagsForImage})
+			images = append(images, newImageListItem(p, tagsForImage, variantGroups, details))
 		}
 		if len(images) == 0 {
 			continue
 		}
-		tweets = append(tweets, tweet{TweetID: tweetID, Images: images})
+		tweets = append(tweets, userTweet{TweetID: tweetID, Images: images})
 	}
 
+	metaIDs := make([]string, 0, len(tweets))
+	for _, t := range tweets {
+		metaIDs = append(metaIDs, t.TweetID)
+	}
+	metaStart := time.Now()
+	metas, err := st.store.GetTweetMetas(metaIDs)
+	timing.since("sqlite", metaStart)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	for i := range tweets {
+		meta := metas[tweets[i].TweetID]
+		tweets[i].DisplayName, tweets[i].Text, tweets[i].CreatedAt = meta.DisplayName, meta.Text, meta.CreatedAt
+	}
+
+	if cursor != nil {
+		nextCursor := ""
+		if hasMore {
+			nextCursor = encodeCursor(tweets[len(tweets)-1].TweetID)
+		}
+		writeCursorResponse(w, tweets, nextCursor)
+		return
+	}
 	totalItems := len(tweets)
 	items := any(tweets)
 	if !returnAll {
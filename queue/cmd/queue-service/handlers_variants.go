@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// handleImageVariants manages variant groups at /api/images/variants.
+func (st *appState) handleImageVariants(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		st.handleImageVariantsGet(w, r)
+	case http.MethodPost:
+		st.handleImageVariantsLink(w, r)
+	case http.MethodDelete:
+		st.handleImageVariantsUnlink(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (st *appState) handleImageVariantsGet(w http.ResponseWriter, r *http.Request) {
+	rel := normalizeFilepath(r.URL.Query().Get("filepath"))
+	if rel == "" {
+		badRequest(w, "filepath is required")
+		return
+	}
+	group, err := st.store.GetVariantGroup(rel)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	variants := make([]map[string]any, 0, len(group))
+	groupID := ""
+	for _, v := range group {
+		groupID = v.GroupID
+		_, statErr := os.Stat(filepath.Join(st.cfg.mediaRoot, filepath.FromSlash(v.Filepath)))
+		variants = append(variants, map[string]any{
+			"filepath":   v.Filepath,
+			"role":       v.Role,
+			"preferred":  v.Preferred,
+			"media_type": mediaTypeFromPath(v.Filepath),
+			"exists":     statErr == nil,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"filepath": rel,
+		"group_id": groupID,
+		"variants": variants,
+	})
+}
+
+type variantsLinkRequest struct {
+	Filepaths []string          `json:"filepaths"`
+	Roles     map[string]string `json:"roles"`
+	Preferred string            `json:"preferred"`
+}
+
+func (st *appState) handleImageVariantsLink(w http.ResponseWriter, r *http.Request) {
+	var body variantsLinkRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepaths is required") {
+		return
+	}
+	filepaths := normalizeUniqueFilepaths(body.Filepaths)
+	if len(filepaths) < 2 {
+		badRequest(w, "at least two filepaths are required")
+		return
+	}
+	preferred := normalizeFilepath(body.Preferred)
+	members := make([]imageVariant, 0, len(filepaths))
+	hasPreferred := preferred == ""
+	for _, rel := range filepaths {
+		fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+		if err != nil {
+			badRequest(w, "invalid filepath: "+rel)
+			return
+		}
+		if _, err := os.Stat(fullPath); err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "Image not found", "filepath": rel})
+			return
+		}
+		role := strings.ToLower(strings.TrimSpace(body.Roles[rel]))
+		if role != "" && !isVariantRole(role) {
+			badRequest(w, "role must be original, upscaled or edited")
+			return
+		}
+		hasPreferred = hasPreferred || rel == preferred
+		members = append(members, imageVariant{Filepath: rel, Role: role})
+	}
+	if !hasPreferred {
+		badRequest(w, "preferred must be one of filepaths")
+		return
+	}
+
+	groupID, err := st.store.LinkVariants(members, preferred)
+	if err != nil {
+		logger.Error("failed to link variants", "count", len(members), "error", err)
+		internalServerError(w)
+		return
+	}
+	logger.Info("variants linked", "group_id", groupID, "count", len(members))
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "group_id": groupID})
+}
+
+func (st *appState) handleImageVariantsUnlink(w http.ResponseWriter, r *http.Request) {
+	var body filepathRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepath is required") {
+		return
+	}
+	rel := normalizeFilepath(body.Filepath)
+	if rel == "" {
+		badRequest(w, "filepath is required")
+		return
+	}
+	removed, err := st.store.UnlinkVariant(rel)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	if !removed {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "Image is not linked to a variant group"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true})
+}
+
+// variantSummary describes the group a listed image represents after collapsing.
+type variantSummary struct {
+	GroupID string
+	Count   int
+}
+
+// collapseVariants keeps one image per variant group among paths, in paths order, and
+// reports the group of each kept image. The explicitly preferred version wins, then the
+// original, then the first listed.
+func (st *appState) collapseVariants(paths []string) ([]string, map[string]variantSummary, error) {
+	variants, err := st.store.GetVariantsForFiles(paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	members := make(map[string][]string)
+	for _, p := range paths {
+		if v, ok := variants[p]; ok {
+			members[v.GroupID] = append(members[v.GroupID], p)
+		}
+	}
+	chosen := make(map[string]string, len(members))
+	for groupID, group := range members {
+		ranked := append([]string(nil), group...)
+		sort.SliceStable(ranked, func(i, j int) bool {
+			return variantRank(variants[ranked[i]]) < variantRank(variants[ranked[j]])
+		})
+		chosen[groupID] = ranked[0]
+	}
+
+	kept := make([]string, 0, len(paths))
+	summaries := make(map[string]variantSummary, len(chosen))
+	for _, p := range paths {
+		v, ok := variants[p]
+		if !ok {
+			kept = append(kept, p)
+			continue
+		}
+		if chosen[v.GroupID] != p {
+			continue
+		}
+		kept = append(kept, p)
+		summaries[p] = variantSummary{GroupID: v.GroupID, Count: len(members[v.GroupID])}
+	}
+	return kept, summaries, nil
+}
+
+func variantRank(v imageVariant) int {
+	switch {
+	case v.Preferred:
+		return 0
+	case v.Role == variantRoleOriginal:
+		return 1
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+type watchlistAddRequest struct {
+	Username        string `json:"username"`
+	Enabled         *bool  `json:"enabled"`
+	IntervalMinutes int    `json:"interval_minutes"`
+}
+
+func (st *appState) handleWatchlist(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := st.store.ListWatchlist()
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"items":                    entries,
+			"default_interval_minutes": st.cfg.watchlistIntervalMinutes,
+		})
+	case http.MethodPost:
+		var body watchlistAddRequest
+		if !decodeJSONOrBadRequest(w, r, &body, "username is required") {
+			return
+		}
+		username, ok := normalizeUsername(body.Username)
+		if !ok {
+			badRequest(w, "Invalid username")
+			return
+		}
+		if body.IntervalMinutes < 0 {
+			badRequest(w, "interval_minutes must be non-negative")
+			return
+		}
+		entry := watchEntry{Username: username, Enabled: body.Enabled == nil || *body.Enabled, IntervalMinutes: body.IntervalMinutes}
+		if err := st.store.SaveWatch(entry); err != nil {
+			internalServerError(w)
+			return
+		}
+		saved, _, err := st.store.GetWatch(username)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		logger.Info("watchlist entry saved", "username", username, "enabled", entry.Enabled)
+		writeJSON(w, http.StatusCreated, map[string]any{"success": true, "item": saved})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+type watchlistUpdateRequest struct {
+	Enabled         *bool `json:"enabled"`
+	IntervalMinutes *int  `json:"interval_minutes"`
+}
+
+func (st *appState) handleWatchlistSubroutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/watchlist/"), "/")
+	// An account named "import" is still reachable with the other methods.
+	if path == "import" && r.Method == http.MethodPost {
+		st.handleWatchlistImport(w, r)
+		return
+	}
+	username, ok := normalizeUsername(path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	entry, found, err := st.store.GetWatch(username)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "user is not watched"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, entry)
+	case http.MethodPatch:
+		var body watchlistUpdateRequest
+		if !decodeJSONOrBadRequest(w, r, &body, "invalid request body") {
+			return
+		}
+		if body.Enabled != nil {
+			entry.Enabled = *body.Enabled
+		}
+		if body.IntervalMinutes != nil {
+			if *body.IntervalMinutes < 0 {
+				badRequest(w, "interval_minutes must be non-negative")
+				return
+			}
+			entry.IntervalMinutes = *body.IntervalMinutes
+		}
+		if err := st.store.SaveWatch(entry); err != nil {
+			internalServerError(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "item": entry})
+	case http.MethodDelete:
+		if _, err := st.store.DeleteWatch(entry.Username); err != nil {
+			internalServerError(w)
+			return
+		}
+		logger.Info("watchlist entry deleted", "username", entry.Username)
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "username": entry.Username})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
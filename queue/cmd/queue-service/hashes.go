@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	hashesDefaultPerPage = 1000
+	hashesMaxPerPage     = 10000
+	maxHashLookup        = 1000
+)
+
+// handleHashes dumps the content hash index (MD5 → filepath) for external dedupe tools,
+// ordered by path. It pages with page/per_page, or with cursor/limit for stable walks
+// while files are being added.
+func (st *appState) handleHashes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	user := strings.TrimSpace(q.Get("user"))
+	if strings.ContainsAny(user, `/\`) {
+		badRequest(w, "invalid user")
+		return
+	}
+	cursor, err := parseCursorRequest(q, 1)
+	if err != nil {
+		badRequest(w, "invalid cursor")
+		return
+	}
+	if cursor != nil {
+		after := ""
+		if cursor.After != nil {
+			after = cursor.After[0]
+		}
+		entries, _, err := st.store.ListImageHashes(user, after, 0, cursor.Limit+1)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		next := ""
+		if len(entries) > cursor.Limit {
+			entries = entries[:cursor.Limit]
+			next = encodeCursor(entries[len(entries)-1].Filepath)
+		}
+		writeCursorResponse(w, entries, next)
+		return
+	}
+
+	page := parsePositiveInt(q.Get("page"), 1)
+	perPage := min(parsePositiveInt(q.Get("per_page"), hashesDefaultPerPage), hashesMaxPerPage)
+	entries, total, err := st.store.ListImageHashes(user, "", (page-1)*perPage, perPage)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	writePaginatedResponse(w, entries, total, perPage, page, false, 0)
+}
+
+type hashLookupRequest struct {
+	Hashes []string `json:"hashes"`
+}
+
+// hashLookupItem answers "do you already have this file?" for one hash. Seen is also
+// true for files that were downloaded and deleted since; downloads keep skipping those.
+type hashLookupItem struct {
+	Hash      string   `json:"hash"`
+	Found     bool     `json:"found"`
+	Seen      bool     `json:"seen"`
+	Filepaths []string `json:"filepaths"`
+}
+
+// handleHashLookup checks up to maxHashLookup MD5 hashes against the library at once.
+func (st *appState) handleHashLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body hashLookupRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "hashes is required") {
+		return
+	}
+	hashes := make([]string, 0, len(body.Hashes))
+	seen := make(map[string]struct{}, len(body.Hashes))
+	for _, raw := range body.Hashes {
+		h := strings.ToLower(strings.TrimSpace(raw))
+		if !md5HexRe.MatchString(h) {
+			badRequest(w, fmt.Sprintf("invalid hash: %q (expected a hex MD5)", raw))
+			return
+		}
+		if _, ok := seen[h]; !ok {
+			seen[h] = struct{}{}
+			hashes = append(hashes, h)
+		}
+	}
+	if len(hashes) == 0 {
+		badRequest(w, "hashes is required")
+		return
+	}
+	if len(hashes) > maxHashLookup {
+		badRequest(w, fmt.Sprintf("too many hashes (max %d)", maxHashLookup))
+		return
+	}
+
+	files, err := st.store.FindImagesByHashes(hashes)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	processed, err := st.store.FilterProcessedHashes(hashes)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	items := make([]hashLookupItem, 0, len(hashes))
+	found, seenCount := 0, 0
+	for _, h := range hashes {
+		paths := files[h]
+		if paths == nil {
+			paths = []string{}
+		}
+		item := hashLookupItem{Hash: h, Found: len(paths) > 0, Seen: len(paths) > 0 || processed[h], Filepaths: paths}
+		if item.Found {
+			found++
+		}
+		if item.Seen {
+			seenCount++
+		}
+		items = append(items, item)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items":       items,
+		"found_count": found,
+		"seen_count":  seenCount,
+	})
+}
@@ -9,10 +9,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,12 +22,25 @@ import (
 )
 
 func setTaskState(ctx context.Context, rdb RedisClient, taskID, status string, result interface{}) {
-	rec := queueTaskStatus{Status: status, Result: result, UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
-	b, _ := json.Marshal(rec)
-	if err := rdb.Set(ctx, taskMetaPrefix+taskID, b, 7*24*time.Hour).Err(); err != nil {
+	if err := rdb.Set(ctx, taskMetaPrefix+taskID, encodeTaskState(status, result), taskStateTTL).Err(); err != nil {
 		logger.Error("failed to persist task state", "task_id", taskID, "status", status, "error", err)
 	}
+	if isFinishedTaskState(status) {
+		rdb.SRem(ctx, pendingDownloadSetKey, taskID)
+	}
+	if err := rdb.Publish(ctx, taskEventsChannel, encodeTaskEvent(taskID, status)).Err(); err != nil {
+		logger.Warn("failed to publish task event", "task_id", taskID, "error", err)
+	}
+	logTaskState(taskID, status, result)
+}
+
+func encodeTaskState(status string, result interface{}) []byte {
+	rec := queueTaskStatus{Status: status, Result: result, UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
+	b, _ := json.Marshal(rec)
+	return b
+}
 
+func logTaskState(taskID, status string, result interface{}) {
 	msg := ""
 	if resultMap, ok := result.(map[string]any); ok {
 		if s, ok := stringFromAny(resultMap["message"]); ok && s != "" {
@@ -60,12 +75,46 @@ func getTaskState(ctx context.Context, rdb RedisClient, taskID string) (queueTas
 	return rec, true
 }
 
+// saveTaskResult keeps the typed final result of a task next to its flattened state.
+func saveTaskResult(ctx context.Context, rdb RedisClient, taskID, taskType, state string, result any) {
+	b, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("failed to encode task result", "task_id", taskID, "error", err)
+		return
+	}
+	rec := taskResultRecord{
+		TaskID:      taskID,
+		TaskType:    taskType,
+		State:       state,
+		CompletedAt: time.Now().UTC().Format(time.RFC3339),
+		Result:      b,
+	}
+	raw, _ := json.Marshal(rec)
+	if err := rdb.Set(ctx, taskResultPrefix+taskID, raw, 7*24*time.Hour).Err(); err != nil {
+		logger.Error("failed to persist task result", "task_id", taskID, "error", err)
+	}
+}
+
+func getTaskResult(ctx context.Context, rdb RedisClient, taskID string) (taskResultRecord, bool) {
+	raw, err := rdb.Get(ctx, taskResultPrefix+taskID).Result()
+	if err != nil || raw == "" {
+		return taskResultRecord{}, false
+	}
+	var rec taskResultRecord
+	if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+		return taskResultRecord{}, false
+	}
+	return rec, true
+}
+
 func setDownloadAutotagState(ctx context.Context, rdb RedisClient, status string, result map[string]any) {
 	rec := queueTaskStatus{Status: status, Result: result, UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
 	b, _ := json.Marshal(rec)
 	if err := rdb.Set(ctx, autotagDownloadStatusKey, b, 24*time.Hour).Err(); err != nil {
 		logger.Error("failed to persist download autotag state", "status", status, "error", err)
 	}
+	taskID, _ := stringFromAny(result["task_id"])
+	_ = rdb.Publish(ctx, taskEventsChannel, encodeTaskEvent(taskID, status)).Err()
 }
 
 func getDownloadAutotagState(ctx context.Context, rdb RedisClient) (queueTaskStatus, bool) {
@@ -82,6 +131,17 @@ func getDownloadAutotagState(ctx context.Context, rdb RedisClient) (queueTaskSta
 
 func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	if tw, ok := w.(*timingWriter); ok {
+		// Encode before writing the status so serialization shows up in Server-Timing.
+		start := time.Now()
+		b, err := json.Marshal(payload)
+		tw.timing.since("serialize", start)
+		tw.WriteHeader(status)
+		if err == nil {
+			_, _ = tw.Write(append(b, '\n'))
+		}
+		return
+	}
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(payload)
 }
@@ -123,18 +183,26 @@ func normalizeUniqueFilepaths(rawPaths []string) []string {
 	return filepaths
 }
 
-func (st *appState) enqueueTask(taskType, queueName, taskID string, payload any, timeout time.Duration) error {
+// enqueueTask enqueues a task without retries; opts are applied last and may override that.
+func (st *appState) enqueueTask(taskType, queueName, taskID string, payload any, timeout time.Duration, opts ...asynq.Option) error {
 	b, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
+	if b, err = st.payloadCodec.Seal(taskType, b); err != nil {
+		return err
+	}
 	task := asynq.NewTask(taskType, b)
-	_, err = st.asynqCli.Enqueue(task,
+	options := []asynq.Option{
 		asynq.Queue(queueName),
 		asynq.TaskID(taskID),
 		asynq.MaxRetry(0),
 		asynq.Timeout(timeout),
-	)
+	}
+	if st.cfg.taskRetention > 0 {
+		options = append(options, asynq.Retention(st.cfg.taskRetention))
+	}
+	_, err = st.asynqCli.Enqueue(task, append(options, opts...)...)
 	return err
 }
 
@@ -156,6 +224,15 @@ func addProgressFields(resp map[string]any, resultMap map[string]any) {
 	}
 }
 
+// paginatedResponse is the envelope of every paged list endpoint.
+type paginatedResponse struct {
+	Items       any `json:"items"`
+	TotalItems  int `json:"total_items"`
+	PerPage     int `json:"per_page"`
+	CurrentPage int `json:"current_page"`
+	TotalPages  int `json:"total_pages"`
+}
+
 func writePaginatedResponse(
 	w http.ResponseWriter,
 	items any,
@@ -179,12 +256,12 @@ func writePaginatedResponse(
 		}
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
-		"items":        items,
-		"total_items":  totalItems,
-		"per_page":     respPerPage,
-		"current_page": respCurrentPage,
-		"total_pages":  respTotalPages,
+	writeJSON(w, http.StatusOK, paginatedResponse{
+		Items:       items,
+		TotalItems:  totalItems,
+		PerPage:     respPerPage,
+		CurrentPage: respCurrentPage,
+		TotalPages:  respTotalPages,
 	})
 }
 
@@ -268,7 +345,7 @@ func hasTagPattern(tags []imageTag, patterns []string) bool {
 			if p == "" {
 				continue
 			}
-			if strings.Contains(tagName, p) {
+			if tagPatternMatches(tagName, p) {
 				return true
 			}
 		}
@@ -276,6 +353,41 @@ func hasTagPattern(tags []imageTag, patterns []string) bool {
 	return false
 }
 
+// exactTagPrefix marks a tag pattern that only matches the whole tag, e.g. "=cat" matches
+// cat but not category.
+const exactTagPrefix = "="
+
+// exactTagPatterns marks every pattern as exact, for the *_exact_tags parameters. OR groups
+// are split first, so each alternative is exact.
+func exactTagPatterns(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, t := range flattenTagGroups(tags) {
+		if t = strings.TrimPrefix(t, exactTagPrefix); t != "" {
+			out = append(out, exactTagPrefix+t)
+		}
+	}
+	return out
+}
+
+// parseExcludeTags reads exclude_tags, whose terms match substrings unless written as
+// =tag, together with exclude_exact_tags, whose terms always match whole tags.
+func parseExcludeTags(q url.Values) []string {
+	return append(splitCSV(q.Get("exclude_tags")), exactTagPatterns(splitCSV(q.Get("exclude_exact_tags")))...)
+}
+
+// tagPatternMatches reports whether a lowercased tag matches a lowercased pattern the way
+// FindFilesByTagPatterns does: "=tag" as a whole, "ns:*" by prefix, anything else as a
+// substring.
+func tagPatternMatches(tagName, pattern string) bool {
+	if whole, ok := strings.CutPrefix(pattern, exactTagPrefix); ok && whole != "" {
+		return tagName == whole
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok && prefix != "" {
+		return strings.HasPrefix(tagName, prefix)
+	}
+	return strings.Contains(tagName, pattern)
+}
+
 func resolvePathUnderRoot(root, rel string) (string, error) {
 	cleanRel := filepath.Clean(filepath.FromSlash(strings.TrimSpace(rel)))
 	if cleanRel == "." || cleanRel == "" || cleanRel == "/" {
@@ -372,7 +484,9 @@ func collectUserTweetIDs(userPath string) (map[string]struct{}, error) {
 	tweetIDs := make(map[string]struct{})
 	for _, entry := range entries {
 		if entry.IsDir() {
-			tweetIDs[entry.Name()] = struct{}{}
+			if !isProfileDir(entry.Name()) {
+				tweetIDs[entry.Name()] = struct{}{}
+			}
 			continue
 		}
 		if !isImageFile(entry.Name()) {
@@ -387,55 +501,178 @@ func collectUserTweetIDs(userPath string) (map[string]struct{}, error) {
 	return tweetIDs, nil
 }
 
-func getTweetImages(tweetURL string) ([]string, error) {
+// tweetMediaDetail is the media entity shape shared by the syndication and GraphQL APIs.
+type tweetMediaDetail struct {
+	Type          string `json:"type"`
+	MediaURLHTTPS string `json:"media_url_https"`
+	VideoInfo     struct {
+		Variants []struct {
+			Bitrate     int    `json:"bitrate"`
+			ContentType string `json:"content_type"`
+			URL         string `json:"url"`
+		} `json:"variants"`
+	} `json:"video_info"`
+}
+
+// bestMP4Variant returns the highest-bitrate MP4 variant URL of a media entity.
+func (m tweetMediaDetail) bestMP4Variant() string {
+	best := ""
+	bestBitrate := -1
+	for _, v := range m.VideoInfo.Variants {
+		if v.URL == "" || !strings.Contains(strings.ToLower(v.ContentType), "mp4") {
+			continue
+		}
+		if v.Bitrate > bestBitrate {
+			best = v.URL
+			bestBitrate = v.Bitrate
+		}
+	}
+	return best
+}
+
+// getTweetImages resolves the downloadable media of a tweet. The public syndication API is
+// tried first; when X credentials are configured, tweets it cannot see (age-gated, NSFW or
+// otherwise withheld) are fetched through the authenticated GraphQL API. When both fail,
+// the configured fallback chain (fxtwitter, vxtwitter, Nitter) is walked.
+func (st *appState) getTweetImages(ctx context.Context, tweetURL string) ([]tweetMedia, *tweetMeta, error) {
 	tweetID := tweetIDFromURL(tweetURL)
 	if tweetID == "" {
-		return nil, errors.New("invalid tweet id")
+		return nil, nil, errors.New("invalid tweet id")
 	}
+
+	var media []tweetMedia
+	var meta *tweetMeta
+	var err error
+	if st.backendHealth.available(syndicationBackendName) || len(st.tweetBackends) == 0 {
+		media, meta, err = fetchSyndicationTweetMedia(ctx, st.mediaClient, tweetID)
+		if err != nil {
+			st.backendHealth.recordFailure(syndicationBackendName, err)
+		} else {
+			st.backendHealth.recordSuccess(syndicationBackendName)
+		}
+	} else {
+		err = errors.New("syndication api cooling down")
+	}
+
+	if st.xAuth != nil && (err != nil || len(media) == 0) {
+		authMedia, authErr := st.xAuth.fetchTweetMedia(ctx, st.downloadHTTPClient, tweetID)
+		if authErr == nil {
+			return authMedia, meta, nil
+		}
+		logger.Warn("authenticated tweet lookup failed", "tweet_id", tweetID, "error", authErr)
+	}
+	if err == nil {
+		return media, meta, nil
+	}
+	if len(st.tweetBackends) == 0 {
+		return nil, nil, err
+	}
+	fallbackMedia, fallbackErr := st.fetchTweetMediaFallback(ctx, extractUsername(tweetURL), tweetID)
+	if fallbackErr != nil {
+		return nil, nil, fmt.Errorf("%w; fallback: %v", err, fallbackErr)
+	}
+	return fallbackMedia, nil, nil
+}
+
+// fetchSyndicationTweetMedia returns the media of a tweet together with its caption metadata.
+func fetchSyndicationTweetMedia(ctx context.Context, client httpDoer, tweetID string) ([]tweetMedia, *tweetMeta, error) {
 	apiURL := fmt.Sprintf("https://cdn.syndication.twimg.com/tweet-result?id=%s&token=4", tweetID)
-	req, _ := http.NewRequest(http.MethodGet, apiURL, nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0")
-	client := &http.Client{Timeout: 10 * time.Second}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("tweet api status=%d", resp.StatusCode)
+		return nil, nil, fmt.Errorf("tweet api status=%d", resp.StatusCode)
 	}
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var parsed struct {
+		Text      string `json:"text"`
+		CreatedAt string `json:"created_at"`
+		User      struct {
+			Name       string `json:"name"`
+			ScreenName string `json:"screen_name"`
+		} `json:"user"`
 		Photos []struct {
 			URL string `json:"url"`
 		} `json:"photos"`
+		MediaDetails []tweetMediaDetail `json:"mediaDetails"`
 	}
 	if err := json.Unmarshal(body, &parsed); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	uniq := make(map[string]struct{})
 	for _, p := range parsed.Photos {
 		if p.URL == "" {
 			continue
 		}
-		u := regexp.MustCompile(`:\\w+$`).ReplaceAllString(p.URL, ":orig")
-		uniq[u] = struct{}{}
+		uniq[origMediaURL(p.URL)] = struct{}{}
 	}
 	images := make([]string, 0, len(uniq))
 	for u := range uniq {
 		images = append(images, u)
 	}
 	sort.Strings(images)
-	return images, nil
+
+	// Animated GIFs are served as a looping MP4; keep the best variant of each.
+	gifs := make([]string, 0)
+	for _, m := range parsed.MediaDetails {
+		if m.Type != "animated_gif" {
+			continue
+		}
+		best := m.bestMP4Variant()
+		if best == "" {
+			continue
+		}
+		if _, ok := uniq[best]; ok {
+			continue
+		}
+		uniq[best] = struct{}{}
+		gifs = append(gifs, best)
+	}
+
+	media := make([]tweetMedia, 0, len(images)+len(gifs))
+	for _, u := range images {
+		media = append(media, tweetMedia{URL: u, Type: mediaTypeImage})
+	}
+	for _, u := range gifs {
+		media = append(media, tweetMedia{URL: u, Type: mediaTypeAnimatedGIF})
+	}
+	meta := &tweetMeta{
+		TweetID:     tweetID,
+		Username:    parsed.User.ScreenName,
+		DisplayName: parsed.User.Name,
+		Text:        parsed.Text,
+		CreatedAt:   parsed.CreatedAt,
+	}
+	return media, meta, nil
 }
 
 func listImageFiles(root string) ([]string, error) {
 	files := make([]string, 0)
-	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+	err := walkImageFiles(root, func(path string) error {
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// walkImageFiles calls fn for every media file under root in lexical order without
+// collecting paths, keeping memory flat on very large libraries. Unreadable entries are
+// skipped; an error from fn stops the walk and is returned.
+func walkImageFiles(root string, fn func(path string) error) error {
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return nil
 		}
@@ -443,20 +680,29 @@ func listImageFiles(root string) ([]string, error) {
 			return nil
 		}
 		if isImageFile(d.Name()) {
-			files = append(files, path)
+			return fn(path)
 		}
 		return nil
 	})
-	if err != nil {
-		return nil, err
-	}
-	sort.Strings(files)
-	return files, nil
 }
 
 func isImageFile(name string) bool {
 	lower := strings.ToLower(name)
-	return strings.HasSuffix(lower, ".jpg") || strings.HasSuffix(lower, ".jpeg") || strings.HasSuffix(lower, ".png") || strings.HasSuffix(lower, ".webp") || strings.HasSuffix(lower, ".gif")
+	return isVideoFile(lower) || strings.HasSuffix(lower, ".jpg") || strings.HasSuffix(lower, ".jpeg") || strings.HasSuffix(lower, ".png") || strings.HasSuffix(lower, ".webp") || strings.HasSuffix(lower, ".gif")
+}
+
+func isVideoFile(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".mp4")
+}
+
+// mediaTypeFromPath reports how a stored file should be presented to clients.
+// GIF files and the MP4 loops X serves for animated GIFs are both treated as animated_gif.
+func mediaTypeFromPath(name string) string {
+	lower := strings.ToLower(name)
+	if isVideoFile(lower) || strings.HasSuffix(lower, ".gif") {
+		return mediaTypeAnimatedGIF
+	}
+	return mediaTypeImage
 }
 
 func fileMD5(path string) (string, error) {
@@ -481,11 +727,35 @@ func extFromContentType(contentType string) string {
 		return ".webp"
 	case strings.Contains(ct, "gif"):
 		return ".gif"
+	case strings.Contains(ct, "mp4"):
+		return ".mp4"
 	default:
 		return ".jpg"
 	}
 }
 
+// sniffMediaExt picks the file extension from the leading bytes of path rather than the
+// response header, rejecting payloads such as HTML error pages that are not media.
+func sniffMediaExt(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	contentType := http.DetectContentType(head[:n])
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp", "video/mp4":
+		return extFromContentType(contentType), nil
+	default:
+		return "", fmt.Errorf("unexpected media content %q", contentType)
+	}
+}
+
 func normalizeRelPath(root, target string) string {
 	rel, err := filepath.Rel(root, target)
 	if err != nil {
@@ -506,8 +776,30 @@ func tweetIDFromURL(tweetURL string) string {
 	return last
 }
 
+// tweetURLRe matches status URLs on x.com, twitter.com and the embed-fixing frontends
+// clients commonly share (fxtwitter, vxtwitter, fixupx, ...), including mobile subdomains.
+var tweetURLRe = regexp.MustCompile(`(?i)https?://(?:(?:www|mobile|m|d)\.)?(?:x|twitter|fxtwitter|vxtwitter|fixupx|fixvx|twittpr)\.com/([A-Za-z0-9_]{1,15})/status(?:es)?/(\d+)`)
+
+// canonicalTweetURL rewrites any supported status URL to https://x.com/{user}/status/{id}.
+func canonicalTweetURL(raw string) (string, bool) {
+	m := tweetURLRe.FindStringSubmatch(strings.TrimSpace(raw))
+	if m == nil {
+		return "", false
+	}
+	return fmt.Sprintf("https://x.com/%s/status/%s", m[1], m[2]), true
+}
+
+// canonicalPostURL canonicalizes tweet URLs and leaves other sites' URLs trimmed as is.
+func canonicalPostURL(raw string) string {
+	if u, ok := canonicalTweetURL(raw); ok {
+		return u
+	}
+	return strings.TrimSpace(raw)
+}
+
 func isTweetURL(url string) bool {
-	return (strings.Contains(url, "x.com") || strings.Contains(url, "twitter.com")) && strings.Contains(url, "/status/")
+	_, ok := canonicalTweetURL(url)
+	return ok
 }
 
 func uniqueReverse(values []string) []string {
@@ -562,6 +854,18 @@ func envOrDefault(key, fallback string) string {
 	return fallback
 }
 
+func envFloat(key string, fallback float64) float64 {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return fallback
+	}
+	n, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
 func envInt(key string, fallback int) int {
 	val := strings.TrimSpace(os.Getenv(key))
 	if val == "" {
@@ -574,3 +878,33 @@ func envInt(key string, fallback int) int {
 	}
 	return n
 }
+
+// envByteSize reads a size such as "500M" or "2G" (binary units); a bare number is bytes.
+func envByteSize(key string, fallback int64) int64 {
+	val := strings.ToUpper(strings.TrimSpace(os.Getenv(key)))
+	if val == "" {
+		return fallback
+	}
+	val = strings.TrimSuffix(strings.TrimSuffix(val, "B"), "I")
+	multiplier := int64(1)
+	if n := len(val); n > 0 {
+		switch val[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			val = val[:n-1]
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return int64(n * float64(multiplier))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// tagSourceHeuristic marks tags guessed from the tweet text, the author and the file name.
+// ML re-tagging keeps them; DELETE /api/tags/sources/heuristic purges them.
+const tagSourceHeuristic = "heuristic"
+
+// Confidences of heuristic tags: the author is a fact, a hashtag was chosen by the
+// author, a keyword is only a guess.
+const (
+	heuristicCreatorConfidence = 1.0
+	heuristicHashtagConfidence = 0.9
+	heuristicKeywordConfidence = 0.6
+)
+
+// defaultHeuristicKeywords is used when HEURISTIC_TAG_KEYWORDS is unset.
+const defaultHeuristicKeywords = "wip=wip,sketch=sketch,rkgk=sketch,落書き=sketch,らくがき=sketch," +
+	"fanart=fanart,ファンアート=fanart,commission=commission,skeb=commission," +
+	"comic=comic,manga=comic,漫画=comic,4koma=4koma,4コマ=4koma"
+
+var hashtagRe = regexp.MustCompile(`[#＃]([\p{L}\p{N}_]+)`)
+
+type heuristicKeyword struct {
+	word string
+	tag  string
+	// ascii words match whole words only; others, typically Japanese, match anywhere.
+	ascii bool
+}
+
+// heuristicTagger suggests tags without the ML autotagger: hashtags of the tweet text,
+// the author as a creator tag and configured keywords found in the text or file name.
+type heuristicTagger struct {
+	hashtags      bool
+	creator       bool
+	creatorPrefix string
+	keywords      []heuristicKeyword
+}
+
+// newHeuristicTagger returns nil when HEURISTIC_TAGGER is off.
+func newHeuristicTagger(cfg config) (*heuristicTagger, error) {
+	if !cfg.heuristicTagger {
+		return nil, nil
+	}
+	keywords, err := parseHeuristicKeywords(cfg.heuristicTagKeywords)
+	if err != nil {
+		return nil, err
+	}
+	return &heuristicTagger{
+		hashtags:      cfg.heuristicTagHashtags,
+		creator:       cfg.heuristicTagCreator,
+		creatorPrefix: cfg.creatorTagPrefix,
+		keywords:      keywords,
+	}, nil
+}
+
+// parseHeuristicKeywords reads "word=tag,word=tag". An empty value selects the defaults
+// and "off" disables keyword matching.
+func parseHeuristicKeywords(raw string) ([]heuristicKeyword, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		raw = defaultHeuristicKeywords
+	}
+	if strings.EqualFold(raw, "off") {
+		return nil, nil
+	}
+	var keywords []heuristicKeyword
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		word, tag, ok := strings.Cut(pair, "=")
+		word, tag = strings.ToLower(strings.TrimSpace(word)), strings.TrimSpace(tag)
+		if !ok || word == "" || tag == "" {
+			return nil, fmt.Errorf("invalid HEURISTIC_TAG_KEYWORDS entry %q: want word=tag", pair)
+		}
+		keywords = append(keywords, heuristicKeyword{word: word, tag: tag, ascii: isASCII(word)})
+	}
+	return keywords, nil
+}
+
+func isASCII(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+// suggest returns the tags for a file of username named filename, posted with text.
+func (h *heuristicTagger) suggest(username, filename, text string) map[string]float64 {
+	tags := make(map[string]float64)
+	if h == nil {
+		return tags
+	}
+	if h.creator && username != "" {
+		tags[creatorTagName(h.creatorPrefix, username)] = heuristicCreatorConfidence
+	}
+	if h.hashtags {
+		for _, m := range hashtagRe.FindAllStringSubmatch(text, -1) {
+			tag := strings.ToLower(m[1])
+			if strings.Trim(tag, "0123456789_") == "" {
+				continue
+			}
+			tags[tag] = max(tags[tag], heuristicHashtagConfidence)
+		}
+	}
+	if len(h.keywords) == 0 {
+		return tags
+	}
+	stem := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	haystack := strings.ToLower(text + "\n" + stem)
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(haystack, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[w] = true
+	}
+	for _, k := range h.keywords {
+		if (k.ascii && words[k.word]) || (!k.ascii && strings.Contains(haystack, k.word)) {
+			tags[k.tag] = max(tags[k.tag], heuristicKeywordConfidence)
+		}
+	}
+	return tags
+}
+
+// heuristicTagFile adds the heuristic tags of a downloaded file. It runs whether or not
+// the ML autotagger is configured.
+func (st *appState) heuristicTagFile(relativePath, username, filename, text string) {
+	tags := st.heuristicTagger.suggest(username, filename, text)
+	if len(tags) == 0 {
+		return
+	}
+	if err := st.store.AddTagsWithSource(relativePath, tags, tagSourceHeuristic); err != nil {
+		logger.Warn("failed to save heuristic tags", "filepath", relativePath, "error", err)
+	}
+}
+
+// tagSourceParam maps the source names of the API to the stored values; the ML
+// autotagger's tags are stored with an empty source.
+func tagSourceParam(name string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "autotagger":
+		return "", true
+	case tagSourceManual:
+		return tagSourceManual, true
+	case tagSourceHeuristic:
+		return tagSourceHeuristic, true
+	case tagSourceCreator:
+		return tagSourceCreator, true
+	}
+	return "", false
+}
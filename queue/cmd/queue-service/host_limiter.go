@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpDoer is the subset of *http.Client used by outbound fetches.
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type tokenBucket struct {
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+// hostRateLimiter is a token-bucket limiter keyed by request host. Hosts that answer
+// 429/503 are paused for the advertised Retry-After so every worker backs off together.
+type hostRateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+func newHostRateLimiter(ratePerSecond float64, burst int) *hostRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &hostRateLimiter{rate: ratePerSecond, burst: float64(burst), buckets: make(map[string]*tokenBucket)}
+}
+
+// reserve takes a token for host and returns how long the caller must wait before using it.
+func (l *hostRateLimiter) reserve(host string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[host] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	b.tokens--
+
+	wait := time.Duration(0)
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / l.rate * float64(time.Second))
+	}
+	if pause := b.pausedUntil.Sub(now); pause > wait {
+		wait = pause
+	}
+	return wait
+}
+
+func (l *hostRateLimiter) wait(ctx context.Context, host string) error {
+	if l == nil || l.rate <= 0 {
+		return nil
+	}
+	d := l.reserve(host)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (l *hostRateLimiter) pause(host string, d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: time.Now()}
+		l.buckets[host] = b
+	}
+	if until := time.Now().Add(d); until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+}
+
+// rateLimitedClient applies the per-host limiter and retries 429/503 responses with
+// exponential backoff, honoring Retry-After.
+type rateLimitedClient struct {
+	client      *http.Client
+	limiter     *hostRateLimiter
+	maxAttempts int
+}
+
+func (c *rateLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	host := strings.ToLower(req.URL.Hostname())
+	for attempt := 1; ; attempt++ {
+		if err := c.limiter.wait(ctx, host); err != nil {
+			return nil, err
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, nil
+		}
+		if attempt >= c.maxAttempts {
+			return resp, nil
+		}
+
+		wait := retryAfterDelay(resp.Header.Get("Retry-After"), attempt)
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		c.limiter.pause(host, wait)
+		logger.Warn("host rate limited, backing off",
+			"host", host,
+			"status", resp.StatusCode,
+			"attempt", attempt,
+			"max_attempts", c.maxAttempts,
+			"wait", wait.String(),
+		)
+	}
+}
@@ -1,14 +1,28 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
-func newSharedHTTPClient(timeout time.Duration) *http.Client {
+const defaultUserAgent = "Mozilla/5.0"
+
+// proxyFunc matches http.Transport.Proxy.
+type proxyFunc func(*http.Request) (*url.URL, error)
+
+func newSharedHTTPClient(timeout time.Duration, proxy proxyFunc) *http.Client {
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
 	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
+		Proxy: proxy,
 		DialContext: (&net.Dialer{
 			Timeout:   10 * time.Second,
 			KeepAlive: 30 * time.Second,
@@ -26,3 +40,141 @@ func newSharedHTTPClient(timeout time.Duration) *http.Client {
 		Transport: transport,
 	}
 }
+
+// proxySelector routes outbound media requests through configured proxies.
+// Per-host entries win; otherwise requests rotate round-robin through the pool.
+type proxySelector struct {
+	pool    []*url.URL
+	perHost map[string]*url.URL
+	next    atomic.Uint64
+}
+
+// newProxySelector parses PROXY_URL (comma-separated pool, http/https/socks5) and
+// PROXY_HOSTS ("pbs.twimg.com=socks5://host:1080,x.com=direct"). It returns nil when
+// neither is set so callers fall back to the environment proxy settings.
+func newProxySelector(poolRaw, perHostRaw string) (*proxySelector, error) {
+	sel := &proxySelector{perHost: make(map[string]*url.URL)}
+	for _, raw := range splitCSV(poolRaw) {
+		u, err := parseProxyURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		sel.pool = append(sel.pool, u)
+	}
+	for _, item := range splitCSV(perHostRaw) {
+		host, raw, ok := strings.Cut(item, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid PROXY_HOSTS entry %q", item)
+		}
+		if strings.EqualFold(strings.TrimSpace(raw), "direct") {
+			sel.perHost[host] = nil
+			continue
+		}
+		u, err := parseProxyURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		sel.perHost[host] = u
+	}
+	if len(sel.pool) == 0 && len(sel.perHost) == 0 {
+		return nil, nil
+	}
+	return sel, nil
+}
+
+func parseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q", raw)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+}
+
+func (p *proxySelector) proxy(req *http.Request) (*url.URL, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	for h := host; h != ""; {
+		if u, ok := p.perHost[h]; ok {
+			return u, nil
+		}
+		_, rest, found := strings.Cut(h, ".")
+		if !found {
+			break
+		}
+		h = rest
+	}
+	if len(p.pool) == 0 {
+		return http.ProxyFromEnvironment(req)
+	}
+	i := p.next.Add(1) - 1
+	return p.pool[i%uint64(len(p.pool))], nil
+}
+
+// headerTransport adds the configured User-Agent and extra headers to outbound download
+// requests. With several agents configured it rotates through them per request. Headers
+// already set on a request are left alone.
+type headerTransport struct {
+	base    http.RoundTripper
+	agents  []string
+	headers http.Header
+	next    atomic.Uint64
+}
+
+// newHeaderTransport loads agents from DOWNLOAD_USER_AGENT_FILE (one per line, # comments)
+// or falls back to DOWNLOAD_USER_AGENT, and parses DOWNLOAD_HEADERS as a JSON object.
+func newHeaderTransport(base http.RoundTripper, userAgent, userAgentFile, headersRaw string) (*headerTransport, error) {
+	t := &headerTransport{base: base, headers: make(http.Header)}
+	if userAgentFile != "" {
+		raw, err := os.ReadFile(userAgentFile)
+		if err != nil {
+			return nil, fmt.Errorf("read DOWNLOAD_USER_AGENT_FILE: %w", err)
+		}
+		for _, line := range strings.Split(string(raw), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				t.agents = append(t.agents, line)
+			}
+		}
+		if len(t.agents) == 0 {
+			return nil, fmt.Errorf("DOWNLOAD_USER_AGENT_FILE %s has no user agents", userAgentFile)
+		}
+	} else {
+		if userAgent = strings.TrimSpace(userAgent); userAgent == "" {
+			userAgent = defaultUserAgent
+		}
+		t.agents = []string{userAgent}
+	}
+	if headersRaw = strings.TrimSpace(headersRaw); headersRaw != "" {
+		var extra map[string]string
+		if err := json.Unmarshal([]byte(headersRaw), &extra); err != nil {
+			return nil, fmt.Errorf("invalid DOWNLOAD_HEADERS: %w", err)
+		}
+		for name, value := range extra {
+			if strings.TrimSpace(name) == "" {
+				return nil, fmt.Errorf("invalid DOWNLOAD_HEADERS: empty header name")
+			}
+			t.headers.Set(name, value)
+		}
+	}
+	return t, nil
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(req.Context())
+	if req.Header.Get("User-Agent") == "" {
+		i := t.next.Add(1) - 1
+		req.Header.Set("User-Agent", t.agents[i%uint64(len(t.agents))])
+	}
+	for name, values := range t.headers {
+		if _, ok := req.Header[name]; !ok {
+			req.Header[name] = values
+		}
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	derivativeKindEdit = "edit"
+	maxImageEditOps    = 10
+)
+
+// imageEditOp is one step of POST /api/images/edit. Crop uses X, Y, Width and Height in
+// pixels of the image as it is at that step; rotate turns clockwise by Angle (90, 180 or
+// 270); flip mirrors along Direction (horizontal or vertical); trim crops away solid
+// borders found by detectBorders.
+type imageEditOp struct {
+	Op        string `json:"op"`
+	X         int    `json:"x,omitempty"`
+	Y         int    `json:"y,omitempty"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Angle     int    `json:"angle,omitempty"`
+	Direction string `json:"direction,omitempty"`
+}
+
+func (op imageEditOp) validate() error {
+	switch op.Op {
+	case "crop":
+		if op.X < 0 || op.Y < 0 || op.Width <= 0 || op.Height <= 0 {
+			return errors.New("crop needs x, y >= 0 and width, height > 0")
+		}
+	case "rotate":
+		if op.Angle != 90 && op.Angle != 180 && op.Angle != 270 {
+			return errors.New("rotate angle must be 90, 180 or 270")
+		}
+	case "flip":
+		if op.Direction != "horizontal" && op.Direction != "vertical" {
+			return errors.New("flip direction must be horizontal or vertical")
+		}
+	case "trim":
+	default:
+		return fmt.Errorf("unknown op %q (crop, rotate, flip or trim)", op.Op)
+	}
+	return nil
+}
+
+func (op imageEditOp) String() string {
+	switch op.Op {
+	case "crop":
+		return fmt.Sprintf("crop:%d,%d,%dx%d", op.X, op.Y, op.Width, op.Height)
+	case "rotate":
+		return fmt.Sprintf("rotate:%d", op.Angle)
+	case "trim":
+		return "trim"
+	}
+	return "flip:" + op.Direction
+}
+
+type imageEditRequest struct {
+	Filepath   string        `json:"filepath"`
+	Operations []imageEditOp `json:"operations"`
+}
+
+// handleImagesEdit queues crop/rotate/flip/trim operations on one image. The result is
+// saved as a new file in the original's variant group, so the original is never modified.
+func (st *appState) handleImagesEdit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body imageEditRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepath and operations are required") {
+		return
+	}
+	rel := normalizeFilepath(body.Filepath)
+	if rel == "" || len(body.Operations) == 0 {
+		badRequest(w, "filepath and operations are required")
+		return
+	}
+	if len(body.Operations) > maxImageEditOps {
+		badRequest(w, fmt.Sprintf("too many operations (max %d)", maxImageEditOps))
+		return
+	}
+	for i := range body.Operations {
+		op := &body.Operations[i]
+		op.Op = strings.ToLower(strings.TrimSpace(op.Op))
+		op.Direction = strings.ToLower(strings.TrimSpace(op.Direction))
+		if err := op.validate(); err != nil {
+			badRequest(w, err.Error())
+			return
+		}
+	}
+	fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+	if err != nil {
+		badRequest(w, "invalid filepath")
+		return
+	}
+	if _, err := os.Stat(fullPath); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "Image not found"})
+		return
+	}
+	if isVideoFile(rel) {
+		badRequest(w, "videos cannot be edited")
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := editImageTaskPayload{TaskID: taskID, Filepath: rel, Operations: body.Operations}
+	err = st.enqueueTask(taskTypeEditImage, st.cfg.interactiveQueue, taskID, payload, 5*time.Minute)
+	if err != nil {
+		logger.Error("failed to enqueue edit image task",
+			"task_type", taskTypeEditImage,
+			"task_id", taskID,
+			"filepath", rel,
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(r.Context(), st.redis, taskID, "PENDING", taskMessage(msgEditImageQueued))
+	logger.Info("edit image task queued", "task_id", taskID, "filepath", rel)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success": true,
+		"queued":  true,
+		"task_id": taskID,
+		"message": localize(r.Context(), msgEditImageQueued),
+	})
+}
+
+func (st *appState) processEditImageTask(ctx context.Context, t *asynq.Task) error {
+	var payload editImageTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+	d, err := st.editImage(payload.Filepath, payload.Operations)
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error(), "filepath": payload.Filepath})
+		// Bad input does not get better on retry.
+		return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+	}
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
+		"filepath": d.Filepath,
+		"variant":  d,
+	}, "message", msgEditImageCompleted))
+	return nil
+}
+
+// editImage applies ops to rel and stores the output as "<name>_edited<ext>" (with a
+// counter when that exists), indexed, tagged like the source and linked as its edited
+// variant.
+func (st *appState) editImage(rel string, ops []imageEditOp) (imageDerivative, error) {
+	fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+	if err != nil {
+		return imageDerivative{}, err
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return imageDerivative{}, err
+	}
+	src, format, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return imageDerivative{}, fmt.Errorf("unsupported image: %w", err)
+	}
+	img := toRGBA(src)
+	tools := make([]string, 0, len(ops))
+	for _, op := range ops {
+		if img, err = st.applyImageEdit(img, op); err != nil {
+			return imageDerivative{}, err
+		}
+		tools = append(tools, op.String())
+	}
+
+	// Keep PNG lossless, everything else becomes JPEG.
+	ext := ".jpg"
+	if format == "png" {
+		ext = ".png"
+	}
+	base := strings.TrimSuffix(fullPath, filepath.Ext(fullPath)) + "_edited"
+	outPath := base + ext
+	for n := 2; ; n++ {
+		if _, err := os.Stat(outPath); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		outPath = fmt.Sprintf("%s%d%s", base, n, ext)
+	}
+	partPath := outPath + ".part"
+	out, err := os.Create(partPath)
+	if err != nil {
+		return imageDerivative{}, err
+	}
+	err = encodeImage(out, img, ext)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(partPath, outPath)
+	}
+	if err != nil {
+		_ = os.Remove(partPath)
+		return imageDerivative{}, err
+	}
+
+	outRel := normalizeRelPath(st.cfg.mediaRoot, outPath)
+	hash, err := fileMD5(outPath)
+	if err != nil {
+		return imageDerivative{}, err
+	}
+	info, err := os.Stat(outPath)
+	if err != nil {
+		return imageDerivative{}, err
+	}
+	if err := st.store.MarkImageProcessed(hash); err != nil {
+		return imageDerivative{}, err
+	}
+	if err := st.store.RecordImage(newImageRecord(outRel, hash, info.Size(), info.ModTime().UnixMilli())); err != nil {
+		logger.Warn("failed to index edited image", "filepath", outRel, "error", err)
+	}
+	if _, err := st.store.CopyTags(rel, []string{outRel}, true); err != nil {
+		logger.Warn("failed to copy tags to edited image", "filepath", outRel, "error", err)
+	}
+	d := imageDerivative{
+		Filepath:       outRel,
+		SourceFilepath: rel,
+		Kind:           derivativeKindEdit,
+		Tool:           strings.Join(tools, " "),
+		CreatedAt:      time.Now().UnixMilli(),
+	}
+	if err := st.store.RecordDerivative(d); err != nil {
+		return imageDerivative{}, err
+	}
+	variants := []imageVariant{{Filepath: rel}, {Filepath: outRel, Role: variantRoleEdited}}
+	if _, err := st.store.LinkVariants(variants, ""); err != nil {
+		logger.Warn("failed to link edited variant", "filepath", outRel, "error", err)
+	}
+	logger.Info("image edited", "filepath", rel, "output", outRel, "ops", d.Tool)
+	return d, nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+func (st *appState) applyImageEdit(img *image.RGBA, op imageEditOp) (*image.RGBA, error) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	switch op.Op {
+	case "trim":
+		s := detectBorders(img, st.cfg.borderTolerance)
+		if s == nil {
+			return nil, errors.New("trim found no border")
+		}
+		return toRGBA(img.SubImage(image.Rect(s.X, s.Y, s.X+s.Width, s.Y+s.Height))), nil
+	case "crop":
+		rect := image.Rect(op.X, op.Y, op.X+op.Width, op.Y+op.Height)
+		if !rect.In(img.Bounds()) {
+			return nil, fmt.Errorf("crop %s is outside the %dx%d image", op, w, h)
+		}
+		return toRGBA(img.SubImage(rect)), nil
+	case "rotate":
+		dw, dh := h, w
+		if op.Angle == 180 {
+			dw, dh = w, h
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				var dx, dy int
+				switch op.Angle {
+				case 90:
+					dx, dy = h-1-y, x
+				case 180:
+					dx, dy = w-1-x, h-1-y
+				default:
+					dx, dy = y, w-1-x
+				}
+				dst.SetRGBA(dx, dy, img.RGBAAt(x, y))
+			}
+		}
+		return dst, nil
+	default:
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if op.Direction == "horizontal" {
+					dst.SetRGBA(w-1-x, y, img.RGBAAt(x, y))
+				} else {
+					dst.SetRGBA(x, h-1-y, img.RGBAAt(x, y))
+				}
+			}
+		}
+		return dst, nil
+	}
+}
+
+// encodeImage writes img as PNG for ".png" and as high quality JPEG otherwise.
+func encodeImage(w io.Writer, img image.Image, ext string) error {
+	if ext == ".png" {
+		return png.Encode(w, img)
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 95})
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type imageInfo struct {
+	Path  string
+	MTime int64
+}
+
+// imageFilter holds the filters shared by /api/images and endpoints that act on its results.
+// Negative tag counts and zero times mean the bound is not set. Media is mediaKindVideo,
+// mediaKindImage or empty for both. Color is colorClassMono, colorClassColor or empty, and
+// Palette a named color or "#rrggbb" one of the dominant colors has to match; images that
+// were never analyzed match neither. Favorites and MinRating (0 for unset) select curated
+// images. Tag patterns match substrings unless written as "=tag" (see tagPatternMatches).
+// TagQuery holds the parts of a search query that do not fit Tags and ExcludeTags, such as
+// OR across negations.
+type imageFilter struct {
+	Tags        []string
+	ExcludeTags []string
+	TagQuery    *queryExpr
+	User        string
+	MinTagCount int
+	MaxTagCount int
+	From        time.Time
+	To          time.Time
+	Media       string
+	Color       string
+	Palette     string
+	Favorites   bool
+	MinRating   int
+}
+
+// imageFilterRequest is the JSON form of imageFilter used by POST endpoints.
+type imageFilterRequest struct {
+	Tags        []string `json:"tags"`
+	ExcludeTags []string `json:"exclude_tags"`
+	// ExcludeExactTags only exclude whole tags, unlike the substrings of ExcludeTags.
+	ExcludeExactTags []string `json:"exclude_exact_tags"`
+	User             string   `json:"user"`
+	MinTagCount      *int     `json:"min_tag_count"`
+	MaxTagCount      *int     `json:"max_tag_count"`
+	From             string   `json:"from"`
+	To               string   `json:"to"`
+	Query            string   `json:"q"`
+	Color            string   `json:"color"`
+	Favorites        bool     `json:"favorites"`
+	MinRating        int      `json:"min_rating"`
+}
+
+func parseImageFilter(q url.Values) (imageFilter, error) {
+	f, err := newImageFilter(
+		splitCSV(q.Get("tags")),
+		parseExcludeTags(q),
+		q.Get("user"),
+		parseNonNegativeInt(q.Get("min_tag_count"), -1),
+		parseNonNegativeInt(q.Get("max_tag_count"), -1),
+		q.Get("from"),
+		q.Get("to"),
+		q.Get("q"),
+	)
+	if err != nil {
+		return f, err
+	}
+	if err := f.setRating(parseBoolParam(q.Get("favorites")), parseNonNegativeInt(q.Get("min_rating"), 0)); err != nil {
+		return f, err
+	}
+	return f, f.setColor(q.Get("color"), false)
+}
+
+func (req imageFilterRequest) toFilter() (imageFilter, error) {
+	minTagCount, maxTagCount := -1, -1
+	if req.MinTagCount != nil && *req.MinTagCount >= 0 {
+		minTagCount = *req.MinTagCount
+	}
+	if req.MaxTagCount != nil && *req.MaxTagCount >= 0 {
+		maxTagCount = *req.MaxTagCount
+	}
+	f, err := newImageFilter(trimNonEmpty(req.Tags), append(trimNonEmpty(req.ExcludeTags), exactTagPatterns(req.ExcludeExactTags)...), req.User, minTagCount, maxTagCount, req.From, req.To, req.Query)
+	if err != nil {
+		return f, err
+	}
+	if err := f.setRating(req.Favorites, req.MinRating); err != nil {
+		return f, err
+	}
+	return f, f.setColor(req.Color, false)
+}
+
+func (f *imageFilter) setRating(favorites bool, minRating int) error {
+	if minRating < 0 || minRating > maxImageRating {
+		return fmt.Errorf("min_rating must be between 0 and %d", maxImageRating)
+	}
+	f.Favorites = f.Favorites || favorites
+	f.MinRating = max(f.MinRating, minRating)
+	return nil
+}
+
+// newImageFilter builds a filter from the individual parameters and then narrows it with
+// the search query, so both forms can be combined.
+func newImageFilter(tags, excludeTags []string, user string, minTagCount, maxTagCount int, from, to, query string) (imageFilter, error) {
+	f := imageFilter{
+		Tags:        normalizeTagGroups(tags),
+		ExcludeTags: flattenTagGroups(excludeTags),
+		User:        strings.TrimSpace(user),
+		MinTagCount: minTagCount,
+		MaxTagCount: maxTagCount,
+	}
+	if strings.ContainsAny(f.User, `/\`) {
+		return f, errors.New("invalid user")
+	}
+	var err error
+	if f.From, err = parseDateParam(from, false); err != nil {
+		return f, fmt.Errorf("invalid from: %w", err)
+	}
+	if f.To, err = parseDateParam(to, true); err != nil {
+		return f, fmt.Errorf("invalid to: %w", err)
+	}
+	if err := f.applyQuery(query); err != nil {
+		return f, fmt.Errorf("invalid q: %w", err)
+	}
+	return f, nil
+}
+
+// parseDateParam accepts RFC3339 timestamps or YYYY-MM-DD dates. A bare date used as an
+// upper bound covers the whole day.
+func parseDateParam(raw string, endOfDay bool) (time.Time, error) {
+	val := strings.TrimSpace(raw)
+	if val == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", val)
+	if err != nil {
+		return time.Time{}, errors.New("expected YYYY-MM-DD or RFC3339")
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Millisecond)
+	}
+	return t, nil
+}
+
+// tagGroupAlternatives splits an OR group such as "(cat|dog)" into its patterns.
+func tagGroupAlternatives(term string) []string {
+	term = strings.TrimSpace(term)
+	if strings.HasPrefix(term, "(") && strings.HasSuffix(term, ")") {
+		term = term[1 : len(term)-1]
+	}
+	return trimNonEmpty(strings.Split(term, "|"))
+}
+
+// normalizeTagGroups rewrites required tag terms to the "cat|dog" form the store expects:
+// every term must match, and a term matches when any of its alternatives does.
+func normalizeTagGroups(terms []string) []string {
+	out := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if alts := tagGroupAlternatives(term); len(alts) > 0 {
+			out = append(out, strings.Join(alts, "|"))
+		}
+	}
+	return out
+}
+
+// flattenTagGroups expands OR groups in excluded tags; excluding any of the alternatives
+// is the same as excluding each of them.
+func flattenTagGroups(terms []string) []string {
+	out := make([]string, 0, len(terms))
+	for _, term := range terms {
+		out = append(out, tagGroupAlternatives(term)...)
+	}
+	return out
+}
+
+func trimNonEmpty(values []string) []string {
+	items := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			items = append(items, v)
+		}
+	}
+	return items
+}
+
+// isEmpty reports whether no filter is set, i.e. the filter matches the whole library.
+func (f imageFilter) isEmpty() bool {
+	return len(f.Tags) == 0 && len(f.ExcludeTags) == 0 && f.TagQuery == nil && f.User == "" &&
+		f.From.IsZero() && f.To.IsZero() && f.MinTagCount < 0 && f.MaxTagCount < 0 && f.Media == "" && f.Color == "" && f.Palette == "" &&
+		!f.Favorites && f.MinRating == 0
+}
+
+// needsTags reports whether filtering requires loading tags for every candidate image.
+func (f imageFilter) needsTags() bool {
+	return f.MinTagCount >= 0 || f.MaxTagCount >= 0 || len(f.ExcludeTags) > 0
+}
+
+func (f imageFilter) matchesTime(mtime int64) bool {
+	if !f.From.IsZero() && mtime < f.From.UnixMilli() {
+		return false
+	}
+	if !f.To.IsZero() && mtime > f.To.UnixMilli() {
+		return false
+	}
+	return true
+}
+
+func (f imageFilter) matchesMedia(path string) bool {
+	switch f.Media {
+	case mediaKindVideo:
+		return isVideoFile(path)
+	case mediaKindImage:
+		return !isVideoFile(path)
+	}
+	return true
+}
+
+// signature returns a stable representation of the filter, used to bind confirmations to a query.
+func (f imageFilter) signature() string {
+	from, to := "", ""
+	if !f.From.IsZero() {
+		from = f.From.UTC().Format(time.RFC3339Nano)
+	}
+	if !f.To.IsZero() {
+		to = f.To.UTC().Format(time.RFC3339Nano)
+	}
+	query := ""
+	if f.TagQuery != nil {
+		query = f.TagQuery.String()
+	}
+	return fmt.Sprintf("tags=%s|exclude=%s|query=%s|user=%s|min=%d|max=%d|from=%s|to=%s|media=%s|color=%s|palette=%s|favorites=%t|min_rating=%d",
+		strings.Join(f.Tags, ","), strings.Join(f.ExcludeTags, ","), query, f.User, f.MinTagCount, f.MaxTagCount, from, to, f.Media, f.Color, f.Palette,
+		f.Favorites, f.MinRating)
+}
+
+// findImages resolves the images matching f. The returned tag map is only populated when
+// needsTags is true; otherwise callers load tags for the page they render.
+func (st *appState) findImages(ctx context.Context, f imageFilter) ([]imageInfo, map[string][]imageTag, error) {
+	timing := timingFrom(ctx)
+	// A tag query yields the files it matches, or with complement those it does not.
+	var queryPaths map[string]struct{}
+	queryComplement := false
+	if f.TagQuery != nil {
+		start := time.Now()
+		paths, complement, err := st.store.FindFilesByTagQuery(f.TagQuery)
+		timing.since("sqlite", start)
+		if err != nil {
+			return nil, nil, err
+		}
+		queryPaths = make(map[string]struct{}, len(paths))
+		for _, p := range paths {
+			queryPaths[p] = struct{}{}
+		}
+		queryComplement = complement
+	}
+	candidates := make([]string, 0)
+	if len(f.Tags) > 0 || (queryPaths != nil && !queryComplement) {
+		var paths []string
+		if len(f.Tags) > 0 {
+			start := time.Now()
+			var err error
+			paths, err = st.store.FindFilesByTagPatterns(f.Tags)
+			timing.since("sqlite", start)
+			if err != nil {
+				return nil, nil, err
+			}
+		} else {
+			paths = make([]string, 0, len(queryPaths))
+			for p := range queryPaths {
+				paths = append(paths, p)
+			}
+		}
+		userPrefix := ""
+		if f.User != "" {
+			userPrefix = f.User + "/"
+		}
+		for _, p := range paths {
+			if userPrefix != "" && !strings.HasPrefix(p, userPrefix) {
+				continue
+			}
+			candidates = append(candidates, filepath.Join(st.cfg.mediaRoot, filepath.FromSlash(p)))
+		}
+	} else {
+		root := st.cfg.mediaRoot
+		if f.User != "" {
+			userPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, f.User)
+			if err != nil {
+				return []imageInfo{}, map[string][]imageTag{}, nil
+			}
+			root = userPath
+		}
+		start := time.Now()
+		files, err := listImageFiles(root)
+		timing.since("fs", start)
+		if err != nil {
+			return nil, nil, err
+		}
+		candidates = files
+	}
+
+	// Stat calls dominate on large libraries, so they run on a bounded pool.
+	scanCtx, cancel := st.scanContext(ctx)
+	defer cancel()
+	infos := make([]imageInfo, len(candidates))
+	statStart := time.Now()
+	err := parallelEach(scanCtx, len(candidates), st.cfg.fsScanWorkers, func(i int) {
+		if !f.matchesMedia(candidates[i]) {
+			return
+		}
+		info, err := os.Stat(candidates[i])
+		if err != nil {
+			return
+		}
+		mtime := info.ModTime().UnixMilli()
+		if !f.matchesTime(mtime) {
+			return
+		}
+		infos[i] = imageInfo{Path: normalizeRelPath(st.cfg.mediaRoot, candidates[i]), MTime: mtime}
+	})
+	timing.since("fs", statStart)
+	if err != nil {
+		return nil, nil, scanError(err)
+	}
+	allImages := make([]imageInfo, 0, len(infos))
+	for _, info := range infos {
+		if info.Path == "" {
+			continue
+		}
+		if queryPaths != nil {
+			if _, ok := queryPaths[info.Path]; ok == queryComplement {
+				continue
+			}
+		}
+		allImages = append(allImages, info)
+	}
+	return st.refineImages(ctx, f, allImages)
+}
+
+// refineImages applies the filters that need per-image records beyond path and mtime: colors,
+// ratings and the tag conditions. Tags are returned when a filter had to load them.
+func (st *appState) refineImages(ctx context.Context, f imageFilter, allImages []imageInfo) ([]imageInfo, map[string][]imageTag, error) {
+	timing := timingFrom(ctx)
+	var err error
+	if f.Color != "" {
+		if allImages, err = st.filterByColor(ctx, allImages, f.Color); err != nil {
+			return nil, nil, err
+		}
+	}
+	if f.Palette != "" {
+		if allImages, err = st.filterByPalette(ctx, allImages, f.Palette); err != nil {
+			return nil, nil, err
+		}
+	}
+	if f.Favorites || f.MinRating > 0 {
+		if allImages, err = st.filterByRating(ctx, allImages, f.Favorites, f.MinRating); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	allTagsMap := map[string][]imageTag{}
+	if !f.needsTags() {
+		return allImages, allTagsMap, nil
+	}
+
+	paths := make([]string, 0, len(allImages))
+	for _, img := range allImages {
+		paths = append(paths, img.Path)
+	}
+	tagsStart := time.Now()
+	tagsMap, err := st.store.GetTagsForFiles(paths)
+	timing.since("sqlite", tagsStart)
+	if err != nil {
+		return nil, nil, err
+	}
+	allTagsMap = tagsMap
+
+	filtered := make([]imageInfo, 0, len(allImages))
+	for _, img := range allImages {
+		tagsForImage := tagsMap[img.Path]
+		if hasTagPattern(tagsForImage, f.ExcludeTags) {
+			continue
+		}
+		tagCount := len(tagsForImage)
+		if f.MinTagCount >= 0 && tagCount < f.MinTagCount {
+			continue
+		}
+		if f.MaxTagCount >= 0 && tagCount > f.MaxTagCount {
+			continue
+		}
+		filtered = append(filtered, img)
+	}
+	return filtered, allTagsMap, nil
+}
+
+// filterByRating keeps the favorites and/or the images rated at least minRating stars.
+func (st *appState) filterByRating(ctx context.Context, images []imageInfo, favorites bool, minRating int) ([]imageInfo, error) {
+	paths := make([]string, 0, len(images))
+	for _, img := range images {
+		paths = append(paths, img.Path)
+	}
+	start := time.Now()
+	ratings, err := st.store.GetImageRatings(paths)
+	timingFrom(ctx).since("sqlite", start)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]imageInfo, 0, len(images))
+	for _, img := range images {
+		r := ratings[img.Path]
+		if favorites && !r.Favorite || r.Rating < minRating {
+			continue
+		}
+		filtered = append(filtered, img)
+	}
+	return filtered, nil
+}
+
+// filterByColor keeps the images whose recorded colorfulness falls into class.
+func (st *appState) filterByColor(ctx context.Context, images []imageInfo, class string) ([]imageInfo, error) {
+	paths := make([]string, 0, len(images))
+	for _, img := range images {
+		paths = append(paths, img.Path)
+	}
+	start := time.Now()
+	scores, err := st.store.GetColorfulness(paths)
+	timingFrom(ctx).since("sqlite", start)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]imageInfo, 0, len(images))
+	for _, img := range images {
+		if score, ok := scores[img.Path]; ok && st.colorClass(score) == class {
+			filtered = append(filtered, img)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const inboxDefaultPerPage = 100
+
+// handleInbox lists downloaded files that have not been reviewed yet, newest first.
+func (st *appState) handleInbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	page := parsePositiveInt(q.Get("page"), 1)
+	perPage := parsePositiveInt(q.Get("per_page"), inboxDefaultPerPage)
+	entries, total, err := st.store.ListInbox((page-1)*perPage, perPage)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	paths := make([]string, 0, len(entries))
+	for _, e := range entries {
+		paths = append(paths, e.Filepath)
+	}
+	tagsMap, err := st.store.GetTagsForFiles(paths)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	items := make([]map[string]any, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, map[string]any{
+			"path":       e.Filepath,
+			"media_type": mediaTypeFromPath(e.Filepath),
+			"tags":       tagsMap[e.Filepath],
+			"added_at":   e.AddedAt,
+		})
+	}
+	writePaginatedResponse(w, items, total, perPage, page, false, 0)
+}
+
+type inboxArchiveRequest struct {
+	Filepaths []string `json:"filepaths"`
+	All       bool     `json:"all"`
+}
+
+// handleInboxArchive accepts reviewed files, keeping them but dropping the inbox flag.
+func (st *appState) handleInboxArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body inboxArchiveRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepaths or all is required") {
+		return
+	}
+	filepaths := normalizeUniqueFilepaths(body.Filepaths)
+	if len(filepaths) == 0 && !body.All {
+		badRequest(w, "filepaths or all is required")
+		return
+	}
+	archived, err := st.store.ArchiveInbox(filepaths, body.All)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "archived_count": archived})
+}
+
+// handleInboxTrash deletes reviewed files through the bulk delete task, which also
+// removes them from the inbox.
+func (st *appState) handleInboxTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body filepathsRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepaths is required") {
+		return
+	}
+	filepaths := normalizeUniqueFilepaths(body.Filepaths)
+	if len(filepaths) == 0 {
+		badRequest(w, "filepaths is required")
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := deleteImagesTaskPayload{TaskID: taskID, Filepaths: filepaths}
+	err := st.enqueueTask(taskTypeDeleteImages, st.cfg.interactiveQueue, taskID, payload, 30*time.Minute)
+	if err != nil {
+		logger.Error("failed to enqueue inbox trash task",
+			"task_type", taskTypeDeleteImages,
+			"task_id", taskID,
+			"count", len(filepaths),
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(r.Context(), st.redis, taskID, "PENDING", withMessage(map[string]any{
+		"total": len(filepaths),
+	}, "message", msgInboxTrashCount, len(filepaths)))
+	logger.Info("inbox trash task queued", "task_id", taskID, "count", len(filepaths))
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success":      true,
+		"queued":       true,
+		"task_id":      taskID,
+		"queued_count": len(filepaths),
+		"message":      localize(r.Context(), msgInboxTrashQueued),
+	})
+}
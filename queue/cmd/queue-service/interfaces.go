@@ -12,12 +12,27 @@ import (
 type RedisClient interface {
 	Ping(ctx context.Context) *redis.StatusCmd
 	Get(ctx context.Context, key string) *redis.StringCmd
+	GetDel(ctx context.Context, key string) *redis.StringCmd
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
 	LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd
 	LTrim(ctx context.Context, key string, start, stop int64) *redis.StatusCmd
 	RPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	LPop(ctx context.Context, key string) *redis.StringCmd
 	HGet(ctx context.Context, key, field string) *redis.StringCmd
 	HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	HSetNX(ctx context.Context, key, field string, value interface{}) *redis.BoolCmd
+	HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd
+	HGetAll(ctx context.Context, key string) *redis.MapStringStringCmd
+	SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SMembers(ctx context.Context, key string) *redis.StringSliceCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+	TxPipeline() redis.Pipeliner
+	Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
 	Close() error
 }
 
@@ -30,6 +45,10 @@ type AsynqClient interface {
 // QueueInspector abstracts queue info inspection.
 type QueueInspector interface {
 	GetQueueInfo(queue string) (*asynq.QueueInfo, error)
+	GetTaskInfo(queue, id string) (*asynq.TaskInfo, error)
+	ListArchivedTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	DeleteTask(queue, id string) error
+	CancelProcessing(id string) error
 	Close() error
 }
 
@@ -38,19 +57,114 @@ type TagStore interface {
 	Close() error
 	IsImageProcessed(hash string) (bool, error)
 	MarkImageProcessed(hash string) error
+	ClaimImageHash(hash string) (bool, error)
 	AddTags(filepath string, tags map[string]float64) error
+	AddTagsWithSource(filepath string, tags map[string]float64, source string) error
+	DeleteTagsBySource(source string) (int, error)
 	DeleteAllTags() error
 	ClearProcessedImages() error
 	GetAllTaggedFilepaths() (map[string]struct{}, error)
-	GetAllProcessedHashes() ([]string, error)
 	DeleteProcessedHashes(hashes []string) (int, error)
 	GetTagsForFiles(filepaths []string) (map[string][]imageTag, error)
+	ListTaggedFilepaths(after string, limit int) ([]string, error)
 	GetAllTags() ([]map[string]any, error)
+	GetAllTagsBySource(source string) ([]map[string]any, error)
 	FindFilesByTagPatterns(tags []string) ([]string, error)
+	FindFilesByTagQuery(expr *queryExpr) ([]string, bool, error)
 	FindFilesByExactTag(tag string) ([]string, error)
+	GetTagConfidences(tag string) ([]float64, error)
 	DeleteTag(tag string) (int, error)
 	DeleteTagsForFile(filepathVal string) error
+	DeleteAutotagsForFile(filepathVal string) error
+	AddManualTags(filepathVal string, tags []string) ([]string, error)
+	RemoveTags(filepathVal string, tags []string) (int, error)
 	DeleteTagsForUser(username string) error
+	NormalizeAllTags() (int, int, error)
+	CopyTags(source string, targets []string, merge bool) (int, error)
+	RecordImage(rec imageRecord) error
+	DeleteImageRecord(filepathVal string) error
+	DeleteUserImages(username string) error
+	ResetImageIndexStaging() error
+	StageImageRecords(records []imageRecord) error
+	PruneUnstagedHashes(since int64) (removed, total int, err error)
+	PruneUnstagedTags(since int64) (int, error)
+	PromoteImageIndexStaging(since int64) (int, error)
+	GetImageRecords(filepaths []string) (map[string]imageRecord, error)
+	ListImageHashes(user, after string, offset, limit int) ([]imageHashEntry, int, error)
+	FindImagesByHashes(hashes []string) (map[string][]string, error)
+	FilterProcessedHashes(hashes []string) (map[string]bool, error)
+	ListDuplicateImages() ([]imageRecord, error)
+	ImageIndexUsage() (int, int64, error)
+	ListTweetImagePaths() ([]imageRecord, error)
+	ListImageMTimes(username string, from, to int64) ([]int64, error)
+	ListImagesBefore(username string, before *imageInfo, limit int) ([]imageInfo, error)
+	ImageIndexBuiltAt() (time.Time, error)
+	ListUserStats() ([]userStats, error)
+	ListWatchlist() ([]watchEntry, error)
+	GetWatch(username string) (watchEntry, bool, error)
+	SaveWatch(e watchEntry) error
+	AddWatchIfMissing(e watchEntry) (bool, error)
+	DeleteWatch(username string) (bool, error)
+	UpdateWatchProgress(username, lastSeen string, checkedAt time.Time) error
+	RecordWatchBackoff(username string, until time.Time, count int) error
+	SaveTweetMeta(m tweetMeta) error
+	GetTweetMetas(tweetIDs []string) (map[string]tweetMeta, error)
+	RecordDerivative(d imageDerivative) error
+	GetDerivative(filepathVal string) (imageDerivative, bool, error)
+	FindDerivatives(source, kind string) ([]imageDerivative, error)
+	LinkVariants(members []imageVariant, preferred string) (string, error)
+	GetVariantGroup(filepathVal string) ([]imageVariant, error)
+	GetVariantsForFiles(filepaths []string) (map[string]imageVariant, error)
+	UnlinkVariant(filepathVal string) (bool, error)
+	RecordImageSource(filepathVal, sourceURL string) error
+	ListImageSources(prefix string) ([]imageSource, error)
+	RecordPerceptualHash(filepathVal, contentHash string, phash uint64) error
+	FindSimilarImage(phash uint64, maxDistance int) (string, int, bool, error)
+	ListPerceptualHashes() (map[string]uint64, error)
+	RecordCropSuggestion(filepathVal, contentHash string, c *cropSuggestion) error
+	GetCropSuggestions(filepaths []string) (map[string]cropSuggestion, error)
+	RecordColorfulness(filepathVal, contentHash string, score float64) error
+	GetColorfulness(filepaths []string) (map[string]float64, error)
+	RecordDominantColors(filepathVal, contentHash string, colors []dominantColor) error
+	GetDominantColors(filepaths []string) (map[string][]dominantColor, error)
+	RenameImagePath(oldPath, newPath string) error
+	GetSettings() (map[string]string, error)
+	SaveSettings(values map[string]string, overwrite bool) error
+	ListSubscriptions() ([]tagSubscription, error)
+	SaveSubscription(tag, webhookURL string) (tagSubscription, error)
+	DeleteSubscription(tag string) (bool, error)
+	RecordSubscriptionUpdates(filepathVal string) ([]subscriptionUpdate, error)
+	ListSubscriptionUpdates(sinceID int64, tag string, limit int) ([]subscriptionUpdate, error)
+	AddToInbox(filepathVal string) error
+	ListInbox(offset, limit int) ([]inboxEntry, int, error)
+	CountInbox() (int, error)
+	ArchiveInbox(filepaths []string, all bool) (int, error)
+	ListTagAliases() ([]tagAlias, error)
+	SaveTagAlias(alias, tag string) (tagAlias, error)
+	MergeTagAlias(alias, tag string) (tagAlias, error)
+	DeleteTagAlias(alias string) (bool, error)
+	ListTagCategories() ([]tagCategory, error)
+	SaveTagCategory(name, color string) (tagCategory, error)
+	DeleteTagCategory(name string) (bool, error)
+	AddImageAccess(deltas map[string]imageAccess) error
+	GetImageAccess(filepaths []string) (map[string]imageAccess, error)
+	TopImageAccess(username string, limit int) ([]imageAccess, error)
+	TopUserAccess(limit int) ([]userAccess, error)
+	SetImageRating(filepathVal string, favorite *bool, rating *int) (imageRating, error)
+	GetImageRatings(filepaths []string) (map[string]imageRating, error)
+	ListCollections() ([]collection, error)
+	GetCollection(id int64) (collection, bool, error)
+	SaveCollection(c collection) (collection, error)
+	DeleteCollection(id int64) (bool, error)
+	ListCollectionItems(id int64, offset, limit int) ([]string, int, error)
+	AddCollectionItems(id int64, filepaths []string, position int) (int, error)
+	ReplaceCollectionItems(id int64, filepaths []string) error
+	RemoveCollectionItems(id int64, filepaths []string) (int, error)
+	CreateShareLink(l shareLink) error
+	ListShareLinks() ([]shareLink, error)
+	GetShareLink(id string) (shareLink, bool, error)
+	RevokeShareLink(id string) (bool, error)
+	RecordShareAccess(id string) error
 }
 
 var _ RedisClient = (*redis.Client)(nil)
@@ -9,14 +9,19 @@ import (
 	"time"
 
 	"github.com/hibiken/asynq"
-	"github.com/redis/go-redis/v9"
 )
 
 func main() {
 	mode := flag.String("mode", "all", "run mode: all|api|worker")
+	selftest := flag.Bool("selftest", false, "check config, Redis, store, media root and the syndication API, print a JSON report and exit")
+	selftestTweet := flag.String("selftest-tweet", selftestDefaultTweet, "tweet ID fetched by -selftest")
+	selftestTagger := flag.Bool("selftest-tagger", false, "also probe the autotagger in -selftest")
 	flag.Parse()
 
 	cfg := loadConfig()
+	if *selftest {
+		os.Exit(runSelftest(cfg, selftestOptions{TweetID: *selftestTweet, Tagger: *selftestTagger}))
+	}
 	st, err := newAppState(cfg)
 	if err != nil {
 		logger.Error("failed to initialize app state", "error", err)
@@ -43,17 +48,105 @@ func main() {
 
 func loadConfig() config {
 	return config{
-		redisAddr:        envOrDefault("REDIS_ADDR", "redis:6379"),
-		redisPassword:    os.Getenv("REDIS_PASSWORD"),
-		redisDB:          envInt("REDIS_DB", 0),
-		queueName:        envOrDefault("ASYNQ_QUEUE", "default"),
-		interactiveQueue: envOrDefault("ASYNQ_INTERACTIVE_QUEUE", "interactive"),
-		mediaRoot:        envOrDefault("MEDIA_ROOT", "/app/downloaded_images"),
-		dbPath:           envOrDefault("TAGS_DB_PATH", "/app/tags.db"),
-		autotaggerURL:    os.Getenv("AUTOTAGGER_URL"),
-		autotaggerEnable: strings.EqualFold(envOrDefault("AUTOTAGGER", "false"), "true"),
-		concurrency:      envInt("ASYNQ_CONCURRENCY", 20),
-		apiAddr:          envOrDefault("QUEUE_API_ADDR", ":8001"),
+		redisAddr:                 envOrDefault("REDIS_ADDR", "redis:6379"),
+		redisPassword:             os.Getenv("REDIS_PASSWORD"),
+		redisDB:                   envInt("REDIS_DB", 0),
+		redisUsername:             os.Getenv("REDIS_USERNAME"),
+		redisSentinelAddrs:        os.Getenv("REDIS_SENTINEL_ADDRS"),
+		redisMasterName:           strings.TrimSpace(os.Getenv("REDIS_MASTER_NAME")),
+		redisSentinelUsername:     os.Getenv("REDIS_SENTINEL_USERNAME"),
+		redisSentinelPassword:     os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		redisClusterAddrs:         os.Getenv("REDIS_CLUSTER_ADDRS"),
+		redisTLS:                  strings.EqualFold(envOrDefault("REDIS_TLS", "false"), "true"),
+		redisTLSCAFile:            strings.TrimSpace(os.Getenv("REDIS_TLS_CA_FILE")),
+		redisTLSCertFile:          strings.TrimSpace(os.Getenv("REDIS_TLS_CERT_FILE")),
+		redisTLSKeyFile:           strings.TrimSpace(os.Getenv("REDIS_TLS_KEY_FILE")),
+		redisTLSServerName:        strings.TrimSpace(os.Getenv("REDIS_TLS_SERVER_NAME")),
+		redisTLSInsecure:          strings.EqualFold(envOrDefault("REDIS_TLS_INSECURE_SKIP_VERIFY", "false"), "true"),
+		queueName:                 envOrDefault("ASYNQ_QUEUE", "default"),
+		interactiveQueue:          envOrDefault("ASYNQ_INTERACTIVE_QUEUE", "interactive"),
+		mediaRoot:                 envOrDefault("MEDIA_ROOT", "/app/downloaded_images"),
+		dbPath:                    envOrDefault("TAGS_DB_PATH", "/app/tags.db"),
+		autotaggerURL:             os.Getenv("AUTOTAGGER_URL"),
+		autotaggerEnable:          strings.EqualFold(envOrDefault("AUTOTAGGER", "false"), "true"),
+		heuristicTagger:           strings.EqualFold(envOrDefault("HEURISTIC_TAGGER", "false"), "true"),
+		heuristicTagHashtags:      strings.EqualFold(envOrDefault("HEURISTIC_TAG_HASHTAGS", "true"), "true"),
+		heuristicTagCreator:       strings.EqualFold(envOrDefault("HEURISTIC_TAG_CREATOR", "true"), "true"),
+		heuristicTagKeywords:      os.Getenv("HEURISTIC_TAG_KEYWORDS"),
+		creatorTag:                strings.EqualFold(envOrDefault("CREATOR_TAG", "false"), "true"),
+		creatorTagPrefix:          strings.ToLower(strings.TrimSpace(envOrDefault("CREATOR_TAG_PREFIX", "artist"))),
+		concurrency:               envInt("ASYNQ_CONCURRENCY", 20),
+		apiAddr:                   envOrDefault("QUEUE_API_ADDR", ":8001"),
+		slowQueryMs:               envInt("SLOW_QUERY_MS", 200),
+		xAuthToken:                strings.TrimSpace(os.Getenv("X_AUTH_TOKEN")),
+		xCT0:                      strings.TrimSpace(os.Getenv("X_CT0")),
+		xCookieFile:               strings.TrimSpace(os.Getenv("X_COOKIE_FILE")),
+		xGraphQLQueryID:           envOrDefault("X_GRAPHQL_TWEET_QUERY_ID", "Vg2Akr5FzUmF0sTplA5k6g"),
+		xGraphQLUserQueryID:       envOrDefault("X_GRAPHQL_USER_QUERY_ID", "xmU6X_CKVnQ5lSrCbAmJsg"),
+		xGraphQLUserMediaQueryID:  envOrDefault("X_GRAPHQL_USER_MEDIA_QUERY_ID", "MOLbHrtk8Ovu7DUNOLcXiA"),
+		tweetFallbacks:            envOrDefault("TWEET_FALLBACKS", "fxtwitter,vxtwitter"),
+		tagCase:                   envOrDefault("TAG_CASE", "lower"),
+		tagSeparator:              envOrDefault("TAG_SEPARATOR", "underscore"),
+		proxyURL:                  os.Getenv("PROXY_URL"),
+		proxyHosts:                os.Getenv("PROXY_HOSTS"),
+		downloadUserAgent:         envOrDefault("DOWNLOAD_USER_AGENT", defaultUserAgent),
+		downloadUserAgentFile:     strings.TrimSpace(os.Getenv("DOWNLOAD_USER_AGENT_FILE")),
+		downloadHeaders:           os.Getenv("DOWNLOAD_HEADERS"),
+		hostRateLimit:             envFloat("DOWNLOAD_HOST_RPS", 5),
+		hostRateBurst:             envInt("DOWNLOAD_HOST_BURST", 10),
+		downloadRateLimit:         envByteSize("DOWNLOAD_RATE_LIMIT", 0),
+		downloadTaskRateLimit:     envByteSize("DOWNLOAD_TASK_RATE_LIMIT", 0),
+		downloadMaxRetry:          envInt("DOWNLOAD_MAX_RETRY", 0),
+		downloadRetryDelay:        time.Duration(envInt("DOWNLOAD_RETRY_DELAY", 30)) * time.Second,
+		fsScanWorkers:             envInt("FS_SCAN_WORKERS", 8),
+		fsScanTimeout:             time.Duration(envInt("FS_SCAN_TIMEOUT", 10)) * time.Second,
+		watchlistIntervalMinutes:  envInt("WATCHLIST_INTERVAL_MINUTES", 60),
+		watchlistJitterPercent:    envInt("WATCHLIST_JITTER_PERCENT", 10),
+		watchlistBackoffBase:      time.Duration(envInt("WATCHLIST_BACKOFF_MINUTES", 15)) * time.Minute,
+		watchlistBackoffMax:       time.Duration(envInt("WATCHLIST_BACKOFF_MAX_MINUTES", 360)) * time.Minute,
+		taskConflictPolicy:        envOrDefault("TASK_CONFLICT_POLICY", "reject"),
+		serverTiming:              strings.EqualFold(envOrDefault("SERVER_TIMING", "false"), "true"),
+		progressInterval:          time.Duration(envInt("TASK_PROGRESS_INTERVAL_MS", 500)) * time.Millisecond,
+		taskStaleAfter:            time.Duration(envInt("TASK_STALE_AFTER_MINUTES", 15)) * time.Minute,
+		taskRetention:             time.Duration(envInt("TASK_RETENTION_MINUTES", 0)) * time.Minute,
+		taskArchiveMax:            envInt("TASK_ARCHIVE_MAX", 0),
+		taskArchiveMaxAge:         time.Duration(envInt("TASK_ARCHIVE_MAX_AGE_HOURS", 0)) * time.Hour,
+		accessFlushInterval:       time.Duration(envInt("ACCESS_FLUSH_SECONDS", 10)) * time.Second,
+		shareSecret:               os.Getenv("SHARE_SECRET"),
+		taskPayloadCodec:          strings.ToLower(strings.TrimSpace(os.Getenv("TASK_PAYLOAD_CODEC"))),
+		taskPayloadKey:            os.Getenv("TASK_PAYLOAD_KEY"),
+		taskPayloadPreviousKeys:   os.Getenv("TASK_PAYLOAD_PREVIOUS_KEYS"),
+		shareDefaultHours:         envInt("SHARE_DEFAULT_HOURS", 168),
+		publicAPIAddr:             strings.TrimSpace(os.Getenv("PUBLIC_API_ADDR")),
+		publicEndpoints:           envOrDefault("PUBLIC_ENDPOINTS", "images,tags,media"),
+		publicNSFWVisible:         strings.EqualFold(envOrDefault("PUBLIC_NSFW_VISIBLE", "false"), "true"),
+		upscalerURL:               strings.TrimSpace(os.Getenv("UPSCALER_URL")),
+		upscalerScale:             envInt("UPSCALER_SCALE", 4),
+		phashDedupDistance:        envInt("PHASH_DEDUP_DISTANCE", -1),
+		borderDetect:              strings.EqualFold(envOrDefault("BORDER_DETECT", "false"), "true"),
+		borderTolerance:           envInt("BORDER_DETECT_TOLERANCE", 16),
+		colorAnalysis:             strings.EqualFold(envOrDefault("COLOR_ANALYSIS", "true"), "true"),
+		colorMonoThreshold:        envFloat("COLOR_MONO_THRESHOLD", 10),
+		mediaMaxFileSize:          envByteSize("MEDIA_MAX_FILE_SIZE", 0),
+		mediaRootQuota:            envByteSize("MEDIA_ROOT_QUOTA", 0),
+		archiveMaxBytes:           envByteSize("ARCHIVE_MAX_BYTES", 2<<30),
+		archiveMaxEntries:         envInt("ARCHIVE_MAX_ENTRIES", 1000),
+		publicBaseURL:             strings.TrimSpace(os.Getenv("PUBLIC_BASE_URL")),
+		wsAllowedOrigins:          strings.TrimSpace(os.Getenv("WS_ALLOWED_ORIGINS")),
+		downloadMediaConcurrency:  envInt("DOWNLOAD_MEDIA_CONCURRENCY", 4),
+		downloadPrecheckMin:       envInt("DOWNLOAD_PRECHECK_MIN", 5),
+		defaultSort:               envOrDefault("DEFAULT_SORT", "latest"),
+		defaultPerPage:            envInt("DEFAULT_PER_PAGE", 100),
+		nsfwVisible:               !strings.EqualFold(envOrDefault("NSFW_VISIBLE", "true"), "false"),
+		thumbnailSize:             envInt("THUMBNAIL_SIZE", 150),
+		profileMedia:              strings.EqualFold(envOrDefault("PROFILE_MEDIA", "false"), "true"),
+		externalDownloader:        strings.TrimSpace(os.Getenv("EXTERNAL_DOWNLOADER")),
+		externalDownloaderPath:    strings.TrimSpace(os.Getenv("EXTERNAL_DOWNLOADER_PATH")),
+		externalDownloaderArgs:    os.Getenv("EXTERNAL_DOWNLOADER_ARGS"),
+		externalDownloaderMode:    strings.ToLower(envOrDefault("EXTERNAL_DOWNLOADER_MODE", "fallback")),
+		externalDownloaderTimeout: time.Duration(envInt("EXTERNAL_DOWNLOADER_TIMEOUT", 600)) * time.Second,
+		mirrorRoot:                strings.TrimSpace(os.Getenv("MIRROR_ROOT")),
+		mirrorMode:                strings.ToLower(envOrDefault("MIRROR_MODE", "copy")),
 	}
 }
 
@@ -61,81 +154,254 @@ func newAppState(cfg config) (*appState, error) {
 	if err := os.MkdirAll(cfg.mediaRoot, 0o755); err != nil {
 		return nil, err
 	}
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     cfg.redisAddr,
-		Password: cfg.redisPassword,
-		DB:       cfg.redisDB,
-	})
+	redisOpt, err := redisConnOpt(cfg)
+	if err != nil {
+		return nil, err
+	}
+	rdb := newRedisClient(redisOpt)
 	if err := rdb.Ping(context.Background()).Err(); err != nil {
 		return nil, err
 	}
 
-	store, err := openStore(cfg.dbPath)
+	proxies, err := newProxySelector(cfg.proxyURL, cfg.proxyHosts)
+	if err != nil {
+		return nil, err
+	}
+	var downloadProxy proxyFunc
+	if proxies != nil {
+		downloadProxy = proxies.proxy
+		logger.Info("download proxy configured", "pool_size", len(proxies.pool), "per_host", len(proxies.perHost))
+	}
+
+	xAuth, err := loadXAuthSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if xAuth != nil {
+		logger.Info("authenticated x session configured")
+	}
+
+	store, err := openStore(cfg.dbPath, storeOptions{
+		slowQueryThreshold: time.Duration(cfg.slowQueryMs) * time.Millisecond,
+		tagPolicy:          parseTagPolicy(cfg.tagCase, cfg.tagSeparator),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := seedSettings(store, cfg); err != nil {
+		return nil, err
+	}
+	shareKey, err := loadShareKey(store, cfg)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := newPayloadCodec(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if codec.Name() != "none" {
+		logger.Info("task payload encryption enabled", "codec", codec.Name())
+	}
+	if err := validateCreatorTagPrefix(cfg.creatorTagPrefix); err != nil {
+		return nil, err
+	}
+	heuristic, err := newHeuristicTagger(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	redisOpt := asynq.RedisClientOpt{Addr: cfg.redisAddr, Password: cfg.redisPassword, DB: cfg.redisDB}
+	downloadHTTPClient := newSharedHTTPClient(30*time.Second, downloadProxy)
+	headers, err := newHeaderTransport(downloadHTTPClient.Transport, cfg.downloadUserAgent, cfg.downloadUserAgentFile, cfg.downloadHeaders)
+	if err != nil {
+		return nil, err
+	}
+	downloadHTTPClient.Transport = headers
+	if len(headers.agents) > 1 || len(headers.headers) > 0 {
+		logger.Info("download request headers configured", "user_agents", len(headers.agents), "extra_headers", len(headers.headers))
+	}
 	return &appState{
 		cfg:                cfg,
 		redis:              rdb,
 		asynqCli:           asynq.NewClient(redisOpt),
 		store:              store,
 		inspector:          asynq.NewInspector(redisOpt),
-		downloadHTTPClient: newSharedHTTPClient(30 * time.Second),
-		autotagHTTPClient:  newSharedHTTPClient(60 * time.Second),
+		downloadHTTPClient: downloadHTTPClient,
+		mediaClient: &rateLimitedClient{
+			client:      downloadHTTPClient,
+			limiter:     newHostRateLimiter(cfg.hostRateLimit, cfg.hostRateBurst),
+			maxAttempts: 4,
+		},
+		downloadRateLimiter: newByteRateLimiter(cfg.downloadRateLimit),
+		autotagHTTPClient:   newSharedHTTPClient(60*time.Second, nil),
+		upscaleHTTPClient:   newSharedHTTPClient(10*time.Minute, nil),
+		webhookHTTPClient:   newSharedHTTPClient(subscriptionWebhookTimeout, nil),
+		storeMetrics:        store.metrics,
+		xAuth:               xAuth,
+		tweetBackends:       parseTweetFallbacks(cfg.tweetFallbacks),
+		conflictPolicies:    parseConflictPolicies(cfg.taskConflictPolicy),
+		backendHealth:       newBackendHealthTracker(rdb),
+		access:              newAccessCounter(cfg.accessFlushInterval),
+		shareKey:            shareKey,
+		payloadCodec:        codec,
+		heuristicTagger:     heuristic,
 	}, nil
 }
 
 func runAPI(st *appState) {
-	mux := http.NewServeMux()
+	go st.access.run(st.store, st.cfg.accessFlushInterval)
+	if st.cfg.publicAPIAddr != "" {
+		go runPublicAPI(st)
+	}
+	mux := newAPIMux()
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 	})
-	mux.HandleFunc("/api/download", st.handleDownload)
+	mux.HandleFunc("/metrics", st.handleMetrics)
+	mux.HandleFunc("/media/", st.handleMedia)
+	mux.HandleFunc("/api/download", st.withServerTiming(st.handleDownload))
+	mux.HandleFunc("/api/download/import", st.handleDownloadImport)
+	mux.HandleFunc("/api/download/retry", st.handleDownloadRetry)
+	mux.HandleFunc("/api/download/stream", st.handleDownloadStream)
+	mux.HandleFunc("/api/ws", st.handleDashboardWS)
+	mux.HandleFunc("/api/upload", st.handleUpload)
 	mux.HandleFunc("/api/autotag/reload", st.handleAutotagReload)
 	mux.HandleFunc("/api/autotag/untagged", st.handleAutotagUntagged)
 	mux.HandleFunc("/api/autotag/reconcile", st.handleReconcileDB)
 	mux.HandleFunc("/api/autotag/status", st.handleAutotagStatus)
 	mux.HandleFunc("/api/autotag/retag-status", st.handleRetagStatus)
-	mux.HandleFunc("/api/tags", st.handleTags)
-	mux.HandleFunc("/api/users", st.handleUsers)
-	mux.HandleFunc("/api/users/", st.handleUsersSubroutes)
-	mux.HandleFunc("/api/images", st.handleImages)
+	mux.HandleFunc("/api/autotag/reconcile-status", st.handleReconcileStatus)
+	mux.HandleFunc("/api/tags", st.withServerTiming(st.handleTags))
+	mux.HandleFunc("/api/tags/", st.handleTagsSubroutes)
+	mux.HandleFunc("/api/users", st.withServerTiming(st.handleUsers))
+	mux.HandleFunc("/api/users/", st.withServerTiming(st.handleUsersSubroutes))
+	mux.HandleFunc("/api/images", st.withServerTiming(st.handleImages))
+	mux.HandleFunc("/api/timeline", st.withServerTiming(st.handleTimeline))
+	mux.HandleFunc("/api/timeline/on-this-day", st.withServerTiming(st.handleOnThisDay))
+	mux.HandleFunc("/api/stats", st.handleStats)
+	mux.HandleFunc("/api/stats/heatmap", st.withServerTiming(st.handleStatsHeatmap))
+	mux.HandleFunc("/api/stats/popular", st.handleStatsPopular)
+	mux.HandleFunc("/api/inbox", st.handleInbox)
+	mux.HandleFunc("/api/inbox/archive", st.handleInboxArchive)
+	mux.HandleFunc("/api/inbox/trash", st.handleInboxTrash)
 	mux.HandleFunc("/api/images/bulk-delete", st.handleImagesBulkDelete)
+	mux.HandleFunc("/api/images/delete-by-query", st.handleImagesDeleteByQuery)
 	mux.HandleFunc("/api/images/retag", st.handleImagesRetag)
 	mux.HandleFunc("/api/images/retag/bulk", st.handleImagesRetagBulk)
+	mux.HandleFunc("/api/images/copy-tags", st.handleImagesCopyTags)
+	mux.HandleFunc("/api/images/tags", st.handleImageTags)
+	mux.HandleFunc("/api/images/upscale", st.handleImagesUpscale)
+	mux.HandleFunc("/api/images/edit", st.handleImagesEdit)
+	mux.HandleFunc("/api/images/borders/detect", st.handleDetectBorders)
+	mux.HandleFunc("/api/images/colors/analyze", st.handleAnalyzeColors)
+	mux.HandleFunc("/api/images/variants", st.handleImageVariants)
+	mux.HandleFunc("/api/images/hash", st.handleImageHash)
+	mux.HandleFunc("/api/images/duplicates", st.handleImageDuplicates)
+	mux.HandleFunc("/api/images/duplicates/resolve", st.handleImageDuplicatesResolve)
+	mux.HandleFunc("/api/hashes", st.handleHashes)
+	mux.HandleFunc("/api/hashes/lookup", st.handleHashLookup)
+	mux.HandleFunc("/api/images/view", st.handleImageView)
+	mux.HandleFunc("/api/images/rating", st.handleImageRating)
+	mux.HandleFunc("/api/images/rename", st.handleImageRename)
 	mux.HandleFunc("/api/tasks/status", st.handleTaskStatus)
+	mux.HandleFunc("/api/tasks/", st.handleTasksSubroutes)
+	mux.HandleFunc("/api/admin/cleanup-empty-users", st.handleCleanupEmptyUsers)
+	mux.HandleFunc("/api/admin/backends", st.handleBackendsHealth)
+	mux.HandleFunc("/api/storage", st.handleStorage)
+	mux.HandleFunc("/api/settings", st.handleSettings)
+	mux.HandleFunc("/api/admin/tags/normalize", st.handleNormalizeTags)
+	mux.HandleFunc("/api/admin/refresh-resolution", st.handleRefreshResolution)
+	mux.HandleFunc("/api/admin/mirror-backfill", st.handleMirrorBackfill)
+	mux.HandleFunc("/api/admin/tasks/unlock", st.handleUnlockTasks)
+	mux.HandleFunc("/api/admin/audit", st.handleAuditLog)
+	mux.HandleFunc("/api/admin/queues", st.handleQueueStats)
+	mux.HandleFunc("/api/watchlist", st.handleWatchlist)
+	mux.HandleFunc("/api/watchlist/", st.handleWatchlistSubroutes)
+	mux.HandleFunc("/api/subscriptions", st.handleSubscriptions)
+	mux.HandleFunc("/api/subscriptions/", st.handleSubscriptionsSubroutes)
+	mux.HandleFunc("/api/collections", st.handleCollections)
+	mux.HandleFunc("/api/collections/", st.withServerTiming(st.handleCollectionsSubroutes))
+	mux.HandleFunc("/api/shares", st.handleShares)
+	mux.HandleFunc("/api/shares/", st.handleSharesSubroutes)
+	mux.HandleFunc("/share/", st.handleShareOpen)
+	mux.HandleFunc("/api/export/tags", st.handleExportTags)
+	mux.HandleFunc("/api/export/dataset", st.handleBuildDataset)
+	mux.HandleFunc("/api/export/zip", st.handleExportZip)
+	mux.HandleFunc("/api/export/", st.handleExportDownload)
+	mux.HandleFunc("/api/graphql", st.handleGraphQL)
+	mux.HandleFunc("/api/openapi.json", mux.handleOpenAPI)
+	mux.HandleFunc("/api/docs", handleAPIDocs)
 
 	logger.Info("queue api listening", "addr", st.cfg.apiAddr)
-	if err := http.ListenAndServe(st.cfg.apiAddr, loggingMiddleware(mux)); err != nil {
+	if err := http.ListenAndServe(st.cfg.apiAddr, loggingMiddleware(languageMiddleware(mux))); err != nil {
 		logger.Error("api server stopped", "error", err)
 		os.Exit(1)
 	}
 }
 
 func runWorker(st *appState) {
+	redisOpt, err := redisConnOpt(st.cfg)
+	if err != nil {
+		logger.Error("invalid redis configuration", "error", err)
+		os.Exit(1)
+	}
 	srv := asynq.NewServer(
-		asynq.RedisClientOpt{Addr: st.cfg.redisAddr, Password: st.cfg.redisPassword, DB: st.cfg.redisDB},
+		redisOpt,
 		asynq.Config{
 			Concurrency: st.cfg.concurrency,
 			Queues: map[string]int{
 				st.cfg.interactiveQueue: 4,
 				st.cfg.queueName:        8,
 			},
+			RetryDelayFunc: st.retryDelay,
 		},
 	)
 
 	mux := asynq.NewServeMux()
+	mux.Use(st.openPayloadMiddleware)
 	mux.HandleFunc(taskTypeDownload, st.processDownloadTask)
-	mux.HandleFunc(taskTypeAutotagAll, st.processAutotagAllTask)
-	mux.HandleFunc(taskTypeAutotagUntagged, st.processAutotagUntaggedTask)
-	mux.HandleFunc(taskTypeReconcileDB, st.processReconcileDBTask)
+	mux.HandleFunc(taskTypeDownloadTimeline, st.processDownloadTimelineTask)
+	mux.HandleFunc(taskTypeAutotagAll, st.withFamilyRelease(familyAutotag, st.processAutotagAllTask))
+	mux.HandleFunc(taskTypeAutotagUntagged, st.withFamilyRelease(familyAutotag, st.processAutotagUntaggedTask))
+	mux.HandleFunc(taskTypeReconcileDB, st.withFamilyRelease(familyReconcile, st.processReconcileDBTask))
 	mux.HandleFunc(taskTypeDeleteUser, st.processDeleteUserTask)
+	mux.HandleFunc(taskTypeCleanupEmptyUsers, st.processCleanupEmptyUsersTask)
+	mux.HandleFunc(taskTypeNormalizeTags, st.withFamilyRelease(familyAutotag, st.processNormalizeTagsTask))
 	mux.HandleFunc(taskTypeDeleteImage, st.processDeleteImageTask)
 	mux.HandleFunc(taskTypeDeleteImages, st.processDeleteImagesTask)
 	mux.HandleFunc(taskTypeRetagImage, st.processRetagImageTask)
-	mux.HandleFunc(taskTypeRetagImages, st.processRetagImagesTask)
+	mux.HandleFunc(taskTypeRetagImages, st.withFamilyRelease(familyRetag, st.processRetagImagesTask))
+	mux.HandleFunc(taskTypeWatchlistScan, st.processWatchlistScanTask)
+	mux.HandleFunc(taskTypeUpscaleImages, st.processUpscaleImagesTask)
+	mux.HandleFunc(taskTypeEditImage, st.processEditImageTask)
+	mux.HandleFunc(taskTypeDetectBorders, st.processDetectBordersTask)
+	mux.HandleFunc(taskTypeAnalyzeColors, st.processAnalyzeColorsTask)
+	mux.HandleFunc(taskTypeRefreshResolution, st.processRefreshResolutionTask)
+	mux.HandleFunc(taskTypeMirrorBackfill, st.processMirrorBackfillTask)
+	mux.HandleFunc(taskTypePrecheckDownloads, st.processPrecheckDownloadsTask)
+	mux.HandleFunc(taskTypeExportTags, st.processExportTagsTask)
+	mux.HandleFunc(taskTypeExportMedia, st.processExportMediaTask)
+	mux.HandleFunc(taskTypeBuildDataset, st.processBuildDatasetTask)
+	mux.HandleFunc(taskTypeTaskWatchdog, st.processTaskWatchdogTask)
+	mux.HandleFunc(taskTypeArchiveTrim, st.processArchiveTrimTask)
+
+	scheduler := asynq.NewScheduler(redisOpt, nil)
+	if err := st.registerWatchlistSchedule(scheduler); err != nil {
+		logger.Error("failed to register watchlist schedule", "error", err)
+		os.Exit(1)
+	}
+	if err := st.registerTaskWatchdog(scheduler); err != nil {
+		logger.Error("failed to register task watchdog", "error", err)
+		os.Exit(1)
+	}
+	if err := st.registerArchiveTrim(scheduler); err != nil {
+		logger.Error("failed to register archive trim", "error", err)
+		os.Exit(1)
+	}
+	if err := scheduler.Start(); err != nil {
+		logger.Error("scheduler failed to start", "error", err)
+		os.Exit(1)
+	}
+	defer scheduler.Shutdown()
 
 	logger.Info("queue worker started",
 		"queue", st.cfg.queueName,
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// handleMedia serves GET /media/{relpath} straight from the media root, so no separate
+// static server is needed. http.ServeContent takes care of Range, If-Modified-Since and
+// If-None-Match. Staging and export directories (any dot-prefixed segment) are hidden.
+func (st *appState) handleMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	st.serveMediaFile(w, r, strings.TrimPrefix(r.URL.Path, "/media/"))
+}
+
+// serveMediaFile serves the media file at the relative path raw, also for shared links.
+func (st *appState) serveMediaFile(w http.ResponseWriter, r *http.Request, raw string) {
+	rel := strings.TrimPrefix(path.Clean("/"+raw), "/")
+	if rel == "" || !isImageFile(rel) {
+		http.NotFound(w, r)
+		return
+	}
+	for _, segment := range strings.Split(rel, "/") {
+		if strings.HasPrefix(segment, ".") {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The indexed content hash keeps the ETag stable across copies and restores of the
+	// same bytes; otherwise fall back to a weak validator, like the frontend media route.
+	etag := fmt.Sprintf(`W/"%d-%d"`, info.ModTime().UnixMilli(), info.Size())
+	if records, err := st.store.GetImageRecords([]string{rel}); err == nil {
+		if rec, ok := records[rel]; ok && rec.ContentHash != "" && rec.Size == info.Size() {
+			etag = `"` + rec.ContentHash + `"`
+		}
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	// Without a registered type ServeContent sniffs the content, which recognizes MP4.
+	if ct := mime.TypeByExtension(path.Ext(rel)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	if r.Method == http.MethodGet {
+		st.access.record(rel, false)
+	}
+	http.ServeContent(w, r, rel, info.ModTime(), f)
+}
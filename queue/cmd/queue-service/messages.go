@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	langEnglish  = "en"
+	langJapanese = "ja"
+)
+
+// Message codes of the user-facing status texts. Clients can switch on a code instead of
+// parsing the text, which depends on Accept-Language.
+const (
+	msgTaskQueuedOrRunning = "task.queued_or_running"
+	msgTaskQueued          = "task.queued"
+	msgTaskPending         = "task.pending"
+	msgTaskRunning         = "task.running"
+	msgTaskProcessing      = "task.processing"
+	msgTaskCompleted       = "task.completed"
+	msgTaskFailed          = "task.failed"
+	msgTaskCancelled       = "task.cancelled"
+	msgTaskRetryWaiting    = "task.retry_waiting"
+	msgTaskCancelledByUser = "task.cancelled_by_user"
+	msgTaskUnlockedByAdmin = "task.unlocked_by_admin"
+	msgTaskWorkerLost      = "task.worker_lost"
+	msgTaskWaitingFamily   = "task.waiting_family"
+
+	msgBusyAutotag   = "busy.autotag"
+	msgBusyReconcile = "busy.reconcile"
+	msgBusyRetag     = "busy.retag"
+
+	msgDownloadQueued      = "download.queued"
+	msgDownloadNoImages    = "download.no_images"
+	msgDownloadStarting    = "download.starting"
+	msgDownloadCompleted   = "download.completed"
+	msgDownloadAutotagging = "download.autotagging"
+
+	msgAutotagNotConfigured   = "autotag.not_configured"
+	msgAutotagNone            = "autotag.none"
+	msgAutotagAllStarted      = "autotag.all_started"
+	msgAutotagUntaggedStarted = "autotag.untagged_started"
+	msgAutotagClearing        = "autotag.clearing"
+	msgAutotagFindingUntagged = "autotag.finding_untagged"
+	msgAutotagProcessed       = "autotag.processed"
+
+	msgReconcileNone      = "reconcile.none"
+	msgReconcileStarted   = "reconcile.started"
+	msgReconcileScanning  = "reconcile.scanning"
+	msgReconcileScanned   = "reconcile.scanned"
+	msgReconcileCompleted = "reconcile.completed"
+
+	msgRetagNone            = "retag.none"
+	msgRetagImageQueued     = "retag_image.queued"
+	msgRetagImageProgress   = "retag_image.progress"
+	msgRetagImageTagged     = "retag_image.tagged"
+	msgRetagImageSkipped    = "retag_image.skipped"
+	msgRetagImagesQueued    = "retag_images.queued"
+	msgRetagImagesProgress  = "retag_images.progress"
+	msgRetagImagesCompleted = "retag_images.completed"
+
+	msgDeleteImageQueued        = "delete_image.queued"
+	msgDeleteImageProgress      = "delete_image.progress"
+	msgDeleteImageNotFound      = "delete_image.not_found"
+	msgDeleteImageCompleted     = "delete_image.completed"
+	msgDeleteImagesQueued       = "delete_images.queued"
+	msgDeleteImagesQueuedCount  = "delete_images.queued_count"
+	msgDeleteImagesProgress     = "delete_images.progress"
+	msgDeleteImagesCompleted    = "delete_images.completed"
+	msgDeleteByQueryQueued      = "delete_by_query.queued"
+	msgDeleteByQueryQueuedCount = "delete_by_query.queued_count"
+	msgDeleteByTagNone          = "delete_by_tag.none"
+	msgDeleteByTagQueued        = "delete_by_tag.queued"
+	msgDeleteByTagQueuedCount   = "delete_by_tag.queued_count"
+	msgDeleteUserQueued         = "delete_user.queued"
+	msgDeleteUserProgress       = "delete_user.progress"
+	msgDeleteUserCompleted      = "delete_user.completed"
+
+	msgCleanupUsersQueued   = "cleanup_users.queued"
+	msgCleanupUsersProgress = "cleanup_users.progress"
+
+	msgNormalizeTagsQueued    = "normalize_tags.queued"
+	msgNormalizeTagsProgress  = "normalize_tags.progress"
+	msgNormalizeTagsCompleted = "normalize_tags.completed"
+
+	msgEditImageQueued    = "edit_image.queued"
+	msgEditImageCompleted = "edit_image.completed"
+	msgInboxTrashQueued   = "inbox_trash.queued"
+	msgInboxTrashCount    = "inbox_trash.queued_count"
+	msgUploadQueued       = "upload.queued"
+
+	msgBordersQueued        = "borders.queued"
+	msgBordersCompleted     = "borders.completed"
+	msgColorsQueued         = "colors.queued"
+	msgColorsCompleted      = "colors.completed"
+	msgDatasetQueued        = "dataset.queued"
+	msgDatasetCompleted     = "dataset.completed"
+	msgExportTagsQueued     = "export_tags.queued"
+	msgExportTagsCompleted  = "export_tags.completed"
+	msgExportMediaQueued    = "export_media.queued"
+	msgExportMediaCompleted = "export_media.completed"
+	msgMirrorQueued         = "mirror.queued"
+	msgMirrorCompleted      = "mirror.completed"
+	msgResolutionQueued     = "resolution.queued"
+	msgResolutionCompleted  = "resolution.completed"
+
+	msgUpscaleNotConfigured = "upscale.not_configured"
+	msgUpscaleQueued        = "upscale.queued"
+	msgUpscaleProgress      = "upscale.progress"
+	msgUpscaleCompleted     = "upscale.completed"
+
+	msgTimelineFetching  = "timeline.fetching"
+	msgTimelinePage      = "timeline.page"
+	msgTimelineCompleted = "timeline.completed"
+	msgBackfillReport    = "timeline.report"
+
+	msgWatchlistScanning  = "watchlist.scanning"
+	msgWatchlistUser      = "watchlist.user"
+	msgWatchlistCompleted = "watchlist.completed"
+)
+
+// messageCatalog holds the fmt templates of every message code per language. English is
+// complete; a code missing from another language falls back to it.
+var messageCatalog = map[string]map[string]string{
+	langEnglish: {
+		msgTaskQueuedOrRunning: "Queued or running",
+		msgTaskQueued:          "Queued",
+		msgTaskPending:         "Task is pending...",
+		msgTaskRunning:         "Running",
+		msgTaskProcessing:      "Processing...",
+		msgTaskCompleted:       "Completed",
+		msgTaskFailed:          "Task failed",
+		msgTaskCancelled:       "Cancelled",
+		msgTaskRetryWaiting:    "Waiting to retry",
+		msgTaskCancelledByUser: "Cancelled by user",
+		msgTaskUnlockedByAdmin: "Unlocked by admin",
+		msgTaskWorkerLost:      "worker lost",
+		msgTaskWaitingFamily:   "Waiting for the running task to finish...",
+
+		msgBusyAutotag:   "Another autotag task is already running.",
+		msgBusyReconcile: "Another reconcile task is already running.",
+		msgBusyRetag:     "Another bulk retag task is already running.",
+
+		msgDownloadQueued:      "%d download tasks have been queued.",
+		msgDownloadNoImages:    "No images found",
+		msgDownloadStarting:    "Starting download for %s...",
+		msgDownloadCompleted:   "completed with saved:%d skipped:%d failed:%d",
+		msgDownloadAutotagging: "Autotagging downloaded media for %s...",
+
+		msgAutotagNotConfigured:   "Autotagger is not configured.",
+		msgAutotagNone:            "No autotagging task has been run yet.",
+		msgAutotagAllStarted:      "Started force re-tagging for ALL images in the background.",
+		msgAutotagUntaggedStarted: "Autotagging for untagged images started in the background.",
+		msgAutotagClearing:        "Clearing database...",
+		msgAutotagFindingUntagged: "Finding untagged files...",
+		msgAutotagProcessed:       "Processed %d/%d (last: %s)",
+
+		msgReconcileNone:      "No reconcile task has been run yet.",
+		msgReconcileStarted:   "Started DB consistency check and cleanup in the background.",
+		msgReconcileScanning:  "Scanning media files and calculating hashes...",
+		msgReconcileScanned:   "Scanned %d/%d files",
+		msgReconcileCompleted: "DB consistency reconciliation completed",
+
+		msgRetagNone:            "No bulk retag task has been run yet.",
+		msgRetagImageQueued:     "Retag task queued",
+		msgRetagImageProgress:   "Retagging image...",
+		msgRetagImageTagged:     "Tags generated successfully!",
+		msgRetagImageSkipped:    "Image already has tags.",
+		msgRetagImagesQueued:    "Bulk retag task queued",
+		msgRetagImagesProgress:  "Retagging images...",
+		msgRetagImagesCompleted: "Bulk retag (force) completed. retagged:%d skipped:%d failed:%d",
+
+		msgDeleteImageQueued:        "Delete image task queued",
+		msgDeleteImageProgress:      "Deleting image...",
+		msgDeleteImageNotFound:      "Image not found",
+		msgDeleteImageCompleted:     "Image deleted",
+		msgDeleteImagesQueued:       "Bulk delete image task queued",
+		msgDeleteImagesQueuedCount:  "Bulk delete task queued (%d images)",
+		msgDeleteImagesProgress:     "Deleting images...",
+		msgDeleteImagesCompleted:    "Bulk delete completed. deleted:%d not_found:%d failed:%d",
+		msgDeleteByQueryQueued:      "Delete by query task queued",
+		msgDeleteByQueryQueuedCount: "Delete by query task queued (%d images)",
+		msgDeleteByTagNone:          "No images found for tag '%s'",
+		msgDeleteByTagQueued:        "Queued delete for %d images with tag '%s'",
+		msgDeleteByTagQueuedCount:   "Delete images by tag task queued (%d images)",
+		msgDeleteUserQueued:         "Delete user task queued",
+		msgDeleteUserProgress:       "Deleting user...",
+		msgDeleteUserCompleted:      "Deleted user '%s' and %d images",
+
+		msgCleanupUsersQueued:   "Cleanup empty users task queued",
+		msgCleanupUsersProgress: "Scanning user directories...",
+
+		msgNormalizeTagsQueued:    "Normalize tags task queued",
+		msgNormalizeTagsProgress:  "Normalizing tags...",
+		msgNormalizeTagsCompleted: "Normalized tags. renamed:%d merged:%d",
+
+		msgEditImageQueued:    "Edit image task queued",
+		msgEditImageCompleted: "Image edited",
+		msgInboxTrashQueued:   "Inbox trash task queued",
+		msgInboxTrashCount:    "Inbox trash task queued (%d images)",
+		msgUploadQueued:       "Upload queued",
+
+		msgBordersQueued:        "Border detection task queued",
+		msgBordersCompleted:     "Border detection completed. detected:%d clean:%d failed:%d",
+		msgColorsQueued:         "Color analysis task queued",
+		msgColorsCompleted:      "Color analysis completed. mono:%d color:%d failed:%d",
+		msgDatasetQueued:        "Dataset task queued",
+		msgDatasetCompleted:     "Dataset built. train:%d val:%d skipped:%d untagged:%d",
+		msgExportTagsQueued:     "Tag export task queued",
+		msgExportTagsCompleted:  "Tag export completed. exported:%d untagged:%d",
+		msgExportMediaQueued:    "Media export task queued",
+		msgExportMediaCompleted: "Media export completed. exported:%d missing:%d",
+		msgMirrorQueued:         "Mirror backfill task queued",
+		msgMirrorCompleted:      "Mirror backfill completed. mirrored:%d unchanged:%d failed:%d",
+		msgResolutionQueued:     "Refresh resolution task queued",
+		msgResolutionCompleted:  "Resolution refresh completed. %s:%d unchanged:%d failed:%d",
+
+		msgUpscaleNotConfigured: "Upscaler is not configured.",
+		msgUpscaleQueued:        "Upscale task queued",
+		msgUpscaleProgress:      "Upscaling images...",
+		msgUpscaleCompleted:     "Upscale completed. upscaled:%d skipped:%d failed:%d",
+
+		msgTimelineFetching:  "Fetching media timeline for %s...",
+		msgTimelinePage:      "page %d: enqueued %d tweets for %s",
+		msgTimelineCompleted: "Enqueued %d tweet downloads for %s across %d pages",
+		msgBackfillReport:    "Backfill of %s finished: %d tweets found, media saved:%d skipped:%d, tweets failed:%d no media:%d restricted:%d",
+
+		msgWatchlistScanning:  "Scanning watched users...",
+		msgWatchlistUser:      "%s: enqueued %d new tweets",
+		msgWatchlistCompleted: "Scanned %d watched users, enqueued %d tweets",
+	},
+	langJapanese: {
+		msgTaskQueuedOrRunning: "待機中または実行中",
+		msgTaskQueued:          "待機中",
+		msgTaskPending:         "タスクの開始を待っています...",
+		msgTaskRunning:         "実行中",
+		msgTaskProcessing:      "処理中...",
+		msgTaskCompleted:       "完了しました",
+		msgTaskFailed:          "タスクが失敗しました",
+		msgTaskCancelled:       "キャンセルされました",
+		msgTaskRetryWaiting:    "再試行を待っています",
+		msgTaskCancelledByUser: "ユーザーによりキャンセルされました",
+		msgTaskUnlockedByAdmin: "管理者によりロックが解除されました",
+		msgTaskWorkerLost:      "ワーカーとの接続が失われました",
+		msgTaskWaitingFamily:   "実行中のタスクの完了を待っています...",
+
+		msgBusyAutotag:   "別の自動タグ付けタスクが実行中です。",
+		msgBusyReconcile: "別の整合性チェックタスクが実行中です。",
+		msgBusyRetag:     "別の一括再タグ付けタスクが実行中です。",
+
+		msgDownloadQueued:      "%d 件のダウンロードタスクをキューに追加しました。",
+		msgDownloadNoImages:    "画像が見つかりませんでした",
+		msgDownloadStarting:    "%s のダウンロードを開始しています...",
+		msgDownloadCompleted:   "完了しました 保存:%d スキップ:%d 失敗:%d",
+		msgDownloadAutotagging: "%s のダウンロードしたメディアを自動タグ付けしています...",
+
+		msgAutotagNotConfigured:   "自動タグ付けが設定されていません。",
+		msgAutotagNone:            "自動タグ付けタスクはまだ実行されていません。",
+		msgAutotagAllStarted:      "すべての画像の強制再タグ付けをバックグラウンドで開始しました。",
+		msgAutotagUntaggedStarted: "タグのない画像の自動タグ付けをバックグラウンドで開始しました。",
+		msgAutotagClearing:        "データベースをクリアしています...",
+		msgAutotagFindingUntagged: "タグのないファイルを探しています...",
+		msgAutotagProcessed:       "%d/%d 件を処理しました (最後: %s)",
+
+		msgReconcileNone:      "整合性チェックタスクはまだ実行されていません。",
+		msgReconcileStarted:   "DB の整合性チェックとクリーンアップをバックグラウンドで開始しました。",
+		msgReconcileScanning:  "メディアファイルを走査してハッシュを計算しています...",
+		msgReconcileScanned:   "%d/%d 件のファイルを走査しました",
+		msgReconcileCompleted: "DB の整合性チェックが完了しました",
+
+		msgRetagNone:            "一括再タグ付けタスクはまだ実行されていません。",
+		msgRetagImageQueued:     "再タグ付けタスクをキューに追加しました",
+		msgRetagImageProgress:   "画像を再タグ付けしています...",
+		msgRetagImageTagged:     "タグを生成しました",
+		msgRetagImageSkipped:    "画像にはすでにタグがあります。",
+		msgRetagImagesQueued:    "一括再タグ付けタスクをキューに追加しました",
+		msgRetagImagesProgress:  "画像を再タグ付けしています...",
+		msgRetagImagesCompleted: "一括再タグ付け（強制）が完了しました 再タグ付け:%d スキップ:%d 失敗:%d",
+
+		msgDeleteImageQueued:        "画像削除タスクをキューに追加しました",
+		msgDeleteImageProgress:      "画像を削除しています...",
+		msgDeleteImageNotFound:      "画像が見つかりません",
+		msgDeleteImageCompleted:     "画像を削除しました",
+		msgDeleteImagesQueued:       "一括削除タスクをキューに追加しました",
+		msgDeleteImagesQueuedCount:  "一括削除タスクをキューに追加しました (%d 件)",
+		msgDeleteImagesProgress:     "画像を削除しています...",
+		msgDeleteImagesCompleted:    "一括削除が完了しました 削除:%d 見つからない:%d 失敗:%d",
+		msgDeleteByQueryQueued:      "条件指定の削除タスクをキューに追加しました",
+		msgDeleteByQueryQueuedCount: "条件指定の削除タスクをキューに追加しました (%d 件)",
+		msgDeleteByTagNone:          "タグ '%s' の画像は見つかりませんでした",
+		msgDeleteByTagQueued:        "タグ '%[2]s' の画像 %[1]d 件の削除をキューに追加しました",
+		msgDeleteByTagQueuedCount:   "タグ指定の削除タスクをキューに追加しました (%d 件)",
+		msgDeleteUserQueued:         "ユーザー削除タスクをキューに追加しました",
+		msgDeleteUserProgress:       "ユーザーを削除しています...",
+		msgDeleteUserCompleted:      "ユーザー '%s' と画像 %d 件を削除しました",
+
+		msgCleanupUsersQueued:   "空ユーザー整理タスクをキューに追加しました",
+		msgCleanupUsersProgress: "ユーザーディレクトリを走査しています...",
+
+		msgNormalizeTagsQueued:    "タグ正規化タスクをキューに追加しました",
+		msgNormalizeTagsProgress:  "タグを正規化しています...",
+		msgNormalizeTagsCompleted: "タグを正規化しました 名前変更:%d 統合:%d",
+
+		msgEditImageQueued:    "画像編集タスクをキューに追加しました",
+		msgEditImageCompleted: "画像を編集しました",
+		msgInboxTrashQueued:   "受信箱のゴミ箱移動タスクをキューに追加しました",
+		msgInboxTrashCount:    "受信箱のゴミ箱移動タスクをキューに追加しました (%d 件)",
+		msgUploadQueued:       "アップロードをキューに追加しました",
+
+		msgBordersQueued:        "余白検出タスクをキューに追加しました",
+		msgBordersCompleted:     "余白検出が完了しました 検出:%d 余白なし:%d 失敗:%d",
+		msgColorsQueued:         "色解析タスクをキューに追加しました",
+		msgColorsCompleted:      "色解析が完了しました モノクロ:%d カラー:%d 失敗:%d",
+		msgDatasetQueued:        "データセット作成タスクをキューに追加しました",
+		msgDatasetCompleted:     "データセットを作成しました train:%d val:%d スキップ:%d タグなし:%d",
+		msgExportTagsQueued:     "タグのエクスポートタスクをキューに追加しました",
+		msgExportTagsCompleted:  "タグのエクスポートが完了しました エクスポート:%d タグなし:%d",
+		msgExportMediaQueued:    "メディアのエクスポートタスクをキューに追加しました",
+		msgExportMediaCompleted: "メディアのエクスポートが完了しました エクスポート:%d 欠落:%d",
+		msgMirrorQueued:         "ミラーのバックフィルタスクをキューに追加しました",
+		msgMirrorCompleted:      "ミラーのバックフィルが完了しました ミラー:%d 変更なし:%d 失敗:%d",
+		msgResolutionQueued:     "解像度更新タスクをキューに追加しました",
+		msgResolutionCompleted:  "解像度の更新が完了しました %s:%d 変更なし:%d 失敗:%d",
+
+		msgUpscaleNotConfigured: "アップスケーラーが設定されていません。",
+		msgUpscaleQueued:        "アップスケールタスクをキューに追加しました",
+		msgUpscaleProgress:      "画像をアップスケールしています...",
+		msgUpscaleCompleted:     "アップスケールが完了しました アップスケール:%d スキップ:%d 失敗:%d",
+
+		msgTimelineFetching:  "%s のメディアタイムラインを取得しています...",
+		msgTimelinePage:      "%[1]d ページ目: %[3]s のツイート %[2]d 件をキューに追加しました",
+		msgTimelineCompleted: "%[2]s のツイート %[1]d 件のダウンロードを %[3]d ページにわたってキューに追加しました",
+		msgBackfillReport:    "%s の一括ダウンロードが完了しました ツイート:%d件 メディア 保存:%d スキップ:%d ツイート 失敗:%d メディアなし:%d 非公開等:%d",
+
+		msgWatchlistScanning:  "ウォッチリストのユーザーを走査しています...",
+		msgWatchlistUser:      "%s: 新しいツイート %d 件をキューに追加しました",
+		msgWatchlistCompleted: "ウォッチ中のユーザー %d 人を走査し、ツイート %d 件をキューに追加しました",
+	},
+}
+
+// messageText formats code in lang, falling back to English and then to the code itself.
+func messageText(lang, code string, args ...any) string {
+	tmpl, ok := messageCatalog[lang][code]
+	if !ok {
+		if tmpl, ok = messageCatalog[langEnglish][code]; !ok {
+			return code
+		}
+	}
+	if len(args) == 0 {
+		return tmpl
+	}
+	return fmt.Sprintf(tmpl, args...)
+}
+
+// localize formats code in the language of the request behind ctx.
+func localize(ctx context.Context, code string, args ...any) string {
+	return messageText(langFrom(ctx), code, args...)
+}
+
+// withMessage sets key ("message" or "status") of a task state to the English text of code
+// and keeps the code and its arguments next to it as key_code and key_args, so the status
+// endpoints can render the text in the reader's language.
+func withMessage(state map[string]any, key, code string, args ...any) map[string]any {
+	state[key] = messageText(langEnglish, code, args...)
+	state[key+"_code"] = code
+	if len(args) > 0 {
+		state[key+"_args"] = args
+	} else {
+		delete(state, key+"_args")
+	}
+	return state
+}
+
+// taskMessage is a task state holding only a message.
+func taskMessage(code string, args ...any) map[string]any {
+	return withMessage(map[string]any{}, "message", code, args...)
+}
+
+// localizeResult returns a copy of a stored task state whose coded message and status are
+// rendered in the language of ctx; nil when the state holds no map. States written before
+// codes existed are kept as is.
+func localizeResult(ctx context.Context, result any) map[string]any {
+	resultMap, ok := result.(map[string]any)
+	if !ok {
+		return nil
+	}
+	lang := langFrom(ctx)
+	out := make(map[string]any, len(resultMap))
+	for k, v := range resultMap {
+		out[k] = v
+	}
+	for _, key := range []string{"message", "status"} {
+		code, ok := stringFromAny(resultMap[key+"_code"])
+		if !ok || code == "" {
+			continue
+		}
+		raw, _ := resultMap[key+"_args"].([]any)
+		args := make([]any, len(raw))
+		for i, a := range raw {
+			// JSON turns every number into float64, which %d would not format.
+			if f, ok := a.(float64); ok && f == math.Trunc(f) {
+				a = int64(f)
+			}
+			args[i] = a
+		}
+		out[key] = messageText(lang, code, args...)
+	}
+	return out
+}
+
+type langKey struct{}
+
+func withLang(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, langKey{}, lang)
+}
+
+// langFrom returns the language chosen for the request behind ctx, English by default.
+func langFrom(ctx context.Context) string {
+	if lang, ok := ctx.Value(langKey{}).(string); ok {
+		return lang
+	}
+	return langEnglish
+}
+
+// requestLang picks the supported language the client prefers most in Accept-Language,
+// e.g. "ja,en-US;q=0.9". Region subtags are ignored.
+func requestLang(r *http.Request) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	candidates := make([]candidate, 0)
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if _, ok := messageCatalog[primary]; !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{primary, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return langEnglish
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].lang
+}
+
+// languageMiddleware resolves the response language once per request for localize.
+func languageMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(withLang(r.Context(), requestLang(r))))
+	})
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const mirrorModeHardlink = "hardlink"
+
+// mirrorFile copies relPath from the media root to MIRROR_ROOT, or hardlinks it with
+// MIRROR_MODE=hardlink. Hardlinks across filesystems fail, so that case falls back to a
+// copy. It reports false when the mirror already holds the same file.
+func (st *appState) mirrorFile(relPath string) (bool, error) {
+	src, err := resolvePathUnderRoot(st.cfg.mediaRoot, relPath)
+	if err != nil {
+		return false, err
+	}
+	dst, err := resolvePathUnderRoot(st.cfg.mirrorRoot, relPath)
+	if err != nil {
+		return false, err
+	}
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil {
+		if os.SameFile(srcInfo, dstInfo) || (dstInfo.Size() == srcInfo.Size() && dstInfo.ModTime().Equal(srcInfo.ModTime())) {
+			return false, nil
+		}
+		if err := os.Remove(dst); err != nil {
+			return false, err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return false, err
+	}
+	if st.cfg.mirrorMode == mirrorModeHardlink {
+		if err := os.Link(src, dst); err == nil {
+			return true, nil
+		}
+	}
+	return true, copyFileAtomic(src, dst, srcInfo.ModTime())
+}
+
+// copyFileAtomic writes src to a temporary file next to dst and renames it into place,
+// keeping the source mtime so the mirror sorts the same way.
+func copyFileAtomic(src, dst string, mtime time.Time) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".mirror.part")
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, mtime, mtime)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// mirrorDownloaded mirrors a newly saved file when MIRROR_ROOT is set. Failures are only
+// logged; the backfill task catches up later.
+func (st *appState) mirrorDownloaded(relPath string) {
+	if st.cfg.mirrorRoot == "" {
+		return
+	}
+	if _, err := st.mirrorFile(relPath); err != nil {
+		logger.Warn("failed to mirror media", "filepath", relPath, "error", err)
+	}
+}
+
+// mirrorRenamed follows a rename in the primary tree so the mirror does not keep the file
+// under its old path. The mirror copy is moved when present; otherwise, or when the move
+// fails, the file is mirrored afresh under its new path. Failures are only logged.
+func (st *appState) mirrorRenamed(rel, newRel string) {
+	if st.cfg.mirrorRoot == "" {
+		return
+	}
+	oldDst, err := resolvePathUnderRoot(st.cfg.mirrorRoot, rel)
+	if err != nil {
+		return
+	}
+	newDst, err := resolvePathUnderRoot(st.cfg.mirrorRoot, newRel)
+	if err != nil {
+		return
+	}
+	if _, err := os.Lstat(oldDst); err == nil {
+		err := os.MkdirAll(filepath.Dir(newDst), 0o755)
+		if err == nil {
+			err = renameNoReplace(oldDst, newDst)
+		}
+		if err == nil {
+			_ = cleanupEmptyParents(oldDst, st.cfg.mirrorRoot)
+			return
+		}
+		if !errors.Is(err, os.ErrExist) {
+			logger.Warn("failed to move mirrored media", "filepath", rel, "new_filepath", newRel, "error", err)
+		}
+		// The new path is already taken in the mirror; the copy below refreshes it.
+		if err := os.Remove(oldDst); err == nil {
+			_ = cleanupEmptyParents(oldDst, st.cfg.mirrorRoot)
+		}
+	}
+	st.mirrorDownloaded(newRel)
+}
+
+func (st *appState) handleMirrorBackfill(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if st.cfg.mirrorRoot == "" {
+		badRequest(w, "MIRROR_ROOT is not configured")
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := mirrorBackfillTaskPayload{TaskID: taskID}
+	err := st.enqueueTask(taskTypeMirrorBackfill, st.cfg.queueName, taskID, payload, 6*time.Hour)
+	if err != nil {
+		logger.Error("failed to enqueue mirror backfill task",
+			"task_type", taskTypeMirrorBackfill,
+			"task_id", taskID,
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(r.Context(), st.redis, taskID, "PENDING", taskMessage(msgMirrorQueued))
+	logger.Info("mirror backfill task queued", "task_id", taskID)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success": true,
+		"queued":  true,
+		"task_id": taskID,
+		"message": localize(r.Context(), msgMirrorQueued),
+	})
+}
+
+// processMirrorBackfillTask mirrors every media file that is missing from MIRROR_ROOT or
+// differs from it in size or mtime.
+func (st *appState) processMirrorBackfillTask(ctx context.Context, t *asynq.Task) error {
+	var payload mirrorBackfillTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+	if st.cfg.mirrorRoot == "" {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": "MIRROR_ROOT is not configured"})
+		return fmt.Errorf("mirror root not configured: %w", asynq.SkipRetry)
+	}
+
+	total := countImages(st.cfg.mediaRoot)
+	current, mirrored, unchanged, failed := 0, 0, 0, 0
+	progress := newProgressThrottle(st.cfg.progressInterval)
+	err := walkImageFiles(st.cfg.mediaRoot, func(full string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if strings.HasPrefix(filepath.Base(full), ".") {
+			return nil
+		}
+		current++
+		copied, err := st.mirrorFile(normalizeRelPath(st.cfg.mediaRoot, full))
+		switch {
+		case err != nil:
+			failed++
+			logger.Warn("mirror backfill failed", "path", full, "error", err)
+		case copied:
+			mirrored++
+		default:
+			unchanged++
+		}
+		if progress.due(current == total) {
+			setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+				"current": current,
+				"total":   total,
+				"status":  fmt.Sprintf("mirrored:%d unchanged:%d failed:%d", mirrored, unchanged, failed),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
+		"mirrored_count":  mirrored,
+		"unchanged_count": unchanged,
+		"failed_count":    failed,
+		"total":           current,
+		"current":         current,
+	}, "message", msgMirrorCompleted, mirrored, unchanged, failed))
+	return nil
+}
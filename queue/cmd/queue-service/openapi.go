@@ -0,0 +1,539 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiMux is the API ServeMux. It remembers the registered patterns so the OpenAPI
+// document lists every route, including ones without an apiOperations entry.
+type apiMux struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func newAPIMux() *apiMux {
+	return &apiMux{ServeMux: http.NewServeMux()}
+}
+
+func (m *apiMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.HandleFunc(pattern, handler)
+}
+
+// apiParam is a query, path or multipart form parameter. Type is a JSON schema type, or
+// "file" for an uploaded file.
+type apiParam struct {
+	Name        string
+	Type        string
+	Required    bool
+	Description string
+}
+
+// apiOperation documents one method of one route. Body and Response are zero values of
+// the Go types the handler decodes and encodes, so their schemas follow the code; a nil
+// Response documents a free-form object.
+type apiOperation struct {
+	Method   string
+	Path     string
+	Summary  string
+	Query    []apiParam
+	Form     []apiParam
+	Body     any
+	Response any
+	// Paginated wraps Response, the item type, in the paginatedResponse envelope.
+	Paginated bool
+	Status    int
+	// ContentType overrides application/json for the success response.
+	ContentType string
+}
+
+var (
+	pageParams = []apiParam{
+		{Name: "page", Type: "integer", Description: "1-based page number"},
+		{Name: "per_page", Type: "integer", Description: "items per page"},
+		{Name: "all", Type: "string", Description: "1 returns every item on one page"},
+	}
+	// cursorParams switch a list to {items, has_more, next_cursor} pages instead.
+	cursorParams = []apiParam{
+		{Name: "cursor", Type: "string", Description: "next_cursor of the previous page; empty for the first"},
+		{Name: "limit", Type: "integer", Description: "items per cursor page (max 500)"},
+	}
+	imageFilterParams = []apiParam{
+		{Name: "tags", Type: "string", Description: "comma separated tags the image must have; ns:* matches every tag of a namespace, =tag only the whole tag"},
+		{Name: "exclude_tags", Type: "string", Description: "comma separated tags the image must not have, matched as substrings unless written as =tag"},
+		{Name: "exclude_exact_tags", Type: "string", Description: "comma separated whole tags the image must not have"},
+		{Name: "user", Type: "string"},
+		{Name: "min_tag_count", Type: "integer"},
+		{Name: "max_tag_count", Type: "integer"},
+		{Name: "from", Type: "string", Description: "YYYY-MM-DD"},
+		{Name: "to", Type: "string", Description: "YYYY-MM-DD"},
+		{Name: "q", Type: "string", Description: "search query: tags with AND / OR / NOT (or - and |), parentheses, =tag for exact matches and key:value filters"},
+		{Name: "color", Type: "string", Description: "mono, color, a color name or #rrggbb"},
+		{Name: "favorites", Type: "boolean", Description: "only favorited images"},
+		{Name: "min_rating", Type: "integer", Description: "only images rated at least this many stars (1-5)"},
+	}
+)
+
+func withParams(groups ...[]apiParam) []apiParam {
+	var out []apiParam
+	for _, g := range groups {
+		out = append(out, g...)
+	}
+	return out
+}
+
+var apiOperations = []apiOperation{
+	{Method: http.MethodGet, Path: "/api/download", Summary: "Recent download tasks with queue depth and summary",
+		Query: []apiParam{{Name: "ids", Type: "string", Description: "comma separated task IDs"}}},
+	{Method: http.MethodPost, Path: "/api/download", Summary: "Queue downloads of post URLs or user timelines", Body: downloadRequest{}},
+	{Method: http.MethodPost, Path: "/api/download/import", Summary: "Queue tweet URLs found in an uploaded .txt or .csv",
+		Form: []apiParam{{Name: "file", Type: "file", Required: true}}},
+	{Method: http.MethodPost, Path: "/api/download/retry", Summary: "Re-queue failed downloads", Body: downloadRetryRequest{}},
+	{Method: http.MethodGet, Path: "/api/download/stream", Summary: "Server-Sent Events of task state changes",
+		Query: []apiParam{{Name: "ids", Type: "string", Description: "comma separated task IDs"}}, ContentType: "text/event-stream"},
+	{Method: http.MethodGet, Path: "/api/ws", Summary: "Dashboard WebSocket; see README for the message format", Status: http.StatusSwitchingProtocols},
+	{Method: http.MethodPost, Path: "/api/upload", Summary: "Ingest media files of a tweet that cannot be fetched", Status: http.StatusAccepted,
+		Form: []apiParam{
+			{Name: "url", Type: "string", Required: true, Description: "source tweet URL"},
+			{Name: "files", Type: "file", Required: true, Description: "one or more media files, or ZIP / tar / tar.gz archives of them"},
+			{Name: "text", Type: "string"},
+			{Name: "display_name", Type: "string"},
+			{Name: "created_at", Type: "string"},
+		}},
+	{Method: http.MethodGet, Path: "/api/tasks/status", Summary: "State of any task",
+		Query: []apiParam{{Name: "id", Type: "string", Required: true}}},
+	{Method: http.MethodDelete, Path: "/api/tasks/{id}", Summary: "Cancel a queued or running task"},
+	{Method: http.MethodGet, Path: "/api/tasks/{id}/result", Summary: "Final result of a finished task", Response: taskResultRecord{}},
+
+	{Method: http.MethodPost, Path: "/api/autotag/reload", Summary: "Re-tag every image", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/autotag/untagged", Summary: "Tag images without tags", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/autotag/reconcile", Summary: "Reconcile the database with the media root", Status: http.StatusAccepted},
+	{Method: http.MethodGet, Path: "/api/autotag/status", Summary: "Autotag progress"},
+	{Method: http.MethodGet, Path: "/api/autotag/retag-status", Summary: "Bulk retag progress"},
+	{Method: http.MethodGet, Path: "/api/autotag/reconcile-status", Summary: "Reconcile progress"},
+
+	{Method: http.MethodGet, Path: "/api/images", Summary: "List images", Response: imageListItem{}, Paginated: true,
+		Query: withParams(pageParams, cursorParams, imageFilterParams, []apiParam{
+			{Name: "sort", Type: "string", Description: "latest, random, popular (most viewed first) or rating (most stars first); cursor pages need latest"},
+			{Name: "seed", Type: "string", Description: "with sort=random, a fixed order so pages neither repeat nor skip images"},
+			{Name: "collapse_variants", Type: "boolean"},
+		})},
+	{Method: http.MethodDelete, Path: "/api/images", Summary: "Delete one image", Body: filepathRequest{}},
+	{Method: http.MethodPost, Path: "/api/images/bulk-delete", Summary: "Delete images", Body: filepathsRequest{}},
+	{Method: http.MethodPost, Path: "/api/images/delete-by-query", Summary: "Delete images matching a filter; dry run first", Body: deleteByQueryRequest{}},
+	{Method: http.MethodPost, Path: "/api/images/retag", Summary: "Re-tag one image", Body: filepathRequest{}},
+	{Method: http.MethodPost, Path: "/api/images/retag/bulk", Summary: "Re-tag images by path or filter", Body: retagBulkRequest{}},
+	{Method: http.MethodPost, Path: "/api/images/copy-tags", Summary: "Copy tags between images", Body: copyTagsRequest{}},
+	{Method: http.MethodPost, Path: "/api/images/tags", Summary: "Add tags to an image by hand", Body: imageTagsRequest{}},
+	{Method: http.MethodDelete, Path: "/api/images/tags", Summary: "Remove tags from an image", Body: imageTagsRequest{}},
+	{Method: http.MethodPost, Path: "/api/images/upscale", Summary: "Upscale images", Body: upscaleRequest{}},
+	{Method: http.MethodGet, Path: "/media/{relpath}", Summary: "Serve a stored media file (supports Range and conditional requests)", ContentType: "application/octet-stream"},
+	{Method: http.MethodPost, Path: "/api/images/edit", Summary: "Crop, rotate, flip or trim an image into a new edited variant", Body: imageEditRequest{}, Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/images/borders/detect", Summary: "Detect solid borders and store crop suggestions", Body: detectBordersRequest{}, Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/images/colors/analyze", Summary: "Analyze colorfulness and dominant colors for the color filter", Body: analyzeColorsRequest{}, Status: http.StatusAccepted},
+	{Method: http.MethodGet, Path: "/api/images/variants", Summary: "Variants of an image",
+		Query: []apiParam{{Name: "filepath", Type: "string", Required: true}}},
+	{Method: http.MethodPost, Path: "/api/images/variants", Summary: "Link images as variants", Body: variantsLinkRequest{}},
+	{Method: http.MethodDelete, Path: "/api/images/variants", Summary: "Unlink an image from its variant group", Body: filepathRequest{}},
+	{Method: http.MethodGet, Path: "/api/images/duplicates", Summary: "Clusters of duplicate files across users, largest saving first", Response: duplicateCluster{}, Paginated: true,
+		Query: withParams(pageParams, []apiParam{
+			{Name: "near", Type: "boolean", Description: "also group near duplicates by perceptual hash"},
+			{Name: "distance", Type: "integer", Description: "near-duplicate threshold in bits (0-16, default PHASH_DEDUP_DISTANCE or 6)"},
+			{Name: "user", Type: "string", Description: "only clusters that include a file of this user"},
+		})},
+	{Method: http.MethodPost, Path: "/api/images/duplicates/resolve", Summary: "Keep one file of duplicate clusters and delete the rest", Body: duplicateResolveRequest{}, Status: http.StatusAccepted},
+	{Method: http.MethodGet, Path: "/api/images/hash", Summary: "Content hash of an image",
+		Query: []apiParam{
+			{Name: "filepath", Type: "string", Required: true},
+			{Name: "serve", Type: "boolean", Description: "count the lookup as a serve of the file"},
+		}},
+	{Method: http.MethodGet, Path: "/api/hashes", Summary: "Content hash index (MD5 to filepath) for external dedupe tools", Response: imageHashEntry{}, Paginated: true,
+		Query: withParams(pageParams, cursorParams, []apiParam{{Name: "user", Type: "string"}})},
+	{Method: http.MethodPost, Path: "/api/hashes/lookup", Summary: "Check which MD5 hashes are already in the library", Body: hashLookupRequest{}, Response: hashLookupItem{}},
+	{Method: http.MethodPost, Path: "/api/images/view", Summary: "Count a view of an image", Body: filepathRequest{}},
+	{Method: http.MethodPost, Path: "/api/images/rating", Summary: "Set the favorite flag and star rating of an image", Body: imageRatingRequest{}},
+	{Method: http.MethodPost, Path: "/api/images/rename", Summary: "Rename or move an image, keeping its tags and other records", Body: imageRenameRequest{}},
+
+	{Method: http.MethodGet, Path: "/api/tags", Summary: "List tags with image counts", Response: tagCount{}, Paginated: true,
+		Query: withParams(pageParams, []apiParam{
+			{Name: "q", Type: "string"},
+			{Name: "match", Type: "string", Description: "partial (default) or exact"},
+			{Name: "min_count", Type: "integer"},
+			{Name: "max_count", Type: "integer"},
+			{Name: "sort", Type: "string", Description: "count_desc, count_asc, name_asc or name_desc"},
+			{Name: "category", Type: "string", Description: "namespace such as character, or general for tags without one"},
+			{Name: "exclude_tags", Type: "string", Description: "comma separated tags to leave out; ns:* leaves out a namespace, =tag only the whole tag"},
+			{Name: "exclude_exact_tags", Type: "string", Description: "comma separated whole tags to leave out"},
+			{Name: "source", Type: "string", Description: "count only tags from autotagger, manual, heuristic or creator"},
+		})},
+	{Method: http.MethodDelete, Path: "/api/tags", Summary: "Delete a tag from every image", Body: tagDeleteRequest{}},
+	{Method: http.MethodGet, Path: "/api/tags/export", Summary: "Stream every tagged file with its tags as JSON lines or CSV",
+		Query: []apiParam{
+			{Name: "format", Type: "string", Description: "jsonl (default, one file per line) or csv (filepath,tag,confidence,source per row)"},
+			{Name: "source", Type: "string", Description: "export only tags from autotagger, manual, heuristic or creator"},
+		}},
+	{Method: http.MethodDelete, Path: "/api/tags/sources/{source}", Summary: "Delete every tag from one source (autotagger, heuristic or creator)"},
+	{Method: http.MethodGet, Path: "/api/tags/categories", Summary: "Tag categories (namespaces) and their colors"},
+	{Method: http.MethodPost, Path: "/api/tags/categories", Summary: "Add a tag category or change its color", Body: tagCategoryRequest{}},
+	{Method: http.MethodDelete, Path: "/api/tags/categories/{name}", Summary: "Delete a tag category"},
+	{Method: http.MethodGet, Path: "/api/tags/aliases", Summary: "Tag aliases"},
+	{Method: http.MethodPost, Path: "/api/tags/aliases", Summary: "Map an alias to a canonical tag", Body: tagAliasRequest{}},
+	{Method: http.MethodDelete, Path: "/api/tags/aliases/{alias}", Summary: "Delete a tag alias"},
+	{Method: http.MethodGet, Path: "/api/tags/{tag}/confidence", Summary: "Confidence histogram of a tag",
+		Query: []apiParam{{Name: "buckets", Type: "integer"}}},
+
+	{Method: http.MethodGet, Path: "/api/users", Summary: "List users with tweet counts", Response: userInfo{}, Paginated: true,
+		Query: withParams(pageParams, []apiParam{
+			{Name: "q", Type: "string"},
+			{Name: "match", Type: "string"},
+			{Name: "min_tweets", Type: "integer"},
+			{Name: "max_tweets", Type: "integer"},
+			{Name: "sort", Type: "string"},
+			{Name: "include_stale", Type: "boolean"},
+		})},
+	{Method: http.MethodDelete, Path: "/api/users", Summary: "Delete a user and their media", Body: userDeleteRequest{}},
+	{Method: http.MethodPost, Path: "/api/users/{user}/merge", Summary: "Move a user's files into another user and alias the creator tag", Body: userMergeRequest{}},
+	{Method: http.MethodGet, Path: "/api/users/{user}/tweets", Summary: "Tweets of a user with their images", Response: userTweet{}, Paginated: true,
+		Query: withParams(pageParams, cursorParams, []apiParam{
+			{Name: "min_tag_count", Type: "integer"},
+			{Name: "max_tag_count", Type: "integer"},
+			{Name: "exclude_tags", Type: "string"},
+			{Name: "exclude_exact_tags", Type: "string"},
+			{Name: "collapse_variants", Type: "boolean"},
+		})},
+	{Method: http.MethodGet, Path: "/api/users/{user}/feed.atom", Summary: "Atom feed of a user's media",
+		Query:       []apiParam{{Name: "limit", Type: "integer"}, {Name: "exclude_tags", Type: "string"}, {Name: "exclude_exact_tags", Type: "string"}},
+		ContentType: "application/atom+xml"},
+
+	{Method: http.MethodGet, Path: "/api/timeline", Summary: "Media timeline across users",
+		Query: []apiParam{{Name: "limit", Type: "integer"}, {Name: "cursor", Type: "string"}, {Name: "exclude_tags", Type: "string"},
+			{Name: "exclude_exact_tags", Type: "string"}}},
+	{Method: http.MethodGet, Path: "/api/timeline/on-this-day", Summary: "Media posted on this day in earlier years",
+		Query: []apiParam{{Name: "date", Type: "string"}, {Name: "tz", Type: "string"}, {Name: "limit", Type: "integer"}, {Name: "exclude_tags", Type: "string"},
+			{Name: "exclude_exact_tags", Type: "string"}}},
+
+	{Method: http.MethodGet, Path: "/api/stats", Summary: "Dashboard counters"},
+	{Method: http.MethodGet, Path: "/api/stats/heatmap", Summary: "Downloads per day",
+		Query: []apiParam{{Name: "year", Type: "integer"}, {Name: "tz", Type: "string"}, {Name: "user", Type: "string"}}},
+	{Method: http.MethodGet, Path: "/api/stats/popular", Summary: "Most viewed images and users",
+		Query: []apiParam{{Name: "limit", Type: "integer", Description: "max 100"}, {Name: "user", Type: "string"}}},
+	{Method: http.MethodGet, Path: "/api/inbox", Summary: "Newly downloaded images not yet reviewed", Paginated: true, Query: pageParams[:2]},
+	{Method: http.MethodPost, Path: "/api/inbox/archive", Summary: "Remove images from the inbox", Body: inboxArchiveRequest{}},
+	{Method: http.MethodPost, Path: "/api/inbox/trash", Summary: "Delete inbox images", Body: filepathsRequest{}},
+
+	{Method: http.MethodGet, Path: "/api/watchlist", Summary: "Watched users"},
+	{Method: http.MethodPost, Path: "/api/watchlist", Summary: "Watch a user", Body: watchlistAddRequest{}},
+	{Method: http.MethodPost, Path: "/api/watchlist/import", Summary: "Watch every account of an uploaded follow list (following.js, .csv or .txt)",
+		Form: []apiParam{
+			{Name: "file", Type: "file", Required: true},
+			{Name: "interval_minutes", Type: "integer", Description: "interval of the new entries; 0 uses the default"},
+			{Name: "enabled", Type: "boolean", Description: "defaults to true"},
+			{Name: "backfill", Type: "boolean", Description: "also queue a timeline download for each new entry"},
+		}},
+	{Method: http.MethodGet, Path: "/api/watchlist/{username}", Summary: "One watched user", Response: watchEntry{}},
+	{Method: http.MethodPatch, Path: "/api/watchlist/{username}", Summary: "Update a watched user", Body: watchlistUpdateRequest{}},
+	{Method: http.MethodDelete, Path: "/api/watchlist/{username}", Summary: "Stop watching a user"},
+	{Method: http.MethodGet, Path: "/api/subscriptions", Summary: "Tag subscriptions"},
+	{Method: http.MethodPost, Path: "/api/subscriptions", Summary: "Subscribe to a tag", Body: subscriptionRequest{}},
+	{Method: http.MethodGet, Path: "/api/subscriptions/updates", Summary: "Images newly matching subscribed tags",
+		Query: []apiParam{{Name: "since_id", Type: "integer"}, {Name: "tag", Type: "string"}, {Name: "limit", Type: "integer"}}},
+	{Method: http.MethodDelete, Path: "/api/subscriptions/{tag}", Summary: "Unsubscribe from a tag"},
+	{Method: http.MethodGet, Path: "/api/collections", Summary: "Collections of hand-picked images"},
+	{Method: http.MethodPost, Path: "/api/collections", Summary: "Create a collection", Body: collectionRequest{}},
+	{Method: http.MethodGet, Path: "/api/collections/{id}", Summary: "One collection", Response: collection{}},
+	{Method: http.MethodPatch, Path: "/api/collections/{id}", Summary: "Rename or redescribe a collection", Body: collectionRequest{}},
+	{Method: http.MethodDelete, Path: "/api/collections/{id}", Summary: "Delete a collection, keeping its images"},
+	{Method: http.MethodGet, Path: "/api/collections/{id}/images", Summary: "Images of a collection in order", Response: imageListItem{}, Paginated: true, Query: pageParams[:2]},
+	{Method: http.MethodPost, Path: "/api/collections/{id}/images", Summary: "Add images to a collection, or move them to position", Body: collectionImagesRequest{}},
+	{Method: http.MethodPut, Path: "/api/collections/{id}/images", Summary: "Set the images of a collection and their order", Body: collectionImagesRequest{}},
+	{Method: http.MethodDelete, Path: "/api/collections/{id}/images", Summary: "Remove images from a collection", Body: collectionImagesRequest{}},
+	{Method: http.MethodGet, Path: "/api/shares", Summary: "Share links with their status and access counts"},
+	{Method: http.MethodPost, Path: "/api/shares", Summary: "Create an expiring public link to an image, tweet or collection", Body: shareRequest{}},
+	{Method: http.MethodGet, Path: "/api/shares/{id}", Summary: "One share link", Response: shareLinkItem{}},
+	{Method: http.MethodDelete, Path: "/api/shares/{id}", Summary: "Revoke a share link"},
+	{Method: http.MethodGet, Path: "/share/{token}", Summary: "Open a share link without other credentials",
+		Query: []apiParam{{Name: "page", Type: "integer", Description: "1-based page of the shared images"}}},
+	{Method: http.MethodGet, Path: "/share/{token}/media/{relpath}", Summary: "One file of a share link", ContentType: "application/octet-stream"},
+
+	{Method: http.MethodPost, Path: "/api/export/tags", Summary: "Export tags of a user's images as .txt sidecars in a ZIP", Body: exportTagsRequest{}, Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/export/dataset", Summary: "Build a resized training dataset with train/val splits as a ZIP", Body: datasetRequest{}, Status: http.StatusAccepted},
+	{Method: http.MethodGet, Path: "/api/export/zip", Summary: "Export the files matching a filter as a ZIP", Status: http.StatusAccepted,
+		Query: withParams(imageFilterParams, []apiParam{{Name: "manifest", Type: "boolean", Description: "add manifest.jsonl with the tags of every file"}})},
+	{Method: http.MethodGet, Path: "/api/export/{task_id}.zip", Summary: "Download a finished export", ContentType: "application/zip"},
+
+	{Method: http.MethodPost, Path: "/api/graphql", Summary: "GraphQL query over users, tweets, images, tags and tasks", Body: graphQLRequest{}, Response: graphQLResponse{}},
+
+	{Method: http.MethodGet, Path: "/api/settings", Summary: "Instance settings", Response: instanceSettings{}},
+	{Method: http.MethodPut, Path: "/api/settings", Summary: "Update instance settings", Body: settingsPatch{}, Response: instanceSettings{}},
+	{Method: http.MethodGet, Path: "/api/storage", Summary: "Media root usage and quota"},
+	{Method: http.MethodPost, Path: "/api/admin/cleanup-empty-users", Summary: "Remove empty user directories", Body: cleanupEmptyUsersRequest{}},
+	{Method: http.MethodGet, Path: "/api/admin/backends", Summary: "Health of tweet lookup backends"},
+	{Method: http.MethodPost, Path: "/api/admin/tags/normalize", Summary: "Apply the tag policy to stored tags", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/admin/refresh-resolution", Summary: "Re-read image dimensions", Body: refreshResolutionRequest{}},
+	{Method: http.MethodPost, Path: "/api/admin/mirror-backfill", Summary: "Copy missing media to MIRROR_ROOT", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/admin/tasks/unlock", Summary: "Force-clear the busy state of task families", Body: unlockTasksRequest{}},
+	{Method: http.MethodGet, Path: "/api/admin/audit", Summary: "Audit log of operator actions, newest first",
+		Query: []apiParam{{Name: "limit", Type: "integer", Description: "entries to return (max 1000)"}}},
+	{Method: http.MethodGet, Path: "/api/admin/queues", Summary: "Task counts per queue, including archived and retained completed tasks", Response: queueStatsResponse{}},
+	{Method: http.MethodGet, Path: "/api/openapi.json", Summary: "This document"},
+	{Method: http.MethodGet, Path: "/api/docs", Summary: "Swagger UI", ContentType: "text/html"},
+}
+
+// openAPISchemas derives JSON schemas from Go types the way encoding/json encodes them.
+// Named structs become components so shared types appear once.
+type openAPISchemas struct {
+	components map[string]any
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s *openAPISchemas) of(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.of(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		if _, ok := s.components[t.Name()]; !ok {
+			// Reserve the name first so self-referencing types terminate.
+			s.components[t.Name()] = map[string]any{}
+			s.components[t.Name()] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+func (s *openAPISchemas) object(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	s.addFields(t, props)
+	return map[string]any{"type": "object", "properties": props}
+}
+
+func (s *openAPISchemas) addFields(t reflect.Type, props map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		// Untagged embedded structs are flattened, as encoding/json does.
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			s.addFields(ft, props)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = s.of(f.Type)
+	}
+}
+
+func (s *openAPISchemas) params(in string, params []apiParam) []any {
+	out := make([]any, 0, len(params))
+	for _, p := range params {
+		param := map[string]any{
+			"name":     p.Name,
+			"in":       in,
+			"required": p.Required,
+			"schema":   map[string]any{"type": p.Type},
+		}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		out = append(out, param)
+	}
+	return out
+}
+
+func (s *openAPISchemas) operation(op apiOperation) map[string]any {
+	out := map[string]any{"summary": op.Summary}
+	if seg := strings.Split(strings.TrimPrefix(op.Path, "/api/"), "/")[0]; seg != "" {
+		out["tags"] = []string{seg}
+	}
+
+	params := s.params("query", op.Query)
+	for _, seg := range strings.Split(op.Path, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			params = append(params, s.params("path", []apiParam{{Name: strings.Trim(seg, "{}"), Type: "string", Required: true}})...)
+		}
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	switch {
+	case op.Body != nil:
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": s.of(reflect.TypeOf(op.Body))}},
+		}
+	case len(op.Form) > 0:
+		props := make(map[string]any, len(op.Form))
+		var required []string
+		for _, p := range op.Form {
+			prop := map[string]any{"type": p.Type}
+			if p.Type == "file" {
+				prop = map[string]any{"type": "string", "format": "binary"}
+			}
+			if p.Description != "" {
+				prop["description"] = p.Description
+			}
+			props[p.Name] = prop
+			if p.Required {
+				required = append(required, p.Name)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": props}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"multipart/form-data": map[string]any{"schema": schema}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	var schema map[string]any
+	if op.Response != nil {
+		schema = s.of(reflect.TypeOf(op.Response))
+	} else {
+		schema = map[string]any{"type": "object"}
+	}
+	if op.Paginated {
+		schema = map[string]any{"allOf": []any{
+			s.of(reflect.TypeOf(paginatedResponse{})),
+			map[string]any{"properties": map[string]any{"items": map[string]any{"type": "array", "items": schema}}},
+		}}
+	}
+	contentType := op.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	resp := map[string]any{"description": http.StatusText(status)}
+	if status != http.StatusSwitchingProtocols {
+		if contentType != "application/json" {
+			schema = map[string]any{"type": "string"}
+		}
+		resp["content"] = map[string]any{contentType: map[string]any{"schema": schema}}
+	}
+	out["responses"] = map[string]any{strconv.Itoa(status): resp}
+	return out
+}
+
+// openAPIDocument builds the OpenAPI 3 document for the routes registered on m. Routes
+// registered without an apiOperations entry are listed as undocumented.
+func (m *apiMux) openAPIDocument() map[string]any {
+	s := &openAPISchemas{components: make(map[string]any)}
+	paths := make(map[string]map[string]any)
+	for _, op := range apiOperations {
+		if paths[op.Path] == nil {
+			paths[op.Path] = make(map[string]any)
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = s.operation(op)
+	}
+
+	patterns := append([]string(nil), m.patterns...)
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "/api/") || documentedPattern(pattern) {
+			continue
+		}
+		paths[pattern] = map[string]any{"get": map[string]any{
+			"summary":        "Undocumented route",
+			"x-undocumented": true,
+			"responses":      map[string]any{"default": map[string]any{"description": "See the handler"}},
+		}}
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "x-media-downloder queue API",
+			"version": "1",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": s.components},
+	}
+}
+
+// documentedPattern reports whether an apiOperations entry is served by the mux pattern;
+// subtree patterns like "/api/tags/" cover every documented path below them.
+func documentedPattern(pattern string) bool {
+	for _, op := range apiOperations {
+		if op.Path == pattern || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(op.Path, pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *apiMux) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, m.openAPIDocument())
+}
+
+const swaggerUIPage = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>x-media-downloder API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" });</script>
+</body>
+</html>
+`
+
+func handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(swaggerUIPage))
+}
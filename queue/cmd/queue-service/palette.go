@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxDominantColors = 5
+	// dominantColorMergeDistance merges histogram buckets that look like the same color.
+	dominantColorMergeDistance = 12.0
+	// dominantColorMinWeight drops colors covering less of the image than this; a color
+	// filter also ignores them.
+	dominantColorMinWeight = 0.05
+	// dominantColorMatchDistance is how far (CIE76 delta E) a dominant color may be from
+	// a color= hex value to match. Around 10 is a clearly visible but related shade.
+	dominantColorMatchDistance = 20.0
+)
+
+// dominantColor is one entry of an image's palette; Weight is the share of the image.
+type dominantColor struct {
+	Hex    string  `json:"hex"`
+	Weight float64 `json:"weight"`
+}
+
+// namedColors are the colors accepted by name in color=, e.g. color:red. A dominant color
+// counts as a named color when that is the nearest of them.
+var namedColors = map[string][3]uint8{
+	"red":    {0xe0, 0x20, 0x20},
+	"orange": {0xf0, 0x80, 0x20},
+	"yellow": {0xf0, 0xe0, 0x30},
+	"green":  {0x40, 0xa0, 0x40},
+	"teal":   {0x20, 0xa0, 0xa0},
+	"blue":   {0x20, 0x50, 0xd0},
+	"purple": {0x80, 0x40, 0xc0},
+	"pink":   {0xf0, 0x80, 0xb0},
+	"brown":  {0x7a, 0x4a, 0x2a},
+	"white":  {0xf5, 0xf5, 0xf5},
+	"gray":   {0x80, 0x80, 0x80},
+	"black":  {0x14, 0x14, 0x14},
+}
+
+// dominantColors builds a palette of up to maxDominantColors colors, most common first,
+// from a 4-bit per channel histogram of a sample grid.
+func dominantColors(img image.Image) []dominantColor {
+	type bucket struct {
+		r, g, b, n float64
+	}
+	buckets := map[int]*bucket{}
+	b := img.Bounds()
+	stepX, stepY := max(1, b.Dx()/colorSampleSize), max(1, b.Dy()/colorSampleSize)
+	total := 0.0
+	for y := b.Min.Y; y < b.Max.Y; y += stepY {
+		for x := b.Min.X; x < b.Max.X; x += stepX {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			key := int(r>>12)<<8 | int(g>>12)<<4 | int(bl>>12)
+			bk := buckets[key]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.r += float64(r >> 8)
+			bk.g += float64(g >> 8)
+			bk.b += float64(bl >> 8)
+			bk.n++
+			total++
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, bk := range buckets {
+		sorted = append(sorted, bk)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].n > sorted[j].n })
+
+	type entry struct {
+		rgb [3]uint8
+		lab [3]float64
+		n   float64
+	}
+	palette := make([]*entry, 0, maxDominantColors)
+	for _, bk := range sorted {
+		rgb := [3]uint8{uint8(bk.r / bk.n), uint8(bk.g / bk.n), uint8(bk.b / bk.n)}
+		lab := rgbToLab(rgb)
+		merged := false
+		for _, e := range palette {
+			if labDistance(lab, e.lab) <= dominantColorMergeDistance {
+				e.n += bk.n
+				merged = true
+				break
+			}
+		}
+		if !merged && len(palette) < maxDominantColors {
+			palette = append(palette, &entry{rgb: rgb, lab: lab, n: bk.n})
+		}
+	}
+	sort.SliceStable(palette, func(i, j int) bool { return palette[i].n > palette[j].n })
+	out := make([]dominantColor, 0, len(palette))
+	for _, e := range palette {
+		weight := math.Round(e.n/total*1000) / 1000
+		if weight < dominantColorMinWeight {
+			continue
+		}
+		out = append(out, dominantColor{Hex: formatHexColor(e.rgb), Weight: weight})
+	}
+	return out
+}
+
+func formatHexColor(rgb [3]uint8) string {
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+}
+
+func parseHexColor(raw string) ([3]uint8, bool) {
+	var rgb [3]uint8
+	s := strings.TrimPrefix(raw, "#")
+	if len(s) != 6 {
+		return rgb, false
+	}
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return rgb, false
+	}
+	copy(rgb[:], decoded)
+	return rgb, true
+}
+
+// normalizePaletteColor accepts a name of namedColors or a hex color with or without the
+// leading '#', and returns the name or "#rrggbb".
+func normalizePaletteColor(raw string) (string, bool) {
+	value := strings.ToLower(strings.TrimSpace(raw))
+	if _, ok := namedColors[value]; ok {
+		return value, true
+	}
+	if rgb, ok := parseHexColor(value); ok {
+		return formatHexColor(rgb), true
+	}
+	return "", false
+}
+
+// rgbToLab converts an sRGB color to CIELAB (D65), where plain distances follow perceived
+// differences far better than in RGB.
+func rgbToLab(rgb [3]uint8) [3]float64 {
+	var lin [3]float64
+	for i, c := range rgb {
+		v := float64(c) / 255
+		if v <= 0.04045 {
+			lin[i] = v / 12.92
+		} else {
+			lin[i] = math.Pow((v+0.055)/1.055, 2.4)
+		}
+	}
+	x := (0.4124*lin[0] + 0.3576*lin[1] + 0.1805*lin[2]) / 0.95047
+	y := 0.2126*lin[0] + 0.7152*lin[1] + 0.0722*lin[2]
+	z := (0.0193*lin[0] + 0.1192*lin[1] + 0.9505*lin[2]) / 1.08883
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+func labDistance(a, b [3]float64) float64 {
+	return math.Sqrt((a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1]) + (a[2]-b[2])*(a[2]-b[2]))
+}
+
+// nearestNamedColor returns the name of the namedColors entry closest to lab.
+func nearestNamedColor(lab [3]float64) string {
+	best, bestDist := "", math.MaxFloat64
+	for name, rgb := range namedColors {
+		if d := labDistance(lab, rgbToLab(rgb)); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// paletteMatches reports whether a palette contains the wanted color: the same nearest
+// named color for a name, or a color within dominantColorMatchDistance for a hex value.
+func paletteMatches(palette []dominantColor, want string) bool {
+	wantRGB, isHex := parseHexColor(want)
+	wantLab := rgbToLab(wantRGB)
+	for _, c := range palette {
+		rgb, ok := parseHexColor(c.Hex)
+		if !ok || c.Weight < dominantColorMinWeight {
+			continue
+		}
+		lab := rgbToLab(rgb)
+		if isHex {
+			if labDistance(lab, wantLab) <= dominantColorMatchDistance {
+				return true
+			}
+		} else if nearestNamedColor(lab) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// filterByPalette keeps the images with want among their dominant colors.
+func (st *appState) filterByPalette(ctx context.Context, images []imageInfo, want string) ([]imageInfo, error) {
+	paths := make([]string, 0, len(images))
+	for _, img := range images {
+		paths = append(paths, img.Path)
+	}
+	start := time.Now()
+	palettes, err := st.store.GetDominantColors(paths)
+	timingFrom(ctx).since("sqlite", start)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]imageInfo, 0, len(images))
+	for _, img := range images {
+		if paletteMatches(palettes[img.Path], want) {
+			filtered = append(filtered, img)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hibiken/asynq"
+)
+
+// sealedPayloadMagic starts every sealed payload; anything else is taken as plaintext, so
+// tasks queued before encryption was turned on still run.
+var sealedPayloadMagic = []byte("xmde\x01")
+
+const payloadKeyIDSize = 4
+
+// payloadCodec seals task payloads before they are written to Redis and opens them again
+// in the worker. The task type is bound to the payload so it cannot be replayed as
+// another kind of task.
+type payloadCodec interface {
+	Name() string
+	Seal(taskType string, plain []byte) ([]byte, error)
+	Open(taskType string, payload []byte) ([]byte, error)
+}
+
+// newPayloadCodec picks the codec from TASK_PAYLOAD_CODEC: "none", or "aes-gcm" keyed by
+// TASK_PAYLOAD_KEY. Left empty, it is aes-gcm when a key is set and none otherwise.
+func newPayloadCodec(cfg config) (payloadCodec, error) {
+	name := cfg.taskPayloadCodec
+	if name == "" {
+		name = "none"
+		if cfg.taskPayloadKey != "" {
+			name = "aes-gcm"
+		}
+	}
+	switch name {
+	case "none":
+		return plainPayloadCodec{}, nil
+	case "aes-gcm":
+		if cfg.taskPayloadKey == "" {
+			return nil, errors.New("TASK_PAYLOAD_CODEC=aes-gcm requires TASK_PAYLOAD_KEY")
+		}
+		return newAESPayloadCodec(cfg.taskPayloadKey, splitCSV(cfg.taskPayloadPreviousKeys))
+	}
+	return nil, fmt.Errorf("unknown TASK_PAYLOAD_CODEC %q", name)
+}
+
+func isSealedPayload(payload []byte) bool {
+	return bytes.HasPrefix(payload, sealedPayloadMagic)
+}
+
+// plainPayloadCodec stores payloads as they are.
+type plainPayloadCodec struct{}
+
+func (plainPayloadCodec) Name() string { return "none" }
+
+func (plainPayloadCodec) Seal(_ string, plain []byte) ([]byte, error) { return plain, nil }
+
+func (plainPayloadCodec) Open(_ string, payload []byte) ([]byte, error) {
+	if isSealedPayload(payload) {
+		return nil, errors.New("task payload is encrypted but TASK_PAYLOAD_KEY is not set")
+	}
+	return payload, nil
+}
+
+// aesPayloadCodec seals with AES-256-GCM under a key derived from a secret. Payloads name
+// their key by ID, so previous keys can still open tasks queued before a rotation.
+type aesPayloadCodec struct {
+	current []byte
+	keys    map[string]cipher.AEAD
+}
+
+func newAESPayloadCodec(secret string, previous []string) (*aesPayloadCodec, error) {
+	c := &aesPayloadCodec{keys: make(map[string]cipher.AEAD)}
+	for i, s := range append([]string{secret}, previous...) {
+		key := sha256.Sum256([]byte(strings.TrimSpace(s)))
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		id := sha256.Sum256(key[:])
+		if i == 0 {
+			c.current = id[:payloadKeyIDSize]
+		}
+		c.keys[string(id[:payloadKeyIDSize])] = aead
+	}
+	return c, nil
+}
+
+func (c *aesPayloadCodec) Name() string { return "aes-gcm" }
+
+// Seal returns magic | key ID | nonce | ciphertext.
+func (c *aesPayloadCodec) Seal(taskType string, plain []byte) ([]byte, error) {
+	aead := c.keys[string(c.current)]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(sealedPayloadMagic)+payloadKeyIDSize+len(nonce)+len(plain)+aead.Overhead())
+	out = append(out, sealedPayloadMagic...)
+	out = append(out, c.current...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plain, []byte(taskType)), nil
+}
+
+func (c *aesPayloadCodec) Open(taskType string, payload []byte) ([]byte, error) {
+	if !isSealedPayload(payload) {
+		return payload, nil
+	}
+	rest := payload[len(sealedPayloadMagic):]
+	if len(rest) < payloadKeyIDSize {
+		return nil, errors.New("truncated task payload")
+	}
+	aead, ok := c.keys[string(rest[:payloadKeyIDSize])]
+	if !ok {
+		return nil, errors.New("task payload was sealed with an unknown key; add it to TASK_PAYLOAD_PREVIOUS_KEYS")
+	}
+	rest = rest[payloadKeyIDSize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, errors.New("truncated task payload")
+	}
+	plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], []byte(taskType))
+	if err != nil {
+		return nil, errors.New("task payload failed to decrypt")
+	}
+	return plain, nil
+}
+
+// openPayloadMiddleware hands processors the plaintext payload, so none of them needs to
+// know whether encryption is on. A payload that cannot be opened fails without retries.
+func (st *appState) openPayloadMiddleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		plain, err := st.payloadCodec.Open(t.Type(), t.Payload())
+		if err != nil {
+			if taskID, ok := asynq.GetTaskID(ctx); ok {
+				setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+			}
+			logger.Error("failed to open task payload", "task_type", t.Type(), "error", err)
+			return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+		}
+		return next.ProcessTask(ctx, asynq.NewTask(t.Type(), plain))
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"os"
+	"strconv"
+)
+
+// dHash dimensions: each row compares dhashWidth+1 adjacent samples, giving a 64-bit hash.
+const (
+	dhashWidth  = 8
+	dhashHeight = 8
+)
+
+// perceptualHash computes a difference hash of the image at path. Re-encoded or resized
+// copies of one image land within a few bits of each other, unlike their MD5s. Only the
+// formats the standard library decodes (JPEG, PNG, GIF) are supported.
+func perceptualHash(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, err
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() < 1 || bounds.Dy() < 1 {
+		return 0, errors.New("empty image")
+	}
+
+	// Average each cell of a (width+1) x height grid down to one luminance sample.
+	const cols = dhashWidth + 1
+	var grid [dhashHeight][cols]float64
+	for y := 0; y < dhashHeight; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/dhashHeight
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/dhashHeight
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < cols; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/cols
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/cols
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var sum float64
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			grid[y][x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < dhashHeight; y++ {
+		for x := 0; x < dhashWidth; x++ {
+			hash <<= 1
+			if grid[y][x] > grid[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+func formatPerceptualHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+func parsePerceptualHash(raw string) (uint64, error) {
+	return strconv.ParseUint(raw, 16, 64)
+}
+
+// supportsPerceptualHash reports whether perceptualHash can decode files with ext.
+func supportsPerceptualHash(ext string) bool {
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
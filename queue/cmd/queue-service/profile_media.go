@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// profileDirName holds a user's avatar and banner. It is not a tweet directory.
+	profileDirName = "_profile"
+	// profileTag marks profile images so /api/images can include or exclude them.
+	profileTag = "_profile"
+
+	profileLockPrefix = "xmd:profile-fetch-"
+	profileLockTTL    = 10 * time.Minute
+)
+
+// bannerSizeRe matches banner URLs that already name a rendition such as /1500x500.
+var bannerSizeRe = regexp.MustCompile(`/\d+x\d+$`)
+
+// isProfileDir reports whether a directory entry under a user is the profile directory.
+func isProfileDir(name string) bool {
+	return name == profileDirName
+}
+
+// fetchXProfileImages looks up the avatar and banner of an X account through the
+// fxtwitter user API, returning their largest variants. Either may be empty.
+func fetchXProfileImages(ctx context.Context, client *http.Client, username string) (string, string, error) {
+	var parsed struct {
+		Code int `json:"code"`
+		User struct {
+			AvatarURL string `json:"avatar_url"`
+			BannerURL string `json:"banner_url"`
+		} `json:"user"`
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	apiURL := "https://api.fxtwitter.com/" + url.PathEscape(username)
+	if err := fetchBackendJSON(ctx, client, apiURL, &parsed); err != nil {
+		return "", "", err
+	}
+	if parsed.Code != 0 && parsed.Code != http.StatusOK {
+		return "", "", fmt.Errorf("fxtwitter code=%d", parsed.Code)
+	}
+	avatar := parsed.User.AvatarURL
+	// Avatars default to the 48px "_normal" rendition.
+	for _, size := range []string{"_normal.", "_bigger.", "_mini.", "_200x200.", "_400x400."} {
+		if strings.Contains(avatar, size) {
+			avatar = strings.Replace(avatar, size, ".", 1)
+			break
+		}
+	}
+	banner := parsed.User.BannerURL
+	if banner != "" && !bannerSizeRe.MatchString(banner) {
+		banner = strings.TrimRight(banner, "/") + "/1500x500"
+	}
+	return avatar, banner, nil
+}
+
+// downloadProfileMedia saves the avatar and banner of an X user under
+// {user}/_profile/ the first time the user is seen. Failures are logged and otherwise
+// ignored so they never fail the tweet download that triggered them.
+func (st *appState) downloadProfileMedia(ctx context.Context, username string) {
+	profileDir := filepath.Join(st.cfg.mediaRoot, username, profileDirName)
+	if _, err := os.Stat(profileDir); err == nil {
+		return
+	}
+	// Concurrent downloads of the same user race here; only one fetches.
+	if ok, err := st.redis.SetNX(ctx, profileLockPrefix+strings.ToLower(username), "1", profileLockTTL).Result(); err != nil || !ok {
+		return
+	}
+	avatar, banner, err := fetchXProfileImages(ctx, st.downloadHTTPClient, username)
+	if err != nil {
+		logger.Warn("failed to look up profile images", "username", username, "error", err)
+		return
+	}
+	if err := os.MkdirAll(profileDir, 0o755); err != nil {
+		logger.Warn("failed to create profile directory", "username", username, "error", err)
+		return
+	}
+	saved := 0
+	for name, mediaURL := range map[string]string{"avatar": avatar, "banner": banner} {
+		if mediaURL == "" {
+			continue
+		}
+		rel, err := st.saveProfileImage(ctx, profileDir, name, mediaURL)
+		if err != nil {
+			logger.Warn("failed to download profile image", "username", username, "kind", name, "url", mediaURL, "error", err)
+			continue
+		}
+		saved++
+		logger.Info("profile image saved", "username", username, "filepath", rel)
+	}
+	if saved == 0 {
+		// Leaving no directory behind lets a later download try again.
+		_ = os.RemoveAll(profileDir)
+	}
+}
+
+func (st *appState) saveProfileImage(ctx context.Context, profileDir, name, mediaURL string) (string, error) {
+	partPath := filepath.Join(profileDir, "."+name+".part")
+	part, err := st.fetchToPart(ctx, mediaURL, partPath)
+	if err != nil {
+		return "", err
+	}
+	ext, err := sniffMediaExt(partPath)
+	if err != nil {
+		removePart(partPath)
+		return "", err
+	}
+	if isVideoFile(ext) {
+		removePart(partPath)
+		return "", errors.New("profile media is not an image")
+	}
+	fullPath := filepath.Join(profileDir, name+ext)
+	if err := os.Rename(partPath, fullPath); err != nil {
+		return "", err
+	}
+	removePart(partPath)
+
+	rel := normalizeRelPath(st.cfg.mediaRoot, fullPath)
+	if err := st.store.RecordImage(newImageRecord(rel, part.Hash, part.Size, time.Now().UnixMilli())); err != nil {
+		logger.Warn("failed to index profile image", "filepath", rel, "error", err)
+	}
+	if err := st.store.RecordImageSource(rel, mediaURL); err != nil {
+		logger.Warn("failed to record image source", "filepath", rel, "error", err)
+	}
+	if err := st.store.AddTags(rel, map[string]float64{profileTag: 1}); err != nil {
+		return rel, err
+	}
+	return rel, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// progressThrottle limits how often a task loop persists PROGRESS state. Loops over many
+// items would otherwise write to Redis after each one; the final state is written
+// separately, so skipped intermediate updates lose nothing.
+type progressThrottle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     time.Time
+}
+
+func newProgressThrottle(interval time.Duration) *progressThrottle {
+	return &progressThrottle{interval: interval}
+}
+
+// due reports whether progress should be written now. The first call and final calls
+// always pass; others pass once interval has elapsed since the last write. Safe for
+// concurrent use.
+func (p *progressThrottle) due(final bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if !final && !p.last.IsZero() && now.Sub(p.last) < p.interval {
+		return false
+	}
+	p.last = now
+	return true
+}
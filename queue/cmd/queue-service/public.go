@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// nsfwRatingTags are the autotagger ratings hidden when NSFW images are not shown, matching
+// the frontend's NSFW filter.
+var nsfwRatingTags = []string{"rating:questionable", "rating:explicit"}
+
+// publicRoute is one pattern of the public gallery listener.
+type publicRoute struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// publicEndpointGroups are the read-only endpoint groups PUBLIC_ENDPOINTS can expose.
+func (st *appState) publicEndpointGroups() map[string][]publicRoute {
+	return map[string][]publicRoute{
+		"images": {{"/api/images", st.withServerTiming(st.handleImages)}},
+		"tags":   {{"/api/tags", st.withServerTiming(st.handleTags)}},
+		"media":  {{"/media/", st.handlePublicMedia}},
+		"users": {
+			{"/api/users", st.withServerTiming(st.handleUsers)},
+			{"/api/users/", st.withServerTiming(st.handleUsersSubroutes)},
+		},
+		"timeline": {
+			{"/api/timeline", st.withServerTiming(st.handleTimeline)},
+			{"/api/timeline/on-this-day", st.withServerTiming(st.handleOnThisDay)},
+		},
+		"shares": {{"/share/", st.handleShareOpen}},
+	}
+}
+
+// runPublicAPI serves the groups listed in PUBLIC_ENDPOINTS on PUBLIC_API_ADDR, so the
+// gallery can be published without exposing the admin API next to it.
+func runPublicAPI(st *appState) {
+	groups := st.publicEndpointGroups()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	})
+	exposed := make([]string, 0)
+	for _, name := range splitCSV(st.cfg.publicEndpoints) {
+		name = strings.ToLower(name)
+		routes, ok := groups[name]
+		if !ok {
+			logger.Warn("unknown public endpoint group", "group", name)
+			continue
+		}
+		for _, route := range routes {
+			mux.HandleFunc(route.pattern, st.publicReadOnly(route.handler))
+		}
+		exposed = append(exposed, name)
+	}
+	sort.Strings(exposed)
+	logger.Info("public api listening", "addr", st.cfg.publicAPIAddr, "endpoints", exposed, "nsfw_visible", st.cfg.publicNSFWVisible)
+	if err := http.ListenAndServe(st.cfg.publicAPIAddr, loggingMiddleware(languageMiddleware(mux))); err != nil {
+		logger.Error("public api server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// publicReadOnly rejects every method but GET and HEAD and, unless PUBLIC_NSFW_VISIBLE is
+// set, adds the NSFW ratings to exclude_tags, which every listing endpoint honours.
+func (st *appState) publicReadOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !st.cfg.publicNSFWVisible {
+			q := r.URL.Query()
+			q.Set("exclude_tags", strings.Join(append(splitCSV(q.Get("exclude_tags")), nsfwRatingTags...), ","))
+			r.URL.RawQuery = q.Encode()
+		}
+		next(w, r)
+	}
+}
+
+// handlePublicMedia serves media like /media/ but hides files rated NSFW.
+func (st *appState) handlePublicMedia(w http.ResponseWriter, r *http.Request) {
+	rel := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, "/media/")), "/")
+	if !st.cfg.publicNSFWVisible {
+		tagsMap, err := st.store.GetTagsForFiles([]string{rel})
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if hasTagPattern(tagsMap[rel], nsfwRatingTags) {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	st.serveMediaFile(w, r, rel)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// archiveTrimTick is how often archived tasks are trimmed to TASK_ARCHIVE_MAX and
+	// TASK_ARCHIVE_MAX_AGE_HOURS.
+	archiveTrimTick = 10 * time.Minute
+	// archiveTrimBatch bounds the archived tasks listed per inspector call.
+	archiveTrimBatch = 500
+)
+
+// queueStats is one asynq queue as seen by GET /api/admin/queues. Archived tasks are
+// those that failed for good; completed ones are only kept with TASK_RETENTION_MINUTES.
+type queueStats struct {
+	Queue          string `json:"queue"`
+	Size           int    `json:"size"`
+	Pending        int    `json:"pending"`
+	Active         int    `json:"active"`
+	Scheduled      int    `json:"scheduled"`
+	Retry          int    `json:"retry"`
+	Archived       int    `json:"archived"`
+	Completed      int    `json:"completed"`
+	ProcessedToday int    `json:"processed_today"`
+	FailedToday    int    `json:"failed_today"`
+	ProcessedTotal int    `json:"processed_total"`
+	FailedTotal    int    `json:"failed_total"`
+	LatencyMs      int64  `json:"latency_ms"`
+	MemoryUsage    int64  `json:"memory_usage_bytes"`
+	Paused         bool   `json:"paused"`
+}
+
+// queueRetentionPolicy echoes the retention settings next to the counts they control.
+type queueRetentionPolicy struct {
+	CompletedRetentionSeconds int64 `json:"completed_retention_seconds"`
+	ArchiveMax                int   `json:"archive_max"`
+	ArchiveMaxAgeHours        int   `json:"archive_max_age_hours"`
+}
+
+type queueStatsResponse struct {
+	Queues    []queueStats         `json:"queues"`
+	Retention queueRetentionPolicy `json:"retention"`
+}
+
+// taskQueues lists the queues this service enqueues to.
+func (st *appState) taskQueues() []string {
+	if st.cfg.interactiveQueue == st.cfg.queueName {
+		return []string{st.cfg.queueName}
+	}
+	return []string{st.cfg.queueName, st.cfg.interactiveQueue}
+}
+
+// handleQueueStats reports task counts per queue, including archived and retained
+// completed tasks, so their buildup can be watched.
+func (st *appState) handleQueueStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	resp := queueStatsResponse{
+		Queues: make([]queueStats, 0, 2),
+		Retention: queueRetentionPolicy{
+			CompletedRetentionSeconds: int64(st.cfg.taskRetention / time.Second),
+			ArchiveMax:                st.cfg.taskArchiveMax,
+			ArchiveMaxAgeHours:        int(st.cfg.taskArchiveMaxAge / time.Hour),
+		},
+	}
+	for _, name := range st.taskQueues() {
+		q, err := st.inspector.GetQueueInfo(name)
+		if errors.Is(err, asynq.ErrQueueNotFound) {
+			// asynq creates a queue on its first task.
+			resp.Queues = append(resp.Queues, queueStats{Queue: name})
+			continue
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		resp.Queues = append(resp.Queues, queueStats{
+			Queue:          q.Queue,
+			Size:           q.Size,
+			Pending:        q.Pending,
+			Active:         q.Active,
+			Scheduled:      q.Scheduled,
+			Retry:          q.Retry,
+			Archived:       q.Archived,
+			Completed:      q.Completed,
+			ProcessedToday: q.Processed,
+			FailedToday:    q.Failed,
+			ProcessedTotal: q.ProcessedTotal,
+			FailedTotal:    q.FailedTotal,
+			LatencyMs:      q.Latency.Milliseconds(),
+			MemoryUsage:    q.MemoryUsage,
+			Paused:         q.Paused,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// registerArchiveTrim schedules trimming of archived tasks when a limit tighter than
+// asynq's own (10000 tasks, 90 days per queue) is configured.
+func (st *appState) registerArchiveTrim(scheduler *asynq.Scheduler) error {
+	if st.cfg.taskArchiveMax <= 0 && st.cfg.taskArchiveMaxAge <= 0 {
+		return nil
+	}
+	_, err := scheduler.Register(
+		"@every "+archiveTrimTick.String(),
+		asynq.NewTask(taskTypeArchiveTrim, nil),
+		asynq.Queue(st.cfg.interactiveQueue),
+		asynq.MaxRetry(0),
+		asynq.Timeout(5*time.Minute),
+		asynq.Unique(archiveTrimTick),
+	)
+	return err
+}
+
+// processArchiveTrimTask deletes the oldest archived tasks of each queue beyond
+// TASK_ARCHIVE_MAX and those archived longer ago than TASK_ARCHIVE_MAX_AGE_HOURS.
+func (st *appState) processArchiveTrimTask(ctx context.Context, _ *asynq.Task) error {
+	for _, name := range st.taskQueues() {
+		deleted, err := st.trimArchivedTasks(ctx, name)
+		if err != nil && !errors.Is(err, asynq.ErrQueueNotFound) {
+			return err
+		}
+		if deleted > 0 {
+			logger.Info("trimmed archived tasks", "queue", name, "deleted", deleted)
+		}
+	}
+	return nil
+}
+
+func (st *appState) trimArchivedTasks(ctx context.Context, queue string) (int, error) {
+	q, err := st.inspector.GetQueueInfo(queue)
+	if err != nil {
+		return 0, err
+	}
+	excess := 0
+	if st.cfg.taskArchiveMax > 0 {
+		excess = max(q.Archived-st.cfg.taskArchiveMax, 0)
+	}
+	cutoff := time.Time{}
+	if st.cfg.taskArchiveMaxAge > 0 {
+		cutoff = time.Now().Add(-st.cfg.taskArchiveMaxAge)
+	}
+	deleted := 0
+	for ctx.Err() == nil {
+		// Archived tasks list oldest first, so the first page is always the next to go.
+		tasks, err := st.inspector.ListArchivedTasks(queue, asynq.PageSize(archiveTrimBatch), asynq.Page(1))
+		if err != nil {
+			return deleted, err
+		}
+		removed := 0
+		for _, t := range tasks {
+			if excess <= 0 && !t.LastFailedAt.Before(cutoff) {
+				break
+			}
+			if err := st.inspector.DeleteTask(queue, t.ID); err != nil && !errors.Is(err, asynq.ErrTaskNotFound) {
+				return deleted, err
+			}
+			excess--
+			removed++
+		}
+		deleted += removed
+		if removed < len(tasks) || len(tasks) < archiveTrimBatch {
+			return deleted, nil
+		}
+	}
+	return deleted, ctx.Err()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisConnOpt builds the asynq connection for a single server, a Sentinel-managed
+// master or a Cluster. The go-redis client for task state is made from the same option,
+// so both always talk to the same Redis.
+func redisConnOpt(cfg config) (asynq.RedisConnOpt, error) {
+	tlsConfig, err := redisTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sentinels := splitCSV(cfg.redisSentinelAddrs)
+	cluster := splitCSV(cfg.redisClusterAddrs)
+	switch {
+	case len(sentinels) > 0 && len(cluster) > 0:
+		return nil, errors.New("REDIS_SENTINEL_ADDRS and REDIS_CLUSTER_ADDRS are mutually exclusive")
+	case len(sentinels) > 0:
+		if cfg.redisMasterName == "" {
+			return nil, errors.New("REDIS_SENTINEL_ADDRS requires REDIS_MASTER_NAME")
+		}
+		return asynq.RedisFailoverClientOpt{
+			MasterName:       cfg.redisMasterName,
+			SentinelAddrs:    sentinels,
+			SentinelUsername: cfg.redisSentinelUsername,
+			SentinelPassword: cfg.redisSentinelPassword,
+			Username:         cfg.redisUsername,
+			Password:         cfg.redisPassword,
+			DB:               cfg.redisDB,
+			TLSConfig:        tlsConfig,
+		}, nil
+	case len(cluster) > 0:
+		if cfg.redisDB != 0 {
+			return nil, errors.New("REDIS_DB must be 0 with REDIS_CLUSTER_ADDRS")
+		}
+		return asynq.RedisClusterClientOpt{
+			Addrs:     cluster,
+			Username:  cfg.redisUsername,
+			Password:  cfg.redisPassword,
+			TLSConfig: tlsConfig,
+		}, nil
+	}
+	return asynq.RedisClientOpt{
+		Addr:      cfg.redisAddr,
+		Username:  cfg.redisUsername,
+		Password:  cfg.redisPassword,
+		DB:        cfg.redisDB,
+		TLSConfig: tlsConfig,
+	}, nil
+}
+
+// newRedisClient returns the go-redis client for opt, which is a *redis.Client,
+// a failover *redis.Client or a *redis.ClusterClient.
+func newRedisClient(opt asynq.RedisConnOpt) redis.UniversalClient {
+	return opt.MakeRedisClient().(redis.UniversalClient)
+}
+
+// redisTLSConfig returns nil unless REDIS_TLS is on. A CA file replaces the system roots;
+// a certificate and key pair enables client authentication.
+func redisTLSConfig(cfg config) (*tls.Config, error) {
+	if !cfg.redisTLS {
+		return nil, nil
+	}
+	tc := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.redisTLSServerName,
+		InsecureSkipVerify: cfg.redisTLSInsecure,
+	}
+	if cfg.redisTLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.redisTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("REDIS_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("REDIS_TLS_CA_FILE: no certificates in %s", cfg.redisTLSCAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if (cfg.redisTLSCertFile == "") != (cfg.redisTLSKeyFile == "") {
+		return nil, errors.New("REDIS_TLS_CERT_FILE and REDIS_TLS_KEY_FILE must be set together")
+	}
+	if cfg.redisTLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.redisTLSCertFile, cfg.redisTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("REDIS_TLS_CERT_FILE: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// scanRedisKeys calls fn with every batch of keys matching pattern. SCAN only walks the
+// node it is sent to, so on a Cluster every master is scanned; fn is never called
+// concurrently.
+func scanRedisKeys(ctx context.Context, rdb RedisClient, pattern string, fn func(keys []string)) error {
+	type scanner interface {
+		Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+	}
+	var mu sync.Mutex
+	scan := func(ctx context.Context, c scanner) error {
+		var cursor uint64
+		for {
+			keys, next, err := c.Scan(ctx, cursor, pattern, 200).Result()
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			fn(keys)
+			mu.Unlock()
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+	if cc, ok := rdb.(*redis.ClusterClient); ok {
+		return cc.ForEachMaster(ctx, func(ctx context.Context, c *redis.Client) error {
+			return scan(ctx, c)
+		})
+	}
+	return scan(ctx, rdb)
+}
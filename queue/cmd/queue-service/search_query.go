@@ -0,0 +1,530 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Media kinds selected by has:video / has:image.
+const (
+	mediaKindVideo = "video"
+	mediaKindImage = "image"
+)
+
+// maxQueryTerms bounds the terms of one search query; each becomes a compound SELECT.
+const maxQueryTerms = 64
+
+// Operators of a parsed search query.
+const (
+	queryOpTerm = "term"
+	queryOpAnd  = "and"
+	queryOpOr   = "or"
+	queryOpNot  = "not"
+)
+
+// queryExpr is a node of a parsed search query. Terms carry the text as written; Exact
+// terms (=tag) match a whole tag instead of a substring and Quoted ones are never read as
+// key:value filters. Pos is the 1-based character position, for error messages.
+type queryExpr struct {
+	Op       string
+	Children []*queryExpr
+	Text     string
+	Exact    bool
+	Quoted   bool
+	Pos      int
+}
+
+const (
+	queryTokTerm = iota
+	queryTokLParen
+	queryTokRParen
+	queryTokAnd
+	queryTokOr
+	queryTokNot
+)
+
+type queryToken struct {
+	kind   int
+	text   string
+	exact  bool
+	quoted bool
+	pos    int
+}
+
+// tokenizeSearchQuery splits a search query into terms, parentheses and the AND / OR / NOT
+// operators. "|" is OR and a leading "-" is NOT. Words may contain balanced parentheses so
+// tags like saber_(fate) stay one term.
+func tokenizeSearchQuery(q string) ([]queryToken, error) {
+	runes := []rune(q)
+	tokens := make([]queryToken, 0)
+	isSpace := func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' || r == '\r' }
+	for i := 0; i < len(runes); {
+		r, pos := runes[i], i+1
+		switch {
+		case isSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: queryTokLParen, pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: queryTokRParen, pos: pos})
+			i++
+		case r == '|':
+			tokens = append(tokens, queryToken{kind: queryTokOr, text: "|", pos: pos})
+			i++
+		case r == '-':
+			if i+1 == len(runes) || isSpace(runes[i+1]) {
+				return nil, fmt.Errorf("expected a term after '-' at position %d", pos)
+			}
+			tokens = append(tokens, queryToken{kind: queryTokNot, text: "-", pos: pos})
+			i++
+		default:
+			tok := queryToken{kind: queryTokTerm, pos: pos}
+			if r == '=' {
+				tok.exact = true
+				if i++; i == len(runes) || isSpace(runes[i]) {
+					return nil, fmt.Errorf("expected a tag after '=' at position %d", pos)
+				}
+			}
+			if runes[i] == '"' {
+				end := i + 1
+				for end < len(runes) && runes[end] != '"' {
+					end++
+				}
+				if end == len(runes) {
+					return nil, fmt.Errorf("unterminated quote starting at position %d", i+1)
+				}
+				tok.text, tok.quoted = string(runes[i+1:end]), true
+				if strings.TrimSpace(tok.text) == "" {
+					return nil, fmt.Errorf("empty quoted term at position %d", i+1)
+				}
+				tokens = append(tokens, tok)
+				i = end + 1
+				continue
+			}
+			start, depth := i, 0
+			for ; i < len(runes) && !isSpace(runes[i]) && runes[i] != '"' && runes[i] != '|'; i++ {
+				if runes[i] == '(' {
+					depth++
+				} else if runes[i] == ')' {
+					if depth == 0 {
+						break
+					}
+					depth--
+				}
+			}
+			tok.text = string(runes[start:i])
+			if tok.text == "" {
+				return nil, fmt.Errorf("expected a tag after '=' at position %d", pos)
+			}
+			if !tok.exact {
+				switch tok.text {
+				case "AND":
+					tok.kind = queryTokAnd
+				case "OR":
+					tok.kind = queryTokOr
+				case "NOT":
+					tok.kind = queryTokNot
+				}
+			}
+			tokens = append(tokens, tok)
+		}
+	}
+	return tokens, nil
+}
+
+// parseSearchQuery parses a search query into an expression tree; nil for an empty query.
+//
+//	query   = or
+//	or      = and { ("OR" | "|") and }
+//	and     = unary { ["AND"] unary }        juxtaposed terms are ANDed
+//	unary   = ("NOT" | "-") unary | primary
+//	primary = "(" query ")" | term
+//	term    = word | "quoted words" | =word | ="quoted words"
+//
+// NOT binds tightest, then AND, then OR, so `a OR b c` is `a OR (b AND c)`.
+func parseSearchQuery(q string) (*queryExpr, error) {
+	tokens, err := tokenizeSearchQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	p := &queryParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.tokens) {
+		return nil, p.unexpected(p.tokens[p.i])
+	}
+	if p.terms > maxQueryTerms {
+		return nil, fmt.Errorf("too many terms (%d, max %d)", p.terms, maxQueryTerms)
+	}
+	return expr, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	i      int
+	terms  int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.i < len(p.tokens) {
+		return p.tokens[p.i], true
+	}
+	return queryToken{}, false
+}
+
+func (p *queryParser) unexpected(tok queryToken) error {
+	if tok.kind == queryTokRParen {
+		return fmt.Errorf("unexpected ')' at position %d", tok.pos)
+	}
+	return fmt.Errorf("unexpected %s at position %d", tok.text, tok.pos)
+}
+
+// operand parses the right-hand side of op, reporting a missing one at op's position.
+func (p *queryParser) operand(op queryToken, parse func() (*queryExpr, error)) (*queryExpr, error) {
+	tok, ok := p.peek()
+	if !ok || tok.kind == queryTokRParen || tok.kind == queryTokAnd || tok.kind == queryTokOr {
+		return nil, fmt.Errorf("expected a term after %s at position %d", op.text, op.pos)
+	}
+	return parse()
+}
+
+func (p *queryParser) parseOr() (*queryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != queryTokOr {
+			return left, nil
+		}
+		p.i++
+		right, err := p.operand(tok, p.parseAnd)
+		if err != nil {
+			return nil, err
+		}
+		left = joinQueryExpr(queryOpOr, left, right)
+	}
+}
+
+func (p *queryParser) parseAnd() (*queryExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind == queryTokRParen || tok.kind == queryTokOr {
+			return left, nil
+		}
+		var right *queryExpr
+		if tok.kind == queryTokAnd {
+			p.i++
+			right, err = p.operand(tok, p.parseUnary)
+		} else {
+			right, err = p.parseUnary()
+		}
+		if err != nil {
+			return nil, err
+		}
+		left = joinQueryExpr(queryOpAnd, left, right)
+	}
+}
+
+func (p *queryParser) parseUnary() (*queryExpr, error) {
+	tok, ok := p.peek()
+	if ok && tok.kind == queryTokNot {
+		p.i++
+		operand, err := p.operand(tok, p.parseUnary)
+		if err != nil {
+			return nil, err
+		}
+		return &queryExpr{Op: queryOpNot, Children: []*queryExpr{operand}, Pos: tok.pos}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (*queryExpr, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end of query")
+	}
+	switch tok.kind {
+	case queryTokTerm:
+		p.i++
+		p.terms++
+		return &queryExpr{Op: queryOpTerm, Text: tok.text, Exact: tok.exact, Quoted: tok.quoted, Pos: tok.pos}, nil
+	case queryTokLParen:
+		p.i++
+		if next, ok := p.peek(); ok && next.kind == queryTokRParen {
+			return nil, fmt.Errorf("empty parentheses at position %d", tok.pos)
+		}
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if next, ok := p.peek(); !ok || next.kind != queryTokRParen {
+			return nil, fmt.Errorf("missing ')' for '(' at position %d", tok.pos)
+		}
+		p.i++
+		return expr, nil
+	}
+	return nil, p.unexpected(tok)
+}
+
+// joinQueryExpr combines two expressions with op, flattening chains of the same operator.
+func joinQueryExpr(op string, left, right *queryExpr) *queryExpr {
+	if left == nil {
+		return right
+	}
+	children := make([]*queryExpr, 0, 2)
+	for _, e := range []*queryExpr{left, right} {
+		if e.Op == op {
+			children = append(children, e.Children...)
+		} else {
+			children = append(children, e)
+		}
+	}
+	return &queryExpr{Op: op, Children: children, Pos: left.Pos}
+}
+
+// String renders the expression canonically, for filter signatures.
+func (e *queryExpr) String() string {
+	switch e.Op {
+	case queryOpTerm:
+		text := strconv.Quote(strings.ToLower(e.Text))
+		if e.Exact {
+			return "=" + text
+		}
+		return text
+	case queryOpNot:
+		return "NOT " + e.Children[0].String()
+	}
+	parts := make([]string, 0, len(e.Children))
+	for _, c := range e.Children {
+		parts = append(parts, c.String())
+	}
+	return "(" + strings.Join(parts, " "+strings.ToUpper(e.Op)+" ") + ")"
+}
+
+// filterKey returns the key of a term that sets a filter rather than naming a tag: user,
+// after, before, has, color, or untagged for the bare word.
+func (e *queryExpr) filterKey() (key, value string, ok bool) {
+	if e.Op != queryOpTerm || e.Exact || e.Quoted {
+		return "", "", false
+	}
+	if strings.EqualFold(e.Text, "untagged") {
+		return "untagged", "", true
+	}
+	key, value, hasKey := strings.Cut(e.Text, ":")
+	key = strings.ToLower(key)
+	switch key {
+	case "user", "after", "before", "has", "color":
+		return key, value, hasKey && value != ""
+	}
+	return "", "", false
+}
+
+// checkTagsOnly rejects filter terms below OR and NOT, which only apply to the whole query.
+func (e *queryExpr) checkTagsOnly() error {
+	if key, _, ok := e.filterKey(); ok {
+		if key != "untagged" {
+			key += ":"
+		}
+		return fmt.Errorf("%s cannot be used inside OR or NOT groups (position %d)", key, e.Pos)
+	}
+	for _, c := range e.Children {
+		if err := c.checkTagsOnly(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagAlternatives returns the patterns of a term or of an OR of terms, exact ones as
+// "=tag", when the expression fits the tags / exclude_tags form.
+func (e *queryExpr) tagAlternatives() ([]string, bool) {
+	switch e.Op {
+	case queryOpTerm:
+		p, ok := e.tagPattern()
+		return []string{p}, ok
+	case queryOpOr:
+		alts := make([]string, 0, len(e.Children))
+		for _, c := range e.Children {
+			if c.Op != queryOpTerm {
+				return nil, false
+			}
+			p, ok := c.tagPattern()
+			if !ok {
+				return nil, false
+			}
+			alts = append(alts, p)
+		}
+		return alts, true
+	}
+	return nil, false
+}
+
+// tagPattern is a term as a tag pattern. Quoted tags that themselves start with "=" or
+// contain "|" cannot be written that way and stay in the TagQuery.
+func (e *queryExpr) tagPattern() (string, bool) {
+	if strings.HasPrefix(e.Text, exactTagPrefix) || strings.Contains(e.Text, "|") {
+		return "", false
+	}
+	if e.Exact {
+		return exactTagPrefix + e.Text, true
+	}
+	return e.Text, true
+}
+
+// applyQuery narrows f with a search query such as `cat -dog user:alice after:2024-01-01
+// has:video` or `(cat OR dog) AND NOT =sketch`. Terms:
+//
+//	tag, -tag            require or exclude a tag pattern (substring match)
+//	=tag                 match the whole tag only, e.g. =cat does not match cat_ears
+//	ns:*, -ns:*          require or exclude any tag of a namespace, e.g. character:*
+//	a OR b, a | b        either; AND (or plain juxtaposition) requires both
+//	NOT a, -a, -(a|b)    exclude; NOT binds tightest, then AND, then OR
+//	user:NAME            only files of one user
+//	rating:R, -rating:R  require or exclude the autotagger's rating:R tag
+//	after:D, before:D    mtime on or after D, strictly before D (YYYY-MM-DD or RFC3339)
+//	has:video, has:image only MP4s, or everything else; -has:video equals has:image
+//	color:C, -color:C    C is mono (grayscale, sketches) or color; -color:mono equals color:color
+//	color:NAME|#HEX      a dominant color near a color name (red, blue...) or #rrggbb
+//	untagged, -untagged  files with no tags, or with at least one
+//
+// Filter terms (user:, after:, before:, has:, color:, untagged) apply to the whole query
+// and cannot appear inside OR or NOT groups. Any other key:value term is treated as a tag
+// so tags containing colons still work. Bounds already set on f are only ever tightened.
+func (f *imageFilter) applyQuery(q string) error {
+	root, err := parseSearchQuery(q)
+	if err != nil || root == nil {
+		return err
+	}
+	conjuncts := []*queryExpr{root}
+	if root.Op == queryOpAnd {
+		conjuncts = root.Children
+	}
+	for _, conj := range conjuncts {
+		negate := conj.Op == queryOpNot
+		inner := conj
+		if negate {
+			inner = conj.Children[0]
+		}
+		if key, value, ok := inner.filterKey(); ok {
+			if err := f.applyFilterTerm(key, value, negate); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := conj.checkTagsOnly(); err != nil {
+			return err
+		}
+		if alts, ok := inner.tagAlternatives(); ok {
+			if negate {
+				f.ExcludeTags = append(f.ExcludeTags, alts...)
+			} else {
+				f.Tags = append(f.Tags, strings.Join(alts, "|"))
+			}
+			continue
+		}
+		// Everything else is evaluated as a whole by FindFilesByTagQuery.
+		f.TagQuery = joinQueryExpr(queryOpAnd, f.TagQuery, conj)
+	}
+	return nil
+}
+
+func (f *imageFilter) applyFilterTerm(key, value string, negate bool) error {
+	switch key {
+	case "user":
+		if negate {
+			return errors.New("-user: is not supported")
+		}
+		if strings.ContainsAny(value, `/\`) {
+			return errors.New("invalid user")
+		}
+		if f.User != "" && !strings.EqualFold(f.User, value) {
+			return errors.New("conflicting user filters")
+		}
+		f.User = value
+	case "after", "before":
+		if negate {
+			return fmt.Errorf("-%s: is not supported", key)
+		}
+		t, err := parseDateParam(value, false)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if key == "after" {
+			if f.From.IsZero() || t.After(f.From) {
+				f.From = t
+			}
+		} else {
+			t = t.Add(-time.Millisecond)
+			if f.To.IsZero() || t.Before(f.To) {
+				f.To = t
+			}
+		}
+	case "has":
+		kind := strings.ToLower(value)
+		if kind != mediaKindVideo && kind != mediaKindImage {
+			return fmt.Errorf("unknown has:%s", value)
+		}
+		if negate {
+			kind = map[string]string{mediaKindVideo: mediaKindImage, mediaKindImage: mediaKindVideo}[kind]
+		}
+		if f.Media != "" && f.Media != kind {
+			return errors.New("conflicting has: filters")
+		}
+		f.Media = kind
+	case "color":
+		return f.setColor(value, negate)
+	case "untagged":
+		if negate {
+			f.MinTagCount = max(f.MinTagCount, 1)
+		} else {
+			f.MaxTagCount = 0
+		}
+	}
+	return nil
+}
+
+// setColor narrows f to a color class (mono or color) or to images with a dominant color
+// near a named or hex color; an empty value leaves it unchanged.
+func (f *imageFilter) setColor(value string, negate bool) error {
+	class := strings.ToLower(strings.TrimSpace(value))
+	if class == "" {
+		return nil
+	}
+	if class != colorClassMono && class != colorClassColor {
+		palette, ok := normalizePaletteColor(class)
+		if !ok {
+			return fmt.Errorf("unknown color:%s (mono, color, a color name or #rrggbb)", value)
+		}
+		if negate {
+			return errors.New("-color: only supports mono and color")
+		}
+		if f.Palette != "" && f.Palette != palette {
+			return errors.New("conflicting color filters")
+		}
+		f.Palette = palette
+		return nil
+	}
+	if negate {
+		class = map[string]string{colorClassMono: colorClassColor, colorClassColor: colorClassMono}[class]
+	}
+	if f.Color != "" && f.Color != class {
+		return errors.New("conflicting color filters")
+	}
+	f.Color = class
+	return nil
+}
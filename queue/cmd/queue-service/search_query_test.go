@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"blank", "  \t ", ""},
+		{"single term", "cat", `"cat"`},
+		{"juxtaposition is and", "cat dog", `("cat" AND "dog")`},
+		{"explicit and", "cat AND dog", `("cat" AND "dog")`},
+		{"lowercase and is a term", "cat and dog", `("cat" AND "and" AND "dog")`},
+		{"or", "cat OR dog", `("cat" OR "dog")`},
+		{"pipe is or", "cat|dog", `("cat" OR "dog")`},
+		{"or chain flattens", "a OR b | c", `("a" OR "b" OR "c")`},
+		{"and binds tighter than or", "a OR b c", `("a" OR ("b" AND "c"))`},
+		{"and before or", "a AND b OR c", `(("a" AND "b") OR "c")`},
+		{"parentheses group", "(a OR b) c", `(("a" OR "b") AND "c")`},
+		{"nested parentheses", "((a))", `"a"`},
+		{"not binds tightest", "NOT a b", `(NOT "a" AND "b")`},
+		{"not over or operand", "a OR NOT b", `("a" OR NOT "b")`},
+		{"dash negates", "-a", `NOT "a"`},
+		{"dash negates group", "-(a|b)", `NOT ("a" OR "b")`},
+		{"double negation", "NOT -a", `NOT NOT "a"`},
+		{"exact term", "=cat", `="cat"`},
+		{"negated exact term", "-=cat", `NOT ="cat"`},
+		{"quoted term", `"blue sky"`, `"blue sky"`},
+		{"quoted exact term", `="Blue Sky"`, `="blue sky"`},
+		{"quoted operator is a term", `"OR" cat`, `("or" AND "cat")`},
+		{"quoted pipe is a term", `"a|b"`, `"a|b"`},
+		{"term with parentheses", "saber_(fate) OR x", `("saber_(fate)" OR "x")`},
+		{"term before closing paren", "(saber_(fate))", `"saber_(fate)"`},
+		{"dash inside a word", "a-b", `"a-b"`},
+		{"key value term", "user:alice cat", `("user:alice" AND "cat")`},
+		{"terms are lowercased", "Cat", `"cat"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parseSearchQuery(tt.in)
+			if err != nil {
+				t.Fatalf("parseSearchQuery(%q) error: %v", tt.in, err)
+			}
+			got := ""
+			if expr != nil {
+				got = expr.String()
+			}
+			if got != tt.want {
+				t.Fatalf("parseSearchQuery(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchQueryMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{"trailing or", "cat OR", "expected a term after OR at position 5"},
+		{"leading or", "OR cat", "unexpected OR at position 1"},
+		{"trailing pipe", "cat |", "expected a term after | at position 5"},
+		{"trailing and", "cat AND", "expected a term after AND at position 5"},
+		{"and then or", "cat AND OR dog", "expected a term after AND at position 5"},
+		{"bare not", "NOT", "expected a term after NOT at position 1"},
+		{"dash before space", "- cat", "expected a term after '-' at position 1"},
+		{"trailing dash", "cat -", "expected a term after '-' at position 5"},
+		{"bare equals", "=", "expected a tag after '=' at position 1"},
+		{"equals before space", "= cat", "expected a tag after '=' at position 1"},
+		{"unclosed paren", "(cat", "missing ')' for '(' at position 1"},
+		{"stray close paren", "cat)", "unexpected ')' at position 4"},
+		{"empty parens", "()", "empty parentheses at position 1"},
+		{"unterminated quote", `"cat`, "unterminated quote starting at position 1"},
+		{"empty quote", `""`, "empty quoted term at position 1"},
+		{"too many terms", strings.Repeat("t ", maxQueryTerms+1), "too many terms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parseSearchQuery(tt.in)
+			if err == nil {
+				t.Fatalf("parseSearchQuery(%q) = %v, want error", tt.in, expr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseSearchQuery(%q) error = %q, want %q", tt.in, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyQueryNegation(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          string
+		wantTags    []string
+		wantExclude []string
+		wantQuery   bool
+		wantErr     string
+	}{
+		{name: "tags and exclusions", in: "cat -dog =sketch", wantTags: []string{"cat", "=sketch"}, wantExclude: []string{"dog"}},
+		{name: "negated or excludes each", in: "-(dog|=bird)", wantExclude: []string{"dog", "=bird"}},
+		{name: "or of tags is one alternative", in: "cat OR dog", wantTags: []string{"cat|dog"}},
+		{name: "nested group stays a query", in: "(cat dog) OR bird", wantQuery: true},
+		{name: "filter under or", in: "cat OR user:alice", wantErr: "user: cannot be used inside OR or NOT groups"},
+		{name: "filter under not", in: "NOT (cat has:video)", wantErr: "has: cannot be used inside OR or NOT groups"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := imageFilter{MinTagCount: -1, MaxTagCount: -1}
+			err := f.applyQuery(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyQuery(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyQuery(%q) error: %v", tt.in, err)
+			}
+			if strings.Join(f.Tags, ",") != strings.Join(tt.wantTags, ",") {
+				t.Errorf("Tags = %v, want %v", f.Tags, tt.wantTags)
+			}
+			if strings.Join(f.ExcludeTags, ",") != strings.Join(tt.wantExclude, ",") {
+				t.Errorf("ExcludeTags = %v, want %v", f.ExcludeTags, tt.wantExclude)
+			}
+			if (f.TagQuery != nil) != tt.wantQuery {
+				t.Errorf("TagQuery = %v, want set=%v", f.TagQuery, tt.wantQuery)
+			}
+		})
+	}
+}
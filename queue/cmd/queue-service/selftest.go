@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// selftestDefaultTweet is a long-lived public tweet for the syndication API probe.
+const selftestDefaultTweet = "20"
+
+const (
+	selftestOK   = "ok"
+	selftestFail = "fail"
+	selftestSkip = "skip"
+)
+
+type selftestOptions struct {
+	TweetID string
+	Tagger  bool
+}
+
+// selftestCheck is one step of the self-test report.
+type selftestCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Message    string `json:"message,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type selftestReport struct {
+	OK     bool            `json:"ok"`
+	Checks []selftestCheck `json:"checks"`
+}
+
+type selftestRun struct {
+	report selftestReport
+}
+
+// check runs fn as the named step. fn returns a short detail on success; errSelftestSkip
+// wrapped in its error marks the step as not applicable.
+func (r *selftestRun) check(name string, fn func() (string, error)) bool {
+	start := time.Now()
+	msg, err := fn()
+	c := selftestCheck{Name: name, Status: selftestOK, Message: msg, DurationMs: time.Since(start).Milliseconds()}
+	switch {
+	case errors.Is(err, errSelftestSkip):
+		c.Status, c.Message = selftestSkip, err.Error()
+	case err != nil:
+		c.Status, c.Message = selftestFail, err.Error()
+	}
+	r.report.Checks = append(r.report.Checks, c)
+	return c.Status != selftestFail
+}
+
+var errSelftestSkip = errors.New("skipped")
+
+// runSelftest checks that this deployment can run: the configuration parses, Redis
+// answers, the store opens, MEDIA_ROOT is writable, the syndication API is reachable
+// through the configured proxy and headers and, when asked, the autotagger is healthy.
+// It prints a JSON report and returns the exit code: 0 when no check failed.
+func runSelftest(cfg config, opts selftestOptions) int {
+	ctx := context.Background()
+	run := &selftestRun{}
+
+	client := newSharedHTTPClient(15*time.Second, nil)
+	configOK := run.check("config", func() (string, error) {
+		if _, err := redisConnOpt(cfg); err != nil {
+			return "", err
+		}
+		if _, err := newPayloadCodec(cfg); err != nil {
+			return "", err
+		}
+		if err := validateCreatorTagPrefix(cfg.creatorTagPrefix); err != nil {
+			return "", err
+		}
+		if _, err := newHeuristicTagger(cfg); err != nil {
+			return "", err
+		}
+		if _, err := loadXAuthSession(cfg); err != nil {
+			return "", err
+		}
+		proxies, err := newProxySelector(cfg.proxyURL, cfg.proxyHosts)
+		if err != nil {
+			return "", err
+		}
+		var downloadProxy proxyFunc
+		if proxies != nil {
+			downloadProxy = proxies.proxy
+		}
+		client = newSharedHTTPClient(15*time.Second, downloadProxy)
+		headers, err := newHeaderTransport(client.Transport, cfg.downloadUserAgent, cfg.downloadUserAgentFile, cfg.downloadHeaders)
+		if err != nil {
+			return "", err
+		}
+		client.Transport = headers
+		return "", nil
+	})
+
+	run.check("redis", func() (string, error) {
+		if !configOK {
+			return "", fmt.Errorf("%w: configuration is invalid", errSelftestSkip)
+		}
+		opt, err := redisConnOpt(cfg)
+		if err != nil {
+			return "", err
+		}
+		rdb := newRedisClient(opt)
+		defer rdb.Close()
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			return "", err
+		}
+		switch opt.(type) {
+		case asynq.RedisFailoverClientOpt:
+			return "sentinel " + cfg.redisMasterName, nil
+		case asynq.RedisClusterClientOpt:
+			return "cluster", nil
+		}
+		return cfg.redisAddr, nil
+	})
+
+	run.check("store", func() (string, error) {
+		s, err := openStore(cfg.dbPath, storeOptions{
+			slowQueryThreshold: time.Duration(cfg.slowQueryMs) * time.Millisecond,
+			tagPolicy:          parseTagPolicy(cfg.tagCase, cfg.tagSeparator),
+		})
+		if err != nil {
+			return "", err
+		}
+		defer s.Close()
+		count, _, err := s.ImageIndexUsage()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s (%d indexed files)", cfg.dbPath, count), nil
+	})
+
+	run.check("media_root", func() (string, error) {
+		return cfg.mediaRoot, checkWritableDir(cfg.mediaRoot)
+	})
+	if cfg.mirrorRoot != "" {
+		run.check("mirror_root", func() (string, error) {
+			return cfg.mirrorRoot, checkWritableDir(cfg.mirrorRoot)
+		})
+	}
+
+	run.check("syndication", func() (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		defer cancel()
+		media, _, err := fetchSyndicationTweetMedia(ctx, client, opts.TweetID)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("tweet %s: %d media", opts.TweetID, len(media)), nil
+	})
+
+	run.check("autotagger", func() (string, error) {
+		if !opts.Tagger {
+			return "", fmt.Errorf("%w: pass -selftest-tagger to probe", errSelftestSkip)
+		}
+		if !cfg.autotaggerEnable || cfg.autotaggerURL == "" {
+			return "", errors.New("AUTOTAGGER and AUTOTAGGER_URL are not set")
+		}
+		return probeAutotagger(ctx, cfg.autotaggerURL)
+	})
+
+	run.report.OK = true
+	for _, c := range run.report.Checks {
+		if c.Status == selftestFail {
+			run.report.OK = false
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(run.report)
+	if !run.report.OK {
+		return 1
+	}
+	return 0
+}
+
+// checkWritableDir creates dir if needed and writes and removes a probe file in it.
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	_, err = f.WriteString("ok")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if rerr := os.Remove(name); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(name), err)
+	}
+	return nil
+}
+
+// probeAutotagger calls /healthz on the host of AUTOTAGGER_URL, which serves tagging on
+// another path.
+func probeAutotagger(ctx context.Context, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid AUTOTAGGER_URL %q", rawURL)
+	}
+	u.Path, u.RawQuery = "/healthz", ""
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	resp, err := newSharedHTTPClient(10*time.Second, nil).Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("%s status=%d", u.String(), resp.StatusCode)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type serverTimingKey struct{}
+
+// serverTimingStages describes the stages measured by the listing handlers.
+var serverTimingStages = map[string]string{
+	"fs":        "filesystem walk",
+	"sqlite":    "sqlite queries",
+	"redis":     "redis lookups",
+	"serialize": "json encoding",
+}
+
+// serverTiming accumulates per-stage durations of one request for the Server-Timing header.
+type serverTiming struct {
+	mu    sync.Mutex
+	order []string
+	durs  map[string]time.Duration
+}
+
+// timingFrom returns the request's timing collector, or nil when debug timing is off.
+// All methods are nil-safe so call sites need no checks.
+func timingFrom(ctx context.Context) *serverTiming {
+	t, _ := ctx.Value(serverTimingKey{}).(*serverTiming)
+	return t
+}
+
+func (t *serverTiming) since(stage string, start time.Time) {
+	if t == nil {
+		return
+	}
+	d := time.Since(start)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.durs[stage]; !ok {
+		t.order = append(t.order, stage)
+	}
+	t.durs[stage] += d
+}
+
+func (t *serverTiming) header(total time.Duration) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, 0, len(t.order)+1)
+	for _, stage := range t.order {
+		ms := float64(t.durs[stage].Microseconds()) / 1000
+		if desc, ok := serverTimingStages[stage]; ok {
+			parts = append(parts, fmt.Sprintf("%s;desc=%q;dur=%.2f", stage, desc, ms))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s;dur=%.2f", stage, ms))
+		}
+	}
+	parts = append(parts, fmt.Sprintf("total;dur=%.2f", float64(total.Microseconds())/1000))
+	return strings.Join(parts, ", ")
+}
+
+// timingWriter emits the Server-Timing header right before the status line is written.
+type timingWriter struct {
+	http.ResponseWriter
+	timing      *serverTiming
+	start       time.Time
+	wroteHeader bool
+}
+
+func (w *timingWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("Server-Timing", w.timing.header(time.Since(w.start)))
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timingWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// withServerTiming enables the Server-Timing breakdown on h when SERVER_TIMING is set.
+func (st *appState) withServerTiming(h http.HandlerFunc) http.HandlerFunc {
+	if !st.cfg.serverTiming {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		timing := &serverTiming{durs: make(map[string]time.Duration)}
+		ctx := context.WithValue(r.Context(), serverTimingKey{}, timing)
+		h(&timingWriter{ResponseWriter: w, timing: timing, start: time.Now()}, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Bounds accepted for the numeric settings.
+const (
+	settingsMaxPerPage       = 500
+	settingsMinThumbnailSize = 80
+	settingsMaxThumbnailSize = 512
+)
+
+// instanceSettings are the UI defaults the frontend reads from /api/settings.
+type instanceSettings struct {
+	DefaultSort    string `json:"default_sort"`
+	DefaultPerPage int    `json:"default_per_page"`
+	NSFWVisible    bool   `json:"nsfw_visible"`
+	ThumbnailSize  int    `json:"thumbnail_size"`
+}
+
+// settingsPatch is a partial update; nil fields are left unchanged.
+type settingsPatch struct {
+	DefaultSort    *string `json:"default_sort"`
+	DefaultPerPage *int    `json:"default_per_page"`
+	NSFWVisible    *bool   `json:"nsfw_visible"`
+	ThumbnailSize  *int    `json:"thumbnail_size"`
+}
+
+func (s instanceSettings) validate() error {
+	switch s.DefaultSort {
+	case "latest", "random", "popular", "rating":
+	default:
+		return errors.New("default_sort must be latest, random, popular or rating")
+	}
+	if s.DefaultPerPage < 1 || s.DefaultPerPage > settingsMaxPerPage {
+		return errors.New("default_per_page must be between 1 and 500")
+	}
+	if s.ThumbnailSize < settingsMinThumbnailSize || s.ThumbnailSize > settingsMaxThumbnailSize {
+		return errors.New("thumbnail_size must be between 80 and 512")
+	}
+	return nil
+}
+
+func (s instanceSettings) values() map[string]string {
+	return map[string]string{
+		"default_sort":     s.DefaultSort,
+		"default_per_page": strconv.Itoa(s.DefaultPerPage),
+		"nsfw_visible":     strconv.FormatBool(s.NSFWVisible),
+		"thumbnail_size":   strconv.Itoa(s.ThumbnailSize),
+	}
+}
+
+// withValues overlays stored values on s. Unparsable values keep the current field.
+func (s instanceSettings) withValues(values map[string]string) instanceSettings {
+	if v, ok := values["default_sort"]; ok {
+		s.DefaultSort = v
+	}
+	if v, err := strconv.Atoi(values["default_per_page"]); err == nil {
+		s.DefaultPerPage = v
+	}
+	if v, err := strconv.ParseBool(values["nsfw_visible"]); err == nil {
+		s.NSFWVisible = v
+	}
+	if v, err := strconv.Atoi(values["thumbnail_size"]); err == nil {
+		s.ThumbnailSize = v
+	}
+	return s
+}
+
+func (s instanceSettings) apply(p settingsPatch) instanceSettings {
+	if p.DefaultSort != nil {
+		s.DefaultSort = strings.ToLower(strings.TrimSpace(*p.DefaultSort))
+	}
+	if p.DefaultPerPage != nil {
+		s.DefaultPerPage = *p.DefaultPerPage
+	}
+	if p.NSFWVisible != nil {
+		s.NSFWVisible = *p.NSFWVisible
+	}
+	if p.ThumbnailSize != nil {
+		s.ThumbnailSize = *p.ThumbnailSize
+	}
+	return s
+}
+
+// defaultSettings are the environment-provided values used to seed the settings table.
+func defaultSettings(cfg config) instanceSettings {
+	return instanceSettings{
+		DefaultSort:    strings.ToLower(cfg.defaultSort),
+		DefaultPerPage: cfg.defaultPerPage,
+		NSFWVisible:    cfg.nsfwVisible,
+		ThumbnailSize:  cfg.thumbnailSize,
+	}
+}
+
+// seedSettings stores the environment defaults for keys that were never saved.
+func seedSettings(store TagStore, cfg config) error {
+	defaults := defaultSettings(cfg)
+	if err := defaults.validate(); err != nil {
+		return fmt.Errorf("invalid settings environment: %w", err)
+	}
+	return store.SaveSettings(defaults.values(), false)
+}
+
+func (st *appState) loadSettings() (instanceSettings, error) {
+	values, err := st.store.GetSettings()
+	if err != nil {
+		return instanceSettings{}, err
+	}
+	return defaultSettings(st.cfg).withValues(values), nil
+}
+
+func (st *appState) handleSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := st.loadSettings()
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, settings)
+	case http.MethodPut:
+		var patch settingsPatch
+		if !decodeJSONOrBadRequest(w, r, &patch, "invalid settings") {
+			return
+		}
+		current, err := st.loadSettings()
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		next := current.apply(patch)
+		if err := next.validate(); err != nil {
+			badRequest(w, err.Error())
+			return
+		}
+		if err := st.store.SaveSettings(next.values(), true); err != nil {
+			internalServerError(w)
+			return
+		}
+		logger.Info("settings updated", "settings", next)
+		writeJSON(w, http.StatusOK, next)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	shareKindImage      = "image"
+	shareKindTweet      = "tweet"
+	shareKindCollection = "collection"
+
+	shareSecretSetting = "share_secret"
+	sharePerPage       = 100
+)
+
+// loadShareKey returns the key that signs share links: SHARE_SECRET, or else a random
+// secret generated once and kept in the settings table so links survive restarts.
+func loadShareKey(store TagStore, cfg config) ([]byte, error) {
+	if cfg.shareSecret != "" {
+		return []byte(cfg.shareSecret), nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	if err := store.SaveSettings(map[string]string{shareSecretSetting: hex.EncodeToString(b)}, false); err != nil {
+		return nil, err
+	}
+	values, err := store.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(values[shareSecretSetting]), nil
+}
+
+// shareToken is "{id}.{signature}"; the signature covers what the link grants, so a token
+// cannot be forged or pointed elsewhere without the key.
+func (st *appState) shareToken(l shareLink) string {
+	mac := hmac.New(sha256.New, st.shareKey)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d", l.ID, l.Kind, l.Target, l.ExpiresAt)
+	return l.ID + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:18])
+}
+
+// shareLinkItem is a share link as listed to its owner, with the public URL.
+type shareLinkItem struct {
+	shareLink
+	Token  string `json:"token"`
+	URL    string `json:"url"`
+	Status string `json:"status"`
+}
+
+func (st *appState) newShareLinkItem(r *http.Request, l shareLink) shareLinkItem {
+	status := "active"
+	switch {
+	case l.RevokedAt > 0:
+		status = "revoked"
+	case time.Now().UnixMilli() >= l.ExpiresAt:
+		status = "expired"
+	}
+	token := st.shareToken(l)
+	return shareLinkItem{shareLink: l, Token: token, URL: st.publicBaseURL(r) + "/share/" + token, Status: status}
+}
+
+type shareRequest struct {
+	Kind string `json:"kind"`
+	// Target is a filepath, "username/tweet_id" or a collection ID.
+	Target         string `json:"target"`
+	ExpiresInHours int    `json:"expires_in_hours"`
+}
+
+func (st *appState) handleShares(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		links, err := st.store.ListShareLinks()
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		items := make([]shareLinkItem, 0, len(links))
+		for _, l := range links {
+			items = append(items, st.newShareLinkItem(r, l))
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost:
+		var body shareRequest
+		if !decodeJSONOrBadRequest(w, r, &body, "kind and target are required") {
+			return
+		}
+		if body.ExpiresInHours < 0 {
+			badRequest(w, "expires_in_hours must be positive")
+			return
+		}
+		hours := body.ExpiresInHours
+		if hours == 0 {
+			hours = st.cfg.shareDefaultHours
+		}
+		target, ok, err := st.normalizeShareTarget(strings.TrimSpace(body.Kind), body.Target)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "share target not found", "kind": body.Kind, "target": body.Target})
+			return
+		}
+		id := make([]byte, 12)
+		if _, err := rand.Read(id); err != nil {
+			internalServerError(w)
+			return
+		}
+		now := time.Now()
+		l := shareLink{
+			ID:        base64.RawURLEncoding.EncodeToString(id),
+			Kind:      strings.TrimSpace(body.Kind),
+			Target:    target,
+			ExpiresAt: now.Add(time.Duration(hours) * time.Hour).UnixMilli(),
+			CreatedAt: now.UnixMilli(),
+		}
+		if err := st.store.CreateShareLink(l); err != nil {
+			internalServerError(w)
+			return
+		}
+		logger.Info("share link created", "id", l.ID, "kind", l.Kind, "target", l.Target, "hours", hours)
+		writeJSON(w, http.StatusCreated, map[string]any{"success": true, "item": st.newShareLinkItem(r, l)})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// normalizeShareTarget checks that what a new link points at exists and returns it in the
+// form stored with the link. The bool is false for an unknown kind or a missing target.
+func (st *appState) normalizeShareTarget(kind, raw string) (string, bool, error) {
+	switch kind {
+	case shareKindImage:
+		rel := normalizeFilepath(raw)
+		fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+		if err != nil || !isImageFile(rel) {
+			return "", false, nil
+		}
+		if info, err := os.Stat(fullPath); err != nil || info.IsDir() {
+			return "", false, nil
+		}
+		return rel, true, nil
+	case shareKindTweet:
+		user, tweetID, _ := strings.Cut(strings.TrimSpace(raw), "/")
+		username, ok := normalizeUsername(user)
+		if _, err := strconv.ParseUint(tweetID, 10, 64); !ok || err != nil {
+			return "", false, nil
+		}
+		target := username + "/" + tweetID
+		return target, len(st.tweetSharePaths(target)) > 0, nil
+	case shareKindCollection:
+		id, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return "", false, nil
+		}
+		_, found, err := st.store.GetCollection(id)
+		return strconv.FormatInt(id, 10), found, err
+	}
+	return "", false, nil
+}
+
+// tweetSharePaths lists the stored images of a "username/tweet_id" target.
+func (st *appState) tweetSharePaths(target string) []string {
+	username, tweetID, _ := strings.Cut(target, "/")
+	userPath := filepath.Join(st.cfg.mediaRoot, username)
+	entries, err := os.ReadDir(userPath)
+	if err != nil {
+		return nil
+	}
+	paths := st.groupUserImagesByTweet(userPath, entries)[tweetID]
+	sort.Strings(paths)
+	return paths
+}
+
+// handleSharesSubroutes serves GET and DELETE (revoke) /api/shares/{id}.
+func (st *appState) handleSharesSubroutes(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/shares/"), "/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	l, found, err := st.store.GetShareLink(id)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "share link not found"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, st.newShareLinkItem(r, l))
+	case http.MethodDelete:
+		if _, err := st.store.RevokeShareLink(id); err != nil {
+			internalServerError(w)
+			return
+		}
+		logger.Info("share link revoked", "id", id)
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "id": id})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// shareImage is one image of an opened share link.
+type shareImage struct {
+	Path      string `json:"path"`
+	MediaType string `json:"media_type"`
+	// URL serves the file through the link, relative to the API origin.
+	URL string `json:"url"`
+}
+
+// handleShareOpen serves the public side of share links without any other credentials:
+// GET /share/{token} describes what is shared and GET /share/{token}/media/{path} serves
+// one of its files.
+func (st *appState) handleShareOpen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/share/")
+	token, mediaPath, isMedia := strings.Cut(rest, "/media/")
+	token = strings.Trim(token, "/")
+	l, ok := st.resolveShareToken(w, token)
+	if !ok {
+		return
+	}
+	if isMedia {
+		if !st.shareContains(l, mediaPath) {
+			http.NotFound(w, r)
+			return
+		}
+		st.serveMediaFile(w, r, mediaPath)
+		return
+	}
+
+	page := parsePositiveInt(r.URL.Query().Get("page"), 1)
+	resp := map[string]any{"kind": l.Kind, "expires_at": l.ExpiresAt}
+	var paths []string
+	total := 0
+	switch l.Kind {
+	case shareKindImage:
+		paths, total = []string{l.Target}, 1
+		resp["title"] = filepath.Base(l.Target)
+	case shareKindTweet:
+		all := st.tweetSharePaths(l.Target)
+		total = len(all)
+		start, end := pageBounds((page-1)*sharePerPage, sharePerPage, total)
+		paths = all[start:end]
+		username, tweetID, _ := strings.Cut(l.Target, "/")
+		resp["title"] = "@" + username
+		if metas, err := st.store.GetTweetMetas([]string{tweetID}); err == nil {
+			if m, ok := metas[tweetID]; ok {
+				resp["tweet"] = m
+			}
+		}
+	case shareKindCollection:
+		id, _ := strconv.ParseInt(l.Target, 10, 64)
+		c, found, err := st.store.GetCollection(id)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if !found {
+			writeJSON(w, http.StatusGone, map[string]any{"error": "shared collection was deleted"})
+			return
+		}
+		resp["title"] = c.Name
+		resp["description"] = c.Description
+		if paths, total, err = st.store.ListCollectionItems(id, (page-1)*sharePerPage, sharePerPage); err != nil {
+			internalServerError(w)
+			return
+		}
+	}
+	if r.Method == http.MethodGet && page == 1 {
+		if err := st.store.RecordShareAccess(l.ID); err != nil {
+			logger.Warn("failed to record share access", "id", l.ID, "error", err)
+		}
+	}
+	items := make([]shareImage, 0, len(paths))
+	for _, p := range paths {
+		items = append(items, shareImage{Path: p, MediaType: mediaTypeFromPath(p), URL: "/share/" + token + "/media/" + p})
+	}
+	resp["items"] = items
+	resp["total_items"] = total
+	resp["per_page"] = sharePerPage
+	resp["current_page"] = page
+	resp["total_pages"] = totalPages(total, sharePerPage)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// resolveShareToken checks the signature and state of a link and writes the error itself
+// when it cannot be opened.
+func (st *appState) resolveShareToken(w http.ResponseWriter, token string) (shareLink, bool) {
+	id, _, _ := strings.Cut(token, ".")
+	l, found, err := st.store.GetShareLink(id)
+	if err != nil {
+		internalServerError(w)
+		return shareLink{}, false
+	}
+	if !found || !hmac.Equal([]byte(token), []byte(st.shareToken(l))) {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "share link not found"})
+		return shareLink{}, false
+	}
+	if l.RevokedAt > 0 {
+		writeJSON(w, http.StatusGone, map[string]any{"error": "share link was revoked"})
+		return shareLink{}, false
+	}
+	if time.Now().UnixMilli() >= l.ExpiresAt {
+		writeJSON(w, http.StatusGone, map[string]any{"error": "share link expired"})
+		return shareLink{}, false
+	}
+	return l, true
+}
+
+func (st *appState) shareContains(l shareLink, rel string) bool {
+	switch l.Kind {
+	case shareKindImage:
+		return rel == l.Target
+	case shareKindTweet:
+		for _, p := range st.tweetSharePaths(l.Target) {
+			if p == rel {
+				return true
+			}
+		}
+	case shareKindCollection:
+		id, _ := strconv.ParseInt(l.Target, 10, 64)
+		paths, _, err := st.store.ListCollectionItems(id, 0, -1)
+		if err != nil {
+			return false
+		}
+		for _, p := range paths {
+			if p == rel {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// heatmapDay is the number of files archived on one calendar day.
+type heatmapDay struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// archivedMTimes returns the mtimes of the media files modified in [from, to). The image
+// index answers once a reconcile has built it; before that the media root is walked.
+func (st *appState) archivedMTimes(ctx context.Context, username string, from, to time.Time) ([]int64, string, error) {
+	timing := timingFrom(ctx)
+	start := time.Now()
+	built, err := st.store.ImageIndexBuiltAt()
+	if err != nil {
+		return nil, "", err
+	}
+	if !built.IsZero() {
+		mtimes, err := st.store.ListImageMTimes(username, from.UnixMilli(), to.UnixMilli())
+		timing.since("sqlite", start)
+		return mtimes, "index", err
+	}
+
+	defer timing.since("fs", time.Now())
+	root := st.cfg.mediaRoot
+	if username != "" {
+		root, err = resolvePathUnderRoot(st.cfg.mediaRoot, username)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	scanCtx, cancel := st.scanContext(ctx)
+	defer cancel()
+	mtimes := make([]int64, 0)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if ctxErr := scanCtx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") || !isImageFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if mt := info.ModTime(); !mt.Before(from) && mt.Before(to) {
+			mtimes = append(mtimes, mt.UnixMilli())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", scanError(err)
+	}
+	return mtimes, "scan", nil
+}
+
+// handleStats returns library counters; inbox_count is the number of downloads still
+// waiting for review.
+func (st *appState) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	inbox, err := st.store.CountInbox()
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"inbox_count": inbox})
+}
+
+// handleStatsHeatmap returns per-day archived-file counts of one year for an activity
+// calendar. Days are cut in the tz query parameter, or the server's local time zone.
+func (st *appState) handleStatsHeatmap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	loc := time.Local
+	if tz := strings.TrimSpace(q.Get("tz")); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			badRequest(w, "invalid tz")
+			return
+		}
+		loc = l
+	}
+	year := time.Now().In(loc).Year()
+	if raw := strings.TrimSpace(q.Get("year")); raw != "" {
+		y, err := strconv.Atoi(raw)
+		if err != nil || y < 1970 || y > 9999 {
+			badRequest(w, "invalid year")
+			return
+		}
+		year = y
+	}
+	username := strings.TrimSpace(q.Get("user"))
+	if strings.Contains(username, "/") || strings.Contains(username, "\\") {
+		badRequest(w, "Invalid username")
+		return
+	}
+
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	to := from.AddDate(1, 0, 0)
+	mtimes, source, err := st.archivedMTimes(r.Context(), username, from, to)
+	if err != nil {
+		writeScanError(w, err)
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, ms := range mtimes {
+		counts[time.UnixMilli(ms).In(loc).Format("2006-01-02")]++
+	}
+	days := make([]heatmapDay, 0, len(counts))
+	total, maxCount := 0, 0
+	for date, n := range counts {
+		days = append(days, heatmapDay{Date: date, Count: n})
+		total += n
+		if n > maxCount {
+			maxCount = n
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+
+	resp := map[string]any{
+		"year":   year,
+		"tz":     loc.String(),
+		"total":  total,
+		"max":    maxCount,
+		"days":   days,
+		"source": source,
+	}
+	if username != "" {
+		resp["user"] = username
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+)
+
+// errStorageQuotaExceeded marks a download refused because the media root is over
+// MEDIA_ROOT_QUOTA.
+var errStorageQuotaExceeded = errors.New("media root is over MEDIA_ROOT_QUOTA")
+
+// storageUsage is the space taken by the media root.
+type storageUsage struct {
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+	Source string `json:"source"`
+}
+
+// storageUsage sums file sizes from the image index once a reconcile has built it, and
+// walks the media root before that.
+func (st *appState) storageUsage(ctx context.Context) (storageUsage, error) {
+	built, err := st.store.ImageIndexBuiltAt()
+	if err != nil {
+		return storageUsage{}, err
+	}
+	if !built.IsZero() {
+		files, total, err := st.store.ImageIndexUsage()
+		if err != nil {
+			return storageUsage{}, err
+		}
+		return storageUsage{Files: files, Bytes: total, Source: "index"}, nil
+	}
+
+	usage := storageUsage{Source: "scan"}
+	err = filepath.WalkDir(st.cfg.mediaRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		usage.Files++
+		usage.Bytes += info.Size()
+		return nil
+	})
+	return usage, err
+}
+
+// checkStorageQuota returns errStorageQuotaExceeded when MEDIA_ROOT_QUOTA is set and
+// already used up.
+func (st *appState) checkStorageQuota(ctx context.Context) error {
+	if st.cfg.mediaRootQuota <= 0 {
+		return nil
+	}
+	usage, err := st.storageUsage(ctx)
+	if err != nil {
+		return err
+	}
+	if usage.Bytes >= st.cfg.mediaRootQuota {
+		return fmt.Errorf("%w: %d of %d bytes used", errStorageQuotaExceeded, usage.Bytes, st.cfg.mediaRootQuota)
+	}
+	return nil
+}
+
+func (st *appState) handleStorage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, cancel := st.scanContext(r.Context())
+	defer cancel()
+	usage, err := st.storageUsage(ctx)
+	if err != nil {
+		writeScanError(w, scanError(err))
+		return
+	}
+	resp := map[string]any{
+		"used_bytes":    usage.Bytes,
+		"file_count":    usage.Files,
+		"source":        usage.Source,
+		"quota_bytes":   st.cfg.mediaRootQuota,
+		"max_file_size": st.cfg.mediaMaxFileSize,
+		"over_quota":    false,
+	}
+	if quota := st.cfg.mediaRootQuota; quota > 0 {
+		remaining := quota - usage.Bytes
+		if remaining < 0 {
+			remaining = 0
+		}
+		resp["remaining_bytes"] = remaining
+		resp["used_ratio"] = float64(usage.Bytes) / float64(quota)
+		resp["over_quota"] = usage.Bytes >= quota
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -6,13 +6,19 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
-func openStore(path string) (*store, error) {
+type storeOptions struct {
+	slowQueryThreshold time.Duration
+	tagPolicy          tagPolicy
+}
+
+func openStore(path string, opts storeOptions) (*store, error) {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, fmt.Errorf("failed to create db directory %s: %w", dir, err)
@@ -48,6 +54,9 @@ func openStore(path string) (*store, error) {
 	`); err != nil {
 		return nil, err
 	}
+	if err := addColumnIfMissing(db, "image_tags", "source", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return nil, err
+	}
 	if _, err := db.Exec(`
 		CREATE TABLE IF NOT EXISTS processed_images (
 			image_hash TEXT PRIMARY KEY
@@ -64,7 +73,61 @@ func openStore(path string) (*store, error) {
 	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_image_tags_lower_tag ON image_tags(LOWER(tag));`); err != nil {
 		return nil, err
 	}
-	return &store{db: db}, nil
+	if err := createImageIndexTables(db); err != nil {
+		return nil, err
+	}
+	if err := createWatchlistTable(db); err != nil {
+		return nil, err
+	}
+	if err := createTweetsTable(db); err != nil {
+		return nil, err
+	}
+	if err := createDerivativesTable(db); err != nil {
+		return nil, err
+	}
+	if err := createVariantsTable(db); err != nil {
+		return nil, err
+	}
+	if err := createImageSourcesTable(db); err != nil {
+		return nil, err
+	}
+	if err := createPerceptualHashTable(db); err != nil {
+		return nil, err
+	}
+	if err := createCropSuggestionsTable(db); err != nil {
+		return nil, err
+	}
+	if err := createColorfulnessTable(db); err != nil {
+		return nil, err
+	}
+	if err := createSettingsTable(db); err != nil {
+		return nil, err
+	}
+	if err := createSubscriptionTables(db); err != nil {
+		return nil, err
+	}
+	if err := createInboxTable(db); err != nil {
+		return nil, err
+	}
+	if err := createTagAliasesTable(db); err != nil {
+		return nil, err
+	}
+	if err := createTagCategoriesTable(db); err != nil {
+		return nil, err
+	}
+	if err := createImageAccessTable(db); err != nil {
+		return nil, err
+	}
+	if err := createImageRatingsTable(db); err != nil {
+		return nil, err
+	}
+	if err := createCollectionsTables(db); err != nil {
+		return nil, err
+	}
+	if err := createSharesTable(db); err != nil {
+		return nil, err
+	}
+	return &store{db: db, metrics: newStoreMetrics(opts.slowQueryThreshold), tagPolicy: opts.tagPolicy}, nil
 }
 
 func isRetryableSQLiteError(err error) bool {
@@ -100,6 +163,7 @@ func (s *store) Close() error {
 }
 
 func (s *store) IsImageProcessed(hash string) (bool, error) {
+	defer s.metrics.observe("IsImageProcessed", time.Now())
 	var found bool
 	err := withSQLiteRetry(func() error {
 		var x int
@@ -118,6 +182,7 @@ func (s *store) IsImageProcessed(hash string) (bool, error) {
 }
 
 func (s *store) MarkImageProcessed(hash string) error {
+	defer s.metrics.observe("MarkImageProcessed", time.Now())
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return withSQLiteRetry(func() error {
@@ -126,7 +191,31 @@ func (s *store) MarkImageProcessed(hash string) error {
 	})
 }
 
+// ClaimImageHash marks hash as processed and reports whether this call inserted it, so
+// concurrent downloads of the same bytes agree on a single writer.
+func (s *store) ClaimImageHash(hash string) (bool, error) {
+	defer s.metrics.observe("ClaimImageHash", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var claimed bool
+	err := withSQLiteRetry(func() error {
+		res, err := s.db.Exec(`INSERT OR IGNORE INTO processed_images (image_hash) VALUES (?)`, hash)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		claimed = n == 1
+		return nil
+	})
+	return claimed, err
+}
+
 func (s *store) AddTags(filepath string, tags map[string]float64) error {
+	defer s.metrics.observe("AddTags", time.Now())
+	tags = s.tagPolicy.normalizeTagMap(tags)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return withSQLiteRetry(func() error {
@@ -150,16 +239,37 @@ func (s *store) AddTags(filepath string, tags map[string]float64) error {
 	})
 }
 
+// DeleteAllTags removes the autotagger's tags. Those set by hand or by the heuristic
+// tagger are not the autotagger's to redo, so a full re-tag keeps them.
 func (s *store) DeleteAllTags() error {
+	defer s.metrics.observe("DeleteAllTags", time.Now())
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return withSQLiteRetry(func() error {
-		_, err := s.db.Exec(`DELETE FROM image_tags`)
+		_, err := s.db.Exec(`DELETE FROM image_tags WHERE source = ''`)
 		return err
 	})
 }
 
+// DeleteTagsBySource removes every tag stored with source and returns how many went.
+func (s *store) DeleteTagsBySource(source string) (int, error) {
+	defer s.metrics.observe("DeleteTagsBySource", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var affected int64
+	err := withSQLiteRetry(func() error {
+		result, err := s.db.Exec(`DELETE FROM image_tags WHERE source = ?`, source)
+		if err != nil {
+			return err
+		}
+		affected, _ = result.RowsAffected()
+		return nil
+	})
+	return int(affected), err
+}
+
 func (s *store) ClearProcessedImages() error {
+	defer s.metrics.observe("ClearProcessedImages", time.Now())
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return withSQLiteRetry(func() error {
@@ -169,6 +279,7 @@ func (s *store) ClearProcessedImages() error {
 }
 
 func (s *store) GetAllTaggedFilepaths() (map[string]struct{}, error) {
+	defer s.metrics.observe("GetAllTaggedFilepaths", time.Now())
 	result := make(map[string]struct{})
 	err := withSQLiteRetry(func() error {
 		rows, err := s.db.Query(`SELECT DISTINCT filepath FROM image_tags`)
@@ -188,27 +299,8 @@ func (s *store) GetAllTaggedFilepaths() (map[string]struct{}, error) {
 	return result, err
 }
 
-func (s *store) GetAllProcessedHashes() ([]string, error) {
-	items := make([]string, 0)
-	err := withSQLiteRetry(func() error {
-		rows, err := s.db.Query(`SELECT image_hash FROM processed_images`)
-		if err != nil {
-			return err
-		}
-		defer rows.Close()
-		for rows.Next() {
-			var h string
-			if err := rows.Scan(&h); err != nil {
-				return err
-			}
-			items = append(items, h)
-		}
-		return rows.Err()
-	})
-	return items, err
-}
-
 func (s *store) DeleteProcessedHashes(hashes []string) (int, error) {
+	defer s.metrics.observe("DeleteProcessedHashes", time.Now())
 	if len(hashes) == 0 {
 		return 0, nil
 	}
@@ -248,7 +340,34 @@ func (s *store) DeleteProcessedHashes(hashes []string) (int, error) {
 	return totalDeleted, nil
 }
 
+// ListTaggedFilepaths returns up to limit tagged files sorted by path, starting after
+// after, so every tag can be walked in batches.
+func (s *store) ListTaggedFilepaths(after string, limit int) ([]string, error) {
+	defer s.metrics.observe("ListTaggedFilepaths", time.Now())
+	var paths []string
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`
+			SELECT DISTINCT filepath FROM image_tags WHERE filepath > ?
+			ORDER BY filepath LIMIT ?`, after, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		paths = make([]string, 0, limit)
+		for rows.Next() {
+			var p string
+			if err := rows.Scan(&p); err != nil {
+				return err
+			}
+			paths = append(paths, p)
+		}
+		return rows.Err()
+	})
+	return paths, err
+}
+
 func (s *store) GetTagsForFiles(filepaths []string) (map[string][]imageTag, error) {
+	defer s.metrics.observe("GetTagsForFiles", time.Now())
 	result := make(map[string][]imageTag, len(filepaths))
 	for _, p := range filepaths {
 		result[p] = []imageTag{}
@@ -266,7 +385,7 @@ func (s *store) GetTagsForFiles(filepaths []string) (map[string][]imageTag, erro
 		chunk := filepaths[start:end]
 		placeholders := strings.TrimRight(strings.Repeat("?,", len(chunk)), ",")
 		query := fmt.Sprintf(
-			"SELECT filepath, tag, confidence FROM image_tags WHERE filepath IN (%s) ORDER BY confidence DESC",
+			"SELECT filepath, tag, confidence, source FROM image_tags WHERE filepath IN (%s) ORDER BY confidence DESC",
 			placeholders,
 		)
 		args := make([]any, 0, len(chunk))
@@ -284,10 +403,11 @@ func (s *store) GetTagsForFiles(filepaths []string) (map[string][]imageTag, erro
 				var filepathVal string
 				var tag string
 				var confidence float64
-				if err := rows.Scan(&filepathVal, &tag, &confidence); err != nil {
+				var source string
+				if err := rows.Scan(&filepathVal, &tag, &confidence, &source); err != nil {
 					return err
 				}
-				result[filepathVal] = append(result[filepathVal], imageTag{Tag: tag, Confidence: confidence})
+				result[filepathVal] = append(result[filepathVal], imageTag{Tag: tag, Confidence: confidence, Source: source})
 			}
 			return rows.Err()
 		})
@@ -299,15 +419,30 @@ func (s *store) GetTagsForFiles(filepaths []string) (map[string][]imageTag, erro
 	return result, nil
 }
 
+// GetAllTags counts images per tag. Tags stored under an alias are counted under their
+// canonical tag.
 func (s *store) GetAllTags() ([]map[string]any, error) {
+	defer s.metrics.observe("GetAllTags", time.Now())
+	return s.tagCounts(`1 = 1`)
+}
+
+// GetAllTagsBySource is GetAllTags counting only the tags stored with source.
+func (s *store) GetAllTagsBySource(source string) ([]map[string]any, error) {
+	defer s.metrics.observe("GetAllTagsBySource", time.Now())
+	return s.tagCounts(`t.source = ?`, source)
+}
+
+func (s *store) tagCounts(where string, args ...any) ([]map[string]any, error) {
 	items := make([]map[string]any, 0)
 	err := withSQLiteRetry(func() error {
 		rows, err := s.db.Query(`
-			SELECT tag, COUNT(id) as tag_count
-			FROM image_tags
-			GROUP BY tag
-			ORDER BY tag_count DESC, tag ASC
-		`)
+			SELECT COALESCE(a.tag, t.tag) AS canonical, COUNT(DISTINCT t.filepath) as tag_count
+			FROM image_tags t
+			LEFT JOIN tag_aliases a ON a.alias = t.tag
+			WHERE `+where+`
+			GROUP BY canonical
+			ORDER BY tag_count DESC, canonical ASC
+		`, args...)
 		if err != nil {
 			return err
 		}
@@ -325,18 +460,145 @@ func (s *store) GetAllTags() ([]map[string]any, error) {
 	return items, err
 }
 
+// FindFilesByTagPatterns returns files matching every pattern. A pattern of the form
+// "cat|dog" matches when any of its alternatives does, "character:*" matches tags
+// starting with "character:" and "=cat" only the tag cat itself. An alternative naming an alias also matches its canonical
+// tag, and one naming a canonical tag matches its aliases.
 func (s *store) FindFilesByTagPatterns(tags []string) ([]string, error) {
+	defer s.metrics.observe("FindFilesByTagPatterns", time.Now())
 	if len(tags) == 0 {
 		return []string{}, nil
 	}
-	query := "SELECT filepath FROM image_tags WHERE LOWER(tag) LIKE ?"
-	for i := 1; i < len(tags); i++ {
-		query += " INTERSECT SELECT filepath FROM image_tags WHERE LOWER(tag) LIKE ?"
+	aliases, err := s.ListTagAliases()
+	if err != nil {
+		return nil, err
 	}
+	index := tagAliasIndex(aliases)
+	selects := make([]string, 0, len(tags))
 	args := make([]any, 0, len(tags))
 	for _, tag := range tags {
-		args = append(args, "%"+strings.ToLower(strings.TrimSpace(tag))+"%")
+		alts := strings.Split(tag, "|")
+		conds := make([]string, 0, len(alts))
+		for _, alt := range alts {
+			altConds, altArgs := tagPatternConditions(index, aliases, alt, false)
+			conds = append(conds, altConds...)
+			args = append(args, altArgs...)
+		}
+		selects = append(selects, "SELECT filepath FROM image_tags WHERE "+strings.Join(conds, " OR "))
+	}
+	return s.queryFilepaths(strings.Join(selects, " INTERSECT "), args)
+}
+
+// tagPatternConditions returns the OR-ed conditions on image_tags.tag matching one pattern:
+// "ns:*" by prefix, anything else as a substring, or the whole tag when exact or written as
+// "=tag". A pattern naming an alias also matches its canonical tag, and one naming a
+// canonical tag matches its aliases.
+func tagPatternConditions(index map[string]string, aliases []tagAlias, pattern string, exact bool) ([]string, []any) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if whole, ok := strings.CutPrefix(pattern, exactTagPrefix); ok && whole != "" && !exact {
+		pattern, exact = whole, true
 	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok && prefix != "" && !exact {
+		return []string{"LOWER(tag) LIKE ?"}, []any{prefix + "%"}
+	}
+	op, arg := "LOWER(tag) LIKE ?", func(t string) any { return "%" + t + "%" }
+	if exact {
+		op, arg = "LOWER(tag) = ?", func(t string) any { return t }
+	}
+	conds := []string{op}
+	args := []any{arg(pattern)}
+	if pattern == "" {
+		return conds, args
+	}
+	canonical := strings.ToLower(resolveTagAlias(index, pattern))
+	if canonical != pattern {
+		conds = append(conds, op)
+		args = append(args, arg(canonical))
+	}
+	for _, a := range aliases {
+		if strings.EqualFold(a.Tag, canonical) && !strings.EqualFold(a.Alias, pattern) {
+			conds = append(conds, "LOWER(tag) = ?")
+			args = append(args, strings.ToLower(a.Alias))
+		}
+	}
+	return conds, args
+}
+
+// FindFilesByTagQuery evaluates a parsed search query against image_tags. Negations are
+// folded into set operations, so the result is either the matching files or, when the
+// bool is true, the files that do not match; the latter also covers untagged files, which
+// image_tags cannot list.
+func (s *store) FindFilesByTagQuery(expr *queryExpr) ([]string, bool, error) {
+	defer s.metrics.observe("FindFilesByTagQuery", time.Now())
+	aliases, err := s.ListTagAliases()
+	if err != nil {
+		return nil, false, err
+	}
+	query, args, complement := compileTagQuery(expr, tagAliasIndex(aliases), aliases)
+	items, err := s.queryFilepaths(query, args)
+	return items, complement, err
+}
+
+// compileTagQuery turns expr into a compound SELECT of file paths. With complement set the
+// query selects the files that do NOT match expr, which keeps NOT from needing the set of
+// all files: A AND NOT B is A EXCEPT B, and NOT A OR NOT B is the complement of A INTERSECT B.
+func compileTagQuery(expr *queryExpr, index map[string]string, aliases []tagAlias) (query string, args []any, complement bool) {
+	switch expr.Op {
+	case queryOpTerm:
+		conds, args := tagPatternConditions(index, aliases, expr.Text, expr.Exact)
+		return "SELECT filepath FROM image_tags WHERE " + strings.Join(conds, " OR "), args, false
+	case queryOpNot:
+		query, args, complement := compileTagQuery(expr.Children[0], index, aliases)
+		return query, args, !complement
+	}
+	query, args, complement = compileTagQuery(expr.Children[0], index, aliases)
+	for _, child := range expr.Children[1:] {
+		q2, args2, c2 := compileTagQuery(child, index, aliases)
+		and := expr.Op == queryOpAnd
+		switch {
+		case !complement && !c2:
+			// A AND B, A OR B
+			op := "UNION"
+			if and {
+				op = "INTERSECT"
+			}
+			query, args = compoundSelect(query, op, q2), append(args, args2...)
+		case complement && c2:
+			// NOT A AND NOT B = NOT (A OR B); NOT A OR NOT B = NOT (A AND B)
+			op := "INTERSECT"
+			if and {
+				op = "UNION"
+			}
+			query, args = compoundSelect(query, op, q2), append(args, args2...)
+		case !complement && c2:
+			// A AND NOT B = A EXCEPT B; A OR NOT B = NOT (B EXCEPT A)
+			if and {
+				query, args = compoundSelect(query, "EXCEPT", q2), append(args, args2...)
+			} else {
+				query, args = compoundSelect(q2, "EXCEPT", query), append(args2, args...)
+			}
+		default:
+			// NOT A AND B = B EXCEPT A; NOT A OR B = NOT (A EXCEPT B)
+			if and {
+				query, args = compoundSelect(q2, "EXCEPT", query), append(args2, args...)
+			} else {
+				query, args = compoundSelect(query, "EXCEPT", q2), append(args, args2...)
+			}
+		}
+		if and {
+			complement = complement && c2
+		} else {
+			complement = complement || c2
+		}
+	}
+	return query, args, complement
+}
+
+func compoundSelect(left, op, right string) string {
+	return "SELECT filepath FROM (" + left + ") " + op + " SELECT filepath FROM (" + right + ")"
+}
+
+func (s *store) queryFilepaths(query string, args []any) ([]string, error) {
 	items := make([]string, 0)
 	err := withSQLiteRetry(func() error {
 		rows, err := s.db.Query(query, args...)
@@ -357,6 +619,7 @@ func (s *store) FindFilesByTagPatterns(tags []string) ([]string, error) {
 }
 
 func (s *store) FindFilesByExactTag(tag string) ([]string, error) {
+	defer s.metrics.observe("FindFilesByExactTag", time.Now())
 	tag = strings.TrimSpace(tag)
 	if tag == "" {
 		return []string{}, nil
@@ -383,7 +646,34 @@ func (s *store) FindFilesByExactTag(tag string) ([]string, error) {
 	return items, err
 }
 
+// GetTagConfidences returns the confidences of a tag (case-insensitive) across all images, ascending.
+func (s *store) GetTagConfidences(tag string) ([]float64, error) {
+	defer s.metrics.observe("GetTagConfidences", time.Now())
+	items := make([]float64, 0)
+	err := withSQLiteRetry(func() error {
+		items = items[:0]
+		rows, err := s.db.Query(
+			`SELECT COALESCE(confidence, 0) FROM image_tags WHERE LOWER(tag) = LOWER(?) ORDER BY confidence ASC`,
+			strings.TrimSpace(tag),
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var c float64
+			if err := rows.Scan(&c); err != nil {
+				return err
+			}
+			items = append(items, c)
+		}
+		return rows.Err()
+	})
+	return items, err
+}
+
 func (s *store) DeleteTag(tag string) (int, error) {
+	defer s.metrics.observe("DeleteTag", time.Now())
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	var affected int64
@@ -399,6 +689,7 @@ func (s *store) DeleteTag(tag string) (int, error) {
 }
 
 func (s *store) DeleteTagsForFile(filepathVal string) error {
+	defer s.metrics.observe("DeleteTagsForFile", time.Now())
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return withSQLiteRetry(func() error {
@@ -407,7 +698,115 @@ func (s *store) DeleteTagsForFile(filepathVal string) error {
 	})
 }
 
+// DeleteAutotagsForFile removes the autotagger's tags of filepathVal before it tags the
+// file again.
+func (s *store) DeleteAutotagsForFile(filepathVal string) error {
+	defer s.metrics.observe("DeleteAutotagsForFile", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`DELETE FROM image_tags WHERE filepath = ? AND source = ''`, filepathVal)
+		return err
+	})
+}
+
+// AddTagsWithSource stores tags that did not come from the autotagger, such as heuristic
+// guesses, marked with source. Tags the file already has are left as they are.
+func (s *store) AddTagsWithSource(filepathVal string, tags map[string]float64, source string) error {
+	defer s.metrics.observe("AddTagsWithSource", time.Now())
+	tags = s.tagPolicy.normalizeTagMap(tags)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		stmt, err := tx.Prepare(`INSERT OR IGNORE INTO image_tags (filepath, tag, confidence, source) VALUES (?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for tag, conf := range tags {
+			if _, err := stmt.Exec(filepathVal, tag, conf, source); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// AddManualTags sets tags on filepathVal by hand: confidence 1.0 and source "manual", also
+// for tags the autotagger already assigned. It returns the tags as stored after the tag
+// policy was applied.
+func (s *store) AddManualTags(filepathVal string, tags []string) ([]string, error) {
+	defer s.metrics.observe("AddManualTags", time.Now())
+	raw := make(map[string]float64, len(tags))
+	for _, tag := range tags {
+		raw[tag] = 1
+	}
+	normalized := s.tagPolicy.normalizeTagMap(raw)
+	added := make([]string, 0, len(normalized))
+	for tag := range normalized {
+		added = append(added, tag)
+	}
+	sort.Strings(added)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		stmt, err := tx.Prepare(`
+			INSERT INTO image_tags (filepath, tag, confidence, source) VALUES (?, ?, 1.0, ?)
+			ON CONFLICT(filepath, tag) DO UPDATE SET confidence = 1.0, source = excluded.source`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, tag := range added {
+			if _, err := stmt.Exec(filepathVal, tag, tagSourceManual); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	return added, err
+}
+
+// RemoveTags deletes the given tags from filepathVal, whoever set them, and returns how
+// many were removed.
+func (s *store) RemoveTags(filepathVal string, tags []string) (int, error) {
+	defer s.metrics.observe("RemoveTags", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	err := withSQLiteRetry(func() error {
+		removed = 0
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		for _, tag := range tags {
+			res, err := tx.Exec(`DELETE FROM image_tags WHERE filepath = ? AND tag IN (?, ?)`,
+				filepathVal, tag, s.tagPolicy.normalize(tag))
+			if err != nil {
+				return err
+			}
+			n, _ := res.RowsAffected()
+			removed += int(n)
+		}
+		return tx.Commit()
+	})
+	return removed, err
+}
+
 func (s *store) DeleteTagsForUser(username string) error {
+	defer s.metrics.observe("DeleteTagsForUser", time.Now())
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return withSQLiteRetry(func() error {
@@ -415,3 +814,151 @@ func (s *store) DeleteTagsForUser(username string) error {
 		return err
 	})
 }
+
+// CopyTags copies the tags of source onto each target and returns how many source tags
+// there were. In merge mode existing target tags are kept and shared tags take the higher
+// confidence; otherwise the target's tags are replaced. Tags set by hand stay marked as such
+// ("manual" sorts after the autotagger's empty source).
+func (s *store) CopyTags(source string, targets []string, merge bool) (int, error) {
+	defer s.metrics.observe("CopyTags", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := 0
+	err := withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM image_tags WHERE filepath = ?`, source).Scan(&copied); err != nil {
+			return err
+		}
+		if copied == 0 {
+			return nil
+		}
+		for _, target := range targets {
+			if !merge {
+				if _, err := tx.Exec(`DELETE FROM image_tags WHERE filepath = ?`, target); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.Exec(`
+				INSERT INTO image_tags (filepath, tag, confidence, source)
+				SELECT ?, tag, confidence, source FROM image_tags WHERE filepath = ?
+				ON CONFLICT(filepath, tag) DO UPDATE SET
+					confidence = MAX(COALESCE(image_tags.confidence, 0), COALESCE(excluded.confidence, 0)),
+					source = MAX(image_tags.source, excluded.source)
+			`, target, source); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	return copied, err
+}
+
+// NormalizeAllTags rewrites stored tags according to the store's tag policy. Rows that
+// collapse onto an existing tag for the same file are merged, keeping the highest confidence.
+func (s *store) NormalizeAllTags() (int, int, error) {
+	defer s.metrics.observe("NormalizeAllTags", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	renamed := 0
+	merged := 0
+	err := withSQLiteRetry(func() error {
+		renamed, merged = 0, 0
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		type tagRow struct {
+			id         int64
+			filepath   string
+			tag        string
+			confidence float64
+		}
+		rows, err := tx.Query(`SELECT id, filepath, tag, COALESCE(confidence, 0) FROM image_tags ORDER BY id`)
+		if err != nil {
+			return err
+		}
+		pending := make([]tagRow, 0)
+		for rows.Next() {
+			var r tagRow
+			if err := rows.Scan(&r.id, &r.filepath, &r.tag, &r.confidence); err != nil {
+				rows.Close()
+				return err
+			}
+			if s.tagPolicy.normalize(r.tag) != r.tag {
+				pending = append(pending, r)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, r := range pending {
+			normalized := s.tagPolicy.normalize(r.tag)
+			if normalized == "" {
+				if _, err := tx.Exec(`DELETE FROM image_tags WHERE id = ?`, r.id); err != nil {
+					return err
+				}
+				merged++
+				continue
+			}
+			var existingID int64
+			var existingConf float64
+			err := tx.QueryRow(
+				`SELECT id, COALESCE(confidence, 0) FROM image_tags WHERE filepath = ? AND tag = ?`,
+				r.filepath, normalized,
+			).Scan(&existingID, &existingConf)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				if _, err := tx.Exec(`UPDATE image_tags SET tag = ? WHERE id = ?`, normalized, r.id); err != nil {
+					return err
+				}
+				renamed++
+			case err != nil:
+				return err
+			default:
+				if r.confidence > existingConf {
+					if _, err := tx.Exec(`UPDATE image_tags SET confidence = ? WHERE id = ?`, r.confidence, existingID); err != nil {
+						return err
+					}
+				}
+				if _, err := tx.Exec(`DELETE FROM image_tags WHERE id = ?`, r.id); err != nil {
+					return err
+				}
+				merged++
+			}
+		}
+		return tx.Commit()
+	})
+	return renamed, merged, err
+}
+
+// addColumnIfMissing adds a column that a newer version introduced to a table created by an
+// older one, which CREATE TABLE IF NOT EXISTS leaves untouched.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf(`SELECT name FROM pragma_table_info('%s')`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
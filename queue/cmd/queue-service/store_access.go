@@ -0,0 +1,170 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// imageAccess holds how often an image was opened in the viewer and served as a file.
+type imageAccess struct {
+	Filepath     string `json:"filepath"`
+	Views        int64  `json:"views"`
+	Serves       int64  `json:"serves"`
+	LastAccessAt int64  `json:"last_access_at"`
+}
+
+// userAccess sums imageAccess over the files of one user.
+type userAccess struct {
+	Username string `json:"username"`
+	Views    int64  `json:"views"`
+	Serves   int64  `json:"serves"`
+}
+
+func createImageAccessTable(db *sql.DB) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS image_access (
+			filepath TEXT PRIMARY KEY,
+			views INTEGER NOT NULL DEFAULT 0,
+			serves INTEGER NOT NULL DEFAULT 0,
+			last_access_at INTEGER NOT NULL DEFAULT 0
+		);
+	`); err != nil {
+		return err
+	}
+	_, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_image_access_views ON image_access(views DESC);`)
+	return err
+}
+
+// AddImageAccess adds batched view and serve counts in one transaction.
+func (s *store) AddImageAccess(deltas map[string]imageAccess) error {
+	defer s.metrics.observe("AddImageAccess", time.Now())
+	if len(deltas) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		stmt, err := tx.Prepare(`
+			INSERT INTO image_access (filepath, views, serves, last_access_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(filepath) DO UPDATE SET
+				views = views + excluded.views,
+				serves = serves + excluded.serves,
+				last_access_at = MAX(last_access_at, excluded.last_access_at)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for p, d := range deltas {
+			if _, err := stmt.Exec(p, d.Views, d.Serves, d.LastAccessAt); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// GetImageAccess returns the counts of the filepaths that were accessed at least once.
+func (s *store) GetImageAccess(filepaths []string) (map[string]imageAccess, error) {
+	defer s.metrics.observe("GetImageAccess", time.Now())
+	result := make(map[string]imageAccess, len(filepaths))
+	const chunkSize = 500
+	for start := 0; start < len(filepaths); start += chunkSize {
+		chunk := filepaths[start:min(start+chunkSize, len(filepaths))]
+		placeholders := strings.TrimRight(strings.Repeat("?,", len(chunk)), ",")
+		query := fmt.Sprintf(`
+			SELECT filepath, views, serves, last_access_at FROM image_access WHERE filepath IN (%s)`,
+			placeholders,
+		)
+		args := make([]any, 0, len(chunk))
+		for _, p := range chunk {
+			args = append(args, p)
+		}
+		err := withSQLiteRetry(func() error {
+			rows, err := s.db.Query(query, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var a imageAccess
+				if err := rows.Scan(&a.Filepath, &a.Views, &a.Serves, &a.LastAccessAt); err != nil {
+					return err
+				}
+				result[a.Filepath] = a
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// TopImageAccess returns the most viewed images, optionally of one user, ties broken by
+// serves.
+func (s *store) TopImageAccess(username string, limit int) ([]imageAccess, error) {
+	defer s.metrics.observe("TopImageAccess", time.Now())
+	query := `SELECT filepath, views, serves, last_access_at FROM image_access`
+	args := []any{}
+	if username != "" {
+		query += ` WHERE filepath LIKE ?`
+		args = append(args, username+"/%")
+	}
+	query += ` ORDER BY views DESC, serves DESC, filepath ASC LIMIT ?`
+	args = append(args, limit)
+	var items []imageAccess
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		items = make([]imageAccess, 0)
+		for rows.Next() {
+			var a imageAccess
+			if err := rows.Scan(&a.Filepath, &a.Views, &a.Serves, &a.LastAccessAt); err != nil {
+				return err
+			}
+			items = append(items, a)
+		}
+		return rows.Err()
+	})
+	return items, err
+}
+
+// TopUserAccess sums the counts per user, the first path segment, most viewed first.
+func (s *store) TopUserAccess(limit int) ([]userAccess, error) {
+	defer s.metrics.observe("TopUserAccess", time.Now())
+	var items []userAccess
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`
+			SELECT substr(filepath, 1, instr(filepath, '/') - 1) AS username, SUM(views) AS v, SUM(serves) AS sv
+			FROM image_access
+			WHERE instr(filepath, '/') > 0
+			GROUP BY username
+			ORDER BY v DESC, sv DESC, username ASC
+			LIMIT ?`, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		items = make([]userAccess, 0)
+		for rows.Next() {
+			var u userAccess
+			if err := rows.Scan(&u.Username, &u.Views, &u.Serves); err != nil {
+				return err
+			}
+			items = append(items, u)
+		}
+		return rows.Err()
+	})
+	return items, err
+}
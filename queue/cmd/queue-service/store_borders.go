@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// cropSuggestion is the area of an image left after trimming solid borders. Its fields
+// match a crop operation of POST /api/images/edit.
+type cropSuggestion struct {
+	X           int `json:"x"`
+	Y           int `json:"y"`
+	Width       int `json:"width"`
+	Height      int `json:"height"`
+	ImageWidth  int `json:"image_width"`
+	ImageHeight int `json:"image_height"`
+}
+
+func createCropSuggestionsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS image_crop_suggestions (
+			filepath TEXT PRIMARY KEY,
+			content_hash TEXT NOT NULL,
+			x INTEGER NOT NULL,
+			y INTEGER NOT NULL,
+			width INTEGER NOT NULL,
+			height INTEGER NOT NULL,
+			image_width INTEGER NOT NULL,
+			image_height INTEGER NOT NULL,
+			detected_at INTEGER NOT NULL
+		);
+	`)
+	return err
+}
+
+// RecordCropSuggestion stores the border trim found for filepathVal. A nil suggestion
+// records that the image has no border, replacing an older suggestion.
+func (s *store) RecordCropSuggestion(filepathVal, contentHash string, c *cropSuggestion) error {
+	defer s.metrics.observe("RecordCropSuggestion", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		if c == nil {
+			_, err := s.db.Exec(`DELETE FROM image_crop_suggestions WHERE filepath = ?`, filepathVal)
+			return err
+		}
+		_, err := s.db.Exec(`
+			INSERT OR REPLACE INTO image_crop_suggestions
+				(filepath, content_hash, x, y, width, height, image_width, image_height, detected_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			filepathVal, contentHash, c.X, c.Y, c.Width, c.Height, c.ImageWidth, c.ImageHeight, time.Now().UnixMilli())
+		return err
+	})
+}
+
+// GetCropSuggestions returns the suggestions of filepaths. Suggestions made for other
+// bytes than the indexed ones, e.g. before a replacement download, are left out.
+func (s *store) GetCropSuggestions(filepaths []string) (map[string]cropSuggestion, error) {
+	defer s.metrics.observe("GetCropSuggestions", time.Now())
+	result := make(map[string]cropSuggestion, len(filepaths))
+	const chunkSize = 500
+	for start := 0; start < len(filepaths); start += chunkSize {
+		chunk := filepaths[start:min(start+chunkSize, len(filepaths))]
+		placeholders := strings.TrimRight(strings.Repeat("?,", len(chunk)), ",")
+		query := fmt.Sprintf(`
+			SELECT c.filepath, c.x, c.y, c.width, c.height, c.image_width, c.image_height
+			FROM image_crop_suggestions c
+			LEFT JOIN images i ON i.filepath = c.filepath
+			WHERE c.filepath IN (%s) AND (i.content_hash IS NULL OR i.content_hash IN ('', c.content_hash))`,
+			placeholders,
+		)
+		args := make([]any, 0, len(chunk))
+		for _, p := range chunk {
+			args = append(args, p)
+		}
+		err := withSQLiteRetry(func() error {
+			rows, err := s.db.Query(query, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var (
+					p string
+					c cropSuggestion
+				)
+				if err := rows.Scan(&p, &c.X, &c.Y, &c.Width, &c.Height, &c.ImageWidth, &c.ImageHeight); err != nil {
+					return err
+				}
+				result[p] = c
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
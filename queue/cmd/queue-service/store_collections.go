@@ -0,0 +1,361 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// collection is a named, ordered group of images picked by hand.
+type collection struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ItemCount   int    `json:"item_count"`
+	// Cover is the first image of the collection, if any.
+	Cover     string `json:"cover,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+var errCollectionNameTaken = errors.New("collection name is already used")
+
+func createCollectionsTables(db *sql.DB) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS collections (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+			description TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS collection_items (
+			collection_id INTEGER NOT NULL,
+			filepath TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			added_at INTEGER NOT NULL,
+			PRIMARY KEY (collection_id, filepath)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_collection_items_position ON collection_items(collection_id, position);`,
+		`CREATE INDEX IF NOT EXISTS idx_collection_items_filepath ON collection_items(filepath);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const collectionSelect = `
+	SELECT c.id, c.name, c.description, c.created_at, c.updated_at,
+		(SELECT COUNT(*) FROM collection_items i WHERE i.collection_id = c.id),
+		COALESCE((SELECT i.filepath FROM collection_items i WHERE i.collection_id = c.id
+			ORDER BY i.position, i.filepath LIMIT 1), '')
+	FROM collections c`
+
+func scanCollection(row interface{ Scan(...any) error }) (collection, error) {
+	var c collection
+	err := row.Scan(&c.ID, &c.Name, &c.Description, &c.CreatedAt, &c.UpdatedAt, &c.ItemCount, &c.Cover)
+	return c, err
+}
+
+func (s *store) ListCollections() ([]collection, error) {
+	defer s.metrics.observe("ListCollections", time.Now())
+	var out []collection
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(collectionSelect + ` ORDER BY c.name COLLATE NOCASE`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		out = make([]collection, 0)
+		for rows.Next() {
+			c, err := scanCollection(rows)
+			if err != nil {
+				return err
+			}
+			out = append(out, c)
+		}
+		return rows.Err()
+	})
+	return out, err
+}
+
+// GetCollection returns the collection with id; the bool is false when it does not exist.
+func (s *store) GetCollection(id int64) (collection, bool, error) {
+	defer s.metrics.observe("GetCollection", time.Now())
+	var c collection
+	found := false
+	err := withSQLiteRetry(func() error {
+		var err error
+		c, err = scanCollection(s.db.QueryRow(collectionSelect+` WHERE c.id = ?`, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			found = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		return nil
+	})
+	return c, found, err
+}
+
+// SaveCollection creates c when its ID is 0 and renames or redescribes it otherwise. Names
+// are unique regardless of case. It returns the saved collection.
+func (s *store) SaveCollection(c collection) (collection, error) {
+	defer s.metrics.observe("SaveCollection", time.Now())
+	c.Name = strings.TrimSpace(c.Name)
+	c.Description = strings.TrimSpace(c.Description)
+	if c.Name == "" {
+		return collection{}, errors.New("name is required")
+	}
+	s.mu.Lock()
+	var id int64
+	err := withSQLiteRetry(func() error {
+		var n int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM collections WHERE name = ? AND id != ?`, c.Name, c.ID).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return errCollectionNameTaken
+		}
+		now := time.Now().UnixMilli()
+		if c.ID == 0 {
+			result, err := s.db.Exec(`INSERT INTO collections (name, description, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+				c.Name, c.Description, now, now)
+			if err != nil {
+				return err
+			}
+			id, err = result.LastInsertId()
+			return err
+		}
+		id = c.ID
+		_, err := s.db.Exec(`UPDATE collections SET name = ?, description = ?, updated_at = ? WHERE id = ?`,
+			c.Name, c.Description, now, c.ID)
+		return err
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return collection{}, err
+	}
+	saved, _, err := s.GetCollection(id)
+	return saved, err
+}
+
+// DeleteCollection removes a collection and its membership, leaving the images alone.
+func (s *store) DeleteCollection(id int64) (bool, error) {
+	defer s.metrics.observe("DeleteCollection", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var affected int64
+	err := withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec(`DELETE FROM collection_items WHERE collection_id = ?`, id); err != nil {
+			return err
+		}
+		result, err := tx.Exec(`DELETE FROM collections WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		affected, _ = result.RowsAffected()
+		return tx.Commit()
+	})
+	return affected > 0, err
+}
+
+// ListCollectionItems returns one page of a collection's files in their order and the
+// total count.
+func (s *store) ListCollectionItems(id int64, offset, limit int) ([]string, int, error) {
+	defer s.metrics.observe("ListCollectionItems", time.Now())
+	var paths []string
+	total := 0
+	err := withSQLiteRetry(func() error {
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM collection_items WHERE collection_id = ?`, id).Scan(&total); err != nil {
+			return err
+		}
+		rows, err := s.db.Query(`
+			SELECT filepath FROM collection_items WHERE collection_id = ?
+			ORDER BY position, filepath LIMIT ? OFFSET ?`, id, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		paths = make([]string, 0)
+		for rows.Next() {
+			var p string
+			if err := rows.Scan(&p); err != nil {
+				return err
+			}
+			paths = append(paths, p)
+		}
+		return rows.Err()
+	})
+	return paths, total, err
+}
+
+// AddCollectionItems adds filepaths to a collection and returns how many were new. Without
+// a position (negative) new files go to the end and members keep their place; with one,
+// all given files, new or not, are placed in order starting at that index.
+func (s *store) AddCollectionItems(id int64, filepaths []string, position int) (int, error) {
+	defer s.metrics.observe("AddCollectionItems", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := 0
+	err := withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		current, err := collectionOrder(tx, id)
+		if err != nil {
+			return err
+		}
+		members := make(map[string]bool, len(current))
+		for _, p := range current {
+			members[p] = true
+		}
+		added = 0
+		for _, p := range filepaths {
+			if !members[p] {
+				added++
+			}
+		}
+		order := current
+		if position < 0 {
+			for _, p := range filepaths {
+				if !members[p] {
+					order = append(order, p)
+				}
+			}
+		} else {
+			moved := make(map[string]bool, len(filepaths))
+			for _, p := range filepaths {
+				moved[p] = true
+			}
+			rest := make([]string, 0, len(current))
+			for _, p := range current {
+				if !moved[p] {
+					rest = append(rest, p)
+				}
+			}
+			position = min(position, len(rest))
+			order = make([]string, 0, len(rest)+len(filepaths))
+			order = append(order, rest[:position]...)
+			order = append(order, filepaths...)
+			order = append(order, rest[position:]...)
+		}
+		if err := writeCollectionOrder(tx, id, order); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	return added, err
+}
+
+// ReplaceCollectionItems sets the exact membership and order of a collection.
+func (s *store) ReplaceCollectionItems(id int64, filepaths []string) error {
+	defer s.metrics.observe("ReplaceCollectionItems", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		current, err := collectionOrder(tx, id)
+		if err != nil {
+			return err
+		}
+		keep := make(map[string]bool, len(filepaths))
+		for _, p := range filepaths {
+			keep[p] = true
+		}
+		for _, p := range current {
+			if keep[p] {
+				continue
+			}
+			if _, err := tx.Exec(`DELETE FROM collection_items WHERE collection_id = ? AND filepath = ?`, id, p); err != nil {
+				return err
+			}
+		}
+		if err := writeCollectionOrder(tx, id, filepaths); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// RemoveCollectionItems drops filepaths from a collection and returns how many were members.
+func (s *store) RemoveCollectionItems(id int64, filepaths []string) (int, error) {
+	defer s.metrics.observe("RemoveCollectionItems", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	err := withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		removed = 0
+		for _, p := range filepaths {
+			result, err := tx.Exec(`DELETE FROM collection_items WHERE collection_id = ? AND filepath = ?`, id, p)
+			if err != nil {
+				return err
+			}
+			n, _ := result.RowsAffected()
+			removed += int(n)
+		}
+		if _, err := tx.Exec(`UPDATE collections SET updated_at = ? WHERE id = ?`, time.Now().UnixMilli(), id); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	return removed, err
+}
+
+func collectionOrder(tx *sql.Tx, id int64) ([]string, error) {
+	rows, err := tx.Query(`SELECT filepath FROM collection_items WHERE collection_id = ? ORDER BY position, filepath`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	order := make([]string, 0)
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		order = append(order, p)
+	}
+	return order, rows.Err()
+}
+
+// writeCollectionOrder renumbers order from 0, inserting files that are not members yet.
+func writeCollectionOrder(tx *sql.Tx, id int64, order []string) error {
+	now := time.Now().UnixMilli()
+	stmt, err := tx.Prepare(`
+		INSERT INTO collection_items (collection_id, filepath, position, added_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(collection_id, filepath) DO UPDATE SET position = excluded.position`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, p := range order {
+		if _, err := stmt.Exec(id, p, i, now); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`UPDATE collections SET updated_at = ? WHERE id = ?`, now, id)
+	return err
+}
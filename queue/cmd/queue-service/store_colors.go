@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// createColorfulnessTable stores raw scores rather than classes, so changing
+// COLOR_MONO_THRESHOLD takes effect without analyzing the library again.
+func createColorfulnessTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS image_colorfulness (
+			filepath TEXT PRIMARY KEY,
+			content_hash TEXT NOT NULL,
+			colorfulness REAL NOT NULL,
+			analyzed_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	// Palettes are only ever read whole, so they are kept as one JSON value per image.
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS image_dominant_colors (
+			filepath TEXT PRIMARY KEY,
+			content_hash TEXT NOT NULL,
+			colors TEXT NOT NULL,
+			analyzed_at INTEGER NOT NULL
+		);
+	`)
+	return err
+}
+
+// RecordColorfulness stores the colorfulness score of filepathVal next to its MD5.
+func (s *store) RecordColorfulness(filepathVal, contentHash string, score float64) error {
+	defer s.metrics.observe("RecordColorfulness", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`
+			INSERT OR REPLACE INTO image_colorfulness (filepath, content_hash, colorfulness, analyzed_at) VALUES (?, ?, ?, ?)`,
+			filepathVal, contentHash, score, time.Now().UnixMilli())
+		return err
+	})
+}
+
+// GetColorfulness returns the scores of the analyzed filepaths. Scores of other bytes than
+// the indexed ones, e.g. before a replacement download, are left out.
+func (s *store) GetColorfulness(filepaths []string) (map[string]float64, error) {
+	defer s.metrics.observe("GetColorfulness", time.Now())
+	result := make(map[string]float64, len(filepaths))
+	const chunkSize = 500
+	for start := 0; start < len(filepaths); start += chunkSize {
+		chunk := filepaths[start:min(start+chunkSize, len(filepaths))]
+		placeholders := strings.TrimRight(strings.Repeat("?,", len(chunk)), ",")
+		query := fmt.Sprintf(`
+			SELECT c.filepath, c.colorfulness
+			FROM image_colorfulness c
+			LEFT JOIN images i ON i.filepath = c.filepath
+			WHERE c.filepath IN (%s) AND (i.content_hash IS NULL OR i.content_hash IN ('', c.content_hash))`,
+			placeholders,
+		)
+		args := make([]any, 0, len(chunk))
+		for _, p := range chunk {
+			args = append(args, p)
+		}
+		err := withSQLiteRetry(func() error {
+			rows, err := s.db.Query(query, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var (
+					p     string
+					score float64
+				)
+				if err := rows.Scan(&p, &score); err != nil {
+					return err
+				}
+				result[p] = score
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// RecordDominantColors stores the palette of filepathVal next to its MD5.
+func (s *store) RecordDominantColors(filepathVal, contentHash string, colors []dominantColor) error {
+	defer s.metrics.observe("RecordDominantColors", time.Now())
+	if colors == nil {
+		colors = []dominantColor{}
+	}
+	raw, err := json.Marshal(colors)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`
+			INSERT OR REPLACE INTO image_dominant_colors (filepath, content_hash, colors, analyzed_at) VALUES (?, ?, ?, ?)`,
+			filepathVal, contentHash, string(raw), time.Now().UnixMilli())
+		return err
+	})
+}
+
+// GetDominantColors returns the palettes of the analyzed filepaths, skipping palettes of
+// other bytes than the indexed ones like GetColorfulness.
+func (s *store) GetDominantColors(filepaths []string) (map[string][]dominantColor, error) {
+	defer s.metrics.observe("GetDominantColors", time.Now())
+	result := make(map[string][]dominantColor, len(filepaths))
+	const chunkSize = 500
+	for start := 0; start < len(filepaths); start += chunkSize {
+		chunk := filepaths[start:min(start+chunkSize, len(filepaths))]
+		placeholders := strings.TrimRight(strings.Repeat("?,", len(chunk)), ",")
+		query := fmt.Sprintf(`
+			SELECT c.filepath, c.colors
+			FROM image_dominant_colors c
+			LEFT JOIN images i ON i.filepath = c.filepath
+			WHERE c.filepath IN (%s) AND (i.content_hash IS NULL OR i.content_hash IN ('', c.content_hash))`,
+			placeholders,
+		)
+		args := make([]any, 0, len(chunk))
+		for _, p := range chunk {
+			args = append(args, p)
+		}
+		err := withSQLiteRetry(func() error {
+			rows, err := s.db.Query(query, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var p, raw string
+				if err := rows.Scan(&p, &raw); err != nil {
+					return err
+				}
+				var colors []dominantColor
+				if err := json.Unmarshal([]byte(raw), &colors); err != nil {
+					continue
+				}
+				result[p] = colors
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
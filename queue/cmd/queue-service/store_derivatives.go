@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// imageDerivative records how a generated file was produced from a source image.
+type imageDerivative struct {
+	Filepath       string `json:"filepath"`
+	SourceFilepath string `json:"source_filepath"`
+	Kind           string `json:"kind"`
+	Tool           string `json:"tool"`
+	CreatedAt      int64  `json:"created_at"`
+}
+
+func createDerivativesTable(db *sql.DB) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS image_derivatives (
+			filepath TEXT PRIMARY KEY,
+			source_filepath TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			tool TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		);
+	`); err != nil {
+		return err
+	}
+	_, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_image_derivatives_source ON image_derivatives(source_filepath, kind);`)
+	return err
+}
+
+// RecordDerivative stores the provenance of a generated file.
+func (s *store) RecordDerivative(d imageDerivative) error {
+	defer s.metrics.observe("RecordDerivative", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`
+			INSERT OR REPLACE INTO image_derivatives (filepath, source_filepath, kind, tool, created_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			d.Filepath, d.SourceFilepath, d.Kind, d.Tool, d.CreatedAt)
+		return err
+	})
+}
+
+// GetDerivative returns the provenance of filepathVal; the bool is false for originals.
+func (s *store) GetDerivative(filepathVal string) (imageDerivative, bool, error) {
+	defer s.metrics.observe("GetDerivative", time.Now())
+	var d imageDerivative
+	found := false
+	err := withSQLiteRetry(func() error {
+		err := s.db.QueryRow(`
+			SELECT filepath, source_filepath, kind, tool, created_at
+			FROM image_derivatives WHERE filepath = ?`, filepathVal).
+			Scan(&d.Filepath, &d.SourceFilepath, &d.Kind, &d.Tool, &d.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			found = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		return nil
+	})
+	return d, found, err
+}
+
+// FindDerivatives lists the files generated from source with the given kind.
+func (s *store) FindDerivatives(source, kind string) ([]imageDerivative, error) {
+	defer s.metrics.observe("FindDerivatives", time.Now())
+	var out []imageDerivative
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`
+			SELECT filepath, source_filepath, kind, tool, created_at
+			FROM image_derivatives WHERE source_filepath = ? AND kind = ?
+			ORDER BY created_at`, source, kind)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		out = make([]imageDerivative, 0)
+		for rows.Next() {
+			var d imageDerivative
+			if err := rows.Scan(&d.Filepath, &d.SourceFilepath, &d.Kind, &d.Tool, &d.CreatedAt); err != nil {
+				return err
+			}
+			out = append(out, d)
+		}
+		return rows.Err()
+	})
+	return out, err
+}
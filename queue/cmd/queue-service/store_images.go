@@ -0,0 +1,754 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const imageIndexBuiltKey = "image_index_built_at"
+
+// imageRecord is one row of the images table.
+type imageRecord struct {
+	Filepath    string
+	Username    string
+	TweetID     string
+	ContentHash string
+	MediaType   string
+	Size        int64
+	MTime       int64
+}
+
+// userStats is one row of the users table.
+type userStats struct {
+	Username   string
+	TweetCount int
+	ImageCount int
+	UpdatedAt  int64
+}
+
+// newImageRecord derives the user and tweet of a media file from its relative path.
+func newImageRecord(rel, hash string, size, mtime int64) imageRecord {
+	rel = strings.TrimPrefix(path.Clean("/"+rel), "/")
+	parts := strings.Split(rel, "/")
+	rec := imageRecord{
+		Filepath:    rel,
+		Username:    parts[0],
+		ContentHash: hash,
+		MediaType:   mediaTypeFromPath(rel),
+		Size:        size,
+		MTime:       mtime,
+	}
+	// Mirrors collectUserTweetIDs: a nested directory counts as one tweet.
+	if len(parts) > 2 {
+		if !isProfileDir(parts[1]) {
+			rec.TweetID = parts[1]
+		}
+	} else {
+		rec.TweetID = tweetIDFromFilename(path.Base(rel))
+	}
+	return rec
+}
+
+func createImageIndexTables(db *sql.DB) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS images (
+			filepath TEXT PRIMARY KEY,
+			username TEXT NOT NULL,
+			tweet_id TEXT NOT NULL DEFAULT '',
+			content_hash TEXT NOT NULL DEFAULT '',
+			media_type TEXT NOT NULL DEFAULT '',
+			size INTEGER NOT NULL DEFAULT 0,
+			mtime INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_images_username ON images(username);`,
+		`CREATE INDEX IF NOT EXISTS idx_images_content_hash ON images(content_hash);`,
+		`CREATE INDEX IF NOT EXISTS idx_images_mtime ON images(mtime, filepath);`,
+		`CREATE INDEX IF NOT EXISTS idx_images_username_mtime ON images(username, mtime, filepath);`,
+		`CREATE TABLE IF NOT EXISTS images_staging (
+			filepath TEXT PRIMARY KEY,
+			username TEXT NOT NULL,
+			tweet_id TEXT NOT NULL DEFAULT '',
+			content_hash TEXT NOT NULL DEFAULT '',
+			media_type TEXT NOT NULL DEFAULT '',
+			size INTEGER NOT NULL DEFAULT 0,
+			mtime INTEGER NOT NULL DEFAULT 0
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_images_staging_content_hash ON images_staging(content_hash);`,
+		`CREATE TABLE IF NOT EXISTS users (
+			username TEXT PRIMARY KEY,
+			tweet_count INTEGER NOT NULL DEFAULT 0,
+			image_count INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS store_meta (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insertImageRecord(db sqlExecer, rec imageRecord, now int64) error {
+	_, err := db.Exec(`
+		INSERT INTO images (filepath, username, tweet_id, content_hash, media_type, size, mtime, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(filepath) DO UPDATE SET
+			username = excluded.username,
+			tweet_id = excluded.tweet_id,
+			content_hash = excluded.content_hash,
+			media_type = excluded.media_type,
+			size = excluded.size,
+			mtime = excluded.mtime`,
+		rec.Filepath, rec.Username, rec.TweetID, rec.ContentHash, rec.MediaType, rec.Size, rec.MTime, now)
+	return err
+}
+
+// refreshUserCounts recomputes the users row for username from the images table.
+func refreshUserCounts(db sqlExecer, username string, now int64) error {
+	if _, err := db.Exec(`
+		INSERT INTO users (username, tweet_count, image_count, updated_at)
+		SELECT ?, COUNT(DISTINCT NULLIF(tweet_id, '')), COUNT(*), ? FROM images WHERE username = ?
+		ON CONFLICT(username) DO UPDATE SET
+			tweet_count = excluded.tweet_count,
+			image_count = excluded.image_count,
+			updated_at = excluded.updated_at`,
+		username, now, username); err != nil {
+		return err
+	}
+	_, err := db.Exec(`DELETE FROM users WHERE username = ? AND image_count = 0`, username)
+	return err
+}
+
+// RecordImage adds or updates a downloaded file in the image index.
+func (s *store) RecordImage(rec imageRecord) error {
+	defer s.metrics.observe("RecordImage", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		now := time.Now().UnixMilli()
+		if err := insertImageRecord(tx, rec, now); err != nil {
+			return err
+		}
+		if err := refreshUserCounts(tx, rec.Username, now); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// DeleteImageRecord removes a file from the image index.
+func (s *store) DeleteImageRecord(filepathVal string) error {
+	defer s.metrics.observe("DeleteImageRecord", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec(`DELETE FROM image_inbox WHERE filepath = ?`, filepathVal); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM image_crop_suggestions WHERE filepath = ?`, filepathVal); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM image_colorfulness WHERE filepath = ?`, filepathVal); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM image_dominant_colors WHERE filepath = ?`, filepathVal); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM image_access WHERE filepath = ?`, filepathVal); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM image_ratings WHERE filepath = ?`, filepathVal); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM collection_items WHERE filepath = ?`, filepathVal); err != nil {
+			return err
+		}
+		var username string
+		err = tx.QueryRow(`SELECT username FROM images WHERE filepath = ?`, filepathVal).Scan(&username)
+		if errors.Is(err, sql.ErrNoRows) {
+			return tx.Commit()
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM images WHERE filepath = ?`, filepathVal); err != nil {
+			return err
+		}
+		if err := refreshUserCounts(tx, username, time.Now().UnixMilli()); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// DeleteUserImages removes every indexed file of username along with its tweet metadata.
+func (s *store) DeleteUserImages(username string) error {
+	defer s.metrics.observe("DeleteUserImages", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec(`DELETE FROM images WHERE username = ?`, username); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM users WHERE username = ?`, username); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM tweets WHERE username = ?`, username); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM image_inbox WHERE filepath LIKE ?`, username+"/%"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM image_access WHERE filepath LIKE ?`, username+"/%"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM image_ratings WHERE filepath LIKE ?`, username+"/%"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM collection_items WHERE filepath LIKE ?`, username+"/%"); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// The image index is rebuilt through images_staging so a reconcile never holds the whole
+// library in memory: the scan stages files in batches, hashes and tags without a staged
+// file are pruned, and the staged rows then replace the index. Rows created after the scan
+// started belong to downloads that raced the walk and are left alone throughout.
+
+// ResetImageIndexStaging empties images_staging before a rebuild.
+func (s *store) ResetImageIndexStaging() error {
+	defer s.metrics.observe("ResetImageIndexStaging", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`DELETE FROM images_staging`)
+		return err
+	})
+}
+
+// StageImageRecords adds a batch of scanned files. A record without a content hash is a
+// file that exists but could not be read: it keeps its tags but is not indexed.
+func (s *store) StageImageRecords(records []imageRecord) error {
+	defer s.metrics.observe("StageImageRecords", time.Now())
+	if len(records) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		stmt, err := tx.Prepare(`
+			INSERT OR REPLACE INTO images_staging (filepath, username, tweet_id, content_hash, media_type, size, mtime)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, rec := range records {
+			if _, err := stmt.Exec(rec.Filepath, rec.Username, rec.TweetID, rec.ContentHash, rec.MediaType, rec.Size, rec.MTime); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// PruneUnstagedHashes deletes processed hashes that no staged file has and no file indexed
+// since since has. It returns how many were removed out of how many there were.
+func (s *store) PruneUnstagedHashes(since int64) (removed, total int, err error) {
+	defer s.metrics.observe("PruneUnstagedHashes", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM processed_images`).Scan(&total); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`
+			DELETE FROM processed_images
+			WHERE NOT EXISTS (SELECT 1 FROM images_staging s WHERE s.content_hash = processed_images.image_hash)
+			  AND NOT EXISTS (SELECT 1 FROM images i WHERE i.content_hash = processed_images.image_hash AND i.created_at >= ?)`,
+			since)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		removed = int(n)
+		return tx.Commit()
+	})
+	return removed, total, err
+}
+
+// PruneUnstagedTags deletes the tags of files that were neither staged nor indexed since
+// since, and returns how many files lost their tags.
+func (s *store) PruneUnstagedTags(since int64) (int, error) {
+	defer s.metrics.observe("PruneUnstagedTags", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	const unstaged = `
+		NOT EXISTS (SELECT 1 FROM images_staging s WHERE s.filepath = image_tags.filepath)
+		AND NOT EXISTS (SELECT 1 FROM images i WHERE i.filepath = image_tags.filepath AND i.created_at >= ?)`
+	files := 0
+	err := withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := tx.QueryRow(`SELECT COUNT(DISTINCT filepath) FROM image_tags WHERE`+unstaged, since).Scan(&files); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM image_tags WHERE`+unstaged, since); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	return files, err
+}
+
+// PromoteImageIndexStaging replaces the images and users tables with the staged files,
+// keeping rows created since since, marks the index built and empties the staging table.
+// It returns how many files were indexed.
+func (s *store) PromoteImageIndexStaging(since int64) (int, error) {
+	defer s.metrics.observe("PromoteImageIndexStaging", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	indexed := 0
+	err := withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		now := time.Now().UnixMilli()
+		if _, err := tx.Exec(`
+			DELETE FROM images
+			WHERE created_at < ?
+			  AND NOT EXISTS (SELECT 1 FROM images_staging s WHERE s.filepath = images.filepath AND s.content_hash != '')`,
+			since); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`
+			INSERT INTO images (filepath, username, tweet_id, content_hash, media_type, size, mtime, created_at)
+			SELECT filepath, username, tweet_id, content_hash, media_type, size, mtime, ?
+			FROM images_staging WHERE content_hash != ''
+			ON CONFLICT(filepath) DO UPDATE SET
+				username = excluded.username,
+				tweet_id = excluded.tweet_id,
+				content_hash = excluded.content_hash,
+				media_type = excluded.media_type,
+				size = excluded.size,
+				mtime = excluded.mtime`, now)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		indexed = int(n)
+		if _, err := tx.Exec(`DELETE FROM users`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO users (username, tweet_count, image_count, updated_at)
+			SELECT username, COUNT(DISTINCT NULLIF(tweet_id, '')), COUNT(*), ? FROM images GROUP BY username`,
+			now); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO store_meta (key, value) VALUES (?, ?)`,
+			imageIndexBuiltKey, strconv.FormatInt(now, 10)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM images_staging`); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	return indexed, err
+}
+
+// ImageIndexBuiltAt returns when the image index was last rebuilt, or the zero time if it
+// has never been built and cannot be trusted yet.
+func (s *store) ImageIndexBuiltAt() (time.Time, error) {
+	defer s.metrics.observe("ImageIndexBuiltAt", time.Now())
+	var built time.Time
+	err := withSQLiteRetry(func() error {
+		var raw string
+		err := s.db.QueryRow(`SELECT value FROM store_meta WHERE key = ?`, imageIndexBuiltKey).Scan(&raw)
+		if errors.Is(err, sql.ErrNoRows) {
+			built = time.Time{}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ms, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		built = time.UnixMilli(ms)
+		return nil
+	})
+	return built, err
+}
+
+// ListUserStats returns the cached per-user counts.
+func (s *store) ListUserStats() ([]userStats, error) {
+	defer s.metrics.observe("ListUserStats", time.Now())
+	var users []userStats
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`SELECT username, tweet_count, image_count, updated_at FROM users WHERE tweet_count > 0`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		users = make([]userStats, 0)
+		for rows.Next() {
+			var u userStats
+			if err := rows.Scan(&u.Username, &u.TweetCount, &u.ImageCount, &u.UpdatedAt); err != nil {
+				return err
+			}
+			users = append(users, u)
+		}
+		return rows.Err()
+	})
+	return users, err
+}
+
+// GetImageRecords returns the indexed rows of filepaths keyed by path. Files that are not
+// indexed are absent from the result.
+func (s *store) GetImageRecords(filepaths []string) (map[string]imageRecord, error) {
+	defer s.metrics.observe("GetImageRecords", time.Now())
+	result := make(map[string]imageRecord)
+	const chunkSize = 500
+	for start := 0; start < len(filepaths); start += chunkSize {
+		end := start + chunkSize
+		if end > len(filepaths) {
+			end = len(filepaths)
+		}
+		chunk := filepaths[start:end]
+		placeholders := strings.TrimRight(strings.Repeat("?,", len(chunk)), ",")
+		query := fmt.Sprintf(
+			"SELECT filepath, username, tweet_id, content_hash, media_type, size, mtime FROM images WHERE filepath IN (%s)",
+			placeholders,
+		)
+		args := make([]any, 0, len(chunk))
+		for _, p := range chunk {
+			args = append(args, p)
+		}
+		err := withSQLiteRetry(func() error {
+			rows, err := s.db.Query(query, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var rec imageRecord
+				if err := rows.Scan(&rec.Filepath, &rec.Username, &rec.TweetID, &rec.ContentHash, &rec.MediaType, &rec.Size, &rec.MTime); err != nil {
+					return err
+				}
+				result[rec.Filepath] = rec
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// imageHashEntry is one file of the content hash index.
+type imageHashEntry struct {
+	Hash     string `json:"hash"`
+	Filepath string `json:"filepath"`
+	Size     int64  `json:"size"`
+}
+
+// ListImageHashes returns indexed files that have a content hash, ordered by path: those
+// after the path after when set, of one user when set, skipping offset of them. The int is
+// the number of such files of the user, ignoring after and offset.
+func (s *store) ListImageHashes(user, after string, offset, limit int) ([]imageHashEntry, int, error) {
+	defer s.metrics.observe("ListImageHashes", time.Now())
+	where, args := "content_hash != ''", []any{}
+	if user != "" {
+		where += " AND username = ?"
+		args = append(args, user)
+	}
+	var entries []imageHashEntry
+	total := 0
+	err := withSQLiteRetry(func() error {
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM images WHERE `+where, args...).Scan(&total); err != nil {
+			return err
+		}
+		pageWhere, pageArgs := where, append([]any{}, args...)
+		if after != "" {
+			pageWhere += " AND filepath > ?"
+			pageArgs = append(pageArgs, after)
+		}
+		rows, err := s.db.Query(`SELECT content_hash, filepath, size FROM images WHERE `+pageWhere+`
+			ORDER BY filepath LIMIT ? OFFSET ?`, append(pageArgs, limit, offset)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		entries = make([]imageHashEntry, 0)
+		for rows.Next() {
+			var e imageHashEntry
+			if err := rows.Scan(&e.Hash, &e.Filepath, &e.Size); err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		}
+		return rows.Err()
+	})
+	return entries, total, err
+}
+
+// FindImagesByHashes returns the indexed files of each content hash, sorted by path.
+// Hashes without files are absent from the result.
+func (s *store) FindImagesByHashes(hashes []string) (map[string][]string, error) {
+	defer s.metrics.observe("FindImagesByHashes", time.Now())
+	result := make(map[string][]string)
+	const chunkSize = 500
+	for start := 0; start < len(hashes); start += chunkSize {
+		chunk := hashes[start:min(start+chunkSize, len(hashes))]
+		placeholders := strings.TrimRight(strings.Repeat("?,", len(chunk)), ",")
+		args := make([]any, 0, len(chunk))
+		for _, h := range chunk {
+			args = append(args, h)
+		}
+		err := withSQLiteRetry(func() error {
+			rows, err := s.db.Query(
+				fmt.Sprintf("SELECT content_hash, filepath FROM images WHERE content_hash IN (%s) ORDER BY filepath", placeholders),
+				args...,
+			)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var hash, p string
+				if err := rows.Scan(&hash, &p); err != nil {
+					return err
+				}
+				result[hash] = append(result[hash], p)
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// FilterProcessedHashes returns which of hashes were ever downloaded, including files
+// deleted since, which downloads keep skipping.
+func (s *store) FilterProcessedHashes(hashes []string) (map[string]bool, error) {
+	defer s.metrics.observe("FilterProcessedHashes", time.Now())
+	result := make(map[string]bool)
+	const chunkSize = 500
+	for start := 0; start < len(hashes); start += chunkSize {
+		chunk := hashes[start:min(start+chunkSize, len(hashes))]
+		placeholders := strings.TrimRight(strings.Repeat("?,", len(chunk)), ",")
+		args := make([]any, 0, len(chunk))
+		for _, h := range chunk {
+			args = append(args, h)
+		}
+		err := withSQLiteRetry(func() error {
+			rows, err := s.db.Query(
+				fmt.Sprintf("SELECT image_hash FROM processed_images WHERE image_hash IN (%s)", placeholders),
+				args...,
+			)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var hash string
+				if err := rows.Scan(&hash); err != nil {
+					return err
+				}
+				result[hash] = true
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// ImageIndexUsage returns the number and total size of the indexed files.
+// ListDuplicateImages returns the indexed files whose content hash is shared with at least
+// one other file, ordered by hash and path.
+func (s *store) ListDuplicateImages() ([]imageRecord, error) {
+	defer s.metrics.observe("ListDuplicateImages", time.Now())
+	var records []imageRecord
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`
+			SELECT filepath, username, tweet_id, content_hash, media_type, size, mtime FROM images
+			WHERE content_hash IN (
+				SELECT content_hash FROM images WHERE content_hash != ''
+				GROUP BY content_hash HAVING COUNT(*) > 1
+			)
+			ORDER BY content_hash, filepath`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		records = make([]imageRecord, 0)
+		for rows.Next() {
+			var rec imageRecord
+			if err := rows.Scan(&rec.Filepath, &rec.Username, &rec.TweetID, &rec.ContentHash, &rec.MediaType, &rec.Size, &rec.MTime); err != nil {
+				return err
+			}
+			records = append(records, rec)
+		}
+		return rows.Err()
+	})
+	return records, err
+}
+
+func (s *store) ImageIndexUsage() (int, int64, error) {
+	defer s.metrics.observe("ImageIndexUsage", time.Now())
+	var (
+		count int
+		total int64
+	)
+	err := withSQLiteRetry(func() error {
+		return s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(size), 0) FROM images`).Scan(&count, &total)
+	})
+	return count, total, err
+}
+
+// ListTweetImagePaths returns the filepath, username and tweet ID of every indexed file
+// that belongs to a tweet.
+func (s *store) ListTweetImagePaths() ([]imageRecord, error) {
+	defer s.metrics.observe("ListTweetImagePaths", time.Now())
+	var out []imageRecord
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`SELECT filepath, username, tweet_id FROM images WHERE tweet_id != ''`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		out = make([]imageRecord, 0)
+		for rows.Next() {
+			var rec imageRecord
+			if err := rows.Scan(&rec.Filepath, &rec.Username, &rec.TweetID); err != nil {
+				return err
+			}
+			out = append(out, rec)
+		}
+		return rows.Err()
+	})
+	return out, err
+}
+
+// ListImagesBefore returns up to limit indexed files newest first (mtime, then filepath,
+// both descending), starting after the position before; nil starts at the newest. An empty
+// username covers all users.
+func (s *store) ListImagesBefore(username string, before *imageInfo, limit int) ([]imageInfo, error) {
+	defer s.metrics.observe("ListImagesBefore", time.Now())
+	query := `SELECT filepath, mtime FROM images WHERE 1 = 1`
+	args := make([]any, 0, 4)
+	if username != "" {
+		query += ` AND username = ?`
+		args = append(args, username)
+	}
+	if before != nil {
+		query += ` AND (mtime, filepath) < (?, ?)`
+		args = append(args, before.MTime, before.Path)
+	}
+	query += ` ORDER BY mtime DESC, filepath DESC LIMIT ?`
+	args = append(args, limit)
+	var out []imageInfo
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		out = make([]imageInfo, 0, limit)
+		for rows.Next() {
+			var img imageInfo
+			if err := rows.Scan(&img.Path, &img.MTime); err != nil {
+				return err
+			}
+			out = append(out, img)
+		}
+		return rows.Err()
+	})
+	return out, err
+}
+
+// ListImageMTimes returns the mtime of every indexed file modified in [from, to), in Unix
+// milliseconds. An empty username covers all users.
+func (s *store) ListImageMTimes(username string, from, to int64) ([]int64, error) {
+	defer s.metrics.observe("ListImageMTimes", time.Now())
+	query := `SELECT mtime FROM images WHERE mtime >= ? AND mtime < ?`
+	args := []any{from, to}
+	if username != "" {
+		query += ` AND username = ?`
+		args = append(args, username)
+	}
+	var out []int64
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		out = make([]int64, 0)
+		for rows.Next() {
+			var mtime int64
+			if err := rows.Scan(&mtime); err != nil {
+				return err
+			}
+			out = append(out, mtime)
+		}
+		return rows.Err()
+	})
+	return out, err
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// inboxEntry is a downloaded file waiting for review.
+type inboxEntry struct {
+	Filepath string `json:"path"`
+	AddedAt  int64  `json:"added_at"`
+}
+
+func createInboxTable(db *sql.DB) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS image_inbox (
+			filepath TEXT PRIMARY KEY,
+			added_at INTEGER NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_image_inbox_added_at ON image_inbox(added_at);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddToInbox flags a newly downloaded file for review.
+func (s *store) AddToInbox(filepathVal string) error {
+	defer s.metrics.observe("AddToInbox", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`INSERT OR IGNORE INTO image_inbox (filepath, added_at) VALUES (?, ?)`,
+			filepathVal, time.Now().UnixMilli())
+		return err
+	})
+}
+
+// ListInbox returns one page of inbox files, newest first, and the total count.
+func (s *store) ListInbox(offset, limit int) ([]inboxEntry, int, error) {
+	defer s.metrics.observe("ListInbox", time.Now())
+	var entries []inboxEntry
+	total := 0
+	err := withSQLiteRetry(func() error {
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM image_inbox`).Scan(&total); err != nil {
+			return err
+		}
+		rows, err := s.db.Query(`SELECT filepath, added_at FROM image_inbox ORDER BY added_at DESC, filepath LIMIT ? OFFSET ?`, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		entries = make([]inboxEntry, 0)
+		for rows.Next() {
+			var e inboxEntry
+			if err := rows.Scan(&e.Filepath, &e.AddedAt); err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		}
+		return rows.Err()
+	})
+	return entries, total, err
+}
+
+func (s *store) CountInbox() (int, error) {
+	defer s.metrics.observe("CountInbox", time.Now())
+	count := 0
+	err := withSQLiteRetry(func() error {
+		return s.db.QueryRow(`SELECT COUNT(*) FROM image_inbox`).Scan(&count)
+	})
+	return count, err
+}
+
+// ArchiveInbox clears the inbox flag of filepaths, or of every file when all is set, and
+// returns how many were flagged.
+func (s *store) ArchiveInbox(filepaths []string, all bool) (int, error) {
+	defer s.metrics.observe("ArchiveInbox", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	archived := 0
+	err := withSQLiteRetry(func() error {
+		archived = 0
+		if all {
+			result, err := s.db.Exec(`DELETE FROM image_inbox`)
+			if err != nil {
+				return err
+			}
+			n, _ := result.RowsAffected()
+			archived = int(n)
+			return nil
+		}
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		for _, p := range filepaths {
+			result, err := tx.Exec(`DELETE FROM image_inbox WHERE filepath = ?`, p)
+			if err != nil {
+				return err
+			}
+			n, _ := result.RowsAffected()
+			archived += int(n)
+		}
+		return tx.Commit()
+	})
+	return archived, err
+}
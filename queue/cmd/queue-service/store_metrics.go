@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// storeLatencyBuckets are histogram upper bounds in seconds.
+var storeLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type storeMethodStats struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+type storeMetrics struct {
+	mu            sync.Mutex
+	slowThreshold time.Duration
+	methods       map[string]*storeMethodStats
+}
+
+func newStoreMetrics(slowThreshold time.Duration) *storeMetrics {
+	return &storeMetrics{
+		slowThreshold: slowThreshold,
+		methods:       make(map[string]*storeMethodStats),
+	}
+}
+
+// observe records the latency of a store method started at start.
+// Intended usage: defer s.metrics.observe("Method", time.Now()).
+func (m *storeMetrics) observe(method string, start time.Time) {
+	if m == nil {
+		return
+	}
+	elapsed := time.Since(start)
+	secs := elapsed.Seconds()
+
+	m.mu.Lock()
+	stats, ok := m.methods[method]
+	if !ok {
+		stats = &storeMethodStats{buckets: make([]uint64, len(storeLatencyBuckets))}
+		m.methods[method] = stats
+	}
+	for i, bound := range storeLatencyBuckets {
+		if secs <= bound {
+			stats.buckets[i]++
+		}
+	}
+	stats.count++
+	stats.sum += secs
+	threshold := m.slowThreshold
+	m.mu.Unlock()
+
+	if threshold > 0 && elapsed >= threshold {
+		logger.Warn("slow sqlite query",
+			"method", method,
+			"duration_ms", elapsed.Milliseconds(),
+			"threshold_ms", threshold.Milliseconds(),
+		)
+	}
+}
+
+// writePrometheus writes the per-method latency histograms in Prometheus text format.
+func (m *storeMetrics) writePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.methods))
+	for name := range m.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP xmd_store_query_duration_seconds Latency of SQLite store methods.")
+	fmt.Fprintln(w, "# TYPE xmd_store_query_duration_seconds histogram")
+	for _, name := range names {
+		stats := m.methods[name]
+		for i, bound := range storeLatencyBuckets {
+			fmt.Fprintf(w, "xmd_store_query_duration_seconds_bucket{method=%q,le=\"%g\"} %d\n", name, bound, stats.buckets[i])
+		}
+		fmt.Fprintf(w, "xmd_store_query_duration_seconds_bucket{method=%q,le=\"+Inf\"} %d\n", name, stats.count)
+		fmt.Fprintf(w, "xmd_store_query_duration_seconds_sum{method=%q} %g\n", name, stats.sum)
+		fmt.Fprintf(w, "xmd_store_query_duration_seconds_count{method=%q} %d\n", name, stats.count)
+	}
+}
+
+func (st *appState) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	if st.storeMetrics != nil {
+		st.storeMetrics.writePrometheus(w)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// createPerceptualHashTable keeps perceptual hashes apart from the images table, which a
+// reconcile rebuilds from disk without decoding every file.
+func createPerceptualHashTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS image_phashes (
+			filepath TEXT PRIMARY KEY,
+			content_hash TEXT NOT NULL,
+			phash TEXT NOT NULL,
+			recorded_at INTEGER NOT NULL
+		);
+	`)
+	return err
+}
+
+// RecordPerceptualHash stores the perceptual hash of filepathVal next to its MD5.
+func (s *store) RecordPerceptualHash(filepathVal, contentHash string, phash uint64) error {
+	defer s.metrics.observe("RecordPerceptualHash", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`
+			INSERT OR REPLACE INTO image_phashes (filepath, content_hash, phash, recorded_at) VALUES (?, ?, ?, ?)`,
+			filepathVal, contentHash, formatPerceptualHash(phash), time.Now().UnixMilli())
+		return err
+	})
+}
+
+// FindSimilarImage returns the recorded file whose perceptual hash is closest to phash,
+// provided it is within maxDistance bits.
+func (s *store) FindSimilarImage(phash uint64, maxDistance int) (string, int, bool, error) {
+	defer s.metrics.observe("FindSimilarImage", time.Now())
+	var (
+		bestPath string
+		bestDist = maxDistance + 1
+	)
+	err := withSQLiteRetry(func() error {
+		bestPath, bestDist = "", maxDistance+1
+		rows, err := s.db.Query(`SELECT filepath, phash FROM image_phashes`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var filepathVal, raw string
+			if err := rows.Scan(&filepathVal, &raw); err != nil {
+				return err
+			}
+			other, err := parsePerceptualHash(raw)
+			if err != nil {
+				continue
+			}
+			if d := hammingDistance(phash, other); d < bestDist {
+				bestPath, bestDist = filepathVal, d
+				if d == 0 {
+					break
+				}
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil || bestPath == "" {
+		return "", 0, false, err
+	}
+	return bestPath, bestDist, true, nil
+}
+
+// ListPerceptualHashes returns the perceptual hash of every indexed file that has one.
+func (s *store) ListPerceptualHashes() (map[string]uint64, error) {
+	defer s.metrics.observe("ListPerceptualHashes", time.Now())
+	var result map[string]uint64
+	err := withSQLiteRetry(func() error {
+		result = make(map[string]uint64)
+		rows, err := s.db.Query(`
+			SELECT p.filepath, p.phash FROM image_phashes p
+			JOIN images i ON i.filepath = p.filepath`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var filepathVal, raw string
+			if err := rows.Scan(&filepathVal, &raw); err != nil {
+				return err
+			}
+			if h, err := parsePerceptualHash(raw); err == nil {
+				result[filepathVal] = h
+			}
+		}
+		return rows.Err()
+	})
+	return result, err
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxImageRating is the highest star rating; 0 means unrated.
+const maxImageRating = 5
+
+// imageRating is the curation state of one image.
+type imageRating struct {
+	Filepath  string `json:"filepath"`
+	Favorite  bool   `json:"favorite"`
+	Rating    int    `json:"rating"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func createImageRatingsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS image_ratings (
+			filepath TEXT PRIMARY KEY,
+			favorite INTEGER NOT NULL DEFAULT 0,
+			rating INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL
+		);
+	`)
+	return err
+}
+
+// SetImageRating updates the favorite flag and/or the star rating of filepathVal; a nil
+// argument keeps the current value. It returns the resulting state.
+func (s *store) SetImageRating(filepathVal string, favorite *bool, rating *int) (imageRating, error) {
+	defer s.metrics.observe("SetImageRating", time.Now())
+	if rating != nil && (*rating < 0 || *rating > maxImageRating) {
+		return imageRating{}, fmt.Errorf("rating must be between 0 and %d", maxImageRating)
+	}
+	if favorite == nil && rating == nil {
+		return imageRating{}, errors.New("favorite or rating is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := imageRating{Filepath: filepathVal}
+	err := withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		err = tx.QueryRow(`SELECT favorite, rating FROM image_ratings WHERE filepath = ?`, filepathVal).
+			Scan(&saved.Favorite, &saved.Rating)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if favorite != nil {
+			saved.Favorite = *favorite
+		}
+		if rating != nil {
+			saved.Rating = *rating
+		}
+		saved.UpdatedAt = time.Now().UnixMilli()
+		if _, err := tx.Exec(`
+			INSERT OR REPLACE INTO image_ratings (filepath, favorite, rating, updated_at) VALUES (?, ?, ?, ?)`,
+			filepathVal, saved.Favorite, saved.Rating, saved.UpdatedAt); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	return saved, err
+}
+
+// GetImageRatings returns the state of the filepaths that were ever rated or favorited.
+func (s *store) GetImageRatings(filepaths []string) (map[string]imageRating, error) {
+	defer s.metrics.observe("GetImageRatings", time.Now())
+	result := make(map[string]imageRating, len(filepaths))
+	const chunkSize = 500
+	for start := 0; start < len(filepaths); start += chunkSize {
+		chunk := filepaths[start:min(start+chunkSize, len(filepaths))]
+		placeholders := strings.TrimRight(strings.Repeat("?,", len(chunk)), ",")
+		query := fmt.Sprintf(`
+			SELECT filepath, favorite, rating, updated_at FROM image_ratings WHERE filepath IN (%s)`,
+			placeholders,
+		)
+		args := make([]any, 0, len(chunk))
+		for _, p := range chunk {
+			args = append(args, p)
+		}
+		err := withSQLiteRetry(func() error {
+			rows, err := s.db.Query(query, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var r imageRating
+				if err := rows.Scan(&r.Filepath, &r.Favorite, &r.Rating, &r.UpdatedAt); err != nil {
+					return err
+				}
+				result[r.Filepath] = r
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
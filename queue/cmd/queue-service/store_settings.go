@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// createSettingsTable holds instance-level UI defaults edited through /api/settings.
+func createSettingsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+	`)
+	return err
+}
+
+// GetSettings returns every stored setting keyed by name.
+func (s *store) GetSettings() (map[string]string, error) {
+	defer s.metrics.observe("GetSettings", time.Now())
+	out := make(map[string]string)
+	err := withSQLiteRetry(func() error {
+		clear(out)
+		rows, err := s.db.Query(`SELECT key, value FROM settings`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key, value string
+			if err := rows.Scan(&key, &value); err != nil {
+				return err
+			}
+			out[key] = value
+		}
+		return rows.Err()
+	})
+	return out, err
+}
+
+// SaveSettings writes values. With overwrite false, keys that already exist are kept,
+// which is how environment defaults seed the table without undoing later edits.
+func (s *store) SaveSettings(values map[string]string, overwrite bool) error {
+	defer s.metrics.observe("SaveSettings", time.Now())
+	if len(values) == 0 {
+		return nil
+	}
+	verb := "INSERT OR IGNORE"
+	if overwrite {
+		verb = "INSERT OR REPLACE"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		now := time.Now().UnixMilli()
+		for key, value := range values {
+			if _, err := tx.Exec(verb+` INTO settings (key, value, updated_at) VALUES (?, ?, ?)`, key, value, now); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
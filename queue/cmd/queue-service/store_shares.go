@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// shareLink is a public link to an image, a tweet or a collection.
+type shareLink struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// Target is a filepath, "username/tweet_id" or a collection ID, depending on Kind.
+	Target       string `json:"target"`
+	ExpiresAt    int64  `json:"expires_at"`
+	CreatedAt    int64  `json:"created_at"`
+	RevokedAt    int64  `json:"revoked_at,omitempty"`
+	AccessCount  int64  `json:"access_count"`
+	LastAccessAt int64  `json:"last_access_at,omitempty"`
+}
+
+func createSharesTable(db *sql.DB) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS share_links (
+			id TEXT PRIMARY KEY,
+			kind TEXT NOT NULL,
+			target TEXT NOT NULL,
+			expires_at INTEGER NOT NULL,
+			created_at INTEGER NOT NULL,
+			revoked_at INTEGER NOT NULL DEFAULT 0,
+			access_count INTEGER NOT NULL DEFAULT 0,
+			last_access_at INTEGER NOT NULL DEFAULT 0
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_share_links_created_at ON share_links(created_at);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const shareLinkColumns = `id, kind, target, expires_at, created_at, revoked_at, access_count, last_access_at`
+
+func scanShareLink(row interface{ Scan(...any) error }) (shareLink, error) {
+	var l shareLink
+	err := row.Scan(&l.ID, &l.Kind, &l.Target, &l.ExpiresAt, &l.CreatedAt, &l.RevokedAt, &l.AccessCount, &l.LastAccessAt)
+	return l, err
+}
+
+func (s *store) CreateShareLink(l shareLink) error {
+	defer s.metrics.observe("CreateShareLink", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`
+			INSERT INTO share_links (id, kind, target, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+			l.ID, l.Kind, l.Target, l.ExpiresAt, l.CreatedAt)
+		return err
+	})
+}
+
+// ListShareLinks returns every link, newest first, including expired and revoked ones.
+func (s *store) ListShareLinks() ([]shareLink, error) {
+	defer s.metrics.observe("ListShareLinks", time.Now())
+	var links []shareLink
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`SELECT ` + shareLinkColumns + ` FROM share_links ORDER BY created_at DESC, id`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		links = make([]shareLink, 0)
+		for rows.Next() {
+			l, err := scanShareLink(rows)
+			if err != nil {
+				return err
+			}
+			links = append(links, l)
+		}
+		return rows.Err()
+	})
+	return links, err
+}
+
+// GetShareLink returns the link with id; the bool is false when it does not exist.
+func (s *store) GetShareLink(id string) (shareLink, bool, error) {
+	defer s.metrics.observe("GetShareLink", time.Now())
+	var l shareLink
+	found := false
+	err := withSQLiteRetry(func() error {
+		var err error
+		l, err = scanShareLink(s.db.QueryRow(`SELECT `+shareLinkColumns+` FROM share_links WHERE id = ?`, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			found = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		return nil
+	})
+	return l, found, err
+}
+
+// RevokeShareLink disables a link for good and reports whether it was still active.
+func (s *store) RevokeShareLink(id string) (bool, error) {
+	defer s.metrics.observe("RevokeShareLink", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var affected int64
+	err := withSQLiteRetry(func() error {
+		result, err := s.db.Exec(`UPDATE share_links SET revoked_at = ? WHERE id = ? AND revoked_at = 0`,
+			time.Now().UnixMilli(), id)
+		if err != nil {
+			return err
+		}
+		affected, _ = result.RowsAffected()
+		return nil
+	})
+	return affected > 0, err
+}
+
+// RecordShareAccess counts one opening of a link.
+func (s *store) RecordShareAccess(id string) error {
+	defer s.metrics.observe("RecordShareAccess", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`UPDATE share_links SET access_count = access_count + 1, last_access_at = ? WHERE id = ?`,
+			time.Now().UnixMilli(), id)
+		return err
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// imageSource is the URL a media file was downloaded from.
+type imageSource struct {
+	Filepath  string
+	SourceURL string
+}
+
+// createImageSourcesTable keeps source URLs apart from the images table, which a
+// reconcile rebuilds from disk.
+func createImageSourcesTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS image_sources (
+			filepath TEXT PRIMARY KEY,
+			source_url TEXT NOT NULL,
+			recorded_at INTEGER NOT NULL
+		);
+	`)
+	return err
+}
+
+// RecordImageSource stores the URL filepathVal was downloaded from.
+func (s *store) RecordImageSource(filepathVal, sourceURL string) error {
+	defer s.metrics.observe("RecordImageSource", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`
+			INSERT OR REPLACE INTO image_sources (filepath, source_url, recorded_at) VALUES (?, ?, ?)`,
+			filepathVal, sourceURL, time.Now().UnixMilli())
+		return err
+	})
+}
+
+// ListImageSources returns the recorded sources whose filepath starts with prefix.
+func (s *store) ListImageSources(prefix string) ([]imageSource, error) {
+	defer s.metrics.observe("ListImageSources", time.Now())
+	var out []imageSource
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`
+			SELECT filepath, source_url FROM image_sources
+			WHERE substr(filepath, 1, length(?)) = ? ORDER BY filepath`, prefix, prefix)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		out = make([]imageSource, 0)
+		for rows.Next() {
+			var src imageSource
+			if err := rows.Scan(&src.Filepath, &src.SourceURL); err != nil {
+				return err
+			}
+			out = append(out, src)
+		}
+		return rows.Err()
+	})
+	return out, err
+}
+
+// RenameImagePath moves every row keyed by oldPath to newPath, e.g. after a replacement
+// download changed the file extension or the file was moved by hand. The index row takes
+// the user and tweet of its new directory.
+func (s *store) RenameImagePath(oldPath, newPath string) error {
+	defer s.metrics.observe("RenameImagePath", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		stmts := []string{
+			`UPDATE OR REPLACE image_tags SET filepath = ? WHERE filepath = ?`,
+			`UPDATE OR REPLACE images SET filepath = ? WHERE filepath = ?`,
+			`UPDATE OR REPLACE image_sources SET filepath = ? WHERE filepath = ?`,
+			`UPDATE OR REPLACE image_phashes SET filepath = ? WHERE filepath = ?`,
+			`UPDATE OR REPLACE image_crop_suggestions SET filepath = ? WHERE filepath = ?`,
+			`UPDATE OR REPLACE image_colorfulness SET filepath = ? WHERE filepath = ?`,
+			`UPDATE OR REPLACE image_dominant_colors SET filepath = ? WHERE filepath = ?`,
+			`UPDATE OR REPLACE image_access SET filepath = ? WHERE filepath = ?`,
+			`UPDATE OR REPLACE image_ratings SET filepath = ? WHERE filepath = ?`,
+			`UPDATE OR REPLACE collection_items SET filepath = ? WHERE filepath = ?`,
+			`UPDATE OR REPLACE image_variants SET filepath = ? WHERE filepath = ?`,
+			`UPDATE OR REPLACE image_derivatives SET filepath = ? WHERE filepath = ?`,
+			`UPDATE image_derivatives SET source_filepath = ? WHERE source_filepath = ?`,
+			`UPDATE OR REPLACE image_inbox SET filepath = ? WHERE filepath = ?`,
+			`UPDATE OR REPLACE subscription_updates SET filepath = ? WHERE filepath = ?`,
+			`UPDATE share_links SET target = ? WHERE kind = '` + shareKindImage + `' AND target = ?`,
+		}
+		var oldUser string
+		err = tx.QueryRow(`SELECT username FROM images WHERE filepath = ?`, oldPath).Scan(&oldUser)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt, newPath, oldPath); err != nil {
+				return err
+			}
+		}
+		if oldUser != "" {
+			rec := newImageRecord(newPath, "", 0, 0)
+			if _, err := tx.Exec(`UPDATE images SET username = ?, tweet_id = ?, media_type = ? WHERE filepath = ?`,
+				rec.Username, rec.TweetID, rec.MediaType, rec.Filepath); err != nil {
+				return err
+			}
+			now := time.Now().UnixMilli()
+			if err := refreshUserCounts(tx, oldUser, now); err != nil {
+				return err
+			}
+			if rec.Username != oldUser {
+				if err := refreshUserCounts(tx, rec.Username, now); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Commit()
+	})
+}
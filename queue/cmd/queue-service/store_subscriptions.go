@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// tagSubscription is interest in a tag, optionally pushed to a webhook.
+type tagSubscription struct {
+	Tag        string `json:"tag"`
+	WebhookURL string `json:"webhook_url,omitempty"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// subscriptionUpdate records a newly downloaded file that received a subscribed tag.
+type subscriptionUpdate struct {
+	ID         int64  `json:"id"`
+	Tag        string `json:"tag"`
+	Filepath   string `json:"filepath"`
+	CreatedAt  int64  `json:"created_at"`
+	WebhookURL string `json:"-"`
+}
+
+func createSubscriptionTables(db *sql.DB) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS tag_subscriptions (
+			tag TEXT PRIMARY KEY COLLATE NOCASE,
+			webhook_url TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS subscription_updates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			tag TEXT NOT NULL COLLATE NOCASE,
+			filepath TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			UNIQUE(tag, filepath)
+		);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) ListSubscriptions() ([]tagSubscription, error) {
+	defer s.metrics.observe("ListSubscriptions", time.Now())
+	var subs []tagSubscription
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`SELECT tag, webhook_url, created_at FROM tag_subscriptions ORDER BY tag COLLATE NOCASE`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		subs = make([]tagSubscription, 0)
+		for rows.Next() {
+			var sub tagSubscription
+			if err := rows.Scan(&sub.Tag, &sub.WebhookURL, &sub.CreatedAt); err != nil {
+				return err
+			}
+			subs = append(subs, sub)
+		}
+		return rows.Err()
+	})
+	return subs, err
+}
+
+// SaveSubscription subscribes to a tag, normalized like stored tags, or updates its
+// webhook. It returns the saved entry.
+func (s *store) SaveSubscription(tag, webhookURL string) (tagSubscription, error) {
+	defer s.metrics.observe("SaveSubscription", time.Now())
+	tag = s.tagPolicy.normalize(tag)
+	if tag == "" {
+		return tagSubscription{}, errors.New("tag is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sub tagSubscription
+	err := withSQLiteRetry(func() error {
+		if _, err := s.db.Exec(`
+			INSERT INTO tag_subscriptions (tag, webhook_url, created_at) VALUES (?, ?, ?)
+			ON CONFLICT(tag) DO UPDATE SET webhook_url = excluded.webhook_url`,
+			tag, webhookURL, time.Now().UnixMilli()); err != nil {
+			return err
+		}
+		return s.db.QueryRow(`SELECT tag, webhook_url, created_at FROM tag_subscriptions WHERE tag = ?`, tag).
+			Scan(&sub.Tag, &sub.WebhookURL, &sub.CreatedAt)
+	})
+	return sub, err
+}
+
+func (s *store) DeleteSubscription(tag string) (bool, error) {
+	defer s.metrics.observe("DeleteSubscription", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var affected int64
+	err := withSQLiteRetry(func() error {
+		result, err := s.db.Exec(`DELETE FROM tag_subscriptions WHERE tag = ?`, tag)
+		if err != nil {
+			return err
+		}
+		affected, _ = result.RowsAffected()
+		return nil
+	})
+	return affected > 0, err
+}
+
+// RecordSubscriptionUpdates matches the current tags of filepathVal against the
+// subscriptions and records one update per subscribed tag. Only updates that were not
+// recorded before are returned, together with the webhook of their subscription.
+func (s *store) RecordSubscriptionUpdates(filepathVal string) ([]subscriptionUpdate, error) {
+	defer s.metrics.observe("RecordSubscriptionUpdates", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var updates []subscriptionUpdate
+	err := withSQLiteRetry(func() error {
+		updates = make([]subscriptionUpdate, 0)
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		rows, err := tx.Query(`
+			SELECT DISTINCT s.tag, s.webhook_url FROM tag_subscriptions s
+			JOIN image_tags it ON LOWER(it.tag) = LOWER(s.tag)
+			WHERE it.filepath = ?`, filepathVal)
+		if err != nil {
+			return err
+		}
+		matches := make([]subscriptionUpdate, 0)
+		for rows.Next() {
+			var u subscriptionUpdate
+			if err := rows.Scan(&u.Tag, &u.WebhookURL); err != nil {
+				rows.Close()
+				return err
+			}
+			matches = append(matches, u)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		now := time.Now().UnixMilli()
+		for _, u := range matches {
+			result, err := tx.Exec(`INSERT OR IGNORE INTO subscription_updates (tag, filepath, created_at) VALUES (?, ?, ?)`,
+				u.Tag, filepathVal, now)
+			if err != nil {
+				return err
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				continue
+			}
+			u.ID, _ = result.LastInsertId()
+			u.Filepath = filepathVal
+			u.CreatedAt = now
+			updates = append(updates, u)
+		}
+		return tx.Commit()
+	})
+	return updates, err
+}
+
+// ListSubscriptionUpdates returns updates with an ID above sinceID in ascending order,
+// optionally for one tag.
+func (s *store) ListSubscriptionUpdates(sinceID int64, tag string, limit int) ([]subscriptionUpdate, error) {
+	defer s.metrics.observe("ListSubscriptionUpdates", time.Now())
+	query := `SELECT id, tag, filepath, created_at FROM subscription_updates WHERE id > ?`
+	args := []any{sinceID}
+	if tag != "" {
+		query += ` AND tag = ?`
+		args = append(args, tag)
+	}
+	query += ` ORDER BY id LIMIT ?`
+	args = append(args, limit)
+	var updates []subscriptionUpdate
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		updates = make([]subscriptionUpdate, 0)
+		for rows.Next() {
+			var u subscriptionUpdate
+			if err := rows.Scan(&u.ID, &u.Tag, &u.Filepath, &u.CreatedAt); err != nil {
+				return err
+			}
+			updates = append(updates, u)
+		}
+		return rows.Err()
+	})
+	return updates, err
+}
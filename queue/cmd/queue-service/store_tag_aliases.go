@@ -0,0 +1,177 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// tagAlias maps an alternative spelling to the canonical tag it stands for.
+type tagAlias struct {
+	Alias     string `json:"alias"`
+	Tag       string `json:"tag"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+var (
+	errTagAliasSelf    = errors.New("alias must differ from tag")
+	errTagAliasChained = errors.New("alias must not point to another alias")
+	errTagAliasIsTag   = errors.New("tag is already the target of an alias")
+)
+
+func createTagAliasesTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS tag_aliases (
+			alias TEXT PRIMARY KEY COLLATE NOCASE,
+			tag TEXT NOT NULL COLLATE NOCASE,
+			created_at INTEGER NOT NULL
+		);
+	`)
+	return err
+}
+
+func (s *store) ListTagAliases() ([]tagAlias, error) {
+	defer s.metrics.observe("ListTagAliases", time.Now())
+	var aliases []tagAlias
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`SELECT alias, tag, created_at FROM tag_aliases ORDER BY alias COLLATE NOCASE`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		aliases = make([]tagAlias, 0)
+		for rows.Next() {
+			var a tagAlias
+			if err := rows.Scan(&a.Alias, &a.Tag, &a.CreatedAt); err != nil {
+				return err
+			}
+			aliases = append(aliases, a)
+		}
+		return rows.Err()
+	})
+	return aliases, err
+}
+
+// SaveTagAlias points alias at tag, normalized like stored tags, replacing an earlier
+// target. Aliases resolve one level only, so an alias may neither point to another alias
+// nor be the target of one.
+func (s *store) SaveTagAlias(alias, tag string) (tagAlias, error) {
+	defer s.metrics.observe("SaveTagAlias", time.Now())
+	alias = strings.ToLower(strings.TrimSpace(alias))
+	tag = s.tagPolicy.normalize(tag)
+	if alias == "" || tag == "" {
+		return tagAlias{}, errors.New("alias and tag are required")
+	}
+	if strings.EqualFold(alias, tag) {
+		return tagAlias{}, errTagAliasSelf
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var saved tagAlias
+	err := withSQLiteRetry(func() error {
+		var n int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM tag_aliases WHERE alias = ?`, tag).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return errTagAliasChained
+		}
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM tag_aliases WHERE tag = ?`, alias).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return errTagAliasIsTag
+		}
+		if _, err := s.db.Exec(`
+			INSERT INTO tag_aliases (alias, tag, created_at) VALUES (?, ?, ?)
+			ON CONFLICT(alias) DO UPDATE SET tag = excluded.tag`,
+			alias, tag, time.Now().UnixMilli()); err != nil {
+			return err
+		}
+		return s.db.QueryRow(`SELECT alias, tag, created_at FROM tag_aliases WHERE alias = ?`, alias).
+			Scan(&saved.Alias, &saved.Tag, &saved.CreatedAt)
+	})
+	return saved, err
+}
+
+// MergeTagAlias folds alias into tag for good, e.g. the creator tag of a user merged into
+// another. Unlike SaveTagAlias it keeps aliases one level deep itself: tag is replaced by
+// its own canonical tag, and aliases that pointed at alias move on to that tag.
+func (s *store) MergeTagAlias(alias, tag string) (tagAlias, error) {
+	defer s.metrics.observe("MergeTagAlias", time.Now())
+	alias = strings.ToLower(strings.TrimSpace(alias))
+	tag = s.tagPolicy.normalize(tag)
+	if alias == "" || tag == "" {
+		return tagAlias{}, errors.New("alias and tag are required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var saved tagAlias
+	err := withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		var canonical string
+		err = tx.QueryRow(`SELECT tag FROM tag_aliases WHERE alias = ?`, tag).Scan(&canonical)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if canonical == "" {
+			canonical = tag
+		}
+		if strings.EqualFold(alias, canonical) {
+			return errTagAliasSelf
+		}
+		if _, err := tx.Exec(`UPDATE tag_aliases SET tag = ? WHERE tag = ?`, canonical, alias); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO tag_aliases (alias, tag, created_at) VALUES (?, ?, ?)
+			ON CONFLICT(alias) DO UPDATE SET tag = excluded.tag`,
+			alias, canonical, time.Now().UnixMilli()); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(`SELECT alias, tag, created_at FROM tag_aliases WHERE alias = ?`, alias).
+			Scan(&saved.Alias, &saved.Tag, &saved.CreatedAt); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	return saved, err
+}
+
+func (s *store) DeleteTagAlias(alias string) (bool, error) {
+	defer s.metrics.observe("DeleteTagAlias", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var affected int64
+	err := withSQLiteRetry(func() error {
+		result, err := s.db.Exec(`DELETE FROM tag_aliases WHERE alias = ?`, strings.TrimSpace(alias))
+		if err != nil {
+			return err
+		}
+		affected, _ = result.RowsAffected()
+		return nil
+	})
+	return affected > 0, err
+}
+
+// tagAliasIndex maps lowercased aliases to their canonical tag.
+func tagAliasIndex(aliases []tagAlias) map[string]string {
+	index := make(map[string]string, len(aliases))
+	for _, a := range aliases {
+		index[strings.ToLower(a.Alias)] = a.Tag
+	}
+	return index
+}
+
+// resolveTagAlias returns the canonical tag for tag, or tag itself when it is no alias.
+func resolveTagAlias(index map[string]string, tag string) string {
+	if canonical, ok := index[strings.ToLower(strings.TrimSpace(tag))]; ok {
+		return canonical
+	}
+	return tag
+}
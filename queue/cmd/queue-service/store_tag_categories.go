@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// tagCategory is a tag namespace such as "character" in "character:hatsune_miku".
+type tagCategory struct {
+	Name      string `json:"name"`
+	Color     string `json:"color"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// defaultTagCategories are seeded once; their colors follow the usual booru scheme.
+var defaultTagCategories = []tagCategory{
+	{Name: "artist", Color: "#c00004"},
+	{Name: "character", Color: "#00ab2c"},
+	{Name: "meta", Color: "#fd9200"},
+	{Name: "rating", Color: "#a800aa"},
+}
+
+var tagCategoryNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+func createTagCategoriesTable(db *sql.DB) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS tag_categories (
+			name TEXT PRIMARY KEY COLLATE NOCASE,
+			color TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		);
+	`); err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	for _, c := range defaultTagCategories {
+		if _, err := db.Exec(`INSERT OR IGNORE INTO tag_categories (name, color, created_at) VALUES (?, ?, ?)`,
+			c.Name, c.Color, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) ListTagCategories() ([]tagCategory, error) {
+	defer s.metrics.observe("ListTagCategories", time.Now())
+	var categories []tagCategory
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`SELECT name, color, created_at FROM tag_categories ORDER BY name COLLATE NOCASE`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		categories = make([]tagCategory, 0)
+		for rows.Next() {
+			var c tagCategory
+			if err := rows.Scan(&c.Name, &c.Color, &c.CreatedAt); err != nil {
+				return err
+			}
+			categories = append(categories, c)
+		}
+		return rows.Err()
+	})
+	return categories, err
+}
+
+// SaveTagCategory adds a category or changes its color and returns the saved entry.
+func (s *store) SaveTagCategory(name, color string) (tagCategory, error) {
+	defer s.metrics.observe("SaveTagCategory", time.Now())
+	name = strings.ToLower(strings.TrimSpace(name))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var saved tagCategory
+	err := withSQLiteRetry(func() error {
+		if _, err := s.db.Exec(`
+			INSERT INTO tag_categories (name, color, created_at) VALUES (?, ?, ?)
+			ON CONFLICT(name) DO UPDATE SET color = excluded.color`,
+			name, color, time.Now().UnixMilli()); err != nil {
+			return err
+		}
+		return s.db.QueryRow(`SELECT name, color, created_at FROM tag_categories WHERE name = ?`, name).
+			Scan(&saved.Name, &saved.Color, &saved.CreatedAt)
+	})
+	return saved, err
+}
+
+// DeleteTagCategory removes a category; its tags keep their names and count as general.
+func (s *store) DeleteTagCategory(name string) (bool, error) {
+	defer s.metrics.observe("DeleteTagCategory", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var affected int64
+	err := withSQLiteRetry(func() error {
+		result, err := s.db.Exec(`DELETE FROM tag_categories WHERE name = ?`, strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		affected, _ = result.RowsAffected()
+		return nil
+	})
+	return affected > 0, err
+}
+
+// tagCategoryIndex maps lowercased category names to their entry.
+func tagCategoryIndex(categories []tagCategory) map[string]tagCategory {
+	index := make(map[string]tagCategory, len(categories))
+	for _, c := range categories {
+		index[strings.ToLower(c.Name)] = c
+	}
+	return index
+}
+
+// categoryOfTag returns the category named by the namespace of tag. Tags without a
+// namespace, or whose namespace is no known category, are general and return false.
+func categoryOfTag(index map[string]tagCategory, tag string) (tagCategory, bool) {
+	ns, _, ok := strings.Cut(tag, ":")
+	if !ok {
+		return tagCategory{}, false
+	}
+	c, ok := index[strings.ToLower(strings.TrimSpace(ns))]
+	return c, ok
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// tweetMeta is the caption data of a downloaded tweet.
+type tweetMeta struct {
+	TweetID     string `json:"tweet_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Text        string `json:"text"`
+	CreatedAt   string `json:"created_at"`
+}
+
+func createTweetsTable(db *sql.DB) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS tweets (
+			tweet_id TEXT PRIMARY KEY,
+			username TEXT NOT NULL COLLATE NOCASE,
+			display_name TEXT NOT NULL DEFAULT '',
+			text TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL DEFAULT '',
+			fetched_at INTEGER NOT NULL
+		);
+	`); err != nil {
+		return err
+	}
+	_, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_tweets_username ON tweets(username);`)
+	return err
+}
+
+// SaveTweetMeta inserts or refreshes the metadata of one tweet.
+func (s *store) SaveTweetMeta(m tweetMeta) error {
+	defer s.metrics.observe("SaveTweetMeta", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`
+			INSERT INTO tweets (tweet_id, username, display_name, text, created_at, fetched_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(tweet_id) DO UPDATE SET
+				username = excluded.username,
+				display_name = excluded.display_name,
+				text = excluded.text,
+				created_at = excluded.created_at,
+				fetched_at = excluded.fetched_at`,
+			m.TweetID, m.Username, m.DisplayName, m.Text, m.CreatedAt, time.Now().UnixMilli())
+		return err
+	})
+}
+
+// GetTweetMetas returns the stored metadata keyed by tweet ID; unknown tweets are absent.
+func (s *store) GetTweetMetas(tweetIDs []string) (map[string]tweetMeta, error) {
+	defer s.metrics.observe("GetTweetMetas", time.Now())
+	result := make(map[string]tweetMeta, len(tweetIDs))
+	const chunkSize = 500
+	for start := 0; start < len(tweetIDs); start += chunkSize {
+		end := start + chunkSize
+		if end > len(tweetIDs) {
+			end = len(tweetIDs)
+		}
+		chunk := tweetIDs[start:end]
+		placeholders := strings.TrimRight(strings.Repeat("?,", len(chunk)), ",")
+		query := fmt.Sprintf(
+			"SELECT tweet_id, username, display_name, text, created_at FROM tweets WHERE tweet_id IN (%s)",
+			placeholders,
+		)
+		args := make([]any, 0, len(chunk))
+		for _, id := range chunk {
+			args = append(args, id)
+		}
+		err := withSQLiteRetry(func() error {
+			rows, err := s.db.Query(query, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var m tweetMeta
+				if err := rows.Scan(&m.TweetID, &m.Username, &m.DisplayName, &m.Text, &m.CreatedAt); err != nil {
+					return err
+				}
+				result[m.TweetID] = m
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// imageVariant places a file in a group of versions of one logical artwork.
+type imageVariant struct {
+	Filepath  string `json:"filepath"`
+	GroupID   string `json:"group_id"`
+	Role      string `json:"role"`
+	Preferred bool   `json:"preferred"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+const (
+	variantRoleOriginal = "original"
+	variantRoleUpscaled = "upscaled"
+	variantRoleEdited   = "edited"
+)
+
+func isVariantRole(role string) bool {
+	switch role {
+	case variantRoleOriginal, variantRoleUpscaled, variantRoleEdited:
+		return true
+	}
+	return false
+}
+
+func createVariantsTable(db *sql.DB) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS image_variants (
+			filepath TEXT PRIMARY KEY,
+			group_id TEXT NOT NULL,
+			role TEXT NOT NULL DEFAULT 'original',
+			preferred INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_image_variants_group ON image_variants(group_id);`,
+		// Upscales recorded before variants existed join their source's group.
+		`INSERT OR IGNORE INTO image_variants (filepath, group_id, role, preferred, created_at)
+			SELECT source_filepath, source_filepath, 'original', 0, MIN(created_at)
+			FROM image_derivatives WHERE kind = 'upscale' GROUP BY source_filepath;`,
+		`INSERT OR IGNORE INTO image_variants (filepath, group_id, role, preferred, created_at)
+			SELECT filepath, source_filepath, 'upscaled', 0, created_at
+			FROM image_derivatives WHERE kind = 'upscale';`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LinkVariants puts members into one variant group, merging any groups they already
+// belong to, and returns the group ID. An empty role keeps the member's current role
+// (new members default to original). When preferred is set it becomes the group's only
+// preferred version.
+func (s *store) LinkVariants(members []imageVariant, preferred string) (string, error) {
+	defer s.metrics.observe("LinkVariants", time.Now())
+	if len(members) == 0 {
+		return "", errors.New("no variants to link")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var groupID string
+	err := withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		groupID = ""
+		existing := make([]string, 0)
+		for _, m := range members {
+			var g string
+			err := tx.QueryRow(`SELECT group_id FROM image_variants WHERE filepath = ?`, m.Filepath).Scan(&g)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			existing = append(existing, g)
+		}
+		if len(existing) > 0 {
+			groupID = existing[0]
+		} else {
+			groupID = members[0].Filepath
+		}
+		for _, g := range existing {
+			if g == groupID {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE image_variants SET group_id = ? WHERE group_id = ?`, groupID, g); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now().UnixMilli()
+		for _, m := range members {
+			role := m.Role
+			if role == "" {
+				role = variantRoleOriginal
+			}
+			if _, err := tx.Exec(`
+				INSERT INTO image_variants (filepath, group_id, role, preferred, created_at)
+				VALUES (?, ?, ?, 0, ?)
+				ON CONFLICT(filepath) DO UPDATE SET group_id = excluded.group_id`,
+				m.Filepath, groupID, role, now); err != nil {
+				return err
+			}
+			if m.Role != "" {
+				if _, err := tx.Exec(`UPDATE image_variants SET role = ? WHERE filepath = ?`, m.Role, m.Filepath); err != nil {
+					return err
+				}
+			}
+		}
+		if preferred != "" {
+			if _, err := tx.Exec(`UPDATE image_variants SET preferred = (filepath = ?) WHERE group_id = ?`, preferred, groupID); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	return groupID, err
+}
+
+// GetVariantGroup returns every member of the group filepathVal belongs to, or an empty
+// slice when it is not linked.
+func (s *store) GetVariantGroup(filepathVal string) ([]imageVariant, error) {
+	defer s.metrics.observe("GetVariantGroup", time.Now())
+	var out []imageVariant
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`
+			SELECT filepath, group_id, role, preferred, created_at FROM image_variants
+			WHERE group_id = (SELECT group_id FROM image_variants WHERE filepath = ?)
+			ORDER BY created_at, filepath`, filepathVal)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		out = make([]imageVariant, 0)
+		for rows.Next() {
+			var v imageVariant
+			if err := rows.Scan(&v.Filepath, &v.GroupID, &v.Role, &v.Preferred, &v.CreatedAt); err != nil {
+				return err
+			}
+			out = append(out, v)
+		}
+		return rows.Err()
+	})
+	return out, err
+}
+
+// GetVariantsForFiles returns the variant rows of the linked files among filepaths.
+func (s *store) GetVariantsForFiles(filepaths []string) (map[string]imageVariant, error) {
+	defer s.metrics.observe("GetVariantsForFiles", time.Now())
+	result := make(map[string]imageVariant)
+	const chunkSize = 500
+	for start := 0; start < len(filepaths); start += chunkSize {
+		end := start + chunkSize
+		if end > len(filepaths) {
+			end = len(filepaths)
+		}
+		chunk := filepaths[start:end]
+		placeholders := strings.TrimRight(strings.Repeat("?,", len(chunk)), ",")
+		query := fmt.Sprintf(
+			"SELECT filepath, group_id, role, preferred, created_at FROM image_variants WHERE filepath IN (%s)",
+			placeholders,
+		)
+		args := make([]any, 0, len(chunk))
+		for _, p := range chunk {
+			args = append(args, p)
+		}
+		err := withSQLiteRetry(func() error {
+			rows, err := s.db.Query(query, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var v imageVariant
+				if err := rows.Scan(&v.Filepath, &v.GroupID, &v.Role, &v.Preferred, &v.CreatedAt); err != nil {
+					return err
+				}
+				result[v.Filepath] = v
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// UnlinkVariant removes filepathVal from its group. A group left with a single member is
+// dissolved.
+func (s *store) UnlinkVariant(filepathVal string) (bool, error) {
+	defer s.metrics.observe("UnlinkVariant", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := false
+	err := withSQLiteRetry(func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		var groupID string
+		err = tx.QueryRow(`SELECT group_id FROM image_variants WHERE filepath = ?`, filepathVal).Scan(&groupID)
+		if errors.Is(err, sql.ErrNoRows) {
+			removed = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM image_variants WHERE filepath = ?`, filepathVal); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			DELETE FROM image_variants WHERE group_id = ?
+			AND (SELECT COUNT(*) FROM image_variants WHERE group_id = ?) < 2`, groupID, groupID); err != nil {
+			return err
+		}
+		removed = true
+		return tx.Commit()
+	})
+	return removed, err
+}
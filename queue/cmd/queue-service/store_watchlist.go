@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// watchEntry is one watched user.
+type watchEntry struct {
+	Username        string `json:"username"`
+	Enabled         bool   `json:"enabled"`
+	IntervalMinutes int    `json:"interval_minutes"`
+	LastSeenTweetID string `json:"last_seen_tweet_id"`
+	LastCheckedAt   int64  `json:"last_checked_at"`
+	CreatedAt       int64  `json:"created_at"`
+	// BackoffUntil (unix ms) defers the next scan after X answered 429; BackoffCount is
+	// the number of consecutive rate-limited scans and grows the delay exponentially.
+	BackoffUntil int64 `json:"backoff_until"`
+	BackoffCount int   `json:"backoff_count"`
+}
+
+func createWatchlistTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS watchlist (
+			username TEXT PRIMARY KEY COLLATE NOCASE,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			interval_minutes INTEGER NOT NULL DEFAULT 0,
+			last_seen_tweet_id TEXT NOT NULL DEFAULT '',
+			last_checked_at INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "watchlist", "backoff_until", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+	return addColumnIfMissing(db, "watchlist", "backoff_count", `INTEGER NOT NULL DEFAULT 0`)
+}
+
+func (s *store) ListWatchlist() ([]watchEntry, error) {
+	defer s.metrics.observe("ListWatchlist", time.Now())
+	var entries []watchEntry
+	err := withSQLiteRetry(func() error {
+		rows, err := s.db.Query(`
+			SELECT username, enabled, interval_minutes, last_seen_tweet_id, last_checked_at, created_at,
+				backoff_until, backoff_count
+			FROM watchlist ORDER BY username COLLATE NOCASE`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		entries = make([]watchEntry, 0)
+		for rows.Next() {
+			var e watchEntry
+			if err := rows.Scan(&e.Username, &e.Enabled, &e.IntervalMinutes, &e.LastSeenTweetID, &e.LastCheckedAt, &e.CreatedAt, &e.BackoffUntil, &e.BackoffCount); err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		}
+		return rows.Err()
+	})
+	return entries, err
+}
+
+// GetWatch returns the entry for username; the bool is false when it is not watched.
+func (s *store) GetWatch(username string) (watchEntry, bool, error) {
+	defer s.metrics.observe("GetWatch", time.Now())
+	var e watchEntry
+	found := false
+	err := withSQLiteRetry(func() error {
+		err := s.db.QueryRow(`
+			SELECT username, enabled, interval_minutes, last_seen_tweet_id, last_checked_at, created_at,
+				backoff_until, backoff_count
+			FROM watchlist WHERE username = ?`, username).
+			Scan(&e.Username, &e.Enabled, &e.IntervalMinutes, &e.LastSeenTweetID, &e.LastCheckedAt, &e.CreatedAt, &e.BackoffUntil, &e.BackoffCount)
+		if errors.Is(err, sql.ErrNoRows) {
+			found = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		return nil
+	})
+	return e, found, err
+}
+
+// SaveWatch inserts an entry or updates its enabled flag and interval, keeping progress.
+func (s *store) SaveWatch(e watchEntry) error {
+	defer s.metrics.observe("SaveWatch", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`
+			INSERT INTO watchlist (username, enabled, interval_minutes, created_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(username) DO UPDATE SET
+				enabled = excluded.enabled,
+				interval_minutes = excluded.interval_minutes`,
+			e.Username, e.Enabled, e.IntervalMinutes, time.Now().UnixMilli())
+		return err
+	})
+}
+
+// AddWatchIfMissing inserts e, including its LastCheckedAt, unless username is already
+// watched; an existing entry keeps its settings. It reports whether e was inserted.
+func (s *store) AddWatchIfMissing(e watchEntry) (bool, error) {
+	defer s.metrics.observe("AddWatchIfMissing", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var affected int64
+	err := withSQLiteRetry(func() error {
+		result, err := s.db.Exec(`
+			INSERT OR IGNORE INTO watchlist (username, enabled, interval_minutes, last_checked_at, created_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			e.Username, e.Enabled, e.IntervalMinutes, e.LastCheckedAt, time.Now().UnixMilli())
+		if err != nil {
+			return err
+		}
+		affected, _ = result.RowsAffected()
+		return nil
+	})
+	return affected > 0, err
+}
+
+func (s *store) DeleteWatch(username string) (bool, error) {
+	defer s.metrics.observe("DeleteWatch", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var affected int64
+	err := withSQLiteRetry(func() error {
+		result, err := s.db.Exec(`DELETE FROM watchlist WHERE username = ?`, username)
+		if err != nil {
+			return err
+		}
+		affected, _ = result.RowsAffected()
+		return nil
+	})
+	return affected > 0, err
+}
+
+// UpdateWatchProgress records a completed scan and clears any rate-limit backoff. An empty
+// lastSeen keeps the previous value.
+func (s *store) UpdateWatchProgress(username, lastSeen string, checkedAt time.Time) error {
+	defer s.metrics.observe("UpdateWatchProgress", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`
+			UPDATE watchlist SET
+				last_seen_tweet_id = CASE WHEN ? = '' THEN last_seen_tweet_id ELSE ? END,
+				last_checked_at = ?,
+				backoff_until = 0,
+				backoff_count = 0
+			WHERE username = ?`,
+			lastSeen, lastSeen, checkedAt.UnixMilli(), username)
+		return err
+	})
+}
+
+// RecordWatchBackoff defers username's next scan until until after a rate-limited scan.
+func (s *store) RecordWatchBackoff(username string, until time.Time, count int) error {
+	defer s.metrics.observe("RecordWatchBackoff", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return withSQLiteRetry(func() error {
+		_, err := s.db.Exec(`UPDATE watchlist SET backoff_until = ?, backoff_count = ? WHERE username = ?`,
+			until.UnixMilli(), count, username)
+		return err
+	})
+}
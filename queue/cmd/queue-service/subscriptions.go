@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	subscriptionUpdatesDefaultLimit = 100
+	subscriptionUpdatesMaxLimit     = 500
+	subscriptionWebhookTimeout      = 5 * time.Second
+)
+
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+type subscriptionRequest struct {
+	Tag        string `json:"tag"`
+	WebhookURL string `json:"webhook_url"`
+}
+
+func (st *appState) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		subs, err := st.store.ListSubscriptions()
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": subs})
+	case http.MethodPost:
+		var body subscriptionRequest
+		if !decodeJSONOrBadRequest(w, r, &body, "tag is required") {
+			return
+		}
+		body.Tag = strings.TrimSpace(body.Tag)
+		body.WebhookURL = strings.TrimSpace(body.WebhookURL)
+		if body.Tag == "" || strings.Contains(body.Tag, "/") {
+			badRequest(w, "tag is required")
+			return
+		}
+		if body.WebhookURL != "" && !validWebhookURL(body.WebhookURL) {
+			badRequest(w, "webhook_url must be an http(s) URL")
+			return
+		}
+		sub, err := st.store.SaveSubscription(body.Tag, body.WebhookURL)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		logger.Info("tag subscription saved", "tag", sub.Tag, "webhook", sub.WebhookURL != "")
+		writeJSON(w, http.StatusCreated, map[string]any{"success": true, "item": sub})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSubscriptionsSubroutes serves GET /api/subscriptions/updates and
+// DELETE /api/subscriptions/{tag}.
+func (st *appState) handleSubscriptionsSubroutes(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/subscriptions/"), "/")
+	if rest == "updates" {
+		st.handleSubscriptionUpdates(w, r)
+		return
+	}
+	if rest == "" || strings.Contains(rest, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	deleted, err := st.store.DeleteSubscription(rest)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	if !deleted {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "tag is not subscribed"})
+		return
+	}
+	logger.Info("tag subscription deleted", "tag", rest)
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "tag": rest})
+}
+
+// handleSubscriptionUpdates returns recorded updates after since_id, oldest first, so a
+// client can poll with the returned last_id.
+func (st *appState) handleSubscriptionUpdates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var sinceID int64
+	if raw := strings.TrimSpace(q.Get("since_id")); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			badRequest(w, "since_id must be a non-negative integer")
+			return
+		}
+		sinceID = v
+	}
+	limit := parsePositiveInt(q.Get("limit"), subscriptionUpdatesDefaultLimit)
+	if limit > subscriptionUpdatesMaxLimit {
+		limit = subscriptionUpdatesMaxLimit
+	}
+	updates, err := st.store.ListSubscriptionUpdates(sinceID, strings.TrimSpace(q.Get("tag")), limit)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	lastID := sinceID
+	if len(updates) > 0 {
+		lastID = updates[len(updates)-1].ID
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items":    updates,
+		"last_id":  lastID,
+		"has_more": len(updates) == limit,
+	})
+}
+
+// notifyTagSubscriptions records subscribed tags of a newly downloaded file and pushes
+// each new update to its subscription's webhook in the background.
+func (st *appState) notifyTagSubscriptions(relPath string) {
+	updates, err := st.store.RecordSubscriptionUpdates(relPath)
+	if err != nil {
+		logger.Warn("failed to record subscription updates", "filepath", relPath, "error", err)
+		return
+	}
+	for _, u := range updates {
+		if u.WebhookURL == "" {
+			continue
+		}
+		go st.postSubscriptionWebhook(u)
+	}
+}
+
+func (st *appState) postSubscriptionWebhook(u subscriptionUpdate) {
+	payload, err := json.Marshal(map[string]any{
+		"id":         u.ID,
+		"tag":        u.Tag,
+		"filepath":   u.Filepath,
+		"created_at": u.CreatedAt,
+	})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), subscriptionWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		logger.Warn("invalid subscription webhook", "tag", u.Tag, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := st.webhookHTTPClient.Do(req)
+	if err != nil {
+		logger.Warn("subscription webhook failed", "tag", u.Tag, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logger.Warn("subscription webhook rejected", "tag", u.Tag, "status", resp.StatusCode)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+)
+
+// tagPolicy normalizes tag names at write time so tags from different models
+// (e.g. "Long Hair" vs "long_hair") collapse to a single spelling.
+type tagPolicy struct {
+	// Case is "lower" or "preserve".
+	Case string
+	// Separator is "underscore", "space" or "preserve".
+	Separator string
+}
+
+func parseTagPolicy(caseMode, separator string) tagPolicy {
+	p := tagPolicy{Case: "lower", Separator: "underscore"}
+	switch strings.ToLower(strings.TrimSpace(caseMode)) {
+	case "preserve":
+		p.Case = "preserve"
+	}
+	switch strings.ToLower(strings.TrimSpace(separator)) {
+	case "space":
+		p.Separator = "space"
+	case "preserve":
+		p.Separator = "preserve"
+	}
+	return p
+}
+
+func (p tagPolicy) normalize(tag string) string {
+	t := strings.TrimSpace(tag)
+	if p.Case == "lower" {
+		t = strings.ToLower(t)
+	}
+	switch p.Separator {
+	case "underscore":
+		t = strings.Join(strings.Fields(t), "_")
+	case "space":
+		t = strings.Join(strings.Fields(strings.ReplaceAll(t, "_", " ")), " ")
+	}
+	return t
+}
+
+// normalizeTagMap applies the policy to a tag set, keeping the highest confidence
+// when several input tags collapse to the same name.
+func (p tagPolicy) normalizeTagMap(tags map[string]float64) map[string]float64 {
+	out := make(map[string]float64, len(tags))
+	for tag, conf := range tags {
+		name := p.normalize(tag)
+		if name == "" {
+			continue
+		}
+		if existing, ok := out[name]; ok && existing >= conf {
+			continue
+		}
+		out[name] = conf
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tagExportBatch is how many files are read from the store per flushed chunk.
+const tagExportBatch = 500
+
+// tagExportLine is one line of the JSON lines export.
+type tagExportLine struct {
+	Filepath string     `json:"filepath"`
+	Tags     []imageTag `json:"tags"`
+}
+
+// handleTagsExport streams every tagged file with its tags, as JSON lines (one file per
+// line) or CSV (one tag per row). The response is written batch by batch, so the
+// library size doesn't matter; a failure halfway can only cut the stream short.
+func (st *appState) handleTagsExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	switch format {
+	case "":
+		format = "jsonl"
+	case "jsonl", "csv":
+	default:
+		badRequest(w, "format must be jsonl or csv")
+		return
+	}
+	source, bySource := "", r.URL.Query().Has("source")
+	if bySource {
+		var ok bool
+		if source, ok = tagSourceParam(r.URL.Query().Get("source")); !ok {
+			badRequest(w, "source must be autotagger, manual, heuristic or creator")
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	name := fmt.Sprintf("tags-%s.%s", time.Now().Format("20060102-150405"), format)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	w.WriteHeader(http.StatusOK)
+
+	csvw := csv.NewWriter(w)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if format == "csv" {
+		_ = csvw.Write([]string{"filepath", "tag", "confidence", "source"})
+	}
+
+	ctx := r.Context()
+	after := ""
+	files := 0
+	for ctx.Err() == nil {
+		paths, err := st.store.ListTaggedFilepaths(after, tagExportBatch)
+		if err != nil {
+			logger.Error("tag export aborted", "after", after, "error", err)
+			return
+		}
+		if len(paths) == 0 {
+			break
+		}
+		after = paths[len(paths)-1]
+		tagsByPath, err := st.store.GetTagsForFiles(paths)
+		if err != nil {
+			logger.Error("tag export aborted", "after", after, "error", err)
+			return
+		}
+		for _, p := range paths {
+			tags := tagsByPath[p]
+			if bySource {
+				kept := tags[:0]
+				for _, t := range tags {
+					if t.Source == source {
+						kept = append(kept, t)
+					}
+				}
+				tags = kept
+			}
+			if len(tags) == 0 {
+				continue
+			}
+			files++
+			if format == "jsonl" {
+				if err := enc.Encode(tagExportLine{Filepath: p, Tags: tags}); err != nil {
+					return
+				}
+				continue
+			}
+			for _, t := range tags {
+				_ = csvw.Write([]string{p, t.Tag, strconv.FormatFloat(t.Confidence, 'f', -1, 64), t.Source})
+			}
+		}
+		csvw.Flush()
+		if csvw.Error() != nil || rc.Flush() != nil {
+			return
+		}
+	}
+	logger.Info("tags exported", "format", format, "files", files)
+}
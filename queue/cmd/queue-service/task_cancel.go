@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+const taskStateCancelled = "CANCELLED"
+
+func isFinishedTaskState(state string) bool {
+	switch state {
+	case "SUCCESS", "FAILURE", taskStateCancelled:
+		return true
+	}
+	return false
+}
+
+// handleTaskCancel deletes a task that is still queued and asks the worker running an
+// active one to stop. Either way the task state becomes CANCELLED so pollers stop.
+func (st *appState) handleTaskCancel(w http.ResponseWriter, r *http.Request, taskID string) {
+	ctx := r.Context()
+	rec, hasState := getTaskState(ctx, st.redis, taskID)
+	if hasState && isFinishedTaskState(rec.Status) {
+		writeJSON(w, http.StatusConflict, map[string]any{"error": "task already finished", "task_id": taskID, "state": rec.Status})
+		return
+	}
+
+	action := ""
+	for _, q := range []string{st.cfg.queueName, st.cfg.interactiveQueue} {
+		info, err := st.inspector.GetTaskInfo(q, taskID)
+		if err != nil {
+			continue
+		}
+		switch info.State {
+		case asynq.TaskStateActive:
+			if err := st.inspector.CancelProcessing(taskID); err != nil {
+				logger.Error("failed to cancel running task", "task_id", taskID, "error", err)
+				internalServerError(w)
+				return
+			}
+			action = "signalled"
+		case asynq.TaskStateCompleted, asynq.TaskStateArchived:
+			writeJSON(w, http.StatusConflict, map[string]any{"error": "task already finished", "task_id": taskID, "state": info.State.String()})
+			return
+		default:
+			if err := st.inspector.DeleteTask(q, taskID); err != nil {
+				logger.Error("failed to delete queued task", "task_id", taskID, "queue", q, "error", err)
+				internalServerError(w)
+				return
+			}
+			action = "deleted"
+		}
+		break
+	}
+	if action == "" {
+		// A task waiting in a family chain has a state but is not in asynq yet;
+		// releaseFamily skips it once it is marked cancelled.
+		if !hasState {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "task not found", "task_id": taskID})
+			return
+		}
+		action = "dequeued"
+	}
+
+	// The marker outlives progress updates a running worker may still write before it
+	// notices the cancellation.
+	st.redis.Set(ctx, taskCancelPrefix+taskID, "1", 7*24*time.Hour)
+	setTaskState(ctx, st.redis, taskID, taskStateCancelled, taskMessage(msgTaskCancelledByUser))
+	if action == "deleted" {
+		// A deleted download never reaches the worker, so its backfill report is told here.
+		if parentID, _ := st.redis.HGet(ctx, taskParentHashKey, taskID).Result(); parentID != "" {
+			url, _ := st.redis.HGet(ctx, taskURLHashKey, taskID).Result()
+			st.recordBackfillChild(ctx, parentID, taskID, url, nil)
+		}
+	}
+	logger.Info("task cancelled", "task_id", taskID, "action", action)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"task_id": taskID,
+		"state":   taskStateCancelled,
+		"action":  action,
+	})
+}
+
+// taskCancelled reports whether a task was cancelled through the API, as opposed to its
+// context ending by timeout or shutdown.
+func (st *appState) taskCancelled(ctx context.Context, taskID string) bool {
+	v, _ := st.redis.Get(context.WithoutCancel(ctx), taskCancelPrefix+taskID).Result()
+	return v != ""
+}
+
+// finishCancelledTask restores the CANCELLED state a worker may have overwritten and
+// stops asynq from retrying the task.
+func (st *appState) finishCancelledTask(ctx context.Context, taskID, taskType string) error {
+	ctx = context.WithoutCancel(ctx)
+	setTaskState(ctx, st.redis, taskID, taskStateCancelled, taskMessage(msgTaskCancelledByUser))
+	saveTaskResult(ctx, st.redis, taskID, taskType, taskStateCancelled, taskMessage(msgTaskCancelledByUser))
+	logger.Info("task stopped after cancellation", "task_id", taskID, "task_type", taskType)
+	return fmt.Errorf("task %s cancelled: %w", taskID, asynq.SkipRetry)
+}
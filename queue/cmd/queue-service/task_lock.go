@@ -2,9 +2,106 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
 )
 
+// conflictPolicy decides what happens when a task is submitted while another task of the
+// same family is still pending or running.
+type conflictPolicy string
+
+const (
+	conflictReject  conflictPolicy = "reject"
+	conflictQueue   conflictPolicy = "queue"
+	conflictReplace conflictPolicy = "replace"
+
+	familyLockPrefix    = "xmd:family-lock:"
+	familyPendingPrefix = "xmd:family-pending:"
+	familyLockTTL       = 10 * time.Second
+)
+
+var errTaskFamilyBusy = errors.New("task family busy")
+
+// taskFamily groups maintenance tasks that must not run concurrently.
+type taskFamily struct {
+	Name     string
+	TrackKey string
+	BusyCode string
+}
+
+var (
+	familyAutotag   = taskFamily{Name: "autotag", TrackKey: autotagLastTask, BusyCode: msgBusyAutotag}
+	familyReconcile = taskFamily{Name: "reconcile", TrackKey: reconcileLastTask, BusyCode: msgBusyReconcile}
+	familyRetag     = taskFamily{Name: "retag", TrackKey: retagLastTask, BusyCode: msgBusyRetag}
+)
+
+// conflictPolicies holds the default policy and per-family overrides.
+type conflictPolicies struct {
+	def       conflictPolicy
+	perFamily map[string]conflictPolicy
+}
+
+// parseConflictPolicies accepts "queue" or "reject,autotag=queue,retag=replace".
+// A bare value sets the default; unknown values fall back to reject.
+func parseConflictPolicies(raw string) conflictPolicies {
+	p := conflictPolicies{def: conflictReject, perFamily: make(map[string]conflictPolicy)}
+	parse := func(v string) (conflictPolicy, bool) {
+		switch conflictPolicy(strings.ToLower(strings.TrimSpace(v))) {
+		case conflictReject:
+			return conflictReject, true
+		case conflictQueue:
+			return conflictQueue, true
+		case conflictReplace:
+			return conflictReplace, true
+		}
+		return "", false
+	}
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			if policy, ok := parse(item); ok {
+				p.def = policy
+			}
+			continue
+		}
+		if policy, ok := parse(value); ok {
+			p.perFamily[strings.ToLower(strings.TrimSpace(name))] = policy
+		}
+	}
+	return p
+}
+
+func (p conflictPolicies) policyFor(family string) conflictPolicy {
+	if policy, ok := p.perFamily[family]; ok {
+		return policy
+	}
+	if p.def == "" {
+		return conflictReject
+	}
+	return p.def
+}
+
+// pendingFamilyTask is a task waiting in a family's chain for the running task to finish.
+type pendingFamilyTask struct {
+	TaskType string          `json:"task_type"`
+	Queue    string          `json:"queue"`
+	TaskID   string          `json:"task_id"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	// Sealed replaces Payload when task payload encryption is on.
+	Sealed  []byte `json:"sealed,omitempty"`
+	Timeout int64  `json:"timeout_seconds"`
+}
+
 func (st *appState) isTrackedTaskBusy(ctx context.Context, taskKey string) bool {
 	taskID, err := st.redis.Get(ctx, taskKey).Result()
 	if err != nil || strings.TrimSpace(taskID) == "" {
@@ -16,3 +113,197 @@ func (st *appState) isTrackedTaskBusy(ctx context.Context, taskKey string) bool
 	}
 	return rec.Status == "PENDING" || rec.Status == "PROGRESS"
 }
+
+// lockFamily serializes submit/release decisions for a family across API and worker
+// processes. The lock expires on its own if the holder dies.
+func (st *appState) lockFamily(ctx context.Context, fam taskFamily) (func(), error) {
+	key := familyLockPrefix + fam.Name
+	token := uuid.NewString()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		ok, err := st.redis.SetNX(ctx, key, token, familyLockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s task lock", fam.Name)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	return func() {
+		if v, _ := st.redis.Get(context.Background(), key).Result(); v == token {
+			st.redis.Del(context.Background(), key)
+		}
+	}, nil
+}
+
+// submitFamilyTask enqueues a family task according to the family's conflict policy.
+// It returns waiting=true when the task was chained behind the running one, and
+// errTaskFamilyBusy when the policy rejects it.
+func (st *appState) submitFamilyTask(ctx context.Context, fam taskFamily, taskType, queue, taskID string, payload any, timeout time.Duration) (bool, error) {
+	unlock, err := st.lockFamily(ctx, fam)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if st.isTrackedTaskBusy(ctx, fam.TrackKey) {
+		switch st.conflictPolicies.policyFor(fam.Name) {
+		case conflictQueue:
+			b, err := json.Marshal(payload)
+			if err != nil {
+				return false, err
+			}
+			rec := pendingFamilyTask{
+				TaskType: taskType,
+				Queue:    queue,
+				TaskID:   taskID,
+				Timeout:  int64(timeout / time.Second),
+			}
+			sealed, err := st.payloadCodec.Seal(taskType, b)
+			if err != nil {
+				return false, err
+			}
+			if isSealedPayload(sealed) {
+				rec.Sealed = sealed
+			} else {
+				rec.Payload = b
+			}
+			pending, _ := json.Marshal(rec)
+			if err := st.redis.RPush(ctx, familyPendingPrefix+fam.Name, pending).Err(); err != nil {
+				return false, err
+			}
+			return true, nil
+		case conflictReplace:
+			st.cancelFamilyTasks(ctx, fam, taskID)
+		default:
+			return false, errTaskFamilyBusy
+		}
+	}
+
+	if err := st.enqueueTask(taskType, queue, taskID, payload, timeout); err != nil {
+		return false, err
+	}
+	st.redis.Set(ctx, fam.TrackKey, taskID, 7*24*time.Hour)
+	return false, nil
+}
+
+// cancelFamilyTasks cancels the tracked task and drops the pending chain of fam.
+func (st *appState) cancelFamilyTasks(ctx context.Context, fam taskFamily, replacedBy string) {
+	message := fmt.Sprintf("Replaced by task %s", replacedBy)
+	if taskID, _ := st.redis.Get(ctx, fam.TrackKey).Result(); taskID != "" {
+		// The task is either still queued or already running; try both.
+		for _, q := range []string{st.cfg.queueName, st.cfg.interactiveQueue} {
+			_ = st.inspector.DeleteTask(q, taskID)
+		}
+		_ = st.inspector.CancelProcessing(taskID)
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": message})
+	}
+	for {
+		raw, err := st.redis.LPop(ctx, familyPendingPrefix+fam.Name).Result()
+		if err != nil || raw == "" {
+			break
+		}
+		var pending pendingFamilyTask
+		if json.Unmarshal([]byte(raw), &pending) == nil {
+			setTaskState(ctx, st.redis, pending.TaskID, "FAILURE", map[string]any{"message": message})
+		}
+	}
+	logger.Info("task family replaced", "family", fam.Name, "task_id", replacedBy)
+}
+
+// releaseFamily starts the next chained task once the tracked task of fam has finished.
+func (st *appState) releaseFamily(ctx context.Context, fam taskFamily, finishedTaskID string) {
+	unlock, err := st.lockFamily(ctx, fam)
+	if err != nil {
+		logger.Warn("failed to lock task family", "family", fam.Name, "error", err)
+		return
+	}
+	defer unlock()
+	if tracked, _ := st.redis.Get(ctx, fam.TrackKey).Result(); tracked != finishedTaskID {
+		return
+	}
+	for {
+		raw, err := st.redis.LPop(ctx, familyPendingPrefix+fam.Name).Result()
+		if err != nil || raw == "" {
+			return
+		}
+		var pending pendingFamilyTask
+		if err := json.Unmarshal([]byte(raw), &pending); err != nil {
+			continue
+		}
+		if st.taskCancelled(ctx, pending.TaskID) {
+			continue
+		}
+		if len(pending.Sealed) > 0 {
+			plain, err := st.payloadCodec.Open(pending.TaskType, pending.Sealed)
+			if err != nil {
+				logger.Error("failed to open chained task payload", "family", fam.Name, "task_id", pending.TaskID, "error", err)
+				setTaskState(ctx, st.redis, pending.TaskID, "FAILURE", map[string]any{"message": err.Error()})
+				continue
+			}
+			pending.Payload = plain
+		}
+		err = st.enqueueTask(pending.TaskType, pending.Queue, pending.TaskID, pending.Payload, time.Duration(pending.Timeout)*time.Second)
+		if err != nil {
+			logger.Error("failed to enqueue chained task", "family", fam.Name, "task_id", pending.TaskID, "error", err)
+			setTaskState(ctx, st.redis, pending.TaskID, "FAILURE", map[string]any{"message": "failed to queue task"})
+			continue
+		}
+		st.redis.Set(ctx, fam.TrackKey, pending.TaskID, 7*24*time.Hour)
+		logger.Info("chained task queued", "family", fam.Name, "task_type", pending.TaskType, "task_id", pending.TaskID)
+		return
+	}
+}
+
+// withFamilyRelease wraps a worker handler so the family chain advances when it returns.
+func (st *appState) withFamilyRelease(fam taskFamily, h asynq.HandlerFunc) asynq.HandlerFunc {
+	return func(ctx context.Context, t *asynq.Task) error {
+		err := h(ctx, t)
+		if taskID, ok := asynq.GetTaskID(ctx); ok {
+			st.releaseFamily(context.Background(), fam, taskID)
+		}
+		return err
+	}
+}
+
+// taskFamilies lists every family by name.
+var taskFamilies = []taskFamily{familyAutotag, familyReconcile, familyRetag}
+
+// familyUnlockResult describes what forceUnlockFamily cleared.
+type familyUnlockResult struct {
+	Family         string `json:"family"`
+	TaskID         string `json:"task_id,omitempty"`
+	PreviousStatus string `json:"previous_status,omitempty"`
+	Cleared        bool   `json:"cleared"`
+}
+
+// forceUnlockFamily recovers a family stuck in the busy state: it drops the submit lock,
+// marks a tracked task that still looks PENDING/PROGRESS as FAILURE and starts the next
+// chained task. The tracked task is not cancelled, in case it is still running somewhere.
+func (st *appState) forceUnlockFamily(ctx context.Context, fam taskFamily) familyUnlockResult {
+	res := familyUnlockResult{Family: fam.Name}
+	st.redis.Del(ctx, familyLockPrefix+fam.Name)
+	taskID, _ := st.redis.Get(ctx, fam.TrackKey).Result()
+	if taskID == "" {
+		return res
+	}
+	res.TaskID = taskID
+	if rec, ok := getTaskState(ctx, st.redis, taskID); ok {
+		res.PreviousStatus = rec.Status
+	}
+	if !st.isTrackedTaskBusy(ctx, fam.TrackKey) {
+		return res
+	}
+	setTaskState(ctx, st.redis, taskID, "FAILURE", taskMessage(msgTaskUnlockedByAdmin))
+	res.Cleared = true
+	st.releaseFamily(ctx, fam, taskID)
+	return res
+}
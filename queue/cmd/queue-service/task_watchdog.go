@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// taskWatchdogTick is how often the scheduler looks for tasks whose worker went away.
+const taskWatchdogTick = time.Minute
+
+// registerTaskWatchdog schedules the stale task check, unique per tick like the watchlist
+// scan so several worker processes run it once.
+func (st *appState) registerTaskWatchdog(scheduler *asynq.Scheduler) error {
+	if st.cfg.taskStaleAfter <= 0 {
+		return nil
+	}
+	_, err := scheduler.Register(
+		"@every "+taskWatchdogTick.String(),
+		asynq.NewTask(taskTypeTaskWatchdog, nil),
+		asynq.Queue(st.cfg.interactiveQueue),
+		asynq.MaxRetry(0),
+		asynq.Timeout(5*time.Minute),
+		asynq.Unique(taskWatchdogTick),
+	)
+	return err
+}
+
+// processTaskWatchdogTask marks tasks FAILURE that stopped reporting progress because their
+// worker died: a worker killed mid-task never writes a final state, and the PROGRESS it
+// left behind would keep busy checks blocked until the state expires.
+func (st *appState) processTaskWatchdogTask(ctx context.Context, _ *asynq.Task) error {
+	cutoff := time.Now().Add(-st.cfg.taskStaleAfter)
+	return scanRedisKeys(ctx, st.redis, taskMetaPrefix+"*", func(keys []string) {
+		for _, key := range keys {
+			taskID := strings.TrimPrefix(key, taskMetaPrefix)
+			rec, ok := getTaskState(ctx, st.redis, taskID)
+			if !ok || rec.Status != "PROGRESS" {
+				continue
+			}
+			updated, err := time.Parse(time.RFC3339, rec.UpdatedAt)
+			if err != nil || updated.After(cutoff) || st.taskAlive(taskID) {
+				continue
+			}
+			st.markTaskLost(ctx, taskID, updated)
+		}
+	})
+}
+
+// taskAlive reports whether asynq still runs the task or will run it again.
+func (st *appState) taskAlive(taskID string) bool {
+	for _, q := range []string{st.cfg.queueName, st.cfg.interactiveQueue} {
+		info, err := st.inspector.GetTaskInfo(q, taskID)
+		if err != nil {
+			continue
+		}
+		switch info.State {
+		case asynq.TaskStateActive, asynq.TaskStatePending, asynq.TaskStateScheduled, asynq.TaskStateRetry:
+			return true
+		}
+	}
+	return false
+}
+
+func (st *appState) markTaskLost(ctx context.Context, taskID string, lastUpdate time.Time) {
+	// Keep the last progress so the task list still shows how far it got.
+	result := map[string]any{}
+	if rec, ok := getTaskState(ctx, st.redis, taskID); ok {
+		if m, ok := rec.Result.(map[string]any); ok {
+			result = m
+		}
+	}
+	withMessage(result, "message", msgTaskWorkerLost)
+	result["last_update"] = lastUpdate.UTC().Format(time.RFC3339)
+	setTaskState(ctx, st.redis, taskID, "FAILURE", result)
+	logger.Warn("task marked as lost", "task_id", taskID, "last_update", lastUpdate)
+	// A lost family task would otherwise hold back the tasks chained behind it.
+	for _, fam := range taskFamilies {
+		st.releaseFamily(ctx, fam, taskID)
+	}
+}
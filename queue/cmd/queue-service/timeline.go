@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	timelineDefaultLimit = 30
+	timelineMaxLimit     = 100
+
+	// twitterEpochMs is the offset of X snowflake IDs; Mastodon IDs carry a Unix
+	// millisecond timestamp in their upper 48 bits.
+	twitterEpochMs = 1288834974657
+)
+
+// timelineTweet is one archived tweet of any user, ordered by when it was posted.
+type timelineTweet struct {
+	Username string
+	TweetID  string
+	PostedAt int64
+	Paths    []string
+}
+
+// tweetPostedAtMs derives the posting time of a tweet from its ID. Accounts stored as
+// user@instance come from Mastodon; everything else uses X snowflakes. IDs that predate
+// snowflakes return 0 and sort last.
+func tweetPostedAtMs(username, tweetID string) int64 {
+	id, err := strconv.ParseUint(tweetID, 10, 64)
+	if err != nil {
+		return 0
+	}
+	if strings.Contains(username, "@") {
+		return int64(id >> 16)
+	}
+	if id < 1<<32 {
+		return 0
+	}
+	return int64(id>>22) + twitterEpochMs
+}
+
+// timelineBefore orders newest first, breaking ties by tweet ID and then username so the
+// order is total and cursors are stable.
+func timelineBefore(a, b timelineTweet) bool {
+	if a.PostedAt != b.PostedAt {
+		return a.PostedAt > b.PostedAt
+	}
+	if a.TweetID != b.TweetID {
+		return a.TweetID > b.TweetID
+	}
+	return a.Username < b.Username
+}
+
+func encodeTimelineCursor(t timelineTweet) string {
+	raw := fmt.Sprintf("%d|%s|%s", t.PostedAt, t.TweetID, t.Username)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeTimelineCursor(cursor string) (timelineTweet, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return timelineTweet{}, err
+	}
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 {
+		return timelineTweet{}, errors.New("malformed cursor")
+	}
+	postedAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return timelineTweet{}, err
+	}
+	return timelineTweet{PostedAt: postedAt, TweetID: parts[1], Username: parts[2]}, nil
+}
+
+// listTimelineTweets groups every archived file by user and tweet, from the image index
+// once a reconcile has built it and by scanning user directories before that.
+func (st *appState) listTimelineTweets(ctx context.Context) ([]timelineTweet, error) {
+	timing := timingFrom(ctx)
+	start := time.Now()
+	built, err := st.store.ImageIndexBuiltAt()
+	if err != nil {
+		return nil, err
+	}
+	if !built.IsZero() {
+		records, err := st.store.ListTweetImagePaths()
+		timing.since("sqlite", start)
+		if err != nil {
+			return nil, err
+		}
+		byKey := make(map[string]*timelineTweet)
+		tweets := make([]*timelineTweet, 0)
+		for _, rec := range records {
+			key := rec.Username + "/" + rec.TweetID
+			t, ok := byKey[key]
+			if !ok {
+				t = &timelineTweet{Username: rec.Username, TweetID: rec.TweetID, PostedAt: tweetPostedAtMs(rec.Username, rec.TweetID)}
+				byKey[key] = t
+				tweets = append(tweets, t)
+			}
+			t.Paths = append(t.Paths, rec.Filepath)
+		}
+		out := make([]timelineTweet, 0, len(tweets))
+		for _, t := range tweets {
+			out = append(out, *t)
+		}
+		return out, nil
+	}
+
+	defer timing.since("fs", time.Now())
+	entries, err := os.ReadDir(st.cfg.mediaRoot)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	dirs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	scanCtx, cancel := st.scanContext(ctx)
+	defer cancel()
+	perUser := make([][]timelineTweet, len(dirs))
+	err = parallelEach(scanCtx, len(dirs), st.cfg.fsScanWorkers, func(i int) {
+		userPath := filepath.Join(st.cfg.mediaRoot, dirs[i])
+		userEntries, err := os.ReadDir(userPath)
+		if err != nil {
+			return
+		}
+		for tweetID, paths := range st.groupUserImagesByTweet(userPath, userEntries) {
+			perUser[i] = append(perUser[i], timelineTweet{Username: dirs[i], TweetID: tweetID, PostedAt: tweetPostedAtMs(dirs[i], tweetID), Paths: paths})
+		}
+	})
+	if err != nil {
+		return nil, scanError(err)
+	}
+	out := make([]timelineTweet, 0)
+	for _, tweets := range perUser {
+		out = append(out, tweets...)
+	}
+	return out, nil
+}
+
+// handleTimeline lists archived tweets of all users newest first with cursor pagination.
+func (st *appState) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	limit := parsePositiveInt(r.URL.Query().Get("limit"), timelineDefaultLimit)
+	if limit > timelineMaxLimit {
+		limit = timelineMaxLimit
+	}
+	var after *timelineTweet
+	if raw := strings.TrimSpace(r.URL.Query().Get("cursor")); raw != "" {
+		c, err := decodeTimelineCursor(raw)
+		if err != nil {
+			badRequest(w, "invalid cursor")
+			return
+		}
+		after = &c
+	}
+	excludeTags := parseExcludeTags(r.URL.Query())
+
+	ctx := r.Context()
+	tweets, err := st.listTimelineTweets(ctx)
+	if err != nil {
+		writeScanError(w, err)
+		return
+	}
+	sort.Slice(tweets, func(i, j int) bool { return timelineBefore(tweets[i], tweets[j]) })
+	if after != nil {
+		start := sort.Search(len(tweets), func(i int) bool { return timelineBefore(*after, tweets[i]) })
+		tweets = tweets[start:]
+	}
+
+	items := make([]map[string]any, 0, limit)
+	var last timelineTweet
+	hasMore := false
+	for _, t := range tweets {
+		if len(items) == limit {
+			hasMore = true
+			break
+		}
+		item, err := st.timelineItem(ctx, t, excludeTags)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		last = t
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+	if err := st.attachTweetMetas(ctx, items); err != nil {
+		internalServerError(w)
+		return
+	}
+
+	resp := map[string]any{"items": items, "has_more": hasMore}
+	if hasMore {
+		resp["next_cursor"] = encodeTimelineCursor(last)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// timelineItem renders one tweet with its media, tags and hashes. It returns nil when
+// every file is excluded by excludeTags.
+func (st *appState) timelineItem(ctx context.Context, t timelineTweet, excludeTags []string) (map[string]any, error) {
+	paths := append([]string(nil), t.Paths...)
+	sort.Strings(paths)
+	start := time.Now()
+	defer timingFrom(ctx).since("sqlite", start)
+	tagsMap, err := st.store.GetTagsForFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	records, err := st.store.GetImageRecords(paths)
+	if err != nil {
+		return nil, err
+	}
+	images := make([]any, 0, len(paths))
+	for _, p := range paths {
+		if hasTagPattern(tagsMap[p], excludeTags) {
+			continue
+		}
+		item := map[string]any{"path": p, "media_type": mediaTypeFromPath(p), "tags": tagsMap[p]}
+		if rec, ok := records[p]; ok && rec.ContentHash != "" {
+			item["hash"] = rec.ContentHash
+		}
+		images = append(images, item)
+	}
+	if len(images) == 0 {
+		return nil, nil
+	}
+	entry := map[string]any{
+		"username": t.Username,
+		"tweet_id": t.TweetID,
+		"images":   images,
+	}
+	if t.PostedAt > 0 {
+		entry["posted_at"] = time.UnixMilli(t.PostedAt).UTC().Format(time.RFC3339)
+	}
+	return entry, nil
+}
+
+// attachTweetMetas adds the saved display name, text and creation time to timeline items.
+func (st *appState) attachTweetMetas(ctx context.Context, items []map[string]any) error {
+	tweetIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		tweetIDs = append(tweetIDs, item["tweet_id"].(string))
+	}
+	start := time.Now()
+	metas, err := st.store.GetTweetMetas(tweetIDs)
+	timingFrom(ctx).since("sqlite", start)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		meta, ok := metas[item["tweet_id"].(string)]
+		if !ok || !strings.EqualFold(meta.Username, item["username"].(string)) {
+			continue
+		}
+		if meta.DisplayName != "" {
+			item["display_name"] = meta.DisplayName
+		}
+		if meta.Text != "" {
+			item["text"] = meta.Text
+		}
+		if meta.CreatedAt != "" {
+			item["created_at"] = meta.CreatedAt
+		}
+	}
+	return nil
+}
+
+// handleOnThisDay lists tweets posted on today's month and day in earlier years, newest
+// year first. date=MM-DD picks another day and tz sets where the day boundaries fall.
+func (st *appState) handleOnThisDay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	loc := time.Local
+	if tz := strings.TrimSpace(q.Get("tz")); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			badRequest(w, "invalid tz")
+			return
+		}
+		loc = l
+	}
+	now := time.Now().In(loc)
+	month, day := now.Month(), now.Day()
+	if raw := strings.TrimSpace(q.Get("date")); raw != "" {
+		// Parsed against a leap year so 02-29 is accepted.
+		d, err := time.Parse("2006-01-02", "2000-"+raw)
+		if err != nil {
+			badRequest(w, "date must be MM-DD")
+			return
+		}
+		month, day = d.Month(), d.Day()
+	}
+	limit := parsePositiveInt(q.Get("limit"), timelineMaxLimit)
+	if limit > timelineMaxLimit {
+		limit = timelineMaxLimit
+	}
+	excludeTags := parseExcludeTags(q)
+
+	ctx := r.Context()
+	tweets, err := st.listTimelineTweets(ctx)
+	if err != nil {
+		writeScanError(w, err)
+		return
+	}
+	matches := make([]timelineTweet, 0)
+	for _, t := range tweets {
+		if t.PostedAt <= 0 {
+			continue
+		}
+		posted := time.UnixMilli(t.PostedAt).In(loc)
+		if posted.Month() == month && posted.Day() == day && posted.Year() < now.Year() {
+			matches = append(matches, t)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return timelineBefore(matches[i], matches[j]) })
+
+	items := make([]map[string]any, 0)
+	for _, t := range matches {
+		if len(items) == limit {
+			break
+		}
+		item, err := st.timelineItem(ctx, t, excludeTags)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if item == nil {
+			continue
+		}
+		item["years_ago"] = now.Year() - time.UnixMilli(t.PostedAt).In(loc).Year()
+		items = append(items, item)
+	}
+	if err := st.attachTweetMetas(ctx, items); err != nil {
+		internalServerError(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"date":  fmt.Sprintf("%02d-%02d", int(month), day),
+		"tz":    loc.String(),
+		"total": len(matches),
+		"items": items,
+	})
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tweetMetadataBackend is an alternative source of tweet media used when the
+// syndication API fails or rate limits.
+type tweetMetadataBackend interface {
+	Name() string
+	FetchMedia(ctx context.Context, client *http.Client, username, tweetID string) ([]tweetMedia, error)
+}
+
+// parseTweetFallbacks builds the fallback chain from TWEET_FALLBACKS, e.g.
+// "fxtwitter,vxtwitter,nitter=https://nitter.net|https://nitter.example".
+func parseTweetFallbacks(raw string) []tweetMetadataBackend {
+	backends := make([]tweetMetadataBackend, 0)
+	for _, item := range splitCSV(raw) {
+		name, arg, _ := strings.Cut(item, "=")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "fxtwitter":
+			backends = append(backends, fxTwitterBackend{baseURL: "https://api.fxtwitter.com"})
+		case "vxtwitter":
+			backends = append(backends, vxTwitterBackend{baseURL: "https://api.vxtwitter.com"})
+		case "nitter":
+			for _, instance := range strings.Split(arg, "|") {
+				instance = strings.TrimRight(strings.TrimSpace(instance), "/")
+				if instance != "" {
+					backends = append(backends, nitterBackend{instance: instance})
+				}
+			}
+		default:
+			logger.Warn("unknown tweet fallback backend", "backend", item)
+		}
+	}
+	return backends
+}
+
+// backendHealth tracks consecutive failures so unhealthy backends are skipped for a cooldown.
+type backendHealth struct {
+	Name                string `json:"name"`
+	Successes           int    `json:"successes"`
+	Failures            int    `json:"failures"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+	LastSuccessAt       string `json:"last_success_at,omitempty"`
+	LastFailureAt       string `json:"last_failure_at,omitempty"`
+	CooldownUntil       string `json:"cooldown_until,omitempty"`
+
+	cooldownUntil time.Time
+}
+
+// backendHealthTracker keeps health in memory for cooldown decisions and mirrors it to
+// Redis so the API process can report what the worker observed.
+type backendHealthTracker struct {
+	mu       sync.Mutex
+	rdb      RedisClient
+	backends map[string]*backendHealth
+}
+
+const (
+	backendFailureThreshold = 3
+	backendBaseCooldown     = 5 * time.Minute
+	backendMaxCooldown      = time.Hour
+)
+
+func newBackendHealthTracker(rdb RedisClient) *backendHealthTracker {
+	return &backendHealthTracker{rdb: rdb, backends: make(map[string]*backendHealth)}
+}
+
+// persist writes a copy of a health record. Callers release h.mu first so a slow Redis
+// doesn't hold up available() checks of every download.
+func (h *backendHealthTracker) persist(b backendHealth) {
+	if h.rdb == nil {
+		return
+	}
+	raw, _ := json.Marshal(b)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := h.rdb.HSet(ctx, backendHealthKey, b.Name, raw).Err(); err != nil {
+		logger.Warn("failed to persist backend health", "backend", b.Name, "error", err)
+	}
+}
+
+func (h *backendHealthTracker) get(name string) *backendHealth {
+	b, ok := h.backends[name]
+	if !ok {
+		b = &backendHealth{Name: name}
+		h.backends[name] = b
+	}
+	return b
+}
+
+func (h *backendHealthTracker) available(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Now().After(h.get(name).cooldownUntil)
+}
+
+func (h *backendHealthTracker) recordSuccess(name string) {
+	h.mu.Lock()
+	b := h.get(name)
+	b.Successes++
+	b.ConsecutiveFailures = 0
+	b.LastSuccessAt = time.Now().UTC().Format(time.RFC3339)
+	b.cooldownUntil = time.Time{}
+	b.CooldownUntil = ""
+	snapshot := *b
+	h.mu.Unlock()
+	h.persist(snapshot)
+}
+
+func (h *backendHealthTracker) recordFailure(name string, err error) {
+	h.mu.Lock()
+	b := h.get(name)
+	b.Failures++
+	b.ConsecutiveFailures++
+	b.LastError = err.Error()
+	b.LastFailureAt = time.Now().UTC().Format(time.RFC3339)
+	if b.ConsecutiveFailures >= backendFailureThreshold {
+		cooldown := backendBaseCooldown << (b.ConsecutiveFailures - backendFailureThreshold)
+		if cooldown > backendMaxCooldown || cooldown <= 0 {
+			cooldown = backendMaxCooldown
+		}
+		b.cooldownUntil = time.Now().Add(cooldown)
+		b.CooldownUntil = b.cooldownUntil.UTC().Format(time.RFC3339)
+	}
+	snapshot := *b
+	h.mu.Unlock()
+	h.persist(snapshot)
+}
+
+// snapshot returns the health records persisted by any process.
+func (h *backendHealthTracker) snapshot(ctx context.Context) ([]backendHealth, error) {
+	raw, err := h.rdb.HGetAll(ctx, backendHealthKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]backendHealth, 0, len(raw))
+	for _, v := range raw {
+		var b backendHealth
+		if err := json.Unmarshal([]byte(v), &b); err == nil {
+			items = append(items, b)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, nil
+}
+
+// fetchTweetMediaFallback walks the fallback chain, skipping backends in cooldown.
+func (st *appState) fetchTweetMediaFallback(ctx context.Context, username, tweetID string) ([]tweetMedia, error) {
+	var lastErr error
+	for _, backend := range st.tweetBackends {
+		name := backend.Name()
+		if !st.backendHealth.available(name) {
+			continue
+		}
+		media, err := backend.FetchMedia(ctx, st.downloadHTTPClient, username, tweetID)
+		if err != nil {
+			st.backendHealth.recordFailure(name, err)
+			logger.Warn("tweet fallback backend failed", "backend", name, "tweet_id", tweetID, "error", err)
+			lastErr = err
+			continue
+		}
+		st.backendHealth.recordSuccess(name)
+		return media, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no healthy fallback backend available")
+	}
+	return nil, lastErr
+}
+
+func (st *appState) handleBackendsHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	names := make([]string, 0, len(st.tweetBackends))
+	for _, b := range st.tweetBackends {
+		names = append(names, b.Name())
+	}
+	health, err := st.backendHealth.snapshot(r.Context())
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"fallback_chain": names,
+		"backends":       health,
+	})
+}
+
+func fetchBackendJSON(ctx context.Context, client *http.Client, apiURL string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status=%d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, dst)
+}
+
+type fxTwitterBackend struct {
+	baseURL string
+}
+
+func (b fxTwitterBackend) Name() string { return "fxtwitter" }
+
+func (b fxTwitterBackend) FetchMedia(ctx context.Context, client *http.Client, username, tweetID string) ([]tweetMedia, error) {
+	var parsed struct {
+		Code  int `json:"code"`
+		Tweet struct {
+			Media struct {
+				Photos []struct {
+					URL string `json:"url"`
+				} `json:"photos"`
+				Videos []struct {
+					URL  string `json:"url"`
+					Type string `json:"type"`
+				} `json:"videos"`
+			} `json:"media"`
+		} `json:"tweet"`
+	}
+	apiURL := fmt.Sprintf("%s/%s/status/%s", b.baseURL, url.PathEscape(username), url.PathEscape(tweetID))
+	if err := fetchBackendJSON(ctx, client, apiURL, &parsed); err != nil {
+		return nil, err
+	}
+	if parsed.Code != 0 && parsed.Code != http.StatusOK {
+		return nil, fmt.Errorf("fxtwitter code=%d", parsed.Code)
+	}
+	media := make([]tweetMedia, 0)
+	for _, p := range parsed.Tweet.Media.Photos {
+		if p.URL != "" {
+			media = append(media, tweetMedia{URL: origPhotoURL(p.URL), Type: mediaTypeImage})
+		}
+	}
+	for _, v := range parsed.Tweet.Media.Videos {
+		if v.URL != "" && v.Type == "gif" {
+			media = append(media, tweetMedia{URL: v.URL, Type: mediaTypeAnimatedGIF})
+		}
+	}
+	return media, nil
+}
+
+type vxTwitterBackend struct {
+	baseURL string
+}
+
+func (b vxTwitterBackend) Name() string { return "vxtwitter" }
+
+func (b vxTwitterBackend) FetchMedia(ctx context.Context, client *http.Client, username, tweetID string) ([]tweetMedia, error) {
+	var parsed struct {
+		MediaExtended []struct {
+			Type string `json:"type"`
+			URL  string `json:"url"`
+		} `json:"media_extended"`
+	}
+	apiURL := fmt.Sprintf("%s/%s/status/%s", b.baseURL, url.PathEscape(username), url.PathEscape(tweetID))
+	if err := fetchBackendJSON(ctx, client, apiURL, &parsed); err != nil {
+		return nil, err
+	}
+	media := make([]tweetMedia, 0)
+	for _, m := range parsed.MediaExtended {
+		if m.URL == "" {
+			continue
+		}
+		switch m.Type {
+		case "image":
+			media = append(media, tweetMedia{URL: origPhotoURL(m.URL), Type: mediaTypeImage})
+		case "gif":
+			media = append(media, tweetMedia{URL: m.URL, Type: mediaTypeAnimatedGIF})
+		}
+	}
+	return media, nil
+}
+
+var (
+	nitterImageRe = regexp.MustCompile(`href="/pic/orig/(media%2F[^"]+)"`)
+	nitterGIFRe   = regexp.MustCompile(`<source src="/pic/(video\.twimg\.com%2Ftweet_video%2F[^"]+)"`)
+)
+
+type nitterBackend struct {
+	instance string
+}
+
+func (b nitterBackend) Name() string { return "nitter:" + b.instance }
+
+func (b nitterBackend) FetchMedia(ctx context.Context, client *http.Client, username, tweetID string) ([]tweetMedia, error) {
+	pageURL := fmt.Sprintf("%s/%s/status/%s", b.instance, url.PathEscape(username), url.PathEscape(tweetID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("status=%d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	media := make([]tweetMedia, 0)
+	seen := make(map[string]struct{})
+	for _, m := range nitterImageRe.FindAllSubmatch(body, -1) {
+		p, err := url.PathUnescape(string(m[1]))
+		if err != nil {
+			continue
+		}
+		u := origPhotoURL("https://pbs.twimg.com/" + p)
+		if _, ok := seen[u]; !ok {
+			seen[u] = struct{}{}
+			media = append(media, tweetMedia{URL: u, Type: mediaTypeImage})
+		}
+	}
+	for _, m := range nitterGIFRe.FindAllSubmatch(body, -1) {
+		p, err := url.PathUnescape(string(m[1]))
+		if err != nil {
+			continue
+		}
+		u := "https://" + p
+		if _, ok := seen[u]; !ok {
+			seen[u] = struct{}{}
+			media = append(media, tweetMedia{URL: u, Type: mediaTypeAnimatedGIF})
+		}
+	}
+	return media, nil
+}
+
+// origPhotoURL requests the original-size rendition of a pbs.twimg.com photo.
+func origPhotoURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || !strings.HasSuffix(u.Host, "twimg.com") {
+		return raw
+	}
+	q := u.Query()
+	q.Set("name", "orig")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
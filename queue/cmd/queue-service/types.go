@@ -2,37 +2,142 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"net/http"
 	"sync"
+	"time"
 )
 
 type config struct {
-	redisAddr        string
-	redisPassword    string
-	redisDB          int
-	queueName        string
-	interactiveQueue string
-	mediaRoot        string
-	dbPath           string
-	autotaggerURL    string
-	autotaggerEnable bool
-	concurrency      int
-	apiAddr          string
+	redisAddr                 string
+	redisPassword             string
+	redisDB                   int
+	redisUsername             string
+	redisSentinelAddrs        string
+	redisMasterName           string
+	redisSentinelUsername     string
+	redisSentinelPassword     string
+	redisClusterAddrs         string
+	redisTLS                  bool
+	redisTLSCAFile            string
+	redisTLSCertFile          string
+	redisTLSKeyFile           string
+	redisTLSServerName        string
+	redisTLSInsecure          bool
+	queueName                 string
+	interactiveQueue          string
+	mediaRoot                 string
+	dbPath                    string
+	autotaggerURL             string
+	autotaggerEnable          bool
+	heuristicTagger           bool
+	heuristicTagHashtags      bool
+	heuristicTagCreator       bool
+	heuristicTagKeywords      string
+	creatorTag                bool
+	creatorTagPrefix          string
+	concurrency               int
+	apiAddr                   string
+	slowQueryMs               int
+	xAuthToken                string
+	xCT0                      string
+	xCookieFile               string
+	xGraphQLQueryID           string
+	xGraphQLUserQueryID       string
+	xGraphQLUserMediaQueryID  string
+	tweetFallbacks            string
+	tagCase                   string
+	tagSeparator              string
+	proxyURL                  string
+	proxyHosts                string
+	downloadUserAgent         string
+	downloadUserAgentFile     string
+	downloadHeaders           string
+	hostRateLimit             float64
+	hostRateBurst             int
+	downloadRateLimit         int64
+	downloadTaskRateLimit     int64
+	downloadMaxRetry          int
+	downloadRetryDelay        time.Duration
+	fsScanWorkers             int
+	fsScanTimeout             time.Duration
+	watchlistIntervalMinutes  int
+	watchlistJitterPercent    int
+	watchlistBackoffBase      time.Duration
+	watchlistBackoffMax       time.Duration
+	downloadMediaConcurrency  int
+	downloadPrecheckMin       int
+	taskConflictPolicy        string
+	serverTiming              bool
+	taskStaleAfter            time.Duration
+	taskRetention             time.Duration
+	taskArchiveMax            int
+	taskArchiveMaxAge         time.Duration
+	accessFlushInterval       time.Duration
+	shareSecret               string
+	taskPayloadCodec          string
+	taskPayloadKey            string
+	taskPayloadPreviousKeys   string
+	shareDefaultHours         int
+	publicAPIAddr             string
+	publicEndpoints           string
+	publicNSFWVisible         bool
+	progressInterval          time.Duration
+	upscalerURL               string
+	upscalerScale             int
+	phashDedupDistance        int
+	borderDetect              bool
+	borderTolerance           int
+	colorAnalysis             bool
+	colorMonoThreshold        float64
+	mediaMaxFileSize          int64
+	mediaRootQuota            int64
+	archiveMaxBytes           int64
+	archiveMaxEntries         int
+	publicBaseURL             string
+	wsAllowedOrigins          string
+	defaultSort               string
+	defaultPerPage            int
+	nsfwVisible               bool
+	thumbnailSize             int
+	profileMedia              bool
+	externalDownloader        string
+	externalDownloaderPath    string
+	externalDownloaderArgs    string
+	externalDownloaderMode    string
+	externalDownloaderTimeout time.Duration
+	mirrorRoot                string
+	mirrorMode                string
 }
 
 type appState struct {
-	cfg                config
-	redis              RedisClient
-	asynqCli           AsynqClient
-	store              TagStore
-	inspector          QueueInspector
-	downloadHTTPClient *http.Client
-	autotagHTTPClient  *http.Client
+	cfg                 config
+	redis               RedisClient
+	asynqCli            AsynqClient
+	store               TagStore
+	inspector           QueueInspector
+	downloadHTTPClient  *http.Client
+	mediaClient         httpDoer
+	downloadRateLimiter *byteRateLimiter
+	autotagHTTPClient   *http.Client
+	upscaleHTTPClient   *http.Client
+	webhookHTTPClient   *http.Client
+	storeMetrics        *storeMetrics
+	xAuth               *xAuthSession
+	tweetBackends       []tweetMetadataBackend
+	backendHealth       *backendHealthTracker
+	conflictPolicies    conflictPolicies
+	access              *accessCounter
+	shareKey            []byte
+	payloadCodec        payloadCodec
+	heuristicTagger     *heuristicTagger
 }
 
 type store struct {
-	db *sql.DB
-	mu sync.Mutex
+	db        *sql.DB
+	mu        sync.Mutex
+	metrics   *storeMetrics
+	tagPolicy tagPolicy
 }
 
 type queueTaskStatus struct {
@@ -42,8 +147,25 @@ type queueTaskStatus struct {
 }
 
 type downloadTaskPayload struct {
-	TaskID string `json:"task_id"`
-	URL    string `json:"url"`
+	TaskID       string   `json:"task_id"`
+	URL          string   `json:"url"`
+	Expand       []string `json:"expand,omitempty"`
+	ParentTaskID string   `json:"parent_task_id,omitempty"`
+	// Upload is set for media supplied through POST /api/upload.
+	Upload *downloadUpload `json:"upload,omitempty"`
+}
+
+// precheckTaskPayload carries tweet downloads whose media is checked in one pass before
+// any of them takes a download worker slot. Items keep the task IDs already tracked.
+type precheckTaskPayload struct {
+	TaskID string                `json:"task_id"`
+	Queue  string                `json:"queue"`
+	Items  []downloadTaskPayload `json:"items"`
+}
+
+type timelineTaskPayload struct {
+	TaskID   string `json:"task_id"`
+	Username string `json:"username"`
 }
 
 type autotagTaskPayload struct {
@@ -55,11 +177,50 @@ type deleteUserTaskPayload struct {
 	Username string `json:"username"`
 }
 
+type cleanupEmptyUsersTaskPayload struct {
+	TaskID string `json:"task_id"`
+	DryRun bool   `json:"dry_run"`
+}
+
+type watchlistScanTaskPayload struct {
+	TaskID string `json:"task_id"`
+}
+
+type refreshResolutionTaskPayload struct {
+	TaskID string `json:"task_id"`
+	User   string `json:"user,omitempty"`
+	DryRun bool   `json:"dry_run"`
+}
+
+type mirrorBackfillTaskPayload struct {
+	TaskID string `json:"task_id"`
+}
+
+type normalizeTagsTaskPayload struct {
+	TaskID string `json:"task_id"`
+}
+
 type deleteImageTaskPayload struct {
 	TaskID   string `json:"task_id"`
 	Filepath string `json:"filepath"`
 }
 
+type editImageTaskPayload struct {
+	TaskID     string        `json:"task_id"`
+	Filepath   string        `json:"filepath"`
+	Operations []imageEditOp `json:"operations"`
+}
+
+type detectBordersTaskPayload struct {
+	TaskID    string   `json:"task_id"`
+	Filepaths []string `json:"filepaths"`
+}
+
+type analyzeColorsTaskPayload struct {
+	TaskID    string   `json:"task_id"`
+	Filepaths []string `json:"filepaths"`
+}
+
 type deleteImagesTaskPayload struct {
 	TaskID    string   `json:"task_id"`
 	Filepaths []string `json:"filepaths"`
@@ -75,15 +236,66 @@ type retagImagesTaskPayload struct {
 	Filepaths []string `json:"filepaths"`
 }
 
+type upscaleImagesTaskPayload struct {
+	TaskID    string   `json:"task_id"`
+	Filepaths []string `json:"filepaths"`
+}
+
+type exportTagsTaskPayload struct {
+	TaskID        string   `json:"task_id"`
+	Filepaths     []string `json:"filepaths"`
+	MinConfidence float64  `json:"min_confidence,omitempty"`
+	IncludeImages bool     `json:"include_images,omitempty"`
+}
+
+type exportMediaTaskPayload struct {
+	TaskID    string   `json:"task_id"`
+	Filepaths []string `json:"filepaths"`
+	Manifest  bool     `json:"manifest,omitempty"`
+}
+
+type datasetOptions struct {
+	MinConfidence float64 `json:"min_confidence,omitempty"`
+	Format        string  `json:"format"`
+	Resolution    int     `json:"resolution,omitempty"`
+	Crop          string  `json:"crop"`
+	MinSide       int     `json:"min_side,omitempty"`
+	ValRatio      float64 `json:"val_ratio"`
+	Seed          int64   `json:"seed,omitempty"`
+}
+
+type datasetTaskPayload struct {
+	TaskID    string         `json:"task_id"`
+	Filepaths []string       `json:"filepaths"`
+	Options   datasetOptions `json:"options"`
+}
+
+type deleteQueryConfirmation struct {
+	Signature string   `json:"signature"`
+	Filepaths []string `json:"filepaths"`
+}
+
 type downloadTaskStatusResponse struct {
-	TaskID          string  `json:"task_id"`
-	URL             *string `json:"url"`
-	State           string  `json:"state"`
-	Message         string  `json:"message"`
-	Current         *int    `json:"current,omitempty"`
-	Total           *int    `json:"total,omitempty"`
-	DownloadedCount *int    `json:"downloaded_count,omitempty"`
-	SkippedCount    *int    `json:"skipped_count,omitempty"`
+	TaskID          string   `json:"task_id"`
+	URL             *string  `json:"url"`
+	Kind            string   `json:"kind"`
+	Username        *string  `json:"username,omitempty"`
+	State           string   `json:"state"`
+	Message         string   `json:"message"`
+	Current         *int     `json:"current,omitempty"`
+	Total           *int     `json:"total,omitempty"`
+	DownloadedCount *int     `json:"downloaded_count,omitempty"`
+	SkippedCount    *int     `json:"skipped_count,omitempty"`
+	EnqueuedCount   *int     `json:"enqueued_count,omitempty"`
+	Pages           *int     `json:"pages,omitempty"`
+	ParentTaskID    *string  `json:"parent_task_id,omitempty"`
+	ChildTaskIDs    []string `json:"child_task_ids,omitempty"`
+	RetryOf         *string  `json:"retry_of,omitempty"`
+	RetriedAs       *string  `json:"retried_as,omitempty"`
+	RetryCount      *int     `json:"retry_count,omitempty"`
+	MaxRetry        *int     `json:"max_retry,omitempty"`
+	// Report is set on user_timeline tasks once every download they queued has finished.
+	Report *backfillReport `json:"report,omitempty"`
 }
 
 type progressResult struct {
@@ -93,11 +305,37 @@ type progressResult struct {
 }
 
 type downloadResult struct {
-	URL             string `json:"url"`
-	Success         bool   `json:"success"`
-	Message         string `json:"message,omitempty"`
-	DownloadedCount int    `json:"downloaded_count"`
-	SkippedCount    int    `json:"skipped_count"`
+	URL             string                `json:"url"`
+	Success         bool                  `json:"success"`
+	Message         string                `json:"message,omitempty"`
+	DownloadedCount int                   `json:"downloaded_count"`
+	SkippedCount    int                   `json:"skipped_count"`
+	FailedCount     int                   `json:"failed_count"`
+	ChildTaskIDs    []string              `json:"child_task_ids,omitempty"`
+	Images          []downloadImageResult `json:"images,omitempty"`
+}
+
+// downloadImageResult is the outcome of one media item of a download task.
+type downloadImageResult struct {
+	Index       int    `json:"index"`
+	SourceURL   string `json:"source_url"`
+	MediaType   string `json:"media_type"`
+	Status      string `json:"status"`
+	Filepath    string `json:"filepath,omitempty"`
+	Hash        string `json:"hash,omitempty"`
+	PHash       string `json:"phash,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// taskResultRecord is the structured final result of a task kept for programmatic consumers.
+type taskResultRecord struct {
+	TaskID      string          `json:"task_id"`
+	TaskType    string          `json:"task_type"`
+	State       string          `json:"state"`
+	CompletedAt string          `json:"completed_at"`
+	Result      json.RawMessage `json:"result"`
 }
 
 type autotagResult struct {
@@ -106,7 +344,21 @@ type autotagResult struct {
 	Status  string `json:"status"`
 }
 
+type tweetMedia struct {
+	URL  string
+	Type string
+	// LocalPath is set when an external downloader already wrote the file; URL is then
+	// the post it came from.
+	LocalPath string
+}
+
+// tagSourceManual marks tags set through /api/images/tags. Re-tagging keeps them.
+const tagSourceManual = "manual"
+
 type imageTag struct {
 	Tag        string  `json:"tag"`
 	Confidence float64 `json:"confidence"`
+	// Source is tagSourceManual for tags set by hand, tagSourceHeuristic for guessed ones
+	// and empty for the autotagger's.
+	Source string `json:"source,omitempty"`
 }
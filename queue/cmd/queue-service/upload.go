@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	maxUploadRequestBytes = 1 << 30
+	maxUploadFiles        = 20
+	// uploadStagingDir holds uploaded files under the media root until the worker ingests
+	// them, so API and worker processes only need the media volume in common. The
+	// ".upload" suffix keeps media scans from picking them up.
+	uploadStagingDir = ".uploads"
+)
+
+// downloadUpload marks a download task whose media was uploaded by the user instead of
+// fetched, e.g. from a protected account. ID names the staging directory.
+type downloadUpload struct {
+	ID          string `json:"id"`
+	Text        string `json:"text,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+}
+
+func (st *appState) uploadStagingPath(id string) string {
+	return filepath.Join(st.cfg.mediaRoot, uploadStagingDir, id)
+}
+
+// handleUpload accepts media files together with the tweet they came from and queues them
+// as a download task, so they are named, hashed, deduplicated and tagged exactly like
+// fetched media. Form fields: url (required), files (one or more), and optionally text,
+// display_name and created_at for the tweet metadata. Archives among the files are
+// extracted through walkArchive and contribute their media.
+func (st *appState) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadRequestBytes)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		badRequest(w, "invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	tweetURL, ok := canonicalTweetURL(r.FormValue("url"))
+	if !ok {
+		badRequest(w, "url must be a tweet URL")
+		return
+	}
+	headers := r.MultipartForm.File["files"]
+	if len(headers) == 0 {
+		badRequest(w, "files are required")
+		return
+	}
+	if len(headers) > maxUploadFiles {
+		badRequest(w, fmt.Sprintf("too many files (max %d)", maxUploadFiles))
+		return
+	}
+
+	taskID := uuid.NewString()
+	dir := st.uploadStagingPath(taskID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		logger.Error("failed to create upload staging directory", "path", dir, "error", err)
+		internalServerError(w)
+		return
+	}
+	files := 0
+	for _, h := range headers {
+		staged := filepath.Join(dir, fmt.Sprintf("%02d.upload", files+1))
+		if err := stageUploadedFile(h, staged); err != nil {
+			_ = os.RemoveAll(dir)
+			logger.Error("failed to stage uploaded file", "filename", h.Filename, "error", err)
+			internalServerError(w)
+			return
+		}
+		_, err := sniffMediaExt(staged)
+		if err == nil {
+			files++
+			continue
+		}
+		if !isArchiveFile(staged) {
+			_ = os.RemoveAll(dir)
+			badRequest(w, fmt.Sprintf("%s: %v", h.Filename, err))
+			return
+		}
+		archive := strings.TrimSuffix(staged, ".upload") + ".archive"
+		n, err := st.stageUploadArchive(staged, archive, dir, files)
+		_ = os.Remove(archive)
+		if err != nil {
+			_ = os.RemoveAll(dir)
+			if errors.Is(err, errArchiveRejected) {
+				badRequest(w, fmt.Sprintf("%s: %v", h.Filename, err))
+				return
+			}
+			logger.Error("failed to extract uploaded archive", "filename", h.Filename, "error", err)
+			internalServerError(w)
+			return
+		}
+		files += n
+	}
+	if files == 0 {
+		_ = os.RemoveAll(dir)
+		badRequest(w, "no media found in files")
+		return
+	}
+
+	payload := downloadTaskPayload{
+		TaskID: taskID,
+		URL:    tweetURL,
+		Upload: &downloadUpload{
+			ID:          taskID,
+			Text:        strings.TrimSpace(r.FormValue("text")),
+			DisplayName: strings.TrimSpace(r.FormValue("display_name")),
+			CreatedAt:   strings.TrimSpace(r.FormValue("created_at")),
+		},
+	}
+	// The staged files are removed after the first attempt, so there is nothing to retry.
+	if err := st.enqueueTask(taskTypeDownload, st.cfg.interactiveQueue, taskID, payload, 30*time.Minute); err != nil {
+		_ = os.RemoveAll(dir)
+		logger.Error("failed to enqueue upload task",
+			"task_type", taskTypeDownload,
+			"task_id", taskID,
+			"url", tweetURL,
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	st.trackTasks(r.Context(), []trackedTask{{TaskID: taskID, URL: tweetURL, Upload: true}})
+	st.redis.LTrim(r.Context(), taskListKey, -maxTrackedTasks, -1)
+	logger.Info("upload task queued", "task_id", taskID, "url", tweetURL, "files", files)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success": true,
+		"queued":  true,
+		"task_id": taskID,
+		"files":   files,
+		"message": localize(r.Context(), msgUploadQueued),
+	})
+}
+
+func stageUploadedFile(h *multipart.FileHeader, dst string) error {
+	in, err := h.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeStagedFile(dst, in)
+}
+
+// stageUploadArchive moves the uploaded archive at staged to archive and stages its media
+// files after the staged ones, in archive order. Entries that are not media, like a readme
+// or macOS metadata, are skipped; the media still count against maxUploadFiles.
+func (st *appState) stageUploadArchive(staged, archive, dir string, count int) (int, error) {
+	if err := os.Rename(staged, archive); err != nil {
+		return 0, err
+	}
+	n := 0
+	err := walkArchive(archive, st.archiveLimits(), func(name string, r io.Reader) error {
+		if strings.HasPrefix(path.Base(name), ".") || strings.HasPrefix(name, "__MACOSX/") {
+			return nil
+		}
+		dst := filepath.Join(dir, fmt.Sprintf("%02d.upload", count+n+1))
+		if err := writeStagedFile(dst, r); err != nil {
+			_ = os.Remove(dst)
+			return err
+		}
+		if _, err := sniffMediaExt(dst); err != nil {
+			return os.Remove(dst)
+		}
+		if n++; count+n > maxUploadFiles {
+			return rejectArchive("too many files (max %d)", maxUploadFiles)
+		}
+		return nil
+	})
+	return n, err
+}
+
+func writeStagedFile(dst string, in io.Reader) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// uploadExtractor presents staged uploads as the media of their tweet.
+type uploadExtractor struct {
+	st     *appState
+	upload downloadUpload
+}
+
+func (uploadExtractor) Name() string { return "upload" }
+
+func (uploadExtractor) Match(rawURL string) bool { return isTweetURL(rawURL) }
+
+func (e uploadExtractor) Extract(_ context.Context, rawURL string) (extractedPost, error) {
+	if _, err := uuid.Parse(e.upload.ID); err != nil {
+		return extractedPost{}, fmt.Errorf("invalid upload id: %w", asynq.SkipRetry)
+	}
+	dir := e.st.uploadStagingPath(e.upload.ID)
+	cleanup := func() { _ = os.RemoveAll(dir) }
+	files, err := filepath.Glob(filepath.Join(dir, "*.upload"))
+	if err != nil || len(files) == 0 {
+		cleanup()
+		return extractedPost{}, fmt.Errorf("uploaded files are missing: %w", asynq.SkipRetry)
+	}
+	sort.Strings(files)
+
+	tweetID := tweetIDFromURL(rawURL)
+	post := extractedPost{
+		ID:       tweetID,
+		Username: extractUsername(rawURL),
+		Cleanup:  cleanup,
+	}
+	for _, f := range files {
+		typ := mediaTypeImage
+		if ext, err := sniffMediaExt(f); err == nil {
+			typ = mediaTypeFromPath("upload" + ext)
+		}
+		post.Media = append(post.Media, tweetMedia{URL: rawURL, Type: typ, LocalPath: f})
+	}
+	if e.upload.Text != "" || e.upload.DisplayName != "" || e.upload.CreatedAt != "" {
+		post.Meta = &tweetMeta{
+			TweetID:     tweetID,
+			DisplayName: e.upload.DisplayName,
+			Text:        e.upload.Text,
+			CreatedAt:   e.upload.CreatedAt,
+		}
+	}
+	return post, nil
+}
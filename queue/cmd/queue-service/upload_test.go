@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testJPEG = "\xff\xd8\xff\xe0 jpeg"
+	testPNG  = "\x89PNG\r\n\x1a\n png"
+)
+
+func TestStageUploadArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		count   int
+		cfg     config
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "media after the staged files, others skipped",
+			entries: []archiveEntry{
+				{name: "a.jpg", body: testJPEG},
+				{name: "readme.txt", body: "hello"},
+				{name: "__MACOSX/._a.jpg", body: testJPEG},
+				{name: "sub/.hidden.png", body: testPNG},
+				{name: "sub/b.png", body: testPNG},
+			},
+			count: 2,
+			want:  []string{"03.upload=" + testJPEG, "04.upload=" + testPNG},
+		},
+		{
+			name:    "too many files",
+			entries: []archiveEntry{{name: "a.jpg", body: testJPEG}, {name: "b.jpg", body: testJPEG}},
+			count:   maxUploadFiles - 1,
+			wantErr: "too many files",
+		},
+		{
+			name:    "entry over the size limit",
+			entries: []archiveEntry{{name: "a.jpg", body: testJPEG}},
+			cfg:     config{mediaMaxFileSize: 4},
+			wantErr: "larger than 4 bytes",
+		},
+		{
+			name:    "unsafe entry",
+			entries: []archiveEntry{{name: "../a.jpg", body: testJPEG}},
+			wantErr: "archive rejected",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := t.TempDir()
+			dir := filepath.Join(base, "staging")
+			if err := os.Mkdir(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			staged := filepath.Join(dir, "upload.part")
+			writeTestZip(t, staged, tt.entries)
+			archive := filepath.Join(base, "upload.archive")
+			st := &appState{cfg: tt.cfg}
+
+			n, err := st.stageUploadArchive(staged, archive, dir, tt.count)
+			if tt.wantErr != "" {
+				if !errors.Is(err, errArchiveRejected) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("stageUploadArchive error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stageUploadArchive: %v", err)
+			}
+			if n != len(tt.want) {
+				t.Fatalf("staged %d files, want %d", n, len(tt.want))
+			}
+			files, err := filepath.Glob(filepath.Join(dir, "*.upload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(files))
+			for _, f := range files {
+				b, err := os.ReadFile(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.Base(f)+"="+string(b))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("staged = %q, want %q", got, tt.want)
+			}
+			if _, err := os.Stat(staged); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("staged archive was not moved: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const derivativeKindUpscale = "upscale"
+
+type upscaleRequest struct {
+	Filepaths []string `json:"filepaths"`
+	imageFilterRequest
+}
+
+// handleImagesUpscale queues selected images for the external upscaler. Images are chosen
+// by explicit filepaths or by an /api/images style query.
+func (st *appState) handleImagesUpscale(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if st.cfg.upscalerURL == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "message": localize(r.Context(), msgUpscaleNotConfigured)})
+		return
+	}
+	var body upscaleRequest
+	if !decodeJSONOrBadRequest(w, r, &body, "filepaths or query is required") {
+		return
+	}
+
+	ctx := r.Context()
+	var filepaths []string
+	if len(body.Filepaths) > 0 {
+		filepaths = normalizeUniqueFilepaths(body.Filepaths)
+	} else {
+		filter, err := body.imageFilterRequest.toFilter()
+		if err != nil {
+			badRequest(w, err.Error())
+			return
+		}
+		if filter.isEmpty() {
+			badRequest(w, "filepaths or query is required")
+			return
+		}
+		filepaths, err = st.selectImagePaths(ctx, filter)
+		if err != nil {
+			writeScanError(w, err)
+			return
+		}
+	}
+	// Videos cannot be upscaled by an image model.
+	images := make([]string, 0, len(filepaths))
+	for _, rel := range filepaths {
+		if !isVideoFile(rel) {
+			images = append(images, rel)
+		}
+	}
+	if len(images) == 0 {
+		badRequest(w, "no images matched")
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := upscaleImagesTaskPayload{TaskID: taskID, Filepaths: images}
+	err := st.enqueueTask(taskTypeUpscaleImages, st.cfg.queueName, taskID, payload, 6*time.Hour)
+	if err != nil {
+		logger.Error("failed to enqueue upscale task",
+			"task_type", taskTypeUpscaleImages,
+			"task_id", taskID,
+			"count", len(images),
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(ctx, st.redis, taskID, "PENDING", withMessage(map[string]any{
+		"total": len(images),
+	}, "message", msgUpscaleQueued))
+	logger.Info("upscale task queued", "task_id", taskID, "count", len(images))
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success":      true,
+		"queued":       true,
+		"task_id":      taskID,
+		"queued_count": len(images),
+		"message":      localize(ctx, msgUpscaleQueued),
+	})
+}
+
+func (st *appState) processUpscaleImagesTask(ctx context.Context, t *asynq.Task) error {
+	var payload upscaleImagesTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+
+	filepaths := normalizeUniqueFilepaths(payload.Filepaths)
+	total := len(filepaths)
+	upscaled := 0
+	skipped := 0
+	failed := 0
+	variants := make([]imageDerivative, 0)
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{
+		"current": 0,
+		"total":   total,
+	}, "status", msgUpscaleProgress))
+
+	for i, rel := range filepaths {
+		d, err := st.upscaleFile(ctx, rel)
+		switch {
+		case errors.Is(err, errUpscaleSkipped):
+			skipped++
+		case err != nil:
+			failed++
+			logger.Warn("upscale failed", "filepath", rel, "error", err)
+		default:
+			upscaled++
+			variants = append(variants, d)
+		}
+		setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+			"current": i + 1,
+			"total":   total,
+			"status":  fmt.Sprintf("upscaled:%d skipped:%d failed:%d", upscaled, skipped, failed),
+		})
+	}
+
+	result := map[string]any{
+		"success":        failed == 0 || upscaled > 0,
+		"upscaled_count": upscaled,
+		"skipped_count":  skipped,
+		"failed_count":   failed,
+		"total":          total,
+		"current":        total,
+		"variants":       variants,
+	}
+	withMessage(result, "message", msgUpscaleCompleted, upscaled, skipped, failed)
+	if upscaled == 0 && failed > 0 {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", result)
+		return errors.New("upscale failed")
+	}
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", result)
+	return nil
+}
+
+var errUpscaleSkipped = errors.New("upscale skipped")
+
+// upscaleFile sends rel to the upscaler and stores the output next to it as
+// "<name>_upscaled<ext>", indexed, tagged like the source and linked by provenance.
+// Files that are upscaled outputs themselves, or already have one, are skipped.
+func (st *appState) upscaleFile(ctx context.Context, rel string) (imageDerivative, error) {
+	if _, isDerivative, err := st.store.GetDerivative(rel); err != nil {
+		return imageDerivative{}, err
+	} else if isDerivative {
+		return imageDerivative{}, errUpscaleSkipped
+	}
+	existing, err := st.store.FindDerivatives(rel, derivativeKindUpscale)
+	if err != nil {
+		return imageDerivative{}, err
+	}
+	for _, d := range existing {
+		if _, err := os.Stat(filepath.Join(st.cfg.mediaRoot, filepath.FromSlash(d.Filepath))); err == nil {
+			return imageDerivative{}, errUpscaleSkipped
+		}
+	}
+
+	fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
+	if err != nil {
+		return imageDerivative{}, err
+	}
+	base := strings.TrimSuffix(fullPath, filepath.Ext(fullPath))
+	partPath := base + "_upscaled.part"
+	if err := st.requestUpscale(ctx, fullPath, partPath); err != nil {
+		_ = os.Remove(partPath)
+		return imageDerivative{}, err
+	}
+	ext, err := sniffMediaExt(partPath)
+	if err != nil || isVideoFile(ext) {
+		_ = os.Remove(partPath)
+		return imageDerivative{}, fmt.Errorf("upscaler returned invalid image: %v", err)
+	}
+	outPath := base + "_upscaled" + ext
+	if err := os.Rename(partPath, outPath); err != nil {
+		_ = os.Remove(partPath)
+		return imageDerivative{}, err
+	}
+
+	outRel := normalizeRelPath(st.cfg.mediaRoot, outPath)
+	hash, err := fileMD5(outPath)
+	if err != nil {
+		return imageDerivative{}, err
+	}
+	info, err := os.Stat(outPath)
+	if err != nil {
+		return imageDerivative{}, err
+	}
+	if err := st.store.MarkImageProcessed(hash); err != nil {
+		return imageDerivative{}, err
+	}
+	if err := st.store.RecordImage(newImageRecord(outRel, hash, info.Size(), info.ModTime().UnixMilli())); err != nil {
+		logger.Warn("failed to index upscaled image", "filepath", outRel, "error", err)
+	}
+	if _, err := st.store.CopyTags(rel, []string{outRel}, true); err != nil {
+		logger.Warn("failed to copy tags to upscaled image", "filepath", outRel, "error", err)
+	}
+	d := imageDerivative{
+		Filepath:       outRel,
+		SourceFilepath: rel,
+		Kind:           derivativeKindUpscale,
+		Tool:           st.cfg.upscalerURL,
+		CreatedAt:      time.Now().UnixMilli(),
+	}
+	if err := st.store.RecordDerivative(d); err != nil {
+		return imageDerivative{}, err
+	}
+	variants := []imageVariant{{Filepath: rel}, {Filepath: outRel, Role: variantRoleUpscaled}}
+	if _, err := st.store.LinkVariants(variants, ""); err != nil {
+		logger.Warn("failed to link upscaled variant", "filepath", outRel, "error", err)
+	}
+	return d, nil
+}
+
+// requestUpscale posts the image as multipart "file" (with "scale") and writes the
+// returned image body to dst.
+func (st *appState) requestUpscale(ctx context.Context, src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filepath.Base(src))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	if err := writer.WriteField("scale", strconv.Itoa(st.cfg.upscalerScale)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, st.cfg.upscalerURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := st.upscaleHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("upscaler response status=%d", resp.StatusCode)
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// selectImagePaths resolves an image query to sorted relative paths.
+func (st *appState) selectImagePaths(ctx context.Context, filter imageFilter) ([]string, error) {
+	images, _, err := st.findImages(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(images))
+	for _, img := range images {
+		paths = append(paths, img.Path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
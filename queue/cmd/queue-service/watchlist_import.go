@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxWatchlistImportBytes   = 5 << 20
+	maxWatchlistImportHandles = 5000
+)
+
+// Per-handle outcomes of POST /api/watchlist/import.
+const (
+	watchImportAdded      = "added"
+	watchImportExists     = "exists"
+	watchImportInvalid    = "invalid"
+	watchImportUnresolved = "unresolved"
+	watchImportFailed     = "failed"
+)
+
+// followEntry is one account found in an uploaded follow list. Username is empty when the
+// list only names the account by ID, as X's own archive does.
+type followEntry struct {
+	Input     string
+	Username  string
+	AccountID string
+}
+
+type watchImportResult struct {
+	Input    string `json:"input"`
+	Username string `json:"username,omitempty"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+	// TaskID is the initial timeline download queued with backfill=true.
+	TaskID string `json:"task_id,omitempty"`
+}
+
+// parseFollowList reads the accounts of an uploaded follow list: following.js from an X
+// data archive, a CSV with a username, screen_name or handle column (else the first
+// column), or plain text with one handle or profile URL per line.
+func parseFollowList(data []byte) ([]followEntry, error) {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if bytes.HasPrefix(trimmed, []byte("window.YTD.")) || bytes.HasPrefix(trimmed, []byte("[")) {
+		return parseFollowingJS(trimmed)
+	}
+	return parseFollowCSV(trimmed)
+}
+
+// parseFollowingJS reads `window.YTD.following.part0 = [{"following": {...}}]`. The
+// archive links accounts as intent/user?user_id=..., which names no handle; links of the
+// form x.com/name are resolved.
+func parseFollowingJS(data []byte) ([]followEntry, error) {
+	if i := bytes.IndexByte(data, '['); i >= 0 {
+		data = data[i:]
+	}
+	var items []map[string]struct {
+		AccountID string `json:"accountId"`
+		UserLink  string `json:"userLink"`
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("invalid following.js: %w", err)
+	}
+	entries := make([]followEntry, 0, len(items))
+	for _, item := range items {
+		for _, acc := range item {
+			e := followEntry{Input: acc.UserLink, AccountID: acc.AccountID}
+			if e.Input == "" {
+				e.Input = acc.AccountID
+			}
+			if u, err := url.Parse(acc.UserLink); err == nil && !strings.HasPrefix(u.Path, "/intent/") {
+				e.Username, _ = normalizeUsername(acc.UserLink)
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func parseFollowCSV(data []byte) ([]followEntry, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	column := -1
+	entries := make([]followEntry, 0)
+	for line := 0; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 0 {
+			for i, name := range record {
+				switch strings.ToLower(strings.TrimSpace(name)) {
+				case "username", "screen_name", "screenname", "handle", "user":
+					column = i
+				}
+			}
+			if column >= 0 {
+				continue
+			}
+			column = 0
+		}
+		if column >= len(record) {
+			continue
+		}
+		raw := strings.TrimSpace(record[column])
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			continue
+		}
+		username, _ := normalizeUsername(raw)
+		entries = append(entries, followEntry{Input: raw, Username: username})
+	}
+	return entries, nil
+}
+
+// handleWatchlistImport adds every account of an uploaded follow list to the watchlist and
+// reports the outcome per handle. Accounts already watched keep their settings. Form
+// fields: interval_minutes and enabled apply to the new entries, and backfill=true also
+// queues a timeline download for each of them.
+func (st *appState) handleWatchlistImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxWatchlistImportBytes)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		badRequest(w, "file is required")
+		return
+	}
+	defer file.Close()
+	switch strings.ToLower(filepath.Ext(header.Filename)) {
+	case ".js", ".json", ".csv", ".txt":
+	default:
+		badRequest(w, "file must be following.js, .json, .csv or .txt")
+		return
+	}
+	interval := 0
+	if raw := strings.TrimSpace(r.FormValue("interval_minutes")); raw != "" {
+		if interval, err = strconv.Atoi(raw); err != nil || interval < 0 {
+			badRequest(w, "interval_minutes must be non-negative")
+			return
+		}
+	}
+	enabled := r.FormValue("enabled") == "" || parseBoolParam(r.FormValue("enabled"))
+	backfill := parseBoolParam(r.FormValue("backfill"))
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		badRequest(w, "failed to read file")
+		return
+	}
+	entries, err := parseFollowList(data)
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	if len(entries) == 0 {
+		badRequest(w, "no accounts found")
+		return
+	}
+	if len(entries) > maxWatchlistImportHandles {
+		badRequest(w, fmt.Sprintf("too many accounts (max %d)", maxWatchlistImportHandles))
+		return
+	}
+
+	period := time.Duration(interval) * time.Minute
+	if interval <= 0 {
+		period = time.Duration(st.cfg.watchlistIntervalMinutes) * time.Minute
+	}
+	ctx := r.Context()
+	now := time.Now()
+	results := make([]watchImportResult, 0, len(entries))
+	counts := make(map[string]int)
+	seen := make(map[string]struct{}, len(entries))
+	tracked := make([]trackedTask, 0)
+	for _, e := range entries {
+		res := watchImportResult{Input: e.Input, Username: e.Username}
+		switch {
+		case e.Username == "" && e.AccountID != "":
+			res.Status, res.Reason = watchImportUnresolved, "the list names account "+e.AccountID+" by ID only"
+		case e.Username == "":
+			res.Status, res.Reason = watchImportInvalid, "not a username or profile URL"
+		default:
+			key := strings.ToLower(e.Username)
+			if _, dup := seen[key]; dup {
+				res.Status, res.Reason = watchImportExists, "listed twice"
+				break
+			}
+			seen[key] = struct{}{}
+			// First scans are spread over one interval so an import doesn't poll every
+			// account on the next tick.
+			offset := time.Duration(float64(period) * watchPhase(e.Username, now.UnixMilli()))
+			added, err := st.store.AddWatchIfMissing(watchEntry{
+				Username:        e.Username,
+				Enabled:         enabled,
+				IntervalMinutes: interval,
+				LastCheckedAt:   now.Add(offset - period).UnixMilli(),
+			})
+			switch {
+			case err != nil:
+				logger.Warn("failed to import watchlist entry", "username", e.Username, "error", err)
+				res.Status, res.Reason = watchImportFailed, err.Error()
+			case !added:
+				res.Status = watchImportExists
+			default:
+				res.Status = watchImportAdded
+			}
+			if res.Status != watchImportAdded || !backfill {
+				break
+			}
+			taskID := uuid.NewString()
+			payload := timelineTaskPayload{TaskID: taskID, Username: e.Username}
+			if err := st.enqueueTask(taskTypeDownloadTimeline, st.cfg.queueName, taskID, payload, 2*time.Hour); err != nil {
+				logger.Warn("failed to enqueue timeline task",
+					"task_type", taskTypeDownloadTimeline,
+					"task_id", taskID,
+					"username", e.Username,
+					"error", err,
+				)
+				res.Reason = "backfill could not be queued"
+				break
+			}
+			res.TaskID = taskID
+			tracked = append(tracked, trackedTask{TaskID: taskID, Username: e.Username})
+		}
+		counts[res.Status]++
+		results = append(results, res)
+	}
+	st.trackTasks(ctx, tracked)
+	st.redis.LTrim(ctx, taskListKey, -maxTrackedTasks, -1)
+
+	logger.Info("watchlist import processed",
+		"filename", header.Filename,
+		"found", len(entries),
+		"added", counts[watchImportAdded],
+		"existing", counts[watchImportExists],
+		"unresolved", counts[watchImportUnresolved],
+		"invalid", counts[watchImportInvalid],
+		"failed", counts[watchImportFailed],
+		"backfill", len(tracked),
+	)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":          counts[watchImportFailed] == 0,
+		"found_count":      len(entries),
+		"added_count":      counts[watchImportAdded],
+		"existing_count":   counts[watchImportExists],
+		"unresolved_count": counts[watchImportUnresolved],
+		"invalid_count":    counts[watchImportInvalid],
+		"failed_count":     counts[watchImportFailed],
+		"backfill_count":   len(tracked),
+		"results":          results,
+	})
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal RFC 6455 server side: enough for JSON text messages from a browser, without
+// extensions or subprotocols.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+const (
+	wsMaxMessageSize = 64 << 10
+	wsWriteTimeout   = 10 * time.Second
+)
+
+var errWebSocketClosed = errors.New("websocket closed")
+
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	// wmu serializes frames; pongs are written from the read loop.
+	wmu sync.Mutex
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// webSocketOriginAllowed reports whether the page that opened the socket may read it.
+// Browsers don't apply the same-origin policy to WebSockets, so without this any site the
+// operator visits could subscribe to the dashboard. A missing Origin means a non-browser
+// client such as the frontend relay. Otherwise the origin's host must be the requested
+// host (or the proxy's X-Forwarded-Host), or the origin must be listed in allowed.
+func webSocketOriginAllowed(r *http.Request, allowed []string) bool {
+	origin := strings.TrimSpace(r.Header.Get("Origin"))
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(strings.TrimRight(a, "/"), u.Scheme+"://"+u.Host) {
+			return true
+		}
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	forwarded := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0])
+	return forwarded != "" && strings.EqualFold(u.Host, forwarded)
+}
+
+// upgradeWebSocket completes the opening handshake and takes over the connection. Cross-site
+// pages outside allowedOrigins are refused. On failure it has already written the HTTP error
+// response.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, allowedOrigins []string) (*wsConn, error) {
+	key := strings.TrimSpace(r.Header.Get("Sec-WebSocket-Key"))
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeJSON(w, http.StatusUpgradeRequired, map[string]any{"error": "websocket upgrade required"})
+		return nil, errors.New("not a websocket handshake")
+	}
+	if !webSocketOriginAllowed(r, allowedOrigins) {
+		writeJSON(w, http.StatusForbidden, map[string]any{"error": "websocket origin not allowed"})
+		return nil, errors.New("websocket origin not allowed")
+	}
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		internalServerError(w)
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	_ = conn.SetDeadline(time.Time{})
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, br: brw.Reader}, nil
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | op
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *wsConn) writeJSON(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(wsOpText, b)
+}
+
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.br, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	op = head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		// Client frames must be masked.
+		return false, 0, nil, errors.New("unmasked client frame")
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessageSize {
+		return false, 0, nil, errors.New("websocket frame too large")
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// readMessage returns the next text or binary message, answering pings and reassembling
+// fragments on the way. A close frame is echoed and reported as errWebSocketClosed.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			_ = c.writeFrame(wsOpClose, payload)
+			return nil, errWebSocketClosed
+		case wsOpText, wsOpBinary, wsOpContinuation:
+		default:
+			return nil, errors.New("unknown websocket opcode")
+		}
+		msg = append(msg, payload...)
+		if len(msg) > wsMaxMessageSize {
+			return nil, errors.New("websocket message too large")
+		}
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+func (c *wsConn) close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clientFrame builds a masked client-to-server frame.
+func clientFrame(fin bool, op byte, payload []byte) []byte {
+	b := []byte{op, 0x80}
+	if fin {
+		b[0] |= 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b[1] |= byte(n)
+	case n <= 0xFFFF:
+		b[1] |= 126
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b[1] |= 127
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	b = append(b, mask[:]...)
+	for i, c := range payload {
+		b = append(b, c^mask[i%4])
+	}
+	return b
+}
+
+// readServerFrame parses one unmasked server-to-client frame.
+func readServerFrame(t *testing.T, r io.Reader) (op byte, payload []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatalf("read frame header: %v", err)
+	}
+	if head[0]&0x80 == 0 {
+		t.Fatalf("server frame without FIN")
+	}
+	if head[1]&0x80 != 0 {
+		t.Fatalf("server frame is masked")
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			t.Fatal(err)
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			t.Fatal(err)
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("read frame payload: %v", err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+// wsPair connects a server-side wsConn to a raw client over loopback TCP, so writes on
+// one side don't block on reads of the other the way net.Pipe does.
+func wsPair(t *testing.T) (*wsConn, net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := ln.Accept()
+		accepted <- c
+	}()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := <-accepted
+	if server == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+	_ = server.SetDeadline(time.Now().Add(5 * time.Second))
+	return &wsConn{conn: server, br: bufio.NewReader(server)}, client
+}
+
+func TestUpgradeWebSocketHandshake(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeWebSocket(w, r, []string{"https://allowed.example"})
+		if err != nil {
+			return
+		}
+		_ = conn.writeFrame(wsOpText, []byte("hi"))
+		conn.close()
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	tests := []struct {
+		name       string
+		header     map[string]string
+		wantStatus int
+	}{
+		{"no origin", nil, http.StatusSwitchingProtocols},
+		{"same origin", map[string]string{"Origin": "http://" + host}, http.StatusSwitchingProtocols},
+		{"same origin other case", map[string]string{"Origin": "http://" + strings.ToUpper(host)}, http.StatusSwitchingProtocols},
+		{"forwarded host", map[string]string{"Origin": "https://media.example", "X-Forwarded-Host": "media.example"}, http.StatusSwitchingProtocols},
+		{"allow-listed origin", map[string]string{"Origin": "https://allowed.example"}, http.StatusSwitchingProtocols},
+		{"cross origin", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"allow-list needs the scheme", map[string]string{"Origin": "http://allowed.example"}, http.StatusForbidden},
+		{"null origin", map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"missing upgrade", map[string]string{"Upgrade": ""}, http.StatusUpgradeRequired},
+		{"wrong version", map[string]string{"Sec-WebSocket-Version": "8"}, http.StatusUpgradeRequired},
+		{"missing key", map[string]string{"Sec-WebSocket-Key": ""}, http.StatusUpgradeRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/ws", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Connection", "keep-alive, Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			req.Header.Set("Sec-WebSocket-Version", "13")
+			// The sample nonce from RFC 6455 section 1.3.
+			req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			for k, v := range tt.header {
+				if v == "" {
+					req.Header.Del(k)
+				} else {
+					req.Header.Set(k, v)
+				}
+			}
+
+			conn, err := net.Dial("tcp", host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+			if err := req.Write(conn); err != nil {
+				t.Fatal(err)
+			}
+			br := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(br, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				return
+			}
+			if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+				t.Fatalf("Sec-WebSocket-Accept = %q", got)
+			}
+			op, payload := readServerFrame(t, br)
+			if op != wsOpText || string(payload) != "hi" {
+				t.Fatalf("first frame = %x %q, want text \"hi\"", op, payload)
+			}
+		})
+	}
+}
+
+func TestWebSocketReadMessage(t *testing.T) {
+	big := bytes.Repeat([]byte("x"), 300)
+	tests := []struct {
+		name     string
+		frames   [][]byte
+		want     string
+		wantErr  string
+		wantPong string
+	}{
+		{
+			name:   "masked text",
+			frames: [][]byte{clientFrame(true, wsOpText, []byte(`{"type":"subscribe"}`))},
+			want:   `{"type":"subscribe"}`,
+		},
+		{
+			name:   "16-bit length",
+			frames: [][]byte{clientFrame(true, wsOpText, big)},
+			want:   string(big),
+		},
+		{
+			name: "fragments are reassembled",
+			frames: [][]byte{
+				clientFrame(false, wsOpText, []byte("hel")),
+				clientFrame(false, wsOpContinuation, []byte("lo ")),
+				clientFrame(true, wsOpContinuation, []byte("world")),
+			},
+			want: "hello world",
+		},
+		{
+			name: "ping between fragments is answered",
+			frames: [][]byte{
+				clientFrame(false, wsOpText, []byte("a")),
+				clientFrame(true, wsOpPing, []byte("p")),
+				clientFrame(true, wsOpContinuation, []byte("b")),
+			},
+			want:     "ab",
+			wantPong: "p",
+		},
+		{
+			name:    "unmasked frame",
+			frames:  [][]byte{{0x81, 0x02, 'h', 'i'}},
+			wantErr: "unmasked client frame",
+		},
+		{
+			name:    "frame over the size limit",
+			frames:  [][]byte{{0x81, 0x80 | 127, 0, 0, 0, 0, 0, 0x10, 0, 1}},
+			wantErr: "websocket frame too large",
+		},
+		{
+			name: "fragments over the size limit",
+			frames: [][]byte{
+				clientFrame(false, wsOpText, make([]byte, wsMaxMessageSize)),
+				clientFrame(true, wsOpContinuation, []byte("x")),
+			},
+			wantErr: "websocket message too large",
+		},
+		{
+			name:    "unknown opcode",
+			frames:  [][]byte{clientFrame(true, 0x3, nil)},
+			wantErr: "unknown websocket opcode",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := wsPair(t)
+			go func() {
+				for _, f := range tt.frames {
+					if _, err := client.Write(f); err != nil {
+						return
+					}
+				}
+			}()
+			msg, err := server.readMessage()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("readMessage error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readMessage: %v", err)
+			}
+			if string(msg) != tt.want {
+				t.Fatalf("readMessage = %q, want %q", msg, tt.want)
+			}
+			if tt.wantPong != "" {
+				op, payload := readServerFrame(t, client)
+				if op != wsOpPong || string(payload) != tt.wantPong {
+					t.Fatalf("reply = %x %q, want pong %q", op, payload, tt.wantPong)
+				}
+			}
+		})
+	}
+}
+
+func TestWebSocketCloseIsEchoed(t *testing.T) {
+	server, client := wsPair(t)
+	if _, err := client.Write(clientFrame(true, wsOpClose, []byte{0x03, 0xE8})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.readMessage(); !errors.Is(err, errWebSocketClosed) {
+		t.Fatalf("readMessage error = %v, want errWebSocketClosed", err)
+	}
+	op, payload := readServerFrame(t, client)
+	if op != wsOpClose || !bytes.Equal(payload, []byte{0x03, 0xE8}) {
+		t.Fatalf("reply = %x %x, want the close frame echoed", op, payload)
+	}
+}
+
+func TestWebSocketWriteFrameLengths(t *testing.T) {
+	tests := []struct {
+		size     int
+		wantLen7 byte
+	}{
+		{0, 0},
+		{125, 125},
+		{126, 126},
+		{0xFFFF, 126},
+		{0x10000, 127},
+	}
+	for _, tt := range tests {
+		server, client := wsPair(t)
+		payload := bytes.Repeat([]byte("y"), tt.size)
+		errc := make(chan error, 1)
+		go func() { errc <- server.writeFrame(wsOpText, payload) }()
+
+		br := bufio.NewReader(client)
+		head, err := br.Peek(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := head[1] & 0x7F; got != tt.wantLen7 {
+			t.Fatalf("size %d: 7-bit length = %d, want %d", tt.size, got, tt.wantLen7)
+		}
+		op, got := readServerFrame(t, br)
+		if op != wsOpText || !bytes.Equal(got, payload) {
+			t.Fatalf("size %d: read %x with %d bytes", tt.size, op, len(got))
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("size %d: writeFrame: %v", tt.size, err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	expandThread = "thread"
+	expandQuote  = "quote"
+
+	// maxThreadDepth bounds how far up a self-thread the worker walks.
+	maxThreadDepth = 25
+)
+
+// parseExpandOption validates the expand option of POST /api/download.
+// Values may be separated by "," or "|".
+func parseExpandOption(raw string) ([]string, error) {
+	fields := strings.FieldsFunc(strings.ToLower(raw), func(r rune) bool { return r == ',' || r == '|' })
+	seen := make(map[string]struct{}, len(fields))
+	expand := make([]string, 0, len(fields))
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if f != expandThread && f != expandQuote {
+			return nil, fmt.Errorf("invalid expand value: %s", f)
+		}
+		if _, ok := seen[f]; ok {
+			continue
+		}
+		seen[f] = struct{}{}
+		expand = append(expand, f)
+	}
+	return expand, nil
+}
+
+// tweetRelations is the subset of syndication tweet data needed for expansion.
+type tweetRelations struct {
+	Author         string
+	ReplyToID      string
+	ReplyToAuthor  string
+	QuotedID       string
+	QuotedAuthor   string
+	QuotedHasMedia bool
+}
+
+func fetchSyndicationTweetRelations(ctx context.Context, client httpDoer, tweetID string) (tweetRelations, error) {
+	apiURL := fmt.Sprintf("https://cdn.syndication.twimg.com/tweet-result?id=%s&token=4", tweetID)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return tweetRelations{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return tweetRelations{}, fmt.Errorf("tweet api status=%d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return tweetRelations{}, err
+	}
+
+	var parsed struct {
+		User struct {
+			ScreenName string `json:"screen_name"`
+		} `json:"user"`
+		InReplyToStatusIDStr string `json:"in_reply_to_status_id_str"`
+		InReplyToScreenName  string `json:"in_reply_to_screen_name"`
+		QuotedTweet          *struct {
+			IDStr string `json:"id_str"`
+			User  struct {
+				ScreenName string `json:"screen_name"`
+			} `json:"user"`
+			Photos       []json.RawMessage `json:"photos"`
+			MediaDetails []json.RawMessage `json:"mediaDetails"`
+		} `json:"quoted_tweet"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return tweetRelations{}, err
+	}
+	rel := tweetRelations{
+		Author:        parsed.User.ScreenName,
+		ReplyToID:     parsed.InReplyToStatusIDStr,
+		ReplyToAuthor: parsed.InReplyToScreenName,
+	}
+	if q := parsed.QuotedTweet; q != nil {
+		rel.QuotedID = q.IDStr
+		rel.QuotedAuthor = q.User.ScreenName
+		rel.QuotedHasMedia = len(q.Photos) > 0 || len(q.MediaDetails) > 0
+	}
+	return rel, nil
+}
+
+// relatedTweetURLs discovers tweets related to tweetID according to expand. Threads are
+// followed upwards through replies by the same author; quotes are only followed when the
+// quoted tweet carries media.
+func (st *appState) relatedTweetURLs(ctx context.Context, tweetID string, expand []string) ([]string, error) {
+	wantThread, wantQuote := false, false
+	for _, e := range expand {
+		wantThread = wantThread || e == expandThread
+		wantQuote = wantQuote || e == expandQuote
+	}
+
+	urls := make([]string, 0)
+	seen := map[string]struct{}{tweetID: {}}
+	add := func(author, id string) {
+		if id == "" || author == "" {
+			return
+		}
+		if _, ok := seen[id]; ok {
+			return
+		}
+		seen[id] = struct{}{}
+		urls = append(urls, fmt.Sprintf("https://x.com/%s/status/%s", author, id))
+	}
+
+	rel, err := fetchSyndicationTweetRelations(ctx, st.mediaClient, tweetID)
+	if err != nil {
+		return nil, err
+	}
+	if wantQuote && rel.QuotedHasMedia {
+		add(rel.QuotedAuthor, rel.QuotedID)
+	}
+	if !wantThread {
+		return urls, nil
+	}
+
+	author := rel.Author
+	for depth := 0; depth < maxThreadDepth; depth++ {
+		if rel.ReplyToID == "" || !strings.EqualFold(rel.ReplyToAuthor, author) {
+			break
+		}
+		if _, ok := seen[rel.ReplyToID]; ok {
+			break
+		}
+		add(author, rel.ReplyToID)
+		next, err := fetchSyndicationTweetRelations(ctx, st.mediaClient, rel.ReplyToID)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return urls, err
+			}
+			break
+		}
+		if wantQuote && next.QuotedHasMedia {
+			add(next.QuotedAuthor, next.QuotedID)
+		}
+		rel = next
+	}
+	return urls, nil
+}
+
+// expandDownload enqueues child download tasks for tweets related to the parent task.
+// Children never expand further, which keeps a single request from fanning out unbounded.
+func (st *appState) expandDownload(ctx context.Context, parentTaskID, tweetURL string, expand []string) []string {
+	related, err := st.relatedTweetURLs(ctx, tweetIDFromURL(tweetURL), expand)
+	if err != nil {
+		logger.Warn("failed to expand related tweets", "task_id", parentTaskID, "url", tweetURL, "error", err)
+	}
+	children := make([]string, 0, len(related))
+	for _, u := range related {
+		childID, err := st.enqueueDownload(ctx, downloadTaskPayload{URL: u, ParentTaskID: parentTaskID})
+		if err != nil {
+			continue
+		}
+		children = append(children, childID)
+	}
+	if len(children) > 0 {
+		st.redis.LTrim(ctx, taskListKey, -maxTrackedTasks, -1)
+		logger.Info("enqueued related tweet downloads", "task_id", parentTaskID, "children", len(children))
+	}
+	return children
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+// origMediaURL rewrites a pbs.twimg.com media URL ("ID.jpg", "ID.jpg:large" or
+// "ID?format=jpg&name=large") to its original-size variant. Other URLs are returned as is.
+func origMediaURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || !strings.EqualFold(u.Host, "pbs.twimg.com") || !strings.HasPrefix(u.Path, "/media/") {
+		return raw
+	}
+	name := path.Base(u.Path)
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	format := strings.TrimPrefix(path.Ext(name), ".")
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if format == "" {
+		format = u.Query().Get("format")
+	}
+	if format == "" {
+		format = "jpg"
+	}
+	return fmt.Sprintf("https://pbs.twimg.com/media/%s?format=%s&name=orig", name, format)
+}
+
+type refreshResolutionRequest struct {
+	User   string `json:"user"`
+	DryRun bool   `json:"dry_run"`
+}
+
+func (st *appState) handleRefreshResolution(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body refreshResolutionRequest
+	if r.ContentLength != 0 && !decodeJSONOrBadRequest(w, r, &body, "invalid request body") {
+		return
+	}
+
+	taskID := uuid.NewString()
+	payload := refreshResolutionTaskPayload{TaskID: taskID, User: strings.TrimSpace(body.User), DryRun: body.DryRun}
+	err := st.enqueueTask(taskTypeRefreshResolution, st.cfg.queueName, taskID, payload, 6*time.Hour)
+	if err != nil {
+		logger.Error("failed to enqueue refresh resolution task",
+			"task_type", taskTypeRefreshResolution,
+			"task_id", taskID,
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to queue task"})
+		return
+	}
+	setTaskState(r.Context(), st.redis, taskID, "PENDING", taskMessage(msgResolutionQueued))
+	logger.Info("refresh resolution task queued", "task_id", taskID, "user", payload.User, "dry_run", body.DryRun)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"success": true,
+		"queued":  true,
+		"task_id": taskID,
+		"dry_run": body.DryRun,
+		"message": localize(r.Context(), msgResolutionQueued),
+	})
+}
+
+// processRefreshResolutionTask re-checks recorded source URLs for an original-size
+// variant larger than the file on disk and replaces the smaller copy.
+func (st *appState) processRefreshResolutionTask(ctx context.Context, t *asynq.Task) error {
+	var payload refreshResolutionTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+
+	prefix := ""
+	if payload.User != "" {
+		prefix = payload.User + "/"
+	}
+	sources, err := st.store.ListImageSources(prefix)
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+
+	total := len(sources)
+	upgraded := make([]string, 0)
+	unchanged := 0
+	failed := 0
+	for i, src := range sources {
+		replaced, err := st.refreshImageResolution(ctx, src, payload.DryRun)
+		switch {
+		case err != nil:
+			failed++
+			logger.Warn("resolution refresh failed", "filepath", src.Filepath, "error", err)
+		case replaced != "":
+			upgraded = append(upgraded, replaced)
+		default:
+			unchanged++
+		}
+		if i%20 == 0 || i == total-1 {
+			setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+				"current": i + 1,
+				"total":   total,
+				"status":  fmt.Sprintf("upgraded:%d unchanged:%d failed:%d", len(upgraded), unchanged, failed),
+			})
+		}
+	}
+
+	verb := "upgraded"
+	if payload.DryRun {
+		verb = "would upgrade"
+	}
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
+		"dry_run":         payload.DryRun,
+		"upgraded_count":  len(upgraded),
+		"unchanged_count": unchanged,
+		"failed_count":    failed,
+		"upgraded":        upgraded,
+		"total":           total,
+		"current":         total,
+	}, "message", msgResolutionCompleted, verb, len(upgraded), unchanged, failed))
+	return nil
+}
+
+// refreshImageResolution returns the (possibly renamed) filepath when a larger original
+// replaced src, and "" when the stored copy is already the largest.
+func (st *appState) refreshImageResolution(ctx context.Context, src imageSource, dryRun bool) (string, error) {
+	origURL := origMediaURL(src.SourceURL)
+	if !strings.Contains(origURL, "pbs.twimg.com/media/") {
+		return "", nil
+	}
+	fullPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, src.Filepath)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	remoteSize, err := st.remoteContentLength(ctx, origURL)
+	if err != nil {
+		return "", err
+	}
+	if remoteSize <= info.Size() {
+		return "", nil
+	}
+	if dryRun {
+		return src.Filepath, nil
+	}
+
+	base := strings.TrimSuffix(fullPath, filepath.Ext(fullPath))
+	partPath := filepath.Join(filepath.Dir(fullPath), "."+filepath.Base(base)+".orig.part")
+	unlock, err := st.lockPart(ctx, partPath)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	part, err := st.fetchToPart(ctx, origURL, partPath)
+	if err != nil {
+		return "", err
+	}
+	ext, err := sniffMediaExt(partPath)
+	if err != nil {
+		removePart(partPath)
+		return "", err
+	}
+	if part.Size <= info.Size() {
+		removePart(partPath)
+		return "", nil
+	}
+
+	newPath := base + ext
+	newRel := normalizeRelPath(st.cfg.mediaRoot, newPath)
+	if newPath == fullPath {
+		// Same extension: the original replaces the stored copy in one rename.
+		if err := os.Rename(partPath, newPath); err != nil {
+			removePart(partPath)
+			return "", err
+		}
+	} else {
+		// The original has another extension. Never overwrite a file already at that
+		// path, and keep the old copy until the index points at the new one.
+		if err := renameNoReplace(partPath, newPath); err != nil {
+			removePart(partPath)
+			if errors.Is(err, os.ErrExist) {
+				return "", fmt.Errorf("%s already exists", newRel)
+			}
+			return "", err
+		}
+		if err := st.store.RenameImagePath(src.Filepath, newRel); err != nil {
+			_ = os.Remove(newPath)
+			return "", err
+		}
+		if err := os.Remove(fullPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("failed to remove replaced image", "filepath", src.Filepath, "error", err)
+		}
+		st.mirrorRenamed(src.Filepath, newRel)
+	}
+	// The mirror copy, moved or not, still holds the smaller file.
+	st.mirrorDownloaded(newRel)
+	// The old hash stays processed so the smaller copy is never downloaded again.
+	if err := st.store.MarkImageProcessed(part.Hash); err != nil {
+		return "", err
+	}
+	if err := st.store.RecordImage(newImageRecord(newRel, part.Hash, part.Size, time.Now().UnixMilli())); err != nil {
+		logger.Warn("failed to index refreshed image", "filepath", newRel, "error", err)
+	}
+	if err := st.store.RecordImageSource(newRel, origURL); err != nil {
+		return "", err
+	}
+	if supportsPerceptualHash(ext) {
+		if phash, err := perceptualHash(newPath); err == nil {
+			if err := st.store.RecordPerceptualHash(newRel, part.Hash, phash); err != nil {
+				logger.Warn("failed to record perceptual hash", "filepath", newRel, "error", err)
+			}
+		}
+	}
+	logger.Info("image resolution upgraded", "filepath", newRel, "old_size", info.Size(), "new_size", part.Size)
+	return newRel, nil
+}
+
+func (st *appState) remoteContentLength(ctx context.Context, mediaURL string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, mediaURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := st.mediaClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return 0, fmt.Errorf("media head status=%d", resp.StatusCode)
+	}
+	if resp.ContentLength < 0 {
+		return 0, errors.New("media head without content length")
+	}
+	return resp.ContentLength, nil
+}
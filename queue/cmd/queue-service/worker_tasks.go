@@ -3,8 +3,6 @@ package main
 import (
 	"bytes"
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,7 +22,7 @@ import (
 	"github.com/hibiken/asynq"
 )
 
-func (st *appState) processDownloadTask(ctx context.Context, t *asynq.Task) error {
+func (st *appState) processDownloadTask(ctx context.Context, t *asynq.Task) (err error) {
 	var payload downloadTaskPayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
 		return err
@@ -32,65 +31,183 @@ func (st *appState) processDownloadTask(ctx context.Context, t *asynq.Task) erro
 	if taskID == "" {
 		taskID = uuid.NewString()
 	}
-	url := payload.URL
-	if !isTweetURL(url) {
-		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": "invalid tweet url"})
-		return errors.New("invalid tweet url")
+	if payload.ParentTaskID != "" {
+		defer func() { st.recordBackfillChild(ctx, payload.ParentTaskID, taskID, payload.URL, err) }()
+	}
+	if st.taskCancelled(ctx, taskID) {
+		return st.finishCancelledTask(ctx, taskID, taskTypeDownload)
+	}
+	url := canonicalPostURL(payload.URL)
+	var extractor mediaExtractor
+	if payload.Upload != nil {
+		extractor = uploadExtractor{st: st, upload: *payload.Upload}
+	} else {
+		extractor = st.extractorFor(url)
+	}
+	if extractor == nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": "unsupported post url"})
+		return fmt.Errorf("unsupported post url: %w", asynq.SkipRetry)
 	}
 
-	username := extractUsername(url)
-	imageURLs, err := getTweetImages(url)
+	if err := st.checkStorageQuota(ctx); err != nil {
+		if errors.Is(err, errStorageQuotaExceeded) {
+			msg := fmt.Sprintf("Download refused: %v. Free up space or raise the quota and retry.", err)
+			setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": msg})
+			saveTaskResult(ctx, st.redis, taskID, taskTypeDownload, "FAILURE", downloadResult{URL: url, Message: msg})
+			return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+		}
+		logger.Warn("storage quota check failed", "error", err)
+	}
+
+	post, err := extractor.Extract(ctx, url)
 	if err != nil {
-		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		if ctx.Err() != nil && st.taskCancelled(ctx, taskID) {
+			return st.finishCancelledTask(ctx, taskID, taskTypeDownload)
+		}
+		st.setDownloadFailure(ctx, taskID, err.Error())
 		return err
 	}
-	if len(imageURLs) == 0 {
-		res := downloadResult{URL: url, Success: false, Message: "No images found", DownloadedCount: 0, SkippedCount: 0}
-		setTaskState(ctx, st.redis, taskID, "SUCCESS", toMap(res))
+	if post.Cleanup != nil {
+		defer post.Cleanup()
+	}
+	username := post.Username
+	mediaItems := post.Media
+	caption := ""
+	if post.Meta != nil {
+		caption = post.Meta.Text
+	}
+	if meta := post.Meta; meta != nil && len(mediaItems) > 0 {
+		// Keyed by the media directory so deleting the user also drops its captions.
+		meta.Username = username
+		if err := st.store.SaveTweetMeta(*meta); err != nil {
+			logger.Warn("failed to save tweet metadata", "tweet_id", meta.TweetID, "error", err)
+		}
+	}
+
+	// Expansion runs on the first attempt only so retries don't enqueue duplicate children.
+	// Threads and quotes are only understood for X posts.
+	var children []string
+	if retried, _ := asynq.GetRetryCount(ctx); len(payload.Expand) > 0 && retried == 0 && extractor.Name() == extractorX {
+		children = st.expandDownload(ctx, taskID, url, payload.Expand)
+	}
+
+	if len(mediaItems) == 0 {
+		res := downloadResult{URL: url, Success: false, Message: messageText(langEnglish, msgDownloadNoImages), DownloadedCount: 0, SkippedCount: 0, ChildTaskIDs: children}
+		setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(toMap(res), "message", msgDownloadNoImages))
+		saveTaskResult(ctx, st.redis, taskID, taskTypeDownload, "SUCCESS", res)
 		return nil
 	}
 
 	success := 0
 	skipped := 0
 	failed := 0
-	total := len(imageURLs)
-	setTaskState(ctx, st.redis, taskID, "PROGRESS", toMap(progressResult{Current: 0, Total: total, Status: fmt.Sprintf("Starting download for %s...", username)}))
+	total := len(mediaItems)
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(toMap(progressResult{Current: 0, Total: total}), "status", msgDownloadStarting, username))
 	if st.cfg.autotaggerEnable && st.cfg.autotaggerURL != "" {
-		setDownloadAutotagState(ctx, st.redis, "PROGRESS", map[string]any{
+		setDownloadAutotagState(ctx, st.redis, "PROGRESS", withMessage(map[string]any{
 			"task_id":  taskID,
 			"current":  0,
 			"total":    total,
-			"status":   fmt.Sprintf("Autotagging downloaded media for %s...", username),
 			"username": username,
 			"url":      url,
-		})
-	}
+		}, "status", msgDownloadAutotagging, username))
+	}
+
+	// Media of one tweet download on a small pool; counters and progress are shared. Progress
+	// is published after mu is released so workers do not wait on each other's Redis writes;
+	// publishMu keeps the published snapshots in order.
+	ctx = withTaskRateLimiter(ctx, newByteRateLimiter(st.cfg.downloadTaskRateLimit))
+	images := make([]downloadImageResult, total)
+	var mu, publishMu sync.Mutex
+	completed := 0
+	published := 0
+	progress := newProgressThrottle(st.cfg.progressInterval)
+	// Files saved by an earlier attempt of this task are skipped by hash on a retry but still
+	// count as downloaded, so each saved index is remembered while attempts remain.
+	savedKey := downloadSavedPrefix + taskID
+	var savedEarlier map[string]string
+	if n, _ := asynq.GetRetryCount(ctx); n > 0 {
+		savedEarlier, _ = st.redis.HGetAll(ctx, savedKey).Result()
+	}
+	rememberSaved := retriesLeft(ctx)
+	_ = parallelEach(ctx, total, st.cfg.downloadMediaConcurrency, func(i int) {
+		media := mediaItems[i]
+		res := st.downloadImage(ctx, media, post.ID, username, caption, i+1)
+		res.MediaType = media.Type
+		index := strconv.Itoa(i + 1)
+		if p, ok := savedEarlier[index]; ok && res.Status == "skipped" {
+			res.Status = "success"
+			res.Filepath = p
+			res.DuplicateOf = ""
+		} else if res.Status == "success" && rememberSaved {
+			st.redis.HSet(ctx, savedKey, index, res.Filepath)
+			st.redis.Expire(ctx, savedKey, taskStateTTL)
+		}
 
-	for i, imageURL := range imageURLs {
-		res := st.downloadImage(imageURL, url, username, i+1)
-		switch res {
+		mu.Lock()
+		images[i] = res
+		completed++
+		switch res.Status {
 		case "success":
 			success++
-		case "skipped":
+		case "skipped", "rejected":
 			skipped++
 		default:
 			failed++
 		}
+		current := completed
+		status := fmt.Sprintf("saved:%d skipped:%d failed:%d", success, skipped, failed)
+		due := progress.due(completed == total)
+		mu.Unlock()
+		if !due {
+			return
+		}
+
+		publishMu.Lock()
+		defer publishMu.Unlock()
+		if current <= published {
+			return
+		}
+		published = current
 		setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
-			"current": i + 1,
+			"current": current,
 			"total":   total,
-			"status":  fmt.Sprintf("saved:%d skipped:%d failed:%d", success, skipped, failed),
+			"status":  status,
 		})
 		if st.cfg.autotaggerEnable && st.cfg.autotaggerURL != "" {
 			setDownloadAutotagState(ctx, st.redis, "PROGRESS", map[string]any{
 				"task_id":  taskID,
-				"current":  i + 1,
+				"current":  current,
 				"total":    total,
-				"status":   fmt.Sprintf("saved:%d skipped:%d failed:%d", success, skipped, failed),
+				"status":   status,
 				"username": username,
 				"url":      url,
 			})
 		}
+	})
+	if ctx.Err() != nil && st.taskCancelled(ctx, taskID) {
+		return st.finishCancelledTask(ctx, taskID, taskTypeDownload)
+	}
+	// Items never started because the task was cancelled count as failures.
+	for i, res := range images {
+		if res.Status == "" {
+			images[i] = downloadImageResult{Index: i + 1, SourceURL: mediaItems[i].URL, MediaType: mediaItems[i].Type, Status: "failed", Error: "not attempted"}
+			failed++
+		}
+	}
+
+	if success > 0 && st.cfg.profileMedia && extractor.Name() == extractorX {
+		st.downloadProfileMedia(ctx, username)
+	}
+
+	// Already saved files are skipped on the next attempt, so partial failures retry cheaply.
+	if failed > 0 && retriesLeft(ctx) {
+		msg := fmt.Sprintf("saved:%d skipped:%d failed:%d", success, skipped, failed)
+		st.setDownloadFailure(ctx, taskID, msg)
+		return fmt.Errorf("failed to download %d of %d media for %s", failed, total, url)
+	}
+	if rememberSaved || savedEarlier != nil {
+		st.redis.Del(ctx, savedKey)
 	}
 
 	res := downloadResult{
@@ -98,26 +215,75 @@ func (st *appState) processDownloadTask(ctx context.Context, t *asynq.Task) erro
 		Success:         success > 0,
 		DownloadedCount: success,
 		SkippedCount:    skipped,
-		Message:         fmt.Sprintf("completed with saved:%d skipped:%d failed:%d", success, skipped, failed),
+		FailedCount:     failed,
+		ChildTaskIDs:    children,
+		Message:         messageText(langEnglish, msgDownloadCompleted, success, skipped, failed),
 	}
-	setTaskState(ctx, st.redis, taskID, "SUCCESS", toMap(res))
+	state := withMessage(toMap(res), "message", msgDownloadCompleted, success, skipped, failed)
+	if n, ok := asynq.GetRetryCount(ctx); ok && n > 0 {
+		state["retry_count"] = n
+	}
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", state)
+	res.Images = images
+	saveTaskResult(ctx, st.redis, taskID, taskTypeDownload, "SUCCESS", res)
 	if st.cfg.autotaggerEnable && st.cfg.autotaggerURL != "" {
 		finalStatus := "SUCCESS"
 		if success == 0 && failed > 0 {
 			finalStatus = "FAILURE"
 		}
-		setDownloadAutotagState(ctx, st.redis, finalStatus, map[string]any{
+		setDownloadAutotagState(ctx, st.redis, finalStatus, withMessage(map[string]any{
 			"task_id":  taskID,
 			"current":  total,
 			"total":    total,
-			"status":   res.Message,
 			"username": username,
 			"url":      url,
-		})
+		}, "status", msgDownloadCompleted, success, skipped, failed))
 	}
 	return nil
 }
 
+// retriesLeft reports whether asynq will run the current task again if it fails.
+func retriesLeft(ctx context.Context) bool {
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	return retried < maxRetry
+}
+
+// setDownloadFailure records a failed download attempt as RETRY while attempts remain,
+// and as FAILURE once the retry budget is spent.
+func (st *appState) setDownloadFailure(ctx context.Context, taskID, message string) {
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	fields := map[string]any{
+		"message":     message,
+		"retry_count": retried,
+		"max_retry":   maxRetry,
+	}
+	if retried < maxRetry {
+		fields["message"] = fmt.Sprintf("retrying (%d/%d): %s", retried+1, maxRetry, message)
+		setTaskState(ctx, st.redis, taskID, "RETRY", fields)
+		return
+	}
+	setTaskState(ctx, st.redis, taskID, "FAILURE", fields)
+	saveTaskResult(ctx, st.redis, taskID, taskTypeDownload, "FAILURE", downloadResult{Message: message})
+}
+
+// retryDelay backs download retries off exponentially from DOWNLOAD_RETRY_DELAY, capped at
+// one hour. Other task types keep the asynq default.
+func (st *appState) retryDelay(n int, err error, t *asynq.Task) time.Duration {
+	if t.Type() != taskTypeDownload || st.cfg.downloadRetryDelay <= 0 {
+		return asynq.DefaultRetryDelayFunc(n, err, t)
+	}
+	delay := st.cfg.downloadRetryDelay
+	for i := 0; i < n && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
+
 func (st *appState) processAutotagAllTask(ctx context.Context, t *asynq.Task) error {
 	var payload autotagTaskPayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
@@ -127,7 +293,7 @@ func (st *appState) processAutotagAllTask(ctx context.Context, t *asynq.Task) er
 	if taskID == "" {
 		taskID = uuid.NewString()
 	}
-	setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{"current": 0, "total": 1, "status": "Clearing database..."})
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{"current": 0, "total": 1}, "status", msgAutotagClearing))
 
 	if err := st.store.DeleteAllTags(); err != nil {
 		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"status": err.Error(), "message": err.Error()})
@@ -138,19 +304,18 @@ func (st *appState) processAutotagAllTask(ctx context.Context, t *asynq.Task) er
 		return err
 	}
 
-	files, err := listImageFiles(st.cfg.mediaRoot)
-	if err != nil {
-		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"status": err.Error(), "message": err.Error()})
-		return err
-	}
-	if len(files) == 0 {
+	total := countImages(st.cfg.mediaRoot)
+	if total == 0 {
 		setTaskState(ctx, st.redis, taskID, "SUCCESS", toMap(autotagResult{Current: 0, Total: 0, Status: "No images found to process."}))
 		return nil
 	}
 
 	processed := 0
-	total := len(files)
-	for _, full := range files {
+	progress := newProgressThrottle(st.cfg.progressInterval)
+	err := walkImageFiles(st.cfg.mediaRoot, func(full string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		rel := normalizeRelPath(st.cfg.mediaRoot, full)
 		hash, err := fileMD5(full)
 		if err == nil {
@@ -158,11 +323,18 @@ func (st *appState) processAutotagAllTask(ctx context.Context, t *asynq.Task) er
 			_ = st.store.MarkImageProcessed(hash)
 			processed++
 		}
-		setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+		if !progress.due(processed == total) {
+			return nil
+		}
+		setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{
 			"current": processed,
 			"total":   total,
-			"status":  fmt.Sprintf("Processed %d/%d (last: %s)", processed, total, rel),
-		})
+		}, "status", msgAutotagProcessed, processed, total, rel))
+		return nil
+	})
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"status": err.Error(), "message": err.Error()})
+		return err
 	}
 
 	setTaskState(ctx, st.redis, taskID, "SUCCESS", toMap(autotagResult{Current: processed, Total: total, Status: fmt.Sprintf("Complete! Processed %d files.", processed)}))
@@ -178,7 +350,7 @@ func (st *appState) processAutotagUntaggedTask(ctx context.Context, t *asynq.Tas
 	if taskID == "" {
 		taskID = uuid.NewString()
 	}
-	setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{"current": 0, "total": 1, "status": "Finding untagged files..."})
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{"current": 0, "total": 1}, "status", msgAutotagFindingUntagged))
 
 	tagged, err := st.store.GetAllTaggedFilepaths()
 	if err != nil {
@@ -186,39 +358,47 @@ func (st *appState) processAutotagUntaggedTask(ctx context.Context, t *asynq.Tas
 		return err
 	}
 
-	files, err := listImageFiles(st.cfg.mediaRoot)
-	if err != nil {
-		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"status": err.Error(), "message": err.Error()})
-		return err
-	}
-	untagged := make([]string, 0)
-	for _, full := range files {
-		rel := normalizeRelPath(st.cfg.mediaRoot, full)
-		if _, ok := tagged[rel]; !ok {
-			untagged = append(untagged, full)
+	// First pass only counts so progress has a total; the second pass does the work.
+	total := 0
+	_ = walkImageFiles(st.cfg.mediaRoot, func(full string) error {
+		if _, ok := tagged[normalizeRelPath(st.cfg.mediaRoot, full)]; !ok {
+			total++
 		}
-	}
-
-	if len(untagged) == 0 {
+		return nil
+	})
+	if total == 0 {
 		setTaskState(ctx, st.redis, taskID, "SUCCESS", toMap(autotagResult{Current: 0, Total: 0, Status: "No new untagged images to process."}))
 		return nil
 	}
 
 	processed := 0
-	total := len(untagged)
-	for _, full := range untagged {
+	progress := newProgressThrottle(st.cfg.progressInterval)
+	err = walkImageFiles(st.cfg.mediaRoot, func(full string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		rel := normalizeRelPath(st.cfg.mediaRoot, full)
+		if _, ok := tagged[rel]; ok {
+			return nil
+		}
 		hash, err := fileMD5(full)
 		if err == nil {
 			_ = st.autotagFile(full, rel, hash)
 			_ = st.store.MarkImageProcessed(hash)
 			processed++
 		}
-		setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+		if !progress.due(processed == total) {
+			return nil
+		}
+		setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{
 			"current": processed,
 			"total":   total,
-			"status":  fmt.Sprintf("Processed %d/%d (last: %s)", processed, total, rel),
-		})
+		}, "status", msgAutotagProcessed, processed, total, rel))
+		return nil
+	})
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"status": err.Error(), "message": err.Error()})
+		return err
 	}
 
 	setTaskState(ctx, st.redis, taskID, "SUCCESS", toMap(autotagResult{Current: processed, Total: total, Status: fmt.Sprintf("Complete! Processed %d files.", processed)}))
@@ -235,29 +415,23 @@ func (st *appState) processReconcileDBTask(ctx context.Context, t *asynq.Task) e
 		taskID = uuid.NewString()
 	}
 
-	files, err := listImageFiles(st.cfg.mediaRoot)
-	if err != nil {
-		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
-		return err
-	}
-
-	total := len(files)
-	setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+	total := countImages(st.cfg.mediaRoot)
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{
 		"current": 0,
 		"total":   total,
-		"status":  "Scanning media files and calculating hashes...",
-	})
-
-	existingPaths := make(map[string]struct{}, len(files))
-	existingHashes := make(map[string]struct{}, len(files))
-	hashReadErrors := 0
+	}, "status", msgReconcileScanning))
 
-	for _, full := range files {
-		rel := normalizeRelPath(st.cfg.mediaRoot, full)
-		existingPaths[rel] = struct{}{}
+	// Files are staged in SQLite as they are hashed, so memory stays flat however large
+	// the library is. Anything indexed from startedAt on is a download racing the scan.
+	startedAt := time.Now().UnixMilli()
+	if err := st.store.ResetImageIndexStaging(); err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
 	}
+	hashReadErrors := 0
 
 	type hashResult struct {
+		full string
 		hash string
 		err  error
 	}
@@ -280,80 +454,99 @@ func (st *appState) processReconcileDBTask(ctx context.Context, t *asynq.Task) e
 			defer wg.Done()
 			for full := range jobs {
 				hash, err := fileMD5(full)
-				results <- hashResult{hash: hash, err: err}
+				results <- hashResult{full: full, hash: hash, err: err}
 			}
 		}()
 	}
 
+	scanCtx, cancelScan := context.WithCancel(ctx)
+	defer cancelScan()
+	walkErr := make(chan error, 1)
 	go func() {
-		for _, full := range files {
-			jobs <- full
-		}
+		walkErr <- walkImageFiles(st.cfg.mediaRoot, func(full string) error {
+			select {
+			case <-scanCtx.Done():
+				return scanCtx.Err()
+			case jobs <- full:
+				return nil
+			}
+		})
 		close(jobs)
 		wg.Wait()
 		close(results)
 	}()
 
 	scanned := 0
+	batch := make([]imageRecord, 0, reconcileStageBatch)
+	var stageErr error
 	for result := range results {
 		scanned++
+		rel := normalizeRelPath(st.cfg.mediaRoot, result.full)
+		// A file that can't be read is staged without a hash: it keeps its tags but is
+		// left out of the index.
+		rec := newImageRecord(rel, "", 0, 0)
 		if result.err != nil {
 			hashReadErrors++
-		} else {
-			existingHashes[result.hash] = struct{}{}
+		} else if info, err := os.Stat(result.full); err == nil {
+			rec = newImageRecord(rel, result.hash, info.Size(), info.ModTime().UnixMilli())
+		}
+		// After a staging error the results are still drained so the hash workers exit.
+		if stageErr == nil {
+			batch = append(batch, rec)
+			if len(batch) == reconcileStageBatch {
+				stageErr = st.store.StageImageRecords(batch)
+				batch = batch[:0]
+				if stageErr != nil {
+					cancelScan()
+				}
+			}
 		}
 
 		if scanned%100 == 0 || scanned == total {
-			setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+			setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{
 				"current": scanned,
 				"total":   total,
-				"status":  fmt.Sprintf("Scanned %d/%d files", scanned, total),
-			})
+			}, "status", msgReconcileScanned, scanned, total))
 		}
 	}
 
-	processedHashes, err := st.store.GetAllProcessedHashes()
+	err := <-walkErr
+	if stageErr == nil {
+		stageErr = st.store.StageImageRecords(batch)
+	}
+	if stageErr != nil {
+		err = stageErr
+	}
 	if err != nil {
 		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
 		return err
 	}
-	staleHashes := make([]string, 0)
-	for _, h := range processedHashes {
-		if _, ok := existingHashes[h]; !ok {
-			staleHashes = append(staleHashes, h)
-		}
-	}
 
-	removedHashCount, err := st.store.DeleteProcessedHashes(staleHashes)
+	removedHashCount, processedHashCount, err := st.store.PruneUnstagedHashes(startedAt)
 	if err != nil {
 		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
 		return err
 	}
-
-	taggedPaths, err := st.store.GetAllTaggedFilepaths()
+	removedTagPathCount, err := st.store.PruneUnstagedTags(startedAt)
 	if err != nil {
 		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
 		return err
 	}
-	removedTagPathCount := 0
-	for p := range taggedPaths {
-		if _, ok := existingPaths[p]; ok {
-			continue
-		}
-		if err := st.store.DeleteTagsForFile(p); err == nil {
-			removedTagPathCount++
-		}
+	indexed, err := st.store.PromoteImageIndexStaging(startedAt)
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
 	}
 
-	setTaskState(ctx, st.redis, taskID, "SUCCESS", map[string]any{
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
 		"success":                 true,
-		"message":                 "DB consistency reconciliation completed",
 		"scanned_files":           total,
-		"db_hashes_total":         len(processedHashes),
+		"db_hashes_total":         processedHashCount,
 		"removed_stale_hashes":    removedHashCount,
 		"removed_missing_tagsets": removedTagPathCount,
 		"hash_read_errors":        hashReadErrors,
-	})
+		"indexed_images":          indexed,
+	}, "message", msgReconcileCompleted))
 	return nil
 }
 
@@ -378,7 +571,7 @@ func (st *appState) processDeleteUserTask(ctx context.Context, t *asynq.Task) er
 		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": "Invalid username"})
 		return err
 	}
-	setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{"message": "Deleting user..."})
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", taskMessage(msgDeleteUserProgress))
 
 	imageCount := countImages(userPath)
 	if err := os.RemoveAll(userPath); err != nil && !errors.Is(err, os.ErrNotExist) {
@@ -389,16 +582,173 @@ func (st *appState) processDeleteUserTask(ctx context.Context, t *asynq.Task) er
 		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
 		return err
 	}
+	if err := st.store.DeleteUserImages(username); err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
 
-	setTaskState(ctx, st.redis, taskID, "SUCCESS", map[string]any{
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
 		"success":        true,
-		"message":        fmt.Sprintf("Deleted user '%s' and %d images", username, imageCount),
 		"username":       username,
 		"deleted_images": imageCount,
+	}, "message", msgDeleteUserCompleted, username, imageCount))
+	return nil
+}
+
+func (st *appState) processCleanupEmptyUsersTask(ctx context.Context, t *asynq.Task) error {
+	var payload cleanupEmptyUsersTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{}, "status", msgCleanupUsersProgress))
+
+	entries, err := os.ReadDir(st.cfg.mediaRoot)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+	dirUsers := make(map[string]struct{}, len(entries))
+	dirs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dirUsers[entry.Name()] = struct{}{}
+		// Dot directories such as .uploads and .exports hold staging files, not media.
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if _, ok := normalizeUsername(entry.Name()); !ok {
+			continue
+		}
+		dirs = append(dirs, entry.Name())
+	}
+	imageCounts := make([]int, len(dirs))
+	if err := parallelEach(ctx, len(dirs), st.cfg.fsScanWorkers, func(i int) {
+		imageCounts[i] = countImages(filepath.Join(st.cfg.mediaRoot, dirs[i]))
+	}); err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+	// A user with a queued or running download may only hold .part files so far.
+	downloadingUsers := make(map[string]struct{})
+	for u := range st.pendingDownloadURLs(ctx) {
+		downloadingUsers[strings.ToLower(extractUsername(u))] = struct{}{}
+	}
+	emptyUsers := make([]string, 0)
+	busyUsers := make([]string, 0)
+	for i, username := range dirs {
+		if imageCounts[i] != 0 {
+			continue
+		}
+		if _, busy := downloadingUsers[strings.ToLower(username)]; busy {
+			busyUsers = append(busyUsers, username)
+			continue
+		}
+		emptyUsers = append(emptyUsers, username)
+	}
+
+	// Tag rows whose user directory no longer exists are residue of earlier deletions.
+	taggedPaths, err := st.store.GetAllTaggedFilepaths()
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+	orphanUsersSet := make(map[string]struct{})
+	for p := range taggedPaths {
+		username, _, ok := strings.Cut(p, "/")
+		if !ok || username == "" {
+			continue
+		}
+		if _, exists := dirUsers[username]; !exists {
+			orphanUsersSet[username] = struct{}{}
+		}
+	}
+	orphanUsers := make([]string, 0, len(orphanUsersSet))
+	for username := range orphanUsersSet {
+		orphanUsers = append(orphanUsers, username)
+	}
+	sort.Strings(emptyUsers)
+	sort.Strings(busyUsers)
+	sort.Strings(orphanUsers)
+
+	removedDirs := make([]string, 0, len(emptyUsers))
+	removedOrphans := 0
+	failedUsers := make([]string, 0)
+	if !payload.DryRun {
+		for _, username := range emptyUsers {
+			userPath, err := resolvePathUnderRoot(st.cfg.mediaRoot, username)
+			if err != nil {
+				failedUsers = append(failedUsers, username)
+				continue
+			}
+			if err := os.RemoveAll(userPath); err != nil {
+				failedUsers = append(failedUsers, username)
+				continue
+			}
+			if err := st.store.DeleteTagsForUser(username); err != nil {
+				failedUsers = append(failedUsers, username)
+				continue
+			}
+			_ = st.store.DeleteUserImages(username)
+			removedDirs = append(removedDirs, username)
+		}
+		for _, username := range orphanUsers {
+			if err := st.store.DeleteTagsForUser(username); err != nil {
+				failedUsers = append(failedUsers, username)
+				continue
+			}
+			removedOrphans++
+		}
+	}
+
+	message := fmt.Sprintf("Removed %d empty users and tag rows for %d missing users", len(removedDirs), removedOrphans)
+	if payload.DryRun {
+		message = fmt.Sprintf("Dry run: %d empty users and %d missing users with residual tags", len(emptyUsers), len(orphanUsers))
+	}
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", map[string]any{
+		"success":              true,
+		"message":              message,
+		"dry_run":              payload.DryRun,
+		"empty_users":          emptyUsers,
+		"downloading_users":    busyUsers,
+		"removed_users":        removedDirs,
+		"orphaned_tag_users":   orphanUsers,
+		"failed_users":         failedUsers,
+		"empty_user_count":     len(emptyUsers),
+		"orphaned_users_count": len(orphanUsers),
 	})
 	return nil
 }
 
+func (st *appState) processNormalizeTagsTask(ctx context.Context, t *asynq.Task) error {
+	var payload normalizeTagsTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{}, "status", msgNormalizeTagsProgress))
+
+	renamed, merged, err := st.store.NormalizeAllTags()
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
+		"success":       true,
+		"renamed_count": renamed,
+		"merged_count":  merged,
+	}, "message", msgNormalizeTagsCompleted, renamed, merged))
+	return nil
+}
+
 func (st *appState) processDeleteImageTask(ctx context.Context, t *asynq.Task) error {
 	var payload deleteImageTaskPayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
@@ -420,23 +770,23 @@ func (st *appState) processDeleteImageTask(ctx context.Context, t *asynq.Task) e
 		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": "Invalid filepath"})
 		return err
 	}
-	setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{"message": "Deleting image..."})
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", taskMessage(msgDeleteImageProgress))
 
 	if err := os.Remove(full); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": "Image not found"})
+			setTaskState(ctx, st.redis, taskID, "FAILURE", taskMessage(msgDeleteImageNotFound))
 			return err
 		}
 		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
 		return err
 	}
 	_ = st.store.DeleteTagsForFile(rel)
+	_ = st.store.DeleteImageRecord(rel)
 	_ = cleanupEmptyParents(full, st.cfg.mediaRoot)
-	setTaskState(ctx, st.redis, taskID, "SUCCESS", map[string]any{
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
 		"success":  true,
-		"message":  "Image deleted",
 		"filepath": rel,
-	})
+	}, "message", msgDeleteImageCompleted))
 	return nil
 }
 
@@ -466,11 +816,10 @@ func (st *appState) processDeleteImagesTask(ctx context.Context, t *asynq.Task)
 	notFound := 0
 	failed := 0
 	total := len(filepaths)
-	setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{
 		"current": 0,
 		"total":   total,
-		"message": "Deleting images...",
-	})
+	}, "message", msgDeleteImagesProgress))
 
 	for i, rel := range filepaths {
 		full, err := resolvePathUnderRoot(st.cfg.mediaRoot, rel)
@@ -486,6 +835,7 @@ func (st *appState) processDeleteImagesTask(ctx context.Context, t *asynq.Task)
 			} else {
 				deleted++
 				_ = st.store.DeleteTagsForFile(rel)
+				_ = st.store.DeleteImageRecord(rel)
 				_ = cleanupEmptyParents(full, st.cfg.mediaRoot)
 			}
 		}
@@ -501,12 +851,12 @@ func (st *appState) processDeleteImagesTask(ctx context.Context, t *asynq.Task)
 
 	result := map[string]any{
 		"success":         true,
-		"message":         fmt.Sprintf("Bulk delete completed. deleted:%d not_found:%d failed:%d", deleted, notFound, failed),
 		"deleted_count":   deleted,
 		"not_found_count": notFound,
 		"failed_count":    failed,
 		"total":           total,
 	}
+	withMessage(result, "message", msgDeleteImagesCompleted, deleted, notFound, failed)
 	if deleted == 0 && failed > 0 {
 		setTaskState(ctx, st.redis, taskID, "FAILURE", result)
 		return errors.New("bulk delete failed")
@@ -530,7 +880,7 @@ func (st *appState) processRetagImageTask(ctx context.Context, t *asynq.Task) er
 		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
 		return err
 	}
-	setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{"message": "Retagging image...", "current": 0, "total": 1})
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{"current": 0, "total": 1}, "message", msgRetagImageProgress))
 	result, err := st.retagSingleFile(rel, false)
 	if err != nil {
 		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
@@ -541,15 +891,14 @@ func (st *appState) processRetagImageTask(ctx context.Context, t *asynq.Task) er
 		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
 		return err
 	}
-	msg := "Tags generated successfully!"
+	code := msgRetagImageTagged
 	if result == "skipped" {
-		msg = "Image already has tags."
+		code = msgRetagImageSkipped
 	}
-	setTaskState(ctx, st.redis, taskID, "SUCCESS", map[string]any{
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
 		"success": true,
-		"message": msg,
 		"tags":    updated[rel],
-	})
+	}, "message", code))
 	return nil
 }
 
@@ -574,11 +923,10 @@ func (st *appState) processRetagImagesTask(ctx context.Context, t *asynq.Task) e
 	success := 0
 	skipped := 0
 	failed := 0
-	setTaskState(ctx, st.redis, taskID, "PROGRESS", map[string]any{
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{
 		"current": 0,
 		"total":   total,
-		"status":  "Retagging images...",
-	})
+	}, "status", msgRetagImagesProgress))
 
 	for i, rel := range filepaths {
 		result, err := st.retagSingleFile(rel, true)
@@ -601,7 +949,6 @@ func (st *appState) processRetagImagesTask(ctx context.Context, t *asynq.Task) e
 
 	result := map[string]any{
 		"success":        true,
-		"message":        fmt.Sprintf("Bulk retag (force) completed. retagged:%d skipped:%d failed:%d", success, skipped, failed),
 		"retagged_count": success,
 		"skipped_count":  skipped,
 		"failed_count":   failed,
@@ -610,6 +957,7 @@ func (st *appState) processRetagImagesTask(ctx context.Context, t *asynq.Task) e
 		"status":         fmt.Sprintf("force retagged:%d skipped:%d failed:%d", success, skipped, failed),
 		"force":          true,
 	}
+	withMessage(result, "message", msgRetagImagesCompleted, success, skipped, failed)
 	if success == 0 && failed > 0 {
 		setTaskState(ctx, st.redis, taskID, "FAILURE", result)
 		return errors.New("bulk retag failed")
@@ -625,12 +973,19 @@ func (st *appState) retagSingleFile(rel string, force bool) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	hasExisting := len(existing[rel]) > 0
+	// Tags set by hand or guessed by the heuristic tagger neither count as tagged nor get replaced.
+	hasExisting := false
+	for _, t := range existing[rel] {
+		if t.Source == "" {
+			hasExisting = true
+			break
+		}
+	}
 	if hasExisting && !force {
 		return "skipped", nil
 	}
 	if hasExisting && force {
-		if err := st.store.DeleteTagsForFile(rel); err != nil {
+		if err := st.store.DeleteAutotagsForFile(rel); err != nil {
 			return "", err
 		}
 	}
@@ -652,53 +1007,141 @@ func (st *appState) retagSingleFile(rel string, force bool) (string, error) {
 	return "success", nil
 }
 
-func (st *appState) downloadImage(imageURL, tweetURL, username string, index int) string {
-	req, _ := http.NewRequest(http.MethodGet, imageURL, nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0")
-	resp, err := st.downloadHTTPClient.Do(req)
-	if err != nil {
-		return "failed"
+func (st *appState) downloadImage(ctx context.Context, media tweetMedia, tweetID, username, caption string, index int) downloadImageResult {
+	imageURL := media.URL
+	res := downloadImageResult{Index: index, SourceURL: imageURL, Status: "failed"}
+	userDir := filepath.Join(st.cfg.mediaRoot, username)
+	if err := os.MkdirAll(userDir, 0o755); err != nil {
+		res.Error = err.Error()
+		return res
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		return "failed"
+
+	// The .part file lives in the destination directory so an interrupted transfer can
+	// resume on retry and the final rename stays on one filesystem.
+	partPath := filepath.Join(userDir, fmt.Sprintf(".%s_%02d.part", tweetID, index))
+	unlock, err := st.lockPart(ctx, partPath)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer unlock()
+	var part partDownload
+	if media.LocalPath != "" {
+		part, err = st.adoptLocalFile(media.LocalPath, partPath)
+	} else {
+		part, err = st.fetchToPart(ctx, imageURL, partPath)
+	}
+	if errors.Is(err, errMediaTooLarge) {
+		// Retrying cannot make the file smaller, so this is not counted as a failure.
+		logger.Warn("media download refused", "url", imageURL, "error", err)
+		res.Status = "rejected"
+		res.Error = err.Error()
+		return res
 	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil || len(body) == 0 {
-		return "failed"
+	if err != nil {
+		logger.Warn("media download failed", "url", imageURL, "error", err)
+		res.Error = err.Error()
+		return res
 	}
 
-	hashArr := md5.Sum(body)
-	hash := hex.EncodeToString(hashArr[:])
-	processed, err := st.store.IsImageProcessed(hash)
-	if err == nil && processed {
-		return "skipped"
+	res.Hash = part.Hash
+	res.Size = part.Size
+	ext, err := sniffMediaExt(partPath)
+	if err != nil {
+		removePart(partPath)
+		logger.Warn("media download rejected", "url", imageURL, "content_type", part.ContentType, "error", err)
+		res.Error = err.Error()
+		return res
 	}
-
-	tweetID := tweetIDFromURL(tweetURL)
-	ext := extFromContentType(resp.Header.Get("content-type"))
-	userDir := filepath.Join(st.cfg.mediaRoot, username)
-	if err := os.MkdirAll(userDir, 0o755); err != nil {
-		return "failed"
+	// Claiming the hash up front keeps two workers holding the same bytes from both saving.
+	claimed, err := st.store.ClaimImageHash(part.Hash)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if !claimed {
+		removePart(partPath)
+		res.Status = "skipped"
+		return res
+	}
+	var phash uint64
+	hasPHash := false
+	if supportsPerceptualHash(ext) {
+		if h, err := perceptualHash(partPath); err == nil {
+			phash, hasPHash = h, true
+			res.PHash = formatPerceptualHash(h)
+		} else {
+			logger.Warn("failed to compute perceptual hash", "url", imageURL, "error", err)
+		}
 	}
+	if hasPHash && st.cfg.phashDedupDistance >= 0 {
+		match, distance, found, err := st.store.FindSimilarImage(phash, st.cfg.phashDedupDistance)
+		if err != nil {
+			logger.Warn("perceptual hash lookup failed", "url", imageURL, "error", err)
+		} else if found {
+			removePart(partPath)
+			// The claimed MD5 stays marked so a retry of the same bytes skips without decoding again.
+			logger.Info("skipped near-duplicate media", "url", imageURL, "duplicate_of", match, "distance", distance)
+			res.Status = "skipped"
+			res.DuplicateOf = match
+			return res
+		}
+	}
+
 	filename := fmt.Sprintf("%s_%02d%s", tweetID, index, ext)
 	fullPath := filepath.Join(userDir, filename)
-	if err := os.WriteFile(fullPath, body, 0o644); err != nil {
-		return "failed"
+	if err := os.Rename(partPath, fullPath); err != nil {
+		// Release the claim so a retry can save these bytes.
+		_, _ = st.store.DeleteProcessedHashes([]string{part.Hash})
+		res.Error = err.Error()
+		return res
 	}
+	removePart(partPath)
 
 	relPath := normalizeRelPath(st.cfg.mediaRoot, fullPath)
-	if err := st.store.MarkImageProcessed(hash); err != nil {
-		return "failed"
+	res.Filepath = relPath
+	rec := newImageRecord(relPath, part.Hash, part.Size, time.Now().UnixMilli())
+	if err := st.store.RecordImage(rec); err != nil {
+		logger.Warn("failed to index downloaded image", "filepath", relPath, "error", err)
+	}
+	if err := st.store.RecordImageSource(relPath, imageURL); err != nil {
+		logger.Warn("failed to record image source", "filepath", relPath, "error", err)
+	}
+	st.mirrorDownloaded(relPath)
+	if err := st.store.AddToInbox(relPath); err != nil {
+		logger.Warn("failed to add image to inbox", "filepath", relPath, "error", err)
+	}
+	if hasPHash {
+		if err := st.store.RecordPerceptualHash(relPath, part.Hash, phash); err != nil {
+			logger.Warn("failed to record perceptual hash", "filepath", relPath, "error", err)
+		}
 	}
-	_ = st.autotagFile(fullPath, relPath, hash)
-	return "success"
+	if st.cfg.borderDetect && supportsPerceptualHash(ext) {
+		if _, err := st.recordCropSuggestion(fullPath, relPath, part.Hash); err != nil {
+			logger.Warn("failed to detect borders", "filepath", relPath, "error", err)
+		}
+	}
+	if st.cfg.colorAnalysis && supportsPerceptualHash(ext) {
+		if _, err := st.recordColorAnalysis(fullPath, relPath, part.Hash); err != nil {
+			logger.Warn("failed to analyze colors", "filepath", relPath, "error", err)
+		}
+	}
+	// Only files an external downloader wrote keep a meaningful name; X media IDs don't.
+	st.creatorTagFile(relPath, username)
+	st.heuristicTagFile(relPath, username, media.LocalPath, caption)
+	_ = st.autotagFile(fullPath, relPath, part.Hash)
+	st.notifyTagSubscriptions(relPath)
+	res.Status = "success"
+	return res
 }
 
 func (st *appState) autotagFile(fullPath, relativePath, _ string) error {
 	if !st.cfg.autotaggerEnable || st.cfg.autotaggerURL == "" {
 		return nil
 	}
+	if isVideoFile(fullPath) {
+		return nil
+	}
 
 	const maxAutotagAttempts = 5
 
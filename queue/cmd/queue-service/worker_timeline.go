@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+var (
+	usernameRe        = regexp.MustCompile(`^[A-Za-z0-9_]{1,15}$`)
+	nextDataRe        = regexp.MustCompile(`(?s)<script id="__NEXT_DATA__" type="application/json">(.*?)</script>`)
+	timelinePageDelay = 2 * time.Second
+)
+
+// timelineMediaPage is one page of a user's media timeline.
+type timelineMediaPage struct {
+	TweetURLs  []string
+	NextCursor string
+}
+
+// normalizeUsername accepts "name", "@name" or a profile URL and returns the bare screen name.
+func normalizeUsername(raw string) (string, bool) {
+	v := strings.TrimSpace(raw)
+	if strings.Contains(v, "/") {
+		if u, err := url.Parse(v); err == nil && u.Host != "" {
+			v = strings.Trim(u.Path, "/")
+			if i := strings.Index(v, "/"); i >= 0 {
+				v = v[:i]
+			}
+		}
+	}
+	v = strings.TrimPrefix(v, "@")
+	if !usernameRe.MatchString(v) {
+		return "", false
+	}
+	return v, true
+}
+
+// rateLimitedError is returned when X answers 429 after the client's own retries.
+// RetryAfter is zero when the response did not advertise one.
+type rateLimitedError struct {
+	Status     int
+	RetryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("timeline api status=%d (rate limited)", e.Status)
+}
+
+// fetchUserMediaTimelinePage fetches one page of media tweets authored by username. With X
+// credentials configured it pages through the GraphQL UserMedia timeline by cursor; without
+// them only the public syndication profile timeline is available, which exposes just the most
+// recent tweets and has no cursor, so NextCursor is always empty.
+func (st *appState) fetchUserMediaTimelinePage(ctx context.Context, username, cursor string) (timelineMediaPage, error) {
+	if st.xAuth != nil {
+		return st.xAuth.fetchUserMediaPage(ctx, st.downloadHTTPClient, username, cursor)
+	}
+	return st.fetchSyndicationMediaTimeline(ctx, username)
+}
+
+// fetchSyndicationMediaTimeline reads the latest media tweets from the public syndication
+// profile timeline.
+func (st *appState) fetchSyndicationMediaTimeline(ctx context.Context, username string) (timelineMediaPage, error) {
+	apiURL := fmt.Sprintf("https://syndication.twitter.com/srv/timeline-profile/screen-name/%s", url.PathEscape(username))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return timelineMediaPage{}, err
+	}
+	resp, err := st.downloadHTTPClient.Do(req)
+	if err != nil {
+		return timelineMediaPage{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		err := &rateLimitedError{Status: resp.StatusCode}
+		if h := resp.Header.Get("Retry-After"); h != "" {
+			err.RetryAfter = retryAfterDelay(h, 1)
+		}
+		return timelineMediaPage{}, err
+	}
+	if resp.StatusCode >= 400 {
+		return timelineMediaPage{}, fmt.Errorf("timeline api status=%d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return timelineMediaPage{}, err
+	}
+	m := nextDataRe.FindSubmatch(body)
+	if len(m) < 2 {
+		return timelineMediaPage{}, errors.New("timeline payload not found")
+	}
+
+	var parsed struct {
+		Props struct {
+			PageProps struct {
+				Timeline struct {
+					Entries []struct {
+						Type    string `json:"type"`
+						Content struct {
+							Tweet struct {
+								IDStr string `json:"id_str"`
+								User  struct {
+									ScreenName string `json:"screen_name"`
+								} `json:"user"`
+								Entities struct {
+									Media []json.RawMessage `json:"media"`
+								} `json:"entities"`
+								ExtendedEntities struct {
+									Media []json.RawMessage `json:"media"`
+								} `json:"extended_entities"`
+							} `json:"tweet"`
+						} `json:"content"`
+					} `json:"entries"`
+				} `json:"timeline"`
+			} `json:"pageProps"`
+		} `json:"props"`
+	}
+	if err := json.Unmarshal(m[1], &parsed); err != nil {
+		return timelineMediaPage{}, err
+	}
+
+	page := timelineMediaPage{TweetURLs: make([]string, 0)}
+	for _, entry := range parsed.Props.PageProps.Timeline.Entries {
+		tweet := entry.Content.Tweet
+		if entry.Type != "tweet" || tweet.IDStr == "" {
+			continue
+		}
+		if !strings.EqualFold(tweet.User.ScreenName, username) {
+			continue
+		}
+		if len(tweet.Entities.Media) == 0 && len(tweet.ExtendedEntities.Media) == 0 {
+			continue
+		}
+		page.TweetURLs = append(page.TweetURLs, fmt.Sprintf("https://x.com/%s/status/%s", username, tweet.IDStr))
+	}
+	return page, nil
+}
+
+func (st *appState) processDownloadTimelineTask(ctx context.Context, t *asynq.Task) error {
+	var payload timelineTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+	username, ok := normalizeUsername(payload.Username)
+	if !ok {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": "invalid username"})
+		return errors.New("invalid username")
+	}
+
+	// Downloads are queued as children of this task and report their outcome to it, so a
+	// backfill report can be written once the last of them finishes.
+	st.startBackfill(ctx, taskID, username)
+
+	// Pagination state lives in Redis so a restarted task resumes from the last cursor.
+	stateKey := timelineStatePrefix + taskID
+	state, _ := st.redis.HGetAll(ctx, stateKey).Result()
+	cursor := state["cursor"]
+	pages, _ := strconv.Atoi(state["pages"])
+	enqueued, _ := strconv.Atoi(state["enqueued"])
+
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{
+		"username":       username,
+		"pages":          pages,
+		"enqueued_count": enqueued,
+	}, "status", msgTimelineFetching, username))
+
+	for {
+		page, err := st.fetchUserMediaTimelinePage(ctx, username, cursor)
+		if err != nil {
+			setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{
+				"message":        err.Error(),
+				"username":       username,
+				"pages":          pages,
+				"enqueued_count": enqueued,
+			})
+			if !retriesLeft(ctx) {
+				st.finishBackfillListing(ctx, taskID, pages, err.Error())
+			}
+			return err
+		}
+		pages++
+		queued := 0
+		for _, tweetURL := range page.TweetURLs {
+			if _, err := st.enqueueDownload(ctx, downloadTaskPayload{URL: tweetURL, ParentTaskID: taskID}); err == nil {
+				queued++
+			}
+		}
+		enqueued += queued
+		st.addBackfillTweets(ctx, taskID, len(page.TweetURLs), queued)
+		st.redis.LTrim(ctx, taskListKey, -maxTrackedTasks, -1)
+
+		prevCursor := cursor
+		cursor = page.NextCursor
+		st.redis.HSet(ctx, stateKey,
+			"username", username,
+			"cursor", cursor,
+			"pages", pages,
+			"enqueued", enqueued,
+			"updated_at", time.Now().UTC().Format(time.RFC3339),
+		)
+		st.redis.Expire(ctx, stateKey, 7*24*time.Hour)
+
+		setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{
+			"username":       username,
+			"pages":          pages,
+			"enqueued_count": enqueued,
+		}, "status", msgTimelinePage, pages, enqueued, username))
+		if cursor == "" || cursor == prevCursor || len(page.TweetURLs) == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": ctx.Err().Error(), "username": username})
+			return ctx.Err()
+		case <-time.After(timelinePageDelay):
+		}
+	}
+
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
+		"success":        true,
+		"username":       username,
+		"pages":          pages,
+		"enqueued_count": enqueued,
+	}, "message", msgTimelineCompleted, enqueued, username, pages))
+	st.finishBackfillListing(ctx, taskID, pages, "")
+	return nil
+}
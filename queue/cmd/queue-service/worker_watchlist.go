@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// watchlistTick is how often the scheduler checks which watched users are due.
+	watchlistTick = 5 * time.Minute
+	// watchlistPollSpread is the window the polls of one scan are spaced over, so users
+	// that fall due on the same tick are not fetched back to back.
+	watchlistPollSpread = watchlistTick / 2
+)
+
+// tweetIDAfter reports whether tweet ID a is newer than b. IDs are compared numerically
+// without parsing so that arbitrarily long snowflakes stay exact.
+func tweetIDAfter(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a > b
+}
+
+// watchPhase returns a fraction in [0, 1) fixed by username and seed. Jitter derived from
+// it stays the same across restarts, so a restart doesn't line every user up again.
+func watchPhase(username string, seed int64) float64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strings.ToLower(username)))
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(seed))
+	_, _ = h.Write(b[:])
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
+
+// watchDue reports whether e should be scanned at now. The interval is stretched by up
+// to WATCHLIST_JITTER_PERCENT, differently per user and per scan, so users registered
+// together drift apart instead of being polled on the same tick forever.
+func (st *appState) watchDue(e watchEntry, now time.Time) bool {
+	if !e.Enabled || now.UnixMilli() < e.BackoffUntil {
+		return false
+	}
+	if e.LastCheckedAt == 0 {
+		return true
+	}
+	interval := e.IntervalMinutes
+	if interval <= 0 {
+		interval = st.cfg.watchlistIntervalMinutes
+	}
+	period := time.Duration(interval) * time.Minute
+	jitter := time.Duration(float64(period) * float64(st.cfg.watchlistJitterPercent) / 100 * watchPhase(e.Username, e.LastCheckedAt))
+	next := time.UnixMilli(e.LastCheckedAt).Add(period + max(jitter, 0))
+	return !now.Before(next)
+}
+
+// watchBackoffDelay is how long to leave username alone after its count-th consecutive
+// 429: WATCHLIST_BACKOFF_MINUTES doubled per attempt up to WATCHLIST_BACKOFF_MAX_MINUTES,
+// never shorter than the advertised Retry-After, plus up to a quarter more per user so
+// backed-off users don't all come back at once.
+func (st *appState) watchBackoffDelay(username string, count int, retryAfter time.Duration) time.Duration {
+	base := st.cfg.watchlistBackoffBase
+	if base <= 0 {
+		base = watchlistTick
+	}
+	limit := max(st.cfg.watchlistBackoffMax, base)
+	delay := base
+	for i := 1; i < count && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(max(delay, retryAfter), max(limit, retryAfter))
+	return delay + time.Duration(float64(delay)/4*watchPhase(username, int64(count)))
+}
+
+// watchlistBackoffUntil returns when the instance-wide backoff set by the last 429 ends.
+// It lives in Redis so every worker and a restarted one honour it.
+func (st *appState) watchlistBackoffUntil(ctx context.Context) time.Time {
+	raw, err := st.redis.Get(ctx, watchlistBackoffKey).Result()
+	if err != nil {
+		return time.Time{}
+	}
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// backOffWatch records a 429 for e: the user is deferred with a growing delay and the
+// rest of the watchlist waits as long, since X throttles the whole instance, not one user.
+func (st *appState) backOffWatch(ctx context.Context, e watchEntry, rl *rateLimitedError) time.Time {
+	count := e.BackoffCount + 1
+	delay := st.watchBackoffDelay(e.Username, count, rl.RetryAfter)
+	until := time.Now().Add(delay)
+	if err := st.store.RecordWatchBackoff(e.Username, until, count); err != nil {
+		logger.Warn("failed to record watchlist backoff", "username", e.Username, "error", err)
+	}
+	if err := st.redis.Set(ctx, watchlistBackoffKey, until.UnixMilli(), delay).Err(); err != nil {
+		logger.Warn("failed to record watchlist backoff", "error", err)
+	}
+	logger.Warn("watchlist scan rate limited, backing off",
+		"username", e.Username,
+		"attempt", count,
+		"until", until.Format(time.RFC3339),
+	)
+	return until
+}
+
+// registerWatchlistSchedule schedules the periodic watchlist scan. The task is unique per
+// tick so several worker processes don't enqueue it more than once.
+func (st *appState) registerWatchlistSchedule(scheduler *asynq.Scheduler) error {
+	if st.cfg.watchlistIntervalMinutes <= 0 {
+		return nil
+	}
+	payload, _ := json.Marshal(watchlistScanTaskPayload{})
+	_, err := scheduler.Register(
+		fmt.Sprintf("@every %s", watchlistTick),
+		asynq.NewTask(taskTypeWatchlistScan, payload),
+		asynq.Queue(st.cfg.queueName),
+		asynq.MaxRetry(0),
+		asynq.Timeout(30*time.Minute),
+		asynq.Unique(watchlistTick),
+	)
+	return err
+}
+
+func (st *appState) processWatchlistScanTask(ctx context.Context, t *asynq.Task) error {
+	var payload watchlistScanTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	if taskID == "" {
+		taskID = uuid.NewString()
+	}
+
+	now := time.Now()
+	if until := st.watchlistBackoffUntil(ctx); now.Before(until) {
+		return nil
+	}
+	entries, err := st.store.ListWatchlist()
+	if err != nil {
+		setTaskState(ctx, st.redis, taskID, "FAILURE", map[string]any{"message": err.Error()})
+		return err
+	}
+	due := make([]watchEntry, 0, len(entries))
+	for _, e := range entries {
+		if st.watchDue(e, now) {
+			due = append(due, e)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{
+		"current": 0,
+		"total":   len(due),
+	}, "status", msgWatchlistScanning))
+	users := make([]map[string]any, 0, len(due))
+	enqueuedTotal := 0
+	spacing := watchlistPollSpread / time.Duration(len(due))
+	for i, e := range due {
+		if i > 0 && spacing > 0 {
+			timer := time.NewTimer(spacing)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		report := map[string]any{"username": e.Username}
+		page, err := st.fetchUserMediaTimelinePage(ctx, e.Username, "")
+		var rl *rateLimitedError
+		if errors.As(err, &rl) {
+			until := st.backOffWatch(ctx, e, rl)
+			report["error"] = err.Error()
+			report["backoff_until"] = until.UnixMilli()
+			users = append(users, report)
+			// The rest keep their place and are picked up once the backoff ends.
+			break
+		}
+		if err != nil {
+			logger.Warn("watchlist scan failed", "username", e.Username, "error", err)
+			report["error"] = err.Error()
+			users = append(users, report)
+			continue
+		}
+
+		lastSeen := e.LastSeenTweetID
+		newest := lastSeen
+		enqueued := 0
+		for _, tweetURL := range page.TweetURLs {
+			tweetID := tweetIDFromURL(tweetURL)
+			if tweetID == "" || (lastSeen != "" && !tweetIDAfter(tweetID, lastSeen)) {
+				continue
+			}
+			if _, err := st.enqueueDownloadURL(ctx, tweetURL); err != nil {
+				continue
+			}
+			enqueued++
+			if tweetIDAfter(tweetID, newest) {
+				newest = tweetID
+			}
+		}
+		st.redis.LTrim(ctx, taskListKey, -maxTrackedTasks, -1)
+		if err := st.store.UpdateWatchProgress(e.Username, newest, time.Now()); err != nil {
+			logger.Warn("failed to update watchlist progress", "username", e.Username, "error", err)
+		}
+
+		enqueuedTotal += enqueued
+		report["enqueued_count"] = enqueued
+		report["last_seen_tweet_id"] = newest
+		users = append(users, report)
+		setTaskState(ctx, st.redis, taskID, "PROGRESS", withMessage(map[string]any{
+			"current": i + 1,
+			"total":   len(due),
+		}, "status", msgWatchlistUser, e.Username, enqueued))
+	}
+
+	setTaskState(ctx, st.redis, taskID, "SUCCESS", withMessage(map[string]any{
+		"success":        true,
+		"enqueued_count": enqueuedTotal,
+		"users":          users,
+	}, "message", msgWatchlistCompleted, len(users), enqueuedTotal))
+	return nil
+}
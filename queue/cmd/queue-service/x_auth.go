@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// xWebBearerToken is the public bearer token used by the x.com web client.
+const xWebBearerToken = "AAAAAAAAAAAAAAAAAAAAANRILgAAAAAAnNwIzUejRCOuH5E6I8xnZz4puTs%3D1Zv7ttfk8LF81IUq16cHjhLTvJu4FA33AGWWjCpTnA"
+
+// xAuthSession holds the cookies of a logged-in x.com session.
+type xAuthSession struct {
+	cookieHeader     string
+	csrfToken        string
+	queryID          string
+	userQueryID      string
+	userMediaQueryID string
+
+	// userIDs caches screen name -> numeric user id lookups for UserMedia paging.
+	userIDs sync.Map
+}
+
+// loadXAuthSession builds a session from X_AUTH_TOKEN/X_CT0 or a cookie file.
+// It returns nil when no credentials are configured.
+func loadXAuthSession(cfg config) (*xAuthSession, error) {
+	cookies := make(map[string]string)
+	order := make([]string, 0)
+	setCookie := func(name, value string) {
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+		if name == "" || value == "" {
+			return
+		}
+		if _, ok := cookies[name]; !ok {
+			order = append(order, name)
+		}
+		cookies[name] = value
+	}
+
+	if cfg.xCookieFile != "" {
+		entries, err := readCookieFile(cfg.xCookieFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read X_COOKIE_FILE %s: %w", cfg.xCookieFile, err)
+		}
+		for _, e := range entries {
+			setCookie(e[0], e[1])
+		}
+	}
+	setCookie("auth_token", cfg.xAuthToken)
+	setCookie("ct0", cfg.xCT0)
+
+	if len(cookies) == 0 {
+		return nil, nil
+	}
+	if cookies["auth_token"] == "" || cookies["ct0"] == "" {
+		return nil, errors.New("x credentials require both auth_token and ct0")
+	}
+	parts := make([]string, 0, len(order))
+	for _, name := range order {
+		parts = append(parts, name+"="+cookies[name])
+	}
+	return &xAuthSession{
+		cookieHeader:     strings.Join(parts, "; "),
+		csrfToken:        cookies["ct0"],
+		queryID:          cfg.xGraphQLQueryID,
+		userQueryID:      cfg.xGraphQLUserQueryID,
+		userMediaQueryID: cfg.xGraphQLUserMediaQueryID,
+	}, nil
+}
+
+// readCookieFile parses either a Netscape cookies.txt export or a single
+// "name=value; name2=value2" Cookie header line.
+func readCookieFile(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := make([][2]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || (strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "#HttpOnly_")) {
+			continue
+		}
+		if fields := strings.Split(line, "\t"); len(fields) >= 7 {
+			domain := strings.TrimPrefix(fields[0], "#HttpOnly_")
+			if strings.HasSuffix(domain, "x.com") || strings.HasSuffix(domain, "twitter.com") {
+				entries = append(entries, [2]string{fields[5], fields[6]})
+			}
+			continue
+		}
+		for _, pair := range strings.Split(line, ";") {
+			name, value, ok := strings.Cut(pair, "=")
+			if ok {
+				entries = append(entries, [2]string{name, value})
+			}
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// graphQLFeatures is the feature switch set sent with every GraphQL request.
+var graphQLFeatures = map[string]any{
+	"responsive_web_graphql_exclude_directive_enabled":                  true,
+	"responsive_web_graphql_timeline_navigation_enabled":                true,
+	"responsive_web_graphql_skip_user_profile_image_extensions_enabled": false,
+	"longform_notetweets_consumption_enabled":                           true,
+	"responsive_web_media_download_video_enabled":                       true,
+	"responsive_web_enhance_cards_enabled":                              false,
+}
+
+// graphQLGet performs an authenticated GET against one GraphQL operation and returns the body.
+// A 429 is reported as *rateLimitedError so callers can back off.
+func (s *xAuthSession) graphQLGet(ctx context.Context, client *http.Client, queryID, operation string, variables []byte) ([]byte, error) {
+	features, _ := json.Marshal(graphQLFeatures)
+	apiURL := fmt.Sprintf("https://x.com/i/api/graphql/%s/%s?variables=%s&features=%s",
+		url.PathEscape(queryID), operation, url.QueryEscape(string(variables)), url.QueryEscape(string(features)))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+xWebBearerToken)
+	req.Header.Set("Cookie", s.cookieHeader)
+	req.Header.Set("X-Csrf-Token", s.csrfToken)
+	req.Header.Set("X-Twitter-Auth-Type", "OAuth2Session")
+	req.Header.Set("X-Twitter-Active-User", "yes")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		err := &rateLimitedError{Status: resp.StatusCode}
+		if h := resp.Header.Get("Retry-After"); h != "" {
+			err.RetryAfter = retryAfterDelay(h, 1)
+		}
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("graphql %s status=%d", operation, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// fetchTweetMedia looks a tweet up through the authenticated GraphQL API.
+func (s *xAuthSession) fetchTweetMedia(ctx context.Context, client *http.Client, tweetID string) ([]tweetMedia, error) {
+	variables, _ := json.Marshal(map[string]any{
+		"tweetId":                tweetID,
+		"withCommunity":          false,
+		"includePromotedContent": false,
+		"withVoice":              false,
+	})
+	body, err := s.graphQLGet(ctx, client, s.queryID, "TweetResultByRestId", variables)
+	if err != nil {
+		return nil, err
+	}
+
+	type legacyTweet struct {
+		ExtendedEntities struct {
+			Media []tweetMediaDetail `json:"media"`
+		} `json:"extended_entities"`
+	}
+	var parsed struct {
+		Data struct {
+			TweetResult struct {
+				Result struct {
+					TypeName string      `json:"__typename"`
+					Legacy   legacyTweet `json:"legacy"`
+					Tweet    struct {
+						Legacy legacyTweet `json:"legacy"`
+					} `json:"tweet"`
+				} `json:"result"`
+			} `json:"tweetResult"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, err
+	}
+	result := parsed.Data.TweetResult.Result
+	if result.TypeName == "" || result.TypeName == "TweetTombstone" || result.TypeName == "TweetUnavailable" {
+		return nil, errors.New("tweet unavailable")
+	}
+	details := result.Legacy.ExtendedEntities.Media
+	if result.TypeName == "TweetWithVisibilityResults" {
+		details = result.Tweet.Legacy.ExtendedEntities.Media
+	}
+
+	seen := make(map[string]struct{})
+	media := make([]tweetMedia, 0, len(details))
+	for _, d := range details {
+		var item tweetMedia
+		switch d.Type {
+		case "photo":
+			if d.MediaURLHTTPS == "" {
+				continue
+			}
+			item = tweetMedia{URL: d.MediaURLHTTPS + "?name=orig", Type: mediaTypeImage}
+		case "animated_gif":
+			best := d.bestMP4Variant()
+			if best == "" {
+				continue
+			}
+			item = tweetMedia{URL: best, Type: mediaTypeAnimatedGIF}
+		default:
+			continue
+		}
+		if _, ok := seen[item.URL]; ok {
+			continue
+		}
+		seen[item.URL] = struct{}{}
+		media = append(media, item)
+	}
+	return media, nil
+}
+
+// lookupUserID resolves a screen name to the numeric user id UserMedia pages by.
+func (s *xAuthSession) lookupUserID(ctx context.Context, client *http.Client, username string) (string, error) {
+	key := strings.ToLower(username)
+	if id, ok := s.userIDs.Load(key); ok {
+		return id.(string), nil
+	}
+	variables, _ := json.Marshal(map[string]any{
+		"screen_name":              username,
+		"withSafetyModeUserFields": true,
+	})
+	body, err := s.graphQLGet(ctx, client, s.userQueryID, "UserByScreenName", variables)
+	if err != nil {
+		return "", err
+	}
+	var parsed struct {
+		Data struct {
+			User struct {
+				Result struct {
+					TypeName string `json:"__typename"`
+					RestID   string `json:"rest_id"`
+				} `json:"result"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", err
+	}
+	id := parsed.Data.User.Result.RestID
+	if id == "" || parsed.Data.User.Result.TypeName == "UserUnavailable" {
+		return "", fmt.Errorf("user %s not found", username)
+	}
+	s.userIDs.Store(key, id)
+	return id, nil
+}
+
+// graphQLTweetResult is the tweet_results.result shape inside timeline entries.
+type graphQLTweetResult struct {
+	TypeName string `json:"__typename"`
+	RestID   string `json:"rest_id"`
+	Legacy   struct {
+		ExtendedEntities struct {
+			Media []json.RawMessage `json:"media"`
+		} `json:"extended_entities"`
+	} `json:"legacy"`
+	Tweet *graphQLTweetResult `json:"tweet"`
+}
+
+type graphQLTimelineItem struct {
+	ItemContent struct {
+		TweetResults struct {
+			Result graphQLTweetResult `json:"result"`
+		} `json:"tweet_results"`
+	} `json:"itemContent"`
+}
+
+type graphQLModuleItem struct {
+	Item graphQLTimelineItem `json:"item"`
+}
+
+// fetchUserMediaPage fetches one page of the user's media tab. The first page (empty cursor)
+// carries its tweets in a grid module; later pages append to that module. The bottom cursor
+// is returned as NextCursor and is empty once X stops returning one.
+func (s *xAuthSession) fetchUserMediaPage(ctx context.Context, client *http.Client, username, cursor string) (timelineMediaPage, error) {
+	userID, err := s.lookupUserID(ctx, client, username)
+	if err != nil {
+		return timelineMediaPage{}, err
+	}
+	vars := map[string]any{
+		"userId":                 userID,
+		"count":                  100,
+		"includePromotedContent": false,
+		"withClientEventToken":   false,
+		"withBirdwatchNotes":     false,
+		"withVoice":              true,
+		"withV2Timeline":         true,
+	}
+	if cursor != "" {
+		vars["cursor"] = cursor
+	}
+	variables, _ := json.Marshal(vars)
+	body, err := s.graphQLGet(ctx, client, s.userMediaQueryID, "UserMedia", variables)
+	if err != nil {
+		return timelineMediaPage{}, err
+	}
+
+	type instructions struct {
+		Instructions []struct {
+			Type    string `json:"type"`
+			Entries []struct {
+				EntryID string `json:"entryId"`
+				Content struct {
+					CursorType string              `json:"cursorType"`
+					Value      string              `json:"value"`
+					Items      []graphQLModuleItem `json:"items"`
+					graphQLTimelineItem
+				} `json:"content"`
+			} `json:"entries"`
+			ModuleItems []graphQLModuleItem `json:"moduleItems"`
+		} `json:"instructions"`
+	}
+	var parsed struct {
+		Data struct {
+			User struct {
+				Result struct {
+					TimelineV2 struct {
+						Timeline instructions `json:"timeline"`
+					} `json:"timeline_v2"`
+					Timeline struct {
+						Timeline instructions `json:"timeline"`
+					} `json:"timeline"`
+				} `json:"result"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return timelineMediaPage{}, err
+	}
+	timeline := parsed.Data.User.Result.TimelineV2.Timeline
+	if len(timeline.Instructions) == 0 {
+		timeline = parsed.Data.User.Result.Timeline.Timeline
+	}
+
+	page := timelineMediaPage{TweetURLs: make([]string, 0)}
+	seen := make(map[string]struct{})
+	add := func(r graphQLTweetResult) {
+		if r.TypeName == "TweetWithVisibilityResults" && r.Tweet != nil {
+			r = *r.Tweet
+		}
+		if r.RestID == "" || len(r.Legacy.ExtendedEntities.Media) == 0 {
+			return
+		}
+		if _, ok := seen[r.RestID]; ok {
+			return
+		}
+		seen[r.RestID] = struct{}{}
+		page.TweetURLs = append(page.TweetURLs, fmt.Sprintf("https://x.com/%s/status/%s", username, r.RestID))
+	}
+	for _, ins := range timeline.Instructions {
+		for _, entry := range ins.Entries {
+			if entry.Content.CursorType == "Bottom" || strings.HasPrefix(entry.EntryID, "cursor-bottom-") {
+				page.NextCursor = entry.Content.Value
+				continue
+			}
+			for _, it := range entry.Content.Items {
+				add(it.Item.ItemContent.TweetResults.Result)
+			}
+			add(entry.Content.ItemContent.TweetResults.Result)
+		}
+		for _, it := range ins.ModuleItems {
+			add(it.Item.ItemContent.TweetResults.Result)
+		}
+	}
+	return page, nil
+}
@@ -3,15 +3,21 @@ import { Image } from "../utils/types.ts";
 interface ImageGridProps {
   images: Image[];
   onImageClick?: (image: Image, index: number) => void;
+  thumbnailSize?: number;
 }
 
-export default function ImageGrid({ images, onImageClick }: ImageGridProps) {
+export default function ImageGrid(
+  { images, onImageClick, thumbnailSize }: ImageGridProps,
+) {
   if (images.length === 0) {
     return <p class="placeholder">No images found for this query.</p>;
   }
 
   return (
-    <div class="image-grid">
+    <div
+      class="image-grid"
+      style={thumbnailSize ? `--thumb-size: ${thumbnailSize}px` : undefined}
+    >
       {images.map((image, index) => (
         <button
           type="button"
@@ -19,11 +25,23 @@ export default function ImageGrid({ images, onImageClick }: ImageGridProps) {
           class="img-container"
           onClick={() => onImageClick && onImageClick(image, index)}
         >
-          <img
-            src={`/images/${image.path}`}
-            alt="media"
-            loading="lazy"
-          />
+          {image.media_type === "animated_gif" && image.path.endsWith(".mp4")
+            ? (
+              <video
+                src={`/images/${image.path}`}
+                autoplay
+                loop
+                muted
+                playsInline
+              />
+            )
+            : (
+              <img
+                src={`/images/${image.path}`}
+                alt="media"
+                loading="lazy"
+              />
+            )}
           <div class="tags-overlay">
             {image.tags?.map((tag) => tag.tag).join(", ") || "No Tags"}
           </div>
@@ -6,19 +6,42 @@ import * as $_404 from "./routes/_404.tsx";
 import * as $_app from "./routes/_app.tsx";
 import * as $api_autotag_slug_ from "./routes/api/autotag/[...slug].ts";
 import * as $api_download from "./routes/api/download.ts";
+import * as $api_download_retry from "./routes/api/download/retry.ts";
+import * as $api_download_stream from "./routes/api/download/stream.ts";
+import * as $api_graphql from "./routes/api/graphql.ts";
 import * as $api_images from "./routes/api/images.ts";
 import * as $api_images_bulk_delete from "./routes/api/images/bulk-delete.ts";
+import * as $api_images_copy_tags from "./routes/api/images/copy-tags.ts";
+import * as $api_images_rating from "./routes/api/images/rating.ts";
 import * as $api_images_retag_bulk from "./routes/api/images/retag-bulk.ts";
 import * as $api_images_retag from "./routes/api/images/retag.ts";
+import * as $api_images_tags from "./routes/api/images/tags.ts";
+import * as $api_images_upscale from "./routes/api/images/upscale.ts";
+import * as $api_images_view from "./routes/api/images/view.ts";
+import * as $api_settings from "./routes/api/settings.ts";
+import * as $api_shares from "./routes/api/shares.ts";
+import * as $api_stats_heatmap from "./routes/api/stats/heatmap.ts";
+import * as $api_stats_popular from "./routes/api/stats/popular.ts";
 import * as $api_tags from "./routes/api/tags.ts";
+import * as $api_tags_aliases from "./routes/api/tags/aliases.ts";
+import * as $api_tags_aliases_alias_ from "./routes/api/tags/aliases/[alias].ts";
+import * as $api_tags_categories from "./routes/api/tags/categories.ts";
+import * as $api_tags_categories_name_ from "./routes/api/tags/categories/[name].ts";
+import * as $api_tasks_id_ from "./routes/api/tasks/[id].ts";
 import * as $api_tasks_status from "./routes/api/tasks/status.ts";
+import * as $api_timeline from "./routes/api/timeline.ts";
+import * as $api_timeline_on_this_day from "./routes/api/timeline/on-this-day.ts";
 import * as $api_users from "./routes/api/users.ts";
+import * as $api_users_username_feed_atom from "./routes/api/users/[username]/feed.atom.ts";
 import * as $api_users_username_tweets from "./routes/api/users/[username]/tweets.ts";
+import * as $api_ws_index from "./routes/api/ws/index.ts";
 import * as $api_ws_status from "./routes/api/ws/status.ts";
 import * as $autotag_status from "./routes/autotag-status.tsx";
 import * as $download_status from "./routes/download-status.tsx";
 import * as $images_filepath_ from "./routes/images/[...filepath].ts";
 import * as $index from "./routes/index.tsx";
+import * as $share_token_ from "./routes/share/[token].tsx";
+import * as $share_token_media_filepath_ from "./routes/share/[token]/media/[...filepath].ts";
 import * as $tags from "./routes/tags.tsx";
 import * as $tags_tag_ from "./routes/tags/[tag].tsx";
 import * as $users from "./routes/users.tsx";
@@ -41,19 +64,42 @@ const manifest = {
     "./routes/_app.tsx": $_app,
     "./routes/api/autotag/[...slug].ts": $api_autotag_slug_,
     "./routes/api/download.ts": $api_download,
+    "./routes/api/download/retry.ts": $api_download_retry,
+    "./routes/api/download/stream.ts": $api_download_stream,
+    "./routes/api/graphql.ts": $api_graphql,
     "./routes/api/images.ts": $api_images,
     "./routes/api/images/bulk-delete.ts": $api_images_bulk_delete,
+    "./routes/api/images/copy-tags.ts": $api_images_copy_tags,
+    "./routes/api/images/rating.ts": $api_images_rating,
     "./routes/api/images/retag-bulk.ts": $api_images_retag_bulk,
     "./routes/api/images/retag.ts": $api_images_retag,
+    "./routes/api/images/tags.ts": $api_images_tags,
+    "./routes/api/images/upscale.ts": $api_images_upscale,
+    "./routes/api/images/view.ts": $api_images_view,
+    "./routes/api/settings.ts": $api_settings,
+    "./routes/api/shares.ts": $api_shares,
+    "./routes/api/stats/heatmap.ts": $api_stats_heatmap,
+    "./routes/api/stats/popular.ts": $api_stats_popular,
     "./routes/api/tags.ts": $api_tags,
+    "./routes/api/tags/aliases.ts": $api_tags_aliases,
+    "./routes/api/tags/aliases/[alias].ts": $api_tags_aliases_alias_,
+    "./routes/api/tags/categories.ts": $api_tags_categories,
+    "./routes/api/tags/categories/[name].ts": $api_tags_categories_name_,
+    "./routes/api/tasks/[id].ts": $api_tasks_id_,
     "./routes/api/tasks/status.ts": $api_tasks_status,
+    "./routes/api/timeline.ts": $api_timeline,
+    "./routes/api/timeline/on-this-day.ts": $api_timeline_on_this_day,
     "./routes/api/users.ts": $api_users,
+    "./routes/api/users/[username]/feed.atom.ts": $api_users_username_feed_atom,
     "./routes/api/users/[username]/tweets.ts": $api_users_username_tweets,
+    "./routes/api/ws/index.ts": $api_ws_index,
     "./routes/api/ws/status.ts": $api_ws_status,
     "./routes/autotag-status.tsx": $autotag_status,
     "./routes/download-status.tsx": $download_status,
     "./routes/images/[...filepath].ts": $images_filepath_,
     "./routes/index.tsx": $index,
+    "./routes/share/[token].tsx": $share_token_,
+    "./routes/share/[token]/media/[...filepath].ts": $share_token_media_filepath_,
     "./routes/tags.tsx": $tags,
     "./routes/tags/[tag].tsx": $tags_tag_,
     "./routes/users.tsx": $users,
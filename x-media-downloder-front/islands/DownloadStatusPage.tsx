@@ -6,12 +6,16 @@ import { DownloadStatus, LiveStatusPayload, subscribeStatus } from "../utils/sta
 interface DownloadTaskStatus {
   task_id: string;
   url: string | null;
-  state: "PENDING" | "PROGRESS" | "SUCCESS" | "FAILURE";
+  state: "PENDING" | "PROGRESS" | "SUCCESS" | "FAILURE" | "CANCELLED";
   message: string;
   current?: number;
   total?: number;
   downloaded_count?: number;
   skipped_count?: number;
+  retry_count?: number;
+  max_retry?: number;
+  retry_of?: string;
+  retried_as?: string;
 }
 
 type DownloadStatusResponse = DownloadStatus;
@@ -20,6 +24,51 @@ export default function DownloadStatusPage() {
   const [status, setStatus] = useState<DownloadStatusResponse | null>(null);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
+  const [cancelling, setCancelling] = useState<string | null>(null);
+  const [retrying, setRetrying] = useState<string | null>(null);
+
+  const cancelTask = async (taskId: string) => {
+    if (!confirm("Cancel this download task?")) return;
+    setCancelling(taskId);
+    setError(null);
+    try {
+      const res = await fetch(`/api/tasks/${encodeURIComponent(taskId)}`, {
+        method: "DELETE",
+      });
+      if (!res.ok) {
+        const data = await res.json().catch(() => ({}));
+        throw new Error(data.error || `HTTP error! status: ${res.status}`);
+      }
+    } catch (err) {
+      setError(err instanceof Error ? err.message : String(err));
+    } finally {
+      setCancelling(null);
+    }
+  };
+
+  // Requeues one failed task, or every recent failure when taskId is omitted.
+  const retryTasks = async (taskId?: string) => {
+    setRetrying(taskId ?? "all");
+    setError(null);
+    try {
+      const res = await fetch("/api/download/retry", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(taskId ? { task_ids: [taskId] } : {}),
+      });
+      const data = await res.json().catch(() => ({}));
+      if (!res.ok) {
+        throw new Error(data.error || `HTTP error! status: ${res.status}`);
+      }
+      if (taskId && (data.requeued?.length ?? 0) === 0) {
+        throw new Error(data.skipped?.[0]?.reason || "Task was not requeued");
+      }
+    } catch (err) {
+      setError(err instanceof Error ? err.message : String(err));
+    } finally {
+      setRetrying(null);
+    }
+  };
 
   useEffect(() => {
     if (!IS_BROWSER) return;
@@ -40,6 +89,16 @@ export default function DownloadStatusPage() {
         <div class="status-head">
           <h2 class="page-title">Asynq Download Status</h2>
           <span class="info-text">Live via WebSocket</span>
+          {(status?.summary?.failure ?? 0) > 0 && (
+            <button
+              type="button"
+              class="header-btn"
+              disabled={retrying !== null}
+              onClick={() => retryTasks()}
+            >
+              {retrying === "all" ? "Retrying..." : "Retry failed"}
+            </button>
+          )}
         </div>
 
         {loading && <p>Loading status...</p>}
@@ -77,9 +136,50 @@ export default function DownloadStatusPage() {
                           {item.state}
                         </span>
                         <code class="task-id">{item.task_id}</code>
+                        {(item.state === "PENDING" ||
+                          item.state === "PROGRESS") && (
+                          <button
+                            type="button"
+                            class="header-btn task-cancel"
+                            disabled={cancelling === item.task_id}
+                            onClick={() => cancelTask(item.task_id)}
+                          >
+                            {cancelling === item.task_id
+                              ? "Cancelling..."
+                              : "Cancel"}
+                          </button>
+                        )}
+                        {item.state === "FAILURE" && !item.retried_as && (
+                          <button
+                            type="button"
+                            class="header-btn task-cancel"
+                            disabled={retrying !== null}
+                            onClick={() => retryTasks(item.task_id)}
+                          >
+                            {retrying === item.task_id ? "Retrying..." : "Retry"}
+                          </button>
+                        )}
                       </div>
                       <p class="task-url">{item.url || "Unknown URL"}</p>
                       <p class="task-message">{item.message}</p>
+                      {item.retry_of && (
+                        <p class="task-counts">
+                          retry of <code>{item.retry_of}</code>
+                        </p>
+                      )}
+                      {item.retried_as && (
+                        <p class="task-counts">
+                          retried as <code>{item.retried_as}</code>
+                        </p>
+                      )}
+                      {item.retry_count !== undefined && (
+                        <p class="task-counts">
+                          retries: {item.retry_count}
+                          {item.max_retry !== undefined
+                            ? ` / ${item.max_retry}`
+                            : ""}
+                        </p>
+                      )}
                       {(item.current !== undefined &&
                         item.total !== undefined) && (
                         <p class="task-counts">
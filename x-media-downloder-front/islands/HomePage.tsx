@@ -16,6 +16,11 @@ export interface HomePageProps {
   images: Image[];
   currentPage: number;
   totalPages: number;
+  sort: string;
+  perPage: number;
+  query: string; // Extra search query, e.g. to hide NSFW images
+  thumbnailSize: number;
+  seed: string; // Fixes the order of sort=random across pages
 }
 
 export default function HomePage(props: HomePageProps) {
@@ -23,6 +28,11 @@ export default function HomePage(props: HomePageProps) {
     images: initialImages,
     currentPage: initialCurrentPage,
     totalPages: initialTotalPages,
+    sort,
+    perPage,
+    query,
+    thumbnailSize,
+    seed,
   } = props;
 
   const [images, setImages] = useState<Image[]>(initialImages || []);
@@ -44,9 +54,14 @@ export default function HomePage(props: HomePageProps) {
     if (currentPage !== initialCurrentPage) {
       setLoading(true);
       setError(null);
-      fetch(
-        `${API_BASE_URL}/api/images?sort=latest&page=${currentPage}&per_page=100`,
-      )
+      const params = new URLSearchParams({
+        sort,
+        page: String(currentPage),
+        per_page: String(perPage),
+      });
+      if (query) params.set("q", query);
+      if (seed) params.set("seed", seed);
+      fetch(`${API_BASE_URL}/api/images?${params.toString()}`)
         .then((res) => {
           if (!res.ok) throw new Error(`HTTP error! status: ${res.status}`);
           return res.json();
@@ -62,7 +77,9 @@ export default function HomePage(props: HomePageProps) {
 
   const handlePageChange = (page: number) => {
     setCurrentPage(page);
-    globalThis.history.pushState({}, "", `/?page=${page}`);
+    const params = new URLSearchParams({ page: String(page) });
+    if (seed) params.set("seed", seed);
+    globalThis.history.pushState({}, "", `/?${params.toString()}`);
   };
 
   const handleImageClick = (image: Image, index: number) => {
@@ -83,7 +100,11 @@ export default function HomePage(props: HomePageProps) {
           <p class="info-text">No images found. Start by downloading some!</p>
         )}
 
-        <ImageGrid images={images} onImageClick={handleImageClick} />
+        <ImageGrid
+          images={images}
+          onImageClick={handleImageClick}
+          thumbnailSize={thumbnailSize}
+        />
 
         <Pagination
           currentPage={currentPage}
@@ -37,7 +37,7 @@ export default function ImageModal({
       const res = await fetch(`${API_BASE_URL}/api/tasks/status?id=${encodeURIComponent(taskId)}`);
       const data = await res.json();
       if (data.state === "SUCCESS") return data;
-      if (data.state === "FAILURE") throw new Error(data.message || "Task failed");
+      if (data.state === "FAILURE" || data.state === "CANCELLED") throw new Error(data.message || "Task failed");
       await new Promise((resolve) => setTimeout(resolve, 500));
     }
     throw new Error("Task timeout");
@@ -55,6 +55,16 @@ export default function ImageModal({
     setRetagStatus(null);
   }, [initialImage, allImages]);
 
+  // Count a view for the popularity sort; failures only cost one count.
+  useEffect(() => {
+    if (!IS_BROWSER || !isOpen || !currentImage) return;
+    fetch(`${API_BASE_URL}/api/images/view`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ filepath: currentImage.path }),
+    }).catch(() => {});
+  }, [isOpen, currentImage?.path]);
+
   const changeImage = (direction: -1 | 1) => {
     if (!allImages || allImages.length === 0) return;
 
@@ -127,6 +137,58 @@ export default function ImageModal({
     }
   };
 
+  // Sends favorite and/or rating; clicking the current star count clears the rating.
+  const handleRate = async (change: { favorite?: boolean; rating?: number }) => {
+    if (!IS_BROWSER || !currentImage) return;
+    try {
+      const res = await fetch(`${API_BASE_URL}/api/images/rating`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ filepath: currentImage.path, ...change }),
+      });
+      const data = await res.json();
+      if (!res.ok || !data.success) {
+        throw new Error(data.error || "Failed to save rating");
+      }
+      const updatedImage = {
+        ...currentImage,
+        favorite: data.item.favorite,
+        rating: data.item.rating,
+      };
+      setCurrentImage(updatedImage);
+      onImageUpdate(updatedImage, currentIndex);
+    } catch (error) {
+      console.error("Rating error:", error);
+      setRetagStatus(`Error: ${error.message}`);
+    }
+  };
+
+  // Creates an expiring public link to the image and copies it to the clipboard.
+  const handleShare = async () => {
+    if (!IS_BROWSER || !currentImage) return;
+    try {
+      const res = await fetch(`${API_BASE_URL}/api/shares`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ kind: "image", target: currentImage.path }),
+      });
+      const data = await res.json();
+      if (!res.ok || !data.success) {
+        throw new Error(data.error || "Failed to create share link");
+      }
+      const expires = new Date(data.item.expires_at).toLocaleString();
+      try {
+        await navigator.clipboard.writeText(data.item.url);
+        setRetagStatus(`Share link copied (expires ${expires}).`);
+      } catch {
+        setRetagStatus(`Share link: ${data.item.url} (expires ${expires})`);
+      }
+    } catch (error) {
+      console.error("Share error:", error);
+      setRetagStatus(`Error: ${error.message}`);
+    }
+  };
+
   // Keyboard navigation
   useEffect(() => {
     if (!IS_BROWSER || !isOpen) return;
@@ -165,11 +227,25 @@ export default function ImageModal({
           &#10094;
         </button>
 
-        <img
-          src={`/images/${currentImage.path}`}
-          alt="Full size media"
-          onClick={() => changeImage(1)} // Click on image to go next
-        />
+        {currentImage.media_type === "animated_gif" &&
+            currentImage.path.endsWith(".mp4")
+          ? (
+            <video
+              src={`/images/${currentImage.path}`}
+              autoplay
+              loop
+              muted
+              playsInline
+              onClick={() => changeImage(1)}
+            />
+          )
+          : (
+            <img
+              src={`/images/${currentImage.path}`}
+              alt="Full size media"
+              onClick={() => changeImage(1)} // Click on image to go next
+            />
+          )}
 
         <button
           type="button"
@@ -180,11 +256,44 @@ export default function ImageModal({
         </button>
 
         <div class="modal-tags">
+          {currentImage.caption && <p class="modal-caption">{currentImage.caption}</p>}
           <p>
             Tags: {currentImage.tags?.map((tag) => tag.tag).join(", ") ||
               "No tags yet."}
           </p>
           <div class="modal-actions">
+            <button
+              type="button"
+              onClick={() => handleRate({ favorite: !currentImage.favorite })}
+              class="btn modal-action-btn"
+              title={currentImage.favorite ? "Remove from favorites" : "Add to favorites"}
+            >
+              {currentImage.favorite ? "\u2665 Favorite" : "\u2661 Favorite"}
+            </button>
+            <span class="modal-rating">
+              {[1, 2, 3, 4, 5].map((star) => (
+                <button
+                  key={star}
+                  type="button"
+                  onClick={() =>
+                    handleRate({
+                      rating: currentImage.rating === star ? 0 : star,
+                    })}
+                  class="modal-rating-star"
+                  title={`${star} star${star > 1 ? "s" : ""}`}
+                >
+                  {(currentImage.rating || 0) >= star ? "\u2605" : "\u2606"}
+                </button>
+              ))}
+            </span>
+            <button
+              type="button"
+              onClick={handleShare}
+              class="btn modal-action-btn"
+              title="Copy an expiring public link"
+            >
+              Share
+            </button>
             {currentImage.tags?.length === 0 && (
               <button
                 type="button"
@@ -18,6 +18,9 @@ interface TagImagesProps {
   images: Image[];
   currentPage: number;
   totalPages: number;
+  perPage: number;
+  query: string; // Extra search query, e.g. to hide NSFW images
+  thumbnailSize: number;
 }
 
 interface TagImageFilters {
@@ -46,6 +49,9 @@ export default function TagImagesPage(props: TagImagesProps) {
     images: initialImages,
     currentPage: initialCurrentPage,
     totalPages: initialTotalPages,
+    perPage,
+    query,
+    thumbnailSize,
   } = props;
 
   const [images, setImages] = useState<Image[]>(initialImages || []);
@@ -80,7 +86,8 @@ export default function TagImagesPage(props: TagImagesProps) {
     const params = new URLSearchParams();
     params.set("tags", tag);
     params.set("page", String(page));
-    params.set("per_page", "100");
+    params.set("per_page", String(perPage));
+    if (query) params.set("q", query);
     const min = toNonNegativeInt(filters.minTagCount);
     const max = toNonNegativeInt(filters.maxTagCount);
     if (min !== "") params.set("min_tag_count", min);
@@ -163,7 +170,7 @@ export default function TagImagesPage(props: TagImagesProps) {
       const res = await fetch(`${API_BASE_URL}/api/tasks/status?id=${encodeURIComponent(taskId)}`);
       const data = await res.json();
       if (data.state === "SUCCESS") return;
-      if (data.state === "FAILURE") throw new Error(data.message || "Delete task failed");
+      if (data.state === "FAILURE" || data.state === "CANCELLED") throw new Error(data.message || "Delete task failed");
       await new Promise((resolve) => setTimeout(resolve, 500));
     }
     throw new Error("Delete task timeout");
@@ -353,7 +360,11 @@ export default function TagImagesPage(props: TagImagesProps) {
           <p class="info-text">No images found for this tag.</p>
         )}
 
-        <ImageGrid images={images} onImageClick={handleImageClick} />
+        <ImageGrid
+          images={images}
+          onImageClick={handleImageClick}
+          thumbnailSize={thumbnailSize}
+        />
 
         <Pagination
           currentPage={currentPage}
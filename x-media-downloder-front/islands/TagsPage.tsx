@@ -304,7 +304,11 @@ export default function TagsPage(props: TagsProps) {
 
         <div class="tag-chip-list">
           {tags && tags.map((tag) => (
-            <div key={tag.tag} class="tag-chip">
+            <div
+              key={tag.tag}
+              class="tag-chip"
+              style={tag.color ? { borderColor: tag.color } : undefined}
+            >
               <a href={`/tags/${encodeURIComponent(tag.tag)}`}>
                 {tag.tag} ({tag.count})
               </a>
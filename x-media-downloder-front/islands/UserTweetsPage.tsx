@@ -72,7 +72,9 @@ export default function UserTweetsPage(props: UserTweetsProps) {
   );
 
   const API_BASE_URL = getApiBaseUrl();
-  const allImages = tweets.flatMap((tweet) => tweet.images);
+  const allImages = tweets.flatMap((tweet) =>
+    tweet.images.map((img) => tweet.text ? { ...img, caption: tweet.text } : img)
+  );
   const currentFilters = (): UserImageFilters => ({ minTagCount, maxTagCount, excludeTags });
   const hasActiveFilters = toNonNegativeInt(minTagCount) !== "" ||
     toNonNegativeInt(maxTagCount) !== "" ||
@@ -121,7 +123,7 @@ export default function UserTweetsPage(props: UserTweetsProps) {
       const res = await fetch(`${API_BASE_URL}/api/tasks/status?id=${encodeURIComponent(taskId)}`);
       const data = await res.json();
       if (data.state === "SUCCESS") return data;
-      if (data.state === "FAILURE") throw new Error(data.message || "Task failed");
+      if (data.state === "FAILURE" || data.state === "CANCELLED") throw new Error(data.message || "Task failed");
       await new Promise((resolve) => setTimeout(resolve, 500));
     }
     throw new Error("Task timeout");
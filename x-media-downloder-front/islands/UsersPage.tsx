@@ -74,7 +74,7 @@ export default function UsersPage(props: UsersProps) {
       const res = await fetch(`${API_BASE_URL}/api/tasks/status?id=${encodeURIComponent(taskId)}`);
       const data = await res.json();
       if (data.state === "SUCCESS") return data;
-      if (data.state === "FAILURE") {
+      if (data.state === "FAILURE" || data.state === "CANCELLED") {
         throw new Error(data.message || "Task failed");
       }
       await new Promise((resolve) => setTimeout(resolve, 500));
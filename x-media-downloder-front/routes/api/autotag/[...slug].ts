@@ -14,13 +14,18 @@ async function proxy(req: Request, slug: string): Promise<Response> {
     target = `${base}/api/autotag/status`;
   } else if (req.method === "GET" && slug === "retag-status") {
     target = `${base}/api/autotag/retag-status`;
+  } else if (req.method === "GET" && slug === "reconcile-status") {
+    target = `${base}/api/autotag/reconcile-status`;
   } else {
     return new Response(null, { status: 404 });
   }
 
   const upstream = await fetch(target, {
     method: req.method,
-    headers: { "Content-Type": "application/json" },
+    headers: {
+      "Content-Type": "application/json",
+      "Accept-Language": req.headers.get("Accept-Language") ?? "",
+    },
   });
   const body = await upstream.text();
   return new Response(body, {
@@ -11,7 +11,10 @@ async function proxyToQueueApi(req: Request): Promise<Response> {
 
   const response = await fetch(target, {
     method: req.method,
-    headers: { "Content-Type": "application/json" },
+    headers: {
+      "Content-Type": "application/json",
+      "Accept-Language": req.headers.get("Accept-Language") ?? "",
+    },
     body: req.method === "POST" ? await req.text() : undefined,
   });
   const body = await response.text();
@@ -0,0 +1,45 @@
+import { FreshContext } from "$fresh/server.ts";
+
+function queueApiBaseUrl(): string {
+  return Deno.env.get("ASYNQ_API_BASE_URL") || "http://queue-api:8001";
+}
+
+export const handler = async (
+  req: Request,
+  _ctx: FreshContext,
+): Promise<Response> => {
+  if (req.method !== "GET") {
+    return new Response(null, { status: 405 });
+  }
+
+  try {
+    const url = new URL(req.url);
+    const upstream = await fetch(
+      `${queueApiBaseUrl()}/api/download/stream${url.search}`,
+      {
+        signal: req.signal,
+        headers: { "Accept-Language": req.headers.get("Accept-Language") ?? "" },
+      },
+    );
+    if (!upstream.ok || !upstream.body) {
+      return new Response(await upstream.text(), {
+        status: upstream.status,
+        headers: { "Content-Type": "application/json" },
+      });
+    }
+    return new Response(upstream.body, {
+      status: upstream.status,
+      headers: {
+        "Content-Type": "text/event-stream",
+        "Cache-Control": "no-cache",
+        "X-Accel-Buffering": "no",
+      },
+    });
+  } catch (error) {
+    console.error("Failed to proxy /api/download/stream:", error);
+    return new Response(JSON.stringify({ error: "Internal Server Error" }), {
+      status: 500,
+      headers: { "Content-Type": "application/json" },
+    });
+  }
+};
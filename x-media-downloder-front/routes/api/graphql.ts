@@ -0,0 +1,37 @@
+import { FreshContext } from "$fresh/server.ts";
+
+function queueApiBaseUrl(): string {
+  return Deno.env.get("ASYNQ_API_BASE_URL") || "http://queue-api:8001";
+}
+
+export const handler = async (
+  req: Request,
+  _ctx: FreshContext,
+): Promise<Response> => {
+  if (req.method !== "GET" && req.method !== "POST") {
+    return new Response(null, { status: 405 });
+  }
+
+  try {
+    const search = new URL(req.url).search;
+    const upstream = await fetch(`${queueApiBaseUrl()}/api/graphql${search}`, {
+      method: req.method,
+      headers: { "Content-Type": "application/json" },
+      body: req.method === "POST" ? await req.text() : undefined,
+    });
+    const body = await upstream.text();
+    return new Response(body, {
+      status: upstream.status,
+      headers: { "Content-Type": "application/json" },
+    });
+  } catch (error) {
+    console.error("Error proxying GraphQL API:", error);
+    return new Response(
+      JSON.stringify({ errors: [{ message: "Internal Server Error" }] }),
+      {
+        status: 500,
+        headers: { "Content-Type": "application/json" },
+      },
+    );
+  }
+};
@@ -15,7 +15,10 @@ export const handler = async (
   try {
     const upstream = await fetch(`${queueApiBaseUrl()}/api/images/bulk-delete`, {
       method: "POST",
-      headers: { "Content-Type": "application/json" },
+      headers: {
+        "Content-Type": "application/json",
+        "Accept-Language": req.headers.get("Accept-Language") ?? "",
+      },
       body: await req.text(),
     });
     const body = await upstream.text();
@@ -0,0 +1,40 @@
+import { FreshContext } from "$fresh/server.ts";
+
+function queueApiBaseUrl(): string {
+  return Deno.env.get("ASYNQ_API_BASE_URL") || "http://queue-api:8001";
+}
+
+export const handler = async (
+  req: Request,
+  _ctx: FreshContext,
+): Promise<Response> => {
+  if (req.method !== "GET" && req.method !== "POST") {
+    return new Response(null, { status: 405 });
+  }
+
+  try {
+    const url = new URL(req.url);
+    // Share URLs must point at the public host, not the internal API address.
+    const upstream = await fetch(`${queueApiBaseUrl()}/api/shares`, {
+      method: req.method,
+      headers: {
+        "Content-Type": "application/json",
+        "X-Forwarded-Host": req.headers.get("x-forwarded-host") || url.host,
+        "X-Forwarded-Proto": req.headers.get("x-forwarded-proto") ||
+          url.protocol.replace(/:$/, ""),
+      },
+      body: req.method === "POST" ? await req.text() : undefined,
+    });
+    const body = await upstream.text();
+    return new Response(body, {
+      status: upstream.status,
+      headers: { "Content-Type": "application/json" },
+    });
+  } catch (error) {
+    console.error("Error proxying shares API:", error);
+    return new Response(JSON.stringify({ error: "Internal Server Error" }), {
+      status: 500,
+      headers: { "Content-Type": "application/json" },
+    });
+  }
+};
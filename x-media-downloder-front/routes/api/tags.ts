@@ -12,7 +12,10 @@ export const handler = async (req: Request, _ctx: FreshContext): Promise<Respons
     const url = new URL(req.url);
     const upstream = await fetch(`${queueApiBaseUrl()}/api/tags${url.search}`, {
       method: req.method,
-      headers: { "Content-Type": "application/json" },
+      headers: {
+        "Content-Type": "application/json",
+        "Accept-Language": req.headers.get("Accept-Language") ?? "",
+      },
       body: req.method === "DELETE" ? await req.text() : undefined,
     });
     const body = await upstream.text();
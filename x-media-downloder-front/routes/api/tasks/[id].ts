@@ -0,0 +1,33 @@
+import { FreshContext } from "$fresh/server.ts";
+
+function queueApiBaseUrl(): string {
+  return Deno.env.get("ASYNQ_API_BASE_URL") || "http://queue-api:8001";
+}
+
+export const handler = async (
+  req: Request,
+  ctx: FreshContext<unknown, { id: string }>,
+): Promise<Response> => {
+  if (req.method !== "DELETE") {
+    return new Response(null, { status: 405 });
+  }
+
+  try {
+    const target = `${queueApiBaseUrl()}/api/tasks/${encodeURIComponent(ctx.params.id)}`;
+    const upstream = await fetch(target, {
+      method: "DELETE",
+      headers: { "Accept-Language": req.headers.get("Accept-Language") ?? "" },
+    });
+    const body = await upstream.text();
+    return new Response(body, {
+      status: upstream.status,
+      headers: { "Content-Type": "application/json" },
+    });
+  } catch (error) {
+    console.error("Error proxying task cancel API:", error);
+    return new Response(JSON.stringify({ error: "Internal Server Error" }), {
+      status: 500,
+      headers: { "Content-Type": "application/json" },
+    });
+  }
+};
@@ -17,7 +17,10 @@ export const handler = async (
     const target = `${queueApiBaseUrl()}/api/tasks/status${url.search}`;
     const upstream = await fetch(target, {
       method: "GET",
-      headers: { "Content-Type": "application/json" },
+      headers: {
+        "Content-Type": "application/json",
+        "Accept-Language": req.headers.get("Accept-Language") ?? "",
+      },
     });
     const body = await upstream.text();
     return new Response(body, {
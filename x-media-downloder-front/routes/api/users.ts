@@ -17,7 +17,10 @@ export const handler = async (
     const target = `${queueApiBaseUrl()}/api/users${url.search}`;
     const upstream = await fetch(target, {
       method: req.method,
-      headers: { "Content-Type": "application/json" },
+      headers: {
+        "Content-Type": "application/json",
+        "Accept-Language": req.headers.get("Accept-Language") ?? "",
+      },
       body: req.method === "DELETE" ? await req.text() : undefined,
     });
     const body = await upstream.text();
@@ -0,0 +1,42 @@
+import { FreshContext } from "$fresh/server.ts";
+
+function queueApiBaseUrl(): string {
+  return Deno.env.get("ASYNQ_API_BASE_URL") || "http://queue-api:8001";
+}
+
+export const handler = async (
+  req: Request,
+  ctx: FreshContext<unknown, { username: string }>,
+): Promise<Response> => {
+  if (req.method !== "GET") {
+    return new Response(null, { status: 405 });
+  }
+
+  try {
+    const url = new URL(req.url);
+    const target = `${queueApiBaseUrl()}/api/users/${encodeURIComponent(ctx.params.username)}/feed.atom${url.search}`;
+    // Feed links must point at the public host, not the internal API address.
+    const upstream = await fetch(target, {
+      method: "GET",
+      headers: {
+        "X-Forwarded-Host": req.headers.get("x-forwarded-host") || url.host,
+        "X-Forwarded-Proto": req.headers.get("x-forwarded-proto") ||
+          url.protocol.replace(/:$/, ""),
+      },
+    });
+    const body = await upstream.text();
+    return new Response(body, {
+      status: upstream.status,
+      headers: {
+        "Content-Type": upstream.headers.get("Content-Type") ||
+          "application/atom+xml; charset=utf-8",
+      },
+    });
+  } catch (error) {
+    console.error("Error proxying user feed API:", error);
+    return new Response(JSON.stringify({ error: "Internal Server Error" }), {
+      status: 500,
+      headers: { "Content-Type": "application/json" },
+    });
+  }
+};
@@ -0,0 +1,69 @@
+import { FreshContext } from "$fresh/server.ts";
+
+function queueApiBaseUrl(): string {
+  return Deno.env.get("ASYNQ_API_BASE_URL") || "http://queue-api:8001";
+}
+
+// The relay connects upstream without an Origin header, so it has to turn away other
+// sites' pages itself; browsers don't apply the same-origin policy to WebSockets.
+function sameOrigin(req: Request): boolean {
+  const origin = req.headers.get("origin");
+  if (!origin) return true;
+  let host: string;
+  try {
+    host = new URL(origin).host.toLowerCase();
+  } catch {
+    return false;
+  }
+  const forwarded = (req.headers.get("x-forwarded-host") ?? "").split(",")[0].trim();
+  return host === new URL(req.url).host.toLowerCase() ||
+    (forwarded !== "" && host === forwarded.toLowerCase());
+}
+
+// Relays the browser socket to the queue service's /api/ws dashboard socket.
+export const handler = (req: Request, _ctx: FreshContext): Response => {
+  if (req.method !== "GET") {
+    return new Response("Method Not Allowed", { status: 405 });
+  }
+  if (!sameOrigin(req)) {
+    return new Response("WebSocket origin not allowed", { status: 403 });
+  }
+  const upgrade = req.headers.get("upgrade") ?? "";
+  if (!upgrade.toLowerCase().includes("websocket")) {
+    return new Response("WebSocket upgrade required", { status: 426 });
+  }
+
+  let socket: WebSocket;
+  let response: Response;
+  try {
+    ({ socket, response } = Deno.upgradeWebSocket(req));
+  } catch (_error) {
+    return new Response("WebSocket upgrade required", { status: 426 });
+  }
+
+  const upstreamUrl = `${queueApiBaseUrl().replace(/^http/, "ws")}/api/ws`;
+  const upstream = new WebSocket(upstreamUrl);
+  // Messages the browser sends before the upstream socket opens, e.g. the first subscribe.
+  const queued: string[] = [];
+
+  upstream.onopen = () => {
+    for (const msg of queued.splice(0)) upstream.send(msg);
+  };
+  upstream.onmessage = (event) => {
+    if (socket.readyState === WebSocket.OPEN) socket.send(event.data);
+  };
+  upstream.onclose = () => socket.close();
+  upstream.onerror = () => socket.close();
+
+  socket.onmessage = (event) => {
+    if (upstream.readyState === WebSocket.OPEN) {
+      upstream.send(event.data);
+    } else if (upstream.readyState === WebSocket.CONNECTING) {
+      queued.push(event.data);
+    }
+  };
+  socket.onclose = () => upstream.close();
+  socket.onerror = () => upstream.close();
+
+  return response;
+};
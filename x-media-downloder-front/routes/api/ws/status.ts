@@ -76,6 +76,8 @@ export const handler = (req: Request, _ctx: FreshContext): Response => {
   }
 
   let timer: number | null = null;
+  let debounce: number | null = null;
+  const upstream = new AbortController();
 
   const push = async () => {
     if (socket.readyState !== WebSocket.OPEN) return;
@@ -83,24 +85,54 @@ export const handler = (req: Request, _ctx: FreshContext): Response => {
     socket.send(JSON.stringify(payload));
   };
 
-  socket.onopen = () => {
-    push();
-    timer = setInterval(push, 2000) as unknown as number;
+  // Task state changes arrive over the queue service's SSE stream; bursts are coalesced
+  // into one push. The slower poll still covers autotag state, which is not streamed.
+  const schedulePush = () => {
+    if (debounce !== null) return;
+    debounce = setTimeout(() => {
+      debounce = null;
+      push();
+    }, 250) as unknown as number;
   };
 
-  socket.onerror = () => {
-    if (timer !== null) {
-      clearInterval(timer);
-      timer = null;
+  const followStream = async () => {
+    try {
+      const res = await fetch(`${queueApiBaseUrl()}/api/download/stream`, {
+        signal: upstream.signal,
+      });
+      if (!res.ok || !res.body) return;
+      const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+      while (true) {
+        const { value, done } = await reader.read();
+        if (done) break;
+        if (value.includes("event: task")) schedulePush();
+      }
+    } catch {
+      // Fall back to polling only.
     }
   };
 
-  socket.onclose = () => {
+  const stop = () => {
+    upstream.abort();
     if (timer !== null) {
       clearInterval(timer);
       timer = null;
     }
+    if (debounce !== null) {
+      clearTimeout(debounce);
+      debounce = null;
+    }
   };
 
+  socket.onopen = () => {
+    push();
+    timer = setInterval(push, 5000) as unknown as number;
+    followStream();
+  };
+
+  socket.onerror = stop;
+
+  socket.onclose = stop;
+
   return response;
 };
@@ -7,8 +7,47 @@ import { getMediaRoot } from "../../utils/media_root.ts";
 
 const UPLOAD_FOLDER = getMediaRoot();
 
+function queueApiBaseUrl(): string {
+  return Deno.env.get("ASYNQ_API_BASE_URL") || "http://queue-api:8001";
+}
+
+// Looks up the stored content hash so the ETag stays stable across copies and
+// restores of the same bytes. Returns null when the API is unavailable.
+// A GET also counts as a serve of the file for the popularity stats.
+async function contentHash(
+  relative: string,
+  serve: boolean,
+): Promise<string | null> {
+  try {
+    const params = new URLSearchParams({ filepath: relative });
+    if (serve) params.set("serve", "1");
+    const upstream = await fetch(
+      `${queueApiBaseUrl()}/api/images/hash?${params}`,
+      { signal: AbortSignal.timeout(2000) },
+    );
+    if (!upstream.ok) {
+      await upstream.body?.cancel();
+      return null;
+    }
+    const data = await upstream.json();
+    return typeof data.hash === "string" && data.hash ? data.hash : null;
+  } catch {
+    return null;
+  }
+}
+
+// etagMatches implements the weak comparison used by If-None-Match.
+function etagMatches(header: string | null, etag: string): boolean {
+  if (!header) return false;
+  const opaque = etag.replace(/^W\//, "");
+  return header.split(",").some((candidate) => {
+    const value = candidate.trim();
+    return value === "*" || value.replace(/^W\//, "") === opaque;
+  });
+}
+
 export const handler = async (
-  _req: Request,
+  req: Request,
   ctx: FreshContext<unknown, { filepath: string }>,
 ): Promise<Response> => {
   try {
@@ -36,32 +75,36 @@ export const handler = async (
 
     const fileStat = await Deno.stat(fullPath);
     const mtimeMs = fileStat.mtime?.getTime() ?? 0;
-    const etag = `W/\"${mtimeMs}-${fileStat.size}\"`;
-    if (_req.headers.get("if-none-match") === etag) {
-      return new Response(null, {
-        status: 304,
-        headers: {
-          ETag: etag,
-          "Cache-Control": "public, max-age=3600",
-          "Last-Modified": new Date(mtimeMs).toUTCString(),
-        },
-      });
-    }
+    const hash = await contentHash(
+      relativeToRoot.replaceAll("\\", "/"),
+      req.method === "GET",
+    );
+    const etag = hash ? `"${hash}"` : `W/"${mtimeMs}-${fileStat.size}"`;
+    const headers: Record<string, string> = {
+      ETag: etag,
+      "Cache-Control": "public, max-age=3600",
+      "Last-Modified": new Date(mtimeMs).toUTCString(),
+    };
 
-    const file = await Deno.open(fullPath, { read: true });
-    const readable = file.readable;
+    // If-Match requires a strong validator, so the mtime fallback never satisfies it.
+    const ifMatch = req.headers.get("if-match");
+    if (ifMatch && (!hash || !etagMatches(ifMatch, etag))) {
+      return new Response(null, { status: 412, headers });
+    }
+    if (etagMatches(req.headers.get("if-none-match"), etag)) {
+      return new Response(null, { status: 304, headers });
+    }
 
     const contentType = getMimeType(normalizedRelative) ||
       "application/octet-stream";
+    headers["Content-Type"] = contentType;
+    headers["Content-Length"] = String(fileStat.size);
+    if (req.method === "HEAD") {
+      return new Response(null, { headers });
+    }
 
-    return new Response(readable, {
-      headers: {
-        "Content-Type": contentType,
-        ETag: etag,
-        "Cache-Control": "public, max-age=3600",
-        "Last-Modified": new Date(mtimeMs).toUTCString(),
-      },
-    });
+    const file = await Deno.open(fullPath, { read: true });
+    return new Response(file.readable, { headers });
   } catch (error) {
     if (error instanceof Deno.errors.NotFound) {
       return new Response("Image not found", { status: 404 });
@@ -3,6 +3,7 @@
 import { PageProps, FreshContext } from "$fresh/server.ts";
 import type { Image, PagedResponse } from "../utils/types.ts";
 import { getApiBaseUrl } from "../utils/api.ts";
+import { fetchSettings, nsfwQuery } from "../utils/settings.ts";
 import HomePage from "../islands/HomePage.tsx";
 
 // Define the props for the page, which will be passed to the island
@@ -10,6 +11,11 @@ interface HomeProps {
   images: Image[];
   currentPage: number;
   totalPages: number;
+  sort: string;
+  perPage: number;
+  query: string;
+  thumbnailSize: number;
+  seed: string;
 }
 
 // The page component now simply renders the island, passing data to it.
@@ -21,12 +27,35 @@ export default function HomeRoute({ data }: PageProps<HomeProps>) {
 export const handler = async (req: Request, ctx: FreshContext): Promise<Response> => {
   const url = new URL(req.url);
   const page = parseInt(url.searchParams.get("page") || "1");
-  const per_page = parseInt(url.searchParams.get("per_page") || "100");
+  const settings = await fetchSettings();
+  const per_page = parseInt(
+    url.searchParams.get("per_page") || String(settings.default_per_page),
+  );
+  const sort = url.searchParams.get("sort") || settings.default_sort;
+  const query = nsfwQuery(settings);
+  // A random order keeps its seed in the URL so paging walks one fixed shuffle.
+  const seed = sort === "random"
+    ? url.searchParams.get("seed") || crypto.randomUUID().slice(0, 8)
+    : "";
+  const view = {
+    sort,
+    perPage: per_page,
+    query,
+    thumbnailSize: settings.thumbnail_size,
+    seed,
+  };
 
   const API_BASE_URL = getApiBaseUrl();
+  const params = new URLSearchParams({
+    sort,
+    page: String(page),
+    per_page: String(per_page),
+  });
+  if (query) params.set("q", query);
+  if (seed) params.set("seed", seed);
 
   try {
-    const res = await fetch(`${API_BASE_URL}/api/images?sort=latest&page=${page}&per_page=${per_page}`);
+    const res = await fetch(`${API_BASE_URL}/api/images?${params.toString()}`);
     if (!res.ok) {
       // Log the error and fall through to render with empty data
       console.error(`Error fetching images from API: ${res.statusText}`);
@@ -39,6 +68,7 @@ export const handler = async (req: Request, ctx: FreshContext): Promise<Response
       images: data.items || [],
       currentPage: data.current_page || 1,
       totalPages: data.total_pages || 0,
+      ...view,
     });
   } catch (error) {
     console.error("Error fetching images in handler:", error.message);
@@ -48,6 +78,7 @@ export const handler = async (req: Request, ctx: FreshContext): Promise<Response
       images: [],
       currentPage: 1,
       totalPages: 0,
+      ...view,
     });
   }
 };
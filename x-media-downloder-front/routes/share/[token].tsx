@@ -0,0 +1,119 @@
+// x-media-downloder-front/routes/share/[token].tsx
+
+import { FreshContext, PageProps, RouteConfig } from "$fresh/server.ts";
+
+function queueApiBaseUrl(): string {
+  return Deno.env.get("ASYNQ_API_BASE_URL") || "http://queue-api:8001";
+}
+
+interface SharedImage {
+  path: string;
+  media_type: string;
+  url: string;
+}
+
+interface SharePageProps {
+  title: string;
+  description?: string;
+  text?: string;
+  images: SharedImage[];
+  expiresAt: number;
+  currentPage: number;
+  totalPages: number;
+  error?: string;
+}
+
+// Shared links are opened by people outside the archive, so skip the app chrome.
+export const config: RouteConfig = { skipAppWrapper: true };
+
+export const handler = async (
+  req: Request,
+  ctx: FreshContext<unknown, SharePageProps>,
+): Promise<Response> => {
+  const url = new URL(req.url);
+  const page = parseInt(url.searchParams.get("page") || "1");
+  const empty = {
+    title: "Shared images",
+    images: [],
+    expiresAt: 0,
+    currentPage: 1,
+    totalPages: 0,
+  };
+  try {
+    const res = await fetch(
+      `${queueApiBaseUrl()}/share/${
+        encodeURIComponent(ctx.params.token)
+      }?page=${page}`,
+    );
+    const data = await res.json();
+    if (!res.ok) {
+      return ctx.render({ ...empty, error: data.error || "Link not found" }, {
+        status: res.status,
+      });
+    }
+    return ctx.render({
+      title: data.title || "Shared images",
+      description: data.description,
+      text: data.tweet?.text,
+      images: data.items || [],
+      expiresAt: data.expires_at,
+      currentPage: data.current_page || 1,
+      totalPages: data.total_pages || 0,
+    });
+  } catch (error) {
+    console.error("Error opening share link:", error);
+    return ctx.render({ ...empty, error: "Failed to load shared images" }, {
+      status: 500,
+    });
+  }
+};
+
+export default function SharePage({ data }: PageProps<SharePageProps>) {
+  return (
+    <html>
+      <head>
+        <meta charset="utf-8" />
+        <meta name="viewport" content="width=device-width, initial-scale=1.0" />
+        <title>{data.title}</title>
+        <link rel="stylesheet" href="/styles.css" />
+      </head>
+      <body>
+        <div class="page-panel">
+          <h2 class="page-title">{data.title}</h2>
+          {data.description && <p class="info-text">{data.description}</p>}
+          {data.text && <p class="modal-caption">{data.text}</p>}
+          {data.error
+            ? <p class="error-text">{data.error}</p>
+            : (
+              <>
+                <div class="image-grid">
+                  {data.images.map((img) => (
+                    <a key={img.path} href={img.url} class="img-container">
+                      {img.media_type === "animated_gif" &&
+                          img.path.endsWith(".mp4")
+                        ? <video src={img.url} muted loop playsInline />
+                        : <img src={img.url} alt={img.path} loading="lazy" />}
+                    </a>
+                  ))}
+                </div>
+                {data.totalPages > 1 && (
+                  <p class="info-text">
+                    {data.currentPage > 1 && (
+                      <a href={`?page=${data.currentPage - 1}`}>Previous</a>
+                    )}{" "}
+                    Page {data.currentPage} / {data.totalPages}{" "}
+                    {data.currentPage < data.totalPages && (
+                      <a href={`?page=${data.currentPage + 1}`}>Next</a>
+                    )}
+                  </p>
+                )}
+                <p class="muted-message">
+                  Link expires {new Date(data.expiresAt).toLocaleString()}
+                </p>
+              </>
+            )}
+        </div>
+      </body>
+    </html>
+  );
+}
@@ -0,0 +1,52 @@
+// x-media-downloder-front/routes/share/[token]/media/[...filepath].ts
+
+import { FreshContext } from "$fresh/server.ts";
+
+function queueApiBaseUrl(): string {
+  return Deno.env.get("ASYNQ_API_BASE_URL") || "http://queue-api:8001";
+}
+
+// Streams a file of a share link; the API checks that it belongs to the link.
+export const handler = async (
+  req: Request,
+  ctx: FreshContext<unknown, { token: string; filepath: string }>,
+): Promise<Response> => {
+  if (req.method !== "GET" && req.method !== "HEAD") {
+    return new Response(null, { status: 405 });
+  }
+
+  try {
+    const filepath = ctx.params.filepath.split("/").map(encodeURIComponent)
+      .join("/");
+    const headers = new Headers();
+    for (const name of ["range", "if-none-match", "if-modified-since"]) {
+      const value = req.headers.get(name);
+      if (value) headers.set(name, value);
+    }
+    const upstream = await fetch(
+      `${queueApiBaseUrl()}/share/${
+        encodeURIComponent(ctx.params.token)
+      }/media/${filepath}`,
+      { method: req.method, headers },
+    );
+    const out = new Headers();
+    for (
+      const name of [
+        "content-type",
+        "content-length",
+        "content-range",
+        "accept-ranges",
+        "etag",
+        "last-modified",
+        "cache-control",
+      ]
+    ) {
+      const value = upstream.headers.get(name);
+      if (value) out.set(name, value);
+    }
+    return new Response(upstream.body, { status: upstream.status, headers: out });
+  } catch (error) {
+    console.error("Error proxying shared media:", error);
+    return new Response("Internal Server Error", { status: 500 });
+  }
+};
@@ -3,6 +3,7 @@
 import { PageProps, FreshContext } from "$fresh/server.ts";
 import type { Image, PagedResponse } from "../../utils/types.ts";
 import { getApiBaseUrl } from "../../utils/api.ts";
+import { fetchSettings, nsfwQuery } from "../../utils/settings.ts";
 import TagImagesPage from "../../islands/TagImagesPage.tsx";
 
 interface TagImagesProps {
@@ -10,6 +11,9 @@ interface TagImagesProps {
   images: Image[];
   currentPage: number;
   totalPages: number;
+  perPage: number;
+  query: string;
+  thumbnailSize: number;
 }
 
 export default function TagImagesRoute({ data }: PageProps<TagImagesProps>) {
@@ -21,11 +25,21 @@ export const handler = async (req: Request, ctx: FreshContext): Promise<Response
   const tag = decodeURIComponent(encodedTag);
   const url = new URL(req.url);
   const page = parseInt(url.searchParams.get("page") || "1");
-  const per_page = parseInt(url.searchParams.get("per_page") || "100");
+  const settings = await fetchSettings();
+  const per_page = parseInt(
+    url.searchParams.get("per_page") || String(settings.default_per_page),
+  );
+  const query = nsfwQuery(settings);
+  const view = {
+    perPage: per_page,
+    query,
+    thumbnailSize: settings.thumbnail_size,
+  };
   const params = new URLSearchParams(url.searchParams);
   params.set("tags", tag);
   params.set("page", String(page));
   params.set("per_page", String(per_page));
+  if (query && !params.has("q")) params.set("q", query);
 
   const API_BASE_URL = getApiBaseUrl();
 
@@ -40,6 +54,7 @@ export const handler = async (req: Request, ctx: FreshContext): Promise<Response
       images: data.items || [],
       currentPage: data.current_page || 1,
       totalPages: data.total_pages || 0,
+      ...view,
     });
   } catch (error) {
     console.error(`Error fetching images for tag ${tag}:`, error);
@@ -48,6 +63,7 @@ export const handler = async (req: Request, ctx: FreshContext): Promise<Response
       images: [],
       currentPage: 1,
       totalPages: 0,
+      ...view,
     });
   }
 };
@@ -1,4 +1,5 @@
 import { PageProps } from "$fresh/server.ts";
+import { Head } from "$fresh/runtime.ts";
 import type { Tweet, PagedResponse } from "../../utils/types.ts";
 import { getApiBaseUrl } from "../../utils/api.ts";
 import UserTweetsPage, { UserTweetsProps } from "../../islands/UserTweetsPage.tsx";
@@ -41,5 +42,17 @@ export const handler: Fresh.Handler<UserTweetsProps> = async (req, ctx) => {
 
 // The new page component is now a simple wrapper that renders the island.
 export default function UserTweetsRoute({ data }: PageProps<UserTweetsProps>) {
-  return <UserTweetsPage {...data} />;
+  return (
+    <>
+      <Head>
+        <link
+          rel="alternate"
+          type="application/atom+xml"
+          title={`${data.username} - x-media-downloder`}
+          href={`/api/users/${encodeURIComponent(data.username)}/feed.atom`}
+        />
+      </Head>
+      <UserTweetsPage {...data} />
+    </>
+  );
 }
@@ -0,0 +1,31 @@
+// utils/settings.ts
+import type { Settings } from "./types.ts";
+import { getApiBaseUrl } from "./api.ts";
+
+// Used when the settings API is unreachable; matches the backend defaults.
+export const DEFAULT_SETTINGS: Settings = {
+  default_sort: "latest",
+  default_per_page: 100,
+  nsfw_visible: true,
+  thumbnail_size: 150,
+};
+
+// Autotagger ratings hidden when nsfw_visible is off.
+const NSFW_RATINGS = ["questionable", "explicit"];
+
+export async function fetchSettings(): Promise<Settings> {
+  try {
+    const res = await fetch(`${getApiBaseUrl()}/api/settings`);
+    if (!res.ok) throw new Error(`HTTP error! status: ${res.status}`);
+    return { ...DEFAULT_SETTINGS, ...(await res.json()) };
+  } catch (error) {
+    console.error("Error fetching settings:", error);
+    return DEFAULT_SETTINGS;
+  }
+}
+
+// Search query (`q`) that hides NSFW images, or "" when they are visible.
+export function nsfwQuery(settings: Settings): string {
+  if (settings.nsfw_visible) return "";
+  return NSFW_RATINGS.map((rating) => `-rating:${rating}`).join(" ");
+}
@@ -13,6 +13,7 @@ export interface DownloadStatus {
     pending?: number;
     success?: number;
     failure?: number;
+    cancelled?: number;
   };
   items?: unknown[];
 }
@@ -2,12 +2,19 @@ export interface Tag {
   tag: string;
   confidence?: number; // Optional, as it might not always be returned
   count?: number; // For tags API
+  category?: string; // Namespace such as "character", tags API only
+  color?: string; // Category color, tags API only
 }
 
 export interface Image {
   path: string;
+  media_type?: "image" | "animated_gif";
   tags?: Tag[];
   mtime?: number; // Only used internally by backend for sorting
+  caption?: string; // Tweet text, attached on the user page
+  hash?: string; // MD5 of the file contents, also served as the ETag
+  favorite?: boolean;
+  rating?: number; // 1-5 stars, absent when unrated
 }
 
 export interface PagedResponse<T> {
@@ -25,5 +32,26 @@ export interface User {
 
 export interface Tweet {
   tweet_id: string;
+  display_name?: string;
+  text?: string;
+  created_at?: string;
   images: Image[];
-}
\ No newline at end of file
+}
+
+export interface TimelineTweet extends Tweet {
+  username: string;
+  posted_at?: string; // Derived from the tweet ID
+  years_ago?: number; // On-this-day results only
+}
+
+export interface TimelineResponse {
+  items: TimelineTweet[];
+  has_more: boolean;
+  next_cursor?: string;
+}
+export interface Settings {
+  default_sort: "latest" | "random" | "popular" | "rating";
+  default_per_page: number;
+  nsfw_visible: boolean;
+  thumbnail_size: number; // Minimum grid cell width in px
+}